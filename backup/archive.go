@@ -0,0 +1,125 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Backups are gzipped tar archives. manifest.json with the sql.Snapshot always comes first, so the schema
+// version can be checked before the rest of the archive is read.
+const manifestFile = "manifest.json"
+
+func writeArchive(writer io.Writer, dir string, snapshot sql.Snapshot) error {
+	compressed := gzip.NewWriter(writer)
+	archive := tar.NewWriter(compressed)
+	manifest, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	createdAt := time.Unix(snapshot.CreatedAt, 0)
+	err = archive.WriteHeader(&tar.Header{Name: manifestFile, Mode: 0600, Size: int64(len(manifest)), ModTime: createdAt})
+	if err != nil {
+		return err
+	}
+	_, err = archive.Write(manifest)
+	if err != nil {
+		return err
+	}
+	for _, name := range snapshot.Files {
+		err = writeArchiveFile(archive, filepath.Join(dir, name), name, createdAt)
+		if err != nil {
+			return err
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+func writeArchiveFile(archive *tar.Writer, path string, name string, modTime time.Time) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	err = archive.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: stat.Size(), ModTime: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, file)
+	return err
+}
+
+// readManifest reads the manifest at the start of the archive and leaves the archive positioned after it.
+func readManifest(reader io.Reader) (snapshot sql.Snapshot, archive *tar.Reader, err error) {
+	compressed, err := gzip.NewReader(reader)
+	if err != nil {
+		return snapshot, nil, err
+	}
+	archive = tar.NewReader(compressed)
+	header, err := archive.Next()
+	if err != nil {
+		return snapshot, nil, err
+	}
+	if header.Name != manifestFile {
+		return snapshot, nil, errors.New("backup doesn't start with a manifest")
+	}
+	err = json.NewDecoder(archive).Decode(&snapshot)
+	return snapshot, archive, err
+}
+
+// extractArchive writes the files listed in the manifest into dir. Other entries are rejected, so an archive
+// can't write outside of dir.
+func extractArchive(archive *tar.Reader, snapshot sql.Snapshot, dir string) error {
+	expected := make(map[string]bool)
+	for _, name := range snapshot.Files {
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return fmt.Errorf("invalid file %s in the manifest", name)
+		}
+		expected[name] = true
+	}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !expected[header.Name] {
+			return fmt.Errorf("unexpected file %s in the backup", header.Name)
+		}
+		delete(expected, header.Name)
+		file, err := os.OpenFile(filepath.Join(dir, header.Name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, archive)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		err = file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for name := range expected {
+		return fmt.Errorf("file %s is missing from the backup", name)
+	}
+	return nil
+}
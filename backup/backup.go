@@ -0,0 +1,348 @@
+package backup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const nameTimeFormat = "20060102-150405"
+
+var backupName = regexp.MustCompile(`^meetplan-(\d{8}-\d{6})\.tar\.gz(\.enc)?$`)
+
+var ErrInvalidName = errors.New("invalid backup name")
+
+// Info describes a backup in the backup directory.
+type Info struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+type RestoreResult struct {
+	Snapshot sql.Snapshot `json:"snapshot"`
+	// Backup of the database as it was before the restore
+	PreviousBackup Info `json:"previous_backup"`
+}
+
+type Manager interface {
+	// Create takes an online backup of the database and prunes old backups afterwards
+	Create() (Info, error)
+	// List returns backups in the backup directory, newest first
+	List() ([]Info, error)
+	// Open opens the backup for downloading
+	Open(name string) (*os.File, error)
+	// Inspect returns the manifest of the backup file without restoring it
+	Inspect(path string) (sql.Snapshot, error)
+	// Prune removes backups the retention policy doesn't keep
+	Prune() (removed []Info, err error)
+	// Restore replaces the database with the backup file, after backing up the current database
+	Restore(path string) (RestoreResult, error)
+	// RunScheduled creates a backup every interval until the process exits
+	RunScheduled(interval time.Duration)
+}
+
+type managerImpl struct {
+	db         sql.SQL
+	dir        string
+	passphrase string
+	policy     RetentionPolicy
+	logger     *zap.SugaredLogger
+	// Backups and restores are serialized, so pruning can't remove a backup that is being restored
+	mutex sync.Mutex
+}
+
+func NewManager(db sql.SQL, config sql.Config, logger *zap.SugaredLogger) Manager {
+	dir := config.BackupDirectory
+	if dir == "" {
+		dir = "backups"
+	}
+	return &managerImpl{
+		db:         db,
+		dir:        dir,
+		passphrase: config.BackupPassphrase,
+		policy: RetentionPolicy{
+			KeepLast:    config.BackupKeepLast,
+			KeepDaily:   config.BackupKeepDaily,
+			KeepWeekly:  config.BackupKeepWeekly,
+			KeepMonthly: config.BackupKeepMonthly,
+		},
+		logger: logger,
+	}
+}
+
+func (m *managerImpl) Create() (Info, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	info, err := m.create()
+	if err != nil {
+		return info, err
+	}
+	_, err = m.prune()
+	return info, err
+}
+
+func (m *managerImpl) create() (info Info, err error) {
+	err = os.MkdirAll(m.dir, 0700)
+	if err != nil {
+		return info, err
+	}
+	createdAt := time.Now().UTC()
+	info = Info{
+		Name:      "meetplan-" + createdAt.Format(nameTimeFormat) + ".tar.gz",
+		CreatedAt: createdAt.Unix(),
+		Encrypted: m.passphrase != "",
+	}
+	if info.Encrypted {
+		info.Name += ".enc"
+	}
+	path := filepath.Join(m.dir, info.Name)
+	if _, err := os.Stat(path); err == nil {
+		return info, fmt.Errorf("backup %s already exists", info.Name)
+	}
+
+	snapshotDir, err := os.MkdirTemp(m.dir, ".snapshot-")
+	if err != nil {
+		return info, err
+	}
+	defer os.RemoveAll(snapshotDir)
+	snapshot, err := m.db.WriteSnapshot(snapshotDir)
+	if err != nil {
+		return info, err
+	}
+
+	// The archive is written under a temporary name, so a failed backup never looks like a complete one
+	partial := filepath.Join(m.dir, "."+info.Name+".partial")
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return info, err
+	}
+	defer os.Remove(partial)
+	err = m.writeBackup(file, snapshotDir, snapshot)
+	if err != nil {
+		file.Close()
+		return info, err
+	}
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		return info, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return info, err
+	}
+	info.Size = stat.Size()
+	err = file.Close()
+	if err != nil {
+		return info, err
+	}
+	err = os.Rename(partial, path)
+	if err != nil {
+		return info, err
+	}
+	m.logger.Infow("created backup", "name", info.Name, "size", info.Size, "schema_version", snapshot.SchemaVersion)
+	return info, nil
+}
+
+func (m *managerImpl) writeBackup(file io.Writer, snapshotDir string, snapshot sql.Snapshot) error {
+	if m.passphrase == "" {
+		return writeArchive(file, snapshotDir, snapshot)
+	}
+	encrypted, err := newEncryptWriter(file, m.passphrase)
+	if err != nil {
+		return err
+	}
+	err = writeArchive(encrypted, snapshotDir, snapshot)
+	if err != nil {
+		return err
+	}
+	return encrypted.Close()
+}
+
+func (m *managerImpl) List() ([]Info, error) {
+	backups := make([]Info, 0)
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return backups, nil
+	}
+	if err != nil {
+		return backups, err
+	}
+	for _, entry := range entries {
+		match := backupName.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		createdAt, err := time.Parse(nameTimeFormat, match[1])
+		if err != nil {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return backups, err
+		}
+		backups = append(backups, Info{
+			Name:      entry.Name(),
+			Size:      stat.Size(),
+			CreatedAt: createdAt.Unix(),
+			Encrypted: match[2] != "",
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt > backups[j].CreatedAt
+	})
+	return backups, nil
+}
+
+func (m *managerImpl) Open(name string) (*os.File, error) {
+	if !backupName.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+	return os.Open(filepath.Join(m.dir, name))
+}
+
+func (m *managerImpl) Prune() ([]Info, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.prune()
+}
+
+func (m *managerImpl) prune() (removed []Info, err error) {
+	removed = make([]Info, 0)
+	if m.policy.IsEmpty() {
+		return removed, nil
+	}
+	backups, err := m.List()
+	if err != nil {
+		return removed, err
+	}
+	_, remove := m.policy.Apply(backups)
+	for _, info := range remove {
+		err = os.Remove(filepath.Join(m.dir, info.Name))
+		if err != nil {
+			return removed, err
+		}
+		m.logger.Infow("removed old backup", "name", info.Name)
+		removed = append(removed, info)
+	}
+	return removed, nil
+}
+
+// openBackup opens the backup file and decrypts it when needed. Whether the backup is encrypted is decided
+// by its content, so renamed backups still work.
+func (m *managerImpl) openBackup(path string) (io.Reader, *os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(file)
+	if !isEncrypted(reader) {
+		return reader, file, nil
+	}
+	if m.passphrase == "" {
+		file.Close()
+		return nil, nil, errors.New("backup is encrypted, but no backup passphrase is configured")
+	}
+	decrypted, err := newDecryptReader(reader, m.passphrase)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return decrypted, file, nil
+}
+
+func (m *managerImpl) Inspect(path string) (sql.Snapshot, error) {
+	reader, file, err := m.openBackup(path)
+	if err != nil {
+		return sql.Snapshot{}, err
+	}
+	defer file.Close()
+	snapshot, _, err := readManifest(reader)
+	return snapshot, err
+}
+
+// checkSnapshot rejects backups that can't be restored into the database, before anything is extracted.
+func (m *managerImpl) checkSnapshot(snapshot sql.Snapshot) error {
+	latest := sql.LatestSchemaVersion()
+	if snapshot.SchemaVersion > latest {
+		return fmt.Errorf("backup has schema version %d, which is newer than the newest version %d known to this MeetPlan binary, please upgrade MeetPlan", snapshot.SchemaVersion, latest)
+	}
+	version, err := m.db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if snapshot.Driver == "postgres" && version != snapshot.SchemaVersion {
+		return fmt.Errorf("backup has schema version %d, but the database %d, PostgreSQL backups can only be restored into a database with the same schema version", snapshot.SchemaVersion, version)
+	}
+	return nil
+}
+
+func (m *managerImpl) Restore(path string) (result RestoreResult, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reader, file, err := m.openBackup(path)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+	snapshot, archive, err := readManifest(reader)
+	if err != nil {
+		return result, err
+	}
+	result.Snapshot = snapshot
+	err = m.checkSnapshot(snapshot)
+	if err != nil {
+		return result, err
+	}
+
+	err = os.MkdirAll(m.dir, 0700)
+	if err != nil {
+		return result, err
+	}
+	restoreDir, err := os.MkdirTemp(m.dir, ".restore-")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(restoreDir)
+	err = extractArchive(archive, snapshot, restoreDir)
+	if err != nil {
+		return result, err
+	}
+
+	// Until this point the database is untouched. It is backed up before it is replaced, so a wrong restore
+	// can be undone.
+	result.PreviousBackup, err = m.create()
+	if err != nil {
+		return result, fmt.Errorf("failed to back up the database before restoring: %s", err.Error())
+	}
+	err = m.db.RestoreSnapshot(restoreDir, snapshot)
+	if err != nil {
+		return result, err
+	}
+	m.logger.Infow("restored backup", "path", path, "schema_version", snapshot.SchemaVersion, "previous_backup", result.PreviousBackup.Name)
+	return result, nil
+}
+
+func (m *managerImpl) RunScheduled(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_, err := m.Create()
+		if err != nil {
+			m.logger.Errorw("scheduled backup failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/scrypt"
+	"io"
+)
+
+// Encrypted backups start with encryptionMagic, the scrypt salt and a random nonce prefix. The rest is split
+// into chunks, each sealed with AES-256-GCM. The nonce of a chunk consists of the prefix, the chunk's counter
+// and a flag marking the last chunk, so chunks can't be reordered, dropped or cut off without failing to open.
+const (
+	encryptionMagic = "MEETPLAN-BACKUP1"
+	saltSize        = 16
+	noncePrefixSize = 7
+	chunkSize       = 64 * 1024
+)
+
+var ErrWrongPassphrase = errors.New("backup can't be decrypted, the passphrase is wrong or the backup is corrupted")
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	writer  io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buffer  []byte
+}
+
+// newEncryptWriter encrypts everything written to it with a key derived from the passphrase. Close has to be
+// called to write the last chunk, it doesn't close the underlying writer.
+func newEncryptWriter(writer io.Writer, passphrase string) (io.WriteCloser, error) {
+	header := make([]byte, saltSize+noncePrefixSize)
+	_, err := rand.Read(header)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, header[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	_, err = writer.Write(append([]byte(encryptionMagic), header...))
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{writer: writer, aead: aead, prefix: header[saltSize:], buffer: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) seal(chunk []byte, last bool) error {
+	_, err := e.writer.Write(e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, last), chunk, nil))
+	e.counter++
+	return err
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	e.buffer = append(e.buffer, p...)
+	// A full chunk is only sealed once more data follows, as the last chunk is sealed differently
+	for len(e.buffer) > chunkSize {
+		err := e.seal(e.buffer[:chunkSize], false)
+		if err != nil {
+			return 0, err
+		}
+		e.buffer = append(e.buffer[:0], e.buffer[chunkSize:]...)
+	}
+	return len(p), nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(e.buffer, true)
+}
+
+type decryptReader struct {
+	reader  *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+// isEncrypted checks whether the backup starts with the header of encrypted backups.
+func isEncrypted(reader *bufio.Reader) bool {
+	magic, err := reader.Peek(len(encryptionMagic))
+	return err == nil && string(magic) == encryptionMagic
+}
+
+func newDecryptReader(reader *bufio.Reader, passphrase string) (io.Reader, error) {
+	header := make([]byte, len(encryptionMagic)+saltSize+noncePrefixSize)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+	header = header[len(encryptionMagic):]
+	aead, err := newAEAD(passphrase, header[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{reader: reader, aead: aead, prefix: header[saltSize:]}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		sealed := make([]byte, chunkSize+d.aead.Overhead())
+		n, err := io.ReadFull(d.reader, sealed)
+		last := false
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			last = true
+		} else if err != nil {
+			return 0, err
+		} else if _, err := d.reader.Peek(1); err == io.EOF {
+			last = true
+		}
+		d.plain, err = d.aead.Open(nil, chunkNonce(d.prefix, d.counter, last), sealed[:n], nil)
+		if err != nil {
+			return 0, ErrWrongPassphrase
+		}
+		d.counter++
+		d.done = last
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy decides which backups are kept when old ones are pruned. A backup is kept when any of
+// the rules keeps it. A policy without rules keeps everything.
+type RetentionPolicy struct {
+	// Number of newest backups to keep
+	KeepLast int
+	// Number of days, weeks and months for which the newest backup of each is kept
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+func (policy RetentionPolicy) IsEmpty() bool {
+	return policy.KeepLast <= 0 && policy.KeepDaily <= 0 && policy.KeepWeekly <= 0 && policy.KeepMonthly <= 0
+}
+
+// Apply splits backups into the ones the policy keeps and the ones it removes, both sorted newest first.
+// Days, weeks and months are counted in the server's time zone, and only those with a backup count.
+func (policy RetentionPolicy) Apply(backups []Info) (keep []Info, remove []Info) {
+	keep = make([]Info, 0)
+	remove = make([]Info, 0)
+	sorted := make([]Info, len(backups))
+	copy(sorted, backups)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt > sorted[j].CreatedAt
+	})
+	if policy.IsEmpty() {
+		return sorted, remove
+	}
+
+	kept := make([]bool, len(sorted))
+	for i := 0; i < len(sorted) && i < policy.KeepLast; i++ {
+		kept[i] = true
+	}
+	buckets := []struct {
+		count  int
+		bucket func(t time.Time) string
+	}{
+		{policy.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{policy.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, b := range buckets {
+		seen := 0
+		last := ""
+		for i := 0; i < len(sorted) && seen < b.count; i++ {
+			bucket := b.bucket(time.Unix(sorted[i].CreatedAt, 0).Local())
+			// Backups are sorted newest first, so the first backup of each bucket is its newest one
+			if bucket != last {
+				kept[i] = true
+				seen++
+				last = bucket
+			}
+		}
+	}
+
+	for i := 0; i < len(sorted); i++ {
+		if kept[i] {
+			keep = append(keep, sorted[i])
+		} else {
+			remove = append(remove, sorted[i])
+		}
+	}
+	return keep, remove
+}
@@ -0,0 +1,244 @@
+package calendar
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"go.uber.org/zap"
+	"net/url"
+	"strings"
+	"time"
+	// Minimal container images don't ship time zone data
+	_ "time/tzdata"
+)
+
+// DefaultTimeZone is the time zone of lesson times when sql.Config.TimeZone is empty.
+const DefaultTimeZone = "Europe/Ljubljana"
+
+// DefaultLessonTimes are the usual times of school hours in Slovenia, starting with the early hour 0.
+var DefaultLessonTimes = []string{
+	"07:30-08:15",
+	"08:20-09:05",
+	"09:10-09:55",
+	"10:15-11:00",
+	"11:05-11:50",
+	"11:55-12:40",
+	"12:45-13:30",
+	"13:35-14:20",
+	"14:25-15:10",
+}
+
+// RefreshInterval is how often calendar apps are asked to fetch the feed again.
+const RefreshInterval = 1 * time.Hour
+
+// Lesson is the time of a school hour, as time since midnight.
+type Lesson struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseLessonTimes parses lesson times such as "07:30-08:15", DefaultLessonTimes when there are none.
+func ParseLessonTimes(values []string) ([]Lesson, error) {
+	if len(values) == 0 {
+		values = DefaultLessonTimes
+	}
+	lessons := make([]Lesson, 0)
+	for i := 0; i < len(values); i++ {
+		parts := strings.Split(values[i], "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid time of hour %d: %s", i, values[i])
+		}
+		start, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of hour %d: %s", i, values[i])
+		}
+		end, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+		if err != nil || !end.After(start) {
+			return nil, fmt.Errorf("invalid time of hour %d: %s", i, values[i])
+		}
+		lessons = append(lessons, Lesson{
+			Start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+			End:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+		})
+	}
+	return lessons, nil
+}
+
+// Feed builds the calendar of a user's timetable: meetings they teach, meetings of their subjects and
+// meetings of their children's subjects. Parents only see which meetings are gradings and tests when the
+// school lets them view gradings.
+type Feed interface {
+	Calendar(user sql.User) (Calendar, error)
+	Event(meeting sql.Meeting) (Event, error)
+}
+
+type feedImpl struct {
+	db       sql.SQL
+	config   sql.Config
+	logger   *zap.SugaredLogger
+	lessons  []Lesson
+	location *time.Location
+	// subjects and teachers are looked up once per feed
+	subjects map[int]sql.Subject
+	teachers map[int]string
+}
+
+// NewFeed returns a Feed using lesson times and the time zone of the configuration.
+func NewFeed(db sql.SQL, config sql.Config, logger *zap.SugaredLogger) (Feed, error) {
+	lessons, err := ParseLessonTimes(config.LessonTimes)
+	if err != nil {
+		return nil, err
+	}
+	zone := config.TimeZone
+	if zone == "" {
+		zone = DefaultTimeZone
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, err
+	}
+	return &feedImpl{
+		db:       db,
+		config:   config,
+		logger:   logger,
+		lessons:  lessons,
+		location: location,
+		subjects: make(map[int]sql.Subject),
+		teachers: make(map[int]string),
+	}, nil
+}
+
+func (f *feedImpl) Calendar(user sql.User) (Calendar, error) {
+	calendar := Calendar{
+		Name:            "MeetPlan - " + user.Name,
+		RefreshInterval: RefreshInterval,
+		Events:          make([]Event, 0),
+	}
+	if f.config.SchoolName != "" {
+		calendar.Name = f.config.SchoolName + " - " + user.Name
+	}
+	meetings, err := f.db.GetMeetingsForUser(user.ID)
+	if err != nil {
+		return calendar, err
+	}
+	hideGradings := user.Role == "parent" && !f.config.ParentViewGradings
+	for i := 0; i < len(meetings); i++ {
+		meeting := meetings[i]
+		if hideGradings {
+			meeting.IsGrading = false
+			meeting.IsWrittenAssessment = false
+			meeting.IsTest = false
+		}
+		event, err := f.Event(meeting)
+		if err != nil {
+			// A meeting whose subject or teacher was deleted shouldn't break the whole feed
+			if err.Error() == "sql: no rows in result set" {
+				f.logger.Warnw("skipped meeting with a missing subject or teacher in calendar feed",
+					"meeting_id", meeting.ID, "subject_id", meeting.SubjectID, "teacher_id", meeting.TeacherID)
+				continue
+			}
+			return calendar, err
+		}
+		calendar.Events = append(calendar.Events, event)
+	}
+	return calendar, nil
+}
+
+// Event turns the meeting into an event at the time of its hour. Meetings in hours without a configured time
+// become all-day events. Substitutions, gradings and tests are marked in the summary and with categories.
+func (f *feedImpl) Event(meeting sql.Meeting) (Event, error) {
+	event := Event{
+		UID:        fmt.Sprintf("meeting-%d@%s", meeting.ID, f.domain()),
+		Summary:    meeting.MeetingName,
+		URL:        meeting.URL,
+		Categories: make([]string, 0),
+	}
+	year, month, day := meeting.Date.Date()
+	if meeting.Hour >= 0 && meeting.Hour < len(f.lessons) {
+		midnight := time.Date(year, month, day, 0, 0, 0, 0, f.location)
+		event.Start = midnight.Add(f.lessons[meeting.Hour].Start)
+		event.End = midnight.Add(f.lessons[meeting.Hour].End)
+	} else {
+		event.AllDay = true
+		event.Start = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		event.End = event.Start.AddDate(0, 0, 1)
+	}
+
+	markers := make([]string, 0)
+	if meeting.IsSubstitution {
+		markers = append(markers, "Nadomeščanje")
+	}
+	if meeting.IsGrading {
+		if meeting.IsWrittenAssessment {
+			markers = append(markers, "Pisno ocenjevanje")
+		} else {
+			markers = append(markers, "Ocenjevanje")
+		}
+	}
+	if meeting.IsTest {
+		markers = append(markers, "Preverjanje znanja")
+	}
+	if len(markers) != 0 {
+		event.Summary = fmt.Sprintf("[%s] %s", strings.Join(markers, ", "), meeting.MeetingName)
+		event.Categories = markers
+	}
+	if meeting.IsGrading || meeting.IsTest {
+		event.Priority = 1
+	}
+
+	description := make([]string, 0)
+	subject, err := f.subject(meeting.SubjectID)
+	if err != nil {
+		return event, err
+	}
+	if subject.LongName != "" {
+		description = append(description, "Predmet: "+subject.LongName)
+	}
+	teacher, err := f.teacher(meeting.TeacherID)
+	if err != nil {
+		return event, err
+	}
+	if meeting.IsSubstitution {
+		description = append(description, "Nadomešča: "+teacher)
+	} else {
+		description = append(description, "Učitelj: "+teacher)
+	}
+	description = append(description, fmt.Sprintf("%d. ura", meeting.Hour))
+	if meeting.Details != "" {
+		description = append(description, "", meeting.Details)
+	}
+	event.Description = strings.Join(description, "\n")
+	return event, nil
+}
+
+// domain makes UIDs unique across schools, as a calendar app can subscribe to feeds of several.
+func (f *feedImpl) domain() string {
+	frontend, err := url.Parse(f.config.FrontendURL)
+	if err != nil || frontend.Hostname() == "" {
+		return "meetplan"
+	}
+	return frontend.Hostname()
+}
+
+func (f *feedImpl) subject(id int) (sql.Subject, error) {
+	if subject, ok := f.subjects[id]; ok {
+		return subject, nil
+	}
+	subject, err := f.db.GetSubject(id)
+	if err != nil {
+		return subject, err
+	}
+	f.subjects[id] = subject
+	return subject, nil
+}
+
+func (f *feedImpl) teacher(id int) (string, error) {
+	if name, ok := f.teachers[id]; ok {
+		return name, nil
+	}
+	teacher, err := f.db.GetUser(id)
+	if err != nil {
+		return "", err
+	}
+	f.teachers[id] = teacher.Name
+	return teacher.Name, nil
+}
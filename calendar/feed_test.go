@@ -0,0 +1,49 @@
+package calendar
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/MeetPlan/MeetPlanBackend/sql/fixtures"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// TestCalendarSkipsBrokenMeetings makes sure a meeting whose teacher is gone doesn't break the feed of
+// everybody attending the subject.
+func TestCalendarSkipsBrokenMeetings(t *testing.T) {
+	db, err := fixtures.NewDatabase(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	school, err := fixtures.NewSchool(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The substitute teacher doesn't exist
+	broken, err := fixtures.NewMeeting(db, school.Subject).At(sql.Today(), 2).Substitution(1000000).Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := NewFeed(db, sql.Config{}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar, err := feed.Calendar(school.Student())
+	if err != nil {
+		t.Fatalf("broken meeting failed the feed: %v", err)
+	}
+	if len(calendar.Events) != 1 {
+		t.Fatalf("events: got %d, want 1", len(calendar.Events))
+	}
+	event, err := feed.Event(school.Meeting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calendar.Events[0].UID != event.UID {
+		t.Errorf("event: got %s, want %s", calendar.Events[0].UID, event.UID)
+	}
+	_, err = feed.Event(broken)
+	if err == nil {
+		t.Error("event of a meeting without a teacher was built")
+	}
+}
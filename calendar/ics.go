@@ -0,0 +1,164 @@
+// Package calendar turns timetables into iCalendar (RFC 5545) feeds, which calendar apps on phones and computers
+// can subscribe to.
+package calendar
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	utcFormat  = "20060102T150405Z"
+	dateFormat = "20060102"
+	// lines longer than this many octets have to be folded
+	maxLineLength = 75
+)
+
+// Event is a VEVENT of a calendar.
+type Event struct {
+	// UID has to stay the same for the same meeting, so calendar apps update events instead of duplicating them
+	UID   string
+	Start time.Time
+	End   time.Time
+	// All-day events only use the day of Start and End, End is the day after the last day of the event
+	AllDay      bool
+	Summary     string
+	Description string
+	URL         string
+	Categories  []string
+	// 1 is the highest priority, 0 leaves it undefined
+	Priority int
+}
+
+// Calendar is a VCALENDAR with the events of a feed.
+type Calendar struct {
+	Name string
+	// How often calendar apps should fetch the feed again
+	RefreshInterval time.Duration
+	Events          []Event
+}
+
+// escape escapes a TEXT value.
+func escape(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(value)
+}
+
+// uri strips control characters from a URI value. URIs aren't escaped like text, so a line break in one would
+// start a new property or component of the calendar.
+func uri(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// fold splits a content line into lines of at most maxLineLength octets, continued lines start with a space.
+// Multi-byte characters are never split.
+func fold(line string) string {
+	var b strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > maxLineLength {
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// duration formats a duration of whole seconds as a DURATION value.
+func duration(d time.Duration) string {
+	return "PT" + strconv.Itoa(int(d.Seconds())) + "S"
+}
+
+// WriteTo writes the calendar in the iCalendar format. Times are written in UTC, so the feed doesn't need
+// time zone definitions.
+func (c Calendar) WriteTo(w io.Writer) (int64, error) {
+	writer := &countingWriter{w: bufio.NewWriter(w)}
+	line := func(name string, value string) {
+		writer.WriteString(fold(name + ":" + value))
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//MeetPlan//MeetPlan Backend//SL")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("NAME", escape(c.Name))
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	if c.RefreshInterval != 0 {
+		line("REFRESH-INTERVAL;VALUE=DURATION", duration(c.RefreshInterval))
+		line("X-PUBLISHED-TTL", duration(c.RefreshInterval))
+	}
+	stamp := time.Now().UTC().Format(utcFormat)
+	for _, event := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(event.UID))
+		line("DTSTAMP", stamp)
+		if event.AllDay {
+			line("DTSTART;VALUE=DATE", event.Start.Format(dateFormat))
+			line("DTEND;VALUE=DATE", event.End.Format(dateFormat))
+		} else {
+			line("DTSTART", event.Start.UTC().Format(utcFormat))
+			line("DTEND", event.End.UTC().Format(utcFormat))
+		}
+		line("SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escape(event.Description))
+		}
+		if url := uri(event.URL); url != "" {
+			line("URL", url)
+		}
+		if len(event.Categories) != 0 {
+			categories := make([]string, 0)
+			for i := 0; i < len(event.Categories); i++ {
+				categories = append(categories, escape(event.Categories[i]))
+			}
+			line("CATEGORIES", strings.Join(categories, ","))
+		}
+		if event.Priority != 0 {
+			line("PRIORITY", strconv.Itoa(event.Priority))
+		}
+		line("STATUS", "CONFIRMED")
+		line("TRANSP", "OPAQUE")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	if writer.err != nil {
+		return writer.n, writer.err
+	}
+	return writer.n, writer.w.Flush()
+}
+
+// countingWriter remembers the first error, so WriteTo can write lines without checking every one of them.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) WriteString(s string) {
+	if c.err != nil {
+		return
+	}
+	n, err := c.w.WriteString(s)
+	c.n += int64(n)
+	c.err = err
+}
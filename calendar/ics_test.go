@@ -0,0 +1,101 @@
+package calendar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short line", "SUMMARY:Matematika", "SUMMARY:Matematika\r\n"},
+		{"exactly 75 octets", strings.Repeat("a", 75), strings.Repeat("a", 75) + "\r\n"},
+		{"76 octets", strings.Repeat("a", 76), strings.Repeat("a", 75) + "\r\n a\r\n"},
+		{"continued lines", strings.Repeat("a", 150), strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n a\r\n"},
+		// č takes 2 octets, so the 38th one doesn't fit into the first line anymore
+		{"multi-byte characters", strings.Repeat("č", 38), strings.Repeat("č", 37) + "\r\n č\r\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := fold(test.line)
+			if got != test.want {
+				t.Errorf("fold(%q) = %q, want %q", test.line, got, test.want)
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+				if len(line) > maxLineLength {
+					t.Errorf("line of %d octets: %q", len(line), line)
+				}
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Matematika", "Matematika"},
+		{`a\b`, `a\\b`},
+		{"a;b,c", `a\;b\,c`},
+		{"a\nb", `a\nb`},
+		{"a\r\nb", `a\nb`},
+		{"a\rb", `a\nb`},
+	}
+	for _, test := range tests {
+		got := escape(test.value)
+		if got != test.want {
+			t.Errorf("escape(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+// TestWriteToInjection makes sure values of events can't add properties or components to the calendar.
+func TestWriteToInjection(t *testing.T) {
+	injected := "\r\nEND:VEVENT\r\nBEGIN:VEVENT\r\nSUMMARY:Injected\nATTACH:https://example.com/x"
+	calendar := Calendar{
+		Name: "Šola" + injected,
+		Events: []Event{{
+			UID:         "meeting-1@meetplan" + injected,
+			Start:       time.Date(2022, 9, 1, 8, 20, 0, 0, time.UTC),
+			End:         time.Date(2022, 9, 1, 9, 5, 0, 0, time.UTC),
+			Summary:     "Matematika" + injected,
+			Description: "Učitelj: Janez" + injected,
+			URL:         "https://meet.example.com/abc" + injected,
+			Categories:  []string{"Ocenjevanje" + injected},
+		}},
+	}
+	var buffer bytes.Buffer
+	_, err := calendar.WriteTo(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := buffer.String()
+
+	// Every line is either a continuation of the previous one or a property of the calendar
+	lines := strings.Split(strings.TrimSuffix(output, "\r\n"), "\r\n")
+	begins := 0
+	for _, line := range lines {
+		if strings.ContainsAny(line, "\r\n") {
+			t.Errorf("bare line break in %q", line)
+		}
+		if line == "BEGIN:VEVENT" {
+			begins++
+		}
+		if strings.HasPrefix(line, "SUMMARY:Injected") || strings.HasPrefix(line, "ATTACH:") {
+			t.Errorf("injected property: %q", line)
+		}
+	}
+	if begins != 1 {
+		t.Errorf("events: got %d, want 1", begins)
+	}
+	unfolded := strings.ReplaceAll(output, "\r\n ", "")
+	if !strings.Contains(unfolded, "\r\nURL:https://meet.example.com/abcEND:VEVENTBEGIN:VEVENTSUMMARY:InjectedATTACH:https://example.com/x\r\n") {
+		t.Errorf("URL wasn't stripped of line breaks:\n%s", unfolded)
+	}
+}
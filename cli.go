@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/backup"
+	"github.com/MeetPlan/MeetPlanBackend/gdpr"
+	"github.com/MeetPlan/MeetPlanBackend/importer"
+	"github.com/MeetPlan/MeetPlanBackend/oidc"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand runs the command given on the command line. It returns false when no command was given,
+// in which case the HTTP server should be started. Flags such as --useenv belong to the server.
+func runCommand(args []string, db sql.SQL, config sql.Config, logger *zap.SugaredLogger) bool {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return false
+	}
+	switch args[0] {
+	case "import-students":
+		os.Exit(importStudents(args[1:], db, logger))
+	case "export-user":
+		os.Exit(exportUser(args[1:], db, config, logger))
+	case "mock-idp":
+		os.Exit(mockIdentityProvider(args[1:], logger))
+	case "rekey-audit-log":
+		os.Exit(rekeyAuditLog(args[1:], db, logger))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n", args[0])
+		os.Exit(2)
+	}
+	return true
+}
+
+func rekeyAuditLog(args []string, db sql.SQL, logger *zap.SugaredLogger) int {
+	flags := flag.NewFlagSet("rekey-audit-log", flag.ExitOnError)
+	oldKey := flags.String("old-key", "", "previous audit_key, empty for audit logs written before the key was introduced")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: MeetPlanBackend rekey-audit-log [-old-key key]")
+		fmt.Fprintln(os.Stderr, "Verifies the audit log with the old key and hashes it again with audit_key from the config.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	verification, err := db.RekeyAuditLog(*oldKey)
+	if err != nil {
+		logger.Error("Failed to rekey audit log: " + err.Error())
+		return 1
+	}
+	if !verification.Valid {
+		logger.Errorw("audit log doesn't match the old key, nothing was changed", "broken_at", verification.BrokenAt)
+		return 1
+	}
+	fmt.Printf("Rekeyed %d audit log entries\n", verification.Entries)
+	return 0
+}
+
+func importStudents(args []string, db sql.SQL, logger *zap.SugaredLogger) int {
+	flags := flag.NewFlagSet("import-students", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only validate the CSV file without importing anything")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: MeetPlanBackend import-students [-dry-run] students.csv")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		logger.Error(err)
+		return 1
+	}
+	defer file.Close()
+	// Imports from the command line are recorded in the audit log without a user
+	auditedDb := db.WithActor(sql.AuditActor{UserID: -1, Role: "", Endpoint: "CLI import-students"})
+	report, err := importer.NewImporter(auditedDb).ImportStudents(file, *dryRun)
+	if err != nil {
+		logger.Error("Failed to import students: " + err.Error())
+		return 1
+	}
+	marshal, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		logger.Error(err)
+		return 1
+	}
+	fmt.Println(string(marshal))
+	if len(report.Errors) != 0 {
+		return 1
+	}
+	return 0
+}
+
+func exportUser(args []string, db sql.SQL, config sql.Config, logger *zap.SugaredLogger) int {
+	flags := flag.NewFlagSet("export-user", flag.ExitOnError)
+	output := flags.String("o", "", "output ZIP file, meetplan-export-<id>.zip by default")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: MeetPlanBackend export-user [-o export.zip] user_id")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	userId, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		flags.Usage()
+		return 2
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("meetplan-export-%d.zip", userId)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		logger.Error(err)
+		return 1
+	}
+	defer file.Close()
+	err = gdpr.NewExporter(db, config).WriteZIP(userId, file)
+	if err != nil {
+		logger.Error("Failed to export user data: " + err.Error())
+		os.Remove(*output)
+		return 1
+	}
+	fmt.Println(*output)
+	return 0
+}
+
+// mockIdentityProvider runs a local OpenID Connect identity provider for testing single sign-on without a real one.
+func mockIdentityProvider(args []string, logger *zap.SugaredLogger) int {
+	flags := flag.NewFlagSet("mock-idp", flag.ExitOnError)
+	issuer := flags.String("issuer", "http://127.0.0.1:9000", "issuer URL, the server listens on its host")
+	clientId := flags.String("client-id", "meetplan", "client ID MeetPlan is configured with")
+	clientSecret := flags.String("client-secret", "meetplan", "client secret MeetPlan is configured with")
+	usersFile := flags.String("users", "", "JSON file with an array of users ({sub, email, name, groups})")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: MeetPlanBackend mock-idp [-issuer url] [-client-id id] [-client-secret secret] [-users users.json]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	users := []oidc.MockUser{{Subject: "1", Email: "admin@example.com", Name: "Admin", Groups: []string{}}}
+	if *usersFile != "" {
+		file, err := os.ReadFile(*usersFile)
+		if err != nil {
+			logger.Error(err)
+			return 1
+		}
+		err = json.Unmarshal(file, &users)
+		if err != nil {
+			logger.Error(err)
+			return 1
+		}
+	}
+	u, err := url.Parse(*issuer)
+	if err != nil {
+		logger.Error(err)
+		return 2
+	}
+	handler, err := oidc.NewMockProvider(*issuer, *clientId, *clientSecret, users)
+	if err != nil {
+		logger.Error(err)
+		return 1
+	}
+	logger.Infow("Starting mock identity provider", "issuer", *issuer)
+	err = http.ListenAndServe(u.Host, handler)
+	if err != nil {
+		logger.Error(err)
+		return 1
+	}
+	return 0
+}
+
+// migrate manages the database schema. It runs before the database is initialized, so it also works
+// when migrations are skipped at startup.
+func migrate(args []string, db sql.SQL, logger *zap.SugaredLogger) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert with down")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: MeetPlanBackend migrate [-steps n] status|up|down")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	switch flags.Arg(0) {
+	case "status":
+		status, err := db.GetMigrationStatus()
+		if err != nil {
+			logger.Error(err)
+			return 1
+		}
+		version, err := db.SchemaVersion()
+		if err != nil {
+			logger.Error(err)
+			return 1
+		}
+		fmt.Printf("Schema version %d, newest known version %d\n", version, sql.LatestSchemaVersion())
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + time.Unix(s.AppliedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+	case "up":
+		applied, err := db.MigrateUp()
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			logger.Error("Failed to migrate database: " + err.Error())
+			return 1
+		}
+	case "down":
+		if *steps < 1 {
+			flags.Usage()
+			return 2
+		}
+		reverted, err := db.MigrateDown(*steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			logger.Error("Failed to revert migrations: " + err.Error())
+			return 1
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+	return 0
+}
+
+// backupCommand manages backups of the configured database. The server should be stopped before restoring,
+// as it keeps signing keys and other state of the replaced database in memory.
+func backupCommand(args []string, db sql.SQL, config sql.Config, logger *zap.SugaredLogger) int {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: MeetPlanBackend backup create|list|prune|inspect backup-file|restore backup-file")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+	backups := backup.NewManager(db, config, logger)
+	switch flags.Arg(0) {
+	case "create":
+		info, err := backups.Create()
+		if err != nil {
+			logger.Error("Failed to create backup: " + err.Error())
+			return 1
+		}
+		fmt.Printf("Created %s (%d bytes)\n", info.Name, info.Size)
+	case "list":
+		list, err := backups.List()
+		if err != nil {
+			logger.Error(err)
+			return 1
+		}
+		for _, info := range list {
+			fmt.Printf("%s\t%d\t%s\n", info.Name, info.Size, time.Unix(info.CreatedAt, 0).Format(time.RFC3339))
+		}
+	case "prune":
+		removed, err := backups.Prune()
+		for _, info := range removed {
+			fmt.Printf("Removed %s\n", info.Name)
+		}
+		if err != nil {
+			logger.Error("Failed to prune backups: " + err.Error())
+			return 1
+		}
+	case "inspect":
+		if flags.NArg() != 2 {
+			flags.Usage()
+			return 2
+		}
+		snapshot, err := backups.Inspect(flags.Arg(1))
+		if err != nil {
+			logger.Error(err)
+			return 1
+		}
+		fmt.Printf("Driver %s, schema version %d, created %s\n", snapshot.Driver, snapshot.SchemaVersion, time.Unix(snapshot.CreatedAt, 0).Format(time.RFC3339))
+	case "restore":
+		if flags.NArg() != 2 {
+			flags.Usage()
+			return 2
+		}
+		result, err := backups.Restore(flags.Arg(1))
+		if result.PreviousBackup.Name != "" {
+			fmt.Printf("Previous database was backed up to %s\n", result.PreviousBackup.Name)
+		}
+		if err != nil {
+			logger.Error("Failed to restore backup: " + err.Error())
+			return 1
+		}
+		fmt.Printf("Restored backup with schema version %d\n", result.Snapshot.SchemaVersion)
+		// Backups of older MeetPlan versions are brought up to date right away, the same as at startup
+		if !config.SkipMigrations {
+			applied, err := db.MigrateUp()
+			for _, m := range applied {
+				fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+			}
+			if err != nil {
+				logger.Error("Failed to migrate restored database: " + err.Error())
+				return 1
+			}
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+	return 0
+}
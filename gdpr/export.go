@@ -0,0 +1,360 @@
+package gdpr
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"io"
+	"time"
+)
+
+// Profile is the user's row without credentials.
+type Profile struct {
+	ID                     int
+	Email                  string
+	Role                   string
+	Name                   string
+	BirthCertificateNumber string
+	Birthday               sql.Date
+	CityOfBirth            string
+	CountryOfBirth         string
+	// Children of parents
+	LinkedUsers    []int
+	IsPassing      bool
+	TwoFactorLogin bool
+}
+
+type Grade struct {
+	sql.Grade
+	SubjectName string
+	TeacherName string
+}
+
+type Absence struct {
+	sql.Absence
+	MeetingName string
+	MeetingDate sql.Date
+	MeetingHour int
+}
+
+type HomeworkStatus struct {
+	sql.StudentHomework
+	HomeworkName string
+	SubjectName  string
+	ToDate       sql.Date
+}
+
+// ArchivedYear is the user's data from a school year that was archived by the rollover.
+type ArchivedYear struct {
+	SchoolYear string
+	ClassName  string
+	// promoted, retained or graduated
+	Outcome  string
+	Grades   []Grade
+	Absences []sql.Absence
+	Homework []sql.StudentHomework
+}
+
+type MealOrder struct {
+	MealID    int
+	Date      sql.Date
+	MealTitle string
+	Meals     string
+	Price     float32
+}
+
+type Communication struct {
+	ID          int
+	Title       string
+	DateCreated time.Time
+	Messages    []sql.Message
+}
+
+// Export is everything MeetPlan stores about a single user.
+type Export struct {
+	GeneratedAt    string
+	Profile        Profile
+	Grades         []Grade
+	Absences       []Absence
+	Homework       []HomeworkStatus
+	ArchivedYears  []ArchivedYear
+	SelfTesting    []sql.Testing
+	MealOrders     []MealOrder
+	Communications []Communication
+	// Messages written by the user
+	Messages []sql.Message
+}
+
+type Exporter interface {
+	Collect(userId int) (Export, error)
+	// WriteZIP writes the export as a ZIP file with export.json and export.pdf
+	WriteZIP(userId int, writer io.Writer) error
+}
+
+type exporterImpl struct {
+	db sql.SQL
+	// Directory with the font the PDF is rendered with
+	fontDirectory string
+}
+
+func NewExporter(db sql.SQL, config sql.Config) Exporter {
+	return &exporterImpl{db: db, fontDirectory: config.AssetPath("fonts")}
+}
+
+func (e *exporterImpl) Collect(userId int) (export Export, err error) {
+	user, err := e.db.GetUser(userId)
+	if err != nil {
+		return export, err
+	}
+	linked, err := e.db.GetChildren(userId)
+	if err != nil {
+		return export, err
+	}
+	export = Export{
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		Profile: Profile{
+			ID:                     user.ID,
+			Email:                  user.Email,
+			Role:                   user.Role,
+			Name:                   user.Name,
+			BirthCertificateNumber: user.BirthCertificateNumber,
+			Birthday:               user.Birthday,
+			CityOfBirth:            user.CityOfBirth,
+			CountryOfBirth:         user.CountryOfBirth,
+			LinkedUsers:            linked,
+			IsPassing:              user.IsPassing,
+			TwoFactorLogin:         user.TOTPEnabled,
+		},
+		Grades:         make([]Grade, 0),
+		Absences:       make([]Absence, 0),
+		Homework:       make([]HomeworkStatus, 0),
+		ArchivedYears:  make([]ArchivedYear, 0),
+		MealOrders:     make([]MealOrder, 0),
+		Communications: make([]Communication, 0),
+		Messages:       make([]sql.Message, 0),
+	}
+
+	grades, err := e.db.GetGradesForUser(userId)
+	if err != nil {
+		return export, err
+	}
+	for i := 0; i < len(grades); i++ {
+		grade := Grade{Grade: grades[i]}
+		subject, err := e.db.GetSubject(grades[i].SubjectID)
+		if err == nil {
+			grade.SubjectName = subject.Name
+		}
+		teacher, err := e.db.GetUser(grades[i].TeacherID)
+		if err == nil {
+			grade.TeacherName = teacher.Name
+		}
+		export.Grades = append(export.Grades, grade)
+	}
+
+	absences, err := e.db.GetAbsencesForUser(userId)
+	if err != nil {
+		return export, err
+	}
+	for i := 0; i < len(absences); i++ {
+		absence := Absence{Absence: absences[i]}
+		meeting, err := e.db.GetMeeting(absences[i].MeetingID)
+		if err == nil {
+			absence.MeetingName = meeting.MeetingName
+			absence.MeetingDate = meeting.Date
+			absence.MeetingHour = meeting.Hour
+		}
+		export.Absences = append(export.Absences, absence)
+	}
+
+	homework, err := e.db.GetStudentsHomework(userId)
+	if err != nil {
+		return export, err
+	}
+	for i := 0; i < len(homework); i++ {
+		status := HomeworkStatus{StudentHomework: homework[i]}
+		h, err := e.db.GetHomework(homework[i].HomeworkID)
+		if err == nil {
+			status.HomeworkName = h.Name
+			status.ToDate = h.ToDate
+			subject, err := e.db.GetSubject(h.SubjectID)
+			if err == nil {
+				status.SubjectName = subject.Name
+			}
+		}
+		export.Homework = append(export.Homework, status)
+	}
+
+	export.ArchivedYears, err = e.collectArchivedYears(userId)
+	if err != nil {
+		return export, err
+	}
+
+	export.SelfTesting, err = e.db.GetAllTestingsForUser(userId)
+	if err != nil {
+		return export, err
+	}
+	if export.SelfTesting == nil {
+		export.SelfTesting = make([]sql.Testing, 0)
+	}
+
+	meals, err := e.db.GetMealsForUser(userId)
+	if err != nil {
+		return export, err
+	}
+	for i := 0; i < len(meals); i++ {
+		// Orders of other users aren't part of the export
+		export.MealOrders = append(export.MealOrders, MealOrder{
+			MealID:    meals[i].ID,
+			Date:      meals[i].Date,
+			MealTitle: meals[i].MealTitle,
+			Meals:     meals[i].Meals,
+			Price:     meals[i].Price,
+		})
+	}
+
+	communications, err := e.db.GetCommunicationsForUser(userId)
+	if err != nil {
+		return export, err
+	}
+	for i := 0; i < len(communications); i++ {
+		messages, err := e.db.GetCommunicationMessages(communications[i].ID)
+		if err != nil {
+			return export, err
+		}
+		if messages == nil {
+			messages = make([]sql.Message, 0)
+		}
+		export.Communications = append(export.Communications, Communication{
+			ID:          communications[i].ID,
+			Title:       communications[i].Title,
+			DateCreated: communications[i].DateCreated,
+			Messages:    messages,
+		})
+	}
+
+	messages, err := e.db.GetAllMessages()
+	if err != nil {
+		return export, err
+	}
+	for i := 0; i < len(messages); i++ {
+		if messages[i].UserID == userId {
+			export.Messages = append(export.Messages, messages[i])
+		}
+	}
+
+	return export, nil
+}
+
+func (e *exporterImpl) collectArchivedYears(userId int) ([]ArchivedYear, error) {
+	archived := make([]ArchivedYear, 0)
+	years, err := e.db.GetSchoolYears()
+	if err != nil {
+		return archived, err
+	}
+	classes, err := e.db.GetArchivedClassesForStudent(userId)
+	if err != nil {
+		return archived, err
+	}
+	grades, err := e.db.GetArchivedGradesForUser(userId)
+	if err != nil {
+		return archived, err
+	}
+	absences, err := e.db.GetArchivedAbsencesForUser(userId)
+	if err != nil {
+		return archived, err
+	}
+	homework, err := e.db.GetArchivedStudentHomeworkForUser(userId)
+	if err != nil {
+		return archived, err
+	}
+	for _, year := range years {
+		a := ArchivedYear{
+			SchoolYear: year.Name,
+			Grades:     make([]Grade, 0),
+			Absences:   make([]sql.Absence, 0),
+			Homework:   make([]sql.StudentHomework, 0),
+		}
+		for i := 0; i < len(classes); i++ {
+			if classes[i].SchoolYearID == year.ID {
+				a.Outcome = classes[i].Outcome
+				archivedClasses, err := e.db.GetArchivedClasses(year.ID)
+				if err != nil {
+					return archived, err
+				}
+				for n := 0; n < len(archivedClasses); n++ {
+					if archivedClasses[n].ID == classes[i].ClassID {
+						a.ClassName = archivedClasses[n].Name
+					}
+				}
+			}
+		}
+		subjects, err := e.db.GetArchivedSubjects(year.ID)
+		if err != nil {
+			return archived, err
+		}
+		for i := 0; i < len(grades); i++ {
+			if grades[i].SchoolYearID != year.ID {
+				continue
+			}
+			grade := Grade{Grade: grades[i].Grade}
+			for n := 0; n < len(subjects); n++ {
+				if subjects[n].ID == grades[i].SubjectID {
+					grade.SubjectName = subjects[n].Name
+				}
+			}
+			teacher, err := e.db.GetUser(grades[i].TeacherID)
+			if err == nil {
+				grade.TeacherName = teacher.Name
+			}
+			a.Grades = append(a.Grades, grade)
+		}
+		for i := 0; i < len(absences); i++ {
+			if absences[i].SchoolYearID == year.ID {
+				a.Absences = append(a.Absences, absences[i].Absence)
+			}
+		}
+		for i := 0; i < len(homework); i++ {
+			if homework[i].SchoolYearID == year.ID {
+				a.Homework = append(a.Homework, homework[i].StudentHomework)
+			}
+		}
+		if a.ClassName != "" || len(a.Grades) != 0 || len(a.Absences) != 0 || len(a.Homework) != 0 {
+			archived = append(archived, a)
+		}
+	}
+	return archived, nil
+}
+
+func (e *exporterImpl) WriteZIP(userId int, writer io.Writer) error {
+	export, err := e.Collect(userId)
+	if err != nil {
+		return err
+	}
+	marshal, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	document, err := exportPDF(export, e.fontDirectory)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(writer)
+	f, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(marshal)
+	if err != nil {
+		return err
+	}
+	f, err = archive.Create("export.pdf")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(document)
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
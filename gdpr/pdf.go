@@ -0,0 +1,175 @@
+package gdpr
+
+import (
+	"fmt"
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/johnfercher/maroto/pkg/props"
+	"time"
+)
+
+func yesNo(b bool) string {
+	if b {
+		return "da"
+	}
+	return "ne"
+}
+
+// timestamp formats the time in the server's time zone, without seconds.
+func timestamp(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func exportPDF(export Export, fontDirectory string) ([]byte, error) {
+	m := pdf.NewMaroto(consts.Portrait, consts.A4)
+
+	m.SetFontLocation(fontDirectory)
+	m.AddUTF8Font("OpenSans", consts.Normal, "opensans.ttf")
+	// Tables switch back to maroto's initial bold style, which has no font of its own, so the regular one is used
+	m.AddUTF8Font("OpenSans", consts.Bold, "opensans.ttf")
+	m.SetDefaultFontFamily("OpenSans")
+
+	tableProps := func(gridSizes []uint) props.TableList {
+		return props.TableList{
+			HeaderProp:  props.TableListContent{Style: consts.Normal, Size: 9, GridSizes: gridSizes},
+			ContentProp: props.TableListContent{Style: consts.Normal, Size: 8, GridSizes: gridSizes},
+			Line:        true,
+		}
+	}
+	section := func(title string) {
+		m.Row(14, func() {
+			m.Col(12, func() {
+				m.Text(title, props.Text{Top: 6, Size: 13})
+			})
+		})
+	}
+	empty := func() {
+		m.Row(7, func() {
+			m.Col(12, func() {
+				m.Text("Ni podatkov.", props.Text{Size: 9})
+			})
+		})
+	}
+
+	m.Row(20, func() {
+		m.Col(12, func() {
+			m.Text("MeetPlan", props.Text{Size: 20})
+			m.Text(fmt.Sprintf("Izvoz osebnih podatkov - %s (ustvarjeno %s)", export.Profile.Name, export.GeneratedAt), props.Text{
+				Top:  10,
+				Size: 10,
+			})
+		})
+	})
+	m.Line(5)
+
+	section("Osebni podatki")
+	profile := [][]string{
+		{"ID", fmt.Sprint(export.Profile.ID)},
+		{"Ime", export.Profile.Name},
+		{"Elektronski naslov", export.Profile.Email},
+		{"Vloga", export.Profile.Role},
+		{"EMŠO", export.Profile.BirthCertificateNumber},
+		{"Datum rojstva", export.Profile.Birthday.String()},
+		{"Kraj rojstva", export.Profile.CityOfBirth},
+		{"Država rojstva", export.Profile.CountryOfBirth},
+		{"Povezani uporabniki", fmt.Sprint(export.Profile.LinkedUsers)},
+		{"Napreduje", yesNo(export.Profile.IsPassing)},
+		{"Dvostopenjska prijava", yesNo(export.Profile.TwoFactorLogin)},
+	}
+	m.TableList([]string{"Podatek", "Vrednost"}, profile, tableProps([]uint{4, 8}))
+
+	section("Ocene")
+	if len(export.Grades) == 0 {
+		empty()
+	} else {
+		rows := make([][]string, 0)
+		for _, g := range export.Grades {
+			rows = append(rows, []string{timestamp(g.Date), g.SubjectName, fmt.Sprint(g.Grade), fmt.Sprint(g.Period), yesNo(g.IsFinal), g.TeacherName, g.Description})
+		}
+		m.TableList([]string{"Datum", "Predmet", "Ocena", "Obdobje", "Zaključna", "Učitelj", "Opis"}, rows, tableProps([]uint{2, 2, 1, 1, 1, 2, 3}))
+	}
+
+	section("Odsotnosti")
+	if len(export.Absences) == 0 {
+		empty()
+	} else {
+		rows := make([][]string, 0)
+		for _, a := range export.Absences {
+			rows = append(rows, []string{a.MeetingDate.String(), fmt.Sprint(a.MeetingHour), a.MeetingName, a.AbsenceType, yesNo(a.IsExcused)})
+		}
+		m.TableList([]string{"Datum", "Ura", "Srečanje", "Vrsta", "Opravičeno"}, rows, tableProps([]uint{2, 1, 4, 3, 2}))
+	}
+
+	section("Domače naloge")
+	if len(export.Homework) == 0 {
+		empty()
+	} else {
+		rows := make([][]string, 0)
+		for _, h := range export.Homework {
+			rows = append(rows, []string{h.ToDate.String(), h.SubjectName, h.HomeworkName, h.Status})
+		}
+		m.TableList([]string{"Rok", "Predmet", "Naloga", "Status"}, rows, tableProps([]uint{2, 3, 4, 3}))
+	}
+
+	section("Pretekla šolska leta")
+	if len(export.ArchivedYears) == 0 {
+		empty()
+	} else {
+		years := make([][]string, 0)
+		grades := make([][]string, 0)
+		for _, y := range export.ArchivedYears {
+			years = append(years, []string{y.SchoolYear, y.ClassName, y.Outcome, fmt.Sprint(len(y.Absences)), fmt.Sprint(len(y.Homework))})
+			for _, g := range y.Grades {
+				grades = append(grades, []string{y.SchoolYear, g.SubjectName, fmt.Sprint(g.Grade), fmt.Sprint(g.Period), yesNo(g.IsFinal), g.TeacherName})
+			}
+		}
+		m.TableList([]string{"Šolsko leto", "Razred", "Izid", "Odsotnosti", "Domače naloge"}, years, tableProps([]uint{3, 2, 3, 2, 2}))
+		if len(grades) != 0 {
+			m.TableList([]string{"Šolsko leto", "Predmet", "Ocena", "Obdobje", "Zaključna", "Učitelj"}, grades, tableProps([]uint{2, 3, 1, 1, 2, 3}))
+		}
+	}
+
+	section("Samotestiranje")
+	if len(export.SelfTesting) == 0 {
+		empty()
+	} else {
+		rows := make([][]string, 0)
+		for _, t := range export.SelfTesting {
+			rows = append(rows, []string{t.Date.String(), t.Result})
+		}
+		m.TableList([]string{"Datum", "Rezultat"}, rows, tableProps([]uint{4, 8}))
+	}
+
+	section("Naročila obrokov")
+	if len(export.MealOrders) == 0 {
+		empty()
+	} else {
+		rows := make([][]string, 0)
+		for _, o := range export.MealOrders {
+			rows = append(rows, []string{o.Date.String(), o.MealTitle, o.Meals, fmt.Sprintf("%.2f", o.Price)})
+		}
+		m.TableList([]string{"Datum", "Obrok", "Jedi", "Cena"}, rows, tableProps([]uint{2, 3, 5, 2}))
+	}
+
+	section("Komunikacija")
+	if len(export.Communications) == 0 {
+		empty()
+	} else {
+		rows := make([][]string, 0)
+		for _, c := range export.Communications {
+			for _, message := range c.Messages {
+				rows = append(rows, []string{timestamp(message.DateCreated), c.Title, fmt.Sprint(message.UserID), message.Body})
+			}
+			if len(c.Messages) == 0 {
+				rows = append(rows, []string{timestamp(c.DateCreated), c.Title, "", ""})
+			}
+		}
+		m.TableList([]string{"Datum", "Pogovor", "Avtor (ID)", "Sporočilo"}, rows, tableProps([]uint{2, 3, 2, 5}))
+	}
+
+	output, err := m.Output()
+	if err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
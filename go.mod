@@ -3,6 +3,7 @@ module github.com/MeetPlan/MeetPlanBackend
 go 1.16
 
 require (
+	github.com/boombuler/barcode v1.0.0
 	github.com/dchest/uniuri v0.0.0-20200228104902-7aecb25e1fe5
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/gorilla/mux v1.8.0
@@ -11,7 +12,7 @@ require (
 	github.com/lib/pq v1.10.4
 	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/rs/cors v1.8.0
-	github.com/signintech/gopdf v0.10.8 // indirect
+	github.com/signintech/gopdf v0.10.8
 	go.uber.org/zap v1.19.1
 	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
 	gopkg.in/yaml.v2 v2.4.0 // indirect
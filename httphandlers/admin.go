@@ -14,14 +14,14 @@ type UserJSON struct {
 	Email                  string
 	Role                   string
 	BirthCertificateNumber string
-	Birthday               string
+	Birthday               sql.Date
 	CityOfBirth            string
 	CountryOfBirth         string
 	IsPassing              bool
 }
 
 func (server *httpImpl) ChangeRole(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -32,7 +32,7 @@ func (server *httpImpl) ChangeRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionUsersChangeRole) {
 		userId, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
 			return
@@ -50,34 +50,52 @@ func (server *httpImpl) ChangeRole(w http.ResponseWriter, r *http.Request) {
 			WriteJSON(w, Response{Data: "Role is empty", Error: nrole, Success: false}, http.StatusBadRequest)
 			return
 		}
+		_, err = server.db.GetRole(nrole)
+		if err != nil {
+			WriteJSON(w, Response{Data: "Role doesn't exist", Error: nrole, Success: false}, http.StatusBadRequest)
+			return
+		}
 
 		currentUser, err := server.db.GetUser(currentUserId)
 		if err != nil {
 			return
 		}
 
-		if (currentUser.Role == "principal assistant" && nrole != "admin" && nrole != "principal" && nrole != "principal assistant") ||
-			(currentUser.Role == "principal" && nrole != "admin" && nrole != "principal") ||
-			(currentUser.Role == "admin" && nrole != "admin") {
-			if currentUser.Role == "admin" && nrole == "principal" {
-				_, err := server.db.GetPrincipal()
-				if err != nil {
-					if err.Error() == "sql: no rows in result set" {
-						user.Role = nrole
-					}
-				} else {
-					WriteJSON(w, Response{Data: "There already is a principal", Success: false}, http.StatusConflict)
-					return
-				}
-			} else {
-				user.Role = nrole
-			}
-		} else {
+		canAssign, err := server.db.CanAssignRole(currentUser.Role, nrole)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		if !canAssign {
 			WriteForbiddenJWT(w)
 			return
 		}
-		err = server.db.UpdateUser(user)
+		if nrole == sql.PrincipalRole {
+			_, err := server.db.GetPrincipal()
+			if err == nil {
+				WriteJSON(w, Response{Data: "There already is a principal", Success: false}, http.StatusConflict)
+				return
+			}
+			if err.Error() != "sql: no rows in result set" {
+				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+				return
+			}
+		}
+		user.Role = nrole
+		err = server.audited(r, jwt).UpdateUser(user)
+		if err != nil {
+			return
+		}
+		// Tokens still contain the old role, so the user has to log in again.
+		err = server.db.RevokeAllUserSessions(user.ID)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		// The calendar feed shows the timetable of the old role as well
+		err = server.db.DeleteCalendarFeed(user.ID)
 		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
 		WriteJSON(w, Response{Success: true}, http.StatusOK)
@@ -87,8 +105,9 @@ func (server *httpImpl) ChangeRole(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	_, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	_, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
+		WriteForbiddenJWT(w)
 		return
 	}
 	users, err := server.db.GetAllUsers()
@@ -107,12 +126,12 @@ func (server *httpImpl) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetTeachers(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionUsersRead) {
 		users, err := server.db.GetTeachers()
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
@@ -132,23 +151,63 @@ func (server *httpImpl) GetTeachers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionUsersDelete) {
 		userId, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
 			return
 		}
-		err = server.db.DeleteUser(userId)
+		mode := r.FormValue("mode")
+		if mode == "" {
+			mode = sql.DeletionModeDelete
+		}
+		preview, err := server.audited(r, jwt).DeleteUserData(userId, mode)
 		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			writeDeletionError(w, preview, err)
 			return
 		}
-		WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+		WriteJSON(w, Response{Data: preview, Success: true}, http.StatusOK)
 	} else {
 		WriteForbiddenJWT(w)
 		return
 	}
 }
+
+func (server *httpImpl) GetSigningKeys(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionSecurityManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	keys, err := server.db.GetSigningKeys()
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: keys, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) RotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionSecurityManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	key, err := server.db.RotateSigningKey()
+	if err != nil {
+		WriteJSON(w, Response{Data: "Failed to rotate signing key", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: key, Success: true}, http.StatusOK)
+}
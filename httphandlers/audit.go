@@ -0,0 +1,133 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// audited returns the database that records writes in the audit log on behalf of the user from the JWT.
+// Claims are nil for requests made by users who aren't logged in yet (such as registration).
+func (server *httpImpl) audited(r *http.Request, claims jwt.MapClaims) sql.SQL {
+	actor := sql.AuditActor{UserID: -1, Role: "", Endpoint: auditEndpoint(r)}
+	if claims != nil {
+		userId, err := strconv.Atoi(fmt.Sprint(claims["user_id"]))
+		if err == nil {
+			actor.UserID = userId
+		}
+		actor.Role = fmt.Sprint(claims["role"])
+		// Changes made while impersonating are recorded as changes of the admin
+		adminId := sql.ImpersonatedBy(claims)
+		if adminId != -1 {
+			actor.UserID = adminId
+			actor.Role = fmt.Sprintf("impersonating %s %s", actor.Role, fmt.Sprint(claims["user_id"]))
+		}
+	}
+	return server.db.WithActor(actor)
+}
+
+// auditedUser is used by handlers which authenticate the user without a JWT (such as single sign-on).
+func (server *httpImpl) auditedUser(r *http.Request, user sql.User) sql.SQL {
+	return server.db.WithActor(sql.AuditActor{UserID: user.ID, Role: user.Role, Endpoint: auditEndpoint(r)})
+}
+
+func auditEndpoint(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route != nil {
+		template, err := route.GetPathTemplate()
+		if err == nil {
+			return routeKey(r.Method, template)
+		}
+	}
+	return routeKey(r.Method, r.URL.Path)
+}
+
+func (server *httpImpl) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionAuditRead) {
+		query := r.URL.Query()
+		filter := sql.AuditFilter{
+			UserID:     -1,
+			EntityType: query.Get("entity_type"),
+			EntityID:   query.Get("entity_id"),
+			Endpoint:   query.Get("endpoint"),
+			Limit:      DefaultAuditLimit,
+		}
+		if query.Get("user_id") != "" {
+			filter.UserID, err = strconv.Atoi(query.Get("user_id"))
+			if err != nil {
+				WriteBadRequest(w)
+				return
+			}
+		}
+		if query.Get("from") != "" {
+			filter.From, err = strconv.ParseInt(query.Get("from"), 10, 64)
+			if err != nil {
+				WriteBadRequest(w)
+				return
+			}
+		}
+		if query.Get("to") != "" {
+			filter.To, err = strconv.ParseInt(query.Get("to"), 10, 64)
+			if err != nil {
+				WriteBadRequest(w)
+				return
+			}
+		}
+		if query.Get("limit") != "" {
+			filter.Limit, err = strconv.Atoi(query.Get("limit"))
+			if err != nil || filter.Limit < 1 || filter.Limit > MaxAuditLimit {
+				WriteBadRequest(w)
+				return
+			}
+		}
+		if query.Get("offset") != "" {
+			filter.Offset, err = strconv.Atoi(query.Get("offset"))
+			if err != nil || filter.Offset < 0 {
+				WriteBadRequest(w)
+				return
+			}
+		}
+		entries, err := server.db.GetAuditEntries(filter)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve audit log", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: entries, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+func (server *httpImpl) VerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionAuditRead) {
+		verification, err := server.db.VerifyAuditLog()
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to verify audit log", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		if !verification.Valid {
+			server.logger.Errorw("audit log hash chain is broken", "broken_at", verification.BrokenAt)
+		}
+		WriteJSON(w, Response{Data: verification, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
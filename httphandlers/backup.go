@@ -0,0 +1,82 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/backup"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"os"
+)
+
+func (server *httpImpl) GetBackups(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionBackupsManage) {
+		backups, err := server.backups.List()
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to list backups", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: backups, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+// NewBackup takes a backup of the database while the server keeps running. Restoring is only possible
+// with the backup command, as the server has to be stopped for it.
+func (server *httpImpl) NewBackup(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionBackupsManage) {
+		info, err := server.backups.Create()
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to create backup", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		server.logger.Infow("backup created through the API", "name", info.Name, "user_id", jwt["user_id"])
+		WriteJSON(w, Response{Data: info, Success: true}, http.StatusCreated)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+// DownloadBackup returns the backup file as it is stored, so encrypted backups stay encrypted.
+func (server *httpImpl) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionBackupsManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	file, err := server.backups.Open(name)
+	if err != nil {
+		if err == backup.ErrInvalidName {
+			WriteBadRequest(w)
+			return
+		}
+		if os.IsNotExist(err) {
+			WriteJSON(w, Response{Data: "Backup doesn't exist", Success: false}, http.StatusNotFound)
+			return
+		}
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to open backup", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	server.logger.Infow("backup downloaded", "name", name, "user_id", jwt["user_id"])
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	io.Copy(w, file)
+}
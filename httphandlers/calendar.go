@@ -0,0 +1,141 @@
+package httphandlers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/calendar"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CalendarFeedJSON describes the user's calendar feed. The token and URL are only known right after the feed
+// is created, as only the hash of the token is stored.
+type CalendarFeedJSON struct {
+	Active     bool   `json:"active"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at"`
+	Token      string `json:"token,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+// calendarFeedURL is the feed's address on this server, as seen by the client that created the feed.
+func (server *httpImpl) calendarFeedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || (server.config.BehindProxy && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	host := r.Host
+	if server.config.BehindProxy && r.Header.Get("X-Forwarded-Host") != "" {
+		host = r.Header.Get("X-Forwarded-Host")
+	}
+	return fmt.Sprintf("%s://%s/calendar/%s.ics", scheme, host, token)
+}
+
+func (server *httpImpl) GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	feed, err := server.db.GetCalendarFeed(userId)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			WriteJSON(w, Response{Data: CalendarFeedJSON{Active: false}, Success: true}, http.StatusOK)
+			return
+		}
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: CalendarFeedJSON{Active: true, CreatedAt: feed.CreatedAt, LastUsedAt: feed.LastUsedAt}, Success: true}, http.StatusOK)
+}
+
+// NewCalendarFeed creates the user's calendar feed and returns its URL. The previous URL stops working.
+func (server *httpImpl) NewCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	token, err := server.db.NewCalendarFeed(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to create calendar feed", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: CalendarFeedJSON{
+		Active:    true,
+		CreatedAt: time.Now().Unix(),
+		Token:     token,
+		URL:       server.calendarFeedURL(r, token),
+	}, Success: true}, http.StatusCreated)
+}
+
+func (server *httpImpl) DeleteCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	err = server.db.DeleteCalendarFeed(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+// GetCalendar serves the iCalendar feed of the token's user. Calendar apps can't log in, so the token in the
+// URL is the only authentication and the route is public. The user is checked on every fetch, as the feed
+// outlives sessions: it stops working once the user is unverified or their role changes.
+func (server *httpImpl) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	feed, err := server.db.GetCalendarFeedByToken(mux.Vars(r)["token"])
+	if err != nil {
+		WriteJSON(w, Response{Data: "Calendar feed doesn't exist", Success: false}, http.StatusNotFound)
+		return
+	}
+	user, err := server.db.GetUser(feed.UserID)
+	if err != nil || user.Role == "unverified" || user.Role != feed.Role {
+		WriteJSON(w, Response{Data: "Calendar feed doesn't exist", Success: false}, http.StatusNotFound)
+		return
+	}
+	timetable, err := calendar.NewFeed(server.db, server.config, server.logger)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Invalid lesson times or time zone in the configuration", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	c, err := timetable.Calendar(user)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	var buffer bytes.Buffer
+	_, err = c.WriteTo(&buffer)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	feed.LastUsedAt = time.Now().Unix()
+	err = server.db.UpdateCalendarFeed(feed)
+	if err != nil {
+		server.logger.Warnw("failed to record calendar feed usage", "user", user.ID, "error", err)
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=\"meetplan.ics\"")
+	w.Write(buffer.Bytes())
+}
@@ -1,12 +1,12 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type ClassJSON struct {
@@ -17,17 +17,26 @@ type ClassJSON struct {
 	ClassYear      string
 	SOK            int
 	EOK            int
-	LastSchoolDate int
+	LastSchoolDate sql.Date
+}
+
+// parseLastSchoolDate accepts an ISO-8601 date, or Unix seconds the way it used to be sent.
+func parseLastSchoolDate(value string) (sql.Date, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return sql.NewDate(time.Unix(seconds, 0)), nil
+	}
+	return sql.ParseDate(value)
 }
 
 func (server *httpImpl) NewClass(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
 
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionClassesManage) {
 
 		className := r.FormValue("name")
 		teacherIdStr := fmt.Sprint(r.FormValue("teacher_id"))
@@ -38,9 +47,9 @@ func (server *httpImpl) NewClass(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		class := sql.Class{ID: server.db.GetLastClassID(), Name: className, Teacher: teacherId, ClassYear: r.FormValue("class_year")}
+		class := sql.Class{Name: className, Teacher: teacherId, ClassYear: r.FormValue("class_year")}
 		server.logger.Debug(class)
-		err = server.db.InsertClass(class)
+		class.ID, err = server.audited(r, jwt).InsertClass(class)
 		if err != nil {
 			WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
 			return
@@ -53,7 +62,7 @@ func (server *httpImpl) NewClass(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetClasses(w http.ResponseWriter, r *http.Request) {
-	_, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	_, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -70,12 +79,12 @@ func (server *httpImpl) GetClasses(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) PatchClass(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionClassesManage) {
 		classId, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -91,7 +100,7 @@ func (server *httpImpl) PatchClass(w http.ResponseWriter, r *http.Request) {
 			WriteBadRequest(w)
 			return
 		}
-		lastDate, err := strconv.Atoi(r.FormValue("last_date"))
+		lastDate, err := parseLastSchoolDate(r.FormValue("last_date"))
 		if err != nil {
 			WriteBadRequest(w)
 			return
@@ -104,7 +113,7 @@ func (server *httpImpl) PatchClass(w http.ResponseWriter, r *http.Request) {
 		class.SOK = sok
 		class.EOK = eok
 		class.LastSchoolDate = lastDate
-		err = server.db.UpdateClass(class)
+		err = server.audited(r, jwt).UpdateClass(class)
 		if err != nil {
 			return
 		}
@@ -116,12 +125,12 @@ func (server *httpImpl) PatchClass(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetClass(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "teacher" || jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionClassesRead) {
 		classId, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -134,8 +143,11 @@ func (server *httpImpl) GetClass(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		var students []int
-		err = json.Unmarshal([]byte(class.Students), &students)
+		students, err := server.db.GetClassStudents(class.ID)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
 
 		var studentsJson = make([]UserJSON, 0)
 
@@ -173,12 +185,12 @@ func (server *httpImpl) GetClass(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) AssignUserToClass(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionClassesManage) {
 		classId, err := strconv.Atoi(mux.Vars(r)["class_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -189,33 +201,21 @@ func (server *httpImpl) AssignUserToClass(w http.ResponseWriter, r *http.Request
 			WriteBadRequest(w)
 			return
 		}
-		class, err := server.db.GetClass(classId)
+		_, err = server.db.GetClass(classId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		var m []int
-		err = json.Unmarshal([]byte(class.Students), &m)
+		inClass, err := server.db.IsStudentInClass(classId, userId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		for i := 0; i < len(m); i++ {
-			if m[i] == userId {
-				WriteJSON(w, Response{Data: "User is already in this class", Success: false}, http.StatusConflict)
-				return
-			}
-		}
-		m = append(m, userId)
-
-		s, err := json.Marshal(m)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		if inClass {
+			WriteJSON(w, Response{Data: "User is already in this class", Success: false}, http.StatusConflict)
 			return
 		}
-		class.Students = string(s)
-
-		err = server.db.UpdateClass(class)
+		err = server.audited(r, jwt).AddStudentToClass(classId, userId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -228,12 +228,12 @@ func (server *httpImpl) AssignUserToClass(w http.ResponseWriter, r *http.Request
 }
 
 func (server *httpImpl) RemoveUserFromClass(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionClassesManage) {
 		classId, err := strconv.Atoi(mux.Vars(r)["class_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -244,32 +244,12 @@ func (server *httpImpl) RemoveUserFromClass(w http.ResponseWriter, r *http.Reque
 			WriteBadRequest(w)
 			return
 		}
-		class, err := server.db.GetClass(classId)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-			return
-		}
-		var m []int
-		err = json.Unmarshal([]byte(class.Students), &m)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-			return
-		}
-		for i := 0; i < len(m); i++ {
-			if m[i] == userId {
-				m = remove(m, i)
-				break
-			}
-		}
-
-		s, err := json.Marshal(m)
+		_, err = server.db.GetClass(classId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		class.Students = string(s)
-
-		err = server.db.UpdateClass(class)
+		err = server.audited(r, jwt).RemoveStudentFromClass(classId, userId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -282,18 +262,18 @@ func (server *httpImpl) RemoveUserFromClass(w http.ResponseWriter, r *http.Reque
 }
 
 func (server *httpImpl) DeleteClass(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionClassesManage) {
 		classId, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
 			WriteBadRequest(w)
 			return
 		}
-		err = server.db.DeleteClass(classId)
+		err = server.audited(r, jwt).DeleteClass(classId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
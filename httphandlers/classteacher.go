@@ -1,21 +1,49 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
 )
 
+// isClassTeacherOf reports whether the teacher is the class teacher of the student.
+func (server *httpImpl) isClassTeacherOf(teacherId int, studentId int) (bool, error) {
+	classes, err := server.db.GetClassesForStudent(studentId)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < len(classes); i++ {
+		if classes[i].Teacher == teacherId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// canSeeStudent reports whether the user may see records of the student: their own, those of students in their
+// class and those of their children, when parentsMay. PermissionClassesReadAll lifts the limitation.
+func (server *httpImpl) canSeeStudent(claims jwt.MapClaims, userId int, studentId int, parentsMay bool) (bool, error) {
+	if userId == studentId || server.can(claims, sql.PermissionClassesReadAll) {
+		return true, nil
+	}
+	isClassTeacher, err := server.isClassTeacherOf(userId, studentId)
+	if err != nil || isClassTeacher {
+		return isClassTeacher, err
+	}
+	isParent, err := server.db.IsParentOf(userId, studentId)
+	return isParent && parentsMay, err
+}
+
 func (server *httpImpl) ExcuseAbsence(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		return
 	}
 
-	if jwt["role"] != "teacher" {
+	if !server.can(jwt, sql.PermissionAbsencesExcuse) {
 		WriteForbiddenJWT(w)
 		return
 	}
@@ -34,29 +62,12 @@ func (server *httpImpl) ExcuseAbsence(w http.ResponseWriter, r *http.Request) {
 		WriteBadRequest(w)
 		return
 	}
-	classes, err := server.db.GetClasses()
+	valid, err := server.isClassTeacherOf(teacherId, studentId)
 	if err != nil {
 		return
 	}
-	var valid = false
-	for i := 0; i < len(classes); i++ {
-		class := classes[i]
-		var users []int
-		err := json.Unmarshal([]byte(class.Students), &users)
-		if err != nil {
-			return
-		}
-		for j := 0; j < len(users); j++ {
-			if users[j] == studentId && class.Teacher == teacherId {
-				valid = true
-				break
-			}
-		}
-		if valid {
-			break
-		}
-	}
-	if !valid {
+	// Class teachers can only excuse absences of their own students
+	if !valid && !server.can(jwt, sql.PermissionAbsencesWriteAll) {
 		WriteForbiddenJWT(w)
 		return
 	}
@@ -65,7 +76,7 @@ func (server *httpImpl) ExcuseAbsence(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	absence.IsExcused = true
-	err = server.db.UpdateAbsence(absence)
+	err = server.audited(r, jwt).UpdateAbsence(absence)
 	if err != nil {
 		return
 	}
@@ -13,15 +13,17 @@ import (
 type MessageJson struct {
 	sql.Message
 	UserName string
+	Seen     []int
 }
 
 type CommunicationJson struct {
 	sql.Communication
+	People   []int
 	Messages []MessageJson
 }
 
 func (server *httpImpl) GetCommunications(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -31,29 +33,15 @@ func (server *httpImpl) GetCommunications(w http.ResponseWriter, r *http.Request
 		WriteForbiddenJWT(w)
 		return
 	}
-	communications, err := server.db.GetCommunications()
+	communications, err := server.db.GetCommunicationsForUser(userId)
 	if err != nil {
 		return
 	}
-
-	var communicationsJson = make([]sql.Communication, 0)
-
-	for i := 0; i < len(communications); i++ {
-		communication := communications[i]
-		var people []int
-		err := json.Unmarshal([]byte(communication.People), &people)
-		if err != nil {
-			return
-		}
-		if contains(people, userId) {
-			communicationsJson = append(communicationsJson, communication)
-		}
-	}
-	WriteJSON(w, Response{Success: true, Data: communicationsJson}, http.StatusOK)
+	WriteJSON(w, Response{Success: true, Data: communications}, http.StatusOK)
 }
 
 func (server *httpImpl) GetCommunication(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -72,8 +60,7 @@ func (server *httpImpl) GetCommunication(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return
 	}
-	var people []int
-	err = json.Unmarshal([]byte(communication.People), &people)
+	people, err := server.db.GetCommunicationPeople(communicationId)
 	if err != nil {
 		return
 	}
@@ -95,36 +82,30 @@ func (server *httpImpl) GetCommunication(w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			return
 		}
-		messagesJson = append(messagesJson, MessageJson{
-			Message:  message,
-			UserName: user.Name,
-		})
-		var users []int
-		err = json.Unmarshal([]byte(message.Seen), &users)
+		seen, err := server.db.GetMessageSeen(message.ID)
 		if err != nil {
 			return
 		}
-		if !contains(users, userId) {
-			users = append(users, userId)
-			marshal, err := json.Marshal(users)
-			if err != nil {
-				return
-			}
-			message.Seen = string(marshal)
+		if !contains(seen, userId) && !isImpersonated(jwt) {
 			// Not a fatal error, move on
-			server.db.UpdateMessage(message)
+			server.db.MarkMessageSeen(message.ID, userId)
 		}
-
+		messagesJson = append(messagesJson, MessageJson{
+			Message:  message,
+			UserName: user.Name,
+			Seen:     seen,
+		})
 	}
 	j := CommunicationJson{
 		Communication: communication,
+		People:        people,
 		Messages:      messagesJson,
 	}
 	WriteJSON(w, Response{Success: true, Data: j}, http.StatusOK)
 }
 
 func (server *httpImpl) NewMessage(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -139,36 +120,31 @@ func (server *httpImpl) NewMessage(w http.ResponseWriter, r *http.Request) {
 		WriteBadRequest(w)
 		return
 	}
-	communication, err := server.db.GetCommunication(communicationId)
+	isMember, err := server.db.IsInCommunication(communicationId, userId)
 	if err != nil {
 		return
 	}
-	var people []int
-	err = json.Unmarshal([]byte(communication.People), &people)
-	if err != nil {
-		return
-	}
-	if !contains(people, userId) {
+	if !isMember {
 		WriteForbiddenJWT(w)
 		return
 	}
 	message := sql.Message{
-		ID:              server.db.GetLastMessageID(),
 		CommunicationID: communicationId,
 		UserID:          userId,
 		Body:            r.FormValue("body"),
-		Seen:            fmt.Sprintf("[%s]", fmt.Sprint(userId)),
-		DateCreated:     time.Now().String(),
+		DateCreated:     time.Now().UTC(),
 	}
-	err = server.db.InsertMessage(message)
+	message.ID, err = server.audited(r, jwt).InsertMessage(message)
 	if err != nil {
 		return
 	}
+	// The author has obviously seen their own message
+	server.db.MarkMessageSeen(message.ID, userId)
 	WriteJSON(w, Response{Success: true, Data: "OK"}, http.StatusCreated)
 }
 
 func (server *httpImpl) NewCommunication(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -186,17 +162,11 @@ func (server *httpImpl) NewCommunication(w http.ResponseWriter, r *http.Request)
 	if !contains(people, userId) {
 		people = append(people, userId)
 	}
-	users, err := json.Marshal(people)
-	if err != nil {
-		return
-	}
 	comm := sql.Communication{
-		ID:          server.db.GetLastCommunicationID(),
-		People:      string(users),
-		DateCreated: time.Now().String(),
+		DateCreated: time.Now().UTC(),
 		Title:       r.FormValue("title"),
 	}
-	err = server.db.InsertCommunication(comm)
+	comm.ID, err = server.audited(r, jwt).InsertCommunication(comm, people)
 	if err != nil {
 		return
 	}
@@ -204,7 +174,7 @@ func (server *httpImpl) NewCommunication(w http.ResponseWriter, r *http.Request)
 }
 
 func (server *httpImpl) GetUnreadMessages(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -222,7 +192,7 @@ func (server *httpImpl) GetUnreadMessages(w http.ResponseWriter, r *http.Request
 }
 
 func (server *httpImpl) DeleteMessage(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -245,7 +215,7 @@ func (server *httpImpl) DeleteMessage(w http.ResponseWriter, r *http.Request) {
 		WriteForbiddenJWT(w)
 		return
 	}
-	err = server.db.DeleteMessage(messageId)
+	err = server.audited(r, jwt).DeleteMessage(messageId)
 	if err != nil {
 		return
 	}
@@ -253,7 +223,7 @@ func (server *httpImpl) DeleteMessage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) EditMessage(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -277,7 +247,7 @@ func (server *httpImpl) EditMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	message.Body = r.FormValue("body")
-	err = server.db.UpdateMessage(message)
+	err = server.audited(r, jwt).UpdateMessage(message)
 	if err != nil {
 		return
 	}
@@ -15,13 +15,13 @@ type ParentConfig struct {
 }
 
 func (server *httpImpl) GetConfig(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
-		WriteJSON(w, Response{Data: server.config, Success: true}, http.StatusOK)
+	if server.can(jwt, sql.PermissionConfigManage) {
+		WriteJSON(w, Response{Data: server.config.Redacted(), Success: true}, http.StatusOK)
 	} else {
 		WriteForbiddenJWT(w)
 		return
@@ -29,12 +29,12 @@ func (server *httpImpl) GetConfig(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) UpdateConfiguration(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionConfigManage) {
 		schoolPostCode, err := strconv.Atoi(r.FormValue("school_post_code"))
 		if err != nil {
 			WriteBadRequest(w)
@@ -100,15 +100,12 @@ func (server *httpImpl) UpdateConfiguration(w http.ResponseWriter, r *http.Reque
 }
 
 func (server *httpImpl) ParentConfig(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	// The settings aren't secret, any user can read what parents are allowed to see
+	_, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] != "parent" {
-		WriteForbiddenJWT(w)
-		return
-	}
 	WriteJSON(w, Response{Data: ParentConfig{
 		ParentViewGrades:   server.config.ParentViewGrades,
 		ParentViewAbsences: server.config.ParentViewAbsences,
@@ -0,0 +1,140 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func writeDeletionError(w http.ResponseWriter, preview sql.DeletionPreview, err error) {
+	if err.Error() == "sql: no rows in result set" {
+		WriteJSON(w, Response{Data: "User doesn't exist", Success: false}, http.StatusNotFound)
+		return
+	}
+	if len(preview.Blockers) != 0 {
+		WriteJSON(w, Response{Error: err.Error(), Data: preview, Success: false}, http.StatusConflict)
+		return
+	}
+	WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+}
+
+// PreviewUserDeletion shows what deleting (mode=delete) or anonymizing (mode=anonymize) the user would affect,
+// without changing anything.
+func (server *httpImpl) PreviewUserDeletion(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersDelete) {
+		userId, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		mode := r.FormValue("mode")
+		if mode == "" {
+			mode = sql.DeletionModeDelete
+		}
+		preview, err := server.db.PreviewUserDeletion(userId, mode)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				WriteJSON(w, Response{Data: "User doesn't exist", Success: false}, http.StatusNotFound)
+				return
+			}
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+			return
+		}
+		WriteJSON(w, Response{Data: preview, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+func (server *httpImpl) GetLegalHolds(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersLegalHold) {
+		holds, err := server.db.GetLegalHolds()
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: holds, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+func (server *httpImpl) SetLegalHold(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersLegalHold) {
+		userId, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		currentUserId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		reason := r.FormValue("reason")
+		if reason == "" {
+			WriteJSON(w, Response{Data: "Reason is required", Success: false}, http.StatusBadRequest)
+			return
+		}
+		_, err = server.db.GetUser(userId)
+		if err != nil {
+			WriteJSON(w, Response{Data: "User doesn't exist", Success: false}, http.StatusNotFound)
+			return
+		}
+		hold := sql.LegalHold{
+			UserID:    userId,
+			Reason:    reason,
+			CreatedBy: currentUserId,
+			CreatedAt: time.Now().Unix(),
+		}
+		err = server.audited(r, jwt).SetLegalHold(hold)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: hold, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+func (server *httpImpl) DeleteLegalHold(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersLegalHold) {
+		userId, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		err = server.audited(r, jwt).DeleteLegalHold(userId)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
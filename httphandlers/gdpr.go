@@ -0,0 +1,56 @@
+package httphandlers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/gdpr"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// ExportUserData returns a ZIP with everything MeetPlan stores about the user. Users can export their own data
+// and parents the data of their children, while the school needs the users.export permission.
+func (server *httpImpl) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	currentUserId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	userId, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	if userId != currentUserId && !server.can(jwt, sql.PermissionUsersExport) {
+		isParent, err := server.db.IsParentOf(currentUserId, userId)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		if !isParent {
+			WriteForbiddenJWT(w)
+			return
+		}
+	}
+	// The archive is built in memory, so errors can still be reported as JSON
+	var buffer bytes.Buffer
+	err = gdpr.NewExporter(server.db, server.config).WriteZIP(userId, &buffer)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			WriteJSON(w, Response{Data: "User doesn't exist", Success: false}, http.StatusNotFound)
+			return
+		}
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to export user data", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"meetplan-export-%d.zip\"", userId))
+	w.Write(buffer.Bytes())
+}
@@ -0,0 +1,318 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/proton"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TimetableDraftJSON is a draft with its lessons and the constraints they break.
+type TimetableDraftJSON struct {
+	Draft     sql.TimetableDraft `json:"draft"`
+	Timetable proton.Timetable   `json:"timetable"`
+}
+
+// generatorOptions reads the generator's options from the form. Only the dates are required.
+func generatorOptions(r *http.Request) (options proton.GeneratorOptions, err error) {
+	options = proton.GeneratorOptions{
+		Seed:           time.Now().UnixNano(),
+		SubjectIDs:     make([]int, 0),
+		Weeks:          proton.DefaultSchoolWeeks,
+		FirstHour:      1,
+		LastHour:       sql.TimetableHours - 1,
+		MaxHoursPerDay: proton.DefaultMaxHoursPerDay,
+		NoGaps:         r.FormValue("no_gaps") == "true",
+		DoubleLessons:  make([]int, 0),
+		Iterations:     proton.DefaultIterations,
+	}
+	options.FromDate, err = sql.ParseDate(r.FormValue("from"))
+	if err != nil {
+		return options, err
+	}
+	options.ToDate, err = sql.ParseDate(r.FormValue("to"))
+	if err != nil {
+		return options, err
+	}
+	if r.FormValue("seed") != "" {
+		options.Seed, err = strconv.ParseInt(r.FormValue("seed"), 10, 64)
+		if err != nil {
+			return options, err
+		}
+	}
+	numbers := map[string]*int{
+		"weeks":             &options.Weeks,
+		"first_hour":        &options.FirstHour,
+		"last_hour":         &options.LastHour,
+		"max_hours_per_day": &options.MaxHoursPerDay,
+		"iterations":        &options.Iterations,
+	}
+	for name, value := range numbers {
+		if r.FormValue(name) == "" {
+			continue
+		}
+		*value, err = strconv.Atoi(r.FormValue(name))
+		if err != nil {
+			return options, fmt.Errorf("invalid %s: %s", name, err.Error())
+		}
+	}
+	if r.FormValue("subjects") != "" {
+		err = json.Unmarshal([]byte(r.FormValue("subjects")), &options.SubjectIDs)
+		if err != nil {
+			return options, err
+		}
+	}
+	if r.FormValue("double_lessons") != "" {
+		err = json.Unmarshal([]byte(r.FormValue("double_lessons")), &options.DoubleLessons)
+		if err != nil {
+			return options, err
+		}
+	}
+	return options, options.Validate()
+}
+
+// timetableDraft returns the draft of the route.
+func (server *httpImpl) timetableDraft(w http.ResponseWriter, r *http.Request) (draft sql.TimetableDraft, ok bool) {
+	draftId, err := strconv.Atoi(mux.Vars(r)["draft_id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return draft, false
+	}
+	draft, err = server.db.GetTimetableDraft(draftId)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			WriteJSON(w, Response{Data: "Draft doesn't exist", Success: false}, http.StatusNotFound)
+			return draft, false
+		}
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return draft, false
+	}
+	return draft, true
+}
+
+// GetUnavailableHours returns the hours in which the teacher can't teach. Teachers can see their own hours,
+// the timetable.manage permission is needed for hours of other teachers.
+func (server *httpImpl) GetUnavailableHours(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionMeetingsWrite) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	teacherId, err := strconv.Atoi(mux.Vars(r)["teacher_id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	if teacherId != userId && !server.can(jwt, sql.PermissionTimetableManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	hours, err := server.db.GetUnavailableHoursForTeacher(teacherId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: hours, Success: true}, http.StatusOK)
+}
+
+// PatchUnavailableHours replaces the teacher's unavailable hours with the JSON list in hours, such as
+// [{"weekday": 1, "hour": 0}].
+func (server *httpImpl) PatchUnavailableHours(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionMeetingsWrite) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	teacherId, err := strconv.Atoi(mux.Vars(r)["teacher_id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	if teacherId != userId && !server.can(jwt, sql.PermissionTimetableManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	var hours []sql.UnavailableHour
+	err = json.Unmarshal([]byte(r.FormValue("hours")), &hours)
+	if err != nil {
+		WriteJSON(w, Response{Data: "Failed to parse hours", Error: err.Error(), Success: false}, http.StatusBadRequest)
+		return
+	}
+	err = server.audited(r, jwt).SetUnavailableHours(teacherId, hours)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) GetTimetableDrafts(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionTimetableManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	drafts, err := server.db.GetTimetableDrafts()
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: drafts, Success: true}, http.StatusOK)
+}
+
+// GetTimetableDraft returns the draft with the constraints it currently breaks, which can differ from when it
+// was generated, as meanwhile templates could have been published or teachers' availability changed.
+func (server *httpImpl) GetTimetableDraft(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionTimetableManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	draft, ok := server.timetableDraft(w, r)
+	if !ok {
+		return
+	}
+	lessons, err := server.db.GetTimetableDraftLessons(draft.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	timetable, err := server.proton.Evaluate(proton.DraftOptions(draft), lessons)
+	if err != nil {
+		WriteJSON(w, Response{Data: "Proton failed to evaluate timetable", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: TimetableDraftJSON{Draft: draft, Timetable: timetable}, Success: true}, http.StatusOK)
+}
+
+// NewTimetableDraft generates a weekly timetable with proton and saves it as a draft. The seed is returned
+// with the draft, so the same timetable can be generated again with the same form.
+func (server *httpImpl) NewTimetableDraft(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionTimetableManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	options, err := generatorOptions(r)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+		return
+	}
+	timetable, err := server.proton.Generate(options)
+	if err != nil {
+		WriteJSON(w, Response{Data: "Proton failed to generate timetable", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	draft := options.Draft()
+	draft.CreatedBy = userId
+	draft.CreatedAt = time.Now().Unix()
+	draft.ID, err = server.audited(r, jwt).InsertTimetableDraft(draft, timetable.Lessons)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to save draft", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: TimetableDraftJSON{Draft: draft, Timetable: timetable}, Success: true}, http.StatusCreated)
+}
+
+// PublishTimetableDraft turns the draft's lessons into timetable templates and creates their meetings. Lessons
+// conflicting with existing meetings are refused the same as templates created one by one.
+func (server *httpImpl) PublishTimetableDraft(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionTimetableManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	draft, ok := server.timetableDraft(w, r)
+	if !ok {
+		return
+	}
+	lessons, err := server.db.GetTimetableDraftLessons(draft.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	freeDays := server.config.FreeDays()
+	conflicts := make([]proton.Conflict, 0)
+	for i := 0; i < len(lessons); i++ {
+		c, err := server.proton.CheckTemplateConflicts(lessons[i].Template(draft), draft.FromDate, freeDays)
+		if err != nil {
+			WriteJSON(w, Response{Data: "Failed to check scheduling conflicts", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		conflicts = append(conflicts, c...)
+	}
+	if !server.checkedConflicts(w, r, jwt, conflicts, nil) {
+		return
+	}
+	syncs, err := server.audited(r, jwt).PublishTimetableDraft(draft.ID, freeDays)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to publish draft", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: syncs, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) DeleteTimetableDraft(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionTimetableManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	draft, ok := server.timetableDraft(w, r)
+	if !ok {
+		return
+	}
+	err = server.audited(r, jwt).DeleteTimetableDraft(draft.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
@@ -1,7 +1,6 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
@@ -44,12 +43,12 @@ type GradeTableResponse struct {
 }
 
 func (server *httpImpl) GetGradesForMeeting(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionGradesWrite) {
 		teacherId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			WriteBadRequest(w)
@@ -70,7 +69,7 @@ func (server *httpImpl) GetGradesForMeeting(w http.ResponseWriter, r *http.Reque
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		if jwt["role"] == "teacher" && subject.TeacherID != teacherId {
+		if !server.can(jwt, sql.PermissionGradesWriteAll) && subject.TeacherID != teacherId {
 			WriteForbiddenJWT(w)
 			return
 		}
@@ -79,24 +78,10 @@ func (server *httpImpl) GetGradesForMeeting(w http.ResponseWriter, r *http.Reque
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		var users []int
-		if subject.InheritsClass {
-			class, err := server.db.GetClass(subject.ClassID)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-			err = json.Unmarshal([]byte(class.Students), &users)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err = json.Unmarshal([]byte(subject.Students), &users)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
+		users, err := server.db.GetSubjectStudents(subject)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
 		}
 		var usergrades = make([]UserGradeTable, 0)
 		for i := 0; i < len(users); i++ {
@@ -186,12 +171,12 @@ func (server *httpImpl) GetGradesForMeeting(w http.ResponseWriter, r *http.Reque
 }
 
 func (server *httpImpl) NewGrade(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionGradesWrite) {
 		teacherId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			WriteBadRequest(w)
@@ -212,7 +197,7 @@ func (server *httpImpl) NewGrade(w http.ResponseWriter, r *http.Request) {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		if jwt["role"] == "teacher" && subject.TeacherID != teacherId {
+		if !server.can(jwt, sql.PermissionGradesWriteAll) && subject.TeacherID != teacherId {
 			WriteForbiddenJWT(w)
 			return
 		}
@@ -278,12 +263,11 @@ func (server *httpImpl) NewGrade(w http.ResponseWriter, r *http.Request) {
 		}
 
 		g := sql.Grade{
-			ID:          server.db.GetLastGradeID(),
 			UserID:      userId,
 			TeacherID:   teacherId,
 			SubjectID:   subject.ID,
 			Grade:       grade,
-			Date:        time.Now().String(),
+			Date:        time.Now().UTC(),
 			IsWritten:   isWrittenBool,
 			Period:      period,
 			Description: "",
@@ -291,7 +275,7 @@ func (server *httpImpl) NewGrade(w http.ResponseWriter, r *http.Request) {
 			CanPatch:    canPatch,
 		}
 
-		err = server.db.InsertGrade(g)
+		g.ID, err = server.audited(r, jwt).InsertGrade(g)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -305,12 +289,12 @@ func (server *httpImpl) NewGrade(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) PatchGrade(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionGradesWrite) {
 		teacherId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			WriteBadRequest(w)
@@ -340,7 +324,7 @@ func (server *httpImpl) PatchGrade(w http.ResponseWriter, r *http.Request) {
 			WriteForbiddenJWT(w)
 			return
 		}
-		if jwt["role"] == "teacher" && grade.TeacherID != teacherId {
+		if !server.can(jwt, sql.PermissionGradesWriteAll) && grade.TeacherID != teacherId {
 			WriteForbiddenJWT(w)
 			return
 		}
@@ -369,7 +353,7 @@ func (server *httpImpl) PatchGrade(w http.ResponseWriter, r *http.Request) {
 		grade.Period = period
 		grade.IsWritten = isWrittenBool
 
-		err = server.db.UpdateGrade(grade)
+		err = server.audited(r, jwt).UpdateGrade(grade)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -382,12 +366,12 @@ func (server *httpImpl) PatchGrade(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) DeleteGrade(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionGradesWrite) {
 		teacherId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			WriteBadRequest(w)
@@ -417,12 +401,12 @@ func (server *httpImpl) DeleteGrade(w http.ResponseWriter, r *http.Request) {
 			WriteForbiddenJWT(w)
 			return
 		}
-		if jwt["role"] == "teacher" && grade.TeacherID != teacherId {
+		if !server.can(jwt, sql.PermissionGradesWriteAll) && grade.TeacherID != teacherId {
 			WriteForbiddenJWT(w)
 			return
 		}
 
-		err = server.db.DeleteGrade(gradeId)
+		err = server.audited(r, jwt).DeleteGrade(gradeId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -435,72 +419,34 @@ func (server *httpImpl) DeleteGrade(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetMyGrades(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "student" || jwt["role"] == "teacher" || jwt["role"] == "parent" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" || jwt["role"] == "admin" {
-		var studentId int
-		var teacherId int
-		if jwt["role"] == "teacher" || jwt["role"] == "parent" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" || jwt["role"] == "admin" {
-			if jwt["role"] == "parent" {
-				if !server.config.ParentViewGrades {
-					WriteForbiddenJWT(w)
-					return
-				}
-			}
+	if server.can(jwt, sql.PermissionGradesRead) {
+		userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		// Students get their own grades, other users pick the student
+		studentId := userId
+		if r.URL.Query().Get("studentId") != "" {
 			studentId, err = strconv.Atoi(r.URL.Query().Get("studentId"))
 			if err != nil {
 				WriteBadRequest(w)
 				return
 			}
-			teacherId, err = strconv.Atoi(fmt.Sprint(jwt["user_id"]))
-		} else {
-			studentId, err = strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		}
+		valid, err := server.canSeeStudent(jwt, userId, studentId, server.config.ParentViewGrades)
 		if err != nil {
-			WriteBadRequest(w)
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		if jwt["role"] == "teacher" {
-			classes, err := server.db.GetClasses()
-			if err != nil {
-				return
-			}
-			var valid = false
-			for i := 0; i < len(classes); i++ {
-				class := classes[i]
-				var users []int
-				err := json.Unmarshal([]byte(class.Students), &users)
-				if err != nil {
-					return
-				}
-				for j := 0; j < len(users); j++ {
-					if users[j] == studentId && class.Teacher == teacherId {
-						valid = true
-						break
-					}
-				}
-				if valid {
-					break
-				}
-			}
-			if !valid {
-				WriteForbiddenJWT(w)
-				return
-			}
-		} else if jwt["role"] == "parent" {
-			parent, err := server.db.GetUser(teacherId)
-			if err != nil {
-				return
-			}
-			var children []int
-			json.Unmarshal([]byte(parent.Users), &children)
-			if !contains(children, studentId) {
-				WriteForbiddenJWT(w)
-				return
-			}
+		if !valid {
+			WriteForbiddenJWT(w)
+			return
 		}
 		userGrades, err := server.db.GetGradesForUser(studentId)
 		if err != nil {
@@ -570,7 +516,7 @@ func (server *httpImpl) GetMyGrades(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) PrintCertificateOfEndingClass(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -726,7 +672,7 @@ func (server *httpImpl) PrintCertificateOfEndingClass(w http.ResponseWriter, r *
 		},
 	}
 
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionCertificates) {
 		studentId, err := strconv.Atoi(mux.Vars(r)["student_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -737,25 +683,17 @@ func (server *httpImpl) PrintCertificateOfEndingClass(w http.ResponseWriter, r *
 			WriteForbiddenJWT(w)
 			return
 		}
-		classes, err := server.db.GetClasses()
+		classes, err := server.db.GetClassesForStudent(studentId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
 		var class *sql.Class
 		for i := 0; i < len(classes); i++ {
-			if jwt["role"] == "teacher" && classes[i].Teacher != teacherId {
+			if !server.can(jwt, sql.PermissionClassesReadAll) && classes[i].Teacher != teacherId {
 				continue
 			}
-			var users []int
-			err := json.Unmarshal([]byte(classes[i].Students), &users)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-			if contains(users, studentId) {
-				class = &classes[i]
-			}
+			class = &classes[i]
 		}
 
 		if class == nil {
@@ -763,31 +701,12 @@ func (server *httpImpl) PrintCertificateOfEndingClass(w http.ResponseWriter, r *
 			return
 		}
 
-		if jwt["role"] == "teacher" {
-			classes, err := server.db.GetClasses()
+		if !server.can(jwt, sql.PermissionClassesReadAll) {
+			valid, err := server.isClassTeacherOf(teacherId, studentId)
 			if err != nil {
 				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 				return
 			}
-			var valid = false
-			for i := 0; i < len(classes); i++ {
-				class := classes[i]
-				var users []int
-				err := json.Unmarshal([]byte(class.Students), &users)
-				if err != nil {
-					WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-					return
-				}
-				for j := 0; j < len(users); j++ {
-					if users[j] == studentId && class.Teacher == teacherId {
-						valid = true
-						break
-					}
-				}
-				if valid {
-					break
-				}
-			}
 			if !valid {
 				WriteForbiddenJWT(w)
 				return
@@ -811,13 +730,13 @@ func (server *httpImpl) PrintCertificateOfEndingClass(w http.ResponseWriter, r *
 
 		if server.config.Debug {
 			// Import page 1
-			tpl1 := pdf.ImportPage("officialdocs/spričevalo.pdf", 1, "/MediaBox")
+			tpl1 := pdf.ImportPage(server.config.AssetPath("officialdocs/spričevalo.pdf"), 1, "/MediaBox")
 
 			// Draw pdf onto page
 			pdf.UseImportedTemplate(tpl1, 0, 0, 595, 0)
 		}
 
-		err = pdf.AddTTFFont("opensans", "fonts/opensans.ttf")
+		err = pdf.AddTTFFont("opensans", server.config.AssetPath("fonts/opensans.ttf"))
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -844,7 +763,7 @@ func (server *httpImpl) PrintCertificateOfEndingClass(w http.ResponseWriter, r *
 
 		pdf.SetY(300)
 		pdf.SetX(50)
-		pdf.Cell(nil, user.Birthday)
+		pdf.Cell(nil, user.Birthday.String())
 		pdf.SetX(215)
 		pdf.Cell(nil, fmt.Sprintf("%s, %s", user.CityOfBirth, user.CountryOfBirth))
 
@@ -942,8 +861,7 @@ func (server *httpImpl) PrintCertificateOfEndingClass(w http.ResponseWriter, r *
 		pdf.SetX(150)
 		pdf.Cell(nil, fmt.Sprint(class.EOK))
 
-		lastDate := time.UnixMilli(int64(class.LastSchoolDate * 1000))
-		year, month, day := lastDate.Date()
+		year, month, day := class.LastSchoolDate.Date()
 		pdf.SetX(50)
 		pdf.SetY(725)
 		pdf.Cell(nil, fmt.Sprintf("%s.%s.%s", fmt.Sprint(day), fmt.Sprint(int(month)), fmt.Sprint(year)))
@@ -1,16 +1,14 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"net/http"
 	"strconv"
-	"time"
 )
 
 type GradingDate struct {
-	Date     string
+	Date     sql.Date
 	Gradings []Meeting
 }
 
@@ -24,79 +22,34 @@ func insertGradingDate(a []GradingDate, index int, value GradingDate) []GradingD
 }
 
 func (server *httpImpl) GetMyGradings(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "student" || jwt["role"] == "teacher" || jwt["role"] == "parent" || jwt["role"] == "admin" || jwt["role"] == "principal assistant" || jwt["role"] == "principal" {
-		var studentId int
-		var teacherId int
-		if jwt["role"] == "teacher" || jwt["role"] == "parent" || jwt["role"] == "admin" || jwt["role"] == "principal assistant" || jwt["role"] == "principal" {
-			if jwt["role"] == "parent" {
-				if !server.config.ParentViewGradings {
-					WriteForbiddenJWT(w)
-					return
-				}
-			}
+	if server.can(jwt, sql.PermissionGradesRead) {
+		userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		// Students get their own gradings, other users pick the student
+		studentId := userId
+		if r.URL.Query().Get("studentId") != "" {
 			studentId, err = strconv.Atoi(r.URL.Query().Get("studentId"))
 			if err != nil {
 				WriteBadRequest(w)
 				return
 			}
-			teacherId, err = strconv.Atoi(fmt.Sprint(jwt["user_id"]))
-		} else {
-			studentId, err = strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		}
+		valid, err := server.canSeeStudent(jwt, userId, studentId, server.config.ParentViewGradings)
 		if err != nil {
-			WriteBadRequest(w)
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to check access to the student", Success: false}, http.StatusInternalServerError)
 			return
 		}
-		if jwt["role"] == "teacher" {
-			classes, err := server.db.GetClasses()
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve classes for teacher", Success: false}, http.StatusInternalServerError)
-				return
-			}
-			var valid = false
-			for i := 0; i < len(classes); i++ {
-				class := classes[i]
-				var users []int
-				err := json.Unmarshal([]byte(class.Students), &users)
-				if err != nil {
-					WriteJSON(w, Response{Error: err.Error(), Data: "Failed to unmarshal class users", Success: false}, http.StatusInternalServerError)
-					return
-				}
-				for j := 0; j < len(users); j++ {
-					if users[j] == studentId && class.Teacher == teacherId {
-						valid = true
-						break
-					}
-				}
-				if valid {
-					break
-				}
-			}
-			if !valid {
-				WriteForbiddenJWT(w)
-				return
-			}
-		} else if jwt["role"] == "parent" {
-			parent, err := server.db.GetUser(teacherId)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve parent", Success: false}, http.StatusInternalServerError)
-				return
-			}
-			var children []int
-			err = json.Unmarshal([]byte(parent.Users), &children)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Data: "Failed to unmarshal parent's students", Success: false}, http.StatusInternalServerError)
-				return
-			}
-			if !contains(children, studentId) {
-				WriteForbiddenJWT(w)
-				return
-			}
+		if !valid {
+			WriteForbiddenJWT(w)
+			return
 		}
 		subjects, err := server.db.GetAllSubjectsForUser(studentId)
 		if err != nil {
@@ -129,18 +82,9 @@ func (server *httpImpl) GetMyGradings(w http.ResponseWriter, r *http.Request) {
 		var dates = make([]GradingDate, 0)
 		for i := 0; i < len(gradings); i++ {
 			var added = false
-			gradingDate, err := time.Parse("02-01-2006", gradings[i].Date)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Data: "Failed to parse gradingDate", Success: false}, http.StatusInternalServerError)
-				return
-			}
+			gradingDate := gradings[i].Date
 			for n := 0; n < len(dates); n++ {
-				date := dates[n]
-				parsedDate, err := time.Parse("02-01-2006", date.Date)
-				if err != nil {
-					WriteJSON(w, Response{Error: err.Error(), Data: "Failed to parse parsedDate", Success: false}, http.StatusInternalServerError)
-					return
-				}
+				parsedDate := dates[n].Date
 				if gradingDate.Equal(parsedDate) {
 					dates[n].Gradings = append(dates[n].Gradings, gradings[i])
 					added = true
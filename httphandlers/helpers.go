@@ -2,8 +2,11 @@ package httphandlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func DumpJSON(jsonstruct interface{}) []byte {
@@ -41,7 +44,29 @@ func WriteBadRequest(w http.ResponseWriter) {
 	w.Write(DumpJSON(Response{Success: false, Data: "Bad request"}))
 }
 
-func remove(s []int, i int) []int {
-	s[i] = s[len(s)-1]
-	return s[:len(s)-1]
+// GetClientIP returns the IP address of the client. X-Forwarded-For header is only trusted when
+// MeetPlan runs behind a reverse proxy, as otherwise anybody could spoof it.
+func GetClientIP(r *http.Request, behindProxy bool) string {
+	if behindProxy {
+		forwarded := r.Header.Get("X-Forwarded-For")
+		if forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func WriteTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(wait.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write(DumpJSON(Response{Success: false, Data: fmt.Sprintf("Too many failed login attempts. Try again in %d seconds.", seconds)}))
 }
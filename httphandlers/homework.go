@@ -1,13 +1,11 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
-	"time"
 )
 
 type Homework struct {
@@ -23,17 +21,17 @@ type HomeworkJSON struct {
 }
 
 type HomeworkPerDate struct {
-	Date     string
+	Date     sql.Date
 	Homework []HomeworkJSON
 }
 
 func (server *httpImpl) NewHomework(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionHomeworkWrite) {
 		userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			return
@@ -46,21 +44,24 @@ func (server *httpImpl) NewHomework(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return
 		}
-		if jwt["role"] == "teacher" && meeting.TeacherID != userId {
+		if !server.can(jwt, sql.PermissionHomeworkWriteAll) && meeting.TeacherID != userId {
 			WriteForbiddenJWT(w)
 			return
 		}
-		currentTime := time.Now()
+		toDate, err := sql.ParseDate(r.FormValue("to_date"))
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+			return
+		}
 		homework := sql.Homework{
-			ID:          server.db.GetLastHomeworkID(),
 			TeacherID:   userId,
 			SubjectID:   meeting.SubjectID,
 			Name:        r.FormValue("name"),
 			Description: r.FormValue("description"),
-			ToDate:      r.FormValue("to_date"),
-			FromDate:    currentTime.Format("2006-01-02"),
+			ToDate:      toDate,
+			FromDate:    sql.Today(),
 		}
-		err = server.db.InsertHomework(homework)
+		homework.ID, err = server.audited(r, jwt).InsertHomework(homework)
 		if err != nil {
 			return
 		}
@@ -72,12 +73,12 @@ func (server *httpImpl) NewHomework(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetAllHomeworksForSpecificSubject(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionHomeworkWrite) {
 		userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			return
@@ -90,7 +91,7 @@ func (server *httpImpl) GetAllHomeworksForSpecificSubject(w http.ResponseWriter,
 		if err != nil {
 			return
 		}
-		if jwt["role"] == "teacher" {
+		if !server.can(jwt, sql.PermissionHomeworkWriteAll) {
 			if meeting.TeacherID != userId {
 				WriteForbiddenJWT(w)
 				return
@@ -123,12 +124,12 @@ func (server *httpImpl) GetAllHomeworksForSpecificSubject(w http.ResponseWriter,
 
 // GetHomeworkData TODO: Not used yet
 func (server *httpImpl) GetHomeworkData(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionHomeworkWrite) {
 		userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			return
@@ -141,7 +142,7 @@ func (server *httpImpl) GetHomeworkData(w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			return
 		}
-		if jwt["role"] == "teacher" {
+		if !server.can(jwt, sql.PermissionHomeworkWriteAll) {
 			if homework.TeacherID != userId {
 				WriteForbiddenJWT(w)
 				return
@@ -162,12 +163,12 @@ func (server *httpImpl) GetHomeworkData(w http.ResponseWriter, r *http.Request)
 }
 
 func (server *httpImpl) PatchHomeworkForStudent(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionHomeworkWrite) {
 		teacherId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			return
@@ -189,7 +190,7 @@ func (server *httpImpl) PatchHomeworkForStudent(w http.ResponseWriter, r *http.R
 		if err != nil {
 			return
 		}
-		if jwt["role"] == "teacher" {
+		if !server.can(jwt, sql.PermissionHomeworkWriteAll) {
 			if homework.TeacherID != teacherId {
 				WriteForbiddenJWT(w)
 				return
@@ -199,12 +200,11 @@ func (server *httpImpl) PatchHomeworkForStudent(w http.ResponseWriter, r *http.R
 		if err != nil {
 			if err.Error() == "sql: no rows in result set" {
 				h = sql.StudentHomework{
-					ID:         server.db.GetLastStudentHomeworkID(),
 					UserID:     userId,
 					HomeworkID: homeworkId,
 					Status:     r.FormValue("status"),
 				}
-				err := server.db.InsertStudentHomework(h)
+				h.ID, err = server.audited(r, jwt).InsertStudentHomework(h)
 				if err == nil {
 					WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
 				}
@@ -214,7 +214,7 @@ func (server *httpImpl) PatchHomeworkForStudent(w http.ResponseWriter, r *http.R
 			}
 		}
 		h.Status = r.FormValue("status")
-		err = server.db.UpdateStudentHomework(h)
+		err = server.audited(r, jwt).UpdateStudentHomework(h)
 		if err != nil {
 			return
 		}
@@ -226,43 +226,29 @@ func (server *httpImpl) PatchHomeworkForStudent(w http.ResponseWriter, r *http.R
 }
 
 func (server *httpImpl) GetUserHomework(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	var studentId int
-	if jwt["role"] == "student" {
-		studentId, err = strconv.Atoi(fmt.Sprint(jwt["user_id"]))
-		if err != nil {
-			WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
-			return
-		}
-	} else {
-		studentId, err = strconv.Atoi(mux.Vars(r)["id"])
-		if err != nil {
-			WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
-			return
-		}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
+		return
 	}
-	if jwt["role"] == "parent" {
-		if !server.config.ParentViewHomework {
-			WriteForbiddenJWT(w)
-			return
-		}
-		parentId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
-		if err != nil {
-			WriteJSON(w, Response{Data: "Could not ATOI parentId", Error: err.Error(), Success: false}, http.StatusBadRequest)
-			return
-		}
-		parent, err := server.db.GetUser(parentId)
+	studentId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	// Teachers see homework of all students, others only their own and that of their children
+	if !server.can(jwt, sql.PermissionHomeworkWrite) {
+		canSee, err := server.canSeeStudent(jwt, userId, studentId, server.config.ParentViewHomework)
 		if err != nil {
-			WriteJSON(w, Response{Data: "Could not fetch parent", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			WriteJSON(w, Response{Data: "Failed to check access to the student", Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		var children []int
-		json.Unmarshal([]byte(parent.Users), &children)
-		if !contains(children, studentId) {
+		if !canSee {
 			WriteForbiddenJWT(w)
 			return
 		}
@@ -286,7 +272,7 @@ func (server *httpImpl) GetUserHomework(w http.ResponseWriter, r *http.Request)
 			var contains = false
 			var containsAt = -1
 			for x := 0; x < len(homeworkJson); x++ {
-				if homeworkJson[x].Date == date {
+				if homeworkJson[x].Date.Equal(date) {
 					contains = true
 					containsAt = 0
 					break
@@ -0,0 +1,167 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+const DefaultImpersonationLogLimit = 100
+
+type ImpersonationToken struct {
+	AccessToken    string `json:"access_token"`
+	ExpiresAt      int64  `json:"expires_at"`
+	UserID         int    `json:"user_id"`
+	ImpersonatedBy int    `json:"impersonated_by"`
+	// Whether requests other than GET are allowed with this token
+	WritesAllowed bool `json:"writes_allowed"`
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// isImpersonated reports whether the token was issued to an admin impersonating the user. The middleware lets
+// every GET request through, so GET handlers that change something as a side effect, such as marking messages
+// as seen, have to skip the change themselves.
+func isImpersonated(claims jwt.MapClaims) bool {
+	return sql.ImpersonatedBy(claims) != -1
+}
+
+// ImpersonationMiddleware logs every request made with an impersonation token and rejects changes,
+// unless they are allowed in the config.
+func (server *httpImpl) ImpersonationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := GetAuthorizationJWT(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := server.db.CheckJWT(token)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		adminId := sql.ImpersonatedBy(claims)
+		if adminId == -1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userId, err := strconv.Atoi(fmt.Sprint(claims["user_id"]))
+		if err != nil {
+			WriteForbiddenJWT(w)
+			return
+		}
+		allowed := isReadOnlyMethod(r.Method) || server.config.ImpersonationAllowWrites
+		endpoint := auditEndpoint(r)
+		server.logger.Infow("impersonated request", "admin_id", adminId, "user_id", userId, "endpoint", endpoint, "allowed", allowed)
+		server.db.RecordImpersonatedRequest(adminId, userId, r.Method, endpoint, GetClientIP(r, server.config.BehindProxy), allowed)
+
+		w.Header().Set("X-Impersonated-By", fmt.Sprint(adminId))
+		if !allowed {
+			WriteJSON(w, Response{Data: "Changes aren't allowed while impersonating a user", Success: false}, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Impersonate issues a short-lived access token, with which the admin sees MeetPlan exactly as the user does.
+func (server *httpImpl) Impersonate(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersImpersonate) {
+		if sql.ImpersonatedBy(jwt) != -1 {
+			WriteJSON(w, Response{Data: "Cannot impersonate while already impersonating a user", Success: false}, http.StatusConflict)
+			return
+		}
+		currentUserId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		sessionId, err := strconv.Atoi(fmt.Sprint(jwt["sid"]))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		userId, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		if userId == currentUserId {
+			WriteJSON(w, Response{Data: "Cannot impersonate itself", Success: false}, http.StatusConflict)
+			return
+		}
+		user, err := server.db.GetUser(userId)
+		if err != nil {
+			WriteJSON(w, Response{Data: "User doesn't exist", Success: false}, http.StatusNotFound)
+			return
+		}
+		// Users who could impersonate others themselves can't be impersonated, so impersonation can't be used
+		// to gain additional permissions.
+		if user.Role == "unverified" || server.db.HasPermission(user.Role, sql.PermissionUsersImpersonate) {
+			WriteForbiddenJWT(w)
+			return
+		}
+		twoFactor, _ := jwt["mfa"].(bool)
+		accessToken, expiresAt, err := server.db.GetJWTForImpersonation(user, currentUserId, sessionId, twoFactor)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		server.logger.Infow("started impersonation", "admin_id", currentUserId, "user_id", userId)
+		server.db.RecordImpersonatedRequest(currentUserId, userId, r.Method, auditEndpoint(r), GetClientIP(r, server.config.BehindProxy), true)
+		WriteJSON(w, Response{Data: ImpersonationToken{
+			AccessToken:    accessToken,
+			ExpiresAt:      expiresAt,
+			UserID:         userId,
+			ImpersonatedBy: currentUserId,
+			WritesAllowed:  server.config.ImpersonationAllowWrites,
+		}, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+func (server *httpImpl) GetImpersonationLogs(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionAuditRead) {
+		query := r.URL.Query()
+		adminId := -1
+		userId := -1
+		if query.Get("admin_id") != "" {
+			adminId, err = strconv.Atoi(query.Get("admin_id"))
+			if err != nil {
+				WriteBadRequest(w)
+				return
+			}
+		}
+		if query.Get("user_id") != "" {
+			userId, err = strconv.Atoi(query.Get("user_id"))
+			if err != nil {
+				WriteBadRequest(w)
+				return
+			}
+		}
+		entries, err := server.db.GetImpersonationLogs(adminId, userId, DefaultImpersonationLogLimit)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve impersonation log", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: entries, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
@@ -0,0 +1,36 @@
+package httphandlers
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/importer"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"net/http"
+)
+
+func (server *httpImpl) ImportStudents(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionUsersImport) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "CSV file isn't provided", Success: false}, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	dryRun := r.FormValue("dry_run") == "true"
+	report, err := importer.NewImporter(server.audited(r, jwt)).ImportStudents(file, dryRun)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to import students", Success: false}, http.StatusBadRequest)
+		return
+	}
+	if len(report.Errors) != 0 {
+		WriteJSON(w, Response{Data: report, Success: false}, http.StatusUnprocessableEntity)
+		return
+	}
+	WriteJSON(w, Response{Data: report, Success: true}, http.StatusOK)
+}
@@ -1,6 +1,9 @@
 package httphandlers
 
 import (
+	"github.com/MeetPlan/MeetPlanBackend/backup"
+	"github.com/MeetPlan/MeetPlanBackend/mailer"
+	"github.com/MeetPlan/MeetPlanBackend/oidc"
 	"github.com/MeetPlan/MeetPlanBackend/proton"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"go.uber.org/zap"
@@ -8,10 +11,13 @@ import (
 )
 
 type httpImpl struct {
-	logger *zap.SugaredLogger
-	db     sql.SQL
-	config sql.Config
-	proton proton.Proton
+	logger  *zap.SugaredLogger
+	db      sql.SQL
+	config  sql.Config
+	proton  proton.Proton
+	mailer  mailer.Mailer
+	sso     oidc.Provider
+	backups backup.Manager
 }
 
 type HTTP interface {
@@ -46,6 +52,8 @@ type HTTP interface {
 	ChangeRole(w http.ResponseWriter, r *http.Request)
 	DeleteUser(w http.ResponseWriter, r *http.Request)
 	GetTeachers(w http.ResponseWriter, r *http.Request)
+	GetSigningKeys(w http.ResponseWriter, r *http.Request)
+	RotateSigningKey(w http.ResponseWriter, r *http.Request)
 
 	// meetings.go
 	GetTimetable(w http.ResponseWriter, r *http.Request)
@@ -121,13 +129,116 @@ type HTTP interface {
 
 	// proton.go
 	ManageTeacherAbsences(w http.ResponseWriter, r *http.Request)
+
+	// sessions.go
+	RefreshToken(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	LogoutEverywhere(w http.ResponseWriter, r *http.Request)
+	RevokeUserSessions(w http.ResponseWriter, r *http.Request)
+
+	// twofactor.go
+	LoginTwoFactor(w http.ResponseWriter, r *http.Request)
+	SetupTwoFactor(w http.ResponseWriter, r *http.Request)
+	ConfirmTwoFactor(w http.ResponseWriter, r *http.Request)
+	DisableTwoFactor(w http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request)
+	ResetTwoFactor(w http.ResponseWriter, r *http.Request)
+	GetTwoFactorRoles(w http.ResponseWriter, r *http.Request)
+	UpdateTwoFactorRoles(w http.ResponseWriter, r *http.Request)
+
+	// password.go
+	ChangePassword(w http.ResponseWriter, r *http.Request)
+	RequestPasswordReset(w http.ResponseWriter, r *http.Request)
+	ResetPassword(w http.ResponseWriter, r *http.Request)
+	ForcePasswordReset(w http.ResponseWriter, r *http.Request)
+
+	// lockout.go
+	UnlockUser(w http.ResponseWriter, r *http.Request)
+	GetLoginAttempts(w http.ResponseWriter, r *http.Request)
+	GetLockouts(w http.ResponseWriter, r *http.Request)
+
+	// permissions.go
+	PermissionMiddleware(next http.Handler) http.Handler
+
+	// roles.go
+	GetPermissions(w http.ResponseWriter, r *http.Request)
+	GetRoles(w http.ResponseWriter, r *http.Request)
+	NewRole(w http.ResponseWriter, r *http.Request)
+	UpdateRole(w http.ResponseWriter, r *http.Request)
+	DeleteRole(w http.ResponseWriter, r *http.Request)
+
+	// import.go
+	ImportStudents(w http.ResponseWriter, r *http.Request)
+
+	// invitations.go
+	NewChildInvitations(w http.ResponseWriter, r *http.Request)
+	RedeemChildInvitation(w http.ResponseWriter, r *http.Request)
+
+	// oidc.go
+	GetOIDCLogin(w http.ResponseWriter, r *http.Request)
+	OIDCCallback(w http.ResponseWriter, r *http.Request)
+
+	// audit.go
+	GetAuditLog(w http.ResponseWriter, r *http.Request)
+	VerifyAuditLog(w http.ResponseWriter, r *http.Request)
+
+	// templates.go
+	GetTimetableTemplates(w http.ResponseWriter, r *http.Request)
+	GetTimetableTemplate(w http.ResponseWriter, r *http.Request)
+	NewTimetableTemplate(w http.ResponseWriter, r *http.Request)
+	PatchTimetableTemplate(w http.ResponseWriter, r *http.Request)
+	DeleteTimetableTemplate(w http.ResponseWriter, r *http.Request)
+
+	// generator.go
+	GetUnavailableHours(w http.ResponseWriter, r *http.Request)
+	PatchUnavailableHours(w http.ResponseWriter, r *http.Request)
+	GetTimetableDrafts(w http.ResponseWriter, r *http.Request)
+	GetTimetableDraft(w http.ResponseWriter, r *http.Request)
+	NewTimetableDraft(w http.ResponseWriter, r *http.Request)
+	PublishTimetableDraft(w http.ResponseWriter, r *http.Request)
+	DeleteTimetableDraft(w http.ResponseWriter, r *http.Request)
+
+	// calendar.go
+	GetCalendarFeed(w http.ResponseWriter, r *http.Request)
+	NewCalendarFeed(w http.ResponseWriter, r *http.Request)
+	DeleteCalendarFeed(w http.ResponseWriter, r *http.Request)
+	GetCalendar(w http.ResponseWriter, r *http.Request)
+
+	// gdpr.go
+	ExportUserData(w http.ResponseWriter, r *http.Request)
+
+	// deletion.go
+	PreviewUserDeletion(w http.ResponseWriter, r *http.Request)
+	GetLegalHolds(w http.ResponseWriter, r *http.Request)
+	SetLegalHold(w http.ResponseWriter, r *http.Request)
+	DeleteLegalHold(w http.ResponseWriter, r *http.Request)
+
+	// impersonation.go
+	Impersonate(w http.ResponseWriter, r *http.Request)
+	GetImpersonationLogs(w http.ResponseWriter, r *http.Request)
+	ImpersonationMiddleware(next http.Handler) http.Handler
+
+	// backup.go
+	GetBackups(w http.ResponseWriter, r *http.Request)
+	NewBackup(w http.ResponseWriter, r *http.Request)
+	DownloadBackup(w http.ResponseWriter, r *http.Request)
+
+	// school_year.go
+	GetSchoolYears(w http.ResponseWriter, r *http.Request)
+	PreviewRollover(w http.ResponseWriter, r *http.Request)
+	RollOver(w http.ResponseWriter, r *http.Request)
+	GetArchivedClasses(w http.ResponseWriter, r *http.Request)
+	GetArchivedStudent(w http.ResponseWriter, r *http.Request)
 }
 
-func NewHTTPInterface(logger *zap.SugaredLogger, db sql.SQL, config sql.Config, proton proton.Proton) HTTP {
+func NewHTTPInterface(logger *zap.SugaredLogger, db sql.SQL, config sql.Config, proton proton.Proton, mailer mailer.Mailer, sso oidc.Provider, backups backup.Manager) HTTP {
 	return &httpImpl{
-		logger: logger,
-		db:     db,
-		config: config,
-		proton: proton,
+		logger:  logger,
+		db:      db,
+		config:  config,
+		proton:  proton,
+		mailer:  mailer,
+		sso:     sso,
+		backups: backups,
 	}
 }
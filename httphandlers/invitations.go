@@ -0,0 +1,228 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/johnfercher/maroto/pkg/props"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MaxInvitationsPerStudent = 4
+
+type ChildInvitationJSON struct {
+	StudentID   int
+	StudentName string
+	ClassName   string
+	Code        string
+	ExpiresAt   int64
+}
+
+func (server *httpImpl) invitationsPDF(invitations []ChildInvitationJSON) ([]byte, error) {
+	m := pdf.NewMaroto(consts.Portrait, consts.A4)
+
+	m.SetFontLocation(server.config.AssetPath("fonts"))
+	m.AddUTF8Font("OpenSans", consts.Normal, "opensans.ttf")
+	m.SetDefaultFontFamily("OpenSans")
+
+	link := strings.TrimSuffix(server.config.FrontendURL, "/")
+
+	for i := 0; i < len(invitations); i++ {
+		invitation := invitations[i]
+		m.Row(45, func() {
+			m.Col(12, func() {
+				m.Text(fmt.Sprintf("Vabilo za starše - %s, %s", invitation.StudentName, invitation.ClassName), props.Text{
+					Top:  5,
+					Size: 13,
+				})
+				m.Text(invitation.Code, props.Text{
+					Top:  14,
+					Size: 20,
+				})
+				m.Text(fmt.Sprintf(
+					"Registrirajte se v MeetPlan sistem %s in vnesite zgornjo kodo, s katero boste povezani z otrokom.",
+					link,
+				), props.Text{
+					Top:  26,
+					Size: 9,
+				})
+				m.Text(fmt.Sprintf(
+					"Koda je enkratna in velja do %s.",
+					time.Unix(invitation.ExpiresAt, 0).Format("02. 01. 2006"),
+				), props.Text{
+					Top:  31,
+					Size: 9,
+				})
+			})
+		})
+		m.Line(5)
+	}
+
+	output, err := m.Output()
+	if err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+func (server *httpImpl) NewChildInvitations(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionParentsInvite) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	classId, err := strconv.Atoi(mux.Vars(r)["class_id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	class, err := server.db.GetClass(classId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve class", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	// Only class teachers can invite parents of their students
+	if class.Teacher != userId && !server.can(jwt, sql.PermissionClassesReadAll) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	students, err := server.db.GetClassStudents(class.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if r.FormValue("student_id") != "" {
+		studentId, err := strconv.Atoi(r.FormValue("student_id"))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		if !contains(students, studentId) {
+			WriteJSON(w, Response{Data: "Student isn't in this class", Success: false}, http.StatusConflict)
+			return
+		}
+		students = []int{studentId}
+	}
+	// One code per parent, so two are usually needed for every student
+	count := 1
+	if r.FormValue("count") != "" {
+		count, err = strconv.Atoi(r.FormValue("count"))
+		if err != nil || count < 1 || count > MaxInvitationsPerStudent {
+			WriteBadRequest(w)
+			return
+		}
+	}
+
+	invitations := make([]ChildInvitationJSON, 0)
+	for i := 0; i < len(students); i++ {
+		student, err := server.db.GetUser(students[i])
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve student", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		for n := 0; n < count; n++ {
+			code, err := server.db.NewChildInvitation(student.ID, userId)
+			if err != nil {
+				WriteJSON(w, Response{Error: err.Error(), Data: "Failed to create invitation", Success: false}, http.StatusInternalServerError)
+				return
+			}
+			invitations = append(invitations, ChildInvitationJSON{
+				StudentID:   student.ID,
+				StudentName: student.Name,
+				ClassName:   class.Name,
+				Code:        code,
+				ExpiresAt:   time.Now().Add(sql.ChildInvitationExpiration).Unix(),
+			})
+		}
+	}
+
+	if r.FormValue("pdf") == "true" {
+		output, err := server.invitationsPDF(invitations)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		w.Write(output)
+		return
+	}
+	WriteJSON(w, Response{Data: invitations, Success: true}, http.StatusOK)
+}
+
+// RedeemChildInvitation links the parent with the student. Parents who are logged in use their JWT, while newly
+// registered (still unverified) parents, who can't log in yet, authenticate using their email and password.
+func (server *httpImpl) RedeemChildInvitation(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("code")
+	if code == "" {
+		WriteBadRequest(w)
+		return
+	}
+	ip := GetClientIP(r, server.config.BehindProxy)
+
+	var parent sql.User
+	if GetAuthorizationJWT(r) != "" {
+		jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+		if err != nil {
+			WriteForbiddenJWT(w)
+			return
+		}
+		userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		parent, err = server.db.GetUser(userId)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+	} else {
+		email := r.FormValue("email")
+		wait := server.reserveLoginAttempt(email, ip)
+		if wait > 0 {
+			WriteTooManyRequests(w, wait)
+			return
+		}
+		user, err := server.db.GetUserByEmail(email)
+		if err != nil {
+			server.registerLoginFailure(-1, email, ip, "unknown email")
+			WriteJSON(w, Response{Data: "Hashes don't match...", Success: false}, http.StatusForbidden)
+			return
+		}
+		if !sql.CheckHash(r.FormValue("pass"), user.Password) {
+			server.registerLoginFailure(user.ID, email, ip, "wrong password")
+			WriteJSON(w, Response{Data: "Hashes don't match...", Success: false}, http.StatusForbidden)
+			return
+		}
+		server.releaseLoginAttempt(email, ip)
+		parent = user
+	}
+
+	// Codes are short enough to be typed in from paper, so guessing them is throttled the same way as passwords
+	wait := server.reserveLoginAttempt(parent.Email, ip)
+	if wait > 0 {
+		WriteTooManyRequests(w, wait)
+		return
+	}
+	student, err := server.auditedUser(r, parent).RedeemChildInvitation(code, parent)
+	if err != nil {
+		server.registerLoginFailure(parent.ID, parent.Email, ip, "invalid invitation code")
+		WriteJSON(w, Response{Data: "Failed to redeem invitation code", Error: err.Error(), Success: false}, http.StatusForbidden)
+		return
+	}
+	server.releaseLoginAttempt(parent.Email, ip)
+	WriteJSON(w, Response{Data: UserJSON{ID: student.ID, Name: student.Name}, Success: true}, http.StatusOK)
+}
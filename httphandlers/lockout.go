@@ -0,0 +1,130 @@
+package httphandlers
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const FailedLoginAttemptsLimit = 500
+
+// reserveLoginAttempt counts the attempt as failed for the account before the credentials are checked, the slow
+// password hash included, so guesses made in parallel are throttled as well. The address is only checked, as
+// whole schools share one and their successful logins mustn't keep it throttled, its failures are counted by
+// registerLoginFailure. It returns how long the caller has to wait when either is locked, in which case the
+// attempt isn't counted.
+func (server *httpImpl) reserveLoginAttempt(email string, ip string) time.Duration {
+	wait := server.db.CheckLoginThrottle(sql.IPThrottleKey(ip))
+	if wait > 0 {
+		return wait
+	}
+	wait, err := server.db.ReserveLoginAttempt(sql.AccountThrottleKey(email), sql.AccountThrottlePolicy)
+	if err != nil {
+		server.logger.Info(err)
+	}
+	return wait
+}
+
+// releaseLoginAttempt takes back the attempt reserveLoginAttempt counted, when it wasn't a failed login.
+func (server *httpImpl) releaseLoginAttempt(email string, ip string) {
+	err := server.db.ReleaseLoginAttempt(sql.AccountThrottleKey(email))
+	if err != nil {
+		server.logger.Info(err)
+	}
+}
+
+// registerLoginFailure records the failed attempt and counts it for the address. The account's failure was
+// already counted by reserveLoginAttempt.
+func (server *httpImpl) registerLoginFailure(userId int, email string, ip string, reason string) {
+	server.db.RecordLoginAttempt(userId, email, ip, false, reason)
+	_, err := server.db.ReserveLoginAttempt(sql.IPThrottleKey(ip), sql.IPThrottlePolicy)
+	if err != nil {
+		server.logger.Info(err)
+	}
+}
+
+// registerLoginSuccess resets the account's failure counter. The address' counter is kept, as a single
+// successful login from a shared address shouldn't allow further guessing of other accounts.
+func (server *httpImpl) registerLoginSuccess(userId int, email string, ip string) {
+	server.db.RecordLoginAttempt(userId, email, ip, true, "")
+	err := server.db.DeleteLoginThrottle(sql.AccountThrottleKey(email))
+	if err != nil {
+		server.logger.Info(err)
+	}
+}
+
+func (server *httpImpl) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersManage) {
+		userId, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		user, err := server.db.GetUser(userId)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve user from database", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		err = server.db.DeleteLoginThrottle(sql.AccountThrottleKey(user.Email))
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to unlock user", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+func (server *httpImpl) GetLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionSecurityManage) {
+		var attempts []sql.LoginAttempt
+		if r.URL.Query().Get("user_id") != "" {
+			userId, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+			if err != nil {
+				WriteBadRequest(w)
+				return
+			}
+			attempts, err = server.db.GetLoginAttemptsForUser(userId)
+		} else {
+			attempts, err = server.db.GetFailedLoginAttempts(FailedLoginAttemptsLimit)
+		}
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve login attempts", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: attempts, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+func (server *httpImpl) GetLockouts(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersManage) {
+		throttles, err := server.db.GetLockedLoginThrottles()
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve lockouts", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: throttles, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
@@ -1,7 +1,6 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
@@ -17,7 +16,7 @@ type MealJSON struct {
 }
 
 type MealDate struct {
-	Date  string
+	Date  sql.Date
 	Meals []MealJSON
 }
 
@@ -26,7 +25,7 @@ func (server *httpImpl) GetMeals(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Data: "Admin has disabled meals", Success: false}, http.StatusForbidden)
 		return
 	}
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -41,11 +40,11 @@ func (server *httpImpl) GetMeals(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
 		return
 	}
+	manageMeals := server.can(jwt, sql.PermissionMealsManage)
 	var mealJson = make([]MealDate, 0)
 	for i := 0; i < len(meals); i++ {
 		meal := meals[i]
-		var orders []int
-		err := json.Unmarshal([]byte(meal.Orders), &orders)
+		orders, err := server.db.GetMealOrders(meal.ID)
 		if err != nil {
 			WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
 			return
@@ -54,7 +53,7 @@ func (server *httpImpl) GetMeals(w http.ResponseWriter, r *http.Request) {
 		var isLimitReached = meal.IsLimited && len(orders) >= meal.OrderLimit
 		var hasAppended = false
 		var mealOrders = make([]UserJSON, 0)
-		if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" || jwt["role"] == "food organizer" {
+		if manageMeals {
 			for n := 0; n < len(orders); n++ {
 				user, err := server.db.GetUser(orders[n])
 				if err != nil {
@@ -69,7 +68,7 @@ func (server *httpImpl) GetMeals(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		for n := 0; n < len(mealJson); n++ {
-			if mealJson[n].Date == meal.Date {
+			if mealJson[n].Date.Equal(meal.Date) {
 				mealJson[n].Meals = append(mealJson[n].Meals, MealJSON{
 					Meal:           meal,
 					HasOrdered:     ordered,
@@ -105,12 +104,12 @@ func (server *httpImpl) NewMeal(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Data: "Admin has disabled meals", Success: false}, http.StatusForbidden)
 		return
 	}
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal assistant" || jwt["role"] == "principal" {
+	if server.can(jwt, sql.PermissionMealsManage) {
 		price, err := strconv.ParseFloat(r.FormValue("price"), 32)
 		if err != nil {
 			WriteJSON(w, Response{Success: false, Data: "Could not parse price", Error: r.FormValue("price")}, http.StatusBadRequest)
@@ -141,13 +140,16 @@ func (server *httpImpl) NewMeal(w http.ResponseWriter, r *http.Request) {
 			WriteJSON(w, Response{Success: false, Data: "Could not parse limit", Error: r.FormValue("limit")}, http.StatusBadRequest)
 			return
 		}
+		date, err := sql.ParseDate(r.FormValue("date"))
+		if err != nil {
+			WriteJSON(w, Response{Success: false, Data: "Could not parse date", Error: r.FormValue("date")}, http.StatusBadRequest)
+			return
+		}
 		meal := sql.Meal{
-			ID:            server.db.GetLastMealID(),
 			Meals:         r.FormValue("description"),
-			Date:          r.FormValue("date"),
+			Date:          date,
 			MealTitle:     r.FormValue("title"),
 			Price:         float32(price),
-			Orders:        "[]",
 			IsLimited:     isLimited,
 			OrderLimit:    orderLimit,
 			IsVegan:       isVegan,
@@ -155,7 +157,7 @@ func (server *httpImpl) NewMeal(w http.ResponseWriter, r *http.Request) {
 			IsLactoseFree: isLactoseFree,
 			BlockOrders:   false,
 		}
-		err = server.db.InsertMeal(meal)
+		meal.ID, err = server.audited(r, jwt).InsertMeal(meal)
 		if err != nil {
 			WriteJSON(w, Response{Success: false, Data: "Could not insert meal", Error: err.Error()}, http.StatusInternalServerError)
 			return
@@ -172,7 +174,7 @@ func (server *httpImpl) NewOrder(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Data: "Admin has disabled meals", Success: false}, http.StatusForbidden)
 		return
 	}
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -195,8 +197,7 @@ func (server *httpImpl) NewOrder(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Success: false, Data: "Orders are blocked."}, http.StatusConflict)
 		return
 	}
-	var orders []int
-	err = json.Unmarshal([]byte(meal.Orders), &orders)
+	orders, err := server.db.GetMealOrders(meal.ID)
 	if err != nil {
 		return
 	}
@@ -204,18 +205,12 @@ func (server *httpImpl) NewOrder(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Success: false, Data: "You cannot order same meal twice."}, http.StatusConflict)
 		return
 	}
-	if meal.IsLimited && len(orders) >= meal.OrderLimit {
-		WriteJSON(w, Response{Success: false, Data: "Orders are closed - maximum orders reached."}, http.StatusConflict)
-		return
-	}
-	orders = append(orders, userId)
-	marshal, err := json.Marshal(orders)
+	ordered, err := server.audited(r, jwt).AddMealOrder(meal.ID, userId)
 	if err != nil {
 		return
 	}
-	meal.Orders = string(marshal)
-	err = server.db.UpdateMeal(meal)
-	if err != nil {
+	if !ordered {
+		WriteJSON(w, Response{Success: false, Data: "Orders are closed - maximum orders reached."}, http.StatusConflict)
 		return
 	}
 	WriteJSON(w, Response{Success: true, Data: "OK"}, http.StatusCreated)
@@ -226,12 +221,12 @@ func (server *httpImpl) EditMeal(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Data: "Admin has disabled meals", Success: false}, http.StatusForbidden)
 		return
 	}
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" || jwt["role"] == "food organizer" {
+	if server.can(jwt, sql.PermissionMealsManage) {
 		//userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		//if err != nil {
 		//	WriteBadRequest(w)
@@ -270,6 +265,11 @@ func (server *httpImpl) EditMeal(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return
 		}
+		date, err := sql.ParseDate(r.FormValue("date"))
+		if err != nil {
+			WriteJSON(w, Response{Success: false, Data: "Could not parse date", Error: r.FormValue("date")}, http.StatusBadRequest)
+			return
+		}
 		meal.Price = float32(price)
 		meal.IsLimited = isLimited
 		meal.IsVegan = isVegan
@@ -277,9 +277,9 @@ func (server *httpImpl) EditMeal(w http.ResponseWriter, r *http.Request) {
 		meal.IsLactoseFree = isLactoseFree
 		meal.OrderLimit = orderLimit
 		meal.Meals = r.FormValue("description")
-		meal.Date = r.FormValue("date")
+		meal.Date = date
 		meal.MealTitle = r.FormValue("title")
-		err = server.db.UpdateMeal(meal)
+		err = server.audited(r, jwt).UpdateMeal(meal)
 		if err != nil {
 			return
 		}
@@ -295,12 +295,12 @@ func (server *httpImpl) DeleteMeal(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Data: "Admin has disabled meals", Success: false}, http.StatusForbidden)
 		return
 	}
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" || jwt["role"] == "food organizer" {
+	if server.can(jwt, sql.PermissionMealsManage) {
 		//userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		//if err != nil {
 		//	WriteBadRequest(w)
@@ -311,7 +311,7 @@ func (server *httpImpl) DeleteMeal(w http.ResponseWriter, r *http.Request) {
 			WriteBadRequest(w)
 			return
 		}
-		err = server.db.DeleteMeal(mealId)
+		err = server.audited(r, jwt).DeleteMeal(mealId)
 		if err != nil {
 			return
 		}
@@ -327,12 +327,12 @@ func (server *httpImpl) BlockUnblockOrder(w http.ResponseWriter, r *http.Request
 		WriteJSON(w, Response{Data: "Admin has disabled meals", Success: false}, http.StatusForbidden)
 		return
 	}
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal assistant" || jwt["role"] == "principal" || jwt["role"] == "food organizer" {
+	if server.can(jwt, sql.PermissionMealsManage) {
 		//userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		//if err != nil {
 		//	WriteBadRequest(w)
@@ -348,7 +348,7 @@ func (server *httpImpl) BlockUnblockOrder(w http.ResponseWriter, r *http.Request
 			return
 		}
 		meal.BlockOrders = !meal.BlockOrders
-		err = server.db.UpdateMeal(meal)
+		err = server.audited(r, jwt).UpdateMeal(meal)
 		if err != nil {
 			return
 		}
@@ -364,7 +364,7 @@ func (server *httpImpl) RemoveOrder(w http.ResponseWriter, r *http.Request) {
 		WriteJSON(w, Response{Data: "Admin has disabled meals", Success: false}, http.StatusForbidden)
 		return
 	}
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -379,26 +379,11 @@ func (server *httpImpl) RemoveOrder(w http.ResponseWriter, r *http.Request) {
 		WriteBadRequest(w)
 		return
 	}
-	meal, err := server.db.GetMeal(mealId)
-	if err != nil {
-		return
-	}
-	var orders []int
-	err = json.Unmarshal([]byte(meal.Orders), &orders)
-	if err != nil {
-		return
-	}
-	for i := 0; i < len(orders); i++ {
-		if orders[i] == userId {
-			orders = remove(orders, i)
-		}
-	}
-	marshal, err := json.Marshal(orders)
+	_, err = server.db.GetMeal(mealId)
 	if err != nil {
 		return
 	}
-	meal.Orders = string(marshal)
-	err = server.db.UpdateMeal(meal)
+	err = server.audited(r, jwt).RemoveMealOrder(mealId, userId)
 	if err != nil {
 		return
 	}
@@ -406,7 +391,7 @@ func (server *httpImpl) RemoveOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) MealsBlocked(w http.ResponseWriter, r *http.Request) {
-	_, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	_, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
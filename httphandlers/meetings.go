@@ -1,16 +1,17 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/proton"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
-	"strings"
-	"time"
 )
 
+// MaxTimetableDays limits how many days after the first one a single timetable request can span.
+const MaxTimetableDays = 366
+
 type Meeting struct {
 	sql.Meeting
 	TeacherName string
@@ -20,7 +21,7 @@ type Meeting struct {
 
 type TimetableDate struct {
 	Meetings [][]sql.Meeting `json:"meetings"`
-	Date     string          `json:"date"`
+	Date     sql.Date        `json:"date"`
 }
 
 type Absence struct {
@@ -49,7 +50,7 @@ func contains(s []int, e int) bool {
 }
 
 func (server *httpImpl) GetTimetable(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -59,6 +60,7 @@ func (server *httpImpl) GetTimetable(w http.ResponseWriter, r *http.Request) {
 		WriteForbiddenJWT(w)
 		return
 	}
+	readAll := server.can(jwt, sql.PermissionMeetingsReadAll)
 
 	var users []int
 	myMeetings := false
@@ -69,12 +71,12 @@ func (server *httpImpl) GetTimetable(w http.ResponseWriter, r *http.Request) {
 			WriteBadRequest(w)
 			return
 		}
-		class, err := server.db.GetClass(classId)
+		_, err = server.db.GetClass(classId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		err = json.Unmarshal([]byte(class.Students), &users)
+		users, err = server.db.GetClassStudents(classId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -90,35 +92,21 @@ func (server *httpImpl) GetTimetable(w http.ResponseWriter, r *http.Request) {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		if subject.InheritsClass {
-			class, err := server.db.GetClass(subject.ClassID)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-			err = json.Unmarshal([]byte(class.Students), &users)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err = json.Unmarshal([]byte(subject.Students), &users)
-			if err != nil {
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
+		users, err = server.db.GetSubjectStudents(subject)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
 		}
 	} else if r.URL.Query().Get("studentId") != "" {
-		if jwt["role"] == "student" {
-			WriteForbiddenJWT(w)
+		studentId, err := strconv.Atoi(r.URL.Query().Get("studentId"))
+		if err != nil {
+			WriteBadRequest(w)
 			return
 		}
 		users = make([]int, 0)
-		// TODO: This doesn't seem right
-		users = append(users, uid)
-		myMeetings = true
+		users = append(users, studentId)
 	} else if r.URL.Query().Get("teacherId") != "" {
-		if jwt["role"] == "admin" || jwt["role"] == "principal assistant" || jwt["role"] == "principal" {
+		if readAll {
 			teacherId, err := strconv.Atoi(r.URL.Query().Get("teacherId"))
 			if err != nil {
 				WriteBadRequest(w)
@@ -137,55 +125,62 @@ func (server *httpImpl) GetTimetable(w http.ResponseWriter, r *http.Request) {
 		users = append(users, uid)
 		myMeetings = true
 	}
-	if jwt["role"] == "student" {
-		var isIn = false
+	if !myMeetings && !readAll && !server.can(jwt, sql.PermissionClassesRead) {
+		// Students and parents only see lessons of themselves and their children
+		children, err := server.db.GetChildren(uid)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		var own = make([]int, 0)
 		for n := 0; n < len(users); n++ {
-			if users[n] == uid {
-				isIn = true
-				break
+			if users[n] == uid || contains(children, users[n]) {
+				own = append(own, users[n])
 			}
 		}
-		if !isIn {
+		if len(own) == 0 {
 			WriteForbiddenJWT(w)
 			return
 		}
+		users = own
 	}
-	startDate := r.URL.Query().Get("start")
-	endDate := r.URL.Query().Get("end")
-	var dates = make([]string, 0)
-	// Do some fancy logic to get dates
-	i := 0
-	for {
-		ndate, err := time.Parse("02-01-2006", startDate)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-			return
-		}
-		ndate = ndate.AddDate(0, 0, i)
-		d2 := strings.Split(ndate.Format("02-01-2006"), " ")[0]
-		dates = append(dates, d2)
-		if d2 == endDate {
-			break
-		}
-		i++
+	startDate, err := sql.ParseDate(r.URL.Query().Get("start"))
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+		return
+	}
+	endDate, err := sql.ParseDate(r.URL.Query().Get("end"))
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+		return
+	}
+	if endDate.Before(startDate) || endDate.After(startDate.AddDays(MaxTimetableDays)) {
+		WriteJSON(w, Response{Data: fmt.Sprintf("Timetable can span from 1 to %d days", MaxTimetableDays+1), Success: false}, http.StatusBadRequest)
+		return
+	}
+	var dates = make([]sql.Date, 0)
+	for date := startDate; !date.After(endDate); date = date.AddDays(1) {
+		dates = append(dates, date)
 	}
 
 	if len(users) == 0 {
 		return
 	}
-	user, err := server.db.GetUser(users[0])
+
+	meetingsInRange, err := server.db.GetMeetingsBetween(startDate, endDate)
 	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 		return
 	}
+	meetingsByDate := make(map[string][]sql.Meeting)
+	for _, meeting := range meetingsInRange {
+		meetingsByDate[meeting.Date.String()] = append(meetingsByDate[meeting.Date.String()], meeting)
+	}
 
 	var meetingsJson = make([]TimetableDate, 0)
 	for i := 0; i < len(dates); i++ {
 		date := dates[i]
-		meetings, err := server.db.GetMeetingsOnSpecificDate(date)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-			return
-		}
+		meetings := meetingsByDate[date.String()]
 		var m = make([]sql.Meeting, 0)
 		for n := 0; n < len(meetings); n++ {
 			meeting := meetings[n]
@@ -193,64 +188,24 @@ func (server *httpImpl) GetTimetable(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				return
 			}
-			var u []int
-			if subject.InheritsClass {
-				class, err := server.db.GetClass(subject.ClassID)
-				if err != nil {
-					return
-				}
-				err = json.Unmarshal([]byte(class.Students), &u)
-				if err != nil {
-					return
-				}
-			} else {
-				err = json.Unmarshal([]byte(subject.Students), &u)
-				if err != nil {
-					return
-				}
-			}
-			var cont = false
-			currentUser, err := server.db.GetUser(uid)
+			u, err := server.db.GetSubjectStudents(subject)
 			if err != nil {
 				return
 			}
-			var studentsParent []int
-			err = json.Unmarshal([]byte(currentUser.Users), &studentsParent)
-			if err != nil {
-				return
+			// Timetables of single users contain lessons they teach as well as those they attend
+			if myMeetings && meeting.TeacherID == users[0] {
+				m = append(m, meeting)
+				continue
 			}
-
-			// Check if at least one user belongs to class
 			for x := 0; x < len(u); x++ {
-				if (myMeetings && (jwt["role"] == "teacher" || jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant")) || contains(users, u[x]) {
-					if jwt["role"] == "parent" {
-						if !contains(studentsParent, u[x]) {
-							continue
-						}
-					}
-					cont = true
+				if contains(users, u[x]) {
+					m = append(m, meeting)
 					break
 				}
 			}
-
-			if cont {
-				if user.Role == "teacher" && myMeetings {
-					if meeting.TeacherID == user.ID {
-						m = append(m, meeting)
-					}
-				} else {
-					if jwt["role"] == "student" {
-						if contains(u, uid) {
-							m = append(m, meeting)
-						}
-					} else if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" || (!myMeetings && jwt["role"] == "teacher") || (myMeetings && jwt["role"] == "teacher" && meeting.TeacherID == uid) || jwt["role"] == "parent" {
-						m = append(m, meeting)
-					}
-				}
-			}
 		}
 		dateMeetingsJson := make([][]sql.Meeting, 0)
-		for n := 0; n < 9; n++ {
+		for n := 0; n < sql.TimetableHours; n++ {
 			hour := make([]sql.Meeting, 0)
 			for c := 0; c < len(m); c++ {
 				meeting := m[c]
@@ -267,13 +222,17 @@ func (server *httpImpl) GetTimetable(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) NewMeeting(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "teacher" || jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
-		date := r.FormValue("date")
+	if server.can(jwt, sql.PermissionMeetingsWrite) {
+		date, err := sql.ParseDate(r.FormValue("date"))
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+			return
+		}
 		hour, err := strconv.Atoi(r.FormValue("hour"))
 		if err != nil {
 			WriteBadRequest(w)
@@ -319,7 +278,6 @@ func (server *httpImpl) NewMeeting(w http.ResponseWriter, r *http.Request) {
 		}
 
 		meeting := sql.Meeting{
-			ID:                  server.db.GetLastMeetingID(),
 			MeetingName:         name,
 			TeacherID:           teacherId,
 			SubjectID:           subjectId,
@@ -334,30 +292,30 @@ func (server *httpImpl) NewMeeting(w http.ResponseWriter, r *http.Request) {
 			IsSubstitution:      false,
 		}
 
-		err = server.db.InsertMeeting(meeting)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-			return
-		}
-		WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+		_, conflicts, err := server.proton.SaveMeeting(server.audited(r, jwt), meeting, server.config.FreeDays(), server.overridesConflicts(r, jwt))
+		savedMeeting(w, conflicts, err)
 	} else {
 		WriteForbiddenJWT(w)
 	}
 }
 
 func (server *httpImpl) PatchMeeting(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "teacher" || jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionMeetingsWrite) {
 		id, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
 			WriteBadRequest(w)
 			return
 		}
-		date := r.FormValue("date")
+		date, err := sql.ParseDate(r.FormValue("date"))
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+			return
+		}
 		hour, err := strconv.Atoi(r.FormValue("hour"))
 		if err != nil {
 			WriteBadRequest(w)
@@ -398,7 +356,7 @@ func (server *httpImpl) PatchMeeting(w http.ResponseWriter, r *http.Request) {
 
 		isSubstitutionString := r.FormValue("is_substitution")
 		var isSubstitution = false
-		if (jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant") && isSubstitutionString == "true" {
+		if server.can(jwt, sql.PermissionSubstitutions) && isSubstitutionString == "true" {
 			isSubstitution = true
 			teacherId, err = strconv.Atoi(r.FormValue("teacherId"))
 			if err != nil {
@@ -414,7 +372,7 @@ func (server *httpImpl) PatchMeeting(w http.ResponseWriter, r *http.Request) {
 		}
 
 		originalmeeting, err := server.db.GetMeeting(id)
-		if originalmeeting.TeacherID != teacherId && jwt["role"] == "teacher" {
+		if originalmeeting.TeacherID != teacherId && !server.can(jwt, sql.PermissionMeetingsWriteAll) {
 			WriteForbiddenJWT(w)
 			return
 		}
@@ -435,24 +393,28 @@ func (server *httpImpl) PatchMeeting(w http.ResponseWriter, r *http.Request) {
 			IsSubstitution:      isSubstitution,
 		}
 
-		err = server.db.UpdateMeeting(meeting)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-			return
+		// Meetings that stay in place may keep their conflicts, so details of already conflicting meetings can be changed
+		allow := server.overridesConflicts(r, jwt)
+		if meeting.Date.Equal(originalmeeting.Date) && meeting.Hour == originalmeeting.Hour &&
+			meeting.TeacherID == originalmeeting.TeacherID && meeting.SubjectID == originalmeeting.SubjectID {
+			allow = func(conflicts []proton.Conflict) bool {
+				return true
+			}
 		}
-		WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+		_, conflicts, err := server.proton.SaveMeeting(server.audited(r, jwt), meeting, server.config.FreeDays(), allow)
+		savedMeeting(w, conflicts, err)
 	} else {
 		WriteForbiddenJWT(w)
 	}
 }
 
 func (server *httpImpl) DeleteMeeting(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "teacher" || jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionMeetingsWrite) {
 		id, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -466,12 +428,12 @@ func (server *httpImpl) DeleteMeeting(w http.ResponseWriter, r *http.Request) {
 		}
 
 		originalmeeting, err := server.db.GetMeeting(id)
-		if originalmeeting.TeacherID != teacherId && jwt["role"] == "teacher" {
+		if originalmeeting.TeacherID != teacherId && !server.can(jwt, sql.PermissionMeetingsWriteAll) {
 			WriteForbiddenJWT(w)
 			return
 		}
 
-		err = server.db.DeleteMeeting(id)
+		err = server.audited(r, jwt).DeleteMeeting(id)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -483,7 +445,7 @@ func (server *httpImpl) DeleteMeeting(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetMeeting(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -497,52 +459,39 @@ func (server *httpImpl) GetMeeting(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	if jwt["role"] == "student" {
+	if !server.can(jwt, sql.PermissionClassesRead) && !server.can(jwt, sql.PermissionMeetingsReadAll) {
+		// Students and parents only see lessons of themselves and their children
 		uid, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			WriteForbiddenJWT(w)
 			return
 		}
-		subjects, err := server.db.GetAllSubjects()
+		subject, err := server.db.GetSubject(meeting.SubjectID)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		for i := 0; i < len(subjects); i++ {
-			subject := subjects[i]
-			if subject.ID == meeting.SubjectID {
-				var users []int
-				if subject.InheritsClass {
-					class, err := server.db.GetClass(subject.ClassID)
-					if err != nil {
-						WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-						return
-					}
-					err = json.Unmarshal([]byte(class.Students), &users)
-					if err != nil {
-						WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-						return
-					}
-				} else {
-					err := json.Unmarshal([]byte(subject.Students), &users)
-					if err != nil {
-						WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-						return
-					}
-				}
-				var isIn = false
-				for n := 0; n < len(users); n++ {
-					if users[n] == uid {
-						isIn = true
-						break
-					}
-				}
-				if !isIn {
-					WriteForbiddenJWT(w)
-					return
-				}
+		users, err := server.db.GetSubjectStudents(subject)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		children, err := server.db.GetChildren(uid)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		var isIn = meeting.TeacherID == uid
+		for n := 0; n < len(users); n++ {
+			if users[n] == uid || contains(children, users[n]) {
+				isIn = true
+				break
 			}
 		}
+		if !isIn {
+			WriteForbiddenJWT(w)
+			return
+		}
 	}
 	teacher, err := server.db.GetUser(meeting.TeacherID)
 	if err != nil {
@@ -567,12 +516,12 @@ func (server *httpImpl) GetMeeting(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetAbsencesTeacher(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "teacher" || jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionAbsencesWrite) {
 		meetingId, err := strconv.Atoi(mux.Vars(r)["meeting_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -586,7 +535,7 @@ func (server *httpImpl) GetAbsencesTeacher(w http.ResponseWriter, r *http.Reques
 		if err != nil {
 			return
 		}
-		if jwt["role"] == "teacher" && meeting.TeacherID != teacherId {
+		if !server.can(jwt, sql.PermissionAbsencesWriteAll) && meeting.TeacherID != teacherId {
 			WriteForbiddenJWT(w)
 			return
 		}
@@ -598,21 +547,9 @@ func (server *httpImpl) GetAbsencesTeacher(w http.ResponseWriter, r *http.Reques
 		if err != nil {
 			return
 		}
-		var users []int
-		if subject.InheritsClass {
-			class, err := server.db.GetClass(subject.ClassID)
-			if err != nil {
-				return
-			}
-			err = json.Unmarshal([]byte(class.Students), &users)
-			if err != nil {
-				return
-			}
-		} else {
-			err = json.Unmarshal([]byte(subject.Students), &users)
-			if err != nil {
-				return
-			}
+		users, err := server.db.GetSubjectStudents(subject)
+		if err != nil {
+			return
 		}
 		var absences = make([]Absence, 0)
 		for i := 0; i < len(users); i++ {
@@ -625,15 +562,17 @@ func (server *httpImpl) GetAbsencesTeacher(w http.ResponseWriter, r *http.Reques
 			if err != nil {
 				if err.Error() == "sql: no rows in result set" {
 					absence := sql.Absence{
-						ID:          server.db.GetLastAbsenceID(),
 						UserID:      userId,
 						TeacherID:   teacherId,
 						MeetingID:   meetingId,
 						AbsenceType: "UNMANAGED",
 					}
-					err := server.db.InsertAbsence(absence)
-					if err != nil {
-						return
+					// An impersonating admin sees the absence as well, but it's only saved once the teacher opens the meeting
+					if !isImpersonated(jwt) {
+						absence.ID, err = server.audited(r, jwt).InsertAbsence(absence)
+						if err != nil {
+							return
+						}
 					}
 					absences = append(absences, Absence{
 						Absence:     absence,
@@ -658,12 +597,12 @@ func (server *httpImpl) GetAbsencesTeacher(w http.ResponseWriter, r *http.Reques
 }
 
 func (server *httpImpl) PatchAbsence(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "teacher" || jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionAbsencesWrite) {
 		absenceId, err := strconv.Atoi(mux.Vars(r)["absence_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -677,13 +616,13 @@ func (server *httpImpl) PatchAbsence(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return
 		}
-		if jwt["role"] == "teacher" && absence.TeacherID != teacherId {
+		if !server.can(jwt, sql.PermissionAbsencesWriteAll) && absence.TeacherID != teacherId {
 			WriteForbiddenJWT(w)
 			return
 		}
 		absence.TeacherID = teacherId
 		absence.AbsenceType = r.FormValue("absence_type")
-		err = server.db.UpdateAbsence(absence)
+		err = server.audited(r, jwt).UpdateAbsence(absence)
 		if err != nil {
 			return
 		}
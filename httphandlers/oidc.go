@@ -0,0 +1,159 @@
+package httphandlers
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/dchest/uniuri"
+	"net/http"
+)
+
+type OIDCLoginJSON struct {
+	URL string `json:"url"`
+}
+
+// oidcRole returns the MeetPlan role for user's identity provider groups, or an empty string when none
+// of the groups is mapped. Admin role can't be granted by the identity provider.
+func (server *httpImpl) oidcRole(groups []string) string {
+	for _, mapping := range server.config.OIDCRoleMapping {
+		for i := 0; i < len(groups); i++ {
+			if groups[i] != mapping.Group {
+				continue
+			}
+			if mapping.Role == sql.AdminRole {
+				server.logger.Warnw("ignoring OIDC role mapping to admin role", "group", mapping.Group)
+				continue
+			}
+			_, err := server.db.GetRole(mapping.Role)
+			if err != nil {
+				server.logger.Warnw("OIDC role mapping refers to unknown role", "group", mapping.Group, "role", mapping.Role)
+				continue
+			}
+			return mapping.Role
+		}
+	}
+	return ""
+}
+
+// GetOIDCLogin returns the identity provider's URL the frontend should redirect the user to.
+func (server *httpImpl) GetOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if server.sso == nil {
+		WriteJSON(w, Response{Data: "Single sign-on isn't configured", Success: false}, http.StatusNotFound)
+		return
+	}
+	state, nonce, err := server.db.NewOIDCState()
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	url, err := server.sso.AuthCodeURL(state, nonce)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Identity provider is unavailable", Success: false}, http.StatusBadGateway)
+		return
+	}
+	WriteJSON(w, Response{Data: OIDCLoginJSON{URL: url}, Success: true}, http.StatusOK)
+}
+
+// OIDCCallback completes the login with the code and state the identity provider redirected the user back with.
+// Users are matched by email and, if enabled, created on their first login. The role is synced with the
+// identity provider's groups on every login.
+func (server *httpImpl) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if server.sso == nil {
+		WriteJSON(w, Response{Data: "Single sign-on isn't configured", Success: false}, http.StatusNotFound)
+		return
+	}
+	code := r.FormValue("code")
+	state := r.FormValue("state")
+	if code == "" || state == "" {
+		WriteBadRequest(w)
+		return
+	}
+	ip := GetClientIP(r, server.config.BehindProxy)
+	wait := server.db.CheckLoginThrottle(sql.IPThrottleKey(ip))
+	if wait > 0 {
+		WriteTooManyRequests(w, wait)
+		return
+	}
+
+	nonce, err := server.db.ConsumeOIDCState(state)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Invalid login state, please try again", Success: false}, http.StatusForbidden)
+		return
+	}
+	claims, err := server.sso.Exchange(code, nonce)
+	if err != nil {
+		server.logger.Info(err)
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to sign in with identity provider", Success: false}, http.StatusForbidden)
+		return
+	}
+	// Accounts are matched by email, so unverified emails would allow taking over other users' accounts
+	if claims.Email == "" || !claims.EmailVerified {
+		server.db.RecordLoginAttempt(-1, claims.Email, ip, false, "oidc: email isn't verified")
+		WriteJSON(w, Response{Data: "Identity provider didn't return a verified email", Success: false}, http.StatusForbidden)
+		return
+	}
+	wait = server.db.CheckLoginThrottle(sql.AccountThrottleKey(claims.Email))
+	if wait > 0 {
+		WriteTooManyRequests(w, wait)
+		return
+	}
+
+	role := server.oidcRole(claims.Groups)
+	user, err := server.db.GetUserByEmail(claims.Email)
+	if err != nil {
+		if err.Error() != "sql: no rows in result set" {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Could not retrieve user from database", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		if !server.config.OIDCProvisionUsers {
+			server.db.RecordLoginAttempt(-1, claims.Email, ip, false, "oidc: unknown user")
+			WriteJSON(w, Response{Data: "You don't have a MeetPlan account", Success: false}, http.StatusForbidden)
+			return
+		}
+		// Password is random and never shown, so the user can only sign in using single sign-on or after a password reset
+		password, err := sql.HashPassword(uniuri.NewLen(64))
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to hash your password", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		name := claims.Name
+		if name == "" {
+			name = claims.Email
+		}
+		if role == "" {
+			role = "unverified"
+		}
+		user = sql.User{
+			Email:                  claims.Email,
+			Password:               password,
+			Role:                   role,
+			Name:                   name,
+			BirthCertificateNumber: "",
+			CityOfBirth:            "",
+			CountryOfBirth:         "",
+		}
+		// The user doesn't have an ID yet, so the insert is recorded without an actor
+		user.ID, err = server.audited(r, nil).InsertUser(user)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to commit new user to database", Success: false}, http.StatusInternalServerError)
+			return
+		}
+	} else if role != "" && role != user.Role && user.Role != sql.AdminRole {
+		user.Role = role
+		err = server.auditedUser(r, user).UpdateUser(user)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to update user's role", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		// Existing sessions still carry the old role
+		err = server.db.RevokeAllUserSessions(user.ID)
+		if err != nil {
+			server.logger.Info(err)
+		}
+	}
+
+	if user.Role == "unverified" {
+		WriteJSON(w, Response{Data: "You are unverified. You cannot login until the school administrator confirms you.", Success: false}, http.StatusForbidden)
+		return
+	}
+
+	server.completeLogin(w, user, ip)
+}
@@ -1,7 +1,6 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
@@ -10,12 +9,12 @@ import (
 )
 
 func (server *httpImpl) AssignUserToParent(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] != "admin" {
+	if !server.can(jwt, sql.PermissionParentsManage) {
 		WriteForbiddenJWT(w)
 		return
 	}
@@ -45,21 +44,7 @@ func (server *httpImpl) AssignUserToParent(w http.ResponseWriter, r *http.Reques
 		WriteJSON(w, Response{Data: "User isn't a student", Success: false}, http.StatusConflict)
 		return
 	}
-	var users []int
-	err = json.Unmarshal([]byte(user.Users), &users)
-	if err != nil {
-		return
-	}
-	if contains(users, studentId) {
-		return
-	}
-	users = append(users, studentId)
-	marshal, err := json.Marshal(users)
-	if err != nil {
-		return
-	}
-	user.Users = string(marshal)
-	err = server.db.UpdateUser(user)
+	err = server.audited(r, jwt).AddChildToParent(user.ID, studentId)
 	if err != nil {
 		return
 	}
@@ -69,30 +54,25 @@ func (server *httpImpl) AssignUserToParent(w http.ResponseWriter, r *http.Reques
 }
 
 func (server *httpImpl) GetMyChildren(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "parent" {
-		var parentId int
-		if jwt["role"] == "admin" {
+	// Users see their own children, the parentId of other parents needs parents.manage
+	parentId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		return
+	}
+	if r.URL.Query().Get("parentId") == "" || server.can(jwt, sql.PermissionParentsManage) {
+		if r.URL.Query().Get("parentId") != "" {
 			parentId, err = strconv.Atoi(r.URL.Query().Get("parentId"))
 			if err != nil {
+				WriteBadRequest(w)
 				return
 			}
-		} else {
-			parentId, err = strconv.Atoi(fmt.Sprint(jwt["user_id"]))
-			if err != nil {
-				return
-			}
-		}
-		parent, err := server.db.GetUser(parentId)
-		if err != nil {
-			return
 		}
-		var children []int
-		err = json.Unmarshal([]byte(parent.Users), &children)
+		children, err := server.db.GetChildren(parentId)
 		if err != nil {
 			return
 		}
@@ -117,12 +97,12 @@ func (server *httpImpl) GetMyChildren(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) RemoveUserFromParent(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] != "admin" {
+	if !server.can(jwt, sql.PermissionParentsManage) {
 		WriteForbiddenJWT(w)
 		return
 	}
@@ -144,22 +124,7 @@ func (server *httpImpl) RemoveUserFromParent(w http.ResponseWriter, r *http.Requ
 		WriteBadRequest(w)
 		return
 	}
-	var users []int
-	err = json.Unmarshal([]byte(user.Users), &users)
-	if err != nil {
-		return
-	}
-	for i := 0; i < len(users); i++ {
-		if users[i] == studentId {
-			users = remove(users, i)
-		}
-	}
-	marshal, err := json.Marshal(users)
-	if err != nil {
-		return
-	}
-	user.Users = string(marshal)
-	err = server.db.UpdateUser(user)
+	err = server.audited(r, jwt).RemoveChildFromParent(user.ID, studentId)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,187 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/dchest/uniuri"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func (server *httpImpl) sendPasswordResetEmail(user sql.User) error {
+	token, err := server.db.NewPasswordReset(user.ID)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/reset_password?token=%s", strings.TrimSuffix(server.config.FrontendURL, "/"), url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Pozdravljeni, %s!\n\nZa vaš MeetPlan račun je bila zahtevana ponastavitev gesla. Geslo lahko ponastavite na naslednji povezavi, ki je veljavna 1 uro:\n\n%s\n\nČe ponastavitve gesla niste zahtevali, lahko to sporočilo ignorirate.\n\nMeetPlan sistem",
+		user.Name, link,
+	)
+	return server.mailer.Send(user.Email, "MeetPlan - ponastavitev gesla", body)
+}
+
+func (server *httpImpl) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	sessionId, err := strconv.Atoi(fmt.Sprint(jwt["sid"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	oldPass := r.FormValue("old_pass")
+	newPass := r.FormValue("new_pass")
+	if newPass == "" {
+		WriteJSON(w, Response{Data: "Bad Request. A parameter isn't provided", Success: false}, http.StatusBadRequest)
+		return
+	}
+	user, err := server.db.GetUser(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	// The old password is throttled like logins, so stolen access tokens can't be used to guess it
+	ip := GetClientIP(r, server.config.BehindProxy)
+	wait := server.reserveLoginAttempt(user.Email, ip)
+	if wait > 0 {
+		server.db.RecordLoginAttempt(user.ID, user.Email, ip, false, "throttled password change")
+		WriteTooManyRequests(w, wait)
+		return
+	}
+	if !sql.CheckHash(oldPass, user.Password) {
+		server.registerLoginFailure(user.ID, user.Email, ip, "wrong password on password change")
+		WriteJSON(w, Response{Data: "Hashes don't match...", Success: false}, http.StatusForbidden)
+		return
+	}
+	server.registerLoginSuccess(user.ID, user.Email, ip)
+	password, err := sql.HashPassword(newPass)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to hash your password", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	user.Password = password
+	err = server.audited(r, jwt).UpdateUser(user)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to update user", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	// Log out all other devices, current one can stay logged in
+	err = server.db.RevokeOtherUserSessions(user.ID, sessionId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	email := r.FormValue("email")
+	if email == "" {
+		WriteBadRequest(w)
+		return
+	}
+	// Requests are throttled before the email is looked up, so throttling doesn't reveal registered emails either
+	ip := GetClientIP(r, server.config.BehindProxy)
+	wait, err := server.db.ReserveLoginAttempt(sql.PasswordResetIPThrottleKey(ip), sql.IPThrottlePolicy)
+	if err != nil {
+		server.logger.Info(err)
+	}
+	if wait == 0 {
+		wait, err = server.db.ReserveLoginAttempt(sql.PasswordResetThrottleKey(email), sql.PasswordResetThrottlePolicy)
+		if err != nil {
+			server.logger.Info(err)
+		}
+	}
+	if wait > 0 {
+		WriteTooManyRequests(w, wait)
+		return
+	}
+	user, err := server.db.GetUserByEmail(email)
+	if err != nil {
+		if err.Error() != "sql: no rows in result set" {
+			server.logger.Info(err)
+		}
+		// We don't want to reveal which emails are registered, so we reply the same way as on success
+		WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+		return
+	}
+	// Sending takes a while, so the reply is sent right away, just like for emails that aren't registered
+	go func() {
+		err := server.sendPasswordResetEmail(user)
+		if err != nil {
+			server.logger.Infow("Failed to send password reset email", "user_id", user.ID, "error", err.Error())
+		}
+	}()
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	pass := r.FormValue("pass")
+	if token == "" || pass == "" {
+		WriteJSON(w, Response{Data: "Bad Request. A parameter isn't provided", Success: false}, http.StatusBadRequest)
+		return
+	}
+	err := server.audited(r, nil).ResetPassword(token, pass)
+	if err != nil {
+		WriteJSON(w, Response{Data: "Failed to reset password", Error: err.Error(), Success: false}, http.StatusForbidden)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersManage) {
+		userId, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		user, err := server.db.GetUser(userId)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve user from database", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		// Old password mustn't work anymore, so we replace it with a random one nobody knows
+		password, err := sql.HashPassword(uniuri.NewLen(64))
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to hash password", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		user.Password = password
+		err = server.audited(r, jwt).UpdateUser(user)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to update user", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		err = server.db.RevokeAllUserSessions(user.ID)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		err = server.sendPasswordResetEmail(user)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to send password reset email", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
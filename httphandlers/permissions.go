@@ -0,0 +1,176 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// RoutePermissions maps routes (method and path template, as registered by NewRouter) to the permission that is
+// required to access them. It is enforced by PermissionMiddleware before the handler is called. Routes that
+// aren't listed are either public or available to every logged-in user, as handlers limit them to user's own data.
+var RoutePermissions = map[string]string{
+	"DELETE /user/2fa/{id}":                                               sql.PermissionSecurityManage,
+	"PATCH /user/password/force_reset/{id}":                               sql.PermissionUsersManage,
+	"GET /user/check/has/class":                                           sql.PermissionClassesRead,
+	"PATCH /user/get/data/{user_id}":                                      sql.PermissionUsersManage,
+	"GET /user/get/ending_certificate/{student_id}":                       sql.PermissionCertificates,
+	"GET /user/get/certificate_of_schooling/{user_id}":                    sql.PermissionSchoolingCert,
+	"PATCH /user/get/absences/{student_id}/excuse/{absence_id}":           sql.PermissionAbsencesExcuse,
+	"GET /class/get/{class_id}/self_testing":                              sql.PermissionTestingManage,
+	"PATCH /user/self_testing/patch/{class_id}/{student_id}":              sql.PermissionTestingManage,
+	"POST /class/get/{class_id}/invitations":                              sql.PermissionParentsInvite,
+	"POST /class/new":                                                     sql.PermissionClassesManage,
+	"GET /class/get/{id}":                                                 sql.PermissionClassesRead,
+	"PATCH /class/get/{id}":                                               sql.PermissionClassesManage,
+	"DELETE /class/get/{id}":                                              sql.PermissionClassesManage,
+	"PATCH /class/get/{class_id}/add_user/{user_id}":                      sql.PermissionClassesManage,
+	"DELETE /class/get/{class_id}/remove_user/{user_id}":                  sql.PermissionClassesManage,
+	"PATCH /meal/get/{meal_id}":                                           sql.PermissionMealsManage,
+	"DELETE /meal/get/{meal_id}":                                          sql.PermissionMealsManage,
+	"POST /meals/new":                                                     sql.PermissionMealsManage,
+	"GET /teachers/get":                                                   sql.PermissionUsersRead,
+	"GET /students/get":                                                   sql.PermissionUsersRead,
+	"PATCH /user/role/update/{id}":                                        sql.PermissionUsersChangeRole,
+	"GET /user/delete/{id}/preview":                                       sql.PermissionUsersDelete,
+	"PUT /user/legal_hold/{id}":                                           sql.PermissionUsersLegalHold,
+	"DELETE /user/legal_hold/{id}":                                        sql.PermissionUsersLegalHold,
+	"POST /admin/impersonate/{id}":                                        sql.PermissionUsersImpersonate,
+	"GET /admin/impersonation_log":                                        sql.PermissionAuditRead,
+	"GET /admin/legal_holds":                                              sql.PermissionUsersLegalHold,
+	"DELETE /user/delete/{id}":                                            sql.PermissionUsersDelete,
+	"DELETE /user/sessions/{id}":                                          sql.PermissionUsersManage,
+	"DELETE /user/lockout/{id}":                                           sql.PermissionUsersManage,
+	"PATCH /parent/{parent}/assign/student/{student}":                     sql.PermissionParentsManage,
+	"DELETE /parent/{parent}/assign/student/{student}":                    sql.PermissionParentsManage,
+	"PATCH /order/get/{meal_id}/block_unblock":                            sql.PermissionMealsManage,
+	"GET /my/grades":                                                      sql.PermissionGradesRead,
+	"GET /my/gradings":                                                    sql.PermissionGradesRead,
+	"POST /meetings/new":                                                  sql.PermissionMeetingsWrite,
+	"GET /timetable/templates":                                            sql.PermissionMeetingsWrite,
+	"POST /timetable/templates":                                           sql.PermissionMeetingsWrite,
+	"GET /timetable/templates/{template_id}":                              sql.PermissionMeetingsWrite,
+	"PATCH /timetable/templates/{template_id}":                            sql.PermissionMeetingsWrite,
+	"DELETE /timetable/templates/{template_id}":                           sql.PermissionMeetingsWrite,
+	"GET /timetable/availability/{teacher_id}":                            sql.PermissionMeetingsWrite,
+	"PATCH /timetable/availability/{teacher_id}":                          sql.PermissionMeetingsWrite,
+	"GET /timetable/drafts":                                               sql.PermissionTimetableManage,
+	"POST /timetable/drafts":                                              sql.PermissionTimetableManage,
+	"GET /timetable/drafts/{draft_id}":                                    sql.PermissionTimetableManage,
+	"DELETE /timetable/drafts/{draft_id}":                                 sql.PermissionTimetableManage,
+	"POST /timetable/drafts/{draft_id}/publish":                           sql.PermissionTimetableManage,
+	"PATCH /meetings/new/{id}":                                            sql.PermissionMeetingsWrite,
+	"DELETE /meetings/new/{id}":                                           sql.PermissionMeetingsWrite,
+	"GET /meeting/get/{meeting_id}/absences":                              sql.PermissionAbsencesWrite,
+	"GET /meeting/get/{meeting_id}/grades":                                sql.PermissionGradesWrite,
+	"PATCH /meeting/get/{meeting_id}/homework/{homework_id}/{student_id}": sql.PermissionHomeworkWrite,
+	"POST /meeting/get/{meeting_id}/homework":                             sql.PermissionHomeworkWrite,
+	"GET /meeting/get/{meeting_id}/homework":                              sql.PermissionHomeworkWrite,
+	"GET /meeting/get/{meeting_id}/substitutions/proton":                  sql.PermissionTimetableManage,
+	"PATCH /meeting/absence/{absence_id}":                                 sql.PermissionAbsencesWrite,
+	"POST /grades/new/{meeting_id}":                                       sql.PermissionGradesWrite,
+	"PATCH /grade/get/{grade_id}":                                         sql.PermissionGradesWrite,
+	"DELETE /grade/get/{grade_id}":                                        sql.PermissionGradesWrite,
+	"POST /subjects/new":                                                  sql.PermissionSubjectsManage,
+	"GET /subject/get/{subject_id}":                                       sql.PermissionSubjectsManage,
+	"DELETE /subject/get/{subject_id}":                                    sql.PermissionSubjectsManage,
+	"PATCH /subject/get/{subject_id}":                                     sql.PermissionSubjectsManage,
+	"PATCH /subject/get/{subject_id}/add_user/{user_id}":                  sql.PermissionSubjectsManage,
+	"DELETE /subject/get/{subject_id}/remove_user/{user_id}":              sql.PermissionSubjectsManage,
+	"GET /admin/config/get":                                               sql.PermissionConfigManage,
+	"PATCH /admin/config/get":                                             sql.PermissionConfigManage,
+	"GET /admin/keys/get":                                                 sql.PermissionSecurityManage,
+	"POST /admin/keys/rotate":                                             sql.PermissionSecurityManage,
+	"GET /admin/2fa/roles":                                                sql.PermissionSecurityManage,
+	"PATCH /admin/2fa/roles":                                              sql.PermissionSecurityManage,
+	"GET /admin/login_attempts":                                           sql.PermissionSecurityManage,
+	"GET /admin/audit":                                                    sql.PermissionAuditRead,
+	"GET /admin/audit/verify":                                             sql.PermissionAuditRead,
+	"GET /admin/lockouts":                                                 sql.PermissionUsersManage,
+	"GET /admin/roles":                                                    sql.PermissionRolesManage,
+	"POST /admin/roles":                                                   sql.PermissionRolesManage,
+	"PATCH /admin/roles/{name}":                                           sql.PermissionRolesManage,
+	"DELETE /admin/roles/{name}":                                          sql.PermissionRolesManage,
+	"POST /admin/import/students":                                         sql.PermissionUsersImport,
+	"GET /admin/permissions":                                              sql.PermissionRolesManage,
+	"GET /admin/backups":                                                  sql.PermissionBackupsManage,
+	"POST /admin/backups":                                                 sql.PermissionBackupsManage,
+	"GET /admin/backups/{name}":                                           sql.PermissionBackupsManage,
+	"GET /admin/school_years":                                             sql.PermissionSchoolYears,
+	"GET /admin/school_years/rollover":                                    sql.PermissionSchoolYears,
+	"POST /admin/school_years/rollover":                                   sql.PermissionSchoolYears,
+	"GET /admin/school_years/{id}/classes":                                sql.PermissionSchoolYears,
+	"POST /system/notifications/new":                                      sql.PermissionNotifications,
+	"DELETE /notification/{notification_id}":                              sql.PermissionNotifications,
+}
+
+func routeKey(method string, template string) string {
+	return method + " " + template
+}
+
+func (server *httpImpl) can(claims jwt.MapClaims, permission string) bool {
+	return server.db.HasPermission(fmt.Sprint(claims["role"]), permission)
+}
+
+// PermissionMiddleware rejects requests to routes listed in RoutePermissions when the user's role
+// doesn't have the required permission.
+func (server *httpImpl) PermissionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		permission, ok := RoutePermissions[routeKey(r.Method, template)]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+		if err != nil {
+			WriteForbiddenJWT(w)
+			return
+		}
+		if !server.can(claims, permission) {
+			WriteForbiddenJWT(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CheckRoutePermissions makes sure every entry in RoutePermissions belongs to a registered route, so renaming
+// a route can't silently remove its permission check.
+func CheckRoutePermissions(r *mux.Router) error {
+	registered := make(map[string]bool)
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for i := 0; i < len(methods); i++ {
+			registered[routeKey(methods[i], template)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for key := range RoutePermissions {
+		if !registered[key] {
+			return fmt.Errorf("permission is defined for unknown route %s", key)
+		}
+	}
+	return nil
+}
@@ -1,19 +1,61 @@
 package httphandlers
 
 import (
+	"github.com/MeetPlan/MeetPlanBackend/proton"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
 )
 
+// checkedConflicts reports whether a meeting or template with these conflicts can be saved. Otherwise it writes
+// the conflicts with 409 Conflict.
+func (server *httpImpl) checkedConflicts(w http.ResponseWriter, r *http.Request, claims jwt.MapClaims, conflicts []proton.Conflict, err error) bool {
+	if err != nil {
+		WriteJSON(w, Response{Data: "Failed to check scheduling conflicts", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return false
+	}
+	if len(conflicts) == 0 || server.overridesConflicts(r, claims)(conflicts) {
+		return true
+	}
+	WriteJSON(w, Response{Data: conflicts, Error: "scheduling conflicts", Success: false}, http.StatusConflict)
+	return false
+}
+
+// overridesConflicts returns whether the user saves a meeting or template with conflicts anyway. Users with the
+// meetings.override_conflicts permission can, but only when they explicitly ask for it with
+// override_conflicts=true.
+func (server *httpImpl) overridesConflicts(r *http.Request, claims jwt.MapClaims) func(conflicts []proton.Conflict) bool {
+	return func(conflicts []proton.Conflict) bool {
+		if r.FormValue("override_conflicts") == "true" && server.can(claims, sql.PermissionMeetingsOverride) {
+			server.logger.Infow("scheduling conflicts overridden", "user_id", claims["user_id"], "conflicts", len(conflicts))
+			return true
+		}
+		return false
+	}
+}
+
+// savedMeeting writes the response of a meeting saved with Proton's SaveMeeting.
+func savedMeeting(w http.ResponseWriter, conflicts []proton.Conflict, err error) {
+	if err == proton.ErrConflicts {
+		WriteJSON(w, Response{Data: conflicts, Error: err.Error(), Success: false}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
 func (server *httpImpl) ManageTeacherAbsences(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionTimetableManage) {
 		meetingId, err := strconv.Atoi(mux.Vars(r)["meeting_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -0,0 +1,165 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (server *httpImpl) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionRolesManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	WriteJSON(w, Response{Data: sql.PermissionRegistry, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) GetRoles(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionRolesManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	roles, err := server.db.GetRoles()
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve roles", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	var rolesJson = make([]sql.RoleJSON, 0)
+	for i := 0; i < len(roles); i++ {
+		permissions, err := server.db.GetPermissionsForRole(roles[i].Name)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to retrieve permissions", Success: false}, http.StatusInternalServerError)
+			return
+		}
+		rolesJson = append(rolesJson, sql.RoleJSON{Role: roles[i], Permissions: permissions})
+	}
+	WriteJSON(w, Response{Data: rolesJson, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) NewRole(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionRolesManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		WriteJSON(w, Response{Data: "Bad Request. A parameter isn't provided", Success: false}, http.StatusBadRequest)
+		return
+	}
+	var permissions []string
+	err = json.Unmarshal([]byte(r.FormValue("permissions")), &permissions)
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	rank := 0
+	if r.FormValue("rank") != "" {
+		rank, err = strconv.Atoi(r.FormValue("rank"))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+	}
+	_, err = server.db.GetRole(name)
+	if err == nil {
+		WriteJSON(w, Response{Data: "Role already exists", Success: false}, http.StatusConflict)
+		return
+	}
+	err = server.audited(r, jwt).InsertRole(sql.Role{Name: name, Description: r.FormValue("description"), IsBuiltIn: false, Rank: rank})
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to insert role", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	err = server.audited(r, jwt).SetRolePermissions(name, permissions)
+	if err != nil {
+		// Don't leave a half-created role behind
+		server.audited(r, jwt).DeleteRole(name)
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to set permissions", Success: false}, http.StatusBadRequest)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusCreated)
+}
+
+func (server *httpImpl) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionRolesManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	role, err := server.db.GetRole(mux.Vars(r)["name"])
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Role doesn't exist", Success: false}, http.StatusNotFound)
+		return
+	}
+	if r.FormValue("permissions") != "" {
+		var permissions []string
+		err = json.Unmarshal([]byte(r.FormValue("permissions")), &permissions)
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		err = server.audited(r, jwt).SetRolePermissions(role.Name, permissions)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to set permissions", Success: false}, http.StatusBadRequest)
+			return
+		}
+	}
+	if r.FormValue("description") != "" || r.FormValue("rank") != "" {
+		if r.FormValue("description") != "" {
+			role.Description = r.FormValue("description")
+		}
+		if r.FormValue("rank") != "" {
+			role.Rank, err = strconv.Atoi(r.FormValue("rank"))
+			if err != nil {
+				WriteBadRequest(w)
+				return
+			}
+		}
+		err = server.audited(r, jwt).UpdateRole(role)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to update role", Success: false}, http.StatusInternalServerError)
+			return
+		}
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionRolesManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	err = server.audited(r, jwt).DeleteRole(mux.Vars(r)["name"])
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to delete role", Success: false}, http.StatusConflict)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
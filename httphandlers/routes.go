@@ -0,0 +1,178 @@
+package httphandlers
+
+import "github.com/gorilla/mux"
+
+// NewRouter registers all routes of the API together with their middlewares. It fails when RoutePermissions
+// has an entry for a route that isn't registered, see CheckRoutePermissions.
+func NewRouter(httphandler HTTP) (*mux.Router, error) {
+	r := mux.NewRouter()
+	r.HandleFunc("/user/new", httphandler.NewUser).Methods("POST")
+	r.HandleFunc("/user/login", httphandler.Login).Methods("POST")
+	r.HandleFunc("/user/token/refresh", httphandler.RefreshToken).Methods("POST")
+	r.HandleFunc("/user/logout", httphandler.Logout).Methods("POST")
+	r.HandleFunc("/user/logout/all", httphandler.LogoutEverywhere).Methods("POST")
+	r.HandleFunc("/user/login/2fa", httphandler.LoginTwoFactor).Methods("POST")
+	r.HandleFunc("/user/login/oidc", httphandler.GetOIDCLogin).Methods("GET")
+	r.HandleFunc("/user/login/oidc/callback", httphandler.OIDCCallback).Methods("POST")
+	r.HandleFunc("/user/2fa/setup", httphandler.SetupTwoFactor).Methods("POST")
+	r.HandleFunc("/user/2fa/confirm", httphandler.ConfirmTwoFactor).Methods("POST")
+	r.HandleFunc("/user/2fa", httphandler.DisableTwoFactor).Methods("DELETE")
+	r.HandleFunc("/user/2fa/recovery_codes", httphandler.RegenerateRecoveryCodes).Methods("POST")
+	r.HandleFunc("/user/2fa/{id}", httphandler.ResetTwoFactor).Methods("DELETE")
+	r.HandleFunc("/user/password", httphandler.ChangePassword).Methods("PATCH")
+	r.HandleFunc("/user/password/reset/request", httphandler.RequestPasswordReset).Methods("POST")
+	r.HandleFunc("/user/password/reset", httphandler.ResetPassword).Methods("POST")
+	r.HandleFunc("/user/password/force_reset/{id}", httphandler.ForcePasswordReset).Methods("PATCH")
+	// Get all classes for specific user
+	r.HandleFunc("/user/get/classes", httphandler.GetAllClasses).Methods("GET")
+	r.HandleFunc("/user/check/has/class", httphandler.HasClass).Methods("GET")
+	r.HandleFunc("/user/get/data/{id}", httphandler.GetUserData).Methods("GET")
+	r.HandleFunc("/user/get/data/{user_id}", httphandler.PatchUser).Methods("PATCH")
+	r.HandleFunc("/user/get/homework/{id}", httphandler.GetUserHomework).Methods("GET")
+	r.HandleFunc("/user/get/absences/{id}", httphandler.GetAbsencesUser).Methods("GET")
+	r.HandleFunc("/user/get/ending_certificate/{student_id}", httphandler.PrintCertificateOfEndingClass).Methods("GET")
+	r.HandleFunc("/user/get/certificate_of_schooling/{user_id}", httphandler.CertificateOfSchooling).Methods("GET")
+	r.HandleFunc("/user/get/export/{user_id}", httphandler.ExportUserData).Methods("GET")
+	r.HandleFunc("/user/get/unread_messages", httphandler.GetUnreadMessages).Methods("GET")
+	r.HandleFunc("/user/calendar", httphandler.GetCalendarFeed).Methods("GET")
+	r.HandleFunc("/user/calendar", httphandler.NewCalendarFeed).Methods("POST")
+	r.HandleFunc("/user/calendar", httphandler.DeleteCalendarFeed).Methods("DELETE")
+	// Subscription URL for calendar apps, authenticated by the feed's token
+	r.HandleFunc("/calendar/{token}.ics", httphandler.GetCalendar).Methods("GET")
+
+	r.HandleFunc("/user/get/absences/{student_id}/excuse/{absence_id}", httphandler.ExcuseAbsence).Methods("PATCH")
+
+	r.HandleFunc("/class/get/{class_id}/self_testing", httphandler.GetSelfTestingTeacher).Methods("GET")
+	r.HandleFunc("/user/self_testing/patch/{class_id}/{student_id}", httphandler.PatchSelfTesting).Methods("PATCH")
+	r.HandleFunc("/user/self_testing/get_results", httphandler.GetTestingResults).Methods("GET")
+	r.HandleFunc("/user/self_testing/get_results/pdf/{test_id}", httphandler.GetPDFSelfTestingReportStudent).Methods("GET")
+
+	r.HandleFunc("/class/new", httphandler.NewClass).Methods("POST")
+	r.HandleFunc("/class/get/{id}", httphandler.GetClass).Methods("GET")
+	r.HandleFunc("/class/get/{id}", httphandler.PatchClass).Methods("PATCH")
+	r.HandleFunc("/class/get/{id}", httphandler.DeleteClass).Methods("DELETE")
+	// Get all classes in database
+	r.HandleFunc("/classes/get", httphandler.GetClasses).Methods("GET")
+	r.HandleFunc("/class/get/{class_id}/add_user/{user_id}", httphandler.AssignUserToClass).Methods("PATCH")
+	r.HandleFunc("/class/get/{class_id}/remove_user/{user_id}", httphandler.RemoveUserFromClass).Methods("DELETE")
+	r.HandleFunc("/class/get/{class_id}/invitations", httphandler.NewChildInvitations).Methods("POST")
+
+	r.HandleFunc("/users/get", httphandler.GetAllUsers).Methods("GET")
+	r.HandleFunc("/meals/get", httphandler.GetMeals).Methods("GET")
+	r.HandleFunc("/meal/get/{meal_id}", httphandler.EditMeal).Methods("PATCH")
+	r.HandleFunc("/meal/get/{meal_id}", httphandler.DeleteMeal).Methods("DELETE")
+	r.HandleFunc("/meals/new", httphandler.NewMeal).Methods("POST")
+	r.HandleFunc("/meals/blocked", httphandler.MealsBlocked).Methods("GET")
+	r.HandleFunc("/teachers/get", httphandler.GetTeachers).Methods("GET")
+	r.HandleFunc("/students/get", httphandler.GetStudents).Methods("GET")
+	r.HandleFunc("/user/role/update/{id}", httphandler.ChangeRole).Methods("PATCH")
+	r.HandleFunc("/user/delete/{id}", httphandler.DeleteUser).Methods("DELETE")
+	r.HandleFunc("/user/delete/{id}/preview", httphandler.PreviewUserDeletion).Methods("GET")
+	r.HandleFunc("/user/legal_hold/{id}", httphandler.SetLegalHold).Methods("PUT")
+	r.HandleFunc("/user/legal_hold/{id}", httphandler.DeleteLegalHold).Methods("DELETE")
+	r.HandleFunc("/admin/legal_holds", httphandler.GetLegalHolds).Methods("GET")
+	r.HandleFunc("/user/sessions/{id}", httphandler.RevokeUserSessions).Methods("DELETE")
+	r.HandleFunc("/user/lockout/{id}", httphandler.UnlockUser).Methods("DELETE")
+
+	r.HandleFunc("/parent/{parent}/assign/student/{student}", httphandler.AssignUserToParent).Methods("PATCH")
+	r.HandleFunc("/parent/{parent}/assign/student/{student}", httphandler.RemoveUserFromParent).Methods("DELETE")
+	r.HandleFunc("/parents/get/students", httphandler.GetMyChildren).Methods("GET")
+	r.HandleFunc("/parents/get/config", httphandler.ParentConfig).Methods("GET")
+	r.HandleFunc("/parents/invitations/redeem", httphandler.RedeemChildInvitation).Methods("POST")
+
+	r.HandleFunc("/order/new/{meal_id}", httphandler.NewOrder).Methods("POST")
+	r.HandleFunc("/order/get/{meal_id}/block_unblock", httphandler.BlockUnblockOrder).Methods("PATCH")
+	r.HandleFunc("/order/get/{meal_id}", httphandler.RemoveOrder).Methods("DELETE")
+
+	r.HandleFunc("/my/grades", httphandler.GetMyGrades).Methods("GET")
+	r.HandleFunc("/my/gradings", httphandler.GetMyGradings).Methods("GET")
+
+	r.HandleFunc("/timetable/get", httphandler.GetTimetable).Methods("GET")
+	r.HandleFunc("/timetable/templates", httphandler.GetTimetableTemplates).Methods("GET")
+	r.HandleFunc("/timetable/templates", httphandler.NewTimetableTemplate).Methods("POST")
+	r.HandleFunc("/timetable/templates/{template_id}", httphandler.GetTimetableTemplate).Methods("GET")
+	r.HandleFunc("/timetable/templates/{template_id}", httphandler.PatchTimetableTemplate).Methods("PATCH")
+	r.HandleFunc("/timetable/templates/{template_id}", httphandler.DeleteTimetableTemplate).Methods("DELETE")
+	r.HandleFunc("/timetable/availability/{teacher_id}", httphandler.GetUnavailableHours).Methods("GET")
+	r.HandleFunc("/timetable/availability/{teacher_id}", httphandler.PatchUnavailableHours).Methods("PATCH")
+	r.HandleFunc("/timetable/drafts", httphandler.GetTimetableDrafts).Methods("GET")
+	r.HandleFunc("/timetable/drafts", httphandler.NewTimetableDraft).Methods("POST")
+	r.HandleFunc("/timetable/drafts/{draft_id}", httphandler.GetTimetableDraft).Methods("GET")
+	r.HandleFunc("/timetable/drafts/{draft_id}", httphandler.DeleteTimetableDraft).Methods("DELETE")
+	r.HandleFunc("/timetable/drafts/{draft_id}/publish", httphandler.PublishTimetableDraft).Methods("POST")
+
+	r.HandleFunc("/meetings/new", httphandler.NewMeeting).Methods("POST")
+	r.HandleFunc("/meetings/new/{id}", httphandler.PatchMeeting).Methods("PATCH")
+	r.HandleFunc("/meetings/new/{id}", httphandler.DeleteMeeting).Methods("DELETE")
+
+	r.HandleFunc("/communications/get", httphandler.GetCommunications).Methods("GET")
+	r.HandleFunc("/communication/get/{id}", httphandler.GetCommunication).Methods("GET")
+	r.HandleFunc("/communication/get/{id}/message/new", httphandler.NewMessage).Methods("POST")
+	r.HandleFunc("/communication/new", httphandler.NewCommunication).Methods("POST")
+
+	r.HandleFunc("/message/get/{message_id}", httphandler.DeleteMessage).Methods("DELETE")
+	r.HandleFunc("/message/get/{message_id}", httphandler.EditMessage).Methods("PATCH")
+
+	r.HandleFunc("/meeting/get/{meeting_id}", httphandler.GetMeeting).Methods("GET")
+	r.HandleFunc("/meeting/get/{meeting_id}/absences", httphandler.GetAbsencesTeacher).Methods("GET")
+	r.HandleFunc("/meeting/get/{meeting_id}/grades", httphandler.GetGradesForMeeting).Methods("GET")
+	r.HandleFunc("/meeting/get/{meeting_id}/homework/{homework_id}/{student_id}", httphandler.PatchHomeworkForStudent).Methods("PATCH")
+	r.HandleFunc("/meeting/get/{meeting_id}/homework", httphandler.NewHomework).Methods("POST")
+	r.HandleFunc("/meeting/get/{meeting_id}/homework", httphandler.GetAllHomeworksForSpecificSubject).Methods("GET")
+	r.HandleFunc("/meeting/get/{meeting_id}/substitutions/proton", httphandler.ManageTeacherAbsences).Methods("GET")
+
+	r.HandleFunc("/meeting/absence/{absence_id}", httphandler.PatchAbsence).Methods("PATCH")
+
+	r.HandleFunc("/grades/new/{meeting_id}", httphandler.NewGrade).Methods("POST")
+
+	r.HandleFunc("/grade/get/{grade_id}", httphandler.PatchGrade).Methods("PATCH")
+	r.HandleFunc("/grade/get/{grade_id}", httphandler.DeleteGrade).Methods("DELETE")
+
+	r.HandleFunc("/subjects/get", httphandler.GetSubjects).Methods("GET")
+	r.HandleFunc("/subjects/new", httphandler.NewSubject).Methods("POST")
+
+	r.HandleFunc("/subject/get/{subject_id}", httphandler.GetSubject).Methods("GET")
+	r.HandleFunc("/subject/get/{subject_id}", httphandler.DeleteSubject).Methods("DELETE")
+	r.HandleFunc("/subject/get/{subject_id}", httphandler.PatchSubjectName).Methods("PATCH")
+	r.HandleFunc("/subject/get/{subject_id}/add_user/{user_id}", httphandler.AssignUserToSubject).Methods("PATCH")
+	r.HandleFunc("/subject/get/{subject_id}/remove_user/{user_id}", httphandler.RemoveUserFromSubject).Methods("DELETE")
+
+	r.HandleFunc("/admin/config/get", httphandler.GetConfig).Methods("GET")
+	r.HandleFunc("/admin/config/get", httphandler.UpdateConfiguration).Methods("PATCH")
+	r.HandleFunc("/admin/keys/get", httphandler.GetSigningKeys).Methods("GET")
+	r.HandleFunc("/admin/keys/rotate", httphandler.RotateSigningKey).Methods("POST")
+	r.HandleFunc("/admin/2fa/roles", httphandler.GetTwoFactorRoles).Methods("GET")
+	r.HandleFunc("/admin/2fa/roles", httphandler.UpdateTwoFactorRoles).Methods("PATCH")
+	r.HandleFunc("/admin/login_attempts", httphandler.GetLoginAttempts).Methods("GET")
+	r.HandleFunc("/admin/audit", httphandler.GetAuditLog).Methods("GET")
+	r.HandleFunc("/admin/audit/verify", httphandler.VerifyAuditLog).Methods("GET")
+	r.HandleFunc("/admin/impersonate/{id}", httphandler.Impersonate).Methods("POST")
+	r.HandleFunc("/admin/impersonation_log", httphandler.GetImpersonationLogs).Methods("GET")
+	r.HandleFunc("/admin/lockouts", httphandler.GetLockouts).Methods("GET")
+	r.HandleFunc("/admin/permissions", httphandler.GetPermissions).Methods("GET")
+	r.HandleFunc("/admin/roles", httphandler.GetRoles).Methods("GET")
+	r.HandleFunc("/admin/roles", httphandler.NewRole).Methods("POST")
+	r.HandleFunc("/admin/roles/{name}", httphandler.UpdateRole).Methods("PATCH")
+	r.HandleFunc("/admin/roles/{name}", httphandler.DeleteRole).Methods("DELETE")
+	r.HandleFunc("/admin/import/students", httphandler.ImportStudents).Methods("POST")
+	r.HandleFunc("/admin/backups", httphandler.GetBackups).Methods("GET")
+	r.HandleFunc("/admin/backups", httphandler.NewBackup).Methods("POST")
+	r.HandleFunc("/admin/backups/{name}", httphandler.DownloadBackup).Methods("GET")
+	r.HandleFunc("/admin/school_years", httphandler.GetSchoolYears).Methods("GET")
+	r.HandleFunc("/admin/school_years/rollover", httphandler.PreviewRollover).Methods("GET")
+	r.HandleFunc("/admin/school_years/rollover", httphandler.RollOver).Methods("POST")
+	r.HandleFunc("/admin/school_years/{id}/classes", httphandler.GetArchivedClasses).Methods("GET")
+	r.HandleFunc("/user/get/archive/{user_id}", httphandler.GetArchivedStudent).Methods("GET")
+
+	r.HandleFunc("/system/notifications", httphandler.GetSystemNotifications).Methods("GET")
+	r.HandleFunc("/system/notifications/new", httphandler.NewNotification).Methods("POST")
+	r.HandleFunc("/notification/{notification_id}", httphandler.DeleteNotification).Methods("DELETE")
+
+	err := CheckRoutePermissions(r)
+	if err != nil {
+		return nil, err
+	}
+	r.Use(httphandler.ImpersonationMiddleware)
+	r.Use(httphandler.PermissionMiddleware)
+	return r, nil
+}
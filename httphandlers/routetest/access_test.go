@@ -0,0 +1,145 @@
+package routetest
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/httphandlers"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"strings"
+)
+
+// access describes who may call a route in the school of newSchool. Callers without a token and unverified
+// users never may, unless the route is public.
+type access struct {
+	// Public routes don't depend on the caller, so every caller has to get the same status as one without a token
+	public  bool
+	allowed func(s *suite, role string) bool
+	// who names the callers that are allowed, for reporting failures
+	who string
+}
+
+var public = access{public: true, who: "everyone"}
+
+var loggedIn = access{
+	allowed: func(s *suite, role string) bool {
+		return true
+	},
+	who: "logged-in users",
+}
+
+func permission(permission string) access {
+	return access{
+		allowed: func(s *suite, role string) bool {
+			return s.db.HasPermission(role, permission)
+		},
+		who: "roles with " + permission,
+	}
+}
+
+// roles allows the roles, who describes how their users relate to the route's rows.
+func roles(who string, roles ...string) access {
+	return access{
+		allowed: func(s *suite, role string) bool {
+			for i := 0; i < len(roles); i++ {
+				if roles[i] == role {
+					return true
+				}
+			}
+			return false
+		},
+		who: who,
+	}
+}
+
+func anyOf(accesses ...access) access {
+	who := make([]string, 0)
+	for i := 0; i < len(accesses); i++ {
+		who = append(who, accesses[i].who)
+	}
+	return access{
+		allowed: func(s *suite, role string) bool {
+			for i := 0; i < len(accesses); i++ {
+				if accesses[i].allowed(s, role) {
+					return true
+				}
+			}
+			return false
+		},
+		who: strings.Join(who, " and "),
+	}
+}
+
+// handlerAccess lists routes that aren't in httphandlers.RoutePermissions, as their handlers decide who may call
+// them. Routes about a user are called for the student of the school, so the student stands for the user
+// themselves and the parent for a parent of the user.
+var handlerAccess = map[string]access{
+	"POST /user/new":                    public,
+	"POST /user/login":                  public,
+	"POST /user/token/refresh":          public,
+	"POST /user/login/2fa":              public,
+	"GET /user/login/oidc":              public,
+	"POST /user/login/oidc/callback":    public,
+	"POST /user/password/reset/request": public,
+	"POST /user/password/reset":         public,
+	// The suite doesn't know any feed token
+	"GET /calendar/{token}.ics": public,
+	// The code is checked before the token, and the suite doesn't send one
+	"POST /parents/invitations/redeem": public,
+
+	"POST /user/logout":                                loggedIn,
+	"POST /user/logout/all":                            loggedIn,
+	"POST /user/2fa/setup":                             loggedIn,
+	"POST /user/2fa/confirm":                           loggedIn,
+	"DELETE /user/2fa":                                 loggedIn,
+	"POST /user/2fa/recovery_codes":                    loggedIn,
+	"PATCH /user/password":                             loggedIn,
+	"GET /user/get/classes":                            loggedIn,
+	"GET /user/get/data/{id}":                          anyOf(roles("the user and their parents", "student", "parent"), permission(sql.PermissionUsersRead), permission(sql.PermissionClassesRead)),
+	"GET /user/get/homework/{id}":                      anyOf(roles("the user and their parents", "student", "parent"), permission(sql.PermissionHomeworkWrite)),
+	"GET /user/get/unread_messages":                    loggedIn,
+	"GET /user/calendar":                               loggedIn,
+	"POST /user/calendar":                              loggedIn,
+	"DELETE /user/calendar":                            loggedIn,
+	"GET /user/self_testing/get_results":               loggedIn,
+	"GET /user/self_testing/get_results/pdf/{test_id}": anyOf(roles("the tested student and their parents", "student", "parent"), permission(sql.PermissionTestingManage)),
+	"GET /classes/get":                                 loggedIn,
+	"GET /users/get":                                   loggedIn,
+	"GET /meals/get":                                   loggedIn,
+	"GET /meals/blocked":                               loggedIn,
+	"POST /order/new/{meal_id}":                        loggedIn,
+	"DELETE /order/get/{meal_id}":                      loggedIn,
+	"GET /timetable/get":                               loggedIn,
+	"GET /subjects/get":                                loggedIn,
+	"GET /meeting/get/{meeting_id}":                    anyOf(roles("students of the meeting and their parents", "student", "parent"), permission(sql.PermissionClassesRead), permission(sql.PermissionMeetingsReadAll)),
+	"GET /system/notifications":                        loggedIn,
+	"GET /communications/get":                          loggedIn,
+	"POST /communication/new":                          loggedIn,
+	// Every user of the school is in the communication
+	"GET /communication/get/{id}":              loggedIn,
+	"POST /communication/get/{id}/message/new": loggedIn,
+
+	"GET /user/get/absences/{id}": anyOf(
+		roles("the user, their parent and their class teacher", "student", "parent", "teacher"),
+		permission(sql.PermissionClassesReadAll),
+	),
+	"GET /user/get/export/{user_id}": anyOf(
+		roles("the user and their parent", "student", "parent"),
+		permission(sql.PermissionUsersExport),
+	),
+	"GET /user/get/archive/{user_id}": anyOf(
+		roles("the user and their parent", "student", "parent"),
+		permission(sql.PermissionSchoolYears),
+		permission(sql.PermissionClassesReadAll),
+	),
+	"GET /parents/get/students": loggedIn,
+	"GET /parents/get/config":   loggedIn,
+	// The teacher wrote the message
+	"PATCH /message/get/{message_id}":  roles("the author", "teacher"),
+	"DELETE /message/get/{message_id}": roles("the author", "teacher"),
+}
+
+func (s *suite) access(route string) (access, bool) {
+	if p, ok := httphandlers.RoutePermissions[route]; ok {
+		return permission(p), true
+	}
+	a, ok := handlerAccess[route]
+	return a, ok
+}
@@ -0,0 +1,11 @@
+// Package routetest checks the role matrix of the API: for every route registered by httphandlers.NewRouter it
+// calls the route as every built-in role and without a token, and checks who is turned away. Requests go through
+// the whole router with its middlewares, using httptest, against an in-memory SQLite database of a small school
+// built with the fixtures package:
+//
+//	go test ./httphandlers/routetest -v
+//
+// Every call starts from the same database, so routes that delete or change rows can't affect other calls.
+// Routes listed in httphandlers.RoutePermissions are expected to be open to roles with the permission, the others
+// check access in their handlers and need an entry in handlerAccess, otherwise the test fails.
+package routetest
@@ -0,0 +1,209 @@
+package routetest
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/backup"
+	"github.com/MeetPlan/MeetPlanBackend/httphandlers"
+	"github.com/MeetPlan/MeetPlanBackend/mailer"
+	"github.com/MeetPlan/MeetPlanBackend/proton"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/MeetPlan/MeetPlanBackend/sql/fixtures"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// anonymous is the caller without a token.
+const anonymous = "anonymous"
+
+type suite struct {
+	db     sql.SQL
+	school school
+	config sql.Config
+	logger *zap.SugaredLogger
+	// snapshot of the database every call starts from, written to snapshotDir
+	snapshot    sql.Snapshot
+	snapshotDir string
+}
+
+// TestRoutes builds the school and checks every route. Files the handlers write, such as the configuration, mail
+// and backups, end up in a temporary directory, while fonts and templates of certificates are read from the
+// repository through the asset directory of the configuration.
+func TestRoutes(t *testing.T) {
+	dir := t.TempDir()
+	configFile := sql.ConfigFile
+	sql.ConfigFile = filepath.Join(dir, "config.json")
+	t.Cleanup(func() {
+		sql.ConfigFile = configFile
+	})
+	assets, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &suite{logger: zap.NewNop().Sugar()}
+	s.config = sql.Config{
+		DatabaseName:       "sqlite3",
+		ParentViewGrades:   true,
+		ParentViewAbsences: true,
+		ParentViewHomework: true,
+		ParentViewGradings: true,
+		MailFile:           filepath.Join(dir, "mail.log"),
+		BackupDirectory:    filepath.Join(dir, "backups"),
+		AssetDirectory:     assets,
+		FinalClassGrade:    sql.DefaultFinalClassGrade,
+	}
+	s.db, err = fixtures.NewDatabase(s.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.school, err = newSchool(s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.snapshotDir = filepath.Join(dir, "snapshot")
+	err = os.Mkdir(s.snapshotDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.snapshot, err = s.db.WriteSnapshot(s.snapshotDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := s.routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range routes {
+		route := route
+		t.Run(route, func(t *testing.T) {
+			expected, ok := s.access(route)
+			if !ok {
+				t.Fatal("not in RoutePermissions nor handlerAccess")
+			}
+			s.check(t, route, expected)
+		})
+	}
+}
+
+// callers returns the roles every route is called as, starting with anonymous.
+func callers() []string {
+	return append([]string{anonymous}, fixtures.Roles()...)
+}
+
+// handler returns the whole API as the server serves it, with a configuration of its own, as some routes change it.
+func (s *suite) handler() (http.Handler, error) {
+	config := s.config
+	mail, err := mailer.NewMailer(config, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	backups := backup.NewManager(s.db, config, s.logger)
+	httphandler := httphandlers.NewHTTPInterface(s.logger, s.db, config, proton.NewProton(s.db), mail, nil, backups)
+	return httphandlers.NewRouter(httphandler)
+}
+
+// routes returns keys of all registered routes, such as "GET /timetable/get", sorted by path.
+func (s *suite) routes() ([]string, error) {
+	handler, err := s.handler()
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]string, 0)
+	err = handler.(*mux.Router).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for i := 0; i < len(methods); i++ {
+			routes = append(routes, methods[i]+" "+template)
+		}
+		return nil
+	})
+	sort.SliceStable(routes, func(i, j int) bool {
+		return strings.SplitN(routes[i], " ", 2)[1] < strings.SplitN(routes[j], " ", 2)[1]
+	})
+	return routes, err
+}
+
+// check calls the route as every caller and reports statuses that don't match the access. The statuses are
+// logged, so go test -v prints the whole matrix.
+func (s *suite) check(t *testing.T, route string, access access) {
+	statuses := make(map[string]int)
+	for _, caller := range callers() {
+		// Every call starts from the same rows and the signing keys stored with them
+		err := s.db.RestoreSnapshot(s.snapshotDir, s.snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.db.LoadSigningKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, err := s.call(route, caller)
+		if err != nil {
+			t.Errorf("%s: %s", caller, err.Error())
+			continue
+		}
+		statuses[caller] = status
+		t.Logf("%s: %d", caller, status)
+	}
+
+	for _, caller := range callers() {
+		status, ok := statuses[caller]
+		if !ok {
+			continue
+		}
+		if status >= 500 {
+			t.Errorf("%s: server error %d", caller, status)
+		}
+		if access.public {
+			if status != statuses[anonymous] {
+				t.Errorf("%s: got %d, but the route is public and a caller without a token got %d", caller, status, statuses[anonymous])
+			}
+			continue
+		}
+		allowed := caller != anonymous && caller != "unverified" && access.allowed(s, caller)
+		if allowed && status == http.StatusForbidden {
+			t.Errorf("%s: forbidden, but %s may use it", caller, access.who)
+		} else if !allowed && status != http.StatusForbidden {
+			t.Errorf("%s: got %d, but only %s may use it", caller, status, access.who)
+		}
+	}
+}
+
+// call sends a request to the route as the caller and returns the status of the response. Handlers that
+// panic are reported as errors.
+func (s *suite) call(route string, caller string) (status int, err error) {
+	handler, err := s.handler()
+	if err != nil {
+		return 0, err
+	}
+	request, err := s.school.request(route)
+	if err != nil {
+		return 0, err
+	}
+	if caller != anonymous {
+		request.Header.Set("Authorization", "Bearer "+s.school.tokens[caller])
+	}
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder.Code, nil
+}
@@ -0,0 +1,233 @@
+package routetest
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/MeetPlan/MeetPlanBackend/sql/fixtures"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// customRole is a role created by the school, the built-in ones can't be changed or deleted.
+const customRole = "librarian"
+
+// school is the fixtures.School together with a row of every other kind the routes need.
+type school struct {
+	fixtures.School
+	// tokens has an access token of every user, keyed by the role
+	tokens        map[string]string
+	meal          sql.Meal
+	grade         sql.Grade
+	absence       sql.Absence
+	homework      sql.Homework
+	testing       sql.Testing
+	communication sql.Communication
+	message       sql.Message
+	notification  sql.NotificationSQL
+	template      sql.TimetableTemplate
+	draft         sql.TimetableDraft
+}
+
+func newSchool(db sql.SQL) (s school, err error) {
+	s.School, err = fixtures.NewSchool(db)
+	if err != nil {
+		return s, err
+	}
+	teacher := s.Teacher()
+	student := s.Student()
+
+	s.meal = sql.Meal{Meals: "Testenine", Date: sql.Today().AddDays(7), MealTitle: "Kosilo", Price: 2.5}
+	s.meal.ID, err = db.InsertMeal(s.meal)
+	if err != nil {
+		return s, err
+	}
+	s.grade = sql.Grade{UserID: student.ID, TeacherID: teacher.ID, SubjectID: s.Subject.ID, Grade: 4, Date: time.Now().UTC(), Period: 1, CanPatch: true}
+	s.grade.ID, err = db.InsertGrade(s.grade)
+	if err != nil {
+		return s, err
+	}
+	s.absence = sql.Absence{UserID: student.ID, TeacherID: teacher.ID, MeetingID: s.Meeting.ID, AbsenceType: "ABSENT"}
+	s.absence.ID, err = db.InsertAbsence(s.absence)
+	if err != nil {
+		return s, err
+	}
+	s.homework = sql.Homework{TeacherID: teacher.ID, SubjectID: s.Subject.ID, Name: "Vaje", FromDate: sql.Today(), ToDate: sql.Today().AddDays(7)}
+	s.homework.ID, err = db.InsertHomework(s.homework)
+	if err != nil {
+		return s, err
+	}
+	s.testing = sql.Testing{UserID: student.ID, Date: sql.Today(), TeacherID: teacher.ID, ClassID: s.Class.ID, Result: "NEGATIVEN"}
+	s.testing.ID, err = db.InsertTestingResult(s.testing)
+	if err != nil {
+		return s, err
+	}
+
+	people := make([]int, 0)
+	for _, user := range s.Users {
+		people = append(people, user.ID)
+	}
+	s.communication = sql.Communication{DateCreated: time.Now().UTC(), Title: "Roditeljski sestanek"}
+	s.communication.ID, err = db.InsertCommunication(s.communication, people)
+	if err != nil {
+		return s, err
+	}
+	s.message = sql.Message{CommunicationID: s.communication.ID, UserID: teacher.ID, Body: "Vabljeni", DateCreated: time.Now().UTC()}
+	s.message.ID, err = db.InsertMessage(s.message)
+	if err != nil {
+		return s, err
+	}
+	s.notification = sql.NotificationSQL{Notification: "Jutri je pouk odpadel"}
+	s.notification.ID, err = db.InsertNotification(s.notification)
+	if err != nil {
+		return s, err
+	}
+	sync, err := db.ApplyTimetableTemplate(sql.TimetableTemplate{
+		SubjectID:     s.Subject.ID,
+		TeacherID:     teacher.ID,
+		MeetingName:   "Matematika",
+		Weekday:       2,
+		Hour:          3,
+		IntervalWeeks: 1,
+		FromDate:      sql.Today(),
+		ToDate:        sql.Today().AddDays(28),
+	}, sql.Today(), nil)
+	if err != nil {
+		return s, err
+	}
+	s.template = sync.Template
+	s.draft = sql.TimetableDraft{
+		Seed:           1,
+		FromDate:       sql.Today(),
+		ToDate:         sql.Today().AddDays(28),
+		FirstHour:      1,
+		LastHour:       7,
+		MaxHoursPerDay: 6,
+		CreatedBy:      teacher.ID,
+		CreatedAt:      time.Now().Unix(),
+	}
+	s.draft.ID, err = db.InsertTimetableDraft(s.draft, []sql.TimetableDraftLesson{
+		{SubjectID: s.Subject.ID, TeacherID: teacher.ID, MeetingName: "Matematika", Weekday: 4, Hour: 5},
+	})
+	if err != nil {
+		return s, err
+	}
+	err = db.InsertRole(sql.Role{Name: customRole, Description: "Knjižničar"})
+	if err != nil {
+		return s, err
+	}
+
+	s.tokens = make(map[string]string)
+	for role, user := range s.Users {
+		s.tokens[role], err = fixtures.Login(db, user)
+		if err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+var pathVariable = regexp.MustCompile(`{([a-z_]+)}`)
+
+// pathValue returns the row a variable of the route's path refers to. Users are always the student, except
+// for teachers.
+func (s school) pathValue(template string, name string) string {
+	var id int
+	switch name {
+	case "user_id", "student_id", "student":
+		id = s.Student().ID
+	case "parent":
+		id = s.Parent().ID
+	case "class_id":
+		id = s.Class.ID
+	case "subject_id":
+		id = s.Subject.ID
+	case "meeting_id":
+		id = s.Meeting.ID
+	case "meal_id":
+		id = s.meal.ID
+	case "grade_id":
+		id = s.grade.ID
+	case "absence_id":
+		id = s.absence.ID
+	case "homework_id":
+		id = s.homework.ID
+	case "test_id":
+		id = s.testing.ID
+	case "message_id":
+		id = s.message.ID
+	case "notification_id":
+		id = s.notification.ID
+	case "template_id":
+		id = s.template.ID
+	case "draft_id":
+		id = s.draft.ID
+	case "teacher_id":
+		id = s.Teacher().ID
+	case "name":
+		if strings.HasPrefix(template, "/admin/backups/") {
+			return "meetplan-missing.tar.gz"
+		}
+		return customRole
+	case "id":
+		switch {
+		case strings.HasPrefix(template, "/class/"):
+			id = s.Class.ID
+		case strings.HasPrefix(template, "/meetings/"):
+			id = s.Meeting.ID
+		case strings.HasPrefix(template, "/communication/"):
+			id = s.communication.ID
+		case strings.HasPrefix(template, "/admin/school_years/"):
+			// No school year is archived yet
+			id = 1
+		default:
+			id = s.Student().ID
+		}
+	}
+	return strconv.Itoa(id)
+}
+
+// form has form values routes need to get past validation, so handlers get to check who is calling.
+func (s school) form(route string) url.Values {
+	switch route {
+	case "PATCH /user/password":
+		return url.Values{"old_pass": {fixtures.Password}, "new_pass": {"meetplan-changed"}}
+	case "POST /class/new":
+		return url.Values{"name": {"1.a"}, "teacher_id": {strconv.Itoa(s.Teacher().ID)}, "class_year": {s.Class.ClassYear}}
+	case "POST /grades/new/{meeting_id}":
+		return url.Values{"user_id": {strconv.Itoa(s.Student().ID)}, "grade": {"5"}, "period": {"1"}, "can_patch": {"true"}}
+	case "PATCH /grade/get/{grade_id}":
+		return url.Values{"grade": {"3"}, "period": {"1"}}
+	case "POST /timetable/templates", "PATCH /timetable/templates/{template_id}":
+		return url.Values{"subjectId": {strconv.Itoa(s.Subject.ID)}, "name": {"Matematika"}, "weekday": {"4"}, "hour": {"2"},
+			"from": {sql.Today().String()}, "to": {sql.Today().AddDays(28).String()}}
+	case "POST /timetable/drafts":
+		return url.Values{"from": {sql.Today().String()}, "to": {sql.Today().AddDays(28).String()}, "seed": {"1"}, "iterations": {"100"}}
+	case "PATCH /timetable/availability/{teacher_id}":
+		return url.Values{"hours": {`[{"weekday": 1, "hour": 0}]`}}
+	case "POST /communication/new":
+		return url.Values{"title": {"Izlet"}, "users": {fmt.Sprintf("[%d]", s.Student().ID)}}
+	case "POST /communication/get/{id}/message/new", "PATCH /message/get/{message_id}":
+		return url.Values{"body": {"Hvala"}}
+	}
+	return url.Values{}
+}
+
+// request builds a request to the route. Form values are sent in the query, as handlers read them with FormValue.
+func (s school) request(route string) (*http.Request, error) {
+	parts := strings.SplitN(route, " ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid route %s", route)
+	}
+	template := parts[1]
+	path := pathVariable.ReplaceAllStringFunc(template, func(variable string) string {
+		return s.pathValue(template, pathVariable.FindStringSubmatch(variable)[1])
+	})
+	request := httptest.NewRequest(parts[0], path, nil)
+	request.URL.RawQuery = s.form(route).Encode()
+	return request, nil
+}
@@ -0,0 +1,234 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// ArchivedClassJSON is a class of an archived school year together with the outcomes of its students.
+type ArchivedClassJSON struct {
+	sql.ArchivedClass
+	Students []sql.ArchivedClassStudent `json:"students"`
+}
+
+// ArchivedStudentJSON is everything archived about a single student, over all archived school years.
+type ArchivedStudentJSON struct {
+	SchoolYears []sql.SchoolYear              `json:"school_years"`
+	Classes     []sql.ArchivedClassStudent    `json:"classes"`
+	Subjects    []sql.ArchivedSubject         `json:"subjects"`
+	Grades      []sql.ArchivedGrade           `json:"grades"`
+	Absences    []sql.ArchivedAbsence         `json:"absences"`
+	Homework    []sql.ArchivedStudentHomework `json:"homework"`
+}
+
+func (server *httpImpl) rolloverOptions(r *http.Request, userId int) sql.RolloverOptions {
+	return sql.RolloverOptions{
+		Year:       r.FormValue("year"),
+		NextYear:   r.FormValue("next_year"),
+		FinalGrade: server.config.FinalClassGrade,
+		ArchivedBy: userId,
+	}
+}
+
+func (server *httpImpl) GetSchoolYears(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionSchoolYears) {
+		years, err := server.db.GetSchoolYears()
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: years, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+// PreviewRollover shows what rolling over into the next school year would change, without changing anything.
+// The school year is taken from the classes unless year is set, and the next one follows it unless next_year is set.
+func (server *httpImpl) PreviewRollover(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionSchoolYears) {
+		plan, err := server.db.PreviewRollover(server.rolloverOptions(r, 0))
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: plan, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+// RollOver archives the finished school year and moves classes into the next one. It accepts the same
+// parameters as PreviewRollover.
+func (server *httpImpl) RollOver(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionSchoolYears) {
+		userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		plan, err := server.audited(r, jwt).RollOver(server.rolloverOptions(r, userId))
+		if err != nil {
+			if len(plan.Blockers) != 0 {
+				WriteJSON(w, Response{Error: err.Error(), Data: plan, Success: false}, http.StatusConflict)
+				return
+			}
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		server.logger.Infow("rolled over into the next school year", "year", plan.Year, "next_year", plan.NextYear, "user_id", userId)
+		WriteJSON(w, Response{Data: plan, Success: true}, http.StatusCreated)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+func (server *httpImpl) GetArchivedClasses(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionSchoolYears) {
+		yearId, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		_, err = server.db.GetSchoolYear(yearId)
+		if err != nil {
+			WriteJSON(w, Response{Data: "School year doesn't exist", Success: false}, http.StatusNotFound)
+			return
+		}
+		classes, err := server.db.GetArchivedClasses(yearId)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		classesJson := make([]ArchivedClassJSON, 0)
+		for i := 0; i < len(classes); i++ {
+			students, err := server.db.GetArchivedClassStudents(yearId, classes[i].ID)
+			if err != nil {
+				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+				return
+			}
+			classesJson = append(classesJson, ArchivedClassJSON{ArchivedClass: classes[i], Students: students})
+		}
+		WriteJSON(w, Response{Data: classesJson, Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
+
+// GetArchivedStudent returns the student's classes, grades, absences and homework of archived school years.
+// Students can read their own archive, parents the archive of their children if they can see grades, and the
+// school needs the school_years.manage or classes.read_all permission.
+func (server *httpImpl) GetArchivedStudent(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	currentUserId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	studentId, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	if studentId != currentUserId && !server.can(jwt, sql.PermissionSchoolYears) && !server.can(jwt, sql.PermissionClassesReadAll) {
+		if !server.config.ParentViewGrades {
+			WriteForbiddenJWT(w)
+			return
+		}
+		isParent, err := server.db.IsParentOf(currentUserId, studentId)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		if !isParent {
+			WriteForbiddenJWT(w)
+			return
+		}
+	}
+
+	archive := ArchivedStudentJSON{
+		SchoolYears: make([]sql.SchoolYear, 0),
+		Subjects:    make([]sql.ArchivedSubject, 0),
+	}
+	archive.Classes, err = server.db.GetArchivedClassesForStudent(studentId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	archive.Grades, err = server.db.GetArchivedGradesForUser(studentId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	archive.Absences, err = server.db.GetArchivedAbsencesForUser(studentId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	archive.Homework, err = server.db.GetArchivedStudentHomeworkForUser(studentId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+
+	// Only school years and subjects the student has archived rows in are returned
+	years := make(map[int]bool)
+	for i := 0; i < len(archive.Classes); i++ {
+		years[archive.Classes[i].SchoolYearID] = true
+	}
+	// IDs of archived rows are only unique within their school year
+	subjects := make(map[string]bool)
+	for i := 0; i < len(archive.Grades); i++ {
+		years[archive.Grades[i].SchoolYearID] = true
+		subjects[fmt.Sprintf("%d:%d", archive.Grades[i].SchoolYearID, archive.Grades[i].SubjectID)] = true
+	}
+	allYears, err := server.db.GetSchoolYears()
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	for i := 0; i < len(allYears); i++ {
+		if !years[allYears[i].ID] {
+			continue
+		}
+		archive.SchoolYears = append(archive.SchoolYears, allYears[i])
+		yearSubjects, err := server.db.GetArchivedSubjects(allYears[i].ID)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		for n := 0; n < len(yearSubjects); n++ {
+			if subjects[fmt.Sprintf("%d:%d", allYears[i].ID, yearSubjects[n].ID)] {
+				archive.Subjects = append(archive.Subjects, yearSubjects[n])
+			}
+		}
+	}
+	WriteJSON(w, Response{Data: archive, Success: true}, http.StatusOK)
+}
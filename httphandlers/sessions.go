@@ -0,0 +1,92 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// Set when user's role requires two-factor authentication, but the user hasn't enrolled yet.
+	// Such tokens can only be used to set up two-factor authentication.
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required"`
+}
+
+func (server *httpImpl) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	refreshToken := r.FormValue("refresh_token")
+	if refreshToken == "" {
+		WriteBadRequest(w)
+		return
+	}
+	accessToken, newRefreshToken, err := server.db.RefreshSession(refreshToken)
+	if err != nil {
+		WriteJSON(w, Response{Data: "Could not refresh session", Error: err.Error(), Success: false}, http.StatusForbidden)
+		return
+	}
+	WriteJSON(w, Response{Data: TokenPair{AccessToken: accessToken, RefreshToken: newRefreshToken}, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) Logout(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	sessionId, err := strconv.Atoi(fmt.Sprint(jwt["sid"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	err = server.db.RevokeSession(sessionId)
+	if err != nil {
+		WriteJSON(w, Response{Data: "Could not revoke session", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	err = server.db.RevokeAllUserSessions(userId)
+	if err != nil {
+		WriteJSON(w, Response{Data: "Could not revoke sessions", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if server.can(jwt, sql.PermissionUsersManage) {
+		userId, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			WriteBadRequest(w)
+			return
+		}
+		err = server.db.RevokeAllUserSessions(userId)
+		if err != nil {
+			WriteJSON(w, Response{Data: "Could not revoke sessions", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+	} else {
+		WriteForbiddenJWT(w)
+	}
+}
@@ -1,7 +1,6 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
 	"net/http"
@@ -16,7 +15,7 @@ type Subject struct {
 }
 
 func (server *httpImpl) GetSubjects(w http.ResponseWriter, r *http.Request) {
-	_, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	_, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -33,12 +32,12 @@ func (server *httpImpl) GetSubjects(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) NewSubject(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionSubjectsManage) {
 		teacherId, err := strconv.Atoi(r.FormValue("teacher_id"))
 		if err != nil {
 			WriteBadRequest(w)
@@ -60,19 +59,15 @@ func (server *httpImpl) NewSubject(w http.ResponseWriter, r *http.Request) {
 			WriteBadRequest(w)
 			return
 		}
-		var students = make([]int, 0)
-		studentsJson, err := json.Marshal(students)
 		nSubject := sql.Subject{
-			ID:            server.db.GetLastSubjectID(),
 			TeacherID:     teacherId,
 			Name:          r.FormValue("name"),
 			LongName:      r.FormValue("long_name"),
 			InheritsClass: inheritsClass,
 			ClassID:       classIdInt,
-			Students:      string(studentsJson),
 			Realization:   float32(realization),
 		}
-		err = server.db.InsertSubject(nSubject)
+		nSubject.ID, err = server.audited(r, jwt).InsertSubject(nSubject)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -85,12 +80,12 @@ func (server *httpImpl) NewSubject(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetSubject(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionSubjectsManage) {
 		subjectId, err := strconv.Atoi(mux.Vars(r)["subject_id"])
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
@@ -102,27 +97,11 @@ func (server *httpImpl) GetSubject(w http.ResponseWriter, r *http.Request) {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		var students []int
-		if subject.InheritsClass {
-			class, err := server.db.GetClass(subject.ClassID)
-			if err != nil {
-				server.logger.Debug(err, subject)
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-			err = json.Unmarshal([]byte(class.Students), &students)
-			if err != nil {
-				server.logger.Debug(err, subject)
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err = json.Unmarshal([]byte(subject.Students), &students)
-			if err != nil {
-				server.logger.Debug(err, subject)
-				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
+		students, err := server.db.GetSubjectStudents(subject)
+		if err != nil {
+			server.logger.Debug(err, subject)
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
 		}
 
 		var studentsJson = make([]UserJSON, 0)
@@ -164,12 +143,12 @@ func (server *httpImpl) GetSubject(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) AssignUserToSubject(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionSubjectsManage) {
 		subjectId, err := strconv.Atoi(mux.Vars(r)["subject_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -185,28 +164,19 @@ func (server *httpImpl) AssignUserToSubject(w http.ResponseWriter, r *http.Reque
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		var m []int
-		err = json.Unmarshal([]byte(subject.Students), &m)
+		// Students of subjects that inherit the class aren't used, but they can still be assigned
+		subject.InheritsClass = false
+		students, err := server.db.GetSubjectStudents(subject)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		for i := 0; i < len(m); i++ {
-			if m[i] == userId {
-				WriteJSON(w, Response{Data: "User is already in this class", Success: false}, http.StatusConflict)
-				return
-			}
-		}
-		m = append(m, userId)
-
-		s, err := json.Marshal(m)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		if contains(students, userId) {
+			WriteJSON(w, Response{Data: "User is already in this class", Success: false}, http.StatusConflict)
 			return
 		}
-		subject.Students = string(s)
 
-		err = server.db.UpdateSubject(subject)
+		err = server.audited(r, jwt).AddStudentToSubject(subjectId, userId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -219,12 +189,12 @@ func (server *httpImpl) AssignUserToSubject(w http.ResponseWriter, r *http.Reque
 }
 
 func (server *httpImpl) RemoveUserFromSubject(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionSubjectsManage) {
 		subjectId, err := strconv.Atoi(mux.Vars(r)["subject_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -235,32 +205,13 @@ func (server *httpImpl) RemoveUserFromSubject(w http.ResponseWriter, r *http.Req
 			WriteBadRequest(w)
 			return
 		}
-		subject, err := server.db.GetSubject(subjectId)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-			return
-		}
-		var m []int
-		err = json.Unmarshal([]byte(subject.Students), &m)
-		if err != nil {
-			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-			return
-		}
-		for i := 0; i < len(m); i++ {
-			if m[i] == userId {
-				m = remove(m, i)
-				break
-			}
-		}
-
-		s, err := json.Marshal(m)
+		_, err = server.db.GetSubject(subjectId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		subject.Students = string(s)
 
-		err = server.db.UpdateSubject(subject)
+		err = server.audited(r, jwt).RemoveStudentFromSubject(subjectId, userId)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -273,12 +224,12 @@ func (server *httpImpl) RemoveUserFromSubject(w http.ResponseWriter, r *http.Req
 }
 
 func (server *httpImpl) DeleteSubject(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionSubjectsManage) {
 		subjectId, err := strconv.Atoi(mux.Vars(r)["subject_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -289,7 +240,7 @@ func (server *httpImpl) DeleteSubject(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return
 		}
-		err = server.db.DeleteSubject(subject)
+		err = server.audited(r, jwt).DeleteSubject(subject)
 		if err != nil {
 			return
 		}
@@ -301,12 +252,12 @@ func (server *httpImpl) DeleteSubject(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) PatchSubjectName(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionSubjectsManage) {
 		subjectId, err := strconv.Atoi(mux.Vars(r)["subject_id"])
 		if err != nil {
 			WriteJSON(w, Response{Data: "Failed to parse subjectId", Error: err.Error(), Success: false}, http.StatusBadRequest)
@@ -324,7 +275,7 @@ func (server *httpImpl) PatchSubjectName(w http.ResponseWriter, r *http.Request)
 		}
 		subject.LongName = r.FormValue("long_name")
 		subject.Realization = float32(realization)
-		err = server.db.UpdateSubject(subject)
+		err = server.audited(r, jwt).UpdateSubject(subject)
 		if err != nil {
 			WriteJSON(w, Response{Data: "Failed to update subject", Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
@@ -10,7 +10,7 @@ import (
 )
 
 func (server *httpImpl) GetSystemNotifications(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -34,16 +34,21 @@ func (server *httpImpl) GetSystemNotifications(w http.ResponseWriter, r *http.Re
 		notifications = make([]sql.NotificationSQL, 0)
 	}
 	currentTime := time.Now()
-	birthday, err := time.Parse("2006-01-02", user.Birthday)
-	if err == nil {
-		if currentTime.Before(birthday) {
+	birthday := user.Birthday
+	if !birthday.IsZero() {
+		if sql.Today().Before(birthday) {
 			WriteJSON(w, Response{Data: "Invalid birthday", Success: false}, http.StatusConflict)
 			return
 		}
 		_, tm, td := currentTime.Date()
 		_, bm, bd := birthday.Date()
 		if tm-bm == 0 && td-bd == 0 {
-			if jwt["role"] == "student" {
+			classes, err := server.db.GetClassesForStudent(user.ID)
+			if err != nil {
+				WriteJSON(w, Response{Data: "Could not fetch classes", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+				return
+			}
+			if len(classes) != 0 {
 				notifications = append(notifications, sql.NotificationSQL{Notification: "\U0001F973 Kdo pa ima danes rojstni dan? Odgovor: Ti. Čeprav ne moremo urediti, da danes nimaš šole, ti ekipa MeetPlan sistema želi vse najboljše in čim boljše ocene v tem šolskem letu."})
 			} else {
 				notifications = append(notifications, sql.NotificationSQL{Notification: "\U0001F973 Kdo pa ima danes rojstni dan? Odgovor: Vi. Čeprav ne moremo urediti, da danes nimate službe, vam ekipa MeetPlan sistema želi vse najboljše. Biti učitelj je zelo plemenito delo in zato se vam zahvaljujemo. Še naprej širite svoje znanje na nove generacije."})
@@ -54,18 +59,17 @@ func (server *httpImpl) GetSystemNotifications(w http.ResponseWriter, r *http.Re
 }
 
 func (server *httpImpl) NewNotification(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionNotifications) {
 
 		notification := sql.NotificationSQL{
-			ID:           server.db.GetLastNotificationID(),
 			Notification: r.FormValue("body"),
 		}
-		err = server.db.InsertNotification(notification)
+		notification.ID, err = server.audited(r, jwt).InsertNotification(notification)
 		if err != nil {
 			return
 		}
@@ -77,17 +81,17 @@ func (server *httpImpl) NewNotification(w http.ResponseWriter, r *http.Request)
 }
 
 func (server *httpImpl) DeleteNotification(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionNotifications) {
 		atoi, err := strconv.Atoi(mux.Vars(r)["notification_id"])
 		if err != nil {
 			return
 		}
-		err = server.db.DeleteNotification(atoi)
+		err = server.audited(r, jwt).DeleteNotification(atoi)
 		if err != nil {
 			return
 		}
@@ -0,0 +1,231 @@
+package httphandlers
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type TimetableTemplateJSON struct {
+	sql.TimetableTemplate
+	Meetings []sql.Meeting `json:"meetings"`
+}
+
+// templateFromForm fills the template with form values. Teachers can only create templates of their own
+// lessons, while the meetings.write_all permission allows picking the teacher with teacherId.
+func (server *httpImpl) templateFromForm(r *http.Request, claims jwt.MapClaims, template sql.TimetableTemplate) (sql.TimetableTemplate, error) {
+	var err error
+	template.SubjectID, err = strconv.Atoi(r.FormValue("subjectId"))
+	if err != nil {
+		return template, err
+	}
+	_, err = server.db.GetSubject(template.SubjectID)
+	if err != nil {
+		return template, fmt.Errorf("subject doesn't exist")
+	}
+	template.Weekday, err = strconv.Atoi(r.FormValue("weekday"))
+	if err != nil {
+		return template, err
+	}
+	template.Hour, err = strconv.Atoi(r.FormValue("hour"))
+	if err != nil {
+		return template, err
+	}
+	template.IntervalWeeks = 1
+	if r.FormValue("interval_weeks") != "" {
+		template.IntervalWeeks, err = strconv.Atoi(r.FormValue("interval_weeks"))
+		if err != nil {
+			return template, err
+		}
+	}
+	template.FromDate, err = sql.ParseDate(r.FormValue("from"))
+	if err != nil {
+		return template, err
+	}
+	template.ToDate, err = sql.ParseDate(r.FormValue("to"))
+	if err != nil {
+		return template, err
+	}
+	template.MeetingName = r.FormValue("name")
+	template.URL = r.FormValue("url")
+	template.Details = r.FormValue("details")
+	template.IsMandatory = r.FormValue("is_mandatory") != "false"
+
+	if server.can(claims, sql.PermissionMeetingsWriteAll) && r.FormValue("teacherId") != "" {
+		template.TeacherID, err = strconv.Atoi(r.FormValue("teacherId"))
+		if err != nil {
+			return template, err
+		}
+	} else if template.TeacherID == 0 || !server.can(claims, sql.PermissionMeetingsWriteAll) {
+		template.TeacherID, err = strconv.Atoi(fmt.Sprint(claims["user_id"]))
+		if err != nil {
+			return template, err
+		}
+	}
+	return template, template.Validate()
+}
+
+// timetableTemplate returns the template of the route, when the user may change it.
+func (server *httpImpl) timetableTemplate(w http.ResponseWriter, r *http.Request, claims jwt.MapClaims) (template sql.TimetableTemplate, ok bool) {
+	templateId, err := strconv.Atoi(mux.Vars(r)["template_id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return template, false
+	}
+	template, err = server.db.GetTimetableTemplate(templateId)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			WriteJSON(w, Response{Data: "Template doesn't exist", Success: false}, http.StatusNotFound)
+			return template, false
+		}
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return template, false
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(claims["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return template, false
+	}
+	if template.TeacherID != userId && !server.can(claims, sql.PermissionMeetingsWriteAll) {
+		WriteForbiddenJWT(w)
+		return template, false
+	}
+	return template, true
+}
+
+func (server *httpImpl) GetTimetableTemplates(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionMeetingsWrite) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	var templates []sql.TimetableTemplate
+	if server.can(jwt, sql.PermissionMeetingsWriteAll) {
+		templates, err = server.db.GetTimetableTemplates()
+	} else {
+		templates, err = server.db.GetTimetableTemplatesForTeacher(userId)
+	}
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: templates, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) GetTimetableTemplate(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionMeetingsWrite) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	template, ok := server.timetableTemplate(w, r, jwt)
+	if !ok {
+		return
+	}
+	meetings, err := server.db.GetMeetingsForTemplate(template.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: TimetableTemplateJSON{TimetableTemplate: template, Meetings: meetings}, Success: true}, http.StatusOK)
+}
+
+// NewTimetableTemplate creates the template together with all of its meetings, except on school free days.
+func (server *httpImpl) NewTimetableTemplate(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionMeetingsWrite) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	template, err := server.templateFromForm(r, jwt, sql.TimetableTemplate{})
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+		return
+	}
+	conflicts, err := server.proton.CheckTemplateConflicts(template, template.FromDate, server.config.FreeDays())
+	if !server.checkedConflicts(w, r, jwt, conflicts, err) {
+		return
+	}
+	sync, err := server.audited(r, jwt).ApplyTimetableTemplate(template, template.FromDate, server.config.FreeDays())
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to create template", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: sync, Success: true}, http.StatusCreated)
+}
+
+// PatchTimetableTemplate changes the template and its meetings from tomorrow on. Earlier meetings stay as they
+// are, as they already have absences and grades.
+func (server *httpImpl) PatchTimetableTemplate(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionMeetingsWrite) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	template, ok := server.timetableTemplate(w, r, jwt)
+	if !ok {
+		return
+	}
+	template, err = server.templateFromForm(r, jwt, template)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusBadRequest)
+		return
+	}
+	conflicts, err := server.proton.CheckTemplateConflicts(template, sql.Today().AddDays(1), server.config.FreeDays())
+	if !server.checkedConflicts(w, r, jwt, conflicts, err) {
+		return
+	}
+	sync, err := server.audited(r, jwt).ApplyTimetableTemplate(template, sql.Today().AddDays(1), server.config.FreeDays())
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to update template", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: sync, Success: true}, http.StatusOK)
+}
+
+// DeleteTimetableTemplate deletes the template and its meetings from tomorrow on, earlier meetings are kept.
+func (server *httpImpl) DeleteTimetableTemplate(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionMeetingsWrite) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	template, ok := server.timetableTemplate(w, r, jwt)
+	if !ok {
+		return
+	}
+	sync, err := server.audited(r, jwt).DeleteTimetableTemplate(template.ID, sql.Today().AddDays(1))
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to delete template", Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: sync, Success: true}, http.StatusOK)
+}
@@ -1,7 +1,6 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
@@ -10,8 +9,6 @@ import (
 	"github.com/johnfercher/maroto/pkg/props"
 	"net/http"
 	"strconv"
-	"strings"
-	"time"
 )
 
 type Response struct {
@@ -21,20 +18,18 @@ type Response struct {
 }
 
 func (server *httpImpl) GetSelfTestingTeacher(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "teacher" || jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionTestingManage) {
 		classId, err := strconv.Atoi(mux.Vars(r)["class_id"])
 		if err != nil {
 			WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
 			return
 		}
-		dt := time.Now()
-		date := dt.Format("02-01-2006")
-		results, err := server.db.GetTestingResults(date, classId)
+		results, err := server.db.GetTestingResults(sql.Today(), classId)
 		if err != nil {
 			WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
 			return
@@ -47,12 +42,12 @@ func (server *httpImpl) GetSelfTestingTeacher(w http.ResponseWriter, r *http.Req
 }
 
 func (server *httpImpl) PatchSelfTesting(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionTestingManage) {
 		studentId, err := strconv.Atoi(mux.Vars(r)["student_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -71,8 +66,7 @@ func (server *httpImpl) PatchSelfTesting(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		dt := time.Now()
-		date := dt.Format("02-01-2006")
+		date := sql.Today()
 
 		results, err := server.db.GetTestingResult(date, studentId)
 		if err != nil {
@@ -80,13 +74,12 @@ func (server *httpImpl) PatchSelfTesting(w http.ResponseWriter, r *http.Request)
 			if err.Error() == "sql: no rows in result set" {
 				results = sql.Testing{
 					Date:      date,
-					ID:        server.db.GetLastTestingID(),
 					UserID:    studentId,
 					TeacherID: teacherId,
 					ClassID:   classId,
 					Result:    r.FormValue("result"),
 				}
-				err := server.db.InsertTestingResult(results)
+				results.ID, err = server.audited(r, jwt).InsertTestingResult(results)
 				if err != nil {
 					WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
 					return
@@ -111,7 +104,7 @@ func (server *httpImpl) PatchSelfTesting(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		results.TeacherID = ntid
-		err = server.db.UpdateTestingResult(results)
+		err = server.audited(r, jwt).UpdateTestingResult(results)
 		if err != nil {
 			WriteJSON(w, Response{Success: false, Error: err.Error()}, http.StatusInternalServerError)
 			return
@@ -124,7 +117,7 @@ func (server *httpImpl) PatchSelfTesting(w http.ResponseWriter, r *http.Request)
 }
 
 func (server *httpImpl) GetPDFSelfTestingReportStudent(w http.ResponseWriter, r *http.Request) {
-	jwtData, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwtData, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -136,7 +129,7 @@ func (server *httpImpl) GetPDFSelfTestingReportStudent(w http.ResponseWriter, r
 		return
 	}
 
-	user, err := server.db.GetUser(userId)
+	_, err = server.db.GetUser(userId)
 	if err != nil {
 		return
 	}
@@ -152,15 +145,9 @@ func (server *httpImpl) GetPDFSelfTestingReportStudent(w http.ResponseWriter, r
 		return
 	}
 
-	if jwtData["role"] == "student" {
-		if test.UserID != userId {
-			WriteForbiddenJWT(w)
-			return
-		}
-	} else if jwtData["role"] == "parent" {
-		var users []int
-		json.Unmarshal([]byte(user.Users), &users)
-		if !contains(users, test.UserID) {
+	if test.UserID != userId && !server.can(jwtData, sql.PermissionTestingManage) {
+		isParent, err := server.db.IsParentOf(userId, test.UserID)
+		if err != nil || !isParent {
 			WriteForbiddenJWT(w)
 			return
 		}
@@ -180,14 +167,15 @@ func (server *httpImpl) GetPDFSelfTestingReportStudent(w http.ResponseWriter, r
 		return
 	}
 
-	jwt, err, expiration := sql.GetJWTForTestingResult(test.UserID, test.Result, test.ID, test.Date)
+	jwt, err, expiration := server.db.GetJWTForTestingResult(test.UserID, test.Result, test.ID, test.Date)
 	if err != nil {
 		return
 	}
 
 	m := pdf.NewMaroto(consts.Portrait, consts.A4)
 
-	m.AddUTF8Font("OpenSans", consts.Normal, "fonts/opensans.ttf")
+	m.SetFontLocation(server.config.AssetPath("fonts"))
+	m.AddUTF8Font("OpenSans", consts.Normal, "opensans.ttf")
 	m.SetDefaultFontFamily("OpenSans")
 
 	m.Row(40, func() {
@@ -324,7 +312,7 @@ func (server *httpImpl) GetPDFSelfTestingReportStudent(w http.ResponseWriter, r
 }
 
 func (server *httpImpl) GetTestingResults(w http.ResponseWriter, r *http.Request) {
-	jwtData, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwtData, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -347,13 +335,8 @@ func (server *httpImpl) GetTestingResults(w http.ResponseWriter, r *http.Request
 		if err != nil {
 			return
 		}
-		expirationTime, err := time.Parse("02-01-2006", r.Date)
-		if err != nil {
-			return
-		}
-		expirationTime = expirationTime.Add(48 * time.Hour)
-		etime := strings.Split(expirationTime.Format("02-01-2006"), " ")[0]
-		j := sql.TestingJSON{IsDone: true, ID: r.ID, ClassID: r.ClassID, TeacherID: r.TeacherID, TeacherName: teacher.Name, UserID: r.UserID, Date: r.Date, Result: r.Result, ValidUntil: etime}
+		validUntil := r.Date.AddDays(sql.TestingResultValidity)
+		j := sql.TestingJSON{IsDone: true, ID: r.ID, ClassID: r.ClassID, TeacherID: r.TeacherID, TeacherName: teacher.Name, UserID: r.UserID, Date: r.Date, Result: r.Result, ValidUntil: validUntil}
 		res = append(res, j)
 	}
 	// Magic to reverse slice
@@ -0,0 +1,355 @@
+package httphandlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/gorilla/mux"
+	"image/png"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	TwoFactorToken    string `json:"two_factor_token"`
+}
+
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	// Base64 encoded PNG image
+	QRCode string `json:"qr_code"`
+}
+
+type TwoFactorConfirmation struct {
+	TokenPair
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func GetQRCodePNG(content string) (string, error) {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return "", err
+	}
+	code, err = barcode.Scale(code, 256, 256)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, code)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func (server *httpImpl) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, err := server.db.CheckTwoFactorJWT(r.FormValue("two_factor_token"))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	user, err := server.db.GetUser(userId)
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if user.Role == "unverified" || !user.TOTPEnabled {
+		WriteForbiddenJWT(w)
+		return
+	}
+	ip := GetClientIP(r, server.config.BehindProxy)
+	wait := server.reserveLoginAttempt(user.Email, ip)
+	if wait > 0 {
+		server.db.RecordLoginAttempt(user.ID, user.Email, ip, false, "throttled")
+		WriteTooManyRequests(w, wait)
+		return
+	}
+	valid, err := server.db.CheckTwoFactorCode(user, r.FormValue("code"))
+	if err != nil {
+		server.releaseLoginAttempt(user.Email, ip)
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		server.registerLoginFailure(user.ID, user.Email, ip, "invalid two-factor code")
+		WriteJSON(w, Response{Data: "Invalid two-factor code", Success: false}, http.StatusForbidden)
+		return
+	}
+	server.registerLoginSuccess(user.ID, user.Email, ip)
+	accessToken, refreshToken, err := server.db.NewSession(user, true)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWTWithoutTwoFactor(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	user, err := server.db.GetUser(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if user.TOTPEnabled {
+		WriteJSON(w, Response{Data: "Two-factor authentication is already enabled", Success: false}, http.StatusConflict)
+		return
+	}
+	secret, err := sql.GenerateTOTPSecret()
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	err = server.audited(r, jwt).UpdateUser(user)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	uri := sql.GetTOTPProvisioningURI(secret, user.Email)
+	qrCode, err := GetQRCodePNG(uri)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: TwoFactorSetup{Secret: secret, URI: uri, QRCode: qrCode}, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWTWithoutTwoFactor(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	user, err := server.db.GetUser(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		WriteJSON(w, Response{Data: "Two-factor authentication setup wasn't started", Success: false}, http.StatusConflict)
+		return
+	}
+	// Only TOTP codes are accepted here, as recovery codes don't exist yet
+	valid, step := sql.ValidateTOTP(user.TOTPSecret, r.FormValue("code"), time.Now())
+	if !valid {
+		WriteJSON(w, Response{Data: "Invalid two-factor code", Success: false}, http.StatusForbidden)
+		return
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	err = server.audited(r, jwt).UpdateUser(user)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	codes, err := server.db.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	// Sessions without two-factor authentication aren't valid anymore, so we issue a new one.
+	err = server.db.RevokeAllUserSessions(user.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	accessToken, refreshToken, err := server.db.NewSession(user, true)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: TwoFactorConfirmation{
+		TokenPair:     TokenPair{AccessToken: accessToken, RefreshToken: refreshToken},
+		RecoveryCodes: codes,
+	}, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	user, err := server.db.GetUser(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if !user.TOTPEnabled {
+		WriteJSON(w, Response{Data: "Two-factor authentication isn't enabled", Success: false}, http.StatusConflict)
+		return
+	}
+	if server.db.IsTwoFactorRequired(user.Role) {
+		WriteJSON(w, Response{Data: "Two-factor authentication is required for your role", Success: false}, http.StatusConflict)
+		return
+	}
+	valid, err := server.db.CheckTwoFactorCode(user, r.FormValue("code"))
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		WriteJSON(w, Response{Data: "Invalid two-factor code", Success: false}, http.StatusForbidden)
+		return
+	}
+	// CheckTwoFactorCode might have updated the user
+	user, err = server.db.GetUser(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	err = server.audited(r, jwt).UpdateUser(user)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	server.db.DeleteRecoveryCodes(user.ID)
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	user, err := server.db.GetUser(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if !user.TOTPEnabled {
+		WriteJSON(w, Response{Data: "Two-factor authentication isn't enabled", Success: false}, http.StatusConflict)
+		return
+	}
+	valid, err := server.db.CheckTwoFactorCode(user, r.FormValue("code"))
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		WriteJSON(w, Response{Data: "Invalid two-factor code", Success: false}, http.StatusForbidden)
+		return
+	}
+	codes, err := server.db.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: codes, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionSecurityManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	userId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	user, err := server.db.GetUser(userId)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	err = server.audited(r, jwt).UpdateUser(user)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	server.db.DeleteRecoveryCodes(user.ID)
+	err = server.db.RevokeAllUserSessions(user.ID)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) GetTwoFactorRoles(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionSecurityManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	roles, err := server.db.GetTwoFactorRoles()
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: roles, Success: true}, http.StatusOK)
+}
+
+func (server *httpImpl) UpdateTwoFactorRoles(w http.ResponseWriter, r *http.Request) {
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	if !server.can(jwt, sql.PermissionSecurityManage) {
+		WriteForbiddenJWT(w)
+		return
+	}
+	var roles []string
+	err = json.Unmarshal([]byte(r.FormValue("roles")), &roles)
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	err = server.audited(r, jwt).SetTwoFactorRoles(roles)
+	if err != nil {
+		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, Response{Data: "OK", Success: true}, http.StatusOK)
+}
@@ -1,7 +1,6 @@
 package httphandlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
 	"github.com/gorilla/mux"
@@ -16,43 +15,104 @@ import (
 func (server *httpImpl) Login(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	pass := r.FormValue("pass")
+	ip := GetClientIP(r, server.config.BehindProxy)
+
+	// Throttle is checked before the password, so locked accounts can't be brute-forced any further
+	wait := server.reserveLoginAttempt(email, ip)
+	if wait > 0 {
+		server.db.RecordLoginAttempt(-1, email, ip, false, "throttled")
+		WriteTooManyRequests(w, wait)
+		return
+	}
+
 	// Check if password is valid
 	user, err := server.db.GetUserByEmail(email)
+	if err != nil {
+		// Unknown emails are throttled the same way, so attackers can't find out which accounts exist
+		server.registerLoginFailure(-1, email, ip, "unknown email")
+		WriteJSON(w, Response{Data: "Hashes don't match...", Success: false}, http.StatusForbidden)
+		return
+	}
 
 	if user.Role == "unverified" {
+		server.releaseLoginAttempt(email, ip)
 		WriteJSON(w, Response{Data: "You are unverified. You cannot login until the school administrator confirms you.", Success: false}, http.StatusForbidden)
 		return
 	}
 
 	hashCorrect := sql.CheckHash(pass, user.Password)
 	if !hashCorrect {
+		server.registerLoginFailure(user.ID, email, ip, "wrong password")
 		WriteJSON(w, Response{Data: "Hashes don't match...", Success: false}, http.StatusForbidden)
 		return
 	}
 
-	// Extract JWT
-	jwt, err := sql.GetJWTFromUserPass(email, user.Role, user.ID)
+	server.completeLogin(w, user, ip)
+}
+
+// completeLogin issues the MeetPlan tokens to the already authenticated user. Users with two-factor
+// authentication have to complete the second step at /user/login/2fa first.
+func (server *httpImpl) completeLogin(w http.ResponseWriter, user sql.User, ip string) {
+	if user.TOTPEnabled {
+		// The second step is throttled on its own
+		server.releaseLoginAttempt(user.Email, ip)
+		token, err := server.db.GetJWTForTwoFactor(user.ID)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, Response{Data: TwoFactorChallenge{TwoFactorRequired: true, TwoFactorToken: token}, Success: true}, http.StatusOK)
+		return
+	}
+
+	server.registerLoginSuccess(user.ID, user.Email, ip)
+
+	// Create a new session and extract JWT
+	accessToken, refreshToken, err := server.db.NewSession(user, false)
 	if err != nil {
 		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 		return
 	}
 
-	WriteJSON(w, Response{Data: jwt, Success: true}, http.StatusOK)
+	WriteJSON(w, Response{Data: TokenPair{
+		AccessToken:            accessToken,
+		RefreshToken:           refreshToken,
+		TwoFactorSetupRequired: server.db.IsTwoFactorRequired(user.Role),
+	}, Success: true}, http.StatusOK)
 }
 
 func (server *httpImpl) NewUser(w http.ResponseWriter, r *http.Request) {
-	if server.config.BlockRegistrations {
+	// Parents with an invitation code from the class teacher can register even when registrations are blocked
+	invitationCode := r.FormValue("invitation_code")
+	// Users registering themselves aren't logged in, so only administrators creating users are recorded as actors
+	db := server.audited(r, nil)
+	if invitationCode != "" {
+		ip := GetClientIP(r, server.config.BehindProxy)
+		wait := server.reserveLoginAttempt(r.FormValue("email"), ip)
+		if wait > 0 {
+			WriteTooManyRequests(w, wait)
+			return
+		}
+		invitation, err := server.db.GetChildInvitationByCode(invitationCode)
+		if err != nil || invitation.IsUsed || invitation.ExpiresAt < time.Now().Unix() {
+			server.registerLoginFailure(-1, r.FormValue("email"), ip, "invalid invitation code")
+			WriteJSON(w, Response{Data: "Invalid invitation code", Success: false}, http.StatusForbidden)
+			return
+		}
+		server.releaseLoginAttempt(r.FormValue("email"), ip)
+	} else if server.config.BlockRegistrations {
 		j := GetAuthorizationJWT(r)
 		if j == "" {
 			WriteForbiddenJWT(w)
 			return
 		}
-		jwt, err := sql.CheckJWT(j)
+		jwt, err := server.db.CheckJWT(j)
 		if err != nil {
 			WriteForbiddenJWT(w)
 			return
 		}
-		if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+		if server.can(jwt, sql.PermissionUsersManage) {
+			db = server.audited(r, jwt)
 		} else {
 			WriteForbiddenJWT(w)
 			return
@@ -95,34 +155,39 @@ func (server *httpImpl) NewUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := sql.User{
-		ID:                     server.db.GetLastUserID(),
 		Email:                  email,
 		Password:               password,
 		Role:                   role,
 		Name:                   name,
 		BirthCertificateNumber: "",
-		Birthday:               "",
 		CityOfBirth:            "",
 		CountryOfBirth:         "",
-		Users:                  "[]",
 	}
 
-	err = server.db.InsertUser(user)
+	user.ID, err = db.InsertUser(user)
 	if err != nil {
 		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to commit new user to database", Success: false}, http.StatusInternalServerError)
 		return
 	}
 
+	if invitationCode != "" {
+		_, err = server.auditedUser(r, user).RedeemChildInvitation(invitationCode, user)
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Data: "User was created, but the invitation code couldn't be redeemed", Success: false}, http.StatusConflict)
+			return
+		}
+	}
+
 	WriteJSON(w, Response{Data: "Success", Success: true}, http.StatusCreated)
 }
 
 func (server *httpImpl) PatchUser(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionUsersManage) {
 		userId, err := strconv.Atoi(mux.Vars(r)["user_id"])
 		if err != nil {
 			WriteForbiddenJWT(w)
@@ -135,7 +200,11 @@ func (server *httpImpl) PatchUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if r.FormValue("birthday") != "" {
-			user.Birthday = r.FormValue("birthday")
+			user.Birthday, err = sql.ParseDate(r.FormValue("birthday"))
+			if err != nil {
+				WriteJSON(w, Response{Error: err.Error(), Data: "Failed to parse birthday", Success: false}, http.StatusBadRequest)
+				return
+			}
 		}
 		if r.FormValue("country_of_birth") != "" {
 			user.CountryOfBirth = r.FormValue("country_of_birth")
@@ -160,7 +229,7 @@ func (server *httpImpl) PatchUser(w http.ResponseWriter, r *http.Request) {
 			}
 			user.IsPassing = isPassing
 		}
-		err = server.db.UpdateUser(user)
+		err = server.audited(r, jwt).UpdateUser(user)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Data: "Failed to update user", Success: false}, http.StatusInternalServerError)
 			return
@@ -173,12 +242,12 @@ func (server *httpImpl) PatchUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) HasClass(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionClassesRead) {
 		userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			WriteForbiddenJWT(w)
@@ -203,21 +272,30 @@ func (server *httpImpl) HasClass(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetUserData(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
+	if err != nil {
+		WriteForbiddenJWT(w)
+		return
+	}
+	currentUserId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	userId, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
+		WriteBadRequest(w)
 		return
 	}
-	var userId int
-	if jwt["role"] == "student" {
-		userId, err = strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	// Students and parents only see data of themselves and their children
+	if !server.can(jwt, sql.PermissionUsersRead) && !server.can(jwt, sql.PermissionClassesRead) {
+		canSee, err := server.canSeeStudent(jwt, currentUserId, userId, true)
 		if err != nil {
-			WriteBadRequest(w)
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-	} else {
-		userId, err = strconv.Atoi(mux.Vars(r)["id"])
-		if err != nil {
-			WriteBadRequest(w)
+		if !canSee {
+			WriteForbiddenJWT(w)
 			return
 		}
 	}
@@ -227,7 +305,7 @@ func (server *httpImpl) GetUserData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var birthCertNum = ""
-	if jwt["role"] == "admin" {
+	if server.can(jwt, sql.PermissionUsersReadPrivate) {
 		birthCertNum = user.BirthCertificateNumber
 	}
 
@@ -246,79 +324,29 @@ func (server *httpImpl) GetUserData(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) GetAbsencesUser(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	var studentId int
-	if jwt["role"] == "student" {
-		studentId, err = strconv.Atoi(fmt.Sprint(jwt["user_id"]))
-		if err != nil {
-			WriteBadRequest(w)
-			return
-		}
-	} else {
-		studentId, err = strconv.Atoi(mux.Vars(r)["id"])
-		if err != nil {
-			WriteBadRequest(w)
-			return
-		}
-		teacherId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
-		if err != nil {
-			WriteBadRequest(w)
-			return
-		}
-		if jwt["role"] == "teacher" {
-			classes, err := server.db.GetClasses()
-			if err != nil {
-				WriteJSON(w, Response{Data: "Could not fetch classes", Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-			var valid = false
-			for i := 0; i < len(classes); i++ {
-				class := classes[i]
-				var users []int
-				err := json.Unmarshal([]byte(class.Students), &users)
-				if err != nil {
-					WriteJSON(w, Response{Data: "Could not unmarshal students", Error: err.Error(), Success: false}, http.StatusInternalServerError)
-					return
-				}
-				for j := 0; j < len(users); j++ {
-					if users[j] == studentId && class.Teacher == teacherId {
-						valid = true
-						break
-					}
-				}
-				if valid {
-					break
-				}
-			}
-			if !valid {
-				WriteForbiddenJWT(w)
-				return
-			}
-		} else if jwt["role"] == "parent" {
-			if !server.config.ParentViewAbsences {
-				WriteForbiddenJWT(w)
-				return
-			}
-			parent, err := server.db.GetUser(teacherId)
-			if err != nil {
-				WriteJSON(w, Response{Data: "Could not fetch parent", Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-			var students []int
-			err = json.Unmarshal([]byte(parent.Users), &students)
-			if err != nil {
-				WriteJSON(w, Response{Data: "Could not unmarshal students", Error: err.Error(), Success: false}, http.StatusInternalServerError)
-				return
-			}
-			if !contains(students, studentId) {
-				WriteForbiddenJWT(w)
-				return
-			}
-		}
+	userId, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	studentId, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		WriteBadRequest(w)
+		return
+	}
+	valid, err := server.canSeeStudent(jwt, userId, studentId, server.config.ParentViewAbsences)
+	if err != nil {
+		WriteJSON(w, Response{Data: "Could not fetch classes", Error: err.Error(), Success: false}, http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		WriteForbiddenJWT(w)
+		return
 	}
 	var absenceJson = make([]Absence, 0)
 	absences, err := server.db.GetAbsencesForUser(studentId)
@@ -360,14 +388,16 @@ func (server *httpImpl) GetAbsencesUser(w http.ResponseWriter, r *http.Request)
 }
 
 func (server *httpImpl) GetAllClasses(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
+		WriteForbiddenJWT(w)
 		return
 	}
 
 	var userId = make([]int, 0)
 	var isTeacher = false
-	if jwt["role"] == "admin" || jwt["role"] == "teacher" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	var isParent = false
+	if server.can(jwt, sql.PermissionClassesRead) {
 		uid := r.URL.Query().Get("id")
 		if uid == "" {
 			u, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
@@ -385,86 +415,73 @@ func (server *httpImpl) GetAllClasses(w http.ResponseWriter, r *http.Request) {
 			}
 			userId = append(userId, u)
 		}
-	} else if jwt["role"] == "parent" {
+	} else {
 		u, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		user, err := server.db.GetUser(u)
-		if err != nil {
-			return
-		}
-		err = json.Unmarshal([]byte(user.Users), &userId)
-		if err != nil {
-			return
-		}
-	} else {
-		u, err := strconv.Atoi(fmt.Sprint(jwt["user_id"]))
+		// Parents see classes of their children
+		children, err := server.db.GetChildren(u)
 		if err != nil {
 			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 			return
 		}
-		userId = append(userId, u)
-	}
-
-	classes, err := server.db.GetClasses()
-	if err != nil {
-		WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
-		return
+		if len(children) != 0 {
+			userId = children
+			isParent = true
+		} else {
+			userId = append(userId, u)
+		}
 	}
 
 	var myclasses = make([]sql.Class, 0)
-	var myClassesInt = make([]int, 0)
 
-	for i := 0; i < len(classes); i++ {
-		class := classes[i]
-		if isTeacher {
+	if isTeacher {
+		classes, err := server.db.GetClasses()
+		if err != nil {
+			WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
+			return
+		}
+		for i := 0; i < len(classes); i++ {
 			for n := 0; n < len(userId); n++ {
-				if class.Teacher == userId[n] {
-					myclasses = append(myclasses, class)
+				if classes[i].Teacher == userId[n] {
+					myclasses = append(myclasses, classes[i])
 				}
 			}
-		} else {
-			var students []int
-			err := json.Unmarshal([]byte(class.Students), &students)
+		}
+	} else {
+		for n := 0; n < len(userId); n++ {
+			classes, err := server.db.GetClassesForStudent(userId[n])
 			if err != nil {
 				WriteJSON(w, Response{Error: err.Error(), Success: false}, http.StatusInternalServerError)
 				return
 			}
-			server.logger.Debug(students, userId)
-			for n := 0; n < len(students); n++ {
-				for l := 0; l < len(userId); l++ {
-					if students[n] == userId[l] && !contains(myClassesInt, students[n]) {
-						user, err := server.db.GetUser(students[n])
-						if err != nil {
-							return
-						}
-						var className = class.Name
-						if jwt["role"] == "parent" {
-							class.Name = fmt.Sprintf("%s - %s", class.Name, user.Name)
-						}
-						myclasses = append(myclasses, class)
-						myClassesInt = append(myClassesInt, students[n])
-						if jwt["role"] == "parent" {
-							class.Name = className
-						}
-						break
-					}
+			// Every student is only listed with one class
+			if len(classes) == 0 {
+				continue
+			}
+			class := classes[0]
+			if isParent {
+				user, err := server.db.GetUser(userId[n])
+				if err != nil {
+					return
 				}
+				class.Name = fmt.Sprintf("%s - %s", class.Name, user.Name)
 			}
+			myclasses = append(myclasses, class)
 		}
 	}
 	WriteJSON(w, Response{Data: myclasses, Success: true}, http.StatusOK)
 }
 
 func (server *httpImpl) GetStudents(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" {
+	if server.can(jwt, sql.PermissionUsersRead) {
 		students, err := server.db.GetStudents()
 		if err != nil {
 			return
@@ -490,7 +507,7 @@ func (server *httpImpl) GetStudents(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) HasBirthday(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
@@ -505,12 +522,12 @@ func (server *httpImpl) HasBirthday(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	currentTime := time.Now()
-	birthday, err := time.Parse("2006-01-02", user.Birthday)
-	if err != nil {
-		WriteJSON(w, Response{Error: err.Error(), Data: "Failed to parse date", Success: false}, http.StatusInternalServerError)
+	birthday := user.Birthday
+	if birthday.IsZero() {
+		WriteJSON(w, Response{Data: "Birthday isn't set", Success: false}, http.StatusInternalServerError)
 		return
 	}
-	if currentTime.Before(birthday) {
+	if sql.Today().Before(birthday) {
 		WriteJSON(w, Response{Data: "Invalid birthday", Success: false}, http.StatusConflict)
 		return
 	}
@@ -520,13 +537,13 @@ func (server *httpImpl) HasBirthday(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *httpImpl) CertificateOfSchooling(w http.ResponseWriter, r *http.Request) {
-	jwt, err := sql.CheckJWT(GetAuthorizationJWT(r))
+	jwt, err := server.db.CheckJWT(GetAuthorizationJWT(r))
 	if err != nil {
 		WriteForbiddenJWT(w)
 		return
 	}
 
-	if jwt["role"] == "admin" || jwt["role"] == "principal" || jwt["role"] == "principal assistant" || jwt["role"] == "school psychologist" {
+	if server.can(jwt, sql.PermissionSchoolingCert) {
 		userId, err := strconv.Atoi(mux.Vars(r)["user_id"])
 		if err != nil {
 			WriteBadRequest(w)
@@ -542,54 +559,25 @@ func (server *httpImpl) CertificateOfSchooling(w http.ResponseWriter, r *http.Re
 			return
 		}
 
-		classes, err := server.db.GetClasses()
+		classes, err := server.db.GetClassesForStudent(userId)
 		if err != nil {
 			return
 		}
-
-		var classId = -1
-
-		for i := 0; i < len(classes); i++ {
-			class := classes[i]
-			var students []int
-			err := json.Unmarshal([]byte(class.Students), &students)
-			if err != nil {
-				return
-			}
-			if contains(students, userId) {
-				classId = class.ID
-				break
-			}
-		}
-
-		if classId == -1 {
-			return
-		}
-
-		class, err := server.db.GetClass(classId)
-		if err != nil {
-			return
-		}
-
-		var students []int
-		err = json.Unmarshal([]byte(class.Students), &students)
-		if err != nil {
-			return
-		}
-		if !contains(students, userId) {
-			WriteForbiddenJWT(w)
+		if len(classes) == 0 {
 			return
 		}
+		class := classes[0]
 
 		m := pdf.NewMaroto(consts.Portrait, consts.A4)
 
-		m.AddUTF8Font("OpenSans", consts.Normal, "fonts/opensans.ttf")
+		m.SetFontLocation(server.config.AssetPath("fonts"))
+		m.AddUTF8Font("OpenSans", consts.Normal, "opensans.ttf")
 		m.SetDefaultFontFamily("OpenSans")
 
 		m.Row(40, func() {
 
 			m.Col(3, func() {
-				_ = m.FileImage("icons/school_logo.png", props.Rect{
+				_ = m.FileImage(server.config.AssetPath("icons/school_logo.png"), props.Rect{
 					Center:  true,
 					Percent: 80,
 				})
@@ -612,7 +600,7 @@ func (server *httpImpl) CertificateOfSchooling(w http.ResponseWriter, r *http.Re
 			m.ColSpace(1)
 
 			m.Col(3, func() {
-				_ = m.FileImage("icons/country_coat_of_arms_black.png", props.Rect{
+				_ = m.FileImage(server.config.AssetPath("icons/country_coat_of_arms_black.png"), props.Rect{
 					Center:  true,
 					Percent: 80,
 				})
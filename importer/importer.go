@@ -0,0 +1,269 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/dchest/uniuri"
+	"io"
+	"strings"
+)
+
+// Columns that can be present in the CSV file. The first row has to be a header with column names,
+// order of the columns doesn't matter. Multiple parent emails are separated by a semicolon.
+var Columns = []string{
+	"name",
+	"email",
+	"birth_certificate_number",
+	"birthday",
+	"city_of_birth",
+	"country_of_birth",
+	"class",
+	"class_year",
+	"class_teacher",
+	"parent_emails",
+}
+
+var requiredColumns = []string{"name", "email"}
+
+type RowError struct {
+	Row   int
+	Email string
+	Error string
+}
+
+type Report struct {
+	DryRun      bool
+	Applied     bool
+	Students    int
+	NewClasses  []string
+	ParentLinks int
+	Errors      []RowError
+	Warnings    []RowError
+}
+
+type Importer interface {
+	ImportStudents(reader io.Reader, dryRun bool) (Report, error)
+}
+
+type importerImpl struct {
+	db sql.SQL
+}
+
+func NewImporter(db sql.SQL) Importer {
+	return &importerImpl{db: db}
+}
+
+type studentRow struct {
+	row    int
+	fields map[string]string
+}
+
+func (r studentRow) get(column string) string {
+	return strings.TrimSpace(r.fields[column])
+}
+
+func readCSV(reader io.Reader) ([]studentRow, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("CSV file is empty")
+	}
+	header := records[0]
+	for i := 0; i < len(header); i++ {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		if !contains(Columns, header[i]) {
+			return nil, fmt.Errorf("unknown column %s", header[i])
+		}
+	}
+	for i := 0; i < len(requiredColumns); i++ {
+		if !contains(header, requiredColumns[i]) {
+			return nil, fmt.Errorf("missing required column %s", requiredColumns[i])
+		}
+	}
+	rows := make([]studentRow, 0)
+	for i := 1; i < len(records); i++ {
+		fields := make(map[string]string)
+		for n := 0; n < len(header); n++ {
+			fields[header[n]] = records[i][n]
+		}
+		// Row numbers match line numbers in spreadsheet editors
+		rows = append(rows, studentRow{row: i + 1, fields: fields})
+	}
+	return rows, nil
+}
+
+// ImportStudents validates all rows of the CSV file and, unless it's a dry run or any row is invalid, creates
+// students, missing classes and links to parents in a single transaction.
+func (i *importerImpl) ImportStudents(reader io.Reader, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun, NewClasses: make([]string, 0), Errors: make([]RowError, 0), Warnings: make([]RowError, 0)}
+
+	rows, err := readCSV(reader)
+	if err != nil {
+		return report, err
+	}
+
+	allUsers, err := i.db.GetAllUsers()
+	if err != nil {
+		return report, err
+	}
+	usersByEmail := make(map[string]sql.User)
+	for n := 0; n < len(allUsers); n++ {
+		usersByEmail[strings.ToLower(allUsers[n].Email)] = allUsers[n]
+	}
+	allClasses, err := i.db.GetClasses()
+	if err != nil {
+		return report, err
+	}
+	classesByName := make(map[string]*sql.Class)
+	for n := 0; n < len(allClasses); n++ {
+		classesByName[allClasses[n].Name] = &allClasses[n]
+	}
+
+	// Imported students don't get a usable password, they have to set it using the password reset.
+	// Hashing a single random password keeps imports of hundreds of students fast, as bcrypt is slow on purpose.
+	password, err := sql.HashPassword(uniuri.NewLen(64))
+	if err != nil {
+		return report, err
+	}
+
+	students := make([]sql.ImportedStudent, 0)
+	newClasses := make([]sql.Class, 0)
+	emailsInFile := make(map[string]int)
+
+	for n := 0; n < len(rows); n++ {
+		row := rows[n]
+		email := row.get("email")
+		rowErrors := make([]string, 0)
+		addError := func(format string, a ...interface{}) {
+			rowErrors = append(rowErrors, fmt.Sprintf(format, a...))
+		}
+
+		name := row.get("name")
+		if name == "" {
+			addError("name is empty")
+		}
+		if email == "" || !strings.Contains(email, "@") || strings.ContainsAny(email, " \t") {
+			addError("invalid email %q", email)
+		} else if previous, ok := emailsInFile[strings.ToLower(email)]; ok {
+			addError("email is already used in row %d", previous)
+		} else if _, ok := usersByEmail[strings.ToLower(email)]; ok {
+			addError("user with this email already exists")
+		}
+		emailsInFile[strings.ToLower(email)] = row.row
+
+		var birthday sql.Date
+		if row.get("birthday") != "" {
+			birthday, err = sql.ParseDate(row.get("birthday"))
+			if err != nil {
+				addError("birthday %q isn't in YYYY-MM-DD format", row.get("birthday"))
+			}
+		}
+
+		var class *sql.Class
+		className := row.get("class")
+		if className != "" {
+			class = classesByName[className]
+			if class == nil {
+				teacherEmail := row.get("class_teacher")
+				teacher, ok := usersByEmail[strings.ToLower(teacherEmail)]
+				if teacherEmail == "" {
+					addError("class %s doesn't exist and class_teacher isn't provided to create it", className)
+				} else if !ok || teacher.Role != "teacher" {
+					addError("class teacher %s doesn't exist or isn't a teacher", teacherEmail)
+				} else {
+					// New classes get their ID once they are inserted
+					class = &sql.Class{
+						ID:        -1,
+						Name:      className,
+						Teacher:   teacher.ID,
+						ClassYear: row.get("class_year"),
+					}
+					classesByName[className] = class
+					newClasses = append(newClasses, *class)
+					report.NewClasses = append(report.NewClasses, className)
+				}
+			}
+		}
+
+		parents := make([]sql.User, 0)
+		parentEmails := strings.Split(row.get("parent_emails"), ";")
+		for p := 0; p < len(parentEmails); p++ {
+			parentEmail := strings.TrimSpace(parentEmails[p])
+			if parentEmail == "" {
+				continue
+			}
+			parent, ok := usersByEmail[strings.ToLower(parentEmail)]
+			if !ok {
+				// Parents often register later, so this doesn't prevent the import
+				report.Warnings = append(report.Warnings, RowError{Row: row.row, Email: email, Error: fmt.Sprintf("parent %s isn't registered yet and won't be linked", parentEmail)})
+				continue
+			}
+			if parent.Role != "parent" {
+				addError("user %s isn't a parent", parentEmail)
+				continue
+			}
+			parents = append(parents, parent)
+		}
+
+		if len(rowErrors) != 0 {
+			for e := 0; e < len(rowErrors); e++ {
+				report.Errors = append(report.Errors, RowError{Row: row.row, Email: email, Error: rowErrors[e]})
+			}
+			continue
+		}
+
+		student := sql.ImportedStudent{
+			Student: sql.User{
+				Email:                  email,
+				Password:               password,
+				Role:                   "student",
+				Name:                   name,
+				BirthCertificateNumber: row.get("birth_certificate_number"),
+				Birthday:               birthday,
+				CityOfBirth:            row.get("city_of_birth"),
+				CountryOfBirth:         row.get("country_of_birth"),
+			},
+			ClassID:   -1,
+			ParentIDs: make([]int, 0),
+		}
+		if class != nil {
+			if class.ID == -1 {
+				student.NewClass = class.Name
+			} else {
+				student.ClassID = class.ID
+			}
+		}
+		for p := 0; p < len(parents); p++ {
+			student.ParentIDs = append(student.ParentIDs, parents[p].ID)
+			report.ParentLinks++
+		}
+		students = append(students, student)
+	}
+
+	report.Students = len(students)
+	if dryRun || len(report.Errors) != 0 {
+		return report, nil
+	}
+
+	_, err = i.db.ImportUsers(students, newClasses)
+	if err != nil {
+		return report, err
+	}
+	report.Applied = true
+	return report, nil
+}
+
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
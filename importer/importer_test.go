@@ -0,0 +1,261 @@
+package importer
+
+import (
+	dbsql "database/sql"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/MeetPlan/MeetPlanBackend/sql/fixtures"
+	"go.uber.org/zap"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// importSchool has a class, its teacher, a parent and a student who are already registered.
+type importSchool struct {
+	db      sql.SQL
+	class   sql.Class
+	teacher sql.User
+	parent  sql.User
+	student sql.User
+}
+
+func newImportSchool(t *testing.T, db sql.SQL) importSchool {
+	school := importSchool{db: db}
+	var err error
+	school.teacher, err = fixtures.NewUser(db, "teacher").Email("razrednik@meetplan.invalid").Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	school.class, err = fixtures.NewClass(db, school.teacher.ID).Name("1.a").Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	school.parent, err = fixtures.NewUser(db, "parent").Email("stars@meetplan.invalid").Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	school.student, err = fixtures.NewUser(db, "student").Email("ucenec@meetplan.invalid").InClass(school.class.ID).Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return school
+}
+
+// users returns emails of all users, to check what an import created.
+func (school importSchool) users(t *testing.T) []string {
+	users, err := school.db.GetAllUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails := make([]string, 0)
+	for i := 0; i < len(users); i++ {
+		emails = append(emails, users[i].Email)
+	}
+	return emails
+}
+
+func (school importSchool) classes(t *testing.T) int {
+	classes, err := school.db.GetClasses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(classes)
+}
+
+func TestImportStudents(t *testing.T) {
+	const header = "name,email,birthday,class,class_teacher,parent_emails\n"
+	tests := []struct {
+		name   string
+		csv    string
+		dryRun bool
+		// Error of the whole file
+		err string
+		// Errors of rows, as row: error
+		errors   []string
+		warnings []string
+		imported int
+	}{
+		{
+			name:     "valid rows",
+			csv:      header + "Ana,ana@meetplan.invalid,2015-03-04,1.a,,stars@meetplan.invalid\nBor,bor@meetplan.invalid,,1.b,razrednik@meetplan.invalid,\n",
+			errors:   []string{},
+			warnings: []string{},
+			imported: 2,
+		},
+		{
+			name:     "dry run",
+			csv:      header + "Ana,ana@meetplan.invalid,,1.a,,\n",
+			dryRun:   true,
+			errors:   []string{},
+			warnings: []string{},
+		},
+		{
+			name:     "unregistered parent",
+			csv:      header + "Ana,ana@meetplan.invalid,,1.a,,nihce@meetplan.invalid\n",
+			errors:   []string{},
+			warnings: []string{"2: parent nihce@meetplan.invalid isn't registered yet and won't be linked"},
+			imported: 1,
+		},
+		{
+			name:     "empty name",
+			csv:      header + " ,ana@meetplan.invalid,,,,\n",
+			errors:   []string{"2: name is empty"},
+			warnings: []string{},
+		},
+		{
+			name:     "invalid email",
+			csv:      header + "Ana,ana meetplan.invalid,,,,\nBor,,,,,\n",
+			errors:   []string{`2: invalid email "ana meetplan.invalid"`, `3: invalid email ""`},
+			warnings: []string{},
+		},
+		{
+			name:     "invalid birthday",
+			csv:      header + "Ana,ana@meetplan.invalid,4. 3. 2015,,,\n",
+			errors:   []string{`2: birthday "4. 3. 2015" isn't in YYYY-MM-DD format`},
+			warnings: []string{},
+		},
+		{
+			name:     "duplicate email in the file",
+			csv:      header + "Ana,ana@meetplan.invalid,,,,\nAna,ANA@meetplan.invalid,,,,\n",
+			errors:   []string{"3: email is already used in row 2"},
+			warnings: []string{},
+		},
+		{
+			name:     "email of a registered user",
+			csv:      header + "Ana,Ucenec@meetplan.invalid,,,,\n",
+			errors:   []string{"2: user with this email already exists"},
+			warnings: []string{},
+		},
+		{
+			name:     "new class without a teacher",
+			csv:      header + "Ana,ana@meetplan.invalid,,1.b,,\n",
+			errors:   []string{"2: class 1.b doesn't exist and class_teacher isn't provided to create it"},
+			warnings: []string{},
+		},
+		{
+			name:     "class teacher who isn't a teacher",
+			csv:      header + "Ana,ana@meetplan.invalid,,1.b,stars@meetplan.invalid,\n",
+			errors:   []string{"2: class teacher stars@meetplan.invalid doesn't exist or isn't a teacher"},
+			warnings: []string{},
+		},
+		{
+			name:     "parent who isn't a parent",
+			csv:      header + "Ana,ana@meetplan.invalid,,,,razrednik@meetplan.invalid\n",
+			errors:   []string{"2: user razrednik@meetplan.invalid isn't a parent"},
+			warnings: []string{},
+		},
+		{
+			// Valid rows aren't imported either, so the file can be fixed and imported again
+			name:     "valid and invalid rows",
+			csv:      header + "Ana,ana@meetplan.invalid,,1.b,razrednik@meetplan.invalid,\nBor,bor,,,,\n",
+			errors:   []string{`3: invalid email "bor"`},
+			warnings: []string{},
+		},
+		{name: "empty file", csv: "", err: "CSV file is empty"},
+		{name: "unknown column", csv: "name,email,razred\n", err: "unknown column razred"},
+		{name: "missing required column", csv: "name,class\nAna,1.a\n", err: "missing required column email"},
+		{name: "row with too many fields", csv: "name,email\nAna,ana@meetplan.invalid,1.a\n", err: "record on line 2: wrong number of fields"},
+		{name: "unterminated quote", csv: "name,email\n\"Ana,ana@meetplan.invalid\n", err: `parse error on line 2, column 27: extraneous or missing " in quoted-field`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := fixtures.NewDatabase(zap.NewNop().Sugar())
+			if err != nil {
+				t.Fatal(err)
+			}
+			school := newImportSchool(t, db)
+			usersBefore := school.users(t)
+			classesBefore := school.classes(t)
+
+			report, err := NewImporter(db).ImportStudents(strings.NewReader(test.csv), test.dryRun)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error: got %v, want %s", err, test.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				if got := rowErrors(report.Errors); !reflect.DeepEqual(got, test.errors) {
+					t.Errorf("errors: got %q, want %q", got, test.errors)
+				}
+				if got := rowErrors(report.Warnings); !reflect.DeepEqual(got, test.warnings) {
+					t.Errorf("warnings: got %q, want %q", got, test.warnings)
+				}
+				if report.Applied != (test.imported != 0) {
+					t.Errorf("applied: got %v, want %v", report.Applied, test.imported != 0)
+				}
+			}
+
+			users := school.users(t)
+			if len(users) != len(usersBefore)+test.imported {
+				t.Errorf("users: got %d, want %d", len(users), len(usersBefore)+test.imported)
+			}
+			if test.imported == 0 && school.classes(t) != classesBefore {
+				t.Errorf("classes: got %d, want %d", school.classes(t), classesBefore)
+			}
+		})
+	}
+}
+
+func rowErrors(errs []RowError) []string {
+	s := make([]string, 0)
+	for i := 0; i < len(errs); i++ {
+		s = append(s, fmt.Sprintf("%d: %s", errs[i].Row, errs[i].Error))
+	}
+	return s
+}
+
+// TestImportStudentsRollback fails the import in the database after the new class and the first student are
+// inserted. Nothing of the import may be left behind.
+func TestImportStudentsRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meetplan.db")
+	db, err := sql.NewSQL("sqlite3", path, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Init()
+	school := newImportSchool(t, db)
+
+	raw, err := dbsql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	_, err = raw.Exec(fmt.Sprintf(`CREATE TRIGGER fail_import BEFORE INSERT ON parent_children WHEN NEW.parent_id=%d
+		BEGIN SELECT RAISE(ABORT, 'linking failed'); END`, school.parent.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usersBefore := school.users(t)
+	classesBefore := school.classes(t)
+	csv := "name,email,class,class_teacher,parent_emails\n" +
+		"Ana,ana@meetplan.invalid,1.b,razrednik@meetplan.invalid,\n" +
+		"Bor,bor@meetplan.invalid,1.a,,stars@meetplan.invalid\n"
+	report, err := NewImporter(db).ImportStudents(strings.NewReader(csv), false)
+	if err == nil || !strings.Contains(err.Error(), "linking failed") {
+		t.Fatalf("error: got %v, want the error of the trigger", err)
+	}
+	if report.Applied {
+		t.Error("failed import is reported as applied")
+	}
+	if users := school.users(t); !reflect.DeepEqual(users, usersBefore) {
+		t.Errorf("users after the failed import: got %v, want %v", users, usersBefore)
+	}
+	if classes := school.classes(t); classes != classesBefore {
+		t.Errorf("classes after the failed import: got %d, want %d", classes, classesBefore)
+	}
+	students, err := db.GetClassStudents(school.class.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(students, []int{school.student.ID}) {
+		t.Errorf("students of the class after the failed import: got %v, want %v", students, []int{school.student.ID})
+	}
+}
@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"go.uber.org/zap"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// NewMailer creates a mailer according to the configuration. SMTP is used when "mailer" is set to "smtp",
+// otherwise all emails are appended to a local file, which is useful for development and testing.
+func NewMailer(config sql.Config, logger *zap.SugaredLogger) (Mailer, error) {
+	switch config.Mailer {
+	case "smtp":
+		if config.SMTPHost == "" || config.MailFrom == "" {
+			return nil, errors.New("smtp_host and mail_from have to be set when using SMTP mailer")
+		}
+		return &smtpMailer{
+			host:     config.SMTPHost,
+			port:     config.SMTPPort,
+			username: config.SMTPUsername,
+			password: config.SMTPPassword,
+			from:     config.MailFrom,
+		}, nil
+	case "", "file":
+		path := config.MailFile
+		if path == "" {
+			path = "MeetPlanDB/mail.log"
+		}
+		return &fileMailer{path: path, logger: logger}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer: %s", config.Mailer)
+	}
+}
+
+type smtpMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func (m *smtpMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	return smtp.SendMail(fmt.Sprintf("%s:%d", m.host, m.port), auth, m.from, []string{to}, formatMessage(m.from, to, subject, body))
+}
+
+type fileMailer struct {
+	path   string
+	logger *zap.SugaredLogger
+}
+
+func (m *fileMailer) Send(to string, subject string, body string) error {
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(formatMessage("MeetPlan", to, subject, body), []byte("\r\n\r\n")...))
+	if err != nil {
+		return err
+	}
+	m.logger.Infow("Email written to file", "to", to, "subject", subject, "file", m.path)
+	return nil
+}
+
+func formatMessage(from string, to string, subject string, body string) []byte {
+	// Header injection protection, as some of the values come from users
+	clean := func(s string) string {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+	}
+	return []byte(fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		clean(from), clean(to), clean(subject), time.Now().Format(time.RFC1123Z), body,
+	))
+}
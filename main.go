@@ -2,26 +2,27 @@ package main
 
 import (
 	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/backup"
 	"github.com/MeetPlan/MeetPlanBackend/httphandlers"
+	"github.com/MeetPlan/MeetPlanBackend/mailer"
+	"github.com/MeetPlan/MeetPlanBackend/oidc"
 	"github.com/MeetPlan/MeetPlanBackend/proton"
 	"github.com/MeetPlan/MeetPlanBackend/sql"
-	"github.com/gorilla/mux"
+	"github.com/dchest/uniuri"
 	"github.com/rs/cors"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"time"
 )
 
 func main() {
-	fmt.Println("Starting MeetPlan server...")
-
 	var logger *zap.Logger
 	var err error
 
 	config, err := sql.GetConfig()
 	if err != nil {
 		panic("Error while retrieving config: " + err.Error())
-		return
 	}
 
 	if config.Debug {
@@ -32,7 +33,6 @@ func main() {
 
 	if err != nil {
 		panic(err.Error())
-		return
 	}
 
 	sugared := logger.Sugar()
@@ -41,117 +41,78 @@ func main() {
 		os.Mkdir("MeetPlanDB", os.ModePerm)
 	}
 
-	db, err := sql.NewSQL(config.DatabaseName, config.DatabaseConfig, sugared)
-	db.Init()
+	// The audit log's key is kept in the config, outside the database it protects
+	if config.AuditKey == "" {
+		config.AuditKey = uniuri.NewLen(64)
+		err = sql.SaveConfig(config)
+		if err != nil {
+			sugared.Fatal("Error while saving audit log key: " + err.Error())
+		}
+	}
 
+	db, err := sql.NewSQL(config.DatabaseName, config.DatabaseConfig, sugared)
 	if err != nil {
 		sugared.Fatal("Error while creating database: " + err.Error())
 		return
 	}
+	db.SetAuditKey(config.AuditKey)
+
+	// Migrations are managed before the database is initialized, as initialization requires an up-to-date schema.
+	// Backups are restored before it as well, as a restored database may need to be migrated.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(os.Args[2:], db, sugared))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		os.Exit(backupCommand(os.Args[2:], db, config, sugared))
+	}
+	if !config.SkipMigrations {
+		_, err = db.MigrateUp()
+		if err != nil {
+			sugared.Fatal("Error while migrating database: " + err.Error())
+			return
+		}
+	}
+	db.Init()
+
+	if runCommand(os.Args[1:], db, config, sugared) {
+		return
+	}
+
+	fmt.Println("Starting MeetPlan server...")
 
 	protonState := proton.NewProton(db)
 
-	httphandler := httphandlers.NewHTTPInterface(sugared, db, config, protonState)
+	mail, err := mailer.NewMailer(config, sugared)
+	if err != nil {
+		sugared.Fatal("Error while creating mailer: " + err.Error())
+		return
+	}
+
+	// Single sign-on is enabled only when the identity provider is configured
+	var sso oidc.Provider
+	if config.OIDCIssuer != "" {
+		sso = oidc.NewProvider(oidc.Config{
+			Issuer:       config.OIDCIssuer,
+			ClientID:     config.OIDCClientID,
+			ClientSecret: config.OIDCClientSecret,
+			RedirectURL:  config.OIDCRedirectURL,
+			GroupsClaim:  config.OIDCGroupsClaim,
+		})
+	}
+
+	backups := backup.NewManager(db, config, sugared)
+	if config.BackupIntervalHours > 0 {
+		go backups.RunScheduled(time.Duration(config.BackupIntervalHours) * time.Hour)
+	}
+
+	httphandler := httphandlers.NewHTTPInterface(sugared, db, config, protonState, mail, sso, backups)
 
 	sugared.Info("Database created successfully")
 
-	r := mux.NewRouter()
-	r.HandleFunc("/user/new", httphandler.NewUser).Methods("POST")
-	r.HandleFunc("/user/login", httphandler.Login).Methods("POST")
-	// Get all classes for specific user
-	r.HandleFunc("/user/get/classes", httphandler.GetAllClasses).Methods("GET")
-	r.HandleFunc("/user/check/has/class", httphandler.HasClass).Methods("GET")
-	r.HandleFunc("/user/get/data/{id}", httphandler.GetUserData).Methods("GET")
-	r.HandleFunc("/user/get/data/{user_id}", httphandler.PatchUser).Methods("PATCH")
-	r.HandleFunc("/user/get/homework/{id}", httphandler.GetUserHomework).Methods("GET")
-	r.HandleFunc("/user/get/absences/{id}", httphandler.GetAbsencesUser).Methods("GET")
-	r.HandleFunc("/user/get/ending_certificate/{student_id}", httphandler.PrintCertificateOfEndingClass).Methods("GET")
-	r.HandleFunc("/user/get/certificate_of_schooling/{user_id}", httphandler.CertificateOfSchooling).Methods("GET")
-	r.HandleFunc("/user/get/unread_messages", httphandler.GetUnreadMessages).Methods("GET")
-
-	r.HandleFunc("/user/get/absences/{student_id}/excuse/{absence_id}", httphandler.ExcuseAbsence).Methods("PATCH")
-
-	r.HandleFunc("/class/get/{class_id}/self_testing", httphandler.GetSelfTestingTeacher).Methods("GET")
-	r.HandleFunc("/user/self_testing/patch/{class_id}/{student_id}", httphandler.PatchSelfTesting).Methods("PATCH")
-	r.HandleFunc("/user/self_testing/get_results", httphandler.GetTestingResults).Methods("GET")
-	r.HandleFunc("/user/self_testing/get_results/pdf/{test_id}", httphandler.GetPDFSelfTestingReportStudent).Methods("GET")
-
-	r.HandleFunc("/class/new", httphandler.NewClass).Methods("POST")
-	r.HandleFunc("/class/get/{id}", httphandler.GetClass).Methods("GET")
-	r.HandleFunc("/class/get/{id}", httphandler.PatchClass).Methods("PATCH")
-	r.HandleFunc("/class/get/{id}", httphandler.DeleteClass).Methods("DELETE")
-	// Get all classes in database
-	r.HandleFunc("/classes/get", httphandler.GetClasses).Methods("GET")
-	r.HandleFunc("/class/get/{class_id}/add_user/{user_id}", httphandler.AssignUserToClass).Methods("PATCH")
-	r.HandleFunc("/class/get/{class_id}/remove_user/{user_id}", httphandler.RemoveUserFromClass).Methods("DELETE")
-
-	r.HandleFunc("/users/get", httphandler.GetAllUsers).Methods("GET")
-	r.HandleFunc("/meals/get", httphandler.GetMeals).Methods("GET")
-	r.HandleFunc("/meal/get/{meal_id}", httphandler.EditMeal).Methods("PATCH")
-	r.HandleFunc("/meal/get/{meal_id}", httphandler.DeleteMeal).Methods("DELETE")
-	r.HandleFunc("/meals/new", httphandler.NewMeal).Methods("POST")
-	r.HandleFunc("/meals/blocked", httphandler.MealsBlocked).Methods("GET")
-	r.HandleFunc("/teachers/get", httphandler.GetTeachers).Methods("GET")
-	r.HandleFunc("/students/get", httphandler.GetStudents).Methods("GET")
-	r.HandleFunc("/user/role/update/{id}", httphandler.ChangeRole).Methods("PATCH")
-	r.HandleFunc("/user/delete/{id}", httphandler.DeleteUser).Methods("DELETE")
-
-	r.HandleFunc("/parent/{parent}/assign/student/{student}", httphandler.AssignUserToParent).Methods("PATCH")
-	r.HandleFunc("/parent/{parent}/assign/student/{student}", httphandler.RemoveUserFromParent).Methods("DELETE")
-	r.HandleFunc("/parents/get/students", httphandler.GetMyChildren).Methods("GET")
-	r.HandleFunc("/parents/get/config", httphandler.ParentConfig).Methods("GET")
-
-	r.HandleFunc("/order/new/{meal_id}", httphandler.NewOrder).Methods("POST")
-	r.HandleFunc("/order/get/{meal_id}/block_unblock", httphandler.BlockUnblockOrder).Methods("PATCH")
-	r.HandleFunc("/order/get/{meal_id}", httphandler.RemoveOrder).Methods("DELETE")
-
-	r.HandleFunc("/my/grades", httphandler.GetMyGrades).Methods("GET")
-	r.HandleFunc("/my/gradings", httphandler.GetMyGradings).Methods("GET")
-
-	r.HandleFunc("/timetable/get", httphandler.GetTimetable).Methods("GET")
-
-	r.HandleFunc("/meetings/new", httphandler.NewMeeting).Methods("POST")
-	r.HandleFunc("/meetings/new/{id}", httphandler.PatchMeeting).Methods("PATCH")
-	r.HandleFunc("/meetings/new/{id}", httphandler.DeleteMeeting).Methods("DELETE")
-
-	r.HandleFunc("/communications/get", httphandler.GetCommunications).Methods("GET")
-	r.HandleFunc("/communication/get/{id}", httphandler.GetCommunication).Methods("GET")
-	r.HandleFunc("/communication/get/{id}/message/new", httphandler.NewMessage).Methods("POST")
-	r.HandleFunc("/communication/new", httphandler.NewCommunication).Methods("POST")
-
-	r.HandleFunc("/message/get/{message_id}", httphandler.DeleteMessage).Methods("DELETE")
-	r.HandleFunc("/message/get/{message_id}", httphandler.EditMessage).Methods("PATCH")
-
-	r.HandleFunc("/meeting/get/{meeting_id}", httphandler.GetMeeting).Methods("GET")
-	r.HandleFunc("/meeting/get/{meeting_id}/absences", httphandler.GetAbsencesTeacher).Methods("GET")
-	r.HandleFunc("/meeting/get/{meeting_id}/grades", httphandler.GetGradesForMeeting).Methods("GET")
-	r.HandleFunc("/meeting/get/{meeting_id}/homework/{homework_id}/{student_id}", httphandler.PatchHomeworkForStudent).Methods("PATCH")
-	r.HandleFunc("/meeting/get/{meeting_id}/homework", httphandler.NewHomework).Methods("POST")
-	r.HandleFunc("/meeting/get/{meeting_id}/homework", httphandler.GetAllHomeworksForSpecificSubject).Methods("GET")
-	r.HandleFunc("/meeting/get/{meeting_id}/substitutions/proton", httphandler.ManageTeacherAbsences).Methods("GET")
-
-	r.HandleFunc("/meeting/absence/{absence_id}", httphandler.PatchAbsence).Methods("PATCH")
-
-	r.HandleFunc("/grades/new/{meeting_id}", httphandler.NewGrade).Methods("POST")
-
-	r.HandleFunc("/grade/get/{grade_id}", httphandler.PatchGrade).Methods("PATCH")
-	r.HandleFunc("/grade/get/{grade_id}", httphandler.DeleteGrade).Methods("DELETE")
-
-	r.HandleFunc("/subjects/get", httphandler.GetSubjects).Methods("GET")
-	r.HandleFunc("/subjects/new", httphandler.NewSubject).Methods("POST")
-
-	r.HandleFunc("/subject/get/{subject_id}", httphandler.GetSubject).Methods("GET")
-	r.HandleFunc("/subject/get/{subject_id}", httphandler.DeleteSubject).Methods("DELETE")
-	r.HandleFunc("/subject/get/{subject_id}", httphandler.PatchSubjectName).Methods("PATCH")
-	r.HandleFunc("/subject/get/{subject_id}/add_user/{user_id}", httphandler.AssignUserToSubject).Methods("PATCH")
-	r.HandleFunc("/subject/get/{subject_id}/remove_user/{user_id}", httphandler.RemoveUserFromSubject).Methods("DELETE")
-
-	r.HandleFunc("/admin/config/get", httphandler.GetConfig).Methods("GET")
-	r.HandleFunc("/admin/config/get", httphandler.UpdateConfiguration).Methods("PATCH")
-
-	r.HandleFunc("/system/notifications", httphandler.GetSystemNotifications).Methods("GET")
-	r.HandleFunc("/system/notifications/new", httphandler.NewNotification).Methods("POST")
-	r.HandleFunc("/notification/{notification_id}", httphandler.DeleteNotification).Methods("DELETE")
+	r, err := httphandlers.NewRouter(httphandler)
+	if err != nil {
+		sugared.Fatal(err.Error())
+	}
 
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"}, // All origins
@@ -1 +0,0 @@
-ALTER TABLE meals ADD COLUMN block_orders BOOLEAN DEFAULT false;
@@ -1 +0,0 @@
-ALTER TABLE grades ADD COLUMN can_patch BOOLEAN DEFAULT true;
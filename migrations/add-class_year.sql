@@ -1 +0,0 @@
-ALTER TABLE classes ADD COLUMN class_year VARCHAR(20) DEFAULT '';
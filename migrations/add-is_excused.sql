@@ -1 +0,0 @@
-ALTER TABLE absence ADD COLUMN is_excused BOOLEAN DEFAULT false;
@@ -1 +0,0 @@
-ALTER TABLE grades ADD COLUMN is_final BOOLEAN DEFAULT false;
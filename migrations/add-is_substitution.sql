@@ -1 +0,0 @@
-ALTER TABLE meetings ADD COLUMN is_substitution BOOLEAN DEFAULT false;
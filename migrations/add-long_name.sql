@@ -1 +0,0 @@
-ALTER TABLE subject ADD COLUMN long_name VARCHAR(200) DEFAULT "";
@@ -1 +0,0 @@
-ALTER TABLE subject ADD COLUMN realization FLOAT DEFAULT 0.0;
@@ -1,3 +0,0 @@
-ALTER TABLE classes ADD COLUMN sok INTEGER DEFAULT 1;
-ALTER TABLE classes ADD COLUMN eok INTEGER DEFAULT 1;
-ALTER TABLE classes ADD COLUMN last_school_date INTEGER DEFAULT 1649521548;
@@ -1 +0,0 @@
-ALTER TABLE users ADD COLUMN users VARCHAR(200) DEFAULT '[]';
\ No newline at end of file
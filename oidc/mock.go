@@ -0,0 +1,222 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dchest/uniuri"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mockKeyID = "mock"
+
+// MockUser is the identity the mock identity provider logs in.
+type MockUser struct {
+	Subject string   `json:"sub"`
+	Email   string   `json:"email"`
+	Name    string   `json:"name"`
+	Groups  []string `json:"groups"`
+}
+
+type mockCode struct {
+	clientId    string
+	redirectURI string
+	nonce       string
+	user        MockUser
+	expiresAt   time.Time
+}
+
+type mockProvider struct {
+	issuer       string
+	clientId     string
+	clientSecret string
+	users        []MockUser
+	key          *rsa.PrivateKey
+	keyID        string
+	mutex        sync.Mutex
+	codes        map[string]mockCode
+}
+
+// NewMockProvider creates a minimal identity provider meant for local development and testing. Authorization
+// requests are approved without asking for credentials. The user is chosen by the login_hint parameter
+// (matched against email or subject), otherwise the first user is logged in.
+func NewMockProvider(issuer string, clientId string, clientSecret string, users []MockUser) (http.Handler, error) {
+	provider, err := newMockProvider(issuer, clientId, clientSecret, users)
+	if err != nil {
+		return nil, err
+	}
+	return provider.handler(), nil
+}
+
+func newMockProvider(issuer string, clientId string, clientSecret string, users []MockUser) (*mockProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &mockProvider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		users:        users,
+		key:          key,
+		keyID:        mockKeyID,
+		codes:        make(map[string]mockCode),
+	}, nil
+}
+
+func (p *mockProvider) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	return mux
+}
+
+// signIDToken signs the claims with the provider's current key.
+func (p *mockProvider) signIDToken(claims jwt.MapClaims) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.key)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (p *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	}, http.StatusOK)
+}
+
+func (p *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	p.mutex.Lock()
+	key := jsonWebKey{
+		Kty: "RSA",
+		Kid: p.keyID,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}
+	p.mutex.Unlock()
+	writeJSON(w, map[string]interface{}{
+		"keys": []jsonWebKey{key},
+	}, http.StatusOK)
+}
+
+func (p *mockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != p.clientId || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if len(p.users) == 0 {
+		http.Error(w, "mock identity provider has no users", http.StatusInternalServerError)
+		return
+	}
+	user := p.users[0]
+	if hint := q.Get("login_hint"); hint != "" {
+		found := false
+		for i := 0; i < len(p.users); i++ {
+			if p.users[i].Email == hint || p.users[i].Subject == hint {
+				user = p.users[i]
+				found = true
+				break
+			}
+		}
+		if !found {
+			http.Error(w, "unknown user", http.StatusBadRequest)
+			return
+		}
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code := uniuri.NewLen(32)
+	p.mutex.Lock()
+	p.codes[code] = mockCode{
+		clientId:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		user:        user,
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	p.mutex.Unlock()
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientId, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId = r.FormValue("client_id")
+		clientSecret = r.FormValue("client_secret")
+	}
+	if clientId != p.clientId || clientSecret != p.clientSecret {
+		writeJSON(w, map[string]string{"error": "invalid_client"}, http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("grant_type") != "authorization_code" {
+		writeJSON(w, map[string]string{"error": "unsupported_grant_type"}, http.StatusBadRequest)
+		return
+	}
+	p.mutex.Lock()
+	code, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mutex.Unlock()
+	if !ok || code.expiresAt.Before(time.Now()) || code.clientId != clientId || code.redirectURI != r.FormValue("redirect_uri") {
+		writeJSON(w, map[string]string{"error": "invalid_grant"}, http.StatusBadRequest)
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            code.user.Subject,
+		"aud":            clientId,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"email":          code.user.Email,
+		"email_verified": true,
+		"name":           code.user.Name,
+		"groups":         code.user.Groups,
+	}
+	if code.nonce != "" {
+		claims["nonce"] = code.nonce
+	}
+	idToken, err := p.signIDToken(claims)
+	if err != nil {
+		writeJSON(w, map[string]string{"error": "server_error"}, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": uniuri.NewLen(32),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	}, http.StatusOK)
+}
@@ -0,0 +1,308 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Name of the ID token claim containing user's groups, "groups" by default
+	GroupsClaim string
+}
+
+// Claims are the claims from the ID token MeetPlan cares about.
+type Claims struct {
+	Subject string
+	Email   string
+	// EmailVerified is only true when the ID token has email_verified set to true
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+type Provider interface {
+	AuthCodeURL(state string, nonce string) (string, error)
+	Exchange(code string, nonce string) (Claims, error)
+}
+
+type providerImpl struct {
+	config    Config
+	client    *http.Client
+	mutex     sync.Mutex
+	discovery *discovery
+	keys      map[string]interface{}
+}
+
+// NewProvider creates a new OIDC relying party. Discovery is done lazily on the first login, so MeetPlan
+// can start even when the identity provider is unreachable.
+func NewProvider(config Config) Provider {
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	return &providerImpl{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]interface{}),
+	}
+}
+
+func (p *providerImpl) getJSON(u string, v interface{}) error {
+	res, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("identity provider returned status %d for %s", res.StatusCode, u)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (p *providerImpl) getDiscovery() (*discovery, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d discovery
+	err := p.getJSON(strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, err
+	}
+	if d.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch, expected %s, got %s", p.config.Issuer, d.Issuer)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+func (p *providerImpl) AuthCodeURL(state string, nonce string) (string, error) {
+	d, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", "openid email profile")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange exchanges the authorization code for tokens and returns verified claims from the ID token.
+func (p *providerImpl) Exchange(code string, nonce string) (Claims, error) {
+	var claims Claims
+	d, err := p.getDiscovery()
+	if err != nil {
+		return claims, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	req, err := http.NewRequest("POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return claims, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	res, err := p.client.Do(req)
+	if err != nil {
+		return claims, err
+	}
+	defer res.Body.Close()
+	var token tokenResponse
+	err = json.NewDecoder(res.Body).Decode(&token)
+	if err != nil {
+		return claims, err
+	}
+	if res.StatusCode != http.StatusOK || token.Error != "" {
+		return claims, fmt.Errorf("token exchange failed: %s %s", token.Error, token.Description)
+	}
+	if token.IDToken == "" {
+		return claims, errors.New("identity provider didn't return an ID token")
+	}
+	return p.verifyIDToken(token.IDToken, nonce)
+}
+
+func (p *providerImpl) verifyIDToken(idToken string, nonce string) (Claims, error) {
+	var claims Claims
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return p.getKey(fmt.Sprint(token.Header["kid"]))
+	})
+	if err != nil {
+		return claims, err
+	}
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return claims, errors.New("invalid ID token")
+	}
+	if mapClaims["iss"] != p.config.Issuer {
+		return claims, errors.New("ID token has invalid issuer")
+	}
+	if !mapClaims.VerifyAudience(p.config.ClientID, true) {
+		return claims, errors.New("ID token has invalid audience")
+	}
+	if _, ok := mapClaims["exp"]; !ok {
+		return claims, errors.New("ID token doesn't expire")
+	}
+	if mapClaims["nonce"] != nonce {
+		return claims, errors.New("ID token has invalid nonce")
+	}
+
+	claims.Subject = fmt.Sprint(mapClaims["sub"])
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.Name, _ = mapClaims["name"].(string)
+	// Emails are only verified when the provider says so, a missing email_verified claim doesn't count
+	claims.EmailVerified, _ = mapClaims["email_verified"].(bool)
+	switch groups := mapClaims[p.config.GroupsClaim].(type) {
+	case []interface{}:
+		for i := 0; i < len(groups); i++ {
+			claims.Groups = append(claims.Groups, fmt.Sprint(groups[i]))
+		}
+	case string:
+		claims.Groups = strings.Fields(groups)
+	}
+	return claims, nil
+}
+
+// getKey returns the public key used to verify ID tokens. Keys are fetched again when an unknown key ID is seen,
+// so key rotation at the identity provider works without restarting MeetPlan.
+func (p *providerImpl) getKey(kid string) (interface{}, error) {
+	p.mutex.Lock()
+	key, ok := p.keys[kid]
+	p.mutex.Unlock()
+	if ok {
+		return key, nil
+	}
+	d, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = p.getJSON(d.JWKSURI, &jwks)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{})
+	for i := 0; i < len(jwks.Keys); i++ {
+		if jwks.Keys[i].Use != "" && jwks.Keys[i].Use != "sig" {
+			continue
+		}
+		k, err := parseJWK(jwks.Keys[i])
+		if err != nil {
+			continue
+		}
+		keys[jwks.Keys[i].Kid] = k
+	}
+	p.mutex.Lock()
+	p.keys = keys
+	p.mutex.Unlock()
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %s", kid)
+	}
+	return key, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func parseJWK(key jsonWebKey) (interface{}, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", key.Crv)
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", key.Kty)
+	}
+}
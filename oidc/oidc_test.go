@@ -0,0 +1,200 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "meetplan"
+	testClientSecret = "skrivnost"
+	testNonce        = "nonce"
+)
+
+// newTestProvider starts the mock identity provider and returns it with a relying party that trusts it.
+func newTestProvider(t *testing.T) (*mockProvider, *providerImpl) {
+	var handler http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	mock, err := newMockProvider(server.URL, testClientID, testClientSecret, []MockUser{
+		{Subject: "1", Email: "ucitelj@example.com", Name: "Učitelj", Groups: []string{"teachers"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler = mock.handler()
+	provider := NewProvider(Config{
+		Issuer:       server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  "https://meetplan.example.com/login/oidc",
+	}).(*providerImpl)
+	return mock, provider
+}
+
+func validClaims(mock *mockProvider) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            mock.issuer,
+		"sub":            "1",
+		"aud":            testClientID,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"nonce":          testNonce,
+		"email":          "ucitelj@example.com",
+		"email_verified": true,
+		"name":           "Učitelj",
+		"groups":         []string{"teachers"},
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	tests := []struct {
+		name   string
+		change func(claims jwt.MapClaims)
+		valid  bool
+		// EmailVerified of valid tokens
+		verified bool
+	}{
+		{"valid", func(claims jwt.MapClaims) {}, true, true},
+		{"other issuer", func(claims jwt.MapClaims) { claims["iss"] = "https://idp.example.com" }, false, false},
+		{"other audience", func(claims jwt.MapClaims) { claims["aud"] = "other" }, false, false},
+		{"audience list", func(claims jwt.MapClaims) { claims["aud"] = []string{"other", testClientID} }, true, true},
+		{"other nonce", func(claims jwt.MapClaims) { claims["nonce"] = "other" }, false, false},
+		{"missing nonce", func(claims jwt.MapClaims) { delete(claims, "nonce") }, false, false},
+		{"expired", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }, false, false},
+		{"missing exp", func(claims jwt.MapClaims) { delete(claims, "exp") }, false, false},
+		{"missing email_verified", func(claims jwt.MapClaims) { delete(claims, "email_verified") }, true, false},
+		{"unverified email", func(claims jwt.MapClaims) { claims["email_verified"] = false }, true, false},
+		{"email_verified as a string", func(claims jwt.MapClaims) { claims["email_verified"] = "true" }, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := validClaims(mock)
+			test.change(claims)
+			idToken, err := mock.signIDToken(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verified, err := provider.verifyIDToken(idToken, testNonce)
+			if test.valid != (err == nil) {
+				t.Fatalf("valid: got %v (%v), want %v", err == nil, err, test.valid)
+			}
+			if !test.valid {
+				return
+			}
+			if verified.EmailVerified != test.verified {
+				t.Errorf("EmailVerified: got %v, want %v", verified.EmailVerified, test.verified)
+			}
+			if verified.Subject != "1" || verified.Email != "ucitelj@example.com" || len(verified.Groups) != 1 {
+				t.Errorf("claims: %+v", verified)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenForgedSignature(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims(mock))
+	token.Header["kid"] = mockKeyID
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.verifyIDToken(idToken, testNonce)
+	if err == nil {
+		t.Error("ID token signed with another key was accepted")
+	}
+}
+
+// TestVerifyIDTokenKeyRotation checks that keys are fetched again when the identity provider rotates them.
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	mock, provider := newTestProvider(t)
+	oldToken, err := mock.signIDToken(validClaims(mock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.verifyIDToken(oldToken, testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.mutex.Lock()
+	mock.key = key
+	mock.keyID = "rotated"
+	mock.mutex.Unlock()
+	newToken, err := mock.signIDToken(validClaims(mock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.verifyIDToken(newToken, testNonce)
+	if err != nil {
+		t.Errorf("ID token signed with the rotated key: %v", err)
+	}
+	_, err = provider.verifyIDToken(oldToken, testNonce)
+	if err == nil {
+		t.Error("ID token signed with a key that isn't published anymore was accepted")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims(mock))
+	token.Header["kid"] = "unknown"
+	unknownToken, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.verifyIDToken(unknownToken, testNonce)
+	if err == nil {
+		t.Error("ID token with an unknown key ID was accepted")
+	}
+}
+
+// TestExchange logs in through the mock identity provider, as the login handlers do.
+func TestExchange(t *testing.T) {
+	_, provider := newTestProvider(t)
+	authURL, err := provider.AuthCodeURL("state", testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	redirect, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect.Query().Get("state") != "state" {
+		t.Errorf("state: got %s, want state", redirect.Query().Get("state"))
+	}
+	claims, err := provider.Exchange(redirect.Query().Get("code"), testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Email != "ucitelj@example.com" || !claims.EmailVerified {
+		t.Errorf("claims: %+v", claims)
+	}
+	_, err = provider.Exchange(redirect.Query().Get("code"), testNonce)
+	if err == nil {
+		t.Error("authorization code was exchanged twice")
+	}
+}
@@ -0,0 +1,180 @@
+package proton
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+)
+
+// Kinds of scheduling conflicts.
+const (
+	// ConflictTeacher is another meeting of the same teacher in the same hour
+	ConflictTeacher = "teacher"
+	// ConflictStudents is another meeting in the same hour, that some of the students also attend
+	ConflictStudents = "students"
+	// ConflictFreeDay is a meeting on one of the school's free days
+	ConflictFreeDay = "free_day"
+	// ConflictRoom is reserved for meetings in the same room, once meetings have rooms
+	ConflictRoom = "room"
+)
+
+// ErrConflicts is returned by SaveMeeting when the meeting has conflicts and wasn't saved.
+var ErrConflicts = errors.New("scheduling conflicts")
+
+// Conflict is a reason why a meeting can't take place at its date and hour.
+type Conflict struct {
+	Kind string   `json:"kind"`
+	Date sql.Date `json:"date"`
+	Hour int      `json:"hour"`
+	// The other meeting, 0 for free days
+	MeetingID   int    `json:"meeting_id"`
+	MeetingName string `json:"meeting_name"`
+	TeacherID   int    `json:"teacher_id"`
+	// Students attending both meetings
+	Students []int  `json:"students"`
+	Message  string `json:"message"`
+}
+
+// CheckConflicts returns the meeting's conflicts with free days and with other meetings in the same hour.
+// The meeting itself is skipped, so it can be checked before and after it's saved. An empty list means the
+// meeting can be saved.
+func (p *protonImpl) CheckConflicts(meeting sql.Meeting, freeDays []sql.Date) ([]Conflict, error) {
+	students := make(map[int][]int)
+	return p.checkConflicts(meeting, freeDays, students)
+}
+
+// SaveMeeting checks the meeting's conflicts and saves it in the same transaction, so a meeting saved
+// meanwhile can't slip past the check. The meeting is inserted when its ID is 0 and updated otherwise. Meetings
+// with conflicts are only saved when allow returns true, else SaveMeeting returns the conflicts with
+// ErrConflicts. db is the database the meeting is written through, usually the audited one of the request.
+func (p *protonImpl) SaveMeeting(db sql.SQL, meeting sql.Meeting, freeDays []sql.Date, allow func(conflicts []Conflict) bool) (id int, conflicts []Conflict, err error) {
+	err = db.WithMeetingsLocked(func(tx sql.SQL) error {
+		locked := &protonImpl{db: tx}
+		conflicts, err = locked.checkConflicts(meeting, freeDays, make(map[int][]int))
+		if err != nil {
+			return err
+		}
+		if len(conflicts) != 0 && !allow(conflicts) {
+			return ErrConflicts
+		}
+		if meeting.ID == 0 {
+			id, err = tx.InsertMeeting(meeting)
+			return err
+		}
+		id = meeting.ID
+		return tx.UpdateMeeting(meeting)
+	})
+	return id, conflicts, err
+}
+
+// CheckTemplateConflicts checks all meetings the template would have from the date on. Meetings of the
+// template itself never conflict with it.
+func (p *protonImpl) CheckTemplateConflicts(template sql.TimetableTemplate, from sql.Date, freeDays []sql.Date) ([]Conflict, error) {
+	conflicts := make([]Conflict, 0)
+	// Subject students are looked up once for all dates
+	students := make(map[int][]int)
+	dates := template.Dates(freeDays)
+	for i := 0; i < len(dates); i++ {
+		if dates[i].Before(from) {
+			continue
+		}
+		meeting := sql.Meeting{
+			MeetingName: template.MeetingName,
+			TeacherID:   template.TeacherID,
+			SubjectID:   template.SubjectID,
+			Hour:        template.Hour,
+			Date:        dates[i],
+			TemplateID:  template.ID,
+		}
+		c, err := p.checkConflicts(meeting, freeDays, students)
+		if err != nil {
+			return conflicts, err
+		}
+		conflicts = append(conflicts, c...)
+	}
+	return conflicts, nil
+}
+
+func (p *protonImpl) checkConflicts(meeting sql.Meeting, freeDays []sql.Date, students map[int][]int) ([]Conflict, error) {
+	conflicts := make([]Conflict, 0)
+	for i := 0; i < len(freeDays); i++ {
+		if freeDays[i].Equal(meeting.Date) {
+			conflicts = append(conflicts, Conflict{
+				Kind:     ConflictFreeDay,
+				Date:     meeting.Date,
+				Hour:     meeting.Hour,
+				Students: make([]int, 0),
+				Message:  fmt.Sprintf("%s is a school free day", meeting.Date),
+			})
+			break
+		}
+	}
+
+	others, err := p.db.GetMeetingsOnSpecificTime(meeting.Date, meeting.Hour)
+	if err != nil {
+		return conflicts, err
+	}
+	attending, err := p.subjectStudents(meeting.SubjectID, students)
+	if err != nil {
+		return conflicts, err
+	}
+	for i := 0; i < len(others); i++ {
+		other := others[i]
+		if other.ID == meeting.ID && meeting.ID != 0 {
+			continue
+		}
+		if other.TemplateID == meeting.TemplateID && meeting.TemplateID != 0 {
+			continue
+		}
+		conflict := Conflict{
+			Date:        meeting.Date,
+			Hour:        meeting.Hour,
+			MeetingID:   other.ID,
+			MeetingName: other.MeetingName,
+			TeacherID:   other.TeacherID,
+			Students:    make([]int, 0),
+		}
+		if other.TeacherID == meeting.TeacherID {
+			conflict.Kind = ConflictTeacher
+			conflict.Message = fmt.Sprintf("The teacher already has %s in hour %d on %s", other.MeetingName, meeting.Hour, meeting.Date)
+			conflicts = append(conflicts, conflict)
+		}
+		otherAttending, err := p.subjectStudents(other.SubjectID, students)
+		if err != nil {
+			return conflicts, err
+		}
+		for n := 0; n < len(attending); n++ {
+			if contains(otherAttending, attending[n]) {
+				conflict.Students = append(conflict.Students, attending[n])
+			}
+		}
+		if len(conflict.Students) != 0 {
+			conflict.Kind = ConflictStudents
+			conflict.Message = fmt.Sprintf("Students already have %s in hour %d on %s", other.MeetingName, meeting.Hour, meeting.Date)
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts, nil
+}
+
+// subjectStudents caches students of subjects, as meetings in the same hour often share them. Subjects that
+// don't exist have no students.
+func (p *protonImpl) subjectStudents(subjectId int, students map[int][]int) ([]int, error) {
+	if s, ok := students[subjectId]; ok {
+		return s, nil
+	}
+	subject, err := p.db.GetSubject(subjectId)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			students[subjectId] = make([]int, 0)
+			return students[subjectId], nil
+		}
+		return nil, err
+	}
+	s, err := p.db.GetSubjectStudents(subject)
+	if err != nil {
+		return nil, err
+	}
+	students[subjectId] = s
+	return s, nil
+}
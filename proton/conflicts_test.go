@@ -0,0 +1,225 @@
+package proton
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/MeetPlan/MeetPlanBackend/sql/fixtures"
+	"go.uber.org/zap"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// conflictSchool has two classes. Teacher A teaches in both, teachers B and C only in one of them.
+type conflictSchool struct {
+	db sql.SQL
+	// Subjects of teacher A in the first and the second class
+	a1 sql.Subject
+	a2 sql.Subject
+	// Subject of teacher B in the second class
+	b2 sql.Subject
+	// Subject of teacher C in the first class
+	c1 sql.Subject
+	// Meeting of a1 in hour 3 on date
+	booked sql.Meeting
+	date   sql.Date
+}
+
+func newConflictSchool(t *testing.T) conflictSchool {
+	db, err := fixtures.NewDatabase(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	school := conflictSchool{db: db, date: sql.NewDate(time.Date(2030, 9, 3, 0, 0, 0, 0, time.UTC))}
+	teachers := make([]sql.User, 0)
+	for i := 0; i < 3; i++ {
+		teacher, err := fixtures.NewUser(db, "teacher").Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		teachers = append(teachers, teacher)
+	}
+	classes := make([]sql.Class, 0)
+	for i := 0; i < 2; i++ {
+		class, err := fixtures.NewClass(db, teachers[i].ID).Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = fixtures.NewUser(db, "student").InClass(class.ID).Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		classes = append(classes, class)
+	}
+	subjects := make([]sql.Subject, 0)
+	for _, s := range []struct{ teacher, class int }{{0, 0}, {0, 1}, {1, 1}, {2, 0}} {
+		subject, err := fixtures.NewSubject(db, teachers[s.teacher].ID).ForClass(classes[s.class].ID).Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		subjects = append(subjects, subject)
+	}
+	school.a1, school.a2, school.b2, school.c1 = subjects[0], subjects[1], subjects[2], subjects[3]
+	school.booked, err = fixtures.NewMeeting(db, school.a1).At(school.date, 3).Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return school
+}
+
+func (school conflictSchool) meeting(subject sql.Subject, hour int) sql.Meeting {
+	return sql.Meeting{
+		MeetingName: subject.Name,
+		TeacherID:   subject.TeacherID,
+		SubjectID:   subject.ID,
+		Hour:        hour,
+		Date:        school.date,
+		IsMandatory: true,
+	}
+}
+
+func conflictKinds(conflicts []Conflict) []string {
+	kinds := make([]string, 0)
+	for i := 0; i < len(conflicts); i++ {
+		kinds = append(kinds, conflicts[i].Kind)
+	}
+	return kinds
+}
+
+func TestCheckConflicts(t *testing.T) {
+	school := newConflictSchool(t)
+	p := NewProton(school.db)
+	tests := []struct {
+		name     string
+		meeting  sql.Meeting
+		freeDays []sql.Date
+		kinds    []string
+	}{
+		{"teacher clash", school.meeting(school.a2, 3), nil, []string{ConflictTeacher}},
+		{"class clash", school.meeting(school.c1, 3), nil, []string{ConflictStudents}},
+		{"teacher and class clash", school.meeting(school.a1, 3), nil, []string{ConflictTeacher, ConflictStudents}},
+		{"another hour", school.meeting(school.a1, 4), nil, []string{}},
+		{"another teacher and class", school.meeting(school.b2, 3), nil, []string{}},
+		{"the meeting itself", school.booked, nil, []string{}},
+		{"free day", school.meeting(school.b2, 3), []sql.Date{school.date}, []string{ConflictFreeDay}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conflicts, err := p.CheckConflicts(test.meeting, test.freeDays)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kinds := conflictKinds(conflicts); !reflect.DeepEqual(kinds, test.kinds) {
+				t.Errorf("conflicts: got %v, want %v", kinds, test.kinds)
+			}
+			for i := 0; i < len(conflicts); i++ {
+				if conflicts[i].Kind != ConflictFreeDay && conflicts[i].MeetingID != school.booked.ID {
+					t.Errorf("conflict with meeting %d, want %d", conflicts[i].MeetingID, school.booked.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckConflictsRoom(t *testing.T) {
+	t.Skip("meetings don't have rooms yet, ConflictRoom is reserved for them")
+}
+
+func TestSaveMeeting(t *testing.T) {
+	school := newConflictSchool(t)
+	p := NewProton(school.db)
+	db := school.db.WithActor(sql.AuditActor{UserID: school.a1.TeacherID, Role: "teacher", Endpoint: "test"})
+	never := func(conflicts []Conflict) bool {
+		return false
+	}
+
+	_, conflicts, err := p.SaveMeeting(db, school.meeting(school.a2, 3), nil, never)
+	if err != ErrConflicts || len(conflicts) != 1 {
+		t.Fatalf("meeting with a conflict: got %v and %d conflicts, want ErrConflicts", err, len(conflicts))
+	}
+	meetings, err := school.db.GetMeetingsOnSpecificTime(school.date, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meetings) != 1 {
+		t.Errorf("meetings in the hour: got %d, want only the booked one", len(meetings))
+	}
+
+	id, _, err := p.SaveMeeting(db, school.meeting(school.a2, 4), nil, never)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := school.db.GetMeeting(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := school.db.GetAuditEntries(sql.AuditFilter{UserID: -1, EntityType: "meeting", EntityID: fmt.Sprint(id), Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != sql.AuditActionInsert {
+		t.Errorf("audit log of the saved meeting: got %d entries, want the insert", len(entries))
+	}
+
+	// Moving the saved meeting onto the booked one fails, unless the conflicts are allowed
+	saved.Hour = 3
+	_, _, err = p.SaveMeeting(db, saved, nil, never)
+	if err != ErrConflicts {
+		t.Errorf("moving onto a conflict: got %v, want ErrConflicts", err)
+	}
+	_, conflicts, err = p.SaveMeeting(db, saved, nil, func(conflicts []Conflict) bool {
+		return true
+	})
+	if err != nil || len(conflicts) != 1 {
+		t.Fatalf("moving with allowed conflicts: got %v and %d conflicts", err, len(conflicts))
+	}
+	moved, err := school.db.GetMeeting(saved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Hour != 3 {
+		t.Errorf("hour of the moved meeting: got %d, want 3", moved.Hour)
+	}
+}
+
+// TestSaveMeetingConcurrently books the same hour of the same teacher at once, only one of the meetings may win.
+func TestSaveMeetingConcurrently(t *testing.T) {
+	school := newConflictSchool(t)
+	p := NewProton(school.db)
+	db := school.db.WithActor(sql.AuditActor{UserID: school.a1.TeacherID, Role: "teacher", Endpoint: "test"})
+	never := func(conflicts []Conflict) bool {
+		return false
+	}
+
+	const requests = 10
+	errs := make([]error, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = p.SaveMeeting(db, school.meeting(school.a2, 5), nil, never)
+		}(i)
+	}
+	wg.Wait()
+
+	saved := 0
+	for i := 0; i < requests; i++ {
+		if errs[i] == nil {
+			saved++
+		} else if errs[i] != ErrConflicts {
+			t.Errorf("request %d: %s", i, errs[i].Error())
+		}
+	}
+	if saved != 1 {
+		t.Errorf("saved meetings: got %d, want 1", saved)
+	}
+	meetings, err := school.db.GetMeetingsOnSpecificTime(school.date, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meetings) != 1 {
+		t.Errorf("meetings in the hour: got %d, want 1", len(meetings))
+	}
+}
@@ -0,0 +1,310 @@
+package proton
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Defaults of GeneratorOptions.
+const (
+	// DefaultSchoolWeeks is the number of weeks of a Slovenian school year, Subject.Realization is divided by it
+	DefaultSchoolWeeks    = 35
+	DefaultMaxHoursPerDay = 7
+	DefaultIterations     = 50000
+	// MaxIterations keeps a single request from occupying the server for long
+	MaxIterations = 1000000
+)
+
+// SchoolDays are the weekdays the generator plans lessons on, Monday to Friday.
+var SchoolDays = []int{1, 2, 3, 4, 5}
+
+// Kinds of timetable violations, besides ConflictTeacher and ConflictStudents for lessons at the same time.
+const (
+	// ViolationUnavailable is a lesson in an hour the teacher isn't available in, a hard constraint
+	ViolationUnavailable = "unavailable"
+	// ViolationMaxHours is a day with more hours than GeneratorOptions.MaxHoursPerDay, a hard constraint
+	ViolationMaxHours = "max_hours"
+	// ViolationStudentGap are free hours between lessons of students, hard only with GeneratorOptions.NoGaps
+	ViolationStudentGap = "student_gap"
+	// ViolationTeacherGap are free hours between lessons of teachers, always soft
+	ViolationTeacherGap = "teacher_gap"
+	// ViolationSameDay is a subject taught more than once a day, double lessons count once, always soft
+	ViolationSameDay = "same_day"
+)
+
+// GeneratorOptions are the inputs and constraints of the timetable generator. Besides them, the generator never
+// plans two lessons of a teacher or of a student at the same time, nor a lesson in an hour its teacher isn't
+// available in. Published templates between FromDate and ToDate stay where they are.
+type GeneratorOptions struct {
+	// The same seed with the same data always gives the same timetable
+	Seed     int64    `json:"seed"`
+	FromDate sql.Date `json:"from_date"`
+	ToDate   sql.Date `json:"to_date"`
+	// Subjects to plan, all subjects when empty
+	SubjectIDs []int `json:"subject_ids"`
+	// Subjects get Realization/Weeks lessons a week, less the lessons they already have in published templates
+	Weeks     int `json:"weeks"`
+	FirstHour int `json:"first_hour"`
+	LastHour  int `json:"last_hour"`
+	// Students can't have more lessons a day
+	MaxHoursPerDay int `json:"max_hours_per_day"`
+	// NoGaps makes free hours between lessons of students a hard constraint, otherwise they're only avoided
+	NoGaps bool `json:"no_gaps"`
+	// Lessons of these subjects are paired into double lessons, an odd lesson stays single
+	DoubleLessons []int `json:"double_lessons"`
+	// Iterations of the optimization after the lessons are placed
+	Iterations int `json:"iterations"`
+}
+
+// DraftOptions returns the constraints the draft was generated with.
+func DraftOptions(draft sql.TimetableDraft) GeneratorOptions {
+	return GeneratorOptions{
+		Seed:           draft.Seed,
+		FromDate:       draft.FromDate,
+		ToDate:         draft.ToDate,
+		SubjectIDs:     make([]int, 0),
+		FirstHour:      draft.FirstHour,
+		LastHour:       draft.LastHour,
+		MaxHoursPerDay: draft.MaxHoursPerDay,
+		NoGaps:         draft.NoGaps,
+		DoubleLessons:  make([]int, 0),
+	}
+}
+
+// Draft returns the draft the timetable is saved as.
+func (options GeneratorOptions) Draft() sql.TimetableDraft {
+	return sql.TimetableDraft{
+		Seed:           options.Seed,
+		FromDate:       options.FromDate,
+		ToDate:         options.ToDate,
+		FirstHour:      options.FirstHour,
+		LastHour:       options.LastHour,
+		MaxHoursPerDay: options.MaxHoursPerDay,
+		NoGaps:         options.NoGaps,
+	}
+}
+
+func (options GeneratorOptions) Validate() error {
+	if options.Weeks < 1 {
+		return errors.New("school year needs at least 1 week")
+	}
+	if options.Iterations < 0 || options.Iterations > MaxIterations {
+		return fmt.Errorf("iterations have to be between 0 and %d", MaxIterations)
+	}
+	return options.Draft().Validate()
+}
+
+// Violation is a broken constraint of a timetable. The same violation of several teachers or students is listed
+// once, with all of them in Users.
+type Violation struct {
+	Kind    string `json:"kind"`
+	Hard    bool   `json:"hard"`
+	Weekday int    `json:"weekday"`
+	// -1 when the violation concerns the whole day
+	Hour      int   `json:"hour"`
+	SubjectID int   `json:"subject_id"`
+	Users     []int `json:"users"`
+	// Lessons at the same time, hours in a day, free hours or lessons of the subject, depending on the kind
+	Count   int    `json:"count"`
+	Message string `json:"message"`
+}
+
+// Timetable is a weekly timetable with the constraints it breaks. Penalty sums up the soft constraints, lower
+// is better.
+type Timetable struct {
+	Options        GeneratorOptions           `json:"options"`
+	Lessons        []sql.TimetableDraftLesson `json:"lessons"`
+	HardViolations int                        `json:"hard_violations"`
+	Penalty        int                        `json:"penalty"`
+	Violations     []Violation                `json:"violations"`
+}
+
+// Generate plans a weekly timetable. Lessons are first placed one by one, each where it breaks the fewest
+// constraints, and then improved with simulated annealing. Random choices only come from the seed, so the
+// generator runs offline and gives the same timetable for the same seed and data.
+//
+// The timetable always has all lessons, even when some constraints can't be met. Those are listed among
+// its violations, so they can be fixed before the timetable is published.
+func (p *protonImpl) Generate(options GeneratorOptions) (Timetable, error) {
+	err := options.Validate()
+	if err != nil {
+		return Timetable{}, err
+	}
+	subjects, err := p.db.GetAllSubjects()
+	if err != nil {
+		return Timetable{}, err
+	}
+	sort.SliceStable(subjects, func(i, j int) bool {
+		return subjects[i].ID < subjects[j].ID
+	})
+	templates, err := p.publishedTemplates(options)
+	if err != nil {
+		return Timetable{}, err
+	}
+	published := make(map[int]int)
+	for i := 0; i < len(templates); i++ {
+		published[templates[i].SubjectID]++
+	}
+
+	problem := newProblem(options, SchoolDays)
+	students := make(map[int][]int)
+	for i := 0; i < len(subjects); i++ {
+		subject := subjects[i]
+		if len(options.SubjectIDs) != 0 && !contains(options.SubjectIDs, subject.ID) {
+			continue
+		}
+		hours := int(math.Round(float64(subject.Realization)/float64(options.Weeks))) - published[subject.ID]
+		if hours <= 0 {
+			continue
+		}
+		attending, err := p.subjectStudents(subject.ID, students)
+		if err != nil {
+			return Timetable{}, err
+		}
+		c := problem.addCourse(subject, subject.TeacherID, meetingName(subject), attending)
+		doubles := 0
+		if contains(options.DoubleLessons, subject.ID) && options.LastHour > options.FirstHour {
+			doubles = hours / 2
+		}
+		for n := 0; n < doubles; n++ {
+			problem.blocks = append(problem.blocks, block{course: c, length: 2, day: -1})
+		}
+		for n := 0; n < hours-2*doubles; n++ {
+			problem.blocks = append(problem.blocks, block{course: c, length: 1, day: -1})
+		}
+	}
+	problem.prepare()
+	err = p.constrain(problem, templates, students)
+	if err != nil {
+		return Timetable{}, err
+	}
+
+	rng := rand.New(rand.NewSource(options.Seed))
+	problem.placeGreedily(rng)
+	problem.anneal(rng)
+	return problem.report(), nil
+}
+
+// Evaluate lists the violations of the lessons, for example of a draft that is being reviewed. Consecutive
+// lessons of a subject are evaluated as a single double lesson.
+func (p *protonImpl) Evaluate(options GeneratorOptions, lessons []sql.TimetableDraftLesson) (Timetable, error) {
+	sorted := make([]sql.TimetableDraftLesson, len(lessons))
+	copy(sorted, lessons)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].SubjectID != sorted[j].SubjectID {
+			return sorted[i].SubjectID < sorted[j].SubjectID
+		}
+		if sorted[i].Weekday != sorted[j].Weekday {
+			return sorted[i].Weekday < sorted[j].Weekday
+		}
+		return sorted[i].Hour < sorted[j].Hour
+	})
+	days := make([]int, len(SchoolDays))
+	copy(days, SchoolDays)
+	for i := 0; i < len(sorted); i++ {
+		if !contains(days, sorted[i].Weekday) {
+			days = append(days, sorted[i].Weekday)
+		}
+	}
+	sort.Ints(days)
+	templates, err := p.publishedTemplates(options)
+	if err != nil {
+		return Timetable{}, err
+	}
+
+	problem := newProblem(options, days)
+	students := make(map[int][]int)
+	courses := make(map[int]int)
+	for i := 0; i < len(sorted); i++ {
+		lesson := sorted[i]
+		c, ok := courses[lesson.SubjectID]
+		if !ok {
+			attending, err := p.subjectStudents(lesson.SubjectID, students)
+			if err != nil {
+				return Timetable{}, err
+			}
+			c = problem.addCourse(sql.Subject{ID: lesson.SubjectID}, lesson.TeacherID, lesson.MeetingName, attending)
+			courses[lesson.SubjectID] = c
+		}
+		day := problem.dayIndex(lesson.Weekday)
+		if n := len(problem.blocks) - 1; n >= 0 && problem.blocks[n].course == c && problem.blocks[n].day == day &&
+			problem.blocks[n].hour+problem.blocks[n].length == lesson.Hour {
+			problem.blocks[n].length++
+			continue
+		}
+		problem.blocks = append(problem.blocks, block{course: c, length: 1, day: day, hour: lesson.Hour})
+	}
+	problem.prepare()
+	for i := 0; i < len(problem.blocks); i++ {
+		problem.place(i, 1)
+	}
+	err = p.constrain(problem, templates, students)
+	if err != nil {
+		return Timetable{}, err
+	}
+	timetable := problem.report()
+	timetable.Lessons = lessons
+	return timetable, nil
+}
+
+// publishedTemplates returns the templates with lessons between the options' dates.
+func (p *protonImpl) publishedTemplates(options GeneratorOptions) ([]sql.TimetableTemplate, error) {
+	templates, err := p.db.GetTimetableTemplates()
+	if err != nil {
+		return nil, err
+	}
+	overlapping := make([]sql.TimetableTemplate, 0)
+	for i := 0; i < len(templates); i++ {
+		if templates[i].ToDate.Before(options.FromDate) || templates[i].FromDate.After(options.ToDate) {
+			continue
+		}
+		overlapping = append(overlapping, templates[i])
+	}
+	return overlapping, nil
+}
+
+// constrain marks the hours of published templates and the hours teachers aren't available in.
+func (p *protonImpl) constrain(problem *problem, templates []sql.TimetableTemplate, students map[int][]int) error {
+	for i := 0; i < len(templates); i++ {
+		template := templates[i]
+		day := problem.dayIndex(template.Weekday)
+		if day == -1 {
+			continue
+		}
+		attending, err := p.subjectStudents(template.SubjectID, students)
+		if err != nil {
+			return err
+		}
+		users := append([]int{template.TeacherID}, attending...)
+		for n := 0; n < len(users); n++ {
+			m, ok := problem.memberIndex[users[n]]
+			if ok {
+				problem.fixed[problem.slot(m, day, template.Hour)]++
+			}
+		}
+	}
+	hours, err := p.db.GetUnavailableHours()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(hours); i++ {
+		m, ok := problem.memberIndex[hours[i].TeacherID]
+		day := problem.dayIndex(hours[i].Weekday)
+		if ok && day != -1 {
+			problem.unavailable[problem.slot(m, day, hours[i].Hour)] = true
+		}
+	}
+	return nil
+}
+
+// meetingName names meetings of the subject with its long name, when it has one.
+func meetingName(subject sql.Subject) string {
+	if subject.LongName != "" {
+		return subject.LongName
+	}
+	return subject.Name
+}
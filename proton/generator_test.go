@@ -0,0 +1,160 @@
+package proton
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/MeetPlan/MeetPlanBackend/sql/fixtures"
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// generatorSchool has two classes sharing their teachers, so the generator has to keep the teachers from being
+// in both classes at once. Subjects get Realization/DefaultSchoolWeeks lessons a week.
+type generatorSchool struct {
+	db       sql.SQL
+	subjects []sql.Subject
+	// Lessons a week of the subjects
+	hours map[int]int
+	// Class of each subject
+	classes map[int]int
+}
+
+func newGeneratorSchool(t *testing.T) generatorSchool {
+	db, err := fixtures.NewDatabase(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	school := generatorSchool{db: db, hours: make(map[int]int), classes: make(map[int]int)}
+	teachers := make([]sql.User, 0)
+	for i := 0; i < 3; i++ {
+		teacher, err := fixtures.NewUser(db, "teacher").Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		teachers = append(teachers, teacher)
+	}
+	weekly := [][]int{{4, 4, 3}, {4, 3, 2}}
+	for c := 0; c < len(weekly); c++ {
+		class, err := fixtures.NewClass(db, teachers[c].ID).Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			_, err = fixtures.NewUser(db, "student").InClass(class.ID).Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		for s := 0; s < len(weekly[c]); s++ {
+			subject, err := fixtures.NewSubject(db, teachers[s].ID).
+				Name(fmt.Sprintf("P%d-%d", c, s), fmt.Sprintf("Predmet %d", s)).
+				ForClass(class.ID).
+				Realization(float32(weekly[c][s] * DefaultSchoolWeeks)).
+				Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+			school.subjects = append(school.subjects, subject)
+			school.hours[subject.ID] = weekly[c][s]
+			school.classes[subject.ID] = class.ID
+		}
+	}
+	return school
+}
+
+func (school generatorSchool) options(seed int64) GeneratorOptions {
+	return GeneratorOptions{
+		Seed:           seed,
+		FromDate:       sql.NewDate(time.Date(2030, 9, 2, 0, 0, 0, 0, time.UTC)),
+		ToDate:         sql.NewDate(time.Date(2031, 6, 20, 0, 0, 0, 0, time.UTC)),
+		Weeks:          DefaultSchoolWeeks,
+		FirstHour:      1,
+		LastHour:       7,
+		MaxHoursPerDay: 7,
+		DoubleLessons:  []int{school.subjects[0].ID},
+		Iterations:     5000,
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	school := newGeneratorSchool(t)
+	p := NewProton(school.db)
+	first, err := p.Generate(school.options(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.Generate(school.options(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("timetables of the same seed differ:\n%+v\n%+v", first, second)
+	}
+}
+
+// TestGenerateDoesNotDoubleBook checks the generated lessons themselves instead of trusting the violations the
+// generator reports. Meetings have no rooms yet, so rooms can't be double-booked.
+func TestGenerateDoesNotDoubleBook(t *testing.T) {
+	school := newGeneratorSchool(t)
+	p := NewProton(school.db)
+	for _, seed := range []int64{1, 2, 3} {
+		timetable, err := p.Generate(school.options(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timetable.HardViolations != 0 {
+			t.Errorf("seed %d: %d hard violations: %+v", seed, timetable.HardViolations, timetable.Violations)
+		}
+		teachers := make(map[string]int)
+		classes := make(map[string]int)
+		lessons := make(map[int]int)
+		for _, lesson := range timetable.Lessons {
+			if lesson.Hour < 1 || lesson.Hour > 7 {
+				t.Errorf("seed %d: lesson in hour %d", seed, lesson.Hour)
+			}
+			lessons[lesson.SubjectID]++
+			teachers[fmt.Sprintf("%d-%d-%d", lesson.TeacherID, lesson.Weekday, lesson.Hour)]++
+			classes[fmt.Sprintf("%d-%d-%d", school.classes[lesson.SubjectID], lesson.Weekday, lesson.Hour)]++
+		}
+		for key, n := range teachers {
+			if n > 1 {
+				t.Errorf("seed %d: teacher, weekday and hour %s have %d lessons", seed, key, n)
+			}
+		}
+		for key, n := range classes {
+			if n > 1 {
+				t.Errorf("seed %d: class, weekday and hour %s have %d lessons", seed, key, n)
+			}
+		}
+		if !reflect.DeepEqual(lessons, school.hours) {
+			t.Errorf("seed %d: lessons of subjects: got %v, want %v", seed, lessons, school.hours)
+		}
+	}
+}
+
+// TestEvaluateReportsDoubleBooking evaluates lessons of both classes' first subjects, taught by the same
+// teacher, in the same hour.
+func TestEvaluateReportsDoubleBooking(t *testing.T) {
+	school := newGeneratorSchool(t)
+	p := NewProton(school.db)
+	first, second := school.subjects[0], school.subjects[3]
+	timetable, err := p.Evaluate(school.options(1), []sql.TimetableDraftLesson{
+		{SubjectID: first.ID, TeacherID: first.TeacherID, MeetingName: first.LongName, Weekday: 1, Hour: 1},
+		{SubjectID: second.ID, TeacherID: second.TeacherID, MeetingName: second.LongName, Weekday: 1, Hour: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, violation := range timetable.Violations {
+		if violation.Kind == ConflictTeacher && violation.Weekday == 1 && violation.Hour == 1 &&
+			reflect.DeepEqual(violation.Users, []int{first.TeacherID}) {
+			found = true
+		}
+	}
+	if !found || timetable.HardViolations != 1 {
+		t.Errorf("double-booked teacher wasn't reported: %+v", timetable.Violations)
+	}
+}
@@ -16,6 +16,11 @@ type protonImpl struct {
 
 type Proton interface {
 	ManageAbsences(meetingId int) ([]TeacherTier, error)
+	CheckConflicts(meeting sql.Meeting, freeDays []sql.Date) ([]Conflict, error)
+	SaveMeeting(db sql.SQL, meeting sql.Meeting, freeDays []sql.Date, allow func(conflicts []Conflict) bool) (id int, conflicts []Conflict, err error)
+	CheckTemplateConflicts(template sql.TimetableTemplate, from sql.Date, freeDays []sql.Date) ([]Conflict, error)
+	Generate(options GeneratorOptions) (Timetable, error)
+	Evaluate(options GeneratorOptions, lessons []sql.TimetableDraftLesson) (Timetable, error)
 }
 
 func NewProton(db sql.SQL) Proton {
@@ -0,0 +1,466 @@
+package proton
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Weights of the penalties the solver minimizes. Breaking a hard constraint costs more than all soft
+// penalties of a day together, so the solver never trades a hard constraint for soft ones.
+const (
+	hardWeight       = 1000
+	studentGapWeight = 10
+	teacherGapWeight = 1
+	sameDayWeight    = 5
+)
+
+// Temperatures of simulated annealing, in the units of penalties. Early on the solver accepts moves that make
+// the timetable worse by a few soft penalties, so it doesn't get stuck, and it ends up only improving it.
+const (
+	startTemperature = 20.0
+	endTemperature   = 0.05
+)
+
+// member is a teacher or a student whose timetable is checked.
+type member struct {
+	userID    int
+	isStudent bool
+}
+
+// course is a subject with everyone attending it.
+type course struct {
+	subject sql.Subject
+	teacher int
+	name    string
+	// Indexes of the teacher and the students in problem.members
+	members []int
+}
+
+// block is one or more lessons of a course in consecutive hours, such as a double lesson.
+type block struct {
+	course int
+	length int
+	// Index into problem.days, -1 while the block isn't placed
+	day  int
+	hour int
+}
+
+// problem is the state of the solver. Occupancy of every member's hours is kept up to date as blocks move,
+// so a move only needs to recalculate the days of the members it touches.
+type problem struct {
+	options GeneratorOptions
+	days    []int
+	members []member
+	// User IDs to indexes into members
+	memberIndex map[int]int
+	courses     []course
+	blocks      []block
+
+	// Indexed by member, day and hour, see slot
+	occupied    []int
+	fixed       []int
+	unavailable []bool
+	// Blocks of a course on a day, indexed by course and day
+	courseDays []int
+
+	// seen marks members already counted by localCost
+	seen  []int
+	stamp int
+}
+
+func newProblem(options GeneratorOptions, days []int) *problem {
+	return &problem{
+		options:     options,
+		days:        days,
+		members:     make([]member, 0),
+		memberIndex: make(map[int]int),
+		courses:     make([]course, 0),
+		blocks:      make([]block, 0),
+	}
+}
+
+func (p *problem) member(userId int, isStudent bool) int {
+	if i, ok := p.memberIndex[userId]; ok {
+		return i
+	}
+	p.members = append(p.members, member{userID: userId, isStudent: isStudent})
+	p.memberIndex[userId] = len(p.members) - 1
+	return len(p.members) - 1
+}
+
+func (p *problem) addCourse(subject sql.Subject, teacherId int, name string, students []int) int {
+	c := course{subject: subject, teacher: teacherId, name: name, members: []int{p.member(teacherId, false)}}
+	for i := 0; i < len(students); i++ {
+		m := p.member(students[i], true)
+		if !contains(c.members, m) {
+			c.members = append(c.members, m)
+		}
+	}
+	p.courses = append(p.courses, c)
+	return len(p.courses) - 1
+}
+
+// prepare allocates the occupancy once all members and courses are known.
+func (p *problem) prepare() {
+	size := len(p.members) * len(p.days) * sql.TimetableHours
+	p.occupied = make([]int, size)
+	p.fixed = make([]int, size)
+	p.unavailable = make([]bool, size)
+	p.courseDays = make([]int, len(p.courses)*len(p.days))
+	p.seen = make([]int, len(p.members))
+}
+
+func (p *problem) slot(m int, day int, hour int) int {
+	return (m*len(p.days)+day)*sql.TimetableHours + hour
+}
+
+// dayIndex returns the index of the weekday in p.days, -1 when lessons aren't planned on it.
+func (p *problem) dayIndex(weekday int) int {
+	for i := 0; i < len(p.days); i++ {
+		if p.days[i] == weekday {
+			return i
+		}
+	}
+	return -1
+}
+
+// place adds (change 1) or removes (change -1) the block at its day and hour.
+func (p *problem) place(b int, change int) {
+	bl := p.blocks[b]
+	if bl.day == -1 {
+		return
+	}
+	c := p.courses[bl.course]
+	for i := 0; i < len(c.members); i++ {
+		for h := bl.hour; h < bl.hour+bl.length; h++ {
+			p.occupied[p.slot(c.members[i], bl.day, h)] += change
+		}
+	}
+	p.courseDays[bl.course*len(p.days)+bl.day] += change
+}
+
+func (p *problem) moveBlock(b int, day int, hour int) {
+	p.place(b, -1)
+	p.blocks[b].day = day
+	p.blocks[b].hour = hour
+	p.place(b, 1)
+}
+
+// dayCost is the penalty of the member's timetable on the day.
+func (p *problem) dayCost(m int, day int) int {
+	cost, used, first, last := 0, 0, -1, -1
+	for h := 0; h < sql.TimetableHours; h++ {
+		i := p.slot(m, day, h)
+		n := p.occupied[i] + p.fixed[i]
+		if n == 0 {
+			continue
+		}
+		used++
+		if first == -1 {
+			first = h
+		}
+		last = h
+		if n > 1 {
+			cost += hardWeight * (n - 1)
+		}
+		if p.unavailable[i] {
+			cost += hardWeight * p.occupied[i]
+		}
+	}
+	if used == 0 {
+		return cost
+	}
+	gaps := last - first + 1 - used
+	if !p.members[m].isStudent {
+		return cost + teacherGapWeight*gaps
+	}
+	if used > p.options.MaxHoursPerDay {
+		cost += hardWeight * (used - p.options.MaxHoursPerDay)
+	}
+	if p.options.NoGaps {
+		return cost + hardWeight*gaps
+	}
+	return cost + studentGapWeight*gaps
+}
+
+func (p *problem) courseDayCost(c int, day int) int {
+	n := p.courseDays[c*len(p.days)+day]
+	if n > 1 {
+		return sameDayWeight * (n - 1)
+	}
+	return 0
+}
+
+// localCost is the penalty of the courses' members and the courses themselves on the days. Moves only change
+// these, so the difference of localCost before and after a move is the difference of the total cost.
+func (p *problem) localCost(courses []int, days []int) int {
+	p.stamp++
+	cost := 0
+	for i := 0; i < len(courses); i++ {
+		c := p.courses[courses[i]]
+		for n := 0; n < len(c.members); n++ {
+			m := c.members[n]
+			if p.seen[m] == p.stamp {
+				continue
+			}
+			p.seen[m] = p.stamp
+			for d := 0; d < len(days); d++ {
+				cost += p.dayCost(m, days[d])
+			}
+		}
+		for d := 0; d < len(days); d++ {
+			cost += p.courseDayCost(courses[i], days[d])
+		}
+	}
+	return cost
+}
+
+func (p *problem) totalCost() int {
+	cost := 0
+	for m := 0; m < len(p.members); m++ {
+		for d := 0; d < len(p.days); d++ {
+			cost += p.dayCost(m, d)
+		}
+	}
+	for c := 0; c < len(p.courses); c++ {
+		for d := 0; d < len(p.days); d++ {
+			cost += p.courseDayCost(c, d)
+		}
+	}
+	return cost
+}
+
+// distinct returns the distinct days, localCost must not count a day twice.
+func distinct(a int, b int) []int {
+	if a == b {
+		return []int{a}
+	}
+	return []int{a, b}
+}
+
+// lastStart is the last hour a block of the length can start in.
+func (p *problem) lastStart(length int) int {
+	return p.options.LastHour - length + 1
+}
+
+// placeGreedily places the blocks one by one where they add the least penalty, starting with the ones that
+// are hardest to place. Equally good places are picked at random.
+func (p *problem) placeGreedily(rng *rand.Rand) {
+	order := make([]int, len(p.blocks))
+	for i := 0; i < len(order); i++ {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := p.blocks[order[i]], p.blocks[order[j]]
+		if a.length != b.length {
+			return a.length > b.length
+		}
+		return len(p.courses[a.course].members) > len(p.courses[b.course].members)
+	})
+	for _, b := range order {
+		c := []int{p.blocks[b].course}
+		best := math.MaxInt32
+		candidates := make([][2]int, 0)
+		for d := 0; d < len(p.days); d++ {
+			for h := p.options.FirstHour; h <= p.lastStart(p.blocks[b].length); h++ {
+				before := p.localCost(c, []int{d})
+				p.moveBlock(b, d, h)
+				delta := p.localCost(c, []int{d}) - before
+				p.moveBlock(b, -1, 0)
+				if delta < best {
+					best = delta
+					candidates = candidates[:0]
+				}
+				if delta == best {
+					candidates = append(candidates, [2]int{d, h})
+				}
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		pick := candidates[rng.Intn(len(candidates))]
+		p.moveBlock(b, pick[0], pick[1])
+	}
+}
+
+// anneal improves the timetable with simulated annealing. Every iteration either moves a random block to a
+// random place or swaps two blocks of the same length. The best timetable found is kept.
+func (p *problem) anneal(rng *rand.Rand) {
+	if len(p.blocks) == 0 || p.options.Iterations <= 0 {
+		return
+	}
+	cost := p.totalCost()
+	bestCost := cost
+	best := make([]block, len(p.blocks))
+	copy(best, p.blocks)
+	for it := 0; it < p.options.Iterations && bestCost > 0; it++ {
+		temperature := startTemperature * math.Pow(endTemperature/startTemperature, float64(it)/float64(p.options.Iterations))
+		b := rng.Intn(len(p.blocks))
+		original := p.blocks[b]
+		other := rng.Intn(len(p.blocks))
+		swap := rng.Intn(2) == 0 && other != b && p.blocks[other].length == original.length &&
+			p.blocks[other].course != original.course
+		var courses, days []int
+		var delta int
+		if swap {
+			second := p.blocks[other]
+			courses = []int{original.course, second.course}
+			days = distinct(original.day, second.day)
+			before := p.localCost(courses, days)
+			p.moveBlock(b, second.day, second.hour)
+			p.moveBlock(other, original.day, original.hour)
+			delta = p.localCost(courses, days) - before
+		} else {
+			day := rng.Intn(len(p.days))
+			hour := p.options.FirstHour + rng.Intn(p.lastStart(original.length)-p.options.FirstHour+1)
+			if day == original.day && hour == original.hour {
+				continue
+			}
+			courses = []int{original.course}
+			days = distinct(original.day, day)
+			before := p.localCost(courses, days)
+			p.moveBlock(b, day, hour)
+			delta = p.localCost(courses, days) - before
+		}
+		if delta <= 0 || rng.Float64() < math.Exp(-float64(delta)/temperature) {
+			cost += delta
+			if cost < bestCost {
+				bestCost = cost
+				copy(best, p.blocks)
+			}
+			continue
+		}
+		if swap {
+			second := p.blocks[b]
+			p.moveBlock(other, second.day, second.hour)
+		}
+		p.moveBlock(b, original.day, original.hour)
+	}
+	for i := 0; i < len(p.blocks); i++ {
+		p.moveBlock(i, best[i].day, best[i].hour)
+	}
+}
+
+// lessons returns the placed blocks as lessons, ordered by weekday and hour.
+func (p *problem) lessons() []sql.TimetableDraftLesson {
+	lessons := make([]sql.TimetableDraftLesson, 0)
+	for i := 0; i < len(p.blocks); i++ {
+		bl := p.blocks[i]
+		if bl.day == -1 {
+			continue
+		}
+		c := p.courses[bl.course]
+		for h := bl.hour; h < bl.hour+bl.length; h++ {
+			lessons = append(lessons, sql.TimetableDraftLesson{
+				SubjectID:   c.subject.ID,
+				TeacherID:   c.teacher,
+				MeetingName: c.name,
+				Weekday:     p.days[bl.day],
+				Hour:        h,
+			})
+		}
+	}
+	sort.SliceStable(lessons, func(i, j int) bool {
+		if lessons[i].Weekday != lessons[j].Weekday {
+			return lessons[i].Weekday < lessons[j].Weekday
+		}
+		if lessons[i].Hour != lessons[j].Hour {
+			return lessons[i].Hour < lessons[j].Hour
+		}
+		return lessons[i].SubjectID < lessons[j].SubjectID
+	})
+	return lessons
+}
+
+// report lists the timetable's violations. Members with the same violation are listed together.
+func (p *problem) report() Timetable {
+	timetable := Timetable{Options: p.options, Lessons: p.lessons(), Violations: make([]Violation, 0)}
+	index := make(map[string]int)
+	add := func(v Violation, userId int) {
+		key := fmt.Sprintf("%s-%d-%d-%d-%d", v.Kind, v.Weekday, v.Hour, v.SubjectID, v.Count)
+		if i, ok := index[key]; ok {
+			if userId != 0 {
+				timetable.Violations[i].Users = append(timetable.Violations[i].Users, userId)
+			}
+			return
+		}
+		v.Users = make([]int, 0)
+		if userId != 0 {
+			v.Users = append(v.Users, userId)
+		}
+		index[key] = len(timetable.Violations)
+		timetable.Violations = append(timetable.Violations, v)
+		if v.Hard {
+			timetable.HardViolations++
+		}
+	}
+	for m := 0; m < len(p.members); m++ {
+		member := p.members[m]
+		for d := 0; d < len(p.days); d++ {
+			weekday := p.days[d]
+			used, first, last := 0, -1, -1
+			for h := 0; h < sql.TimetableHours; h++ {
+				i := p.slot(m, d, h)
+				n := p.occupied[i] + p.fixed[i]
+				if n == 0 {
+					continue
+				}
+				used++
+				if first == -1 {
+					first = h
+				}
+				last = h
+				if n > 1 {
+					kind := ConflictTeacher
+					if member.isStudent {
+						kind = ConflictStudents
+					}
+					add(Violation{Kind: kind, Hard: true, Weekday: weekday, Hour: h, Count: n,
+						Message: fmt.Sprintf("%d lessons at the same time", n)}, member.userID)
+				}
+				if p.unavailable[i] && p.occupied[i] != 0 {
+					add(Violation{Kind: ViolationUnavailable, Hard: true, Weekday: weekday, Hour: h, Count: p.occupied[i],
+						Message: "The teacher isn't available in this hour"}, member.userID)
+				}
+			}
+			if used == 0 {
+				continue
+			}
+			gaps := last - first + 1 - used
+			if !member.isStudent {
+				timetable.Penalty += teacherGapWeight * gaps
+				if gaps != 0 {
+					add(Violation{Kind: ViolationTeacherGap, Weekday: weekday, Hour: -1, Count: gaps,
+						Message: "Free hours between lessons of the teacher"}, member.userID)
+				}
+				continue
+			}
+			if used > p.options.MaxHoursPerDay {
+				add(Violation{Kind: ViolationMaxHours, Hard: true, Weekday: weekday, Hour: -1, Count: used,
+					Message: fmt.Sprintf("%d hours in a day, at most %d are allowed", used, p.options.MaxHoursPerDay)}, member.userID)
+			}
+			if !p.options.NoGaps {
+				timetable.Penalty += studentGapWeight * gaps
+			}
+			if gaps != 0 {
+				add(Violation{Kind: ViolationStudentGap, Hard: p.options.NoGaps, Weekday: weekday, Hour: -1, Count: gaps,
+					Message: "Free hours between lessons of students"}, member.userID)
+			}
+		}
+	}
+	for c := 0; c < len(p.courses); c++ {
+		for d := 0; d < len(p.days); d++ {
+			n := p.courseDays[c*len(p.days)+d]
+			if n > 1 {
+				timetable.Penalty += p.courseDayCost(c, d)
+				add(Violation{Kind: ViolationSameDay, Weekday: p.days[d], Hour: -1, SubjectID: p.courses[c].subject.ID, Count: n,
+					Message: fmt.Sprintf("%s is taught %d times on the same day", p.courses[c].name, n)}, 0)
+			}
+		}
+	}
+	return timetable
+}
@@ -9,19 +9,6 @@ type Absence struct {
 	IsExcused   bool   `db:"is_excused"`
 }
 
-func (db *sqlImpl) GetLastAbsenceID() int {
-	var id int
-	err := db.db.Get(&id, "SELECT id FROM absence WHERE id = (SELECT MAX(id) FROM absence)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
 func (db *sqlImpl) GetAbsence(id int) (absence Absence, err error) {
 	err = db.db.Get(&absence, "SELECT * FROM absence WHERE id=$1", id)
 	return absence, err
@@ -42,11 +29,10 @@ func (db *sqlImpl) GetAllAbsences(id int) (absences []Absence, err error) {
 	return absences, err
 }
 
-func (db *sqlImpl) InsertAbsence(absence Absence) error {
-	_, err := db.db.NamedExec(
-		"INSERT INTO absence (id, user_id, teacher_id, meeting_id, absence_type, is_excused) VALUES (:id, :user_id, :teacher_id, :meeting_id, :absence_type, :is_excused)",
+func (db *sqlImpl) InsertAbsence(absence Absence) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO absence (user_id, teacher_id, meeting_id, absence_type, is_excused) VALUES (:user_id, :teacher_id, :meeting_id, :absence_type, :is_excused)",
 		absence)
-	return err
 }
 
 func (db *sqlImpl) UpdateAbsence(absence Absence) error {
@@ -0,0 +1,1423 @@
+package sql
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"hash"
+	"strings"
+	"time"
+)
+
+const (
+	AuditActionInsert = "insert"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	// AuditActionRedact entries list the entries personal data of a deleted user was removed from
+	AuditActionRedact = "redact"
+)
+
+// AuditActor is the user on whose behalf writes are made.
+type AuditActor struct {
+	UserID int
+	Role   string
+	// Method and route template of the request, such as "PATCH /grades/get/{id}"
+	Endpoint string
+}
+
+// AuditEntry is a single write in the audit log. Every entry contains the hash of the previous one,
+// so changing or removing an entry breaks the chain after it (see VerifyAuditLog). Hashes are keyed with
+// a secret kept outside the database (see SetAuditKey), so the chain can't be computed again by someone
+// who can only change the database.
+type AuditEntry struct {
+	ID         int    `json:"id"`
+	CreatedAt  int64  `db:"created_at" json:"created_at"`
+	UserID     int    `db:"user_id" json:"user_id"`
+	Role       string `json:"role"`
+	Endpoint   string `json:"endpoint"`
+	EntityType string `db:"entity_type" json:"entity_type"`
+	EntityID   string `db:"entity_id" json:"entity_id"`
+	Action     string `json:"action"`
+	Before     string `db:"before_data" json:"before"`
+	After      string `db:"after_data" json:"after"`
+	PrevHash   string `db:"prev_hash" json:"prev_hash"`
+	Hash       string `json:"hash"`
+}
+
+type AuditFilter struct {
+	UserID     int
+	EntityType string
+	EntityID   string
+	Endpoint   string
+	From       int64
+	To         int64
+	Limit      int
+	Offset     int
+}
+
+type AuditVerification struct {
+	Valid   bool `json:"valid"`
+	Entries int  `json:"entries"`
+	// ID of the first entry that doesn't match the chain, -1 when the chain is valid
+	BrokenAt int `json:"broken_at"`
+}
+
+// computeHash returns the HMAC-SHA256 of the entry. Audit logs written before the key was introduced were
+// hashed with plain SHA-256, which is what a nil key gives, see RekeyAuditLog.
+func (entry AuditEntry) computeHash(key []byte) string {
+	// Fields are JSON encoded, so values containing separators can't be used to forge another entry
+	marshal, _ := json.Marshal([]interface{}{
+		entry.PrevHash,
+		entry.ID,
+		entry.CreatedAt,
+		entry.UserID,
+		entry.Role,
+		entry.Endpoint,
+		entry.EntityType,
+		entry.EntityID,
+		entry.Action,
+		entry.Before,
+		entry.After,
+	})
+	var h hash.Hash
+	if key == nil {
+		h = sha256.New()
+	} else {
+		h = hmac.New(sha256.New, key)
+	}
+	h.Write(marshal)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// randomAuditKey is the key of databases SetAuditKey wasn't called on, which is only good for scratch databases.
+func randomAuditKey() []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		panic("failed to generate audit log key: " + err.Error())
+	}
+	return key
+}
+
+// SetAuditKey sets the secret the audit log's hash chain is keyed with. It comes from the config, as a key stored
+// in the database could be used to rewrite the chain by anyone who can change the database.
+func (db *sqlImpl) SetAuditKey(key string) {
+	db.auditKey = []byte(key)
+}
+
+// auditData serializes the entity for the audit log. Secrets are never stored in the log.
+func auditData(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	switch u := v.(type) {
+	case User:
+		v = redactUser(u)
+	case []User:
+		users := make([]User, len(u))
+		for i := 0; i < len(u); i++ {
+			users[i] = redactUser(u[i])
+		}
+		v = users
+	}
+	marshal, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(marshal)
+}
+
+func redactUser(user User) User {
+	user.Password = ""
+	user.TOTPSecret = ""
+	if user.BirthCertificateNumber != "" {
+		user.BirthCertificateNumber = "[redacted]"
+	}
+	return user
+}
+
+// anonymizeUser replaces personal data of the user with what anonymization leaves in the users table.
+func anonymizeUser(user User) User {
+	user = redactUser(user)
+	user.Email = ""
+	user.Name = AnonymizedUserName
+	user.BirthCertificateNumber = ""
+	user.Birthday = Date{}
+	user.CityOfBirth = ""
+	user.CountryOfBirth = ""
+	return user
+}
+
+// anonymizeAuditData anonymizes users with the ID in before or after data of an audit log entry. Users are recognized
+// as objects with the ID and an Email, as auditData stores them. It reports whether anything was changed.
+func anonymizeAuditData(data string, userId int) (string, bool) {
+	if data == "" {
+		return data, false
+	}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if decoder.Decode(&value) != nil {
+		return data, false
+	}
+	changed := false
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			_, isUser := v["Email"]
+			if id, ok := v["ID"].(json.Number); ok && isUser && id.String() == fmt.Sprint(userId) {
+				personal := map[string]interface{}{
+					"Email":                  "",
+					"Name":                   AnonymizedUserName,
+					"BirthCertificateNumber": "",
+					"Birthday":               nil,
+					"CityOfBirth":            "",
+					"CountryOfBirth":         "",
+				}
+				for key, anonymized := range personal {
+					if current, ok := v[key]; ok && current != anonymized {
+						v[key] = anonymized
+						changed = true
+					}
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(value)
+	if !changed {
+		return data, false
+	}
+	marshal, err := json.Marshal(value)
+	if err != nil {
+		return data, false
+	}
+	return string(marshal), true
+}
+
+// redactAuditedUser removes personal data of the deleted or anonymized user from the audit log and hashes the chain
+// again from the first changed entry. It returns IDs of the changed entries, which the caller records in an
+// AuditActionRedact entry, so the rewrite itself stays on record. A broken chain is never hashed again, as that
+// would hide the tampering. The caller holds auditMutex and the lock of lockAuditLog.
+func (db *sqlImpl) redactAuditedUser(tx database, userId int) (redacted []int, err error) {
+	redacted = make([]int, 0)
+	verification, err := verifyAuditChain(tx, db.auditKey)
+	if err != nil {
+		return redacted, err
+	}
+	if !verification.Valid {
+		return redacted, fmt.Errorf("audit log is broken at entry %d, personal data can't be redacted", verification.BrokenAt)
+	}
+	var entries []AuditEntry
+	err = tx.Select(&entries, "SELECT * FROM audit_log ORDER BY id ASC")
+	if err != nil {
+		return redacted, err
+	}
+	prevHash := ""
+	rehash := false
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		var beforeChanged, afterChanged bool
+		entry.Before, beforeChanged = anonymizeAuditData(entry.Before, userId)
+		entry.After, afterChanged = anonymizeAuditData(entry.After, userId)
+		if beforeChanged || afterChanged {
+			redacted = append(redacted, entry.ID)
+			rehash = true
+		}
+		if rehash {
+			entry.PrevHash = prevHash
+			entry.Hash = entry.computeHash(db.auditKey)
+			_, err = tx.Exec("UPDATE audit_log SET before_data=$1, after_data=$2, prev_hash=$3, hash=$4 WHERE id=$5",
+				entry.Before, entry.After, entry.PrevHash, entry.Hash, entry.ID)
+			if err != nil {
+				return redacted, err
+			}
+		}
+		prevHash = entry.Hash
+	}
+	return redacted, nil
+}
+
+// lockAuditLog locks the audit log against concurrent appends until the transaction ends. auditMutex only covers
+// this process, but several MeetPlan instances may share a PostgreSQL database. SQLite allows a single writer anyway.
+func (db *sqlImpl) lockAuditLog(tx database) error {
+	if db.driver != "postgres" {
+		return nil
+	}
+	_, err := tx.Exec("LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE")
+	return err
+}
+
+// appendAuditEntry appends the entry to the chain in the transaction. The caller holds auditMutex and the lock
+// of lockAuditLog.
+func (db *sqlImpl) appendAuditEntry(tx database, entry AuditEntry) error {
+	var last AuditEntry
+	err := tx.Get(&last, "SELECT * FROM audit_log ORDER BY id DESC LIMIT 1")
+	if err != nil {
+		if err.Error() != "sql: no rows in result set" {
+			return err
+		}
+		entry.PrevHash = ""
+	} else {
+		entry.PrevHash = last.Hash
+	}
+	// The hash covers the ID, which is only known once the entry is inserted
+	entry.ID, err = db.insert(tx,
+		"INSERT INTO audit_log (created_at, user_id, role, endpoint, entity_type, entity_id, action, before_data, after_data, prev_hash, hash) VALUES (:created_at, :user_id, :role, :endpoint, :entity_type, :entity_id, :action, :before_data, :after_data, :prev_hash, '')",
+		entry)
+	if err != nil {
+		return err
+	}
+	entry.Hash = entry.computeHash(db.auditKey)
+	_, err = tx.Exec("UPDATE audit_log SET hash=$1 WHERE id=$2", entry.Hash, entry.ID)
+	return err
+}
+
+// InsertAuditEntry appends the entry to the audit log. Appending is serialized, so the chain doesn't fork
+// when two requests write at the same time.
+func (db *sqlImpl) InsertAuditEntry(entry AuditEntry) error {
+	db.auditMutex.Lock()
+	defer db.auditMutex.Unlock()
+
+	tx, err := db.pool.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = db.lockAuditLog(tx)
+	if err != nil {
+		return err
+	}
+	err = db.appendAuditEntry(tx, entry)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *sqlImpl) GetAuditEntries(filter AuditFilter) (entries []AuditEntry, err error) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.UserID != -1 {
+		add("user_id=$%d", filter.UserID)
+	}
+	if filter.EntityType != "" {
+		add("entity_type=$%d", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		add("entity_id=$%d", filter.EntityID)
+	}
+	if filter.Endpoint != "" {
+		add("endpoint=$%d", filter.Endpoint)
+	}
+	if filter.From != 0 {
+		add("created_at>=$%d", filter.From)
+	}
+	if filter.To != 0 {
+		add("created_at<=$%d", filter.To)
+	}
+	query := "SELECT * FROM audit_log"
+	if len(conditions) != 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+	err = db.db.Select(&entries, query, args...)
+	if entries == nil {
+		entries = make([]AuditEntry, 0)
+	}
+	return entries, err
+}
+
+// VerifyAuditLog recomputes the whole hash chain.
+func (db *sqlImpl) VerifyAuditLog() (verification AuditVerification, err error) {
+	return verifyAuditChain(db.db, db.auditKey)
+}
+
+func verifyAuditChain(q sqlx.Queryer, key []byte) (verification AuditVerification, err error) {
+	verification = AuditVerification{Valid: true, BrokenAt: -1}
+	rows, err := q.Queryx("SELECT * FROM audit_log ORDER BY id ASC")
+	if err != nil {
+		return verification, err
+	}
+	defer rows.Close()
+	prevHash := ""
+	for rows.Next() {
+		var entry AuditEntry
+		err = rows.StructScan(&entry)
+		if err != nil {
+			return verification, err
+		}
+		verification.Entries++
+		// Removed entries are detected by the previous hash, changed ones by their own hash. IDs may have gaps,
+		// as databases don't reuse IDs of rolled back inserts.
+		if entry.PrevHash != prevHash || !hmac.Equal([]byte(entry.computeHash(key)), []byte(entry.Hash)) {
+			verification.Valid = false
+			verification.BrokenAt = entry.ID
+			return verification, nil
+		}
+		prevHash = entry.Hash
+	}
+	return verification, rows.Err()
+}
+
+// RekeyAuditLog verifies the chain with the old key and hashes it again with the current one, after the key was
+// changed. An empty old key verifies the plain SHA-256 hashes of audit logs written before the key was introduced.
+// Nothing is changed when the chain is broken, the returned verification says where.
+func (db *sqlImpl) RekeyAuditLog(oldKey string) (verification AuditVerification, err error) {
+	var key []byte
+	if oldKey != "" {
+		key = []byte(oldKey)
+	}
+	db.auditMutex.Lock()
+	defer db.auditMutex.Unlock()
+
+	tx, err := db.pool.Beginx()
+	if err != nil {
+		return verification, err
+	}
+	defer tx.Rollback()
+	err = db.lockAuditLog(tx)
+	if err != nil {
+		return verification, err
+	}
+	verification, err = verifyAuditChain(tx, key)
+	if err != nil || !verification.Valid {
+		return verification, err
+	}
+	var entries []AuditEntry
+	err = tx.Select(&entries, "SELECT * FROM audit_log ORDER BY id ASC")
+	if err != nil {
+		return verification, err
+	}
+	prevHash := ""
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		entry.PrevHash = prevHash
+		entry.Hash = entry.computeHash(db.auditKey)
+		_, err = tx.Exec("UPDATE audit_log SET prev_hash=$1, hash=$2 WHERE id=$3", entry.PrevHash, entry.Hash, entry.ID)
+		if err != nil {
+			return verification, err
+		}
+		prevHash = entry.Hash
+	}
+	return verification, tx.Commit()
+}
+
+// WithActor returns the database, which records writes made through it in the audit log on behalf of the actor.
+func (db *sqlImpl) WithActor(actor AuditActor) SQL {
+	return &auditedSQL{SQL: db, db: db, actor: actor}
+}
+
+// auditedSQL records writes of school data to the audit log. Sessions, login attempts, throttles and similar
+// security bookkeeping aren't recorded, as they already are a log of their own.
+// Entries are appended in the same transaction as the write, so a write is never made without its entry.
+type auditedSQL struct {
+	SQL
+	db    *sqlImpl
+	actor AuditActor
+	// The first entry that couldn't be appended during write
+	err error
+	// Set on the database write binds to its transaction, writes made through it join the transaction
+	inWrite bool
+}
+
+func (a *auditedSQL) WithActor(actor AuditActor) SQL {
+	return a.db.WithActor(actor)
+}
+
+// write runs fn with the database bound to a new transaction and commits it together with the entries fn
+// recorded. When fn fails or an entry can't be appended, the whole write is rolled back. Writes made inside
+// another write run in its transaction.
+func (a *auditedSQL) write(fn func(tx *auditedSQL) error) error {
+	if a.inWrite {
+		return fn(a)
+	}
+	a.db.auditMutex.Lock()
+	defer a.db.auditMutex.Unlock()
+
+	tx, err := a.db.pool.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = a.db.lockAuditLog(tx)
+	if err != nil {
+		return err
+	}
+	bound := a.db.withTx(tx)
+	t := &auditedSQL{SQL: bound, db: bound, actor: a.actor, inWrite: true}
+	err = fn(t)
+	if err != nil {
+		return err
+	}
+	if t.err != nil {
+		return fmt.Errorf("failed to write audit log entry: %s", t.err.Error())
+	}
+	return tx.Commit()
+}
+
+// record appends the entry in write's transaction.
+func (a *auditedSQL) record(entityType string, entityId interface{}, action string, before interface{}, after interface{}) {
+	if a.err != nil {
+		return
+	}
+	a.err = a.db.appendAuditEntry(a.db.db, AuditEntry{
+		CreatedAt:  time.Now().Unix(),
+		UserID:     a.actor.UserID,
+		Role:       a.actor.Role,
+		Endpoint:   a.actor.Endpoint,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityId),
+		Action:     action,
+		Before:     auditData(before),
+		After:      auditData(after),
+	})
+	if a.err != nil {
+		a.db.logger.Errorw("failed to write audit log entry", "error", a.err, "entity_type", entityType, "entity_id", entityId)
+	}
+}
+
+// orNil turns failed lookups of the previous state into an empty before value.
+func orNil(v interface{}, err error) interface{} {
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func (a *auditedSQL) InsertTestingResult(testing Testing) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertTestingResult(testing)
+		if err == nil {
+			testing.ID = id
+			tx.record("testing", id, AuditActionInsert, nil, testing)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateTestingResult(testing Testing) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetTestingResultByID(testing.ID))
+		err := tx.SQL.UpdateTestingResult(testing)
+		if err == nil {
+			tx.record("testing", testing.ID, AuditActionUpdate, before, testing)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteTeacherSelfTesting(teacherId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.DeleteTeacherSelfTesting(teacherId)
+		if err == nil {
+			tx.record("testing", "teacher:"+fmt.Sprint(teacherId), AuditActionDelete, nil, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteUserSelfTesting(userId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetAllTestingsForUser(userId))
+		err := tx.SQL.DeleteUserSelfTesting(userId)
+		if err == nil {
+			tx.record("testing", "user:"+fmt.Sprint(userId), AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) InsertUser(user User) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertUser(user)
+		if err == nil {
+			user.ID = id
+			tx.record("user", id, AuditActionInsert, nil, user)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateUser(user User) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetUser(user.ID))
+		err := tx.SQL.UpdateUser(user)
+		if err == nil {
+			tx.record("user", user.ID, AuditActionUpdate, before, user)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteUser(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetUser(ID))
+		err := tx.SQL.DeleteUser(ID)
+		if err == nil {
+			tx.record("user", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) AddChildToParent(parentId int, studentId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.AddChildToParent(parentId, studentId)
+		if err == nil {
+			tx.record("parent_child", membershipID(parentId, studentId), AuditActionInsert, nil, ParentChild{ParentID: parentId, StudentID: studentId})
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) RemoveChildFromParent(parentId int, studentId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.RemoveChildFromParent(parentId, studentId)
+		if err == nil {
+			tx.record("parent_child", membershipID(parentId, studentId), AuditActionDelete, ParentChild{ParentID: parentId, StudentID: studentId}, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteUserData(userId int, mode string) (preview DeletionPreview, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		user, err := tx.SQL.GetUser(userId)
+		if err != nil {
+			return err
+		}
+		preview, err = tx.SQL.DeleteUserData(userId, mode)
+		if err != nil {
+			return err
+		}
+		redacted, err := tx.db.redactAuditedUser(tx.db.db, userId)
+		if err != nil {
+			return err
+		}
+		tx.record("user", userId, AuditActionRedact, nil, map[string]interface{}{"entries": redacted})
+		// The user's entry mustn't bring back the personal data that was just redacted
+		if mode == DeletionModeAnonymize {
+			tx.record("user", userId, AuditActionUpdate, anonymizeUser(user), orNil(tx.SQL.GetUser(userId)))
+		} else {
+			tx.record("user", userId, AuditActionDelete, anonymizeUser(user), nil)
+		}
+		return nil
+	})
+	return preview, err
+}
+
+// RollOver records the school year with the whole plan, as the rollover changes too many rows to record each one.
+func (a *auditedSQL) RollOver(opts RolloverOptions) (plan RolloverPlan, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		plan, err = tx.SQL.RollOver(opts)
+		if err == nil {
+			tx.record("school_year", plan.SchoolYearID, AuditActionInsert, nil, plan)
+		}
+		return err
+	})
+	return plan, err
+}
+
+func (a *auditedSQL) SetLegalHold(hold LegalHold) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetLegalHold(hold.UserID))
+		err := tx.SQL.SetLegalHold(hold)
+		if err == nil {
+			tx.record("legal_hold", hold.UserID, AuditActionUpdate, before, hold)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteLegalHold(userId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetLegalHold(userId))
+		err := tx.SQL.DeleteLegalHold(userId)
+		if err == nil {
+			tx.record("legal_hold", userId, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) InsertClass(class Class) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertClass(class)
+		if err == nil {
+			class.ID = id
+			tx.record("class", id, AuditActionInsert, nil, class)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateClass(class Class) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetClass(class.ID))
+		err := tx.SQL.UpdateClass(class)
+		if err == nil {
+			tx.record("class", class.ID, AuditActionUpdate, before, class)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteClass(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetClass(ID))
+		err := tx.SQL.DeleteClass(ID)
+		if err == nil {
+			tx.record("class", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteTeacherClasses(teacherId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.DeleteTeacherClasses(teacherId)
+		if err == nil {
+			tx.record("class", "teacher:"+fmt.Sprint(teacherId), AuditActionDelete, nil, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) AddStudentToClass(classId int, userId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.AddStudentToClass(classId, userId)
+		if err == nil {
+			tx.record("class_student", membershipID(classId, userId), AuditActionInsert, nil, ClassStudent{ClassID: classId, UserID: userId})
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) RemoveStudentFromClass(classId int, userId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.RemoveStudentFromClass(classId, userId)
+		if err == nil {
+			tx.record("class_student", membershipID(classId, userId), AuditActionDelete, ClassStudent{ClassID: classId, UserID: userId}, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteUserClasses(userId int) {
+	err := a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetClassesForStudent(userId))
+		tx.SQL.DeleteUserClasses(userId)
+		tx.record("class_student", "user:"+fmt.Sprint(userId), AuditActionDelete, before, nil)
+		return nil
+	})
+	if err != nil {
+		a.db.logger.Errorw("failed to write audit log entry", "error", err)
+	}
+}
+
+func (a *auditedSQL) InsertMeeting(meeting Meeting) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertMeeting(meeting)
+		if err == nil {
+			meeting.ID = id
+			tx.record("meeting", id, AuditActionInsert, nil, meeting)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateMeeting(meeting Meeting) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetMeeting(meeting.ID))
+		err := tx.SQL.UpdateMeeting(meeting)
+		if err == nil {
+			tx.record("meeting", meeting.ID, AuditActionUpdate, before, meeting)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteMeeting(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetMeeting(ID))
+		err := tx.SQL.DeleteMeeting(ID)
+		if err == nil {
+			tx.record("meeting", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteMeetingsForTeacher(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.DeleteMeetingsForTeacher(ID)
+		if err == nil {
+			tx.record("meeting", "teacher:"+fmt.Sprint(ID), AuditActionDelete, nil, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteMeetingsForSubject(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetMeetingsForSubject(ID))
+		err := tx.SQL.DeleteMeetingsForSubject(ID)
+		if err == nil {
+			tx.record("meeting", "subject:"+fmt.Sprint(ID), AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+// WithMeetingsLocked records the writes fn makes, all in the transaction that locks meetings.
+func (a *auditedSQL) WithMeetingsLocked(fn func(tx SQL) error) error {
+	return a.write(func(tx *auditedSQL) error {
+		return tx.SQL.WithMeetingsLocked(func(locked SQL) error {
+			return fn(tx)
+		})
+	})
+}
+
+func (a *auditedSQL) ApplyTimetableTemplate(template TimetableTemplate, from Date, freeDays []Date) (sync TemplateSync, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		var before interface{}
+		if template.ID != 0 {
+			before = orNil(tx.SQL.GetTimetableTemplate(template.ID))
+		}
+		sync, err = tx.SQL.ApplyTimetableTemplate(template, from, freeDays)
+		if err == nil {
+			action := AuditActionUpdate
+			if before == nil {
+				action = AuditActionInsert
+			}
+			tx.record("timetable_template", sync.Template.ID, action, before, sync)
+		}
+		return err
+	})
+	return sync, err
+}
+
+func (a *auditedSQL) DeleteTimetableTemplate(id int, from Date) (sync TemplateSync, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		sync, err = tx.SQL.DeleteTimetableTemplate(id, from)
+		if err == nil {
+			tx.record("timetable_template", id, AuditActionDelete, sync.Template, sync)
+		}
+		return err
+	})
+	return sync, err
+}
+
+func (a *auditedSQL) SetUnavailableHours(teacherId int, hours []UnavailableHour) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetUnavailableHoursForTeacher(teacherId))
+		err := tx.SQL.SetUnavailableHours(teacherId, hours)
+		if err == nil {
+			tx.record("teacher_unavailability", teacherId, AuditActionUpdate, before, orNil(tx.SQL.GetUnavailableHoursForTeacher(teacherId)))
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) InsertTimetableDraft(draft TimetableDraft, lessons []TimetableDraftLesson) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertTimetableDraft(draft, lessons)
+		if err == nil {
+			draft.ID = id
+			tx.record("timetable_draft", id, AuditActionInsert, nil, draft)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) DeleteTimetableDraft(id int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetTimetableDraft(id))
+		err := tx.SQL.DeleteTimetableDraft(id)
+		if err == nil {
+			tx.record("timetable_draft", id, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+// PublishTimetableDraft records every created template, the same as if they were created one by one.
+func (a *auditedSQL) PublishTimetableDraft(id int, freeDays []Date) (syncs []TemplateSync, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetTimetableDraft(id))
+		syncs, err = tx.SQL.PublishTimetableDraft(id, freeDays)
+		if err == nil {
+			for i := 0; i < len(syncs); i++ {
+				tx.record("timetable_template", syncs[i].Template.ID, AuditActionInsert, nil, syncs[i])
+			}
+			tx.record("timetable_draft", id, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+	if err != nil {
+		return make([]TemplateSync, 0), err
+	}
+	return syncs, nil
+}
+
+func (a *auditedSQL) InsertAbsence(absence Absence) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertAbsence(absence)
+		if err == nil {
+			absence.ID = id
+			tx.record("absence", id, AuditActionInsert, nil, absence)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateAbsence(absence Absence) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetAbsence(absence.ID))
+		err := tx.SQL.UpdateAbsence(absence)
+		if err == nil {
+			tx.record("absence", absence.ID, AuditActionUpdate, before, absence)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteAbsencesForTeacher(userId int) {
+	err := a.write(func(tx *auditedSQL) error {
+		tx.SQL.DeleteAbsencesForTeacher(userId)
+		tx.record("absence", "teacher:"+fmt.Sprint(userId), AuditActionDelete, nil, nil)
+		return nil
+	})
+	if err != nil {
+		a.db.logger.Errorw("failed to write audit log entry", "error", err)
+	}
+}
+
+func (a *auditedSQL) DeleteAbsencesForUser(userId int) {
+	err := a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetAllAbsences(userId))
+		tx.SQL.DeleteAbsencesForUser(userId)
+		tx.record("absence", "user:"+fmt.Sprint(userId), AuditActionDelete, before, nil)
+		return nil
+	})
+	if err != nil {
+		a.db.logger.Errorw("failed to write audit log entry", "error", err)
+	}
+}
+
+func (a *auditedSQL) InsertSubject(subject Subject) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertSubject(subject)
+		if err == nil {
+			subject.ID = id
+			tx.record("subject", id, AuditActionInsert, nil, subject)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateSubject(subject Subject) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetSubject(subject.ID))
+		err := tx.SQL.UpdateSubject(subject)
+		if err == nil {
+			tx.record("subject", subject.ID, AuditActionUpdate, before, subject)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteSubject(subject Subject) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetSubject(subject.ID))
+		err := tx.SQL.DeleteSubject(subject)
+		if err == nil {
+			tx.record("subject", subject.ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) AddStudentToSubject(subjectId int, userId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.AddStudentToSubject(subjectId, userId)
+		if err == nil {
+			tx.record("subject_student", membershipID(subjectId, userId), AuditActionInsert, nil, SubjectStudent{SubjectID: subjectId, UserID: userId})
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) RemoveStudentFromSubject(subjectId int, userId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.RemoveStudentFromSubject(subjectId, userId)
+		if err == nil {
+			tx.record("subject_student", membershipID(subjectId, userId), AuditActionDelete, SubjectStudent{SubjectID: subjectId, UserID: userId}, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteStudentSubject(userId int) {
+	err := a.write(func(tx *auditedSQL) error {
+		tx.SQL.DeleteStudentSubject(userId)
+		tx.record("subject_student", "user:"+fmt.Sprint(userId), AuditActionDelete, nil, nil)
+		return nil
+	})
+	if err != nil {
+		a.db.logger.Errorw("failed to write audit log entry", "error", err)
+	}
+}
+
+func (a *auditedSQL) InsertGrade(grade Grade) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertGrade(grade)
+		if err == nil {
+			grade.ID = id
+			tx.record("grade", id, AuditActionInsert, nil, grade)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateGrade(grade Grade) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetGrade(grade.ID))
+		err := tx.SQL.UpdateGrade(grade)
+		if err == nil {
+			tx.record("grade", grade.ID, AuditActionUpdate, before, grade)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteGrade(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetGrade(ID))
+		err := tx.SQL.DeleteGrade(ID)
+		if err == nil {
+			tx.record("grade", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteGradesByTeacherID(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.DeleteGradesByTeacherID(ID)
+		if err == nil {
+			tx.record("grade", "teacher:"+fmt.Sprint(ID), AuditActionDelete, nil, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteGradesByUserID(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetGradesForUser(ID))
+		err := tx.SQL.DeleteGradesByUserID(ID)
+		if err == nil {
+			tx.record("grade", "user:"+fmt.Sprint(ID), AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) InsertHomework(homework Homework) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertHomework(homework)
+		if err == nil {
+			homework.ID = id
+			tx.record("homework", id, AuditActionInsert, nil, homework)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateHomework(homework Homework) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetHomework(homework.ID))
+		err := tx.SQL.UpdateHomework(homework)
+		if err == nil {
+			tx.record("homework", homework.ID, AuditActionUpdate, before, homework)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteHomework(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetHomework(ID))
+		err := tx.SQL.DeleteHomework(ID)
+		if err == nil {
+			tx.record("homework", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteAllTeacherHomeworks(ID int) {
+	err := a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetHomeworkForTeacher(ID))
+		tx.SQL.DeleteAllTeacherHomeworks(ID)
+		tx.record("homework", "teacher:"+fmt.Sprint(ID), AuditActionDelete, before, nil)
+		return nil
+	})
+	if err != nil {
+		a.db.logger.Errorw("failed to write audit log entry", "error", err)
+	}
+}
+
+func (a *auditedSQL) InsertStudentHomework(homework StudentHomework) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertStudentHomework(homework)
+		if err == nil {
+			homework.ID = id
+			tx.record("student_homework", id, AuditActionInsert, nil, homework)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateStudentHomework(homework StudentHomework) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetStudentHomework(homework.ID))
+		err := tx.SQL.UpdateStudentHomework(homework)
+		if err == nil {
+			tx.record("student_homework", homework.ID, AuditActionUpdate, before, homework)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteStudentHomework(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetStudentHomework(ID))
+		err := tx.SQL.DeleteStudentHomework(ID)
+		if err == nil {
+			tx.record("student_homework", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteStudentHomeworkByHomeworkID(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.DeleteStudentHomeworkByHomeworkID(ID)
+		if err == nil {
+			tx.record("student_homework", "homework:"+fmt.Sprint(ID), AuditActionDelete, nil, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteStudentHomeworkByStudentID(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.DeleteStudentHomeworkByStudentID(ID)
+		if err == nil {
+			tx.record("student_homework", "user:"+fmt.Sprint(ID), AuditActionDelete, nil, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) InsertCommunication(communication Communication, people []int) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertCommunication(communication, people)
+		if err == nil {
+			communication.ID = id
+			tx.record("communication", id, AuditActionInsert, nil, struct {
+				Communication
+				People []int
+			}{communication, people})
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateCommunication(communication Communication) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetCommunication(communication.ID))
+		err := tx.SQL.UpdateCommunication(communication)
+		if err == nil {
+			tx.record("communication", communication.ID, AuditActionUpdate, before, communication)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteCommunication(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetCommunication(ID))
+		err := tx.SQL.DeleteCommunication(ID)
+		if err == nil {
+			tx.record("communication", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteUserCommunications(userId int) {
+	err := a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetCommunicationsForUser(userId))
+		tx.SQL.DeleteUserCommunications(userId)
+		tx.record("communication", "user:"+fmt.Sprint(userId), AuditActionDelete, before, nil)
+		return nil
+	})
+	if err != nil {
+		a.db.logger.Errorw("failed to write audit log entry", "error", err)
+	}
+}
+
+func (a *auditedSQL) InsertMessage(message Message) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertMessage(message)
+		if err == nil {
+			message.ID = id
+			tx.record("message", id, AuditActionInsert, nil, message)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateMessage(message Message) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetMessage(message.ID))
+		err := tx.SQL.UpdateMessage(message)
+		if err == nil {
+			tx.record("message", message.ID, AuditActionUpdate, before, message)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteMessage(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetMessage(ID))
+		err := tx.SQL.DeleteMessage(ID)
+		if err == nil {
+			tx.record("message", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) InsertMeal(meal Meal) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertMeal(meal)
+		if err == nil {
+			meal.ID = id
+			tx.record("meal", id, AuditActionInsert, nil, meal)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateMeal(meal Meal) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetMeal(meal.ID))
+		err := tx.SQL.UpdateMeal(meal)
+		if err == nil {
+			tx.record("meal", meal.ID, AuditActionUpdate, before, meal)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteMeal(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetMeal(ID))
+		err := tx.SQL.DeleteMeal(ID)
+		if err == nil {
+			tx.record("meal", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) AddMealOrder(mealId int, userId int) (ordered bool, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		ordered, err = tx.SQL.AddMealOrder(mealId, userId)
+		if err == nil && ordered {
+			tx.record("meal_order", membershipID(mealId, userId), AuditActionInsert, nil, MealOrder{MealID: mealId, UserID: userId})
+		}
+		return err
+	})
+	return ordered, err
+}
+
+func (a *auditedSQL) RemoveMealOrder(mealId int, userId int) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.RemoveMealOrder(mealId, userId)
+		if err == nil {
+			tx.record("meal_order", membershipID(mealId, userId), AuditActionDelete, MealOrder{MealID: mealId, UserID: userId}, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) InsertNotification(notification NotificationSQL) (id int, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		id, err = tx.SQL.InsertNotification(notification)
+		if err == nil {
+			notification.ID = id
+			tx.record("notification", id, AuditActionInsert, nil, notification)
+		}
+		return err
+	})
+	return id, err
+}
+
+func (a *auditedSQL) UpdateNotification(notification NotificationSQL) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetNotification(notification.ID))
+		err := tx.SQL.UpdateNotification(notification)
+		if err == nil {
+			tx.record("notification", notification.ID, AuditActionUpdate, before, notification)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteNotification(ID int) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetNotification(ID))
+		err := tx.SQL.DeleteNotification(ID)
+		if err == nil {
+			tx.record("notification", ID, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) InsertRole(role Role) error {
+	return a.write(func(tx *auditedSQL) error {
+		err := tx.SQL.InsertRole(role)
+		if err == nil {
+			tx.record("role", role.Name, AuditActionInsert, nil, role)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) UpdateRole(role Role) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetRole(role.Name))
+		err := tx.SQL.UpdateRole(role)
+		if err == nil {
+			tx.record("role", role.Name, AuditActionUpdate, before, role)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) DeleteRole(name string) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetRole(name))
+		err := tx.SQL.DeleteRole(name)
+		if err == nil {
+			tx.record("role", name, AuditActionDelete, before, nil)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) SetRolePermissions(role string, permissions []string) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetPermissionsForRole(role))
+		err := tx.SQL.SetRolePermissions(role, permissions)
+		if err == nil {
+			tx.record("role_permissions", role, AuditActionUpdate, before, permissions)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) SetTwoFactorRoles(roles []string) error {
+	return a.write(func(tx *auditedSQL) error {
+		before := orNil(tx.SQL.GetTwoFactorRoles())
+		err := tx.SQL.SetTwoFactorRoles(roles)
+		if err == nil {
+			tx.record("two_factor_roles", "", AuditActionUpdate, before, roles)
+		}
+		return err
+	})
+}
+
+func (a *auditedSQL) ImportUsers(students []ImportedStudent, newClasses []Class) (result ImportResult, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		result, err = tx.SQL.ImportUsers(students, newClasses)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(result.Students); i++ {
+			tx.record("user", result.Students[i].ID, AuditActionInsert, nil, result.Students[i])
+		}
+		for i := 0; i < len(result.NewClasses); i++ {
+			tx.record("class", result.NewClasses[i].ID, AuditActionInsert, nil, result.NewClasses[i])
+		}
+		for i := 0; i < len(result.ClassStudents); i++ {
+			m := result.ClassStudents[i]
+			tx.record("class_student", membershipID(m.ClassID, m.UserID), AuditActionInsert, nil, m)
+		}
+		for i := 0; i < len(result.ParentChildren); i++ {
+			m := result.ParentChildren[i]
+			tx.record("parent_child", membershipID(m.ParentID, m.StudentID), AuditActionInsert, nil, m)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (a *auditedSQL) RedeemChildInvitation(code string, parent User) (student User, err error) {
+	err = a.write(func(tx *auditedSQL) error {
+		student, err = tx.SQL.RedeemChildInvitation(code, parent)
+		if err == nil {
+			after := orNil(tx.SQL.GetUser(parent.ID))
+			tx.record("user", parent.ID, AuditActionUpdate, parent, after)
+			tx.record("parent_child", membershipID(parent.ID, student.ID), AuditActionInsert, nil, ParentChild{ParentID: parent.ID, StudentID: student.ID})
+		}
+		return err
+	})
+	return student, err
+}
+
+func (a *auditedSQL) ResetPassword(token string, password string) error {
+	return a.write(func(tx *auditedSQL) error {
+		reset, lookupErr := tx.SQL.GetPasswordResetByToken(token)
+		err := tx.SQL.ResetPassword(token, password)
+		if err == nil && lookupErr == nil {
+			tx.record("user_password", reset.UserID, AuditActionUpdate, nil, nil)
+		}
+		return err
+	})
+}
@@ -0,0 +1,133 @@
+package sql
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+)
+
+// TestAuditedWriteFailsWithoutEntry checks that a write is rolled back when its audit log entry can't be appended.
+func TestAuditedWriteFailsWithoutEntry(t *testing.T) {
+	conn, err := NewInMemorySQLite(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := conn.(*sqlImpl)
+	defer db.pool.Close()
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	audited := db.WithActor(AuditActor{UserID: 1, Role: AdminRole, Endpoint: "POST /notifications/new"})
+	_, err = audited.InsertNotification(NotificationSQL{Notification: "Zapisano"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.db.Exec("DROP TABLE audit_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = audited.InsertNotification(NotificationSQL{Notification: "Brez revizijske sledi"})
+	if err == nil {
+		t.Fatal("write without an audit log entry succeeded")
+	}
+	notifications, err := db.GetAllNotifications()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 {
+		t.Errorf("notifications after the failed write: got %d, want 1", len(notifications))
+	}
+}
+
+// TestAnonymizeRedactsAuditLog checks that personal data of an anonymized user is removed from earlier audit log
+// entries, while the chain stays valid and the redaction is recorded.
+func TestAnonymizeRedactsAuditLog(t *testing.T) {
+	conn, err := NewInMemorySQLite(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := conn.(*sqlImpl)
+	defer db.pool.Close()
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	audited := db.WithActor(AuditActor{UserID: 1, Role: AdminRole, Endpoint: "PATCH /user/{id}"})
+	birthday, err := ParseDate("2010-05-04")
+	if err != nil {
+		t.Fatal(err)
+	}
+	student := User{
+		Email:          "micka.kovacic@example.com",
+		Role:           "student",
+		Name:           "Micka Kovačič",
+		Birthday:       birthday,
+		CityOfBirth:    "Kranj",
+		CountryOfBirth: "Slovenija",
+	}
+	student.ID, err = audited.InsertUser(student)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := audited.InsertUser(User{Email: "janez.novak@example.com", Role: "student", Name: "Janez Novak"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	student.IsPassing = true
+	err = audited.UpdateUser(student)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.ReserveLoginAttempt(AccountThrottleKey(student.Email), AccountThrottlePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = audited.DeleteUserData(student.ID, DeletionModeAnonymize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := db.GetAuditEntries(AuditFilter{UserID: -1, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactions := 0
+	for _, entry := range entries {
+		for _, personal := range []string{student.Email, student.Name, "2010-05-04", "Kranj"} {
+			if strings.Contains(entry.Before+entry.After, personal) {
+				t.Errorf("entry %d still contains %s: %s %s", entry.ID, personal, entry.Before, entry.After)
+			}
+		}
+		if entry.Action == AuditActionRedact {
+			redactions++
+			if entry.After == `{"entries":[]}` {
+				t.Error("redaction entry doesn't list the redacted entries")
+			}
+		}
+	}
+	if redactions != 1 {
+		t.Errorf("redaction entries: got %d, want 1", redactions)
+	}
+	verification, err := db.VerifyAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Valid {
+		t.Errorf("audit log is broken at entry %d after the redaction", verification.BrokenAt)
+	}
+	otherEntries, err := db.GetAuditEntries(AuditFilter{UserID: -1, EntityType: "user", EntityID: fmt.Sprint(other), Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(otherEntries) != 1 || !strings.Contains(otherEntries[0].After, "Janez Novak") {
+		t.Errorf("entries of another user were redacted: %v", otherEntries)
+	}
+	_, err = db.GetLoginThrottle(AccountThrottleKey(student.Email))
+	if err == nil {
+		t.Error("login throttle of the anonymized user wasn't deleted")
+	}
+}
@@ -0,0 +1,300 @@
+package sql
+
+import (
+	"bufio"
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotSQLiteFile is the copy of the database in SQLite snapshots. PostgreSQL snapshots contain
+// a <table>.jsonl file with a JSON object per row for every table instead.
+const snapshotSQLiteFile = "meetplan.db"
+
+// Snapshot describes a consistent copy of the database written by WriteSnapshot.
+type Snapshot struct {
+	Driver        string `json:"driver"`
+	SchemaVersion int    `json:"schema_version"`
+	CreatedAt     int64  `json:"created_at"`
+	// Files written into the snapshot directory
+	Files []string `json:"files"`
+}
+
+// WriteSnapshot writes a consistent copy of the database into dir while the database stays online. SQLite is
+// copied with its online backup API, PostgreSQL is dumped table by table inside a single repeatable read
+// transaction, so rows written during the dump aren't included.
+func (db *sqlImpl) WriteSnapshot(dir string) (snapshot Snapshot, err error) {
+	snapshot = Snapshot{Driver: db.driver, CreatedAt: time.Now().Unix(), Files: make([]string, 0)}
+	switch db.driver {
+	case "sqlite3":
+		copied, err := sqlx.Connect("sqlite3", filepath.Join(dir, snapshotSQLiteFile))
+		if err != nil {
+			return snapshot, err
+		}
+		defer copied.Close()
+		err = copySQLite(copied, db.pool)
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.SchemaVersion, err = (&sqlImpl{db: copied, driver: db.driver, logger: db.logger}).SchemaVersion()
+		snapshot.Files = append(snapshot.Files, snapshotSQLiteFile)
+		return snapshot, err
+	case "postgres":
+		tx, err := db.pool.BeginTxx(context.Background(), &dbsql.TxOptions{Isolation: dbsql.LevelRepeatableRead, ReadOnly: true})
+		if err != nil {
+			return snapshot, err
+		}
+		defer tx.Rollback()
+		err = tx.Get(&snapshot.SchemaVersion, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+		if err != nil {
+			return snapshot, err
+		}
+		tables, err := postgresTables(tx)
+		if err != nil {
+			return snapshot, err
+		}
+		for _, table := range tables {
+			err = dumpPostgresTable(tx, table, filepath.Join(dir, table+".jsonl"))
+			if err != nil {
+				return snapshot, fmt.Errorf("failed to dump table %s: %s", table, err.Error())
+			}
+			snapshot.Files = append(snapshot.Files, table+".jsonl")
+		}
+		return snapshot, tx.Commit()
+	default:
+		return snapshot, fmt.Errorf("snapshots aren't supported for driver %s", db.driver)
+	}
+}
+
+// RestoreSnapshot replaces everything in the database with the snapshot in dir. The snapshot has to be made
+// with the same driver and mustn't be newer than this binary.
+//
+// SQLite snapshots are copied over the database with the backup API, so the restored database has the schema
+// version of the snapshot and may need to be migrated afterwards. PostgreSQL snapshots only contain rows,
+// so the database has to have the same schema version as the snapshot already. There all tables are emptied
+// and filled again in a single transaction, which leaves the database untouched when anything fails.
+func (db *sqlImpl) RestoreSnapshot(dir string, snapshot Snapshot) error {
+	if snapshot.Driver != db.driver {
+		return fmt.Errorf("snapshot was made with driver %s, but the database uses %s", snapshot.Driver, db.driver)
+	}
+	latest := LatestSchemaVersion()
+	if snapshot.SchemaVersion > latest {
+		return fmt.Errorf("snapshot schema version %d is newer than the newest version %d known to this MeetPlan binary, please upgrade MeetPlan", snapshot.SchemaVersion, latest)
+	}
+	switch db.driver {
+	case "sqlite3":
+		copied, err := sqlx.Connect("sqlite3", filepath.Join(dir, snapshotSQLiteFile))
+		if err != nil {
+			return err
+		}
+		defer copied.Close()
+		// The manifest could have been edited, so the version stored in the copy itself is checked as well
+		version, err := (&sqlImpl{db: copied, driver: db.driver, logger: db.logger}).SchemaVersion()
+		if err != nil {
+			return err
+		}
+		if version != snapshot.SchemaVersion {
+			return fmt.Errorf("snapshot has schema version %d, but its manifest says %d", version, snapshot.SchemaVersion)
+		}
+		return copySQLite(db.pool, copied)
+	case "postgres":
+		version, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		if version != snapshot.SchemaVersion {
+			return fmt.Errorf("database has schema version %d, but the snapshot %d, migrate the database to the version of the snapshot first", version, snapshot.SchemaVersion)
+		}
+		return db.restorePostgres(dir)
+	default:
+		return fmt.Errorf("snapshots aren't supported for driver %s", db.driver)
+	}
+}
+
+// copySQLite copies the whole database behind src into dest with SQLite's online backup API.
+func copySQLite(dest *sqlx.DB, src *sqlx.DB) error {
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			destSQLite, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("destination isn't an SQLite database")
+			}
+			srcSQLite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("source isn't an SQLite database")
+			}
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			// All pages are copied in a single step, so the copy can't mix pages from before and after a write.
+			// The step doesn't fail while another connection holds a lock, it has to be retried instead.
+			for {
+				done, err := backup.Step(-1)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// postgresTables lists tables of the current schema, except schema_migrations. Tables with foreign keys
+// are listed last, as they reference the others and have to be filled after them when restoring.
+func postgresTables(q sqlx.Queryer) (tables []string, err error) {
+	err = sqlx.Select(q, &tables, `SELECT t.table_name FROM information_schema.tables t
+		WHERE t.table_schema=current_schema() AND t.table_type='BASE TABLE' AND t.table_name<>'schema_migrations'
+		ORDER BY EXISTS (
+			SELECT 1 FROM information_schema.table_constraints c
+			WHERE c.table_schema=t.table_schema AND c.table_name=t.table_name AND c.constraint_type='FOREIGN KEY'
+		), t.table_name`)
+	return tables, err
+}
+
+func dumpPostgresTable(tx database, table string, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	rows, err := tx.Queryx("SELECT * FROM " + pq.QuoteIdentifier(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row := make(map[string]interface{})
+		err = rows.MapScan(row)
+		if err != nil {
+			return err
+		}
+		// lib/pq returns text of types it doesn't decode itself as bytes, which JSON would encode as base64
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+		err = encoder.Encode(row)
+		if err != nil {
+			return err
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (db *sqlImpl) restorePostgres(dir string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	tables, err := postgresTables(tx)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, 0)
+	for _, table := range tables {
+		quoted = append(quoted, pq.QuoteIdentifier(table))
+	}
+	if len(quoted) != 0 {
+		_, err = tx.Exec("TRUNCATE " + strings.Join(quoted, ", "))
+		if err != nil {
+			return err
+		}
+	}
+	for _, table := range tables {
+		err = restorePostgresTable(tx, table, filepath.Join(dir, table+".jsonl"))
+		if err != nil {
+			return fmt.Errorf("failed to restore table %s: %s", table, err.Error())
+		}
+	}
+	// Generated IDs have to continue after the restored rows
+	var generated []string
+	err = tx.Select(&generated, "SELECT table_name FROM information_schema.columns WHERE table_schema=current_schema() AND column_name='id' AND is_identity='YES'")
+	if err != nil {
+		return err
+	}
+	for _, table := range generated {
+		_, err = tx.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)", pq.QuoteIdentifier(table)), table)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func restorePostgresTable(tx database, table string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	// Numbers are passed on as text, so large integers don't lose precision by going through float64
+	decoder.UseNumber()
+	for decoder.More() {
+		row := make(map[string]interface{})
+		err = decoder.Decode(&row)
+		if err != nil {
+			return err
+		}
+		columns := make([]string, 0)
+		for column := range row {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		placeholders := make([]string, 0)
+		args := make([]interface{}, 0)
+		for i, column := range columns {
+			placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+			value := row[column]
+			if number, ok := value.(json.Number); ok {
+				value = number.String()
+			}
+			args = append(args, value)
+			columns[i] = pq.QuoteIdentifier(column)
+		}
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", pq.QuoteIdentifier(table), strings.Join(columns, ", "), strings.Join(placeholders, ", ")), args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package sql
+
+import (
+	"github.com/dchest/uniuri"
+	"time"
+)
+
+// CalendarFeed lets calendar apps subscribe to the user's timetable. They can't log in, so the feed is
+// authenticated by the token in its URL instead of a JWT. Only the hash of the token is stored.
+type CalendarFeed struct {
+	ID     int
+	UserID int `db:"user_id"`
+	// Role of the user when the feed was created, the feed stops working once it changes
+	Role       string
+	Token      string
+	CreatedAt  int64 `db:"created_at"`
+	LastUsedAt int64 `db:"last_used_at"`
+}
+
+func (db *sqlImpl) GetCalendarFeed(userId int) (feed CalendarFeed, err error) {
+	err = db.db.Get(&feed, "SELECT * FROM calendar_feeds WHERE user_id=$1", userId)
+	return feed, err
+}
+
+func (db *sqlImpl) GetCalendarFeedByToken(token string) (feed CalendarFeed, err error) {
+	err = db.db.Get(&feed, "SELECT * FROM calendar_feeds WHERE token=$1", HashToken(token))
+	return feed, err
+}
+
+func (db *sqlImpl) InsertCalendarFeed(feed CalendarFeed) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO calendar_feeds (user_id, role, token, created_at, last_used_at) VALUES (:user_id, :role, :token, :created_at, :last_used_at)",
+		feed)
+}
+
+func (db *sqlImpl) UpdateCalendarFeed(feed CalendarFeed) error {
+	_, err := db.db.NamedExec("UPDATE calendar_feeds SET last_used_at=:last_used_at WHERE id=:id", feed)
+	return err
+}
+
+// DeleteCalendarFeed revokes the user's feed, calendar apps subscribed to it stop getting the timetable.
+func (db *sqlImpl) DeleteCalendarFeed(userId int) error {
+	_, err := db.db.Exec("DELETE FROM calendar_feeds WHERE user_id=$1", userId)
+	return err
+}
+
+// NewCalendarFeed revokes the user's previous feed and returns the token of a new one for the user's current role.
+func (db *sqlImpl) NewCalendarFeed(userId int) (string, error) {
+	user, err := db.GetUser(userId)
+	if err != nil {
+		return "", err
+	}
+	err = db.DeleteCalendarFeed(userId)
+	if err != nil {
+		return "", err
+	}
+	token := uniuri.NewLen(64)
+	_, err = db.InsertCalendarFeed(CalendarFeed{
+		UserID:    userId,
+		Role:      user.Role,
+		Token:     HashToken(token),
+		CreatedAt: time.Now().Unix(),
+	})
+	return token, err
+}
+
+// GetMeetingsForUser returns meetings the user teaches or attends, together with meetings their children
+// attend, ordered by time.
+func (db *sqlImpl) GetMeetingsForUser(userId int) (meetings []Meeting, err error) {
+	err = db.db.Select(&meetings, `SELECT * FROM meetings WHERE teacher_id=$1 OR subject_id IN (
+			SELECT id FROM subject WHERE
+				(inherits_class AND class_id IN (SELECT class_id FROM class_students WHERE user_id=$1 OR user_id IN (SELECT student_id FROM parent_children WHERE parent_id=$1)))
+				OR (NOT inherits_class AND id IN (SELECT subject_id FROM subject_students WHERE user_id=$1 OR user_id IN (SELECT student_id FROM parent_children WHERE parent_id=$1)))
+		) ORDER BY date ASC, hour ASC, id ASC`, userId)
+	if meetings == nil {
+		meetings = make([]Meeting, 0)
+	}
+	return meetings, err
+}
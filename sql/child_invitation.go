@@ -0,0 +1,122 @@
+package sql
+
+import (
+	"errors"
+	"github.com/dchest/uniuri"
+	"strings"
+	"time"
+)
+
+const ChildInvitationExpiration = 30 * 24 * time.Hour
+
+// Characters that can't be easily mistaken for each other when codes are copied from paper
+var childInvitationChars = []byte("ABCDEFGHJKLMNPQRSTUVWXYZ23456789")
+
+type ChildInvitation struct {
+	ID        int
+	StudentID int `db:"student_id"`
+	Code      string
+	CreatedBy int   `db:"created_by"`
+	ExpiresAt int64 `db:"expires_at"`
+	IsUsed    bool  `db:"is_used"`
+	UsedBy    int   `db:"used_by"`
+}
+
+// NormalizeInvitationCode removes the formatting from codes typed in by the user.
+func NormalizeInvitationCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
+
+func (db *sqlImpl) GetChildInvitationByCode(code string) (invitation ChildInvitation, err error) {
+	err = db.db.Get(&invitation, "SELECT * FROM child_invitations WHERE code=$1", HashToken(NormalizeInvitationCode(code)))
+	return invitation, err
+}
+
+func (db *sqlImpl) GetChildInvitationsForStudent(studentId int) (invitations []ChildInvitation, err error) {
+	err = db.db.Select(&invitations, "SELECT * FROM child_invitations WHERE student_id=$1 ORDER BY id ASC", studentId)
+	if invitations == nil {
+		invitations = make([]ChildInvitation, 0)
+	}
+	return invitations, err
+}
+
+func (db *sqlImpl) InsertChildInvitation(invitation ChildInvitation) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO child_invitations (student_id, code, created_by, expires_at, is_used, used_by) VALUES (:student_id, :code, :created_by, :expires_at, :is_used, :used_by)",
+		invitation)
+}
+
+func (db *sqlImpl) DeleteChildInvitations(studentId int) {
+	db.db.Exec("DELETE FROM child_invitations WHERE student_id=$1", studentId)
+}
+
+// NewChildInvitation creates a single-use invitation code for the student and returns it formatted
+// for printing (XXXXX-XXXXX). Only the hash of the code is stored.
+func (db *sqlImpl) NewChildInvitation(studentId int, createdBy int) (string, error) {
+	code := uniuri.NewLenChars(10, childInvitationChars)
+	_, err := db.InsertChildInvitation(ChildInvitation{
+		StudentID: studentId,
+		Code:      HashToken(code),
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(ChildInvitationExpiration).Unix(),
+		IsUsed:    false,
+		UsedBy:    -1,
+	})
+	return code[:5] + "-" + code[5:], err
+}
+
+// RedeemChildInvitation links the parent with the student from the invitation. Unverified users become parents,
+// as the invitation code proves they have received it from the school.
+func (db *sqlImpl) RedeemChildInvitation(code string, parent User) (student User, err error) {
+	invitation, err := db.GetChildInvitationByCode(code)
+	if err != nil {
+		return student, errors.New("invalid invitation code")
+	}
+	if invitation.IsUsed || invitation.ExpiresAt < time.Now().Unix() {
+		return student, errors.New("invitation code has already been used or has expired")
+	}
+	if parent.Role != "parent" && parent.Role != "unverified" {
+		return student, errors.New("only parents can redeem invitation codes")
+	}
+	student, err = db.GetUser(invitation.StudentID)
+	if err != nil {
+		return student, err
+	}
+	linked, err := db.IsParentOf(parent.ID, student.ID)
+	if err != nil {
+		return student, err
+	}
+	if linked {
+		return student, errors.New("student is already linked with this parent")
+	}
+
+	tx, err := db.begin()
+	if err != nil {
+		return student, err
+	}
+	// Checking is_used in the same statement makes sure two parents can't redeem the same code concurrently
+	res, err := tx.Exec("UPDATE child_invitations SET is_used=true, used_by=$1 WHERE id=$2 AND is_used=false", parent.ID, invitation.ID)
+	if err != nil {
+		tx.Rollback()
+		return student, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil || affected != 1 {
+		tx.Rollback()
+		return student, errors.New("invitation code has already been used or has expired")
+	}
+	_, err = tx.Exec("UPDATE users SET role='parent' WHERE id=$1", parent.ID)
+	if err != nil {
+		tx.Rollback()
+		return student, err
+	}
+	_, err = tx.Exec("INSERT INTO parent_children (parent_id, student_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", parent.ID, student.ID)
+	if err != nil {
+		tx.Rollback()
+		return student, err
+	}
+	return student, tx.Commit()
+}
@@ -1,21 +1,13 @@
 package sql
 
-import "encoding/json"
-
-func remove(s []int, i int) []int {
-	s[i] = s[len(s)-1]
-	return s[:len(s)-1]
-}
-
 type Class struct {
 	ID             int
 	Name           string
 	Teacher        int
-	Students       string
 	ClassYear      string `db:"class_year"`
 	SOK            int
 	EOK            int
-	LastSchoolDate int `db:"last_school_date"`
+	LastSchoolDate Date `db:"last_school_date"`
 }
 
 func (db *sqlImpl) GetClass(id int) (class Class, err error) {
@@ -23,40 +15,29 @@ func (db *sqlImpl) GetClass(id int) (class Class, err error) {
 	return class, err
 }
 
-func (db *sqlImpl) InsertClass(class Class) (err error) {
-	_, err = db.db.NamedExec(
-		"INSERT INTO classes (id, teacher, name, class_year, sok, eok, last_school_date) VALUES (:id, :teacher, :name, :class_year, :sok, :eok, :last_school_date)",
+func (db *sqlImpl) InsertClass(class Class) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO classes (teacher, name, class_year, sok, eok, last_school_date) VALUES (:teacher, :name, :class_year, :sok, :eok, :last_school_date)",
 		class)
-	return err
 }
 
 func (db *sqlImpl) UpdateClass(class Class) error {
 	_, err := db.db.NamedExec(
-		"UPDATE classes SET teacher=:teacher, students=:students, name=:name, class_year=:class_year, sok=:sok, eok=:eok, last_school_date=:last_school_date WHERE id=:id",
+		"UPDATE classes SET teacher=:teacher, name=:name, class_year=:class_year, sok=:sok, eok=:eok, last_school_date=:last_school_date WHERE id=:id",
 		class)
 	return err
 }
 
-func (db *sqlImpl) GetLastClassID() (id int) {
-	err := db.db.Get(&id, "SELECT id FROM classes WHERE id = (SELECT MAX(id) FROM classes)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
 func (db *sqlImpl) GetClasses() (classes []Class, err error) {
 	err = db.db.Select(&classes, "SELECT * FROM classes ORDER BY id ASC")
 	return classes, err
 }
 
 func (db *sqlImpl) DeleteClass(ID int) error {
-	_, err := db.db.Exec("DELETE FROM classes WHERE id=$1", ID)
-	return err
+	return db.execAll([]string{
+		"DELETE FROM class_students WHERE class_id=$1",
+		"DELETE FROM classes WHERE id=$1",
+	}, ID)
 }
 
 func (db *sqlImpl) DeleteTeacherClasses(teacherId int) error {
@@ -83,18 +64,40 @@ func (db *sqlImpl) DeleteTeacherClasses(teacherId int) error {
 }
 
 func (db *sqlImpl) DeleteUserClasses(userId int) {
-	classes, _ := db.GetClasses()
-	for i := 0; i < len(classes); i++ {
-		class := classes[i]
-		var users []int
-		json.Unmarshal([]byte(class.Students), &users)
-		for n := 0; n < len(users); n++ {
-			if users[n] == userId {
-				users = remove(users, n)
-			}
-		}
-		marshal, _ := json.Marshal(users)
-		class.Students = string(marshal)
-		db.UpdateClass(class)
+	db.db.Exec("DELETE FROM class_students WHERE user_id=$1", userId)
+}
+
+// GetClassStudents returns IDs of the students in the class.
+func (db *sqlImpl) GetClassStudents(classId int) (students []int, err error) {
+	err = db.db.Select(&students, "SELECT user_id FROM class_students WHERE class_id=$1 ORDER BY user_id ASC", classId)
+	if students == nil {
+		students = make([]int, 0)
+	}
+	return students, err
+}
+
+func (db *sqlImpl) GetClassesForStudent(userId int) (classes []Class, err error) {
+	err = db.db.Select(&classes,
+		"SELECT classes.* FROM classes JOIN class_students ON class_students.class_id=classes.id WHERE class_students.user_id=$1 ORDER BY classes.id ASC",
+		userId)
+	if classes == nil {
+		classes = make([]Class, 0)
 	}
+	return classes, err
+}
+
+func (db *sqlImpl) IsStudentInClass(classId int, userId int) (bool, error) {
+	n, err := count(db.db, "SELECT COUNT(*) FROM class_students WHERE class_id=$1 AND user_id=$2", classId, userId)
+	return n != 0, err
+}
+
+// AddStudentToClass does nothing when the student is already in the class.
+func (db *sqlImpl) AddStudentToClass(classId int, userId int) error {
+	_, err := db.db.Exec("INSERT INTO class_students (class_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", classId, userId)
+	return err
+}
+
+func (db *sqlImpl) RemoveStudentFromClass(classId int, userId int) error {
+	_, err := db.db.Exec("DELETE FROM class_students WHERE class_id=$1 AND user_id=$2", classId, userId)
+	return err
 }
@@ -1,11 +1,10 @@
 package sql
 
-import "encoding/json"
+import "time"
 
 type Communication struct {
 	ID          int
-	People      string
-	DateCreated string `db:"date_created"`
+	DateCreated time.Time `db:"date_created"`
 	Title       string
 }
 
@@ -14,53 +13,76 @@ func (db *sqlImpl) GetCommunication(id int) (communication Communication, err er
 	return communication, err
 }
 
-func (db *sqlImpl) InsertCommunication(communication Communication) (err error) {
-	_, err = db.db.NamedExec(
-		"INSERT INTO communication (id, people, title, date_created) VALUES (:id, :people, :title, :date_created)",
+// InsertCommunication creates the communication together with the people taking part in it.
+func (db *sqlImpl) InsertCommunication(communication Communication, people []int) (id int, err error) {
+	tx, err := db.begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+	id, err = db.insert(tx,
+		"INSERT INTO communication (title, date_created) VALUES (:title, :date_created)",
 		communication)
-	return err
+	if err != nil {
+		return -1, err
+	}
+	for i := 0; i < len(people); i++ {
+		_, err = tx.Exec("INSERT INTO communication_people (communication_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, people[i])
+		if err != nil {
+			return -1, err
+		}
+	}
+	return id, tx.Commit()
 }
 
 func (db *sqlImpl) UpdateCommunication(communication Communication) error {
 	_, err := db.db.NamedExec(
-		"UPDATE communication SET people=:people, title=:title WHERE id=:id",
+		"UPDATE communication SET title=:title WHERE id=:id",
 		communication)
 	return err
 }
 
-func (db *sqlImpl) GetLastCommunicationID() (id int) {
-	err := db.db.Get(&id, "SELECT id FROM communication WHERE id = (SELECT MAX(id) FROM communication)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
 func (db *sqlImpl) GetCommunications() (communication []Communication, err error) {
 	err = db.db.Select(&communication, "SELECT * FROM communication ORDER BY id ASC")
 	return communication, err
 }
 
 func (db *sqlImpl) DeleteCommunication(ID int) error {
-	_, err := db.db.Exec("DELETE FROM communication WHERE id=$1", ID)
-	if err != nil {
-		return err
-	}
-	_, err = db.db.Exec("DELETE FROM message WHERE communication_id=$1", ID)
-	return err
+	return db.execAll([]string{
+		"DELETE FROM message_seen WHERE message_id IN (SELECT id FROM message WHERE communication_id=$1)",
+		"DELETE FROM message WHERE communication_id=$1",
+		"DELETE FROM communication_people WHERE communication_id=$1",
+		"DELETE FROM communication WHERE id=$1",
+	}, ID)
 }
 
 func (db *sqlImpl) DeleteUserCommunications(userId int) {
-	communications, _ := db.GetCommunications()
+	communications, _ := db.GetCommunicationsForUser(userId)
 	for i := 0; i < len(communications); i++ {
-		var users []int
-		json.Unmarshal([]byte(communications[i].People), &users)
-		if contains(users, userId) {
-			db.DeleteCommunication(communications[i].ID)
-		}
+		db.DeleteCommunication(communications[i].ID)
+	}
+}
+
+// GetCommunicationPeople returns IDs of the users taking part in the communication.
+func (db *sqlImpl) GetCommunicationPeople(communicationId int) (people []int, err error) {
+	err = db.db.Select(&people, "SELECT user_id FROM communication_people WHERE communication_id=$1 ORDER BY user_id ASC", communicationId)
+	if people == nil {
+		people = make([]int, 0)
+	}
+	return people, err
+}
+
+func (db *sqlImpl) GetCommunicationsForUser(userId int) (communications []Communication, err error) {
+	err = db.db.Select(&communications,
+		"SELECT communication.* FROM communication JOIN communication_people ON communication_people.communication_id=communication.id WHERE communication_people.user_id=$1 ORDER BY communication.id ASC",
+		userId)
+	if communications == nil {
+		communications = make([]Communication, 0)
 	}
+	return communications, err
+}
+
+func (db *sqlImpl) IsInCommunication(communicationId int, userId int) (bool, error) {
+	n, err := count(db.db, "SELECT COUNT(*) FROM communication_people WHERE communication_id=$1 AND user_id=$2", communicationId, userId)
+	return n != 0, err
 }
@@ -3,6 +3,7 @@ package sql
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 )
 
 type Config struct {
@@ -22,11 +23,106 @@ type Config struct {
 	BlockRegistrations bool     `json:"block_registrations"`
 	BlockMeals         bool     `json:"block_meals"`
 	SchoolFreeDays     []string `json:"school_free_days"`
+	// URL of the MeetPlan frontend, used in links sent by email
+	FrontendURL  string `json:"frontend_url"`
+	Mailer       string `json:"mailer"`
+	MailFrom     string `json:"mail_from"`
+	MailFile     string `json:"mail_file"`
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     int    `json:"smtp_port"`
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password"`
+	// Trust X-Forwarded-For header when MeetPlan runs behind a reverse proxy
+	BehindProxy bool `json:"behind_proxy"`
+	// OpenID Connect single sign-on, disabled when OIDCIssuer is empty
+	OIDCIssuer       string `json:"oidc_issuer"`
+	OIDCClientID     string `json:"oidc_client_id"`
+	OIDCClientSecret string `json:"oidc_client_secret"`
+	// Frontend page the identity provider redirects back to. It should pass code and state to /user/login/oidc/callback.
+	OIDCRedirectURL string `json:"oidc_redirect_url"`
+	OIDCGroupsClaim string `json:"oidc_groups_claim"`
+	// Groups are checked in order and the first matching group determines the user's role
+	OIDCRoleMapping []OIDCRoleMapping `json:"oidc_role_mapping"`
+	// Create accounts for unknown users on their first login
+	OIDCProvisionUsers bool `json:"oidc_provision_users"`
+	// Allow admins to change data while impersonating other users. Impersonation is read-only by default.
+	ImpersonationAllowWrites bool `json:"impersonation_allow_writes"`
+	// Don't apply pending migrations at startup. They have to be applied with the migrate command instead.
+	SkipMigrations bool `json:"skip_migrations"`
+	// Directory backups are written to, "backups" when empty
+	BackupDirectory string `json:"backup_directory"`
+	// Backups are encrypted with a key derived from the passphrase. They aren't encrypted when it's empty.
+	BackupPassphrase string `json:"backup_passphrase"`
+	// Take a backup every given number of hours while the server runs, 0 disables scheduled backups
+	BackupIntervalHours int `json:"backup_interval_hours"`
+	// Retention policy applied after every backup, see backup.RetentionPolicy. Backups are never removed
+	// when all of them are 0.
+	BackupKeepLast    int `json:"backup_keep_last"`
+	BackupKeepDaily   int `json:"backup_keep_daily"`
+	BackupKeepWeekly  int `json:"backup_keep_weekly"`
+	BackupKeepMonthly int `json:"backup_keep_monthly"`
+	// Students of classes in this grade graduate at the school year rollover, 9 when 0
+	FinalClassGrade int `json:"final_class_grade"`
+	// Start and end of every school hour starting with hour 0, such as "07:30-08:15", used by calendar feeds.
+	// calendar.DefaultLessonTimes when empty.
+	LessonTimes []string `json:"lesson_times"`
+	// IANA time zone lesson times are in, calendar.DefaultTimeZone when empty
+	TimeZone string `json:"time_zone"`
+	// Directory with the fonts, icons and officialdocs directories PDFs are rendered with, the working directory
+	// when empty
+	AssetDirectory string `json:"asset_directory"`
+	// Secret key of the audit log's hash chain. It's generated on the first start when empty. Changing it breaks
+	// the chain until it's hashed again with the rekey-audit-log command.
+	AuditKey string `json:"audit_key"`
 }
 
+type OIDCRoleMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// Redacted returns a copy of the config without secrets, safe to be sent to the frontend.
+func (config Config) Redacted() Config {
+	if config.SMTPPassword != "" {
+		config.SMTPPassword = "********"
+	}
+	if config.OIDCClientSecret != "" {
+		config.OIDCClientSecret = "********"
+	}
+	if config.BackupPassphrase != "" {
+		config.BackupPassphrase = "********"
+	}
+	if config.AuditKey != "" {
+		config.AuditKey = "********"
+	}
+	return config
+}
+
+// AssetPath returns the path of an asset such as fonts/opensans.ttf in AssetDirectory.
+func (config Config) AssetPath(name string) string {
+	return filepath.Join(config.AssetDirectory, name)
+}
+
+// FreeDays returns SchoolFreeDays as dates, days that can't be parsed are skipped.
+func (config Config) FreeDays() []Date {
+	days := make([]Date, 0)
+	for i := 0; i < len(config.SchoolFreeDays); i++ {
+		day, err := ParseDate(config.SchoolFreeDays[i])
+		if err != nil {
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// ConfigFile is where GetConfig and SaveConfig keep the configuration, relative to the working directory.
+// Check suites point it elsewhere, so routes that change the configuration don't overwrite the server's.
+var ConfigFile = "config.json"
+
 func GetConfig() (Config, error) {
 	var config Config
-	file, err := os.ReadFile("config.json")
+	file, err := os.ReadFile(ConfigFile)
 	if err != nil {
 		marshal, err := json.Marshal(Config{
 			DatabaseName:   "sqlite3",
@@ -37,11 +133,11 @@ func GetConfig() (Config, error) {
 		if err != nil {
 			return config, err
 		}
-		err = os.WriteFile("config.json", marshal, 0600)
+		err = os.WriteFile(ConfigFile, marshal, 0600)
 		if err != nil {
 			return config, err
 		}
-		file, err = os.ReadFile("config.json")
+		file, err = os.ReadFile(ConfigFile)
 		if err != nil {
 			return config, err
 		}
@@ -58,14 +154,14 @@ func SaveConfig(config Config) error {
 	if err != nil {
 		return err
 	}
-	f, err := os.Create("config.json")
+	f, err := os.Create(ConfigFile)
 	if err != nil {
 		return err
 	}
 	if err := f.Close(); err != nil {
 		return err
 	}
-	err = os.WriteFile("config.json", marshal, 0600)
+	err = os.WriteFile(ConfigFile, marshal, 0600)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,129 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateFormat is the ISO-8601 format dates are stored in and sent to the API with.
+const DateFormat = "2006-01-02"
+
+// LegacyDateFormat is the format MeetPlan used for meetings and self-testing before dates got their own columns.
+// It's still accepted as input during the transition period.
+const LegacyDateFormat = "02-01-2006"
+
+// legacyTimestampFormat is the output of time.Time.String(), which was stored for grades and messages.
+const legacyTimestampFormat = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// Date is a calendar day, without a time of day or a time zone. The zero Date is stored as NULL and sent to the
+// API as null.
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the day t falls on in its own location.
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// Today returns the current day in the server's time zone.
+func Today() Date {
+	return NewDate(time.Now())
+}
+
+// ParseDate parses an ISO-8601 date, a full ISO-8601 timestamp, or one of the legacy formats.
+func ParseDate(value string) (Date, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Date{}, fmt.Errorf("date is empty")
+	}
+	for _, layout := range []string{DateFormat, LegacyDateFormat, time.RFC3339Nano} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return NewDate(t), nil
+		}
+	}
+	// time.Time.String() appends the monotonic clock reading, which can't be parsed
+	t, err := time.Parse(legacyTimestampFormat, strings.Split(value, " m=")[0])
+	if err == nil {
+		return NewDate(t), nil
+	}
+	return Date{}, fmt.Errorf("invalid date %s, expected format %s", value, DateFormat)
+}
+
+// AddDays returns the date n days later, or earlier when n is negative.
+func (d Date) AddDays(n int) Date {
+	return Date{d.Time.AddDate(0, 0, n)}
+}
+
+func (d Date) Before(other Date) bool {
+	return d.Time.Before(other.Time)
+}
+
+func (d Date) After(other Date) bool {
+	return d.Time.After(other.Time)
+}
+
+func (d Date) Equal(other Date) bool {
+	return d.Time.Equal(other.Time)
+}
+
+// String returns the date in DateFormat, or an empty string for the zero Date.
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(DateFormat)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var value *string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	if value == nil || *value == "" {
+		*d = Date{}
+		return nil
+	}
+	*d, err = ParseDate(*value)
+	return err
+}
+
+// Value stores the date as an ISO-8601 string, which both SQLite and PostgreSQL compare correctly.
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+func (d *Date) Scan(src interface{}) (err error) {
+	switch value := src.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = NewDate(value)
+	case string:
+		return d.Scan([]byte(value))
+	case []byte:
+		if len(value) == 0 {
+			*d = Date{}
+			return nil
+		}
+		*d, err = ParseDate(string(value))
+	default:
+		err = fmt.Errorf("cannot scan %T into Date", src)
+	}
+	return err
+}
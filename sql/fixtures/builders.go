@@ -0,0 +1,305 @@
+package fixtures
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+// hashPassword hashes with the lowest cost bcrypt allows. Fixtures don't need to resist cracking, and
+// sql.CheckHash accepts hashes of any cost, so logging in stays fast.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	return string(hash), err
+}
+
+// UserBuilder creates a user, see NewUser.
+type UserBuilder struct {
+	db       sql.SQL
+	user     sql.User
+	password string
+	classes  []int
+	subjects []int
+	children []int
+}
+
+// NewUser starts building a user of the role. Name and email are unique, the user can't log in
+// with a password unless one is set.
+func NewUser(db sql.SQL, role string) *UserBuilder {
+	name := unique(role)
+	return &UserBuilder{
+		db: db,
+		user: sql.User{
+			Email:          name + "@meetplan.invalid",
+			Role:           role,
+			Name:           name,
+			Birthday:       sql.NewDate(time.Date(2010, time.March, 14, 0, 0, 0, 0, time.UTC)),
+			CityOfBirth:    "Ljubljana",
+			CountryOfBirth: "Slovenija",
+			IsPassing:      true,
+		},
+		classes:  make([]int, 0),
+		subjects: make([]int, 0),
+		children: make([]int, 0),
+	}
+}
+
+func (b *UserBuilder) Name(name string) *UserBuilder {
+	b.user.Name = name
+	return b
+}
+
+func (b *UserBuilder) Email(email string) *UserBuilder {
+	b.user.Email = email
+	return b
+}
+
+// Password is hashed when the user is created.
+func (b *UserBuilder) Password(password string) *UserBuilder {
+	b.password = password
+	return b
+}
+
+func (b *UserBuilder) Birthday(birthday sql.Date) *UserBuilder {
+	b.user.Birthday = birthday
+	return b
+}
+
+func (b *UserBuilder) Failing() *UserBuilder {
+	b.user.IsPassing = false
+	return b
+}
+
+// InClass adds the user to classes as a student.
+func (b *UserBuilder) InClass(classIds ...int) *UserBuilder {
+	b.classes = append(b.classes, classIds...)
+	return b
+}
+
+// InSubject adds the user to subjects that don't inherit students from a class.
+func (b *UserBuilder) InSubject(subjectIds ...int) *UserBuilder {
+	b.subjects = append(b.subjects, subjectIds...)
+	return b
+}
+
+// ParentOf makes the user a parent of the students.
+func (b *UserBuilder) ParentOf(studentIds ...int) *UserBuilder {
+	b.children = append(b.children, studentIds...)
+	return b
+}
+
+func (b *UserBuilder) Create() (user sql.User, err error) {
+	user = b.user
+	if b.password != "" {
+		user.Password, err = hashPassword(b.password)
+		if err != nil {
+			return user, err
+		}
+	}
+	user.ID, err = b.db.InsertUser(user)
+	if err != nil {
+		return user, err
+	}
+	for i := 0; i < len(b.classes); i++ {
+		err = b.db.AddStudentToClass(b.classes[i], user.ID)
+		if err != nil {
+			return user, err
+		}
+	}
+	for i := 0; i < len(b.subjects); i++ {
+		err = b.db.AddStudentToSubject(b.subjects[i], user.ID)
+		if err != nil {
+			return user, err
+		}
+	}
+	for i := 0; i < len(b.children); i++ {
+		err = b.db.AddChildToParent(user.ID, b.children[i])
+		if err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+// ClassBuilder creates a class, see NewClass.
+type ClassBuilder struct {
+	db       sql.SQL
+	class    sql.Class
+	students []int
+}
+
+// NewClass starts building a class of the current school year with the teacher as its class teacher.
+func NewClass(db sql.SQL, teacherId int) *ClassBuilder {
+	today := sql.Today()
+	year := today.Year()
+	// School years start in September and end in June
+	if today.Month() < time.September {
+		year--
+	}
+	return &ClassBuilder{
+		db: db,
+		class: sql.Class{
+			Name:           unique("class"),
+			Teacher:        teacherId,
+			ClassYear:      fmt.Sprintf("%d/%d", year, year+1),
+			LastSchoolDate: sql.NewDate(time.Date(year+1, time.June, 23, 0, 0, 0, 0, time.UTC)),
+		},
+		students: make([]int, 0),
+	}
+}
+
+func (b *ClassBuilder) Name(name string) *ClassBuilder {
+	b.class.Name = name
+	return b
+}
+
+// Year sets the school year, such as 2022/2023.
+func (b *ClassBuilder) Year(classYear string) *ClassBuilder {
+	b.class.ClassYear = classYear
+	return b
+}
+
+func (b *ClassBuilder) LastSchoolDate(date sql.Date) *ClassBuilder {
+	b.class.LastSchoolDate = date
+	return b
+}
+
+func (b *ClassBuilder) Students(studentIds ...int) *ClassBuilder {
+	b.students = append(b.students, studentIds...)
+	return b
+}
+
+func (b *ClassBuilder) Create() (class sql.Class, err error) {
+	class = b.class
+	class.ID, err = b.db.InsertClass(class)
+	if err != nil {
+		return class, err
+	}
+	for i := 0; i < len(b.students); i++ {
+		err = b.db.AddStudentToClass(class.ID, b.students[i])
+		if err != nil {
+			return class, err
+		}
+	}
+	return class, nil
+}
+
+// SubjectBuilder creates a subject, see NewSubject.
+type SubjectBuilder struct {
+	db       sql.SQL
+	subject  sql.Subject
+	students []int
+}
+
+// NewSubject starts building a subject taught by the teacher. It has no students unless they are
+// added or it inherits them from a class.
+func NewSubject(db sql.SQL, teacherId int) *SubjectBuilder {
+	return &SubjectBuilder{
+		db: db,
+		subject: sql.Subject{
+			TeacherID: teacherId,
+			Name:      unique("MAT"),
+			ClassID:   -1,
+			LongName:  "Matematika",
+		},
+		students: make([]int, 0),
+	}
+}
+
+func (b *SubjectBuilder) Name(name string, longName string) *SubjectBuilder {
+	b.subject.Name = name
+	b.subject.LongName = longName
+	return b
+}
+
+// Realization sets the hours of the subject in a school year.
+func (b *SubjectBuilder) Realization(hours float32) *SubjectBuilder {
+	b.subject.Realization = hours
+	return b
+}
+
+// ForClass makes the subject inherit students of the class.
+func (b *SubjectBuilder) ForClass(classId int) *SubjectBuilder {
+	b.subject.InheritsClass = true
+	b.subject.ClassID = classId
+	return b
+}
+
+// Students adds students to a subject that doesn't inherit them from a class.
+func (b *SubjectBuilder) Students(studentIds ...int) *SubjectBuilder {
+	b.students = append(b.students, studentIds...)
+	return b
+}
+
+func (b *SubjectBuilder) Create() (subject sql.Subject, err error) {
+	subject = b.subject
+	subject.ID, err = b.db.InsertSubject(subject)
+	if err != nil {
+		return subject, err
+	}
+	for i := 0; i < len(b.students); i++ {
+		err = b.db.AddStudentToSubject(subject.ID, b.students[i])
+		if err != nil {
+			return subject, err
+		}
+	}
+	return subject, nil
+}
+
+// MeetingBuilder creates a meeting, see NewMeeting.
+type MeetingBuilder struct {
+	db      sql.SQL
+	meeting sql.Meeting
+}
+
+// NewMeeting starts building a mandatory meeting of the subject in the first hour of today,
+// held by the subject's teacher.
+func NewMeeting(db sql.SQL, subject sql.Subject) *MeetingBuilder {
+	return &MeetingBuilder{
+		db: db,
+		meeting: sql.Meeting{
+			MeetingName: unique("meeting"),
+			TeacherID:   subject.TeacherID,
+			SubjectID:   subject.ID,
+			Hour:        1,
+			Date:        sql.Today(),
+			IsMandatory: true,
+		},
+	}
+}
+
+func (b *MeetingBuilder) Name(name string) *MeetingBuilder {
+	b.meeting.MeetingName = name
+	return b
+}
+
+func (b *MeetingBuilder) At(date sql.Date, hour int) *MeetingBuilder {
+	b.meeting.Date = date
+	b.meeting.Hour = hour
+	return b
+}
+
+// Substitution makes the teacher hold the meeting instead of the subject's teacher.
+func (b *MeetingBuilder) Substitution(teacherId int) *MeetingBuilder {
+	b.meeting.TeacherID = teacherId
+	b.meeting.IsSubstitution = true
+	return b
+}
+
+func (b *MeetingBuilder) Grading(written bool) *MeetingBuilder {
+	b.meeting.IsGrading = true
+	b.meeting.IsWrittenAssessment = written
+	return b
+}
+
+func (b *MeetingBuilder) Test() *MeetingBuilder {
+	b.meeting.IsTest = true
+	return b
+}
+
+func (b *MeetingBuilder) Create() (meeting sql.Meeting, err error) {
+	meeting = b.meeting
+	meeting.ID, err = b.db.InsertMeeting(meeting)
+	return meeting, err
+}
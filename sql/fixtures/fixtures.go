@@ -0,0 +1,39 @@
+// Package fixtures builds rows for checking code that talks to sql.SQL, usually on a database of
+// sql.NewInMemorySQLite. Builders fill in every column with a sensible default, so callers only set what
+// matters to them, and they link the new row to others (classes, subjects, parents) in the same call.
+package fixtures
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"go.uber.org/zap"
+	"sync/atomic"
+)
+
+var sequence int64
+
+// unique returns a value nobody else used in this process, for columns such as emails and names.
+func unique(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, atomic.AddInt64(&sequence, 1))
+}
+
+// NewDatabase returns an in-memory SQLite database that is migrated and initialized, so it's ready to be used.
+func NewDatabase(logger *zap.SugaredLogger) (sql.SQL, error) {
+	db, err := sql.NewInMemorySQLite(logger)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.MigrateUp()
+	if err != nil {
+		return nil, err
+	}
+	db.Init()
+	return db, nil
+}
+
+// Login starts a session of the user and returns its access token. Two-factor authentication counts as
+// done, so the token is accepted for roles that require it as well.
+func Login(db sql.SQL, user sql.User) (string, error) {
+	accessToken, _, err := db.NewSession(user, true)
+	return accessToken, err
+}
@@ -0,0 +1,84 @@
+package fixtures
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"sort"
+)
+
+// Password is the password of every user of a School.
+const Password = "meetplan"
+
+// School is a small school with a user of every built-in role. The teacher is the class teacher of the class
+// and teaches its subject, the student is in the class and the parent is the student's parent.
+type School struct {
+	// Users has a user of every built-in role, keyed by the role
+	Users   map[string]sql.User
+	Class   sql.Class
+	Subject sql.Subject
+	Meeting sql.Meeting
+}
+
+// Roles returns the built-in roles in alphabetical order.
+func Roles() []string {
+	roles := []string{sql.AdminRole}
+	for role := range sql.DefaultRolePermissions {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func NewSchool(db sql.SQL) (school School, err error) {
+	school.Users = make(map[string]sql.User)
+	teacher, err := NewUser(db, "teacher").Password(Password).Create()
+	if err != nil {
+		return school, err
+	}
+	school.Users[teacher.Role] = teacher
+	school.Class, err = NewClass(db, teacher.ID).Create()
+	if err != nil {
+		return school, err
+	}
+	school.Subject, err = NewSubject(db, teacher.ID).ForClass(school.Class.ID).Create()
+	if err != nil {
+		return school, err
+	}
+	school.Meeting, err = NewMeeting(db, school.Subject).Create()
+	if err != nil {
+		return school, err
+	}
+	student, err := NewUser(db, "student").Password(Password).InClass(school.Class.ID).Create()
+	if err != nil {
+		return school, err
+	}
+	school.Users[student.Role] = student
+	parent, err := NewUser(db, "parent").Password(Password).ParentOf(student.ID).Create()
+	if err != nil {
+		return school, err
+	}
+	school.Users[parent.Role] = parent
+
+	roles := Roles()
+	for i := 0; i < len(roles); i++ {
+		if _, ok := school.Users[roles[i]]; ok {
+			continue
+		}
+		school.Users[roles[i]], err = NewUser(db, roles[i]).Password(Password).Create()
+		if err != nil {
+			return school, err
+		}
+	}
+	return school, nil
+}
+
+func (school School) Teacher() sql.User {
+	return school.Users["teacher"]
+}
+
+func (school School) Student() sql.User {
+	return school.Users["student"]
+}
+
+func (school School) Parent() sql.User {
+	return school.Users["parent"]
+}
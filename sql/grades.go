@@ -1,12 +1,14 @@
 package sql
 
+import "time"
+
 type Grade struct {
 	ID          int
 	UserID      int `db:"user_id"`
 	TeacherID   int `db:"teacher_id"`
 	SubjectID   int `db:"subject_id"`
 	Grade       int
-	Date        string
+	Date        time.Time
 	IsWritten   bool `db:"is_written"`
 	IsFinal     bool `db:"is_final"`
 	Period      int
@@ -14,19 +16,6 @@ type Grade struct {
 	CanPatch    bool `db:"can_patch"`
 }
 
-func (db *sqlImpl) GetLastGradeID() int {
-	var id int
-	err := db.db.Get(&id, "SELECT id FROM grades WHERE id = (SELECT MAX(id) FROM grades)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
 func (db *sqlImpl) GetGrade(id int) (grade Grade, err error) {
 	err = db.db.Get(&grade, "SELECT * FROM grades WHERE id=$1", id)
 	return grade, err
@@ -47,16 +36,13 @@ func (db *sqlImpl) GetGradesForUserInSubject(userId int, subjectId int) (grades
 	return grades, err
 }
 
-func (db *sqlImpl) InsertGrade(grade Grade) error {
+func (db *sqlImpl) InsertGrade(grade Grade) (id int, err error) {
 	i := `
 	INSERT INTO grades
-	    (id, user_id, teacher_id, subject_id, date, is_written, grade, period, description, is_final, can_patch) VALUES
-	    (:id, :user_id, :teacher_id, :subject_id, :date, :is_written, :grade, :period, :description, :is_final, :can_patch)
+	    (user_id, teacher_id, subject_id, date, is_written, grade, period, description, is_final, can_patch) VALUES
+	    (:user_id, :teacher_id, :subject_id, :date, :is_written, :grade, :period, :description, :is_final, :can_patch)
 	`
-	_, err := db.db.NamedExec(
-		i,
-		grade)
-	return err
+	return db.insert(db.db, i, grade)
 }
 
 func (db *sqlImpl) UpdateGrade(grade Grade) error {
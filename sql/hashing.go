@@ -1,6 +1,10 @@
 package sql
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"golang.org/x/crypto/bcrypt"
+)
 
 func HashPassword(pass string) (string, error) {
 	passbyte := []byte(pass)
@@ -15,3 +19,10 @@ func CheckHash(pass string, hashedPass string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPass), []byte(pass))
 	return err == nil
 }
+
+// HashToken hashes randomly generated tokens (such as refresh tokens) before they are stored in the database.
+// Such tokens already have enough entropy, so there is no need for bcrypt here.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
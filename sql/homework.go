@@ -6,21 +6,8 @@ type Homework struct {
 	SubjectID   int `db:"subject_id"`
 	Name        string
 	Description string
-	ToDate      string `db:"to_date"`
-	FromDate    string `db:"from_date"`
-}
-
-func (db *sqlImpl) GetLastHomeworkID() int {
-	var id int
-	err := db.db.Get(&id, "SELECT id FROM homework WHERE id = (SELECT MAX(id) FROM homework)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
+	ToDate      Date `db:"to_date"`
+	FromDate    Date `db:"from_date"`
 }
 
 func (db *sqlImpl) GetHomework(id int) (homework Homework, err error) {
@@ -44,16 +31,13 @@ func (db *sqlImpl) GetHomeworkForTeacher(teacherId int) (homework []Homework, er
 	return homework, err
 }
 
-func (db *sqlImpl) InsertHomework(homework Homework) error {
+func (db *sqlImpl) InsertHomework(homework Homework) (id int, err error) {
 	i := `
 	INSERT INTO homework
-	    (id, teacher_id, subject_id, name, description, from_date, to_date) VALUES
-	    (:id, :teacher_id, :subject_id, :name, :description, :from_date, :to_date)
+	    (teacher_id, subject_id, name, description, from_date, to_date) VALUES
+	    (:teacher_id, :subject_id, :name, :description, :from_date, :to_date)
 	`
-	_, err := db.db.NamedExec(
-		i,
-		homework)
-	return err
+	return db.insert(db.db, i, homework)
 }
 
 func (db *sqlImpl) UpdateHomework(homework Homework) error {
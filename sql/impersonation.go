@@ -0,0 +1,72 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ImpersonationLog records every request an admin made while impersonating another user.
+type ImpersonationLog struct {
+	ID      int
+	AdminID int `db:"admin_id"`
+	UserID  int `db:"user_id"`
+	Method  string
+	// Route template of the request, such as "GET /user/homework/get/{id}"
+	Endpoint string
+	IP       string
+	// Writes are rejected unless they are allowed in the config
+	IsAllowed bool  `db:"is_allowed"`
+	CreatedAt int64 `db:"created_at"`
+}
+
+func (db *sqlImpl) InsertImpersonationLog(entry ImpersonationLog) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO impersonation_log (admin_id, user_id, method, endpoint, ip, is_allowed, created_at) VALUES (:admin_id, :user_id, :method, :endpoint, :ip, :is_allowed, :created_at)",
+		entry)
+}
+
+// GetImpersonationLogs returns the newest entries first. adminId and userId are ignored when they are -1.
+func (db *sqlImpl) GetImpersonationLogs(adminId int, userId int, limit int) (entries []ImpersonationLog, err error) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if adminId != -1 {
+		add("admin_id=$%d", adminId)
+	}
+	if userId != -1 {
+		add("user_id=$%d", userId)
+	}
+	query := "SELECT * FROM impersonation_log"
+	if len(conditions) != 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	err = db.db.Select(&entries, query, args...)
+	if entries == nil {
+		entries = make([]ImpersonationLog, 0)
+	}
+	return entries, err
+}
+
+// RecordImpersonatedRequest stores the request into the impersonation log. Errors are only logged, the same
+// as with login attempts.
+func (db *sqlImpl) RecordImpersonatedRequest(adminId int, userId int, method string, endpoint string, ip string, allowed bool) {
+	_, err := db.InsertImpersonationLog(ImpersonationLog{
+		AdminID:   adminId,
+		UserID:    userId,
+		Method:    method,
+		Endpoint:  endpoint,
+		IP:        ip,
+		IsAllowed: allowed,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		db.logger.Info(err)
+	}
+}
@@ -0,0 +1,81 @@
+package sql
+
+// ImportedStudent is a new student together with the class and the parents it should be linked with.
+type ImportedStudent struct {
+	Student User
+	// ID of an existing class, -1 when the student is added to a new class or to none
+	ClassID int
+	// Name of the class from newClasses the student is added to, empty otherwise
+	NewClass  string
+	ParentIDs []int
+}
+
+// ImportResult contains the rows ImportUsers created, with IDs assigned by the database.
+type ImportResult struct {
+	Students       []User
+	NewClasses     []Class
+	ClassStudents  []ClassStudent
+	ParentChildren []ParentChild
+}
+
+// ImportUsers inserts new classes and students and links the students with their classes and parents in a single
+// transaction, so a failed import never leaves half of the students in the database.
+func (db *sqlImpl) ImportUsers(students []ImportedStudent, newClasses []Class) (result ImportResult, err error) {
+	result = ImportResult{
+		Students:       make([]User, 0),
+		NewClasses:     make([]Class, 0),
+		ClassStudents:  make([]ClassStudent, 0),
+		ParentChildren: make([]ParentChild, 0),
+	}
+	tx, err := db.begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	newClassIds := make(map[string]int)
+	for i := 0; i < len(newClasses); i++ {
+		class := newClasses[i]
+		class.ID, err = db.insert(tx,
+			"INSERT INTO classes (teacher, name, class_year, sok, eok, last_school_date) VALUES (:teacher, :name, :class_year, :sok, :eok, :last_school_date)",
+			class)
+		if err != nil {
+			return result, err
+		}
+		newClassIds[class.Name] = class.ID
+		result.NewClasses = append(result.NewClasses, class)
+	}
+
+	for i := 0; i < len(students); i++ {
+		student := students[i].Student
+		student.ID, err = db.insert(tx,
+			"INSERT INTO users (email, pass, role, name, birth_certificate_number, city_of_birth, country_of_birth, birthday, is_passing, totp_secret, totp_enabled, totp_last_step) VALUES (:email, :pass, :role, :name, :birth_certificate_number, :city_of_birth, :country_of_birth, :birthday, :is_passing, :totp_secret, :totp_enabled, :totp_last_step)",
+			student)
+		if err != nil {
+			return result, err
+		}
+		result.Students = append(result.Students, student)
+
+		classId := students[i].ClassID
+		if students[i].NewClass != "" {
+			classId = newClassIds[students[i].NewClass]
+		}
+		if classId != -1 {
+			membership := ClassStudent{ClassID: classId, UserID: student.ID}
+			_, err = tx.NamedExec("INSERT INTO class_students (class_id, user_id) VALUES (:class_id, :user_id)", membership)
+			if err != nil {
+				return result, err
+			}
+			result.ClassStudents = append(result.ClassStudents, membership)
+		}
+		for n := 0; n < len(students[i].ParentIDs); n++ {
+			link := ParentChild{ParentID: students[i].ParentIDs[n], StudentID: student.ID}
+			_, err = tx.NamedExec("INSERT INTO parent_children (parent_id, student_id) VALUES (:parent_id, :student_id) ON CONFLICT DO NOTHING", link)
+			if err != nil {
+				return result, err
+			}
+			result.ParentChildren = append(result.ParentChildren, link)
+		}
+	}
+	return result, tx.Commit()
+}
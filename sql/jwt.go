@@ -3,66 +3,112 @@ package sql
 import (
 	"errors"
 	"fmt"
-	"github.com/dchest/uniuri"
 	"github.com/golang-jwt/jwt"
-	"strings"
+	"strconv"
 	"time"
 )
 
-func GetSigningKey() []byte {
-	config, err := GetConfig()
-	if err != nil || !config.Debug {
-		return []byte(uniuri.NewLen(100))
-	}
-	return []byte("46ad2cb520028e1f5e2eab8d860a547353ddbabdb6affb923c075c92518c7e02")
-}
+const JWTIssuer = "MeetPlanCA"
 
-var JwtSigningKey = GetSigningKey()
+// Access tokens are short-lived, clients are expected to use their refresh token to obtain a new one.
+const AccessTokenExpiration = 15 * time.Minute
 
-const JWTIssuer = "MeetPlanCA"
+// Time the user has to enter the two-factor code after entering the correct password.
+const TwoFactorLoginExpiration = 5 * time.Minute
+
+// Impersonation tokens can't be refreshed, the admin has to start impersonating again once they expire.
+const ImpersonationExpiration = 10 * time.Minute
 
-func GetJWTFromUserPass(email string, role string, uid int) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+func (db *sqlImpl) GetJWTFromUserPass(email string, role string, uid int, sessionId int, twoFactor bool) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenExpiration)
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": uid,
 		"email":   email,
 		"role":    role,
+		"sid":     sessionId,
+		"mfa":     twoFactor,
 		"iss":     JWTIssuer,
 		"exp":     expirationTime.Unix(),
 	})
 
-	return token.SignedString(JwtSigningKey)
+	return db.signToken(token)
 }
 
-func GetJWTForTestingResult(userId int, result string, testId int, date string) (string, error, string) {
-	expirationTime, err := time.Parse("02-01-2006", date)
+// GetJWTForImpersonation issues an access token for the user, which belongs to the admin's session. Such tokens
+// are marked with the impersonated_by claim and stop working as soon as the admin's session is revoked.
+func (db *sqlImpl) GetJWTForImpersonation(user User, adminId int, sessionId int, twoFactor bool) (string, int64, error) {
+	expirationTime := time.Now().Add(ImpersonationExpiration)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":         user.ID,
+		"email":           user.Email,
+		"role":            user.Role,
+		"sid":             sessionId,
+		"mfa":             twoFactor,
+		"impersonated_by": adminId,
+		"iss":             JWTIssuer,
+		"exp":             expirationTime.Unix(),
+	})
+
+	signed, err := db.signToken(token)
+	return signed, expirationTime.Unix(), err
+}
+
+// ImpersonatedBy returns the ID of the admin impersonating the user, or -1 if the token wasn't issued for impersonation.
+func ImpersonatedBy(claims jwt.MapClaims) int {
+	if claims["impersonated_by"] == nil {
+		return -1
+	}
+	adminId, err := strconv.Atoi(fmt.Sprint(claims["impersonated_by"]))
 	if err != nil {
-		return "", err, ""
+		return -1
 	}
-	expirationTime = expirationTime.Add(48 * time.Hour)
+	return adminId
+}
+
+// TestingResultValidity is how many days a self-testing result stays valid.
+const TestingResultValidity = 2
+
+func (db *sqlImpl) GetJWTForTestingResult(userId int, result string, testId int, date Date) (string, error, Date) {
+	validUntil := date.AddDays(TestingResultValidity)
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userId,
 		"result":  result,
 		"test_id": testId,
 		"iss":     JWTIssuer,
-		"exp":     expirationTime.Unix(),
+		"exp":     validUntil.Unix(),
 	})
 
-	sgnd, err := token.SignedString(JwtSigningKey)
-	return sgnd, err, strings.Split(expirationTime.Format("02-01-2006"), " ")[0]
+	sgnd, err := db.signToken(token)
+	return sgnd, err, validUntil
 }
 
-func CheckJWT(tokenString string) (jwt.MapClaims, error) {
+// signToken signs the token with currently active signing key and sets the kid header,
+// so we know which key to verify it with, even after the key was rotated.
+func (db *sqlImpl) signToken(token *jwt.Token) (string, error) {
+	kid, key, err := db.keyring.active()
+	if err != nil {
+		return "", err
+	}
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+// parseJWT verifies the signature and the issuer of the token.
+func (db *sqlImpl) parseJWT(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Don't forget to validate the alg is what you expect:
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
-		return JwtSigningKey, nil
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("JWT doesn't contain a key ID")
+		}
+		return db.getVerificationKey(kid)
 	})
 
 	if token != nil {
@@ -70,9 +116,6 @@ func CheckJWT(tokenString string) (jwt.MapClaims, error) {
 			if claims["iss"] != JWTIssuer {
 				return nil, errors.New("JWT issuer isn't correct")
 			}
-			if claims["role"] == "unverified" {
-				return nil, errors.New("you are an unverified user. You cannot do anything in this system until the server administrator confirms you")
-			}
 			return claims, nil
 		} else {
 			return nil, err
@@ -81,3 +124,95 @@ func CheckJWT(tokenString string) (jwt.MapClaims, error) {
 		return nil, err
 	}
 }
+
+func (db *sqlImpl) CheckJWT(tokenString string) (jwt.MapClaims, error) {
+	claims, session, err := db.checkJWTSession(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !session.TwoFactor {
+		user, err := db.GetUser(session.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.TOTPEnabled || db.IsTwoFactorRequired(user.Role) {
+			return nil, errors.New("two-factor authentication wasn't completed for this session")
+		}
+	}
+	return claims, nil
+}
+
+// CheckJWTWithoutTwoFactor works the same as CheckJWT, except it accepts sessions that haven't completed
+// two-factor authentication. It should only be used by the endpoints used for enrolling into two-factor authentication.
+func (db *sqlImpl) CheckJWTWithoutTwoFactor(tokenString string) (jwt.MapClaims, error) {
+	claims, _, err := db.checkJWTSession(tokenString)
+	return claims, err
+}
+
+func (db *sqlImpl) checkJWTSession(tokenString string) (jwt.MapClaims, Session, error) {
+	claims, err := db.parseJWT(tokenString)
+	if err != nil {
+		return nil, Session{}, err
+	}
+	if claims["role"] == "unverified" {
+		return nil, Session{}, errors.New("you are an unverified user. You cannot do anything in this system until the server administrator confirms you")
+	}
+	session, err := db.checkSession(claims)
+	if err != nil {
+		return nil, Session{}, err
+	}
+	return claims, session, nil
+}
+
+// checkSession makes sure that the session, to which the access token belongs, wasn't revoked in the meantime.
+func (db *sqlImpl) checkSession(claims jwt.MapClaims) (Session, error) {
+	sessionId, err := strconv.Atoi(fmt.Sprint(claims["sid"]))
+	if err != nil {
+		return Session{}, errors.New("JWT doesn't belong to any session")
+	}
+	userId, err := strconv.Atoi(fmt.Sprint(claims["user_id"]))
+	if err != nil {
+		return Session{}, errors.New("JWT doesn't contain a valid user ID")
+	}
+	if claims["impersonated_by"] != nil {
+		// Impersonation tokens belong to the session of the admin
+		userId = ImpersonatedBy(claims)
+		if userId == -1 {
+			return Session{}, errors.New("JWT doesn't contain a valid impersonator ID")
+		}
+	}
+	session, err := db.GetSession(sessionId)
+	if err != nil {
+		return Session{}, errors.New("session doesn't exist")
+	}
+	if session.IsRevoked || session.UserID != userId || session.ExpiresAt < time.Now().Unix() {
+		return Session{}, errors.New("session has been revoked")
+	}
+	return session, nil
+}
+
+// GetJWTForTwoFactor issues a short-lived token, which proves that the user entered the correct password.
+// It can only be exchanged for a session at the second login step, as it doesn't belong to any session.
+func (db *sqlImpl) GetJWTForTwoFactor(uid int) (string, error) {
+	expirationTime := time.Now().Add(TwoFactorLoginExpiration)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": uid,
+		"typ":     "2fa",
+		"iss":     JWTIssuer,
+		"exp":     expirationTime.Unix(),
+	})
+
+	return db.signToken(token)
+}
+
+func (db *sqlImpl) CheckTwoFactorJWT(tokenString string) (int, error) {
+	claims, err := db.parseJWT(tokenString)
+	if err != nil {
+		return -1, err
+	}
+	if claims["typ"] != "2fa" {
+		return -1, errors.New("JWT isn't a two-factor login token")
+	}
+	return strconv.Atoi(fmt.Sprint(claims["user_id"]))
+}
@@ -0,0 +1,231 @@
+package sql
+
+import (
+	dbsql "database/sql"
+	"strings"
+	"time"
+)
+
+type LoginAttempt struct {
+	ID           int
+	UserID       int `db:"user_id"`
+	Email        string
+	IP           string
+	IsSuccessful bool `db:"is_successful"`
+	Reason       string
+	CreatedAt    int64 `db:"created_at"`
+}
+
+// LoginThrottle tracks consecutive failed logins for one key (either an account or an IP address).
+type LoginThrottle struct {
+	Key         string `db:"throttle_key"`
+	Failures    int
+	LockedUntil int64 `db:"locked_until"`
+	LastFailure int64 `db:"last_failure"`
+}
+
+type ThrottlePolicy struct {
+	// Number of failures allowed before we start delaying further attempts
+	FreeAttempts int
+	// Delay is doubled with every further failure, but never exceeds MaxDelay
+	MaxDelay time.Duration
+	// After this many failures the key is locked for at least LockoutDuration. 0 disables lockouts.
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// Failures older than this are forgotten, together with throttles of keys that didn't fail since
+	ResetAfter time.Duration
+}
+
+var AccountThrottlePolicy = ThrottlePolicy{
+	FreeAttempts:    3,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      24 * time.Hour,
+}
+
+// IP addresses get more free attempts, as whole schools are often behind a single public address.
+var IPThrottlePolicy = ThrottlePolicy{
+	FreeAttempts: 20,
+	MaxDelay:     15 * time.Minute,
+	ResetAfter:   24 * time.Hour,
+}
+
+// Password reset emails are throttled separately from logins, so requesting them doesn't lock anybody out.
+var PasswordResetThrottlePolicy = ThrottlePolicy{
+	FreeAttempts: 3,
+	MaxDelay:     time.Hour,
+	ResetAfter:   24 * time.Hour,
+}
+
+func AccountThrottleKey(email string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func PasswordResetThrottleKey(email string) string {
+	return "reset:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func PasswordResetIPThrottleKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+func (p ThrottlePolicy) delay(failures int) time.Duration {
+	if p.LockoutAfter != 0 && failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := time.Second
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+func (db *sqlImpl) InsertLoginAttempt(attempt LoginAttempt) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO login_attempts (user_id, email, ip, is_successful, reason, created_at) VALUES (:user_id, :email, :ip, :is_successful, :reason, :created_at)",
+		attempt)
+}
+
+func (db *sqlImpl) GetFailedLoginAttempts(limit int) (attempts []LoginAttempt, err error) {
+	err = db.db.Select(&attempts, "SELECT * FROM login_attempts WHERE is_successful=false ORDER BY id DESC LIMIT $1", limit)
+	if attempts == nil {
+		attempts = make([]LoginAttempt, 0)
+	}
+	return attempts, err
+}
+
+func (db *sqlImpl) GetLoginAttemptsForUser(userId int) (attempts []LoginAttempt, err error) {
+	err = db.db.Select(&attempts, "SELECT * FROM login_attempts WHERE user_id=$1 ORDER BY id DESC", userId)
+	if attempts == nil {
+		attempts = make([]LoginAttempt, 0)
+	}
+	return attempts, err
+}
+
+// RecordLoginAttempt stores the attempt into the audit log. Errors are only logged, as failing to write
+// the audit record shouldn't prevent users from logging in.
+func (db *sqlImpl) RecordLoginAttempt(userId int, email string, ip string, successful bool, reason string) {
+	_, err := db.InsertLoginAttempt(LoginAttempt{
+		UserID:       userId,
+		Email:        email,
+		IP:           ip,
+		IsSuccessful: successful,
+		Reason:       reason,
+		CreatedAt:    time.Now().Unix(),
+	})
+	if err != nil {
+		db.logger.Info(err)
+	}
+}
+
+func (db *sqlImpl) GetLoginThrottle(key string) (throttle LoginThrottle, err error) {
+	err = db.db.Get(&throttle, "SELECT * FROM login_throttles WHERE throttle_key=$1", key)
+	return throttle, err
+}
+
+func (db *sqlImpl) GetLockedLoginThrottles() (throttles []LoginThrottle, err error) {
+	err = db.db.Select(&throttles, "SELECT * FROM login_throttles WHERE locked_until>$1 ORDER BY locked_until DESC", time.Now().Unix())
+	if throttles == nil {
+		throttles = make([]LoginThrottle, 0)
+	}
+	return throttles, err
+}
+
+func (db *sqlImpl) DeleteLoginThrottle(key string) error {
+	_, err := db.db.Exec("DELETE FROM login_throttles WHERE throttle_key=$1", key)
+	return err
+}
+
+// CheckLoginThrottle returns how long the caller has to wait before another login attempt is allowed
+// for any of the keys. Zero means the attempt can proceed.
+func (db *sqlImpl) CheckLoginThrottle(keys ...string) time.Duration {
+	var wait time.Duration
+	now := time.Now().Unix()
+	for i := 0; i < len(keys); i++ {
+		throttle, err := db.GetLoginThrottle(keys[i])
+		if err != nil {
+			continue
+		}
+		if throttle.LockedUntil > now {
+			d := time.Duration(throttle.LockedUntil-now) * time.Second
+			if d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// ReserveLoginAttempt counts the attempt as failed before the credentials are checked, so attempts made in
+// parallel can't all pass the throttle. When the key is locked, nothing is counted and the time the caller has
+// to wait is returned. Attempts that turn out to be successful are released with ReleaseLoginAttempt.
+func (db *sqlImpl) ReserveLoginAttempt(key string, policy ThrottlePolicy) (time.Duration, error) {
+	// The counter is only changed if nobody else changed it since it was read, otherwise it's read again
+	for {
+		now := time.Now()
+		throttle, err := db.GetLoginThrottle(key)
+		exists := err == nil
+		if err != nil && err.Error() != "sql: no rows in result set" {
+			return 0, err
+		}
+		if exists && throttle.LockedUntil > now.Unix() {
+			return time.Duration(throttle.LockedUntil-now.Unix()) * time.Second, nil
+		}
+		next := LoginThrottle{Key: key, Failures: throttle.Failures + 1, LastFailure: now.Unix()}
+		if !exists || time.Unix(throttle.LastFailure, 0).Add(policy.ResetAfter).Before(now) {
+			next.Failures = 1
+		}
+		next.LockedUntil = now.Add(policy.delay(next.Failures)).Unix()
+
+		var result dbsql.Result
+		if exists {
+			result, err = db.db.Exec("UPDATE login_throttles SET failures=$1, locked_until=$2, last_failure=$3 WHERE throttle_key=$4 AND failures=$5 AND last_failure=$6",
+				next.Failures, next.LockedUntil, next.LastFailure, key, throttle.Failures, throttle.LastFailure)
+		} else {
+			err = db.pruneLoginThrottles(key, policy)
+			if err != nil {
+				return 0, err
+			}
+			result, err = db.db.Exec("INSERT INTO login_throttles (throttle_key, failures, locked_until, last_failure) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+				key, next.Failures, next.LockedUntil, next.LastFailure)
+		}
+		if err != nil {
+			return 0, err
+		}
+		changed, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if changed == 1 {
+			return 0, nil
+		}
+	}
+}
+
+// ReleaseLoginAttempt takes back the failure ReserveLoginAttempt counted, once the attempt turned out to be
+// successful.
+func (db *sqlImpl) ReleaseLoginAttempt(key string) error {
+	_, err := db.db.Exec("UPDATE login_throttles SET failures=failures-1 WHERE throttle_key=$1 AND failures>0", key)
+	return err
+}
+
+// pruneLoginThrottles deletes throttles of the key's kind that weren't locked or failed for longer than the policy
+// remembers failures. Anybody can create throttles by logging in with made up emails, so they can't be kept forever.
+func (db *sqlImpl) pruneLoginThrottles(key string, policy ThrottlePolicy) error {
+	now := time.Now()
+	kind := strings.SplitN(key, ":", 2)[0]
+	_, err := db.db.Exec("DELETE FROM login_throttles WHERE throttle_key LIKE $1 AND last_failure<$2 AND locked_until<$3",
+		kind+":%", now.Add(-policy.ResetAfter).Unix(), now.Unix())
+	return err
+}
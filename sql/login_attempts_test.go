@@ -0,0 +1,102 @@
+package sql
+
+import (
+	"go.uber.org/zap"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestReserveLoginAttemptConcurrently makes guesses in parallel. Each of them has to be counted and only the free
+// attempts may pass the throttle.
+func TestReserveLoginAttemptConcurrently(t *testing.T) {
+	conn, err := NewSQL("sqlite3", filepath.Join(t.TempDir(), "meetplan.db"), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := conn.(*sqlImpl)
+	defer db.pool.Close()
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := AccountThrottleKey("ucenec@example.com")
+	policy := ThrottlePolicy{FreeAttempts: 5, MaxDelay: time.Hour, ResetAfter: time.Hour}
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	passed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := db.ReserveLoginAttempt(key, policy)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mutex.Lock()
+				passed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The sixth attempt is counted and locks the key for everybody after it
+	if passed != policy.FreeAttempts+1 {
+		t.Errorf("attempts that passed the throttle: got %d, want %d", passed, policy.FreeAttempts+1)
+	}
+	throttle, err := db.GetLoginThrottle(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != passed {
+		t.Errorf("failures: got %d, want %d", throttle.Failures, passed)
+	}
+}
+
+// TestReserveLoginAttemptPrunesStaleThrottles checks that throttles of made up emails don't pile up.
+func TestReserveLoginAttemptPrunesStaleThrottles(t *testing.T) {
+	conn, err := NewInMemorySQLite(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := conn.(*sqlImpl)
+	defer db.pool.Close()
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * AccountThrottlePolicy.ResetAfter).Unix()
+	stale := []LoginThrottle{
+		{Key: AccountThrottleKey("izmisljen@example.com"), Failures: 3, LockedUntil: old, LastFailure: old},
+		{Key: AccountThrottleKey("zaklenjen@example.com"), Failures: 10, LockedUntil: time.Now().Add(time.Hour).Unix(), LastFailure: old},
+		{Key: IPThrottleKey("192.0.2.1"), Failures: 3, LockedUntil: old, LastFailure: old},
+	}
+	for _, throttle := range stale {
+		_, err = db.db.NamedExec("INSERT INTO login_throttles (throttle_key, failures, locked_until, last_failure) VALUES (:throttle_key, :failures, :locked_until, :last_failure)", throttle)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.ReserveLoginAttempt(AccountThrottleKey("ucenec@example.com"), AccountThrottlePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.GetLoginThrottle(stale[0].Key)
+	if err == nil {
+		t.Error("stale throttle of an account wasn't pruned")
+	}
+	// Locked keys and keys of another kind are kept
+	for _, throttle := range stale[1:] {
+		_, err = db.GetLoginThrottle(throttle.Key)
+		if err != nil {
+			t.Errorf("throttle %s: %s", throttle.Key, err.Error())
+		}
+	}
+}
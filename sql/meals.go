@@ -3,10 +3,9 @@ package sql
 type Meal struct {
 	ID            int
 	Meals         string
-	Date          string
+	Date          Date
 	MealTitle     string `db:"meal_title"`
 	Price         float32
-	Orders        string
 	IsLimited     bool `db:"is_limited"`
 	OrderLimit    int  `db:"order_limit"`
 	IsVegan       bool `db:"is_vegan"`
@@ -20,38 +19,65 @@ func (db *sqlImpl) GetMeal(id int) (meal Meal, err error) {
 	return meal, err
 }
 
-func (db *sqlImpl) InsertMeal(meal Meal) (err error) {
-	_, err = db.db.NamedExec(
-		"INSERT INTO meals (id, meals, date, meal_title, price, is_vegan, is_vegetarian, is_lactose_free, orders, order_limit, is_limited, block_orders) VALUES (:id, :meals, :date, :meal_title, :price, :is_vegan, :is_vegetarian, :is_lactose_free, :orders, :order_limit, :is_limited, :block_orders)",
+func (db *sqlImpl) InsertMeal(meal Meal) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO meals (meals, date, meal_title, price, is_vegan, is_vegetarian, is_lactose_free, order_limit, is_limited, block_orders) VALUES (:meals, :date, :meal_title, :price, :is_vegan, :is_vegetarian, :is_lactose_free, :order_limit, :is_limited, :block_orders)",
 		meal)
-	return err
 }
 
 func (db *sqlImpl) UpdateMeal(meal Meal) error {
 	_, err := db.db.NamedExec(
-		"UPDATE meals SET meals=:meals, date=:date, meal_title=:meal_title, price=:price, is_vegan=:is_vegan, is_vegetarian=:is_vegetarian, is_lactose_free=:is_lactose_free, orders=:orders, order_limit=:order_limit, is_limited=:is_limited, block_orders=:block_orders WHERE id=:id",
+		"UPDATE meals SET meals=:meals, date=:date, meal_title=:meal_title, price=:price, is_vegan=:is_vegan, is_vegetarian=:is_vegetarian, is_lactose_free=:is_lactose_free, order_limit=:order_limit, is_limited=:is_limited, block_orders=:block_orders WHERE id=:id",
 		meal)
 	return err
 }
 
-func (db *sqlImpl) GetLastMealID() (id int) {
-	err := db.db.Get(&id, "SELECT id FROM meals WHERE id = (SELECT MAX(id) FROM meals)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
+func (db *sqlImpl) GetMeals() (meals []Meal, err error) {
+	err = db.db.Select(&meals, "SELECT * FROM meals ORDER BY date ASC, id ASC")
+	return meals, err
+}
+
+func (db *sqlImpl) DeleteMeal(ID int) error {
+	return db.execAll([]string{
+		"DELETE FROM meal_orders WHERE meal_id=$1",
+		"DELETE FROM meals WHERE id=$1",
+	}, ID)
+}
+
+// GetMealOrders returns IDs of the users who ordered the meal.
+func (db *sqlImpl) GetMealOrders(mealId int) (orders []int, err error) {
+	err = db.db.Select(&orders, "SELECT user_id FROM meal_orders WHERE meal_id=$1 ORDER BY user_id ASC", mealId)
+	if orders == nil {
+		orders = make([]int, 0)
 	}
-	return id + 1
+	return orders, err
 }
 
-func (db *sqlImpl) GetMeals() (meals []Meal, err error) {
-	err = db.db.Select(&meals, "SELECT * FROM meals ORDER BY id ASC")
+func (db *sqlImpl) GetMealsForUser(userId int) (meals []Meal, err error) {
+	err = db.db.Select(&meals,
+		"SELECT meals.* FROM meals JOIN meal_orders ON meal_orders.meal_id=meals.id WHERE meal_orders.user_id=$1 ORDER BY meals.date ASC, meals.id ASC",
+		userId)
+	if meals == nil {
+		meals = make([]Meal, 0)
+	}
 	return meals, err
 }
 
-func (db *sqlImpl) DeleteMeal(ID int) error {
-	_, err := db.db.Exec("DELETE FROM meals WHERE id=$1", ID)
+// AddMealOrder orders the meal for the user. The order limit is checked in the same statement, so concurrent
+// orders can't exceed it. ordered is false when the meal is sold out or the user has already ordered it.
+func (db *sqlImpl) AddMealOrder(mealId int, userId int) (ordered bool, err error) {
+	// PostgreSQL can't infer the type of a parameter in the select list, so the user ID is cast explicitly
+	res, err := db.db.Exec(
+		"INSERT INTO meal_orders (meal_id, user_id) SELECT id, CAST($1 AS INTEGER) FROM meals WHERE id=$2 AND (NOT is_limited OR order_limit > (SELECT COUNT(*) FROM meal_orders WHERE meal_id=$2)) ON CONFLICT DO NOTHING",
+		userId, mealId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected == 1, err
+}
+
+func (db *sqlImpl) RemoveMealOrder(mealId int, userId int) error {
+	_, err := db.db.Exec("DELETE FROM meal_orders WHERE meal_id=$1 AND user_id=$2", mealId, userId)
 	return err
 }
@@ -1,12 +1,14 @@
 package sql
 
+import "github.com/jmoiron/sqlx"
+
 type Meeting struct {
 	ID             int    `db:"id"`
 	MeetingName    string `db:"meeting_name"`
 	TeacherID      int    `db:"teacher_id"`
 	SubjectID      int    `db:"subject_id"`
 	Hour           int    `db:"hour"`
-	Date           string `db:"date"`
+	Date           Date   `db:"date"`
 	IsMandatory    bool   `db:"is_mandatory"`
 	URL            string `db:"url"`
 	Details        string `db:"details"`
@@ -16,6 +18,8 @@ type Meeting struct {
 	IsWrittenAssessment bool `db:"is_written_assessment"`
 	// Preverjanje znanja
 	IsTest bool `db:"is_test"`
+	// Template the meeting was created from, 0 for meetings created on their own
+	TemplateID int `db:"template_id"`
 }
 
 func (db *sqlImpl) GetMeeting(id int) (meeting Meeting, err error) {
@@ -23,17 +27,23 @@ func (db *sqlImpl) GetMeeting(id int) (meeting Meeting, err error) {
 	return meeting, err
 }
 
-func (db *sqlImpl) GetMeetingsOnSpecificTime(date string, hour int) (meetings []Meeting, err error) {
+func (db *sqlImpl) GetMeetingsOnSpecificTime(date Date, hour int) (meetings []Meeting, err error) {
 	err = db.db.Select(&meetings, "SELECT * FROM meetings WHERE date=$1 AND hour=$2 ORDER BY id ASC", date, hour)
 	return meetings, err
 }
 
-func (db *sqlImpl) GetMeetingsOnSpecificDate(date string) (meetings []Meeting, err error) {
+func (db *sqlImpl) GetMeetingsOnSpecificDate(date Date) (meetings []Meeting, err error) {
 	err = db.db.Select(&meetings, "SELECT * FROM meetings WHERE date=$1 ORDER BY id ASC", date)
 	return meetings, err
 }
 
-func (db *sqlImpl) GetMeetingsForTeacherOnSpecificDate(teacherId int, date string) (meetings []Meeting, err error) {
+// GetMeetingsBetween returns meetings from the first to the last day, both included, ordered by date and hour.
+func (db *sqlImpl) GetMeetingsBetween(from Date, to Date) (meetings []Meeting, err error) {
+	err = db.db.Select(&meetings, "SELECT * FROM meetings WHERE date>=$1 AND date<=$2 ORDER BY date ASC, hour ASC, id ASC", from, to)
+	return meetings, err
+}
+
+func (db *sqlImpl) GetMeetingsForTeacherOnSpecificDate(teacherId int, date Date) (meetings []Meeting, err error) {
 	err = db.db.Select(&meetings, "SELECT * FROM meetings WHERE date=$1 AND teacher_id=$2 ORDER BY id ASC", date, teacherId)
 	return meetings, err
 }
@@ -43,17 +53,15 @@ func (db *sqlImpl) GetMeetingsForSubject(subjectId int) (meetings []Meeting, err
 	return meetings, err
 }
 
-func (db *sqlImpl) InsertMeeting(meeting Meeting) (err error) {
+func (db *sqlImpl) InsertMeeting(meeting Meeting) (id int, err error) {
 	i := `
-	INSERT INTO meetings (id, meeting_name, teacher_id, subject_id, hour, date, is_mandatory, url, details, is_grading, is_written_assessment, is_test, is_substitution)
-		VALUES (:id, :meeting_name, :teacher_id, :subject_id, :hour, :date, :is_mandatory, :url, :details, :is_grading, :is_written_assessment, :is_test, :is_substitution)
+	INSERT INTO meetings (meeting_name, teacher_id, subject_id, hour, date, is_mandatory, url, details, is_grading, is_written_assessment, is_test, is_substitution, template_id)
+		VALUES (:meeting_name, :teacher_id, :subject_id, :hour, :date, :is_mandatory, :url, :details, :is_grading, :is_written_assessment, :is_test, :is_substitution, :template_id)
 	`
-	_, err = db.db.NamedExec(
-		i,
-		meeting)
-	return err
+	return db.insert(db.db, i, meeting)
 }
 
+// UpdateMeeting doesn't change the template of the meeting, edited meetings still follow their template.
 func (db *sqlImpl) UpdateMeeting(meeting Meeting) error {
 	i := `
 	UPDATE meetings SET meeting_name=:meeting_name, teacher_id=:teacher_id,
@@ -68,16 +76,34 @@ func (db *sqlImpl) UpdateMeeting(meeting Meeting) error {
 	return err
 }
 
-func (db *sqlImpl) GetLastMeetingID() (id int) {
-	err := db.db.Get(&id, "SELECT id FROM meetings WHERE id = (SELECT MAX(id) FROM meetings)")
+// WithMeetingsLocked runs fn with the database bound to one transaction, in which other transactions can't
+// write meetings. Scheduling conflicts are checked and the meeting is saved in fn, so two meetings that
+// conflict can't both pass the check. SQLite already serializes writes, a transaction that read meetings
+// fails to commit when another one changed them meanwhile.
+func (db *sqlImpl) WithMeetingsLocked(fn func(tx SQL) error) error {
+	tx, err := db.begin()
 	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
+		return err
+	}
+	defer tx.Rollback()
+	if db.driver == "postgres" {
+		_, err = tx.Exec("LOCK TABLE meetings IN SHARE ROW EXCLUSIVE MODE")
+		if err != nil {
+			return err
 		}
-		db.logger.Info(err)
-		return -1
 	}
-	return id + 1
+	var bound *sqlImpl
+	switch t := tx.(type) {
+	case *sqlx.Tx:
+		bound = db.withTx(t)
+	case *savepoint:
+		bound = db.withTx(t.Tx)
+	}
+	err = fn(bound)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (db *sqlImpl) GetMeetings() (meetings []Meeting, err error) {
@@ -86,7 +112,7 @@ func (db *sqlImpl) GetMeetings() (meetings []Meeting, err error) {
 }
 
 func (db *sqlImpl) GetMeetingsForSubjectWithIDLower(id int, subjectId int) (meetings []Meeting, err error) {
-	err = db.db.Select(&meetings, "SELECT * FROM meetings WHERE id<=$1 AND subject_id=$2", id, subjectId)
+	err = db.db.Select(&meetings, "SELECT * FROM meetings WHERE id<=$1 AND subject_id=$2 ORDER BY id ASC", id, subjectId)
 	return meetings, err
 }
 
@@ -0,0 +1,31 @@
+package sql
+
+import "fmt"
+
+// Rows of the membership tables, which link users with classes, subjects, parents, meals, messages and
+// communications. They used to be JSON encoded lists of user IDs stored with the class, subject etc.
+
+type ClassStudent struct {
+	ClassID int `db:"class_id" json:"class_id"`
+	UserID  int `db:"user_id" json:"user_id"`
+}
+
+type SubjectStudent struct {
+	SubjectID int `db:"subject_id" json:"subject_id"`
+	UserID    int `db:"user_id" json:"user_id"`
+}
+
+type ParentChild struct {
+	ParentID  int `db:"parent_id" json:"parent_id"`
+	StudentID int `db:"student_id" json:"student_id"`
+}
+
+type MealOrder struct {
+	MealID int `db:"meal_id" json:"meal_id"`
+	UserID int `db:"user_id" json:"user_id"`
+}
+
+// membershipID is the entity ID of membership rows in the audit log.
+func membershipID(groupId int, userId int) string {
+	return fmt.Sprintf("%d:%d", groupId, userId)
+}
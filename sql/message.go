@@ -1,14 +1,13 @@
 package sql
 
-import "encoding/json"
+import "time"
 
 type Message struct {
 	ID              int
 	CommunicationID int `db:"communication_id"`
 	UserID          int `db:"user_id"`
 	Body            string
-	Seen            string
-	DateCreated     string `db:"date_created"`
+	DateCreated     time.Time `db:"date_created"`
 }
 
 func (db *sqlImpl) GetMessage(id int) (message Message, err error) {
@@ -21,64 +20,53 @@ func (db *sqlImpl) GetCommunicationMessages(communicationId int) (messages []Mes
 	return messages, err
 }
 
-func (db *sqlImpl) InsertMessage(message Message) (err error) {
-	_, err = db.db.NamedExec(
-		"INSERT INTO message (id, communication_id, body, seen, date_created, user_id) VALUES (:id, :communication_id, :body, :seen, :date_created, :user_id)",
+func (db *sqlImpl) InsertMessage(message Message) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO message (communication_id, body, date_created, user_id) VALUES (:communication_id, :body, :date_created, :user_id)",
 		message)
-	return err
 }
 
 func (db *sqlImpl) UpdateMessage(message Message) error {
 	_, err := db.db.NamedExec(
-		"UPDATE message SET body=:body, seen=:seen WHERE id=:id",
+		"UPDATE message SET body=:body WHERE id=:id",
 		message)
 	return err
 }
 
-func (db *sqlImpl) GetLastMessageID() (id int) {
-	err := db.db.Get(&id, "SELECT id FROM message WHERE id = (SELECT MAX(id) FROM message)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
 func (db *sqlImpl) GetAllMessages() (messages []Message, err error) {
 	err = db.db.Select(&messages, "SELECT * FROM message ORDER BY id ASC")
 	return messages, err
 }
 
+// GetAllUnreadMessages returns messages from the user's communications the user hasn't seen yet.
 func (db *sqlImpl) GetAllUnreadMessages(userId int) (messages []Message, err error) {
-	err = db.db.Select(&messages, "SELECT * FROM message ORDER BY id ASC")
-	var unread = make([]Message, 0)
-	for i := 0; i < len(messages); i++ {
-		message := messages[i]
-		var users []int
-		err := json.Unmarshal([]byte(message.Seen), &users)
-		if err != nil {
-			return make([]Message, 0), err
-		}
-		var communicationUsers []int
-		communication, err := db.GetCommunication(message.CommunicationID)
-		if err != nil {
-			return nil, err
-		}
-		err = json.Unmarshal([]byte(communication.People), &communicationUsers)
-		if err != nil {
-			return make([]Message, 0), err
-		}
-		if contains(communicationUsers, userId) && !contains(users, userId) {
-			unread = append(unread, message)
-		}
+	err = db.db.Select(&messages,
+		"SELECT * FROM message WHERE communication_id IN (SELECT communication_id FROM communication_people WHERE user_id=$1) AND id NOT IN (SELECT message_id FROM message_seen WHERE user_id=$1) ORDER BY id ASC",
+		userId)
+	if messages == nil {
+		messages = make([]Message, 0)
 	}
-	return unread, err
+	return messages, err
 }
 
 func (db *sqlImpl) DeleteMessage(ID int) error {
-	_, err := db.db.Exec("DELETE FROM message WHERE id=$1", ID)
+	return db.execAll([]string{
+		"DELETE FROM message_seen WHERE message_id=$1",
+		"DELETE FROM message WHERE id=$1",
+	}, ID)
+}
+
+// GetMessageSeen returns IDs of the users who have seen the message.
+func (db *sqlImpl) GetMessageSeen(messageId int) (users []int, err error) {
+	err = db.db.Select(&users, "SELECT user_id FROM message_seen WHERE message_id=$1 ORDER BY user_id ASC", messageId)
+	if users == nil {
+		users = make([]int, 0)
+	}
+	return users, err
+}
+
+// MarkMessageSeen does nothing when the user has already seen the message.
+func (db *sqlImpl) MarkMessageSeen(messageId int, userId int) error {
+	_, err := db.db.Exec("INSERT INTO message_seen (message_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", messageId, userId)
 	return err
 }
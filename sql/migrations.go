@@ -0,0 +1,351 @@
+package sql
+
+import (
+	"embed"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migrations are embedded into the binary and applied in order of their version. Each migration consists of
+// NNNN_name.up.sql and NNNN_name.down.sql. When a driver needs different SQL, NNNN_name.<driver>.up.sql
+// (and .down.sql) is used instead for that driver.
+//
+// 0001_initial contains the whole schema as it was before the migration runner, including the columns that
+// used to be added by hand with the loose files in migrations/. Its tables are created with IF NOT EXISTS,
+// so existing databases keep their tables, and columns of legacyColumns they lack are added when it's applied.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+?)(?:\.(sqlite3|postgres))?\.(up|down)\.sql$`)
+
+const schemaMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version                 INTEGER         PRIMARY KEY,
+	name                    VARCHAR(200)    NOT NULL,
+	applied_at              INTEGER         NOT NULL
+);`
+
+// legacyColumns were added to existing databases by hand with the loose files that used to be in migrations/.
+// Databases that skipped some of the files would fail later migrations without them.
+var legacyColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"users", "birth_certificate_number", "VARCHAR(200) DEFAULT ''"},
+	{"users", "birthday", "VARCHAR(200) DEFAULT ''"},
+	{"users", "country_of_birth", "VARCHAR(200) DEFAULT ''"},
+	{"users", "city_of_birth", "VARCHAR(200) DEFAULT ''"},
+	{"users", "users", "VARCHAR(200) DEFAULT '[]'"},
+	{"users", "is_passing", "BOOLEAN DEFAULT true"},
+	{"users", "totp_secret", "VARCHAR(100) DEFAULT ''"},
+	{"users", "totp_enabled", "BOOLEAN DEFAULT false"},
+	{"users", "totp_last_step", "INTEGER DEFAULT 0"},
+	{"sessions", "two_factor", "BOOLEAN DEFAULT false"},
+	{"classes", "class_year", "VARCHAR(20) DEFAULT ''"},
+	{"classes", "sok", "INTEGER DEFAULT 1"},
+	{"classes", "eok", "INTEGER DEFAULT 1"},
+	{"classes", "last_school_date", "INTEGER DEFAULT 1649521548"},
+	{"meetings", "is_substitution", "BOOLEAN DEFAULT false"},
+	{"absence", "is_excused", "BOOLEAN DEFAULT false"},
+	{"grades", "is_final", "BOOLEAN DEFAULT false"},
+	{"grades", "can_patch", "BOOLEAN DEFAULT true"},
+	{"subject", "long_name", "VARCHAR(200) DEFAULT ''"},
+	{"subject", "realization", "FLOAT DEFAULT 0.0"},
+	{"meals", "block_orders", "BOOLEAN DEFAULT false"},
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	AppliedAt int64  `json:"applied_at" db:"applied_at"`
+}
+
+// LoadMigrations returns migrations for the driver, sorted by version.
+func LoadMigrations(driver string) ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make(map[int]*Migration)
+	// Driver specific files take precedence over the generic ones, regardless of the order we read them in
+	specific := make(map[string]bool)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		fileDriver := match[3]
+		if fileDriver != "" && fileDriver != driver {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		m, ok := migrations[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			migrations[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.Name, match[2], version)
+		}
+		key := match[1] + "." + match[4]
+		if fileDriver == "" && specific[key] {
+			continue
+		}
+		if fileDriver != "" {
+			specific[key] = true
+		}
+		contents, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if match[4] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	sorted := make([]Migration, 0)
+	for _, m := range migrations {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		sorted = append(sorted, *m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted, nil
+}
+
+// LatestSchemaVersion is the version of the newest migration embedded into this binary.
+func LatestSchemaVersion() int {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return 0
+	}
+	latest := 0
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err == nil && version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
+
+func (db *sqlImpl) getAppliedMigrations() (applied []MigrationStatus, err error) {
+	_, err = db.db.Exec(schemaMigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	err = db.db.Select(&applied, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version ASC")
+	for i := 0; i < len(applied); i++ {
+		applied[i].Applied = true
+	}
+	return applied, err
+}
+
+// SchemaVersion returns the version of the newest migration applied to the database, 0 if none was applied.
+func (db *sqlImpl) SchemaVersion() (int, error) {
+	applied, err := db.getAppliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 {
+		return 0, nil
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// GetMigrationStatus lists all known migrations together with the applied ones this binary doesn't know about.
+func (db *sqlImpl) GetMigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations(db.driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.getAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	appliedByVersion := make(map[int]MigrationStatus)
+	for _, m := range applied {
+		appliedByVersion[m.Version] = m
+	}
+	status := make([]MigrationStatus, 0)
+	for _, m := range migrations {
+		s, ok := appliedByVersion[m.Version]
+		if !ok {
+			s = MigrationStatus{Version: m.Version, Name: m.Name}
+		}
+		delete(appliedByVersion, m.Version)
+		status = append(status, s)
+	}
+	for _, s := range appliedByVersion {
+		status = append(status, s)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+func (db *sqlImpl) checkNotNewer() error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latest := LatestSchemaVersion()
+	if version > latest {
+		return fmt.Errorf("database schema version %d is newer than the newest version %d known to this MeetPlan binary, please upgrade MeetPlan", version, latest)
+	}
+	return nil
+}
+
+// CheckSchemaVersion makes sure that all migrations were applied and that the database wasn't migrated
+// by a newer MeetPlan binary.
+func (db *sqlImpl) CheckSchemaVersion() error {
+	err := db.checkNotNewer()
+	if err != nil {
+		return err
+	}
+	status, err := db.GetMigrationStatus()
+	if err != nil {
+		return err
+	}
+	for _, s := range status {
+		if !s.Applied {
+			return fmt.Errorf("migration %04d_%s hasn't been applied yet, run the migrate up command", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// adoptLegacyColumns adds columns of legacyColumns that tables of an existing database lack.
+func (db *sqlImpl) adoptLegacyColumns(tx database) error {
+	for _, c := range legacyColumns {
+		query := "SELECT COUNT(*) FROM pragma_table_info($1) WHERE name=$2"
+		if db.driver == "postgres" {
+			query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=$1 AND column_name=$2"
+		}
+		n, err := count(tx, query, c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if n != 0 {
+			continue
+		}
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition))
+		if err != nil {
+			return err
+		}
+		db.logger.Infow("added legacy column", "table", c.table, "column", c.column)
+	}
+	return nil
+}
+
+func (db *sqlImpl) runMigration(version int, name string, statements string, up bool) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(statements)
+	if err == nil && up && version == 1 {
+		err = db.adoptLegacyColumns(tx)
+	}
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %s", version, name, err.Error())
+	}
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)", version, name, time.Now().Unix())
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version=$1", version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateUp applies all pending migrations in order. Each migration runs in its own transaction.
+func (db *sqlImpl) MigrateUp() (applied []MigrationStatus, err error) {
+	applied = make([]MigrationStatus, 0)
+	err = db.checkNotNewer()
+	if err != nil {
+		return applied, err
+	}
+	migrations, err := LoadMigrations(db.driver)
+	if err != nil {
+		return applied, err
+	}
+	status, err := db.GetMigrationStatus()
+	if err != nil {
+		return applied, err
+	}
+	done := make(map[int]bool)
+	for _, s := range status {
+		done[s.Version] = s.Applied
+	}
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+		err = db.runMigration(m.Version, m.Name, m.Up, true)
+		if err != nil {
+			return applied, err
+		}
+		db.logger.Infow("applied migration", "version", m.Version, "name", m.Name)
+		applied = append(applied, MigrationStatus{Version: m.Version, Name: m.Name, Applied: true, AppliedAt: time.Now().Unix()})
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the given number of the newest applied migrations.
+func (db *sqlImpl) MigrateDown(steps int) (reverted []MigrationStatus, err error) {
+	reverted = make([]MigrationStatus, 0)
+	migrations, err := LoadMigrations(db.driver)
+	if err != nil {
+		return reverted, err
+	}
+	byVersion := make(map[int]Migration)
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+	applied, err := db.getAppliedMigrations()
+	if err != nil {
+		return reverted, err
+	}
+	for i := len(applied) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m, ok := byVersion[applied[i].Version]
+		if !ok {
+			return reverted, fmt.Errorf("migration %04d_%s is unknown to this MeetPlan binary and can't be reverted", applied[i].Version, applied[i].Name)
+		}
+		err = db.runMigration(m.Version, m.Name, m.Down, false)
+		if err != nil {
+			return reverted, err
+		}
+		db.logger.Infow("reverted migration", "version", m.Version, "name", m.Name)
+		reverted = append(reverted, MigrationStatus{Version: m.Version, Name: m.Name, Applied: false})
+	}
+	return reverted, nil
+}
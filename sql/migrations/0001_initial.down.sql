@@ -0,0 +1,29 @@
+DROP INDEX IF EXISTS audit_log_user;
+DROP INDEX IF EXISTS audit_log_entity;
+DROP TABLE IF EXISTS impersonation_log;
+DROP TABLE IF EXISTS legal_holds;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS oidc_states;
+DROP TABLE IF EXISTS child_invitations;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS login_throttles;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS two_factor_roles;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS signing_keys;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS meals;
+DROP TABLE IF EXISTS message;
+DROP TABLE IF EXISTS communication;
+DROP TABLE IF EXISTS homework;
+DROP TABLE IF EXISTS student_homework;
+DROP TABLE IF EXISTS subject;
+DROP TABLE IF EXISTS grades;
+DROP TABLE IF EXISTS absence;
+DROP TABLE IF EXISTS meetings;
+DROP TABLE IF EXISTS classes;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS testing;
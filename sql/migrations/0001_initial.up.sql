@@ -0,0 +1,231 @@
+CREATE TABLE IF NOT EXISTS testing (
+	id           INTEGER                    PRIMARY KEY,
+	user_id      INTEGER                    NOT NULL,
+    date         VARCHAR(250)               NOT NULL,
+	teacher_id   INTEGER                    NOT NULL,
+	class_id     INTEGER                    NOT NULL,
+	result       VARCHAR(250)               NOT NULL
+);
+CREATE TABLE IF NOT EXISTS users (
+    id                       INTEGER        PRIMARY KEY,
+    email                    VARCHAR(250)   NOT NULL,
+    pass                     VARCHAR(250)   NOT NULL,
+	name                     VARCHAR(250)   NOT NULL,
+	role                     VARCHAR(50)    NOT NULL,
+    birth_certificate_number VARCHAR(200),
+    birthday                 VARCHAR(200),
+    country_of_birth         VARCHAR(200),
+    city_of_birth            VARCHAR(200),
+    users                    VARCHAR(200)   DEFAULT('[]'),
+    is_passing               BOOLEAN,
+    totp_secret              VARCHAR(100)   DEFAULT(''),
+    totp_enabled             BOOLEAN        DEFAULT(false),
+    totp_last_step           INTEGER        DEFAULT(0)
+);
+CREATE TABLE IF NOT EXISTS classes (
+	id                       INTEGER        PRIMARY KEY,
+	students                 JSON           DEFAULT('[]'),
+	name                     VARCHAR(100)   NOT NULL,
+    class_year               VARCHAR(20)    DEFAULT(''),
+	last_school_date         INTEGER,
+	teacher                  INTEGER,
+    sok                      INTEGER,
+    eok                      INTEGER
+);
+CREATE TABLE IF NOT EXISTS meetings (
+	id                      INTEGER         PRIMARY KEY,
+	meeting_name            VARCHAR(200)    NOT NULL,
+	url                     VARCHAR(300)    NOT NULL,
+	details                 VARCHAR(1000)   NOT NULL,
+	teacher_id              INTEGER         NOT NULL,
+	subject_id              INTEGER         NOT NULL,
+	hour                    INTEGER         NOT NULL,
+	date                    INTEGER         NOT NULL,
+	is_mandatory            BOOLEAN         NOT NULL,
+	is_grading              BOOLEAN         NOT NULL,
+	is_written_assessment   BOOLEAN,
+	is_test                 BOOLEAN         NOT NULL,
+	is_substitution         BOOLEAN         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS absence (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER,
+	meeting_id              INTEGER,
+	teacher_id              INTEGER,
+	absence_type            VARCHAR(200),
+	is_excused              BOOLEAN
+);
+CREATE TABLE IF NOT EXISTS grades (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER,
+	teacher_id              INTEGER,
+	subject_id              INTEGER,
+	date                    VARCHAR(200),
+	is_written              BOOLEAN,
+	grade                   INTEGER,
+	period                  INTEGER,
+	is_final                BOOLEAN,
+	description             VARCHAR(200),
+	can_patch               BOOLEAN         DEFAULT(true)
+);
+CREATE TABLE IF NOT EXISTS subject (
+	id                      INTEGER         PRIMARY KEY,
+	teacher_id              INTEGER,
+	name                    VARCHAR(200),
+    long_name               VARCHAR(200),
+	inherits_class          BOOLEAN,
+    realization             FLOAT,
+	class_id                INTEGER         DEFAULT(-1),
+	students                JSON            DEFAULT('[]')
+);
+CREATE TABLE IF NOT EXISTS student_homework (
+	id                      INTEGER,
+	user_id                 INTEGER,
+	homework_id             INTEGER,
+	status                  VARCHAR(200)
+);
+CREATE TABLE IF NOT EXISTS homework (
+	id                      INTEGER         PRIMARY KEY,
+	teacher_id              INTEGER,
+	subject_id              INTEGER,
+	name                    VARCHAR(200),
+	description             VARCHAR(1000),
+	from_date               VARCHAR(200),
+	to_date                 VARCHAR(200)
+);
+CREATE TABLE IF NOT EXISTS communication (
+	id                      INTEGER         PRIMARY KEY,
+	people                  JSON            DEFAULT('[]'),
+	title                   VARCHAR(200),
+	date_created            VARCHAR(200)
+);
+CREATE TABLE IF NOT EXISTS message (
+	id                      INTEGER         PRIMARY KEY,
+	communication_id        INTEGER,
+	user_id                 INTEGER,
+	body                    VARCHAR(3000),
+	seen                    JSON,
+	date_created            VARCHAR(200)
+);
+CREATE TABLE IF NOT EXISTS meals (
+	id                      INTEGER         PRIMARY KEY,
+	meals                   VARCHAR(3000),
+	date                    VARCHAR(200),
+	meal_title              VARCHAR(3000),
+	price                   FLOAT,
+	orders                  JSON,
+	is_limited              BOOLEAN,
+	order_limit             INTEGER,
+	is_vegan                BOOLEAN,
+	is_vegetarian           BOOLEAN,
+	is_lactose_free         BOOLEAN,
+	block_orders            BOOLEAN
+);
+CREATE TABLE IF NOT EXISTS notifications (
+	id                      INTEGER         PRIMARY KEY,
+	notification            VARCHAR(3000)
+);
+CREATE TABLE IF NOT EXISTS sessions (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER         NOT NULL,
+	refresh_token           VARCHAR(200)    NOT NULL,
+	created_at              INTEGER         NOT NULL,
+	expires_at              INTEGER         NOT NULL,
+	is_revoked              BOOLEAN         NOT NULL,
+	two_factor              BOOLEAN         DEFAULT(false)
+);
+CREATE TABLE IF NOT EXISTS signing_keys (
+	id                      INTEGER         PRIMARY KEY,
+	kid                     VARCHAR(50)     NOT NULL,
+	secret                  VARCHAR(200)    NOT NULL,
+	created_at              INTEGER         NOT NULL,
+	expires_at              INTEGER         NOT NULL,
+	is_active               BOOLEAN         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER         NOT NULL,
+	code                    VARCHAR(200)    NOT NULL,
+	is_used                 BOOLEAN         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS two_factor_roles (
+	role                    VARCHAR(50)     PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS password_resets (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER         NOT NULL,
+	token                   VARCHAR(200)    NOT NULL,
+	expires_at              INTEGER         NOT NULL,
+	is_used                 BOOLEAN         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS login_attempts (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER,
+	email                   VARCHAR(250),
+	ip                      VARCHAR(100),
+	is_successful           BOOLEAN         NOT NULL,
+	reason                  VARCHAR(200),
+	created_at              INTEGER         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS login_throttles (
+	throttle_key            VARCHAR(300)    PRIMARY KEY,
+	failures                INTEGER         NOT NULL,
+	locked_until            INTEGER         NOT NULL,
+	last_failure            INTEGER         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS roles (
+	name                    VARCHAR(100)    PRIMARY KEY,
+	description             VARCHAR(500)    NOT NULL DEFAULT '',
+	is_builtin              BOOLEAN         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role                    VARCHAR(100)    NOT NULL,
+	permission              VARCHAR(100)    NOT NULL,
+	PRIMARY KEY (role, permission)
+);
+CREATE TABLE IF NOT EXISTS child_invitations (
+	id                      INTEGER         PRIMARY KEY,
+	student_id              INTEGER         NOT NULL,
+	code                    VARCHAR(100)    NOT NULL UNIQUE,
+	created_by              INTEGER         NOT NULL,
+	expires_at              INTEGER         NOT NULL,
+	is_used                 BOOLEAN         NOT NULL,
+	used_by                 INTEGER         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS oidc_states (
+	state                   VARCHAR(200)    PRIMARY KEY,
+	nonce                   VARCHAR(200)    NOT NULL,
+	expires_at              INTEGER         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS audit_log (
+	id                      INTEGER         PRIMARY KEY,
+	created_at              INTEGER         NOT NULL,
+	user_id                 INTEGER         NOT NULL,
+	role                    VARCHAR(100)    NOT NULL,
+	endpoint                VARCHAR(300)    NOT NULL,
+	entity_type             VARCHAR(100)    NOT NULL,
+	entity_id               VARCHAR(100)    NOT NULL,
+	action                  VARCHAR(20)     NOT NULL,
+	before_data             TEXT            NOT NULL,
+	after_data              TEXT            NOT NULL,
+	prev_hash               VARCHAR(64)     NOT NULL,
+	hash                    VARCHAR(64)     NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_entity ON audit_log (entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_user ON audit_log (user_id);
+CREATE TABLE IF NOT EXISTS legal_holds (
+	user_id                 INTEGER         PRIMARY KEY,
+	reason                  VARCHAR(1000)   NOT NULL,
+	created_by              INTEGER         NOT NULL,
+	created_at              INTEGER         NOT NULL
+);
+CREATE TABLE IF NOT EXISTS impersonation_log (
+	id                      INTEGER         PRIMARY KEY,
+	admin_id                INTEGER         NOT NULL,
+	user_id                 INTEGER         NOT NULL,
+	method                  VARCHAR(10)     NOT NULL,
+	endpoint                VARCHAR(300)    NOT NULL,
+	ip                      VARCHAR(100),
+	is_allowed              BOOLEAN         NOT NULL,
+	created_at              INTEGER         NOT NULL
+);
@@ -0,0 +1,10 @@
+CREATE TABLE student_homework_old (
+	id                      INTEGER,
+	user_id                 INTEGER,
+	homework_id             INTEGER,
+	status                  VARCHAR(200)
+);
+INSERT INTO student_homework_old (id, user_id, homework_id, status)
+	SELECT id, user_id, homework_id, status FROM student_homework;
+DROP TABLE student_homework;
+ALTER TABLE student_homework_old RENAME TO student_homework;
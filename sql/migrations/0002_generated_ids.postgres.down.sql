@@ -0,0 +1,23 @@
+ALTER TABLE testing ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE users ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE classes ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE meetings ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE absence ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE grades ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE subject ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE homework ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE communication ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE message ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE meals ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE notifications ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE sessions ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE signing_keys ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE recovery_codes ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE password_resets ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE login_attempts ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE child_invitations ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE audit_log ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE impersonation_log ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE student_homework ALTER COLUMN id DROP IDENTITY IF EXISTS;
+ALTER TABLE student_homework DROP CONSTRAINT IF EXISTS student_homework_pkey;
+ALTER TABLE student_homework ALTER COLUMN id DROP NOT NULL;
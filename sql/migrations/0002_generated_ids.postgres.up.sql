@@ -0,0 +1,53 @@
+-- Rows of student_homework with a duplicated or missing ID get a new one, so the column can become the primary key.
+UPDATE student_homework SET id = NULL
+	WHERE ctid IN (SELECT ctid FROM (SELECT ctid, ROW_NUMBER() OVER (PARTITION BY id) AS n FROM student_homework) AS d WHERE n > 1);
+UPDATE student_homework SET id = m.max_id + d.n
+	FROM (SELECT COALESCE(MAX(id), 0) AS max_id FROM student_homework) AS m,
+		(SELECT ctid, ROW_NUMBER() OVER () AS n FROM student_homework WHERE id IS NULL) AS d
+	WHERE student_homework.ctid = d.ctid;
+ALTER TABLE student_homework ALTER COLUMN id SET NOT NULL;
+ALTER TABLE student_homework ADD PRIMARY KEY (id);
+
+-- Identity sequences continue after the largest existing ID
+ALTER TABLE testing ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('testing', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM testing;
+ALTER TABLE users ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('users', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM users;
+ALTER TABLE classes ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('classes', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM classes;
+ALTER TABLE meetings ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('meetings', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM meetings;
+ALTER TABLE absence ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('absence', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM absence;
+ALTER TABLE grades ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('grades', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM grades;
+ALTER TABLE subject ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('subject', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM subject;
+ALTER TABLE homework ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('homework', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM homework;
+ALTER TABLE communication ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('communication', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM communication;
+ALTER TABLE message ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('message', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM message;
+ALTER TABLE meals ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('meals', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM meals;
+ALTER TABLE notifications ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('notifications', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM notifications;
+ALTER TABLE sessions ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('sessions', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM sessions;
+ALTER TABLE signing_keys ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('signing_keys', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM signing_keys;
+ALTER TABLE recovery_codes ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('recovery_codes', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM recovery_codes;
+ALTER TABLE password_resets ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('password_resets', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM password_resets;
+ALTER TABLE login_attempts ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('login_attempts', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM login_attempts;
+ALTER TABLE child_invitations ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('child_invitations', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM child_invitations;
+ALTER TABLE audit_log ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('audit_log', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM audit_log;
+ALTER TABLE impersonation_log ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('impersonation_log', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM impersonation_log;
+ALTER TABLE student_homework ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('student_homework', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM student_homework;
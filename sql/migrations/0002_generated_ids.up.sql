@@ -0,0 +1,16 @@
+-- SQLite generates IDs for INTEGER PRIMARY KEY columns already, only student_homework didn't have a primary key.
+-- Rows with a duplicated or missing ID get a new one.
+CREATE TABLE student_homework_new (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER,
+	homework_id             INTEGER,
+	status                  VARCHAR(200)
+);
+INSERT INTO student_homework_new (id, user_id, homework_id, status)
+	SELECT id, user_id, homework_id, status FROM student_homework
+	WHERE rowid IN (SELECT MIN(rowid) FROM student_homework WHERE id IS NOT NULL GROUP BY id);
+INSERT INTO student_homework_new (user_id, homework_id, status)
+	SELECT user_id, homework_id, status FROM student_homework
+	WHERE rowid NOT IN (SELECT MIN(rowid) FROM student_homework WHERE id IS NOT NULL GROUP BY id);
+DROP TABLE student_homework;
+ALTER TABLE student_homework_new RENAME TO student_homework;
@@ -0,0 +1,19 @@
+ALTER TABLE classes ADD COLUMN students JSON DEFAULT('[]');
+UPDATE classes SET students = '[' || COALESCE((SELECT group_concat(user_id, ',') FROM (SELECT user_id FROM class_students WHERE class_id = classes.id ORDER BY user_id)), '') || ']';
+ALTER TABLE subject ADD COLUMN students JSON DEFAULT('[]');
+UPDATE subject SET students = '[' || COALESCE((SELECT group_concat(user_id, ',') FROM (SELECT user_id FROM subject_students WHERE subject_id = subject.id ORDER BY user_id)), '') || ']';
+ALTER TABLE users ADD COLUMN users VARCHAR(200) DEFAULT('[]');
+UPDATE users SET users = '[' || COALESCE((SELECT group_concat(student_id, ',') FROM (SELECT student_id FROM parent_children WHERE parent_id = users.id ORDER BY student_id)), '') || ']';
+ALTER TABLE meals ADD COLUMN orders JSON;
+UPDATE meals SET orders = '[' || COALESCE((SELECT group_concat(user_id, ',') FROM (SELECT user_id FROM meal_orders WHERE meal_id = meals.id ORDER BY user_id)), '') || ']';
+ALTER TABLE message ADD COLUMN seen JSON;
+UPDATE message SET seen = '[' || COALESCE((SELECT group_concat(user_id, ',') FROM (SELECT user_id FROM message_seen WHERE message_id = message.id ORDER BY user_id)), '') || ']';
+ALTER TABLE communication ADD COLUMN people JSON DEFAULT('[]');
+UPDATE communication SET people = '[' || COALESCE((SELECT group_concat(user_id, ',') FROM (SELECT user_id FROM communication_people WHERE communication_id = communication.id ORDER BY user_id)), '') || ']';
+
+DROP TABLE communication_people;
+DROP TABLE message_seen;
+DROP TABLE meal_orders;
+DROP TABLE parent_children;
+DROP TABLE subject_students;
+DROP TABLE class_students;
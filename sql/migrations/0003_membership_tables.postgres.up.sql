@@ -0,0 +1,64 @@
+-- Memberships that used to be stored as JSON arrays of user IDs get tables of their own. IDs of rows that don't
+-- exist anymore and values that aren't IDs are dropped while copying. Values are checked in CASE before the cast,
+-- as PostgreSQL may evaluate conditions of a join in any order.
+CREATE TABLE class_students (
+	class_id                INTEGER         NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (class_id, user_id)
+);
+CREATE INDEX class_students_user ON class_students (user_id);
+INSERT INTO class_students (class_id, user_id)
+	SELECT DISTINCT c.id, u.id FROM classes c CROSS JOIN json_array_elements_text(CASE WHEN json_typeof(NULLIF(c.students::text, '')::json) = 'array' THEN NULLIF(c.students::text, '')::json ELSE '[]'::json END) AS j(value) JOIN users u ON u.id = CAST(CASE WHEN j.value ~ '^[0-9]{1,9}$' THEN j.value END AS INTEGER);
+
+CREATE TABLE subject_students (
+	subject_id              INTEGER         NOT NULL REFERENCES subject(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (subject_id, user_id)
+);
+CREATE INDEX subject_students_user ON subject_students (user_id);
+INSERT INTO subject_students (subject_id, user_id)
+	SELECT DISTINCT s.id, u.id FROM subject s CROSS JOIN json_array_elements_text(CASE WHEN json_typeof(NULLIF(s.students::text, '')::json) = 'array' THEN NULLIF(s.students::text, '')::json ELSE '[]'::json END) AS j(value) JOIN users u ON u.id = CAST(CASE WHEN j.value ~ '^[0-9]{1,9}$' THEN j.value END AS INTEGER);
+
+CREATE TABLE parent_children (
+	parent_id               INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	student_id              INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (parent_id, student_id)
+);
+CREATE INDEX parent_children_student ON parent_children (student_id);
+INSERT INTO parent_children (parent_id, student_id)
+	SELECT DISTINCT p.id, u.id FROM users p CROSS JOIN json_array_elements_text(CASE WHEN json_typeof(NULLIF(p.users::text, '')::json) = 'array' THEN NULLIF(p.users::text, '')::json ELSE '[]'::json END) AS j(value) JOIN users u ON u.id = CAST(CASE WHEN j.value ~ '^[0-9]{1,9}$' THEN j.value END AS INTEGER)
+	WHERE u.id <> p.id;
+
+CREATE TABLE meal_orders (
+	meal_id                 INTEGER         NOT NULL REFERENCES meals(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (meal_id, user_id)
+);
+CREATE INDEX meal_orders_user ON meal_orders (user_id);
+INSERT INTO meal_orders (meal_id, user_id)
+	SELECT DISTINCT m.id, u.id FROM meals m CROSS JOIN json_array_elements_text(CASE WHEN json_typeof(NULLIF(m.orders::text, '')::json) = 'array' THEN NULLIF(m.orders::text, '')::json ELSE '[]'::json END) AS j(value) JOIN users u ON u.id = CAST(CASE WHEN j.value ~ '^[0-9]{1,9}$' THEN j.value END AS INTEGER);
+
+CREATE TABLE message_seen (
+	message_id              INTEGER         NOT NULL REFERENCES message(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (message_id, user_id)
+);
+CREATE INDEX message_seen_user ON message_seen (user_id);
+INSERT INTO message_seen (message_id, user_id)
+	SELECT DISTINCT m.id, u.id FROM message m CROSS JOIN json_array_elements_text(CASE WHEN json_typeof(NULLIF(m.seen::text, '')::json) = 'array' THEN NULLIF(m.seen::text, '')::json ELSE '[]'::json END) AS j(value) JOIN users u ON u.id = CAST(CASE WHEN j.value ~ '^[0-9]{1,9}$' THEN j.value END AS INTEGER);
+
+CREATE TABLE communication_people (
+	communication_id        INTEGER         NOT NULL REFERENCES communication(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (communication_id, user_id)
+);
+CREATE INDEX communication_people_user ON communication_people (user_id);
+INSERT INTO communication_people (communication_id, user_id)
+	SELECT DISTINCT c.id, u.id FROM communication c CROSS JOIN json_array_elements_text(CASE WHEN json_typeof(NULLIF(c.people::text, '')::json) = 'array' THEN NULLIF(c.people::text, '')::json ELSE '[]'::json END) AS j(value) JOIN users u ON u.id = CAST(CASE WHEN j.value ~ '^[0-9]{1,9}$' THEN j.value END AS INTEGER);
+
+ALTER TABLE classes DROP COLUMN students;
+ALTER TABLE subject DROP COLUMN students;
+ALTER TABLE users DROP COLUMN users;
+ALTER TABLE meals DROP COLUMN orders;
+ALTER TABLE message DROP COLUMN seen;
+ALTER TABLE communication DROP COLUMN people;
@@ -0,0 +1,171 @@
+-- Memberships that used to be stored as JSON arrays of user IDs get tables of their own. IDs of rows that don't
+-- exist anymore are dropped while copying.
+--
+-- SQLite is built without the JSON functions, so the arrays are split with a recursive query into a temporary
+-- table first. Quotes and whitespace are ignored and anything that isn't a number is skipped.
+CREATE TEMPORARY TABLE membership_ids (
+	kind                    VARCHAR(20)     NOT NULL,
+	owner_id                INTEGER         NOT NULL,
+	user_id                 INTEGER         NOT NULL
+);
+WITH RECURSIVE list(kind, owner_id, rest) AS (
+	SELECT 'classes', id, students FROM classes
+	UNION ALL SELECT 'subject', id, students FROM subject
+	UNION ALL SELECT 'users', id, users FROM users
+	UNION ALL SELECT 'meals', id, orders FROM meals
+	UNION ALL SELECT 'message', id, seen FROM message
+	UNION ALL SELECT 'communication', id, people FROM communication
+), item(kind, owner_id, value, rest) AS (
+	SELECT kind, owner_id, '', replace(replace(replace(replace(replace(replace(replace(COALESCE(rest, ''), '[', ''), ']', ''), '"', ''), ' ', ''), char(9), ''), char(10), ''), char(13), '') || ',' FROM list
+	UNION ALL
+	SELECT kind, owner_id, substr(rest, 1, instr(rest, ',') - 1), substr(rest, instr(rest, ',') + 1) FROM item WHERE rest <> ''
+)
+INSERT INTO membership_ids (kind, owner_id, user_id)
+	SELECT kind, owner_id, CAST(value AS INTEGER) FROM item WHERE value <> '' AND value NOT GLOB '*[^0-9]*';
+
+CREATE TABLE class_students (
+	class_id                INTEGER         NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (class_id, user_id)
+);
+CREATE INDEX class_students_user ON class_students (user_id);
+INSERT INTO class_students (class_id, user_id)
+	SELECT DISTINCT c.id, u.id FROM classes c JOIN membership_ids j ON j.kind = 'classes' AND j.owner_id = c.id JOIN users u ON u.id = j.user_id;
+
+CREATE TABLE subject_students (
+	subject_id              INTEGER         NOT NULL REFERENCES subject(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (subject_id, user_id)
+);
+CREATE INDEX subject_students_user ON subject_students (user_id);
+INSERT INTO subject_students (subject_id, user_id)
+	SELECT DISTINCT s.id, u.id FROM subject s JOIN membership_ids j ON j.kind = 'subject' AND j.owner_id = s.id JOIN users u ON u.id = j.user_id;
+
+CREATE TABLE parent_children (
+	parent_id               INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	student_id              INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (parent_id, student_id)
+);
+CREATE INDEX parent_children_student ON parent_children (student_id);
+INSERT INTO parent_children (parent_id, student_id)
+	SELECT DISTINCT p.id, u.id FROM users p JOIN membership_ids j ON j.kind = 'users' AND j.owner_id = p.id JOIN users u ON u.id = j.user_id
+	WHERE u.id <> p.id;
+
+CREATE TABLE meal_orders (
+	meal_id                 INTEGER         NOT NULL REFERENCES meals(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (meal_id, user_id)
+);
+CREATE INDEX meal_orders_user ON meal_orders (user_id);
+INSERT INTO meal_orders (meal_id, user_id)
+	SELECT DISTINCT m.id, u.id FROM meals m JOIN membership_ids j ON j.kind = 'meals' AND j.owner_id = m.id JOIN users u ON u.id = j.user_id;
+
+CREATE TABLE message_seen (
+	message_id              INTEGER         NOT NULL REFERENCES message(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (message_id, user_id)
+);
+CREATE INDEX message_seen_user ON message_seen (user_id);
+INSERT INTO message_seen (message_id, user_id)
+	SELECT DISTINCT m.id, u.id FROM message m JOIN membership_ids j ON j.kind = 'message' AND j.owner_id = m.id JOIN users u ON u.id = j.user_id;
+
+CREATE TABLE communication_people (
+	communication_id        INTEGER         NOT NULL REFERENCES communication(id) ON DELETE CASCADE,
+	user_id                 INTEGER         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (communication_id, user_id)
+);
+CREATE INDEX communication_people_user ON communication_people (user_id);
+INSERT INTO communication_people (communication_id, user_id)
+	SELECT DISTINCT c.id, u.id FROM communication c JOIN membership_ids j ON j.kind = 'communication' AND j.owner_id = c.id JOIN users u ON u.id = j.user_id;
+
+DROP TABLE membership_ids;
+
+-- The bundled SQLite can't drop columns, so the tables are rebuilt without the JSON columns. Foreign keys aren't
+-- enforced on MeetPlan's connections, so dropping the old tables leaves the memberships above intact.
+CREATE TABLE classes_new (
+	id                       INTEGER        PRIMARY KEY,
+	name                     VARCHAR(100)   NOT NULL,
+    class_year               VARCHAR(20)    DEFAULT(''),
+	last_school_date         INTEGER,
+	teacher                  INTEGER,
+    sok                      INTEGER,
+    eok                      INTEGER
+);
+INSERT INTO classes_new (id, name, class_year, last_school_date, teacher, sok, eok)
+	SELECT id, name, class_year, last_school_date, teacher, sok, eok FROM classes;
+DROP TABLE classes;
+ALTER TABLE classes_new RENAME TO classes;
+
+CREATE TABLE subject_new (
+	id                      INTEGER         PRIMARY KEY,
+	teacher_id              INTEGER,
+	name                    VARCHAR(200),
+    long_name               VARCHAR(200),
+	inherits_class          BOOLEAN,
+    realization             FLOAT,
+	class_id                INTEGER         DEFAULT(-1)
+);
+INSERT INTO subject_new (id, teacher_id, name, long_name, inherits_class, realization, class_id)
+	SELECT id, teacher_id, name, long_name, inherits_class, realization, class_id FROM subject;
+DROP TABLE subject;
+ALTER TABLE subject_new RENAME TO subject;
+
+CREATE TABLE users_new (
+    id                       INTEGER        PRIMARY KEY,
+    email                    VARCHAR(250)   NOT NULL,
+    pass                     VARCHAR(250)   NOT NULL,
+	name                     VARCHAR(250)   NOT NULL,
+	role                     VARCHAR(50)    NOT NULL,
+    birth_certificate_number VARCHAR(200),
+    birthday                 VARCHAR(200),
+    country_of_birth         VARCHAR(200),
+    city_of_birth            VARCHAR(200),
+    is_passing               BOOLEAN,
+    totp_secret              VARCHAR(100)   DEFAULT(''),
+    totp_enabled             BOOLEAN        DEFAULT(false),
+    totp_last_step           INTEGER        DEFAULT(0)
+);
+INSERT INTO users_new (id, email, pass, name, role, birth_certificate_number, birthday, country_of_birth, city_of_birth, is_passing, totp_secret, totp_enabled, totp_last_step)
+	SELECT id, email, pass, name, role, birth_certificate_number, birthday, country_of_birth, city_of_birth, is_passing, totp_secret, totp_enabled, totp_last_step FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE TABLE meals_new (
+	id                      INTEGER         PRIMARY KEY,
+	meals                   VARCHAR(3000),
+	date                    VARCHAR(200),
+	meal_title              VARCHAR(3000),
+	price                   FLOAT,
+	is_limited              BOOLEAN,
+	order_limit             INTEGER,
+	is_vegan                BOOLEAN,
+	is_vegetarian           BOOLEAN,
+	is_lactose_free         BOOLEAN,
+	block_orders            BOOLEAN
+);
+INSERT INTO meals_new (id, meals, date, meal_title, price, is_limited, order_limit, is_vegan, is_vegetarian, is_lactose_free, block_orders)
+	SELECT id, meals, date, meal_title, price, is_limited, order_limit, is_vegan, is_vegetarian, is_lactose_free, block_orders FROM meals;
+DROP TABLE meals;
+ALTER TABLE meals_new RENAME TO meals;
+
+CREATE TABLE message_new (
+	id                      INTEGER         PRIMARY KEY,
+	communication_id        INTEGER,
+	user_id                 INTEGER,
+	body                    VARCHAR(3000),
+	date_created            VARCHAR(200)
+);
+INSERT INTO message_new (id, communication_id, user_id, body, date_created)
+	SELECT id, communication_id, user_id, body, date_created FROM message;
+DROP TABLE message;
+ALTER TABLE message_new RENAME TO message;
+
+CREATE TABLE communication_new (
+	id                      INTEGER         PRIMARY KEY,
+	title                   VARCHAR(200),
+	date_created            VARCHAR(200)
+);
+INSERT INTO communication_new (id, title, date_created)
+	SELECT id, title, date_created FROM communication;
+DROP TABLE communication;
+ALTER TABLE communication_new RENAME TO communication;
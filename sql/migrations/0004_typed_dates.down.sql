@@ -0,0 +1,157 @@
+DROP INDEX testing_user_date;
+DROP INDEX meetings_date;
+
+CREATE TABLE testing_new (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER         NOT NULL,
+	date                    VARCHAR(250)    NOT NULL,
+	teacher_id              INTEGER         NOT NULL,
+	class_id                INTEGER         NOT NULL,
+	result                  VARCHAR(250)    NOT NULL
+);
+INSERT INTO testing_new (id, user_id, date, teacher_id, class_id, result)
+	SELECT id, user_id,
+		COALESCE(strftime('%d-%m-%Y', date), ''),
+		teacher_id, class_id, result
+	FROM testing;
+DROP TABLE testing;
+ALTER TABLE testing_new RENAME TO testing;
+
+CREATE TABLE users_new (
+	id                       INTEGER        PRIMARY KEY,
+	email                    VARCHAR(250)   NOT NULL,
+	pass                     VARCHAR(250)   NOT NULL,
+	name                     VARCHAR(250)   NOT NULL,
+	role                     VARCHAR(50)    NOT NULL,
+	birth_certificate_number VARCHAR(200),
+	birthday                 VARCHAR(200),
+	country_of_birth         VARCHAR(200),
+	city_of_birth            VARCHAR(200),
+	is_passing               BOOLEAN,
+	totp_secret              VARCHAR(100)   DEFAULT(''),
+	totp_enabled             BOOLEAN        DEFAULT(false),
+	totp_last_step           INTEGER        DEFAULT(0)
+);
+INSERT INTO users_new (id, email, pass, name, role, birth_certificate_number, birthday, country_of_birth, city_of_birth, is_passing, totp_secret, totp_enabled, totp_last_step)
+	SELECT id, email, pass, name, role, birth_certificate_number, birthday, country_of_birth, city_of_birth, is_passing, totp_secret, totp_enabled, totp_last_step FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE TABLE classes_new (
+	id                       INTEGER        PRIMARY KEY,
+	name                     VARCHAR(100)   NOT NULL,
+	class_year               VARCHAR(20)    DEFAULT(''),
+	last_school_date         INTEGER,
+	teacher                  INTEGER,
+	sok                      INTEGER,
+	eok                      INTEGER
+);
+INSERT INTO classes_new (id, name, class_year, last_school_date, teacher, sok, eok)
+	SELECT id, name, class_year,
+		CAST(strftime('%s', last_school_date, 'utc') AS INTEGER),
+		teacher, sok, eok
+	FROM classes;
+DROP TABLE classes;
+ALTER TABLE classes_new RENAME TO classes;
+
+CREATE TABLE meetings_new (
+	id                      INTEGER         PRIMARY KEY,
+	meeting_name            VARCHAR(200)    NOT NULL,
+	url                     VARCHAR(300)    NOT NULL,
+	details                 VARCHAR(1000)   NOT NULL,
+	teacher_id              INTEGER         NOT NULL,
+	subject_id              INTEGER         NOT NULL,
+	hour                    INTEGER         NOT NULL,
+	date                    INTEGER         NOT NULL,
+	is_mandatory            BOOLEAN         NOT NULL,
+	is_grading              BOOLEAN         NOT NULL,
+	is_written_assessment   BOOLEAN,
+	is_test                 BOOLEAN         NOT NULL,
+	is_substitution         BOOLEAN         NOT NULL
+);
+INSERT INTO meetings_new (id, meeting_name, url, details, teacher_id, subject_id, hour, date, is_mandatory, is_grading, is_written_assessment, is_test, is_substitution)
+	SELECT id, meeting_name, url, details, teacher_id, subject_id, hour,
+		COALESCE(strftime('%d-%m-%Y', date), ''),
+		is_mandatory, is_grading, is_written_assessment, is_test, is_substitution
+	FROM meetings;
+DROP TABLE meetings;
+ALTER TABLE meetings_new RENAME TO meetings;
+
+CREATE TABLE grades_new (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER,
+	teacher_id              INTEGER,
+	subject_id              INTEGER,
+	date                    VARCHAR(200),
+	is_written              BOOLEAN,
+	grade                   INTEGER,
+	period                  INTEGER,
+	is_final                BOOLEAN,
+	description             VARCHAR(200),
+	can_patch               BOOLEAN         DEFAULT(true)
+);
+INSERT INTO grades_new (id, user_id, teacher_id, subject_id, date, is_written, grade, period, is_final, description, can_patch)
+	SELECT id, user_id, teacher_id, subject_id,
+		strftime('%Y-%m-%d %H:%M:%S', date) || ' +0000 UTC',
+		is_written, grade, period, is_final, description, can_patch
+	FROM grades;
+DROP TABLE grades;
+ALTER TABLE grades_new RENAME TO grades;
+
+CREATE TABLE homework_new (
+	id                      INTEGER         PRIMARY KEY,
+	teacher_id              INTEGER,
+	subject_id              INTEGER,
+	name                    VARCHAR(200),
+	description             VARCHAR(1000),
+	from_date               VARCHAR(200),
+	to_date                 VARCHAR(200)
+);
+INSERT INTO homework_new (id, teacher_id, subject_id, name, description, from_date, to_date)
+	SELECT id, teacher_id, subject_id, name, description, from_date, to_date FROM homework;
+DROP TABLE homework;
+ALTER TABLE homework_new RENAME TO homework;
+
+CREATE TABLE communication_new (
+	id                      INTEGER         PRIMARY KEY,
+	title                   VARCHAR(200),
+	date_created            VARCHAR(200)
+);
+INSERT INTO communication_new (id, title, date_created)
+	SELECT id, title,
+		strftime('%Y-%m-%d %H:%M:%S', date_created) || ' +0000 UTC'
+	FROM communication;
+DROP TABLE communication;
+ALTER TABLE communication_new RENAME TO communication;
+
+CREATE TABLE message_new (
+	id                      INTEGER         PRIMARY KEY,
+	communication_id        INTEGER,
+	user_id                 INTEGER,
+	body                    VARCHAR(3000),
+	date_created            VARCHAR(200)
+);
+INSERT INTO message_new (id, communication_id, user_id, body, date_created)
+	SELECT id, communication_id, user_id, body,
+		strftime('%Y-%m-%d %H:%M:%S', date_created) || ' +0000 UTC'
+	FROM message;
+DROP TABLE message;
+ALTER TABLE message_new RENAME TO message;
+
+CREATE TABLE meals_new (
+	id                      INTEGER         PRIMARY KEY,
+	meals                   VARCHAR(3000),
+	date                    VARCHAR(200),
+	meal_title              VARCHAR(3000),
+	price                   FLOAT,
+	is_limited              BOOLEAN,
+	order_limit             INTEGER,
+	is_vegan                BOOLEAN,
+	is_vegetarian           BOOLEAN,
+	is_lactose_free         BOOLEAN,
+	block_orders            BOOLEAN
+);
+INSERT INTO meals_new (id, meals, date, meal_title, price, is_limited, order_limit, is_vegan, is_vegetarian, is_lactose_free, block_orders)
+	SELECT id, meals, date, meal_title, price, is_limited, order_limit, is_vegan, is_vegetarian, is_lactose_free, block_orders FROM meals;
+DROP TABLE meals;
+ALTER TABLE meals_new RENAME TO meals;
@@ -0,0 +1,15 @@
+DROP INDEX testing_user_date;
+DROP INDEX meetings_date;
+
+-- meetings.date was an INTEGER column before, which couldn't hold the dates MeetPlan stored into it, so it's reverted
+-- to a string column.
+ALTER TABLE testing ALTER COLUMN date TYPE VARCHAR(250) USING COALESCE(to_char(date, 'DD-MM-YYYY'), '');
+ALTER TABLE users ALTER COLUMN birthday TYPE VARCHAR(200) USING to_char(birthday, 'YYYY-MM-DD');
+ALTER TABLE classes ALTER COLUMN last_school_date TYPE INTEGER USING extract(epoch FROM last_school_date::timestamptz)::integer;
+ALTER TABLE meetings ALTER COLUMN date TYPE VARCHAR(200) USING COALESCE(to_char(date, 'DD-MM-YYYY'), '');
+ALTER TABLE grades ALTER COLUMN date TYPE VARCHAR(200) USING to_char(date AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS') || ' +0000 UTC';
+ALTER TABLE homework ALTER COLUMN from_date TYPE VARCHAR(200) USING to_char(from_date, 'YYYY-MM-DD');
+ALTER TABLE homework ALTER COLUMN to_date TYPE VARCHAR(200) USING to_char(to_date, 'YYYY-MM-DD');
+ALTER TABLE communication ALTER COLUMN date_created TYPE VARCHAR(200) USING to_char(date_created AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS') || ' +0000 UTC';
+ALTER TABLE message ALTER COLUMN date_created TYPE VARCHAR(200) USING to_char(date_created AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS') || ' +0000 UTC';
+ALTER TABLE meals ALTER COLUMN date TYPE VARCHAR(200) USING to_char(date, 'YYYY-MM-DD');
@@ -0,0 +1,40 @@
+-- Dates were stored as strings in several formats: 02-01-2006 for meetings and self-testing, 2006-01-02 for
+-- birthdays and homework, the output of Go's time.Time.String() for grades and messages, and Unix seconds for the
+-- last school day of a class. They are converted to DATE and TIMESTAMP WITH TIME ZONE columns. Dates that can't be
+-- parsed, such as 2022-3-1, become NULL, so the date columns are nullable; timestamps that can't be parsed become the
+-- Unix epoch. Rows with NULL dates can be listed with "SELECT id FROM meetings WHERE date IS NULL" (and the same for
+-- testing) and fixed by hand.
+ALTER TABLE testing ALTER COLUMN date DROP NOT NULL;
+ALTER TABLE meetings ALTER COLUMN date DROP NOT NULL;
+ALTER TABLE testing ALTER COLUMN date TYPE DATE USING
+	CASE WHEN date ~ '^\d{4}-\d{2}-\d{2}' THEN to_date(substr(date, 1, 10), 'YYYY-MM-DD')
+	WHEN date ~ '^\d{2}-\d{2}-\d{4}' THEN to_date(substr(date, 1, 10), 'DD-MM-YYYY') END;
+ALTER TABLE users ALTER COLUMN birthday TYPE DATE USING
+	CASE WHEN birthday ~ '^\d{4}-\d{2}-\d{2}' THEN to_date(substr(birthday, 1, 10), 'YYYY-MM-DD')
+	WHEN birthday ~ '^\d{2}-\d{2}-\d{4}' THEN to_date(substr(birthday, 1, 10), 'DD-MM-YYYY') END;
+ALTER TABLE classes ALTER COLUMN last_school_date TYPE DATE USING
+	CASE WHEN last_school_date > 0 THEN to_timestamp(last_school_date)::date END;
+ALTER TABLE meetings ALTER COLUMN date TYPE DATE USING
+	CASE WHEN date::text ~ '^\d{4}-\d{2}-\d{2}' THEN to_date(substr(date::text, 1, 10), 'YYYY-MM-DD')
+	WHEN date::text ~ '^\d{2}-\d{2}-\d{4}' THEN to_date(substr(date::text, 1, 10), 'DD-MM-YYYY') END;
+ALTER TABLE grades ALTER COLUMN date TYPE TIMESTAMP WITH TIME ZONE USING
+	COALESCE(CASE WHEN date ~ '^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}' THEN (substr(date, 1, 10) || ' ' || substr(date, 12, 8) ||
+	COALESCE(regexp_replace(substring(date from ' ([+-]\d{4}) '), '(\d{2})$', ':\1'), '+00:00'))::timestamptz END, 'epoch'::timestamptz);
+ALTER TABLE homework ALTER COLUMN from_date TYPE DATE USING
+	CASE WHEN from_date ~ '^\d{4}-\d{2}-\d{2}' THEN to_date(substr(from_date, 1, 10), 'YYYY-MM-DD')
+	WHEN from_date ~ '^\d{2}-\d{2}-\d{4}' THEN to_date(substr(from_date, 1, 10), 'DD-MM-YYYY') END;
+ALTER TABLE homework ALTER COLUMN to_date TYPE DATE USING
+	CASE WHEN to_date ~ '^\d{4}-\d{2}-\d{2}' THEN to_date(substr(to_date, 1, 10), 'YYYY-MM-DD')
+	WHEN to_date ~ '^\d{2}-\d{2}-\d{4}' THEN to_date(substr(to_date, 1, 10), 'DD-MM-YYYY') END;
+ALTER TABLE communication ALTER COLUMN date_created TYPE TIMESTAMP WITH TIME ZONE USING
+	COALESCE(CASE WHEN date_created ~ '^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}' THEN (substr(date_created, 1, 10) || ' ' || substr(date_created, 12, 8) ||
+	COALESCE(regexp_replace(substring(date_created from ' ([+-]\d{4}) '), '(\d{2})$', ':\1'), '+00:00'))::timestamptz END, 'epoch'::timestamptz);
+ALTER TABLE message ALTER COLUMN date_created TYPE TIMESTAMP WITH TIME ZONE USING
+	COALESCE(CASE WHEN date_created ~ '^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}' THEN (substr(date_created, 1, 10) || ' ' || substr(date_created, 12, 8) ||
+	COALESCE(regexp_replace(substring(date_created from ' ([+-]\d{4}) '), '(\d{2})$', ':\1'), '+00:00'))::timestamptz END, 'epoch'::timestamptz);
+ALTER TABLE meals ALTER COLUMN date TYPE DATE USING
+	CASE WHEN date ~ '^\d{4}-\d{2}-\d{2}' THEN to_date(substr(date, 1, 10), 'YYYY-MM-DD')
+	WHEN date ~ '^\d{2}-\d{2}-\d{4}' THEN to_date(substr(date, 1, 10), 'DD-MM-YYYY') END;
+
+CREATE INDEX meetings_date ON meetings (date, hour);
+CREATE INDEX testing_user_date ON testing (user_id, date);
@@ -0,0 +1,187 @@
+-- Dates were stored as strings in several formats: 02-01-2006 for meetings and self-testing, 2006-01-02 for
+-- birthdays and homework, the output of Go's time.Time.String() for grades and messages, and Unix seconds for the
+-- last school day of a class. They are converted to ISO-8601 DATE and TIMESTAMP (in UTC) columns. Dates that can't
+-- be parsed, such as 2022-3-1, become NULL, so the date columns are nullable; timestamps that can't be parsed become
+-- the Unix epoch. Rows with NULL dates can be listed with "SELECT id FROM meetings WHERE date IS NULL" (and the same
+-- for testing) and fixed by hand.
+--
+-- The bundled SQLite can't change column types, so the tables are rebuilt the same way as in 0003.
+
+CREATE TABLE testing_new (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER         NOT NULL,
+	date                    DATE,
+	teacher_id              INTEGER         NOT NULL,
+	class_id                INTEGER         NOT NULL,
+	result                  VARCHAR(250)    NOT NULL
+);
+INSERT INTO testing_new (id, user_id, date, teacher_id, class_id, result)
+	SELECT id, user_id,
+		date(CASE WHEN date GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]*' THEN substr(date, 1, 10)
+			WHEN date GLOB '[0-9][0-9]-[0-9][0-9]-[0-9][0-9][0-9][0-9]*' THEN substr(date, 7, 4) || '-' || substr(date, 4, 2) || '-' || substr(date, 1, 2) END),
+		teacher_id, class_id, result
+	FROM testing;
+DROP TABLE testing;
+ALTER TABLE testing_new RENAME TO testing;
+
+CREATE TABLE users_new (
+	id                       INTEGER        PRIMARY KEY,
+	email                    VARCHAR(250)   NOT NULL,
+	pass                     VARCHAR(250)   NOT NULL,
+	name                     VARCHAR(250)   NOT NULL,
+	role                     VARCHAR(50)    NOT NULL,
+	birth_certificate_number VARCHAR(200),
+	birthday                 DATE,
+	country_of_birth         VARCHAR(200),
+	city_of_birth            VARCHAR(200),
+	is_passing               BOOLEAN,
+	totp_secret              VARCHAR(100)   DEFAULT(''),
+	totp_enabled             BOOLEAN        DEFAULT(false),
+	totp_last_step           INTEGER        DEFAULT(0)
+);
+INSERT INTO users_new (id, email, pass, name, role, birth_certificate_number, birthday, country_of_birth, city_of_birth, is_passing, totp_secret, totp_enabled, totp_last_step)
+	SELECT id, email, pass, name, role, birth_certificate_number,
+		date(CASE WHEN birthday GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]*' THEN substr(birthday, 1, 10)
+			WHEN birthday GLOB '[0-9][0-9]-[0-9][0-9]-[0-9][0-9][0-9][0-9]*' THEN substr(birthday, 7, 4) || '-' || substr(birthday, 4, 2) || '-' || substr(birthday, 1, 2) END),
+		country_of_birth, city_of_birth, is_passing, totp_secret, totp_enabled, totp_last_step
+	FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE TABLE classes_new (
+	id                       INTEGER        PRIMARY KEY,
+	name                     VARCHAR(100)   NOT NULL,
+	class_year               VARCHAR(20)    DEFAULT(''),
+	last_school_date         DATE,
+	teacher                  INTEGER,
+	sok                      INTEGER,
+	eok                      INTEGER
+);
+INSERT INTO classes_new (id, name, class_year, last_school_date, teacher, sok, eok)
+	SELECT id, name, class_year,
+		CASE WHEN last_school_date > 0 THEN date(last_school_date, 'unixepoch', 'localtime') END,
+		teacher, sok, eok
+	FROM classes;
+DROP TABLE classes;
+ALTER TABLE classes_new RENAME TO classes;
+
+CREATE TABLE meetings_new (
+	id                      INTEGER         PRIMARY KEY,
+	meeting_name            VARCHAR(200)    NOT NULL,
+	url                     VARCHAR(300)    NOT NULL,
+	details                 VARCHAR(1000)   NOT NULL,
+	teacher_id              INTEGER         NOT NULL,
+	subject_id              INTEGER         NOT NULL,
+	hour                    INTEGER         NOT NULL,
+	date                    DATE,
+	is_mandatory            BOOLEAN         NOT NULL,
+	is_grading              BOOLEAN         NOT NULL,
+	is_written_assessment   BOOLEAN,
+	is_test                 BOOLEAN         NOT NULL,
+	is_substitution         BOOLEAN         NOT NULL
+);
+INSERT INTO meetings_new (id, meeting_name, url, details, teacher_id, subject_id, hour, date, is_mandatory, is_grading, is_written_assessment, is_test, is_substitution)
+	SELECT id, meeting_name, url, details, teacher_id, subject_id, hour,
+		date(CASE WHEN date GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]*' THEN substr(date, 1, 10)
+			WHEN date GLOB '[0-9][0-9]-[0-9][0-9]-[0-9][0-9][0-9][0-9]*' THEN substr(date, 7, 4) || '-' || substr(date, 4, 2) || '-' || substr(date, 1, 2) END),
+		is_mandatory, is_grading, is_written_assessment, is_test, is_substitution
+	FROM meetings;
+DROP TABLE meetings;
+ALTER TABLE meetings_new RENAME TO meetings;
+
+CREATE TABLE grades_new (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER,
+	teacher_id              INTEGER,
+	subject_id              INTEGER,
+	date                    TIMESTAMP,
+	is_written              BOOLEAN,
+	grade                   INTEGER,
+	period                  INTEGER,
+	is_final                BOOLEAN,
+	description             VARCHAR(200),
+	can_patch               BOOLEAN         DEFAULT(true)
+);
+INSERT INTO grades_new (id, user_id, teacher_id, subject_id, date, is_written, grade, period, is_final, description, can_patch)
+	SELECT id, user_id, teacher_id, subject_id,
+		COALESCE(datetime(CASE WHEN date GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9][ T][0-9][0-9]:[0-9][0-9]:[0-9][0-9]*' THEN substr(date, 1, 10) || ' ' || substr(date, 12, 8) ||
+			CASE WHEN instr(date, ' +') > 0 THEN substr(date, instr(date, ' +') + 1, 3) || ':' || substr(date, instr(date, ' +') + 4, 2)
+			WHEN instr(date, ' -') > 0 THEN substr(date, instr(date, ' -') + 1, 3) || ':' || substr(date, instr(date, ' -') + 4, 2) ELSE '' END END), '1970-01-01 00:00:00'),
+		is_written, grade, period, is_final, description, can_patch
+	FROM grades;
+DROP TABLE grades;
+ALTER TABLE grades_new RENAME TO grades;
+
+CREATE TABLE homework_new (
+	id                      INTEGER         PRIMARY KEY,
+	teacher_id              INTEGER,
+	subject_id              INTEGER,
+	name                    VARCHAR(200),
+	description             VARCHAR(1000),
+	from_date               DATE,
+	to_date                 DATE
+);
+INSERT INTO homework_new (id, teacher_id, subject_id, name, description, from_date, to_date)
+	SELECT id, teacher_id, subject_id, name, description,
+		date(CASE WHEN from_date GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]*' THEN substr(from_date, 1, 10)
+			WHEN from_date GLOB '[0-9][0-9]-[0-9][0-9]-[0-9][0-9][0-9][0-9]*' THEN substr(from_date, 7, 4) || '-' || substr(from_date, 4, 2) || '-' || substr(from_date, 1, 2) END),
+		date(CASE WHEN to_date GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]*' THEN substr(to_date, 1, 10)
+			WHEN to_date GLOB '[0-9][0-9]-[0-9][0-9]-[0-9][0-9][0-9][0-9]*' THEN substr(to_date, 7, 4) || '-' || substr(to_date, 4, 2) || '-' || substr(to_date, 1, 2) END)
+	FROM homework;
+DROP TABLE homework;
+ALTER TABLE homework_new RENAME TO homework;
+
+CREATE TABLE communication_new (
+	id                      INTEGER         PRIMARY KEY,
+	title                   VARCHAR(200),
+	date_created            TIMESTAMP
+);
+INSERT INTO communication_new (id, title, date_created)
+	SELECT id, title,
+		COALESCE(datetime(CASE WHEN date_created GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9][ T][0-9][0-9]:[0-9][0-9]:[0-9][0-9]*' THEN substr(date_created, 1, 10) || ' ' || substr(date_created, 12, 8) ||
+			CASE WHEN instr(date_created, ' +') > 0 THEN substr(date_created, instr(date_created, ' +') + 1, 3) || ':' || substr(date_created, instr(date_created, ' +') + 4, 2)
+			WHEN instr(date_created, ' -') > 0 THEN substr(date_created, instr(date_created, ' -') + 1, 3) || ':' || substr(date_created, instr(date_created, ' -') + 4, 2) ELSE '' END END), '1970-01-01 00:00:00')
+	FROM communication;
+DROP TABLE communication;
+ALTER TABLE communication_new RENAME TO communication;
+
+CREATE TABLE message_new (
+	id                      INTEGER         PRIMARY KEY,
+	communication_id        INTEGER,
+	user_id                 INTEGER,
+	body                    VARCHAR(3000),
+	date_created            TIMESTAMP
+);
+INSERT INTO message_new (id, communication_id, user_id, body, date_created)
+	SELECT id, communication_id, user_id, body,
+		COALESCE(datetime(CASE WHEN date_created GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9][ T][0-9][0-9]:[0-9][0-9]:[0-9][0-9]*' THEN substr(date_created, 1, 10) || ' ' || substr(date_created, 12, 8) ||
+			CASE WHEN instr(date_created, ' +') > 0 THEN substr(date_created, instr(date_created, ' +') + 1, 3) || ':' || substr(date_created, instr(date_created, ' +') + 4, 2)
+			WHEN instr(date_created, ' -') > 0 THEN substr(date_created, instr(date_created, ' -') + 1, 3) || ':' || substr(date_created, instr(date_created, ' -') + 4, 2) ELSE '' END END), '1970-01-01 00:00:00')
+	FROM message;
+DROP TABLE message;
+ALTER TABLE message_new RENAME TO message;
+
+CREATE TABLE meals_new (
+	id                      INTEGER         PRIMARY KEY,
+	meals                   VARCHAR(3000),
+	date                    DATE,
+	meal_title              VARCHAR(3000),
+	price                   FLOAT,
+	is_limited              BOOLEAN,
+	order_limit             INTEGER,
+	is_vegan                BOOLEAN,
+	is_vegetarian           BOOLEAN,
+	is_lactose_free         BOOLEAN,
+	block_orders            BOOLEAN
+);
+INSERT INTO meals_new (id, meals, date, meal_title, price, is_limited, order_limit, is_vegan, is_vegetarian, is_lactose_free, block_orders)
+	SELECT id, meals,
+		date(CASE WHEN date GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]*' THEN substr(date, 1, 10)
+			WHEN date GLOB '[0-9][0-9]-[0-9][0-9]-[0-9][0-9][0-9][0-9]*' THEN substr(date, 7, 4) || '-' || substr(date, 4, 2) || '-' || substr(date, 1, 2) END),
+		meal_title, price, is_limited, order_limit, is_vegan, is_vegetarian, is_lactose_free, block_orders
+	FROM meals;
+DROP TABLE meals;
+ALTER TABLE meals_new RENAME TO meals;
+
+CREATE INDEX meetings_date ON meetings (date, hour);
+CREATE INDEX testing_user_date ON testing (user_id, date);
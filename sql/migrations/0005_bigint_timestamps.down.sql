@@ -0,0 +1 @@
+-- Nothing to revert, see 0005_bigint_timestamps.up.sql.
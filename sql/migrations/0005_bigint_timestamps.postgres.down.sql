@@ -0,0 +1,16 @@
+-- Fails when a timestamp after January 2038 is stored already, as it doesn't fit into INTEGER anymore.
+ALTER TABLE sessions ALTER COLUMN created_at TYPE INTEGER;
+ALTER TABLE sessions ALTER COLUMN expires_at TYPE INTEGER;
+ALTER TABLE signing_keys ALTER COLUMN created_at TYPE INTEGER;
+ALTER TABLE signing_keys ALTER COLUMN expires_at TYPE INTEGER;
+ALTER TABLE password_resets ALTER COLUMN expires_at TYPE INTEGER;
+ALTER TABLE login_attempts ALTER COLUMN created_at TYPE INTEGER;
+ALTER TABLE login_throttles ALTER COLUMN locked_until TYPE INTEGER;
+ALTER TABLE login_throttles ALTER COLUMN last_failure TYPE INTEGER;
+ALTER TABLE child_invitations ALTER COLUMN expires_at TYPE INTEGER;
+ALTER TABLE oidc_states ALTER COLUMN expires_at TYPE INTEGER;
+ALTER TABLE audit_log ALTER COLUMN created_at TYPE INTEGER;
+ALTER TABLE legal_holds ALTER COLUMN created_at TYPE INTEGER;
+ALTER TABLE impersonation_log ALTER COLUMN created_at TYPE INTEGER;
+ALTER TABLE schema_migrations ALTER COLUMN applied_at TYPE INTEGER;
+ALTER TABLE users ALTER COLUMN totp_last_step TYPE INTEGER;
@@ -0,0 +1,17 @@
+-- PostgreSQL INTEGER is 32-bit, which can't hold Unix timestamps after January 2038. SQLite integers are
+-- 64-bit already, so the SQLite version of this migration doesn't change anything.
+ALTER TABLE sessions ALTER COLUMN created_at TYPE BIGINT;
+ALTER TABLE sessions ALTER COLUMN expires_at TYPE BIGINT;
+ALTER TABLE signing_keys ALTER COLUMN created_at TYPE BIGINT;
+ALTER TABLE signing_keys ALTER COLUMN expires_at TYPE BIGINT;
+ALTER TABLE password_resets ALTER COLUMN expires_at TYPE BIGINT;
+ALTER TABLE login_attempts ALTER COLUMN created_at TYPE BIGINT;
+ALTER TABLE login_throttles ALTER COLUMN locked_until TYPE BIGINT;
+ALTER TABLE login_throttles ALTER COLUMN last_failure TYPE BIGINT;
+ALTER TABLE child_invitations ALTER COLUMN expires_at TYPE BIGINT;
+ALTER TABLE oidc_states ALTER COLUMN expires_at TYPE BIGINT;
+ALTER TABLE audit_log ALTER COLUMN created_at TYPE BIGINT;
+ALTER TABLE legal_holds ALTER COLUMN created_at TYPE BIGINT;
+ALTER TABLE impersonation_log ALTER COLUMN created_at TYPE BIGINT;
+ALTER TABLE schema_migrations ALTER COLUMN applied_at TYPE BIGINT;
+ALTER TABLE users ALTER COLUMN totp_last_step TYPE BIGINT;
@@ -0,0 +1 @@
+-- SQLite integers are 64-bit, Unix timestamps fit into them already. See the PostgreSQL version of this migration.
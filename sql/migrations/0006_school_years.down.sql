@@ -0,0 +1,9 @@
+DROP TABLE archived_student_homework;
+DROP TABLE archived_homework;
+DROP TABLE archived_absences;
+DROP TABLE archived_grades;
+DROP TABLE archived_meetings;
+DROP TABLE archived_subjects;
+DROP TABLE archived_class_students;
+DROP TABLE archived_classes;
+DROP TABLE school_years;
@@ -0,0 +1,115 @@
+-- Finished school years are archived by the rollover. Rows of the year are copied into the archived_* tables
+-- together with the ID of their school year and removed from the live tables afterwards. Archived rows keep
+-- their original IDs, which are only unique within a school year.
+CREATE TABLE school_years (
+	id                      INTEGER         GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	name                    VARCHAR(20)     NOT NULL UNIQUE,
+	next_year               VARCHAR(20)     NOT NULL,
+	archived_at             BIGINT          NOT NULL,
+	archived_by             INTEGER         NOT NULL
+);
+
+CREATE TABLE archived_classes (
+	school_year_id          INTEGER         NOT NULL REFERENCES school_years(id),
+	id                      INTEGER         NOT NULL,
+	name                    VARCHAR(100)    NOT NULL,
+	class_year              VARCHAR(20)     DEFAULT(''),
+	last_school_date        DATE,
+	teacher                 INTEGER,
+	sok                     INTEGER,
+	eok                     INTEGER,
+	PRIMARY KEY (school_year_id, id)
+);
+
+-- Outcome is promoted, retained or graduated
+CREATE TABLE archived_class_students (
+	school_year_id          INTEGER         NOT NULL REFERENCES school_years(id),
+	class_id                INTEGER         NOT NULL,
+	user_id                 INTEGER         NOT NULL,
+	is_passing              BOOLEAN         NOT NULL,
+	outcome                 VARCHAR(20)     NOT NULL,
+	PRIMARY KEY (school_year_id, class_id, user_id)
+);
+CREATE INDEX archived_class_students_user ON archived_class_students (user_id);
+
+CREATE TABLE archived_subjects (
+	school_year_id          INTEGER         NOT NULL REFERENCES school_years(id),
+	id                      INTEGER         NOT NULL,
+	teacher_id              INTEGER,
+	name                    VARCHAR(200),
+	long_name               VARCHAR(200),
+	inherits_class          BOOLEAN,
+	realization             FLOAT,
+	class_id                INTEGER,
+	PRIMARY KEY (school_year_id, id)
+);
+
+CREATE TABLE archived_meetings (
+	school_year_id          INTEGER         NOT NULL REFERENCES school_years(id),
+	id                      INTEGER         NOT NULL,
+	meeting_name            VARCHAR(200)    NOT NULL,
+	url                     VARCHAR(300)    NOT NULL,
+	details                 VARCHAR(1000)   NOT NULL,
+	teacher_id              INTEGER         NOT NULL,
+	subject_id              INTEGER         NOT NULL,
+	hour                    INTEGER         NOT NULL,
+	date                    DATE            NOT NULL,
+	is_mandatory            BOOLEAN         NOT NULL,
+	is_grading              BOOLEAN         NOT NULL,
+	is_written_assessment   BOOLEAN,
+	is_test                 BOOLEAN         NOT NULL,
+	is_substitution         BOOLEAN         NOT NULL,
+	PRIMARY KEY (school_year_id, id)
+);
+CREATE INDEX archived_meetings_subject ON archived_meetings (school_year_id, subject_id);
+
+CREATE TABLE archived_grades (
+	school_year_id          INTEGER         NOT NULL REFERENCES school_years(id),
+	id                      INTEGER         NOT NULL,
+	user_id                 INTEGER,
+	teacher_id              INTEGER,
+	subject_id              INTEGER,
+	date                    TIMESTAMP WITH TIME ZONE,
+	is_written              BOOLEAN,
+	grade                   INTEGER,
+	period                  INTEGER,
+	is_final                BOOLEAN,
+	description             VARCHAR(200),
+	can_patch               BOOLEAN,
+	PRIMARY KEY (school_year_id, id)
+);
+CREATE INDEX archived_grades_user ON archived_grades (user_id);
+
+CREATE TABLE archived_absences (
+	school_year_id          INTEGER         NOT NULL REFERENCES school_years(id),
+	id                      INTEGER         NOT NULL,
+	user_id                 INTEGER,
+	meeting_id              INTEGER,
+	teacher_id              INTEGER,
+	absence_type            VARCHAR(200),
+	is_excused              BOOLEAN,
+	PRIMARY KEY (school_year_id, id)
+);
+CREATE INDEX archived_absences_user ON archived_absences (user_id);
+
+CREATE TABLE archived_homework (
+	school_year_id          INTEGER         NOT NULL REFERENCES school_years(id),
+	id                      INTEGER         NOT NULL,
+	teacher_id              INTEGER,
+	subject_id              INTEGER,
+	name                    VARCHAR(200),
+	description             VARCHAR(1000),
+	from_date               DATE,
+	to_date                 DATE,
+	PRIMARY KEY (school_year_id, id)
+);
+
+CREATE TABLE archived_student_homework (
+	school_year_id          INTEGER         NOT NULL REFERENCES school_years(id),
+	id                      INTEGER         NOT NULL,
+	user_id                 INTEGER,
+	homework_id             INTEGER,
+	status                  VARCHAR(200),
+	PRIMARY KEY (school_year_id, id)
+);
+CREATE INDEX archived_student_homework_user ON archived_student_homework (user_id);
@@ -0,0 +1,9 @@
+-- Calendar apps subscribe to a user's timetable with the token in the feed URL. Only the hash of the token is
+-- stored and a user has at most one feed, creating a new one revokes the old URL.
+CREATE TABLE calendar_feeds (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER         NOT NULL UNIQUE,
+	token                   VARCHAR(64)     NOT NULL UNIQUE,
+	created_at              INTEGER         NOT NULL,
+	last_used_at            INTEGER         NOT NULL
+);
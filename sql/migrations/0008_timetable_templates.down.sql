@@ -0,0 +1,27 @@
+-- SQLite can't drop columns, so meetings are copied into a table without template_id
+DROP INDEX meetings_template;
+DROP INDEX meetings_date;
+
+CREATE TABLE meetings_new (
+	id                      INTEGER         PRIMARY KEY,
+	meeting_name            VARCHAR(200)    NOT NULL,
+	url                     VARCHAR(300)    NOT NULL,
+	details                 VARCHAR(1000)   NOT NULL,
+	teacher_id              INTEGER         NOT NULL,
+	subject_id              INTEGER         NOT NULL,
+	hour                    INTEGER         NOT NULL,
+	date                    DATE,
+	is_mandatory            BOOLEAN         NOT NULL,
+	is_grading              BOOLEAN         NOT NULL,
+	is_written_assessment   BOOLEAN,
+	is_test                 BOOLEAN         NOT NULL,
+	is_substitution         BOOLEAN         NOT NULL
+);
+INSERT INTO meetings_new (id, meeting_name, url, details, teacher_id, subject_id, hour, date, is_mandatory, is_grading, is_written_assessment, is_test, is_substitution)
+	SELECT id, meeting_name, url, details, teacher_id, subject_id, hour, date, is_mandatory, is_grading, is_written_assessment, is_test, is_substitution
+	FROM meetings;
+DROP TABLE meetings;
+ALTER TABLE meetings_new RENAME TO meetings;
+CREATE INDEX meetings_date ON meetings (date, hour);
+
+DROP TABLE timetable_templates;
@@ -0,0 +1,3 @@
+DROP INDEX meetings_template;
+ALTER TABLE meetings DROP COLUMN template_id;
+DROP TABLE timetable_templates;
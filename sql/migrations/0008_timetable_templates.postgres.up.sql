@@ -0,0 +1,21 @@
+-- Templates describe lessons that repeat every week or every few weeks, such as "mathematics on Tuesdays in
+-- the 3rd hour". Meetings created from a template remember it in template_id, which is 0 for meetings created
+-- on their own. Weekday uses Go's numbering, 0 is Sunday.
+CREATE TABLE timetable_templates (
+	id                      INTEGER         GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	subject_id              INTEGER         NOT NULL,
+	teacher_id              INTEGER         NOT NULL,
+	meeting_name            VARCHAR(200)    NOT NULL,
+	url                     VARCHAR(300)    NOT NULL,
+	details                 VARCHAR(1000)   NOT NULL,
+	is_mandatory            BOOLEAN         NOT NULL,
+	weekday                 INTEGER         NOT NULL,
+	hour                    INTEGER         NOT NULL,
+	interval_weeks          INTEGER         NOT NULL,
+	from_date               DATE            NOT NULL,
+	to_date                 DATE            NOT NULL
+);
+CREATE INDEX timetable_templates_teacher ON timetable_templates (teacher_id);
+
+ALTER TABLE meetings ADD COLUMN template_id INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX meetings_template ON meetings (template_id);
@@ -0,0 +1,3 @@
+DROP TABLE timetable_draft_lessons;
+DROP TABLE timetable_drafts;
+DROP TABLE teacher_unavailability;
@@ -0,0 +1,35 @@
+-- Hours in which teachers can't teach, the timetable generator never plans their lessons in them.
+CREATE TABLE teacher_unavailability (
+	id                      INTEGER         GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	teacher_id              INTEGER         NOT NULL,
+	weekday                 INTEGER         NOT NULL,
+	hour                    INTEGER         NOT NULL,
+	UNIQUE (teacher_id, weekday, hour)
+);
+
+-- Drafts are weekly timetables made by the generator. Their lessons become timetable templates once an
+-- administrator publishes the draft, until then they don't affect meetings. The constraints are kept, so the
+-- draft can be evaluated again while it's reviewed.
+CREATE TABLE timetable_drafts (
+	id                      INTEGER         GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	seed                    BIGINT          NOT NULL,
+	from_date               DATE            NOT NULL,
+	to_date                 DATE            NOT NULL,
+	first_hour              INTEGER         NOT NULL,
+	last_hour               INTEGER         NOT NULL,
+	max_hours_per_day       INTEGER         NOT NULL,
+	no_gaps                 BOOLEAN         NOT NULL,
+	created_by              INTEGER         NOT NULL,
+	created_at              BIGINT          NOT NULL
+);
+
+CREATE TABLE timetable_draft_lessons (
+	id                      INTEGER         GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	draft_id                INTEGER         NOT NULL,
+	subject_id              INTEGER         NOT NULL,
+	teacher_id              INTEGER         NOT NULL,
+	meeting_name            VARCHAR(200)    NOT NULL,
+	weekday                 INTEGER         NOT NULL,
+	hour                    INTEGER         NOT NULL
+);
+CREATE INDEX timetable_draft_lessons_draft ON timetable_draft_lessons (draft_id);
@@ -0,0 +1,13 @@
+-- SQLite can't drop columns, so feeds are copied into a table without role
+CREATE TABLE calendar_feeds_new (
+	id                      INTEGER         PRIMARY KEY,
+	user_id                 INTEGER         NOT NULL UNIQUE,
+	token                   VARCHAR(64)     NOT NULL UNIQUE,
+	created_at              INTEGER         NOT NULL,
+	last_used_at            INTEGER         NOT NULL
+);
+INSERT INTO calendar_feeds_new (id, user_id, token, created_at, last_used_at)
+	SELECT id, user_id, token, created_at, last_used_at
+	FROM calendar_feeds;
+DROP TABLE calendar_feeds;
+ALTER TABLE calendar_feeds_new RENAME TO calendar_feeds;
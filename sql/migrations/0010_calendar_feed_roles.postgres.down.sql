@@ -0,0 +1 @@
+ALTER TABLE calendar_feeds DROP COLUMN role;
@@ -0,0 +1,4 @@
+-- Feeds remember the role of the user they were created for. The timetable depends on the role, so a feed
+-- stops working once the user's role changes and they have to create a new one.
+ALTER TABLE calendar_feeds ADD COLUMN role VARCHAR(50) NOT NULL DEFAULT '';
+UPDATE calendar_feeds SET role=COALESCE((SELECT role FROM users WHERE users.id=calendar_feeds.user_id), '');
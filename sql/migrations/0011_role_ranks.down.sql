@@ -0,0 +1,11 @@
+-- SQLite can't drop columns, so roles are copied into a table without rank
+CREATE TABLE roles_new (
+	name                    VARCHAR(100)    PRIMARY KEY,
+	description             VARCHAR(500)    NOT NULL DEFAULT '',
+	is_builtin              BOOLEAN         NOT NULL
+);
+INSERT INTO roles_new (name, description, is_builtin)
+	SELECT name, description, is_builtin
+	FROM roles;
+DROP TABLE roles;
+ALTER TABLE roles_new RENAME TO roles;
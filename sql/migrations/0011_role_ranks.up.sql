@@ -0,0 +1,5 @@
+-- Users can only give roles ranked below their own, so a principal assistant can't promote anyone to principal.
+ALTER TABLE roles ADD COLUMN rank INTEGER NOT NULL DEFAULT 0;
+UPDATE roles SET rank=3 WHERE name='admin';
+UPDATE roles SET rank=2 WHERE name='principal';
+UPDATE roles SET rank=1 WHERE name='principal assistant';
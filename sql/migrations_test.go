@@ -0,0 +1,130 @@
+package sql
+
+import (
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTypedDatesMigration upgrades a database with dates in the old string formats. Dates that can't be parsed
+// have to become NULL instead of failing the migration.
+func TestTypedDatesMigration(t *testing.T) {
+	conn, err := NewSQL("sqlite3", filepath.Join(t.TempDir(), "meetplan.db"), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := conn.(*sqlImpl)
+	defer db.pool.Close()
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Back to the schema before 0004_typed_dates
+	_, err = db.MigrateDown(LatestSchemaVersion() - 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := []string{"01-03-2022", "2022-03-01", "2022-3-1", ""}
+	for i, date := range legacy {
+		_, err = db.db.Exec(`INSERT INTO meetings (id, meeting_name, url, details, teacher_id, subject_id, hour, date, is_mandatory, is_grading, is_written_assessment, is_test, is_substitution)
+			VALUES ($1, 'Matematika', '', '', 1, 1, 1, $2, true, false, false, false, false)`, i+1, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.db.Exec("INSERT INTO testing (id, user_id, date, teacher_id, class_id, result) VALUES ($1, 1, $2, 1, 1, 'SE NE TESTIRA')", i+1, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatalf("migrating legacy dates: %s", err.Error())
+	}
+
+	want := []string{"2022-03-01", "2022-03-01", "", ""}
+	for i := range legacy {
+		meeting, err := db.GetMeeting(i + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meeting.Date.String() != want[i] {
+			t.Errorf("meeting dated %q: got %q, want %q", legacy[i], meeting.Date.String(), want[i])
+		}
+		testing, err := db.GetTestingResultByID(i + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testing.Date.String() != want[i] {
+			t.Errorf("self-testing dated %q: got %q, want %q", legacy[i], testing.Date.String(), want[i])
+		}
+	}
+	var unparseable int
+	err = db.db.Get(&unparseable, "SELECT COUNT(*) FROM meetings WHERE date IS NULL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unparseable != 2 {
+		t.Errorf("meetings with NULL dates: got %d, want 2", unparseable)
+	}
+
+	// Reverting has to work with the NULL dates as well
+	_, err = db.MigrateDown(LatestSchemaVersion() - 3)
+	if err != nil {
+		t.Fatalf("reverting NULL dates: %s", err.Error())
+	}
+}
+
+// TestMigrateBaselineSchema adopts a database created before the migration runner, which lacks the columns that
+// used to be added by hand, and migrates it to the latest version.
+func TestMigrateBaselineSchema(t *testing.T) {
+	conn, err := NewSQL("sqlite3", filepath.Join(t.TempDir(), "meetplan.db"), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := conn.(*sqlImpl)
+	defer db.pool.Close()
+	schema, err := os.ReadFile(filepath.Join("testdata", "baseline_schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.db.Exec(string(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.db.Exec("INSERT INTO users (id, email, pass, name, role, birth_certificate_number, birthday, country_of_birth, city_of_birth, is_passing) VALUES (1, 'ucitelj@example.com', '', 'Učitelj', 'teacher', '', '01-03-1990', '', '', true)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.db.Exec("INSERT INTO grades (id, user_id, teacher_id, subject_id, date, is_written, grade, period, is_final, description) VALUES (1, 2, 1, 1, '01-03-2022', false, 5, 1, false, 'Ustno')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatalf("migrating the baseline schema: %s", err.Error())
+	}
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("schema version: got %d, want %d", version, LatestSchemaVersion())
+	}
+	user, err := db.GetUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "ucitelj@example.com" || user.TOTPEnabled || user.TOTPSecret != "" {
+		t.Errorf("adopted user: %+v", user)
+	}
+	grade, err := db.GetGrade(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !grade.CanPatch || grade.Grade != 5 {
+		t.Errorf("adopted grade: %+v", grade)
+	}
+}
@@ -11,15 +11,14 @@ func (db *sqlImpl) GetNotification(id int) (notification NotificationSQL, err er
 }
 
 func (db *sqlImpl) GetAllNotifications() (notifications []NotificationSQL, err error) {
-	err = db.db.Select(&notifications, "SELECT * FROM notifications")
+	err = db.db.Select(&notifications, "SELECT * FROM notifications ORDER BY id ASC")
 	return notifications, err
 }
 
-func (db *sqlImpl) InsertNotification(notification NotificationSQL) (err error) {
-	_, err = db.db.NamedExec(
-		"INSERT INTO notifications (id, notification) VALUES (:id, :notification)",
+func (db *sqlImpl) InsertNotification(notification NotificationSQL) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO notifications (notification) VALUES (:notification)",
 		notification)
-	return err
 }
 
 func (db *sqlImpl) UpdateNotification(notification NotificationSQL) error {
@@ -29,18 +28,6 @@ func (db *sqlImpl) UpdateNotification(notification NotificationSQL) error {
 	return err
 }
 
-func (db *sqlImpl) GetLastNotificationID() (id int) {
-	err := db.db.Get(&id, "SELECT id FROM notifications WHERE id = (SELECT MAX(id) FROM notifications)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
 func (db *sqlImpl) DeleteNotification(ID int) error {
 	_, err := db.db.Exec("DELETE FROM notifications WHERE id=$1", ID)
 	return err
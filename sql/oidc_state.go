@@ -0,0 +1,58 @@
+package sql
+
+import (
+	"errors"
+	"github.com/dchest/uniuri"
+	"time"
+)
+
+const OIDCStateExpiration = 10 * time.Minute
+
+// OIDCState is a pending OpenID Connect login. The state protects the callback from CSRF, while the nonce
+// binds the ID token to this login.
+type OIDCState struct {
+	State     string
+	Nonce     string
+	ExpiresAt int64 `db:"expires_at"`
+}
+
+func (db *sqlImpl) InsertOIDCState(state OIDCState) error {
+	_, err := db.db.NamedExec(
+		"INSERT INTO oidc_states (state, nonce, expires_at) VALUES (:state, :nonce, :expires_at)",
+		state)
+	return err
+}
+
+// NewOIDCState returns a new state and nonce for the authorization request. Only the hash of the state is stored.
+func (db *sqlImpl) NewOIDCState() (state string, nonce string, err error) {
+	db.db.Exec("DELETE FROM oidc_states WHERE expires_at<$1", time.Now().Unix())
+	state = uniuri.NewLen(32)
+	nonce = uniuri.NewLen(32)
+	err = db.InsertOIDCState(OIDCState{
+		State:     HashToken(state),
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(OIDCStateExpiration).Unix(),
+	})
+	return state, nonce, err
+}
+
+// ConsumeOIDCState removes the state, so it can be used only once, and returns the nonce belonging to it.
+func (db *sqlImpl) ConsumeOIDCState(state string) (nonce string, err error) {
+	var s OIDCState
+	err = db.db.Get(&s, "SELECT * FROM oidc_states WHERE state=$1", HashToken(state))
+	if err != nil {
+		return "", errors.New("invalid state")
+	}
+	res, err := db.db.Exec("DELETE FROM oidc_states WHERE state=$1", s.State)
+	if err != nil {
+		return "", err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil || affected != 1 {
+		return "", errors.New("state has already been used")
+	}
+	if s.ExpiresAt < time.Now().Unix() {
+		return "", errors.New("state has expired")
+	}
+	return s.Nonce, nil
+}
@@ -0,0 +1,103 @@
+package sql
+
+import (
+	"errors"
+	"github.com/dchest/uniuri"
+	"time"
+)
+
+const PasswordResetExpiration = 1 * time.Hour
+
+type PasswordReset struct {
+	ID        int
+	UserID    int `db:"user_id"`
+	Token     string
+	ExpiresAt int64 `db:"expires_at"`
+	IsUsed    bool  `db:"is_used"`
+}
+
+func (db *sqlImpl) GetPasswordResetByToken(token string) (reset PasswordReset, err error) {
+	err = db.db.Get(&reset, "SELECT * FROM password_resets WHERE token=$1", HashToken(token))
+	return reset, err
+}
+
+func (db *sqlImpl) InsertPasswordReset(reset PasswordReset) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO password_resets (user_id, token, expires_at, is_used) VALUES (:user_id, :token, :expires_at, :is_used)",
+		reset)
+}
+
+func (db *sqlImpl) UpdatePasswordReset(reset PasswordReset) error {
+	_, err := db.db.NamedExec(
+		"UPDATE password_resets SET is_used=:is_used WHERE id=:id",
+		reset)
+	return err
+}
+
+func (db *sqlImpl) DeletePasswordResets(userId int) {
+	db.db.Exec("DELETE FROM password_resets WHERE user_id=$1", userId)
+}
+
+// NewPasswordReset returns a new single-use token. Earlier tokens of the user stay valid until they expire, otherwise
+// anybody could keep invalidating the link in the user's mailbox by requesting new ones.
+func (db *sqlImpl) NewPasswordReset(userId int) (string, error) {
+	_, err := db.db.Exec("DELETE FROM password_resets WHERE user_id=$1 AND expires_at<$2", userId, time.Now().Unix())
+	if err != nil {
+		return "", err
+	}
+	token := uniuri.NewLen(64)
+	_, err = db.InsertPasswordReset(PasswordReset{
+		UserID:    userId,
+		Token:     HashToken(token),
+		ExpiresAt: time.Now().Add(PasswordResetExpiration).Unix(),
+		IsUsed:    false,
+	})
+	return token, err
+}
+
+// ResetPassword sets a new password using the reset token. The token is marked as used by the same statement that
+// checks it, so it can't be used twice, not even in parallel. All sessions and other reset tokens of the user are
+// revoked as well.
+func (db *sqlImpl) ResetPassword(token string, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("UPDATE password_resets SET is_used=true WHERE token=$1 AND is_used=false AND expires_at>$2",
+		HashToken(token), time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return errors.New("invalid password reset token, or it has already been used or has expired")
+	}
+	var reset PasswordReset
+	err = tx.Get(&reset, "SELECT * FROM password_resets WHERE token=$1", HashToken(token))
+	if err != nil {
+		return err
+	}
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE users SET pass=$1 WHERE id=$2", []interface{}{hash, reset.UserID}},
+		{"UPDATE password_resets SET is_used=true WHERE user_id=$1", []interface{}{reset.UserID}},
+		{"UPDATE sessions SET is_revoked=true WHERE user_id=$1", []interface{}{reset.UserID}},
+	}
+	for _, q := range queries {
+		_, err = tx.Exec(q.query, q.args...)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
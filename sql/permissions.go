@@ -0,0 +1,152 @@
+package sql
+
+// Permissions are the only thing handlers check when authorizing a request. Roles are just named sets of
+// permissions stored in the database, so administrators can define custom roles (such as secretary or
+// kitchen staff) without any code changes.
+//
+// Handlers additionally limit data to the user's own relations (their own records, their children, their
+// classes and their subjects). The *_all permissions lift this limitation.
+const (
+	PermissionUsersRead        = "users.read"
+	PermissionUsersReadPrivate = "users.read_private"
+	PermissionUsersManage      = "users.manage"
+	PermissionUsersDelete      = "users.delete"
+	PermissionUsersChangeRole  = "users.change_role"
+	PermissionUsersImport      = "users.import"
+	PermissionParentsManage    = "parents.manage"
+	PermissionParentsInvite    = "parents.invite"
+	PermissionClassesRead      = "classes.read"
+	PermissionClassesReadAll   = "classes.read_all"
+	PermissionClassesManage    = "classes.manage"
+	PermissionSubjectsManage   = "subjects.manage"
+	PermissionMeetingsWrite    = "meetings.write"
+	PermissionMeetingsWriteAll = "meetings.write_all"
+	PermissionMeetingsReadAll  = "meetings.read_all"
+	PermissionSubstitutions    = "meetings.substitutions"
+	PermissionAbsencesWrite    = "absences.write"
+	PermissionAbsencesWriteAll = "absences.write_all"
+	PermissionAbsencesExcuse   = "absences.excuse"
+	PermissionGradesRead       = "grades.read"
+	PermissionGradesWrite      = "grades.write"
+	PermissionGradesWriteAll   = "grades.write_all"
+	PermissionHomeworkWrite    = "homework.write"
+	PermissionHomeworkWriteAll = "homework.write_all"
+	PermissionCertificates     = "certificates.print"
+	PermissionSchoolingCert    = "certificates.schooling"
+	PermissionMealsManage      = "meals.manage"
+	PermissionNotifications    = "notifications.manage"
+	PermissionTestingManage    = "testing.manage"
+	PermissionTimetableManage  = "timetable.manage"
+	PermissionConfigManage     = "config.manage"
+	PermissionRolesManage      = "roles.manage"
+	PermissionSecurityManage   = "security.manage"
+	PermissionAuditRead        = "audit.read"
+	PermissionUsersExport      = "users.export"
+	PermissionUsersLegalHold   = "users.legal_hold"
+	PermissionUsersImpersonate = "users.impersonate"
+	PermissionBackupsManage    = "backups.manage"
+	PermissionSchoolYears      = "school_years.manage"
+	PermissionMeetingsOverride = "meetings.override_conflicts"
+)
+
+// AdminRole always has all permissions, so administrators can't lock themselves out.
+const AdminRole = "admin"
+
+// PrincipalRole can only be held by one user at a time.
+const PrincipalRole = "principal"
+
+type Permission struct {
+	Name        string
+	Description string
+}
+
+// PermissionRegistry lists all permissions known to MeetPlan. Roles can only be assigned permissions from this list.
+var PermissionRegistry = []Permission{
+	{PermissionUsersRead, "View lists of users, teachers and students"},
+	{PermissionUsersReadPrivate, "View private data of users, such as birth certificate numbers"},
+	{PermissionUsersManage, "Create and edit users, reset their passwords, sessions and lockouts"},
+	{PermissionUsersDelete, "Delete users"},
+	{PermissionUsersChangeRole, "Change roles of users"},
+	{PermissionUsersImport, "Import students, classes and links to parents from CSV files"},
+	{PermissionParentsManage, "Link parents with their children"},
+	{PermissionParentsInvite, "Generate invitation codes parents can use to link themselves with students of own class"},
+	{PermissionClassesRead, "View classes"},
+	{PermissionClassesReadAll, "View all classes and their students, not only own classes"},
+	{PermissionClassesManage, "Create, edit and delete classes"},
+	{PermissionSubjectsManage, "Create, edit and delete subjects"},
+	{PermissionMeetingsWrite, "Create, edit and delete own meetings"},
+	{PermissionMeetingsWriteAll, "Create, edit and delete meetings of all teachers"},
+	{PermissionMeetingsReadAll, "View timetables of all teachers"},
+	{PermissionSubstitutions, "Mark meetings as substitutions"},
+	{PermissionAbsencesWrite, "Manage absences in own meetings"},
+	{PermissionAbsencesWriteAll, "Manage absences in all meetings"},
+	{PermissionAbsencesExcuse, "Excuse absences of students in own class"},
+	{PermissionGradesRead, "View grades of students"},
+	{PermissionGradesWrite, "Manage grades in own subjects"},
+	{PermissionGradesWriteAll, "Manage grades in all subjects"},
+	{PermissionHomeworkWrite, "Manage homework in own meetings"},
+	{PermissionHomeworkWriteAll, "Manage homework in all meetings"},
+	{PermissionCertificates, "Print certificates of ending class"},
+	{PermissionSchoolingCert, "Print certificates of schooling"},
+	{PermissionMealsManage, "Manage meals and meal orders"},
+	{PermissionNotifications, "Manage system notifications"},
+	{PermissionTestingManage, "Manage self-testing results"},
+	{PermissionTimetableManage, "Manage teacher absences and substitutions, generate and publish timetables using proton"},
+	{PermissionConfigManage, "Change the school configuration"},
+	{PermissionRolesManage, "Create and edit roles and their permissions"},
+	{PermissionSecurityManage, "Manage signing keys, two-factor requirements and view login attempts"},
+	{PermissionAuditRead, "Search the audit log of changes and verify its integrity"},
+	{PermissionUsersExport, "Export all data stored about any user (subject access requests)"},
+	{PermissionUsersLegalHold, "Place users on legal hold, which prevents their deletion"},
+	{PermissionUsersImpersonate, "View MeetPlan as another user to reproduce their issues"},
+	{PermissionBackupsManage, "Create, list and download backups of the whole database"},
+	{PermissionSchoolYears, "Roll the school over into the next school year and view archived school years"},
+	{PermissionMeetingsOverride, "Save meetings despite scheduling conflicts, such as double-booked teachers or students"},
+}
+
+var principalPermissions = []string{
+	PermissionUsersRead, PermissionUsersManage, PermissionUsersDelete, PermissionUsersChangeRole, PermissionUsersImport,
+	PermissionParentsInvite, PermissionClassesRead, PermissionClassesReadAll, PermissionClassesManage, PermissionSubjectsManage,
+	PermissionMeetingsWrite, PermissionMeetingsWriteAll, PermissionMeetingsReadAll, PermissionSubstitutions,
+	PermissionAbsencesWrite, PermissionAbsencesWriteAll, PermissionAbsencesExcuse,
+	PermissionGradesRead, PermissionGradesWrite, PermissionGradesWriteAll,
+	PermissionHomeworkWrite, PermissionHomeworkWriteAll, PermissionCertificates, PermissionSchoolingCert,
+	PermissionMealsManage, PermissionNotifications, PermissionTestingManage, PermissionTimetableManage,
+	PermissionConfigManage, PermissionAuditRead, PermissionUsersExport,
+	PermissionUsersLegalHold,
+}
+
+// DefaultRolePermissions are inserted into the database on the first start. Afterwards permissions of
+// the built-in roles can be changed through the API, but the roles themselves can't be deleted.
+var DefaultRolePermissions = map[string][]string{
+	PrincipalRole:         principalPermissions,
+	"principal assistant": principalPermissions,
+	"teacher": {
+		PermissionClassesRead, PermissionMeetingsWrite, PermissionAbsencesWrite, PermissionAbsencesExcuse,
+		PermissionGradesRead, PermissionGradesWrite, PermissionHomeworkWrite, PermissionCertificates,
+		PermissionTestingManage, PermissionParentsInvite,
+	},
+	"school psychologist": {PermissionSchoolingCert},
+	"food organizer":      {PermissionMealsManage},
+	"parent":              {PermissionGradesRead},
+	"student":             {PermissionGradesRead},
+	"unverified":          {},
+	GraduatedRole:         {},
+}
+
+// DefaultRoleRanks are the ranks of the built-in roles. Other roles start with rank 0, so they can be given by
+// any of the roles listed here, but can't give any role themselves.
+var DefaultRoleRanks = map[string]int{
+	AdminRole:             3,
+	PrincipalRole:         2,
+	"principal assistant": 1,
+}
+
+func IsValidPermission(permission string) bool {
+	for i := 0; i < len(PermissionRegistry); i++ {
+		if PermissionRegistry[i].Name == permission {
+			return true
+		}
+	}
+	return false
+}
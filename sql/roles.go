@@ -0,0 +1,180 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Role struct {
+	Name        string
+	Description string
+	IsBuiltIn   bool `db:"is_builtin"`
+	// Rank orders roles by authority. Users can only give roles ranked below their own.
+	Rank int
+}
+
+type RoleJSON struct {
+	Role
+	Permissions []string
+}
+
+func (db *sqlImpl) GetRoles() (roles []Role, err error) {
+	err = db.db.Select(&roles, "SELECT * FROM roles ORDER BY name ASC")
+	if roles == nil {
+		roles = make([]Role, 0)
+	}
+	return roles, err
+}
+
+func (db *sqlImpl) GetRole(name string) (role Role, err error) {
+	err = db.db.Get(&role, "SELECT * FROM roles WHERE name=$1", name)
+	return role, err
+}
+
+func (db *sqlImpl) InsertRole(role Role) error {
+	_, err := db.db.NamedExec(
+		"INSERT INTO roles (name, description, is_builtin, rank) VALUES (:name, :description, :is_builtin, :rank)",
+		role)
+	return err
+}
+
+func (db *sqlImpl) UpdateRole(role Role) error {
+	_, err := db.db.NamedExec(
+		"UPDATE roles SET description=:description, rank=:rank WHERE name=:name",
+		role)
+	return err
+}
+
+// DeleteRole removes a custom role. Roles that are still assigned to users can't be deleted.
+func (db *sqlImpl) DeleteRole(name string) error {
+	role, err := db.GetRole(name)
+	if err != nil {
+		return err
+	}
+	if role.IsBuiltIn {
+		return errors.New("built-in roles cannot be deleted")
+	}
+	var count int
+	err = db.db.Get(&count, "SELECT COUNT(*) FROM users WHERE role=$1", name)
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		return fmt.Errorf("role is still assigned to %d users", count)
+	}
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM role_permissions WHERE role=$1", name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM roles WHERE name=$1", name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *sqlImpl) GetPermissionsForRole(role string) (permissions []string, err error) {
+	if role == AdminRole {
+		permissions = make([]string, 0)
+		for i := 0; i < len(PermissionRegistry); i++ {
+			permissions = append(permissions, PermissionRegistry[i].Name)
+		}
+		return permissions, nil
+	}
+	err = db.db.Select(&permissions, "SELECT permission FROM role_permissions WHERE role=$1 ORDER BY permission ASC", role)
+	if permissions == nil {
+		permissions = make([]string, 0)
+	}
+	return permissions, err
+}
+
+func (db *sqlImpl) SetRolePermissions(role string, permissions []string) error {
+	if role == AdminRole {
+		return errors.New("permissions of the admin role cannot be changed")
+	}
+	for i := 0; i < len(permissions); i++ {
+		if !IsValidPermission(permissions[i]) {
+			return fmt.Errorf("unknown permission %s", permissions[i])
+		}
+	}
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM role_permissions WHERE role=$1", role)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i := 0; i < len(permissions); i++ {
+		_, err = tx.Exec("INSERT INTO role_permissions (role, permission) VALUES ($1, $2)", role, permissions[i])
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CanAssignRole reports whether a user with the role assigner may give the role assigned to someone.
+func (db *sqlImpl) CanAssignRole(assigner string, assigned string) (bool, error) {
+	assignerRole, err := db.GetRole(assigner)
+	if err != nil {
+		return false, err
+	}
+	assignedRole, err := db.GetRole(assigned)
+	if err != nil {
+		return false, err
+	}
+	return assignedRole.Rank < assignerRole.Rank, nil
+}
+
+func (db *sqlImpl) HasPermission(role string, permission string) bool {
+	if role == AdminRole {
+		return true
+	}
+	var count int
+	err := db.db.Get(&count, "SELECT COUNT(*) FROM role_permissions WHERE role=$1 AND permission=$2", role, permission)
+	if err != nil {
+		db.logger.Info(err)
+		return false
+	}
+	return count > 0
+}
+
+// SeedRoles inserts built-in roles with their default permissions if they don't exist yet.
+// Existing roles are left untouched, so changes made by administrators are preserved across restarts.
+func (db *sqlImpl) SeedRoles() error {
+	builtIn := []string{AdminRole}
+	for role := range DefaultRolePermissions {
+		builtIn = append(builtIn, role)
+	}
+	for i := 0; i < len(builtIn); i++ {
+		name := builtIn[i]
+		_, err := db.GetRole(name)
+		if err == nil {
+			continue
+		}
+		if err.Error() != "sql: no rows in result set" {
+			return err
+		}
+		err = db.InsertRole(Role{Name: name, IsBuiltIn: true, Rank: DefaultRoleRanks[name]})
+		if err != nil {
+			return err
+		}
+		if name == AdminRole {
+			continue
+		}
+		err = db.SetRolePermissions(name, DefaultRolePermissions[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
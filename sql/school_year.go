@@ -0,0 +1,648 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Outcomes of students in the archived classes of a school year
+const (
+	RolloverPromoted  = "promoted"
+	RolloverRetained  = "retained"
+	RolloverGraduated = "graduated"
+	// Students of classes the rollover couldn't interpret, see RolloverPlan.Warnings
+	RolloverUnchanged = "unchanged"
+)
+
+// GraduatedRole is given to students who finished the final grade. It has no permissions by default.
+const GraduatedRole = "graduated"
+
+// DefaultFinalClassGrade is the last grade of Slovenian primary schools.
+const DefaultFinalClassGrade = 9
+
+// Class names consist of the grade and the department, such as 1.a or 9.b.
+var className = regexp.MustCompile(`^(\d+)\.(.*)$`)
+
+// School years are named like 2022/2023.
+var schoolYearName = regexp.MustCompile(`^(\d{4})/(\d{4})$`)
+
+// SchoolYear is a finished school year, which can only be read anymore.
+type SchoolYear struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	NextYear   string `db:"next_year" json:"next_year"`
+	ArchivedAt int64  `db:"archived_at" json:"archived_at"`
+	ArchivedBy int    `db:"archived_by" json:"archived_by"`
+}
+
+type ArchivedClass struct {
+	SchoolYearID int `db:"school_year_id" json:"school_year_id"`
+	Class
+}
+
+type ArchivedClassStudent struct {
+	SchoolYearID int    `db:"school_year_id" json:"school_year_id"`
+	ClassID      int    `db:"class_id" json:"class_id"`
+	UserID       int    `db:"user_id" json:"user_id"`
+	IsPassing    bool   `db:"is_passing" json:"is_passing"`
+	Outcome      string `json:"outcome"`
+}
+
+type ArchivedSubject struct {
+	SchoolYearID int `db:"school_year_id" json:"school_year_id"`
+	Subject
+}
+
+type ArchivedMeeting struct {
+	SchoolYearID int `db:"school_year_id" json:"school_year_id"`
+	Meeting
+}
+
+type ArchivedGrade struct {
+	SchoolYearID int `db:"school_year_id" json:"school_year_id"`
+	Grade
+}
+
+type ArchivedAbsence struct {
+	SchoolYearID int `db:"school_year_id" json:"school_year_id"`
+	Absence
+}
+
+type ArchivedHomework struct {
+	SchoolYearID int `db:"school_year_id" json:"school_year_id"`
+	Homework
+}
+
+type ArchivedStudentHomework struct {
+	SchoolYearID int `db:"school_year_id" json:"school_year_id"`
+	StudentHomework
+}
+
+type RolloverOptions struct {
+	// Name of the finished school year, taken from the classes when empty
+	Year string
+	// Name of the school year classes are moved into, the year after Year when empty
+	NextYear string
+	// Classes of this grade graduate, DefaultFinalClassGrade when 0
+	FinalGrade int
+	// User performing the rollover
+	ArchivedBy int
+}
+
+// RolloverClass describes what happens to a single class and its students.
+type RolloverClass struct {
+	ClassID int    `json:"class_id"`
+	Name    string `json:"name"`
+	// Name of the class in the next year, empty when the class is removed
+	NewName string `json:"new_name"`
+	Removed bool   `json:"removed"`
+
+	Promoted  []int `json:"promoted"`
+	Graduated []int `json:"graduated"`
+	Retained  []int `json:"retained"`
+	// Class the retained students are moved into, -1 while it's a new class that doesn't exist yet
+	RetainedInto     int    `json:"retained_into"`
+	RetainedIntoName string `json:"retained_into_name"`
+}
+
+// RolloverCounts are the numbers of rows moved into the archive.
+type RolloverCounts struct {
+	Classes         int `json:"classes"`
+	ClassStudents   int `json:"class_students"`
+	Subjects        int `json:"subjects"`
+	Meetings        int `json:"meetings"`
+	Grades          int `json:"grades"`
+	Absences        int `json:"absences"`
+	Homework        int `json:"homework"`
+	StudentHomework int `json:"student_homework"`
+}
+
+// RolloverPlan lists everything the rollover changes. Nothing is changed when Blockers aren't empty.
+type RolloverPlan struct {
+	// ID of the archived school year, 0 in previews
+	SchoolYearID int    `json:"school_year_id"`
+	Year         string `json:"year"`
+	NextYear     string `json:"next_year"`
+	FinalGrade   int    `json:"final_grade"`
+
+	Classes []RolloverClass `json:"classes"`
+	// Classes created for retained students who have no class in the next year yet
+	NewClasses []Class `json:"new_classes"`
+	// Subjects of removed classes, which are removed together with them
+	RemovedSubjects []int          `json:"removed_subjects"`
+	Archived        RolloverCounts `json:"archived"`
+
+	Warnings []string `json:"warnings"`
+	Blockers []string `json:"blockers"`
+}
+
+// NextSchoolYear returns the name of the school year after year, such as 2023/2024 after 2022/2023.
+func NextSchoolYear(year string) (string, error) {
+	match := schoolYearName.FindStringSubmatch(year)
+	if match == nil {
+		return "", fmt.Errorf("school year %s isn't named like 2022/2023", year)
+	}
+	from, _ := strconv.Atoi(match[1])
+	to, _ := strconv.Atoi(match[2])
+	return fmt.Sprintf("%d/%d", from+1, to+1), nil
+}
+
+func (db *sqlImpl) GetSchoolYears() (years []SchoolYear, err error) {
+	err = db.db.Select(&years, "SELECT * FROM school_years ORDER BY id ASC")
+	if years == nil {
+		years = make([]SchoolYear, 0)
+	}
+	return years, err
+}
+
+func (db *sqlImpl) GetSchoolYear(id int) (year SchoolYear, err error) {
+	err = db.db.Get(&year, "SELECT * FROM school_years WHERE id=$1", id)
+	return year, err
+}
+
+func (db *sqlImpl) GetArchivedClasses(schoolYearId int) (classes []ArchivedClass, err error) {
+	err = db.db.Select(&classes, "SELECT * FROM archived_classes WHERE school_year_id=$1 ORDER BY id ASC", schoolYearId)
+	if classes == nil {
+		classes = make([]ArchivedClass, 0)
+	}
+	return classes, err
+}
+
+func (db *sqlImpl) GetArchivedClassStudents(schoolYearId int, classId int) (students []ArchivedClassStudent, err error) {
+	err = db.db.Select(&students,
+		"SELECT * FROM archived_class_students WHERE school_year_id=$1 AND class_id=$2 ORDER BY user_id ASC",
+		schoolYearId, classId)
+	if students == nil {
+		students = make([]ArchivedClassStudent, 0)
+	}
+	return students, err
+}
+
+// GetArchivedClassesForStudent returns the student's class memberships of all archived school years.
+func (db *sqlImpl) GetArchivedClassesForStudent(userId int) (classes []ArchivedClassStudent, err error) {
+	err = db.db.Select(&classes,
+		"SELECT * FROM archived_class_students WHERE user_id=$1 ORDER BY school_year_id ASC, class_id ASC",
+		userId)
+	if classes == nil {
+		classes = make([]ArchivedClassStudent, 0)
+	}
+	return classes, err
+}
+
+func (db *sqlImpl) GetArchivedSubjects(schoolYearId int) (subjects []ArchivedSubject, err error) {
+	err = db.db.Select(&subjects, "SELECT * FROM archived_subjects WHERE school_year_id=$1 ORDER BY id ASC", schoolYearId)
+	if subjects == nil {
+		subjects = make([]ArchivedSubject, 0)
+	}
+	return subjects, err
+}
+
+func (db *sqlImpl) GetArchivedMeetingsForSubject(schoolYearId int, subjectId int) (meetings []ArchivedMeeting, err error) {
+	err = db.db.Select(&meetings,
+		"SELECT * FROM archived_meetings WHERE school_year_id=$1 AND subject_id=$2 ORDER BY date ASC, hour ASC",
+		schoolYearId, subjectId)
+	if meetings == nil {
+		meetings = make([]ArchivedMeeting, 0)
+	}
+	return meetings, err
+}
+
+func (db *sqlImpl) GetArchivedHomeworkForSubject(schoolYearId int, subjectId int) (homework []ArchivedHomework, err error) {
+	err = db.db.Select(&homework,
+		"SELECT * FROM archived_homework WHERE school_year_id=$1 AND subject_id=$2 ORDER BY id ASC",
+		schoolYearId, subjectId)
+	if homework == nil {
+		homework = make([]ArchivedHomework, 0)
+	}
+	return homework, err
+}
+
+// GetArchivedGradesForUser returns the user's grades of all archived school years.
+func (db *sqlImpl) GetArchivedGradesForUser(userId int) (grades []ArchivedGrade, err error) {
+	err = db.db.Select(&grades,
+		"SELECT * FROM archived_grades WHERE user_id=$1 ORDER BY school_year_id ASC, id ASC",
+		userId)
+	if grades == nil {
+		grades = make([]ArchivedGrade, 0)
+	}
+	return grades, err
+}
+
+// GetArchivedAbsencesForUser returns the user's absences of all archived school years.
+func (db *sqlImpl) GetArchivedAbsencesForUser(userId int) (absences []ArchivedAbsence, err error) {
+	err = db.db.Select(&absences,
+		"SELECT * FROM archived_absences WHERE user_id=$1 ORDER BY school_year_id ASC, id ASC",
+		userId)
+	if absences == nil {
+		absences = make([]ArchivedAbsence, 0)
+	}
+	return absences, err
+}
+
+// GetArchivedStudentHomeworkForUser returns the user's homework statuses of all archived school years.
+func (db *sqlImpl) GetArchivedStudentHomeworkForUser(userId int) (homework []ArchivedStudentHomework, err error) {
+	err = db.db.Select(&homework,
+		"SELECT * FROM archived_student_homework WHERE user_id=$1 ORDER BY school_year_id ASC, id ASC",
+		userId)
+	if homework == nil {
+		homework = make([]ArchivedStudentHomework, 0)
+	}
+	return homework, err
+}
+
+type rolloverMember struct {
+	ClassID   int  `db:"class_id"`
+	UserID    int  `db:"user_id"`
+	IsPassing bool `db:"is_passing"`
+}
+
+func previewRollover(q sqlx.Queryer, opts RolloverOptions) (plan RolloverPlan, err error) {
+	plan = RolloverPlan{
+		Year:            opts.Year,
+		NextYear:        opts.NextYear,
+		FinalGrade:      opts.FinalGrade,
+		Classes:         make([]RolloverClass, 0),
+		NewClasses:      make([]Class, 0),
+		RemovedSubjects: make([]int, 0),
+		Warnings:        make([]string, 0),
+		Blockers:        make([]string, 0),
+	}
+	if plan.FinalGrade <= 0 {
+		plan.FinalGrade = DefaultFinalClassGrade
+	}
+	var classes []Class
+	err = sqlx.Select(q, &classes, "SELECT * FROM classes ORDER BY id ASC")
+	if err != nil {
+		return plan, err
+	}
+
+	if plan.Year == "" {
+		years := make(map[string]bool)
+		for i := 0; i < len(classes); i++ {
+			if classes[i].ClassYear != "" && !years[classes[i].ClassYear] {
+				years[classes[i].ClassYear] = true
+				plan.Year = classes[i].ClassYear
+			}
+		}
+		if len(years) != 1 {
+			plan.Year = ""
+			plan.Blockers = append(plan.Blockers, "school year can't be determined from the classes, name it explicitly")
+		}
+	}
+	if plan.Year != "" {
+		archived, err := count(q, "SELECT COUNT(*) FROM school_years WHERE name=$1", plan.Year)
+		if err != nil {
+			return plan, err
+		}
+		if archived != 0 {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("school year %s is archived already", plan.Year))
+		}
+		if plan.NextYear == "" {
+			plan.NextYear, err = NextSchoolYear(plan.Year)
+			if err != nil {
+				plan.Blockers = append(plan.Blockers, err.Error()+", name the next school year explicitly")
+			}
+		}
+	}
+	if plan.NextYear != "" && plan.NextYear == plan.Year {
+		plan.Blockers = append(plan.Blockers, "next school year has to differ from the archived one")
+	}
+
+	var members []rolloverMember
+	err = sqlx.Select(q, &members,
+		"SELECT class_students.class_id, class_students.user_id, COALESCE(users.is_passing, false) AS is_passing FROM class_students JOIN users ON users.id=class_students.user_id ORDER BY class_students.class_id ASC, class_students.user_id ASC")
+	if err != nil {
+		return plan, err
+	}
+	studentClasses := make(map[int][]int)
+	for i := 0; i < len(members); i++ {
+		studentClasses[members[i].UserID] = append(studentClasses[members[i].UserID], members[i].ClassID)
+	}
+
+	// Classes are promoted by name, so the class named after the rolled-over class one grade lower
+	// takes its place in the next year
+	type parsedClass struct {
+		class      Class
+		grade      int
+		department string
+	}
+	parsed := make([]parsedClass, 0)
+	byName := make(map[string]int)
+	today := Today()
+	for i := 0; i < len(classes); i++ {
+		class := classes[i]
+		if class.ClassYear != "" && plan.Year != "" && class.ClassYear != plan.Year {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("class %s belongs to school year %s", class.Name, class.ClassYear))
+		}
+		if !class.LastSchoolDate.IsZero() && class.LastSchoolDate.After(today) {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("last school day of class %s is %s, which hasn't passed yet", class.Name, class.LastSchoolDate))
+		}
+		match := className.FindStringSubmatch(class.Name)
+		grade := 0
+		if match != nil {
+			grade, _ = strconv.Atoi(match[1])
+		}
+		if match == nil || grade < 1 || grade > plan.FinalGrade {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("class %s isn't named like 1.a up to %d.a, it's left unchanged", class.Name, plan.FinalGrade))
+			continue
+		}
+		name := fmt.Sprintf("%d.%s", grade, match[2])
+		if _, ok := byName[name]; ok {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("there are several classes named %s", name))
+			continue
+		}
+		byName[name] = len(parsed)
+		parsed = append(parsed, parsedClass{class: class, grade: grade, department: match[2]})
+	}
+
+	rolledOver := make(map[int]bool)
+	for i := 0; i < len(parsed); i++ {
+		rolledOver[parsed[i].class.ID] = true
+	}
+	for userId, classIds := range studentClasses {
+		n := 0
+		for _, classId := range classIds {
+			if rolledOver[classId] {
+				n++
+			}
+		}
+		if n > 1 {
+			plan.Blockers = append(plan.Blockers, fmt.Sprintf("student %d is in %d classes, it's unclear which one they should follow", userId, n))
+		}
+	}
+
+	for i := 0; i < len(parsed); i++ {
+		p := parsed[i]
+		c := RolloverClass{
+			ClassID:   p.class.ID,
+			Name:      p.class.Name,
+			Promoted:  make([]int, 0),
+			Graduated: make([]int, 0),
+			Retained:  make([]int, 0),
+		}
+		final := p.grade == plan.FinalGrade
+		for n := 0; n < len(members); n++ {
+			if members[n].ClassID != p.class.ID {
+				continue
+			}
+			if !members[n].IsPassing {
+				c.Retained = append(c.Retained, members[n].UserID)
+			} else if final {
+				c.Graduated = append(c.Graduated, members[n].UserID)
+			} else {
+				c.Promoted = append(c.Promoted, members[n].UserID)
+			}
+		}
+
+		// Retained students join the class that takes over the name of their class
+		sameGrade := fmt.Sprintf("%d.%s", p.grade, p.department)
+		c.RetainedIntoName = sameGrade
+		if successor, ok := byName[fmt.Sprintf("%d.%s", p.grade-1, p.department)]; ok {
+			c.RetainedInto = parsed[successor].class.ID
+		} else if final {
+			c.RetainedInto = p.class.ID
+		} else {
+			c.RetainedInto = -1
+		}
+
+		if !final {
+			c.NewName = fmt.Sprintf("%d.%s", p.grade+1, p.department)
+		} else if c.RetainedInto == p.class.ID && len(c.Retained) != 0 {
+			c.NewName = sameGrade
+		} else {
+			c.Removed = true
+		}
+		if len(c.Retained) == 0 {
+			c.RetainedInto = 0
+			c.RetainedIntoName = ""
+		} else if c.RetainedInto == -1 {
+			plan.NewClasses = append(plan.NewClasses, Class{
+				Name:      sameGrade,
+				Teacher:   p.class.Teacher,
+				ClassYear: plan.NextYear,
+			})
+		}
+		if c.Removed {
+			var subjects []int
+			err = sqlx.Select(q, &subjects, "SELECT id FROM subject WHERE inherits_class=true AND class_id=$1 ORDER BY id ASC", p.class.ID)
+			if err != nil {
+				return plan, err
+			}
+			plan.RemovedSubjects = append(plan.RemovedSubjects, subjects...)
+		}
+		plan.Classes = append(plan.Classes, c)
+	}
+
+	counts := []struct {
+		target *int
+		query  string
+	}{
+		{&plan.Archived.Classes, "SELECT COUNT(*) FROM classes"},
+		{&plan.Archived.ClassStudents, "SELECT COUNT(*) FROM class_students"},
+		{&plan.Archived.Subjects, "SELECT COUNT(*) FROM subject"},
+		{&plan.Archived.Meetings, "SELECT COUNT(*) FROM meetings"},
+		{&plan.Archived.Grades, "SELECT COUNT(*) FROM grades"},
+		{&plan.Archived.Absences, "SELECT COUNT(*) FROM absence"},
+		{&plan.Archived.Homework, "SELECT COUNT(*) FROM homework"},
+		{&plan.Archived.StudentHomework, "SELECT COUNT(*) FROM student_homework"},
+	}
+	for _, c := range counts {
+		*c.target, err = count(q, c.query)
+		if err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+func (db *sqlImpl) PreviewRollover(opts RolloverOptions) (RolloverPlan, error) {
+	return previewRollover(db.db, opts)
+}
+
+// RollOver archives the finished school year and moves the school into the next one in a single transaction.
+// Grades, absences, meetings and homework are moved into the archive, passing students are promoted with their
+// class, others stay in the same grade and students of the final grade graduate. The plan is computed again
+// inside the transaction, so the result matches what actually happened.
+func (db *sqlImpl) RollOver(opts RolloverOptions) (plan RolloverPlan, err error) {
+	tx, err := db.begin()
+	if err != nil {
+		return plan, err
+	}
+	defer tx.Rollback()
+	plan, err = previewRollover(tx, opts)
+	if err != nil {
+		return plan, err
+	}
+	if len(plan.Blockers) != 0 {
+		return plan, errors.New(plan.Blockers[0])
+	}
+
+	year := SchoolYear{Name: plan.Year, NextYear: plan.NextYear, ArchivedAt: time.Now().Unix(), ArchivedBy: opts.ArchivedBy}
+	year.ID, err = db.insert(tx,
+		"INSERT INTO school_years (name, next_year, archived_at, archived_by) VALUES (:name, :next_year, :archived_at, :archived_by)",
+		year)
+	if err != nil {
+		return plan, err
+	}
+	err = archiveSchoolYear(tx, year.ID, plan)
+	if err != nil {
+		return plan, err
+	}
+
+	newClassIds := make(map[string]int)
+	for i := 0; i < len(plan.NewClasses); i++ {
+		plan.NewClasses[i].ID, err = db.insert(tx,
+			"INSERT INTO classes (teacher, name, class_year, sok, eok, last_school_date) VALUES (:teacher, :name, :class_year, :sok, :eok, :last_school_date)",
+			plan.NewClasses[i])
+		if err != nil {
+			return plan, err
+		}
+		newClassIds[plan.NewClasses[i].Name] = plan.NewClasses[i].ID
+	}
+	for i := 0; i < len(plan.Classes); i++ {
+		c := &plan.Classes[i]
+		if c.RetainedInto == -1 {
+			c.RetainedInto = newClassIds[c.RetainedIntoName]
+		}
+		err = rollOverClass(tx, *c, plan.NextYear)
+		if err != nil {
+			return plan, err
+		}
+	}
+	for i := 0; i < len(plan.RemovedSubjects); i++ {
+		_, err = tx.Exec("DELETE FROM subject_students WHERE subject_id=$1", plan.RemovedSubjects[i])
+		if err != nil {
+			return plan, err
+		}
+		_, err = tx.Exec("DELETE FROM subject WHERE id=$1", plan.RemovedSubjects[i])
+		if err != nil {
+			return plan, err
+		}
+	}
+	plan.SchoolYearID = year.ID
+	return plan, tx.Commit()
+}
+
+// archiveSchoolYear copies the rows of the finished year into the archive and removes the ones that only
+// belong to it from the live tables.
+func archiveSchoolYear(tx database, schoolYearId int, plan RolloverPlan) error {
+	queries := []string{
+		`INSERT INTO archived_classes (school_year_id, id, name, class_year, last_school_date, teacher, sok, eok)
+			SELECT $1, id, name, class_year, last_school_date, teacher, sok, eok FROM classes`,
+		`INSERT INTO archived_class_students (school_year_id, class_id, user_id, is_passing, outcome)
+			SELECT $1, class_students.class_id, class_students.user_id, COALESCE(users.is_passing, false), '` + RolloverUnchanged + `'
+			FROM class_students JOIN users ON users.id=class_students.user_id`,
+		`INSERT INTO archived_subjects (school_year_id, id, teacher_id, name, long_name, inherits_class, realization, class_id)
+			SELECT $1, id, teacher_id, name, long_name, inherits_class, realization, class_id FROM subject`,
+		`INSERT INTO archived_meetings (school_year_id, id, meeting_name, url, details, teacher_id, subject_id, hour, date, is_mandatory, is_grading, is_written_assessment, is_test, is_substitution)
+			SELECT $1, id, meeting_name, url, details, teacher_id, subject_id, hour, date, is_mandatory, is_grading, is_written_assessment, is_test, is_substitution FROM meetings`,
+		`INSERT INTO archived_grades (school_year_id, id, user_id, teacher_id, subject_id, date, is_written, grade, period, is_final, description, can_patch)
+			SELECT $1, id, user_id, teacher_id, subject_id, date, is_written, grade, period, is_final, description, can_patch FROM grades`,
+		`INSERT INTO archived_absences (school_year_id, id, user_id, meeting_id, teacher_id, absence_type, is_excused)
+			SELECT $1, id, user_id, meeting_id, teacher_id, absence_type, is_excused FROM absence`,
+		`INSERT INTO archived_homework (school_year_id, id, teacher_id, subject_id, name, description, from_date, to_date)
+			SELECT $1, id, teacher_id, subject_id, name, description, from_date, to_date FROM homework`,
+		`INSERT INTO archived_student_homework (school_year_id, id, user_id, homework_id, status)
+			SELECT $1, id, user_id, homework_id, status FROM student_homework`,
+	}
+	for i := 0; i < len(queries); i++ {
+		_, err := tx.Exec(queries[i], schoolYearId)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(plan.Classes); i++ {
+		c := plan.Classes[i]
+		outcomes := []struct {
+			outcome  string
+			students []int
+		}{
+			{RolloverPromoted, c.Promoted},
+			{RolloverGraduated, c.Graduated},
+			{RolloverRetained, c.Retained},
+		}
+		for _, o := range outcomes {
+			for n := 0; n < len(o.students); n++ {
+				_, err := tx.Exec("UPDATE archived_class_students SET outcome=$1 WHERE school_year_id=$2 AND class_id=$3 AND user_id=$4",
+					o.outcome, schoolYearId, c.ClassID, o.students[n])
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Subjects stay, so teachers keep teaching them to the promoted classes. Templates describe the finished
+	// year's timetable, so they go together with its meetings.
+	for _, table := range []string{"student_homework", "homework", "absence", "grades", "meetings", "timetable_templates"} {
+		_, err := tx.Exec("DELETE FROM " + table)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rollOverClass(tx database, c RolloverClass, nextYear string) error {
+	for i := 0; i < len(c.Graduated); i++ {
+		queries := []string{
+			"DELETE FROM class_students WHERE user_id=$1",
+			"DELETE FROM subject_students WHERE user_id=$1",
+			"UPDATE users SET role='" + GraduatedRole + "', is_passing=true WHERE id=$1",
+			// Sessions were issued for the student role
+			"UPDATE sessions SET is_revoked=true WHERE user_id=$1",
+		}
+		for _, query := range queries {
+			_, err := tx.Exec(query, c.Graduated[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for i := 0; i < len(c.Retained); i++ {
+		if c.RetainedInto != c.ClassID {
+			_, err := tx.Exec("DELETE FROM class_students WHERE class_id=$1 AND user_id=$2", c.ClassID, c.Retained[i])
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO class_students (class_id, user_id) VALUES ($1, $2)", c.RetainedInto, c.Retained[i])
+			if err != nil {
+				return err
+			}
+			// Subjects the class didn't attend as a whole move up with it, so the student leaves them as well
+			_, err = tx.Exec("DELETE FROM subject_students WHERE user_id=$1 AND subject_id IN (SELECT id FROM subject WHERE inherits_class=false AND class_id=$2)",
+				c.Retained[i], c.ClassID)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec("UPDATE users SET is_passing=true WHERE id=$1", c.Retained[i])
+		if err != nil {
+			return err
+		}
+	}
+	for i := 0; i < len(c.Promoted); i++ {
+		_, err := tx.Exec("UPDATE users SET is_passing=true WHERE id=$1", c.Promoted[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Removed {
+		_, err := tx.Exec("DELETE FROM class_students WHERE class_id=$1", c.ClassID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM classes WHERE id=$1", c.ClassID)
+		return err
+	}
+	// Marks of conduct and the last school day belong to the finished year
+	_, err := tx.Exec("UPDATE classes SET name=$1, class_year=$2, sok=0, eok=0, last_school_date=NULL WHERE id=$3",
+		c.NewName, nextYear, c.ClassID)
+	return err
+}
@@ -1,13 +1,9 @@
 package sql
 
-import (
-	"encoding/json"
-)
-
 type Testing struct {
 	ID        int
 	UserID    int `db:"user_id"`
-	Date      string
+	Date      Date
 	TeacherID int `db:"teacher_id"`
 	ClassID   int `db:"class_id"`
 	Result    string
@@ -16,26 +12,20 @@ type Testing struct {
 type TestingJSON struct {
 	ID          int
 	UserID      int `db:"user_id"`
-	Date        string
+	Date        Date
 	TeacherID   int `db:"teacher_id"`
 	TeacherName string
 	ClassID     int `db:"class_id"`
-	ValidUntil  string
+	ValidUntil  Date
 	Result      string
 	IsDone      bool
 	UserName    string
 }
 
-func (db *sqlImpl) GetTestingResults(date string, classId int) ([]TestingJSON, error) {
+func (db *sqlImpl) GetTestingResults(date Date, classId int) ([]TestingJSON, error) {
 	var testing = make([]TestingJSON, 0)
 
-	class, err := db.GetClass(classId)
-	if err != nil {
-		db.logger.Debug(err)
-		return nil, err
-	}
-	var students []int
-	err = json.Unmarshal([]byte(class.Students), &students)
+	students, err := db.GetClassStudents(classId)
 	if err != nil {
 		db.logger.Debug(err)
 		return nil, err
@@ -69,20 +59,7 @@ func (db *sqlImpl) GetTestingResults(date string, classId int) ([]TestingJSON, e
 	return testing, nil
 }
 
-func (db *sqlImpl) GetLastTestingID() int {
-	var id int
-	err := db.db.Get(&id, "SELECT id FROM testing WHERE id = (SELECT MAX(id) FROM testing)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
-func (db *sqlImpl) GetTestingResult(date string, id int) (Testing, error) {
+func (db *sqlImpl) GetTestingResult(date Date, id int) (Testing, error) {
 	var message Testing
 
 	err := db.db.Get(&message, "SELECT * FROM testing WHERE user_id=$1 AND date=$2", id, date)
@@ -101,11 +78,10 @@ func (db *sqlImpl) GetTestingResultByID(id int) (Testing, error) {
 	return message, err
 }
 
-func (db *sqlImpl) InsertTestingResult(testing Testing) error {
-	_, err := db.db.NamedExec(
-		"INSERT INTO testing (id, user_id, date, teacher_id, class_id, result) VALUES (:id, :user_id, :date, :teacher_id, :class_id, :result)",
+func (db *sqlImpl) InsertTestingResult(testing Testing) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO testing (user_id, date, teacher_id, class_id, result) VALUES (:user_id, :date, :teacher_id, :class_id, :result)",
 		testing)
-	return err
 }
 
 func (db *sqlImpl) UpdateTestingResult(testing Testing) error {
@@ -0,0 +1,143 @@
+package sql
+
+import (
+	"errors"
+	"github.com/dchest/uniuri"
+	"time"
+)
+
+const RefreshTokenExpiration = 30 * 24 * time.Hour
+
+type Session struct {
+	ID           int
+	UserID       int    `db:"user_id"`
+	RefreshToken string `db:"refresh_token"`
+	CreatedAt    int64  `db:"created_at"`
+	ExpiresAt    int64  `db:"expires_at"`
+	IsRevoked    bool   `db:"is_revoked"`
+	TwoFactor    bool   `db:"two_factor"`
+}
+
+func (db *sqlImpl) GetSession(id int) (session Session, err error) {
+	err = db.db.Get(&session, "SELECT * FROM sessions WHERE id=$1", id)
+	return session, err
+}
+
+func (db *sqlImpl) GetSessionByRefreshToken(refreshToken string) (session Session, err error) {
+	err = db.db.Get(&session, "SELECT * FROM sessions WHERE refresh_token=$1", HashToken(refreshToken))
+	return session, err
+}
+
+func (db *sqlImpl) GetSessionsForUser(userId int) (sessions []Session, err error) {
+	err = db.db.Select(&sessions, "SELECT * FROM sessions WHERE user_id=$1 AND is_revoked=false ORDER BY id ASC", userId)
+	if sessions == nil {
+		sessions = make([]Session, 0)
+	}
+	return sessions, err
+}
+
+func (db *sqlImpl) InsertSession(session Session) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO sessions (user_id, refresh_token, created_at, expires_at, is_revoked, two_factor) VALUES (:user_id, :refresh_token, :created_at, :expires_at, :is_revoked, :two_factor)",
+		session)
+}
+
+func (db *sqlImpl) UpdateSession(session Session) error {
+	_, err := db.db.NamedExec(
+		"UPDATE sessions SET refresh_token=:refresh_token, expires_at=:expires_at, is_revoked=:is_revoked WHERE id=:id",
+		session)
+	return err
+}
+
+func (db *sqlImpl) RevokeSession(ID int) error {
+	_, err := db.db.Exec("UPDATE sessions SET is_revoked=true WHERE id=$1", ID)
+	return err
+}
+
+func (db *sqlImpl) RevokeAllUserSessions(userId int) error {
+	_, err := db.db.Exec("UPDATE sessions SET is_revoked=true WHERE user_id=$1", userId)
+	return err
+}
+
+func (db *sqlImpl) RevokeOtherUserSessions(userId int, sessionId int) error {
+	_, err := db.db.Exec("UPDATE sessions SET is_revoked=true WHERE user_id=$1 AND id<>$2", userId, sessionId)
+	return err
+}
+
+func (db *sqlImpl) DeleteUserSessions(userId int) {
+	db.db.Exec("DELETE FROM sessions WHERE user_id=$1", userId)
+}
+
+// NewSession creates a new session for the user and returns a short-lived access token together with a refresh token.
+// Only a hash of the refresh token is stored in the database. twoFactor marks whether the user completed
+// two-factor authentication while logging in.
+func (db *sqlImpl) NewSession(user User, twoFactor bool) (accessToken string, refreshToken string, err error) {
+	refreshToken = uniuri.NewLen(64)
+	now := time.Now()
+	session := Session{
+		UserID:       user.ID,
+		RefreshToken: HashToken(refreshToken),
+		CreatedAt:    now.Unix(),
+		ExpiresAt:    now.Add(RefreshTokenExpiration).Unix(),
+		IsRevoked:    false,
+		TwoFactor:    twoFactor,
+	}
+	session.ID, err = db.InsertSession(session)
+	if err != nil {
+		return "", "", err
+	}
+	accessToken, err = db.GetJWTFromUserPass(user.Email, user.Role, user.ID, session.ID, session.TwoFactor)
+	return accessToken, refreshToken, err
+}
+
+// RefreshSession exchanges a refresh token for a new access token. Refresh tokens are rotated on every use,
+// so the old refresh token stops working once this function returns.
+func (db *sqlImpl) RefreshSession(refreshToken string) (accessToken string, newRefreshToken string, err error) {
+	session, err := db.GetSessionByRefreshToken(refreshToken)
+	if err != nil {
+		return "", "", errors.New("invalid refresh token")
+	}
+	if session.IsRevoked || session.ExpiresAt < time.Now().Unix() {
+		return "", "", errors.New("session has been revoked")
+	}
+	user, err := db.GetUser(session.UserID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.Role == "unverified" {
+		return "", "", errors.New("you are an unverified user. You cannot do anything in this system until the server administrator confirms you")
+	}
+	newRefreshToken = uniuri.NewLen(64)
+	session, err = db.rotateRefreshToken(session, newRefreshToken)
+	if err != nil {
+		return "", "", err
+	}
+	accessToken, err = db.GetJWTFromUserPass(user.Email, user.Role, user.ID, session.ID, session.TwoFactor)
+	return accessToken, newRefreshToken, err
+}
+
+// rotateRefreshToken replaces the refresh token of the session, as read from the database, with the new one. When
+// the token was already rotated or the session revoked since it was read, the same refresh token was used twice,
+// which means it was stolen, so the session is revoked.
+func (db *sqlImpl) rotateRefreshToken(session Session, newRefreshToken string) (Session, error) {
+	expiresAt := time.Now().Add(RefreshTokenExpiration).Unix()
+	result, err := db.db.Exec("UPDATE sessions SET refresh_token=$1, expires_at=$2 WHERE id=$3 AND refresh_token=$4 AND is_revoked=false",
+		HashToken(newRefreshToken), expiresAt, session.ID, session.RefreshToken)
+	if err != nil {
+		return session, err
+	}
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return session, err
+	}
+	if changed == 0 {
+		err = db.RevokeSession(session.ID)
+		if err != nil {
+			return session, err
+		}
+		return session, errors.New("refresh token has already been used, the session has been revoked")
+	}
+	session.RefreshToken = HashToken(newRefreshToken)
+	session.ExpiresAt = expiresAt
+	return session, nil
+}
@@ -0,0 +1,91 @@
+package sql
+
+import (
+	"go.uber.org/zap"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestRefreshSessionConcurrently uses the same refresh token in parallel. At most one of the refreshes may get
+// a new token, the others have to fail.
+func TestRefreshSessionConcurrently(t *testing.T) {
+	db := newSessionTestDatabase(t)
+	_, refreshToken, err := db.NewSession(User{ID: 1, Email: "ucenec@example.com", Role: "student"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	refreshed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := db.RefreshSession(refreshToken)
+			if err == nil {
+				mutex.Lock()
+				refreshed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshed > 1 {
+		t.Errorf("refreshes with the same token: got %d, want at most 1", refreshed)
+	}
+}
+
+// TestRotateRefreshTokenTwice rotates a session read before another refresh rotated it, as the losing one of two
+// concurrent refreshes does. The reuse has to revoke the session.
+func TestRotateRefreshTokenTwice(t *testing.T) {
+	db := newSessionTestDatabase(t)
+	_, refreshToken, err := db.NewSession(User{ID: 1, Email: "ucenec@example.com", Role: "student"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := db.GetSessionByRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.rotateRefreshToken(stale, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.rotateRefreshToken(stale, "second")
+	if err == nil {
+		t.Fatal("the same refresh token was rotated twice")
+	}
+	session, err := db.GetSession(stale.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.IsRevoked {
+		t.Error("session with a reused refresh token wasn't revoked")
+	}
+}
+
+func newSessionTestDatabase(t *testing.T) *sqlImpl {
+	conn, err := NewSQL("sqlite3", filepath.Join(t.TempDir(), "meetplan.db"), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := conn.(*sqlImpl)
+	t.Cleanup(func() {
+		db.pool.Close()
+	})
+	_, err = db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.LoadSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.db.Exec("INSERT INTO users (id, email, pass, name, role, birth_certificate_number, country_of_birth, city_of_birth, is_passing) VALUES (1, 'ucenec@example.com', '', 'Učenec', 'student', '', '', '', true)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
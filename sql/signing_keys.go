@@ -0,0 +1,197 @@
+package sql
+
+import (
+	"errors"
+	"github.com/dchest/uniuri"
+	"sync"
+	"time"
+)
+
+// SigningKeyGracePeriod is the time during which a retired signing key can still verify tokens.
+// It has to be longer than the lifetime of any token we sign (self-testing tokens are valid for 48 hours).
+const SigningKeyGracePeriod = 7 * 24 * time.Hour
+
+type SigningKey struct {
+	ID        int
+	KID       string `db:"kid"`
+	Secret    string `json:"-"`
+	CreatedAt int64  `db:"created_at"`
+	ExpiresAt int64  `db:"expires_at"`
+	IsActive  bool   `db:"is_active"`
+}
+
+// SigningKeyReloadInterval limits how often tokens with an unknown kid reload the signing keys, so forged tokens
+// can't make every request query the database.
+const SigningKeyReloadInterval = 5 * time.Second
+
+type signingKeyring struct {
+	mutex     sync.RWMutex
+	keys      map[string]SigningKey
+	activeKid string
+	loadedAt  time.Time
+}
+
+func newSigningKeyring() *signingKeyring {
+	return &signingKeyring{keys: make(map[string]SigningKey)}
+}
+
+func (k *signingKeyring) set(keys []SigningKey) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.keys = make(map[string]SigningKey)
+	k.activeKid = ""
+	k.loadedAt = time.Now()
+	for i := 0; i < len(keys); i++ {
+		k.keys[keys[i].KID] = keys[i]
+		if keys[i].IsActive {
+			k.activeKid = keys[i].KID
+		}
+	}
+}
+
+func (k *signingKeyring) active() (kid string, key []byte, err error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	if k.activeKid == "" {
+		return "", nil, errors.New("no active signing key")
+	}
+	return k.activeKid, []byte(k.keys[k.activeKid].Secret), nil
+}
+
+// reloadDue reports whether the keys may be reloaded, and if so, it counts the caller's reload as done already, so
+// concurrent callers don't reload them as well.
+func (k *signingKeyring) reloadDue() bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if time.Since(k.loadedAt) < SigningKeyReloadInterval {
+		return false
+	}
+	k.loadedAt = time.Now()
+	return true
+}
+
+func (k *signingKeyring) get(kid string) ([]byte, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	key, ok := k.keys[kid]
+	if !ok || (!key.IsActive && key.ExpiresAt < time.Now().Unix()) {
+		return nil, false
+	}
+	return []byte(key.Secret), true
+}
+
+func (db *sqlImpl) GetSigningKeys() (keys []SigningKey, err error) {
+	err = db.db.Select(&keys, "SELECT * FROM signing_keys ORDER BY id ASC")
+	if keys == nil {
+		keys = make([]SigningKey, 0)
+	}
+	return keys, err
+}
+
+func (db *sqlImpl) InsertSigningKey(key SigningKey) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO signing_keys (kid, secret, created_at, expires_at, is_active) VALUES (:kid, :secret, :created_at, :expires_at, :is_active)",
+		key)
+}
+
+func (db *sqlImpl) UpdateSigningKey(key SigningKey) error {
+	_, err := db.db.NamedExec(
+		"UPDATE signing_keys SET expires_at=:expires_at, is_active=:is_active WHERE id=:id",
+		key)
+	return err
+}
+
+func (db *sqlImpl) DeleteExpiredSigningKeys() error {
+	_, err := db.db.Exec("DELETE FROM signing_keys WHERE is_active=false AND expires_at<$1", time.Now().Unix())
+	return err
+}
+
+// LoadSigningKeys loads all signing keys from the database into memory. If there is no active key yet
+// (for example on the first start), a new one is generated.
+func (db *sqlImpl) LoadSigningKeys() error {
+	keys, err := db.GetSigningKeys()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(keys); i++ {
+		if keys[i].IsActive {
+			db.keyring.set(keys)
+			return nil
+		}
+	}
+	_, err = db.RotateSigningKey()
+	return err
+}
+
+// RotateSigningKey generates a new active signing key. Previously active key is retired, but it can still
+// verify tokens until SigningKeyGracePeriod passes.
+func (db *sqlImpl) RotateSigningKey() (SigningKey, error) {
+	tx, err := db.begin()
+	if err != nil {
+		return SigningKey{}, err
+	}
+	defer tx.Rollback()
+	// Instances sharing a PostgreSQL database could otherwise both retire the same key and activate one each
+	if db.driver == "postgres" {
+		_, err = tx.Exec("LOCK TABLE signing_keys IN SHARE ROW EXCLUSIVE MODE")
+		if err != nil {
+			return SigningKey{}, err
+		}
+	}
+	now := time.Now()
+	_, err = tx.Exec("UPDATE signing_keys SET is_active=false, expires_at=$1 WHERE is_active=true", now.Add(SigningKeyGracePeriod).Unix())
+	if err != nil {
+		return SigningKey{}, err
+	}
+	key := SigningKey{
+		KID:       uniuri.NewLen(16),
+		Secret:    uniuri.NewLen(100),
+		CreatedAt: now.Unix(),
+		ExpiresAt: 0,
+		IsActive:  true,
+	}
+	key.ID, err = db.insert(tx,
+		"INSERT INTO signing_keys (kid, secret, created_at, expires_at, is_active) VALUES (:kid, :secret, :created_at, :expires_at, :is_active)",
+		key)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	_, err = tx.Exec("DELETE FROM signing_keys WHERE is_active=false AND expires_at<$1", now.Unix())
+	if err != nil {
+		return SigningKey{}, err
+	}
+	var keys []SigningKey
+	err = tx.Select(&keys, "SELECT * FROM signing_keys ORDER BY id ASC")
+	if err != nil {
+		return SigningKey{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return SigningKey{}, err
+	}
+	db.keyring.set(keys)
+	return key, nil
+}
+
+// getVerificationKey returns the key with the specified kid. As keys might be rotated by another
+// MeetPlan instance sharing the same database, keys are reloaded when kid isn't known, but at most once
+// per SigningKeyReloadInterval.
+func (db *sqlImpl) getVerificationKey(kid string) ([]byte, error) {
+	key, ok := db.keyring.get(kid)
+	if ok {
+		return key, nil
+	}
+	if !db.keyring.reloadDue() {
+		return nil, errors.New("unknown or expired signing key")
+	}
+	keys, err := db.GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	db.keyring.set(keys)
+	key, ok = db.keyring.get(kid)
+	if !ok {
+		return nil, errors.New("unknown or expired signing key")
+	}
+	return key, nil
+}
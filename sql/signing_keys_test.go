@@ -0,0 +1,67 @@
+package sql
+
+import (
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSigningKeysOfAnotherInstance shares a database between two instances. Tokens signed after the other
+// instance rotated the key are accepted once the keys are reloaded, but unknown kids can't reload them any time.
+func TestSigningKeysOfAnotherInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meetplan.db")
+	instances := make([]*sqlImpl, 2)
+	for i := range instances {
+		conn, err := NewSQL("sqlite3", path, zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatal(err)
+		}
+		instances[i] = conn.(*sqlImpl)
+		defer instances[i].pool.Close()
+		_, err = instances[i].MigrateUp()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = instances[i].LoadSigningKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := instances[0], instances[1]
+	if a.keyring == b.keyring {
+		t.Fatal("instances share the keyring")
+	}
+
+	_, err := a.RotateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := a.GetJWTForTwoFactor(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys were loaded just now, so b doesn't reload them yet
+	_, err = b.CheckTwoFactorJWT(token)
+	if err == nil {
+		t.Fatal("keys were reloaded before SigningKeyReloadInterval passed")
+	}
+	b.keyring.loadedAt = time.Now().Add(-SigningKeyReloadInterval)
+	_, err = b.CheckTwoFactorJWT(token)
+	if err != nil {
+		t.Fatalf("token of the rotated key: %s", err.Error())
+	}
+
+	_, err = a.RotateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err = a.GetJWTForTwoFactor(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.CheckTwoFactorJWT(token)
+	if err == nil {
+		t.Error("keys were reloaded twice within SigningKeyReloadInterval")
+	}
+}
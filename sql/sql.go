@@ -1,37 +1,190 @@
 package sql
 
 import (
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// database runs the queries, either on the connection pool or in the transaction of an audited write.
+type database interface {
+	sqlx.Ext
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	NamedExec(query string, arg interface{}) (dbsql.Result, error)
+}
+
+type transaction interface {
+	database
+	Commit() error
+	Rollback() error
+}
+
 type sqlImpl struct {
-	db     *sqlx.DB
+	db database
+	// The connection pool, also when db is a transaction
+	pool   *sqlx.DB
+	driver string
 	logger *zap.SugaredLogger
+	// Serializes audited writes, so the audit log's hash chain doesn't fork
+	auditMutex *sync.Mutex
+	// Key of the audit log's hash chain, see SetAuditKey
+	auditKey []byte
+	// Signing keys of JWTs, shared with the transaction-bound copies
+	keyring *signingKeyring
+}
+
+func newSQLImpl(db *sqlx.DB, driver string, logger *zap.SugaredLogger) *sqlImpl {
+	return &sqlImpl{
+		db:         db,
+		pool:       db,
+		driver:     driver,
+		logger:     logger,
+		auditMutex: &sync.Mutex{},
+		auditKey:   randomAuditKey(),
+		keyring:    newSigningKeyring(),
+	}
+}
+
+// withTx returns the database, which runs all queries in the transaction. Transactions its methods begin
+// become savepoints of the transaction.
+func (db *sqlImpl) withTx(tx *sqlx.Tx) *sqlImpl {
+	bound := *db
+	bound.db = tx
+	return &bound
+}
+
+// begin starts a transaction, or a savepoint when the database already runs in one.
+func (db *sqlImpl) begin() (transaction, error) {
+	tx, ok := db.db.(*sqlx.Tx)
+	if !ok {
+		return db.pool.Beginx()
+	}
+	sp := &savepoint{Tx: tx, name: fmt.Sprintf("meetplan_%d", atomic.AddInt64(&savepoints, 1))}
+	_, err := tx.Exec("SAVEPOINT " + sp.name)
+	return sp, err
 }
 
+// execAll runs the queries with the same arguments in one transaction. Deletes of a row and the rows that
+// belong to it use it, as SQLite doesn't enforce the ON DELETE CASCADE of the membership tables.
+func (db *sqlImpl) execAll(queries []string, args ...interface{}) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(queries); i++ {
+		_, err = tx.Exec(queries[i], args...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// savepoints numbers savepoints, so nested ones get distinct names.
+var savepoints int64
+
+// savepoint is a transaction nested in another one. Committing it only releases the savepoint, the changes
+// are committed together with the outer transaction.
+type savepoint struct {
+	*sqlx.Tx
+	name string
+	done bool
+}
+
+func (sp *savepoint) Commit() error {
+	if sp.done {
+		return dbsql.ErrTxDone
+	}
+	sp.done = true
+	_, err := sp.Tx.Exec("RELEASE SAVEPOINT " + sp.name)
+	return err
+}
+
+func (sp *savepoint) Rollback() error {
+	if sp.done {
+		return dbsql.ErrTxDone
+	}
+	sp.done = true
+	_, err := sp.Tx.Exec("ROLLBACK TO SAVEPOINT " + sp.name)
+	if err != nil {
+		return err
+	}
+	_, err = sp.Tx.Exec("RELEASE SAVEPOINT " + sp.name)
+	return err
+}
+
+// insert runs the named INSERT statement and returns the ID the database generated for the new row.
+// The postgres driver doesn't support LastInsertId, so the ID is returned by the statement itself.
+func (db *sqlImpl) insert(e sqlx.Ext, query string, arg interface{}) (id int, err error) {
+	if db.driver == "postgres" {
+		rows, err := sqlx.NamedQuery(e, query+" RETURNING id", arg)
+		if err != nil {
+			return -1, err
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return -1, rows.Err()
+			}
+			return -1, errors.New("insert didn't return an ID")
+		}
+		err = rows.Scan(&id)
+		return id, err
+	}
+	result, err := sqlx.NamedExec(e, query, arg)
+	if err != nil {
+		return -1, err
+	}
+	lastId, err := result.LastInsertId()
+	return int(lastId), err
+}
+
+// Init expects the schema to be migrated already, see MigrateUp.
 func (db *sqlImpl) Init() {
-	db.db.MustExec(schema)
+	err := db.CheckSchemaVersion()
+	if err != nil {
+		db.logger.Fatal("Database schema isn't up to date: " + err.Error())
+	}
+	err = db.LoadSigningKeys()
+	if err != nil {
+		db.logger.Fatal("Error while loading JWT signing keys: " + err.Error())
+	}
+	err = db.SeedRoles()
+	if err != nil {
+		db.logger.Fatal("Error while creating built-in roles: " + err.Error())
+	}
 }
 
 type SQL interface {
 	Init()
 
+	SchemaVersion() (int, error)
+	GetMigrationStatus() ([]MigrationStatus, error)
+	CheckSchemaVersion() error
+	MigrateUp() (applied []MigrationStatus, err error)
+	MigrateDown(steps int) (reverted []MigrationStatus, err error)
+
 	UpdateTestingResult(testing Testing) error
-	InsertTestingResult(testing Testing) error
-	GetTestingResults(date string, classId int) ([]TestingJSON, error)
+	InsertTestingResult(testing Testing) (id int, err error)
+	GetTestingResults(date Date, classId int) ([]TestingJSON, error)
 	GetAllTestingsForUser(id int) (testing []Testing, err error)
-	GetTestingResult(date string, id int) (Testing, error)
+	GetTestingResult(date Date, id int) (Testing, error)
 	GetTestingResultByID(id int) (Testing, error)
-	GetLastTestingID() int
 	DeleteTeacherSelfTesting(teacherId int) error
 	DeleteUserSelfTesting(userId int) error
 
 	GetUser(id int) (message User, err error)
-	InsertUser(user User) (err error)
-	GetLastUserID() (id int)
+	InsertUser(user User) (id int, err error)
 	GetUserByEmail(email string) (message User, err error)
 	CheckIfAdminIsCreated() bool
 	GetAllUsers() (users []User, err error)
@@ -39,119 +192,269 @@ type SQL interface {
 	DeleteUser(ID int) error
 	GetTeachers() ([]User, error)
 	GetPrincipal() (principal User, err error)
+	GetChildren(parentId int) (children []int, err error)
+	GetParents(studentId int) (parents []int, err error)
+	IsParentOf(parentId int, studentId int) (bool, error)
+	AddChildToParent(parentId int, studentId int) error
+	RemoveChildFromParent(parentId int, studentId int) error
 
 	GetClass(id int) (Class, error)
-	InsertClass(class Class) (err error)
-	GetLastClassID() (id int)
+	InsertClass(class Class) (id int, err error)
 	UpdateClass(class Class) error
 	GetClasses() ([]Class, error)
 	DeleteClass(ID int) error
 	DeleteTeacherClasses(teacherId int) error
 	DeleteUserClasses(userId int)
+	GetClassStudents(classId int) (students []int, err error)
+	GetClassesForStudent(userId int) (classes []Class, err error)
+	IsStudentInClass(classId int, userId int) (bool, error)
+	AddStudentToClass(classId int, userId int) error
+	RemoveStudentFromClass(classId int, userId int) error
 
 	GetMeeting(id int) (meeting Meeting, err error)
-	GetMeetingsOnSpecificTime(date string, hour int) (meetings []Meeting, err error)
+	GetMeetingsOnSpecificTime(date Date, hour int) (meetings []Meeting, err error)
 	GetMeetingsForSubject(subjectId int) (meetings []Meeting, err error)
-	GetMeetingsForTeacherOnSpecificDate(teacherId int, date string) (meetings []Meeting, err error)
-	InsertMeeting(meeting Meeting) (err error)
+	GetMeetingsForTeacherOnSpecificDate(teacherId int, date Date) (meetings []Meeting, err error)
+	InsertMeeting(meeting Meeting) (id int, err error)
 	UpdateMeeting(meeting Meeting) error
-	GetLastMeetingID() (id int)
 	GetMeetings() (meetings []Meeting, err error)
 	GetMeetingsForSubjectWithIDLower(id int, subjectId int) (meetings []Meeting, err error)
 	DeleteMeeting(ID int) error
-	GetMeetingsOnSpecificDate(date string) (meetings []Meeting, err error)
+	GetMeetingsOnSpecificDate(date Date) (meetings []Meeting, err error)
+	GetMeetingsBetween(from Date, to Date) (meetings []Meeting, err error)
 	DeleteMeetingsForTeacher(ID int) error
 	DeleteMeetingsForSubject(ID int) error
+	WithMeetingsLocked(fn func(tx SQL) error) error
 
-	GetLastAbsenceID() int
 	GetAbsence(id int) (absence Absence, err error)
 	GetAllAbsences(id int) (absences []Absence, err error)
-	InsertAbsence(absence Absence) error
+	InsertAbsence(absence Absence) (id int, err error)
 	UpdateAbsence(absence Absence) error
 	GetAbsenceForUserMeeting(meeting_id int, user_id int) (absence Absence, err error)
 	GetAbsencesForUser(user_id int) (absence []Absence, err error)
 	DeleteAbsencesForTeacher(userId int)
 	DeleteAbsencesForUser(userId int)
 
-	GetLastSubjectID() int
 	GetSubject(id int) (subject Subject, err error)
 	GetAllSubjectsForTeacher(id int) (subject []Subject, err error)
 	GetAllSubjectsForUser(id int) (subject []Subject, err error)
 	GetSubjectsWithSpecificLongName(longName string) (subject []Subject, err error)
-	InsertSubject(subject Subject) error
+	InsertSubject(subject Subject) (id int, err error)
 	UpdateSubject(subject Subject) error
 	GetAllSubjects() (subject []Subject, err error)
 	GetStudents() (message []User, err error)
 	DeleteSubject(subject Subject) error
 	DeleteStudentSubject(userId int)
+	GetSubjectStudents(subject Subject) (students []int, err error)
+	AddStudentToSubject(subjectId int, userId int) error
+	RemoveStudentFromSubject(subjectId int, userId int) error
 
-	GetLastGradeID() int
 	GetGrade(id int) (grade Grade, err error)
 	GetGradesForUser(userId int) (grades []Grade, err error)
 	GetGradesForUserInSubject(userId int, subjectId int) (grades []Grade, err error)
 	CheckIfFinal(userId int, subjectId int) (grade Grade, err error)
-	InsertGrade(grade Grade) error
+	InsertGrade(grade Grade) (id int, err error)
 	UpdateGrade(grade Grade) error
 	DeleteGrade(ID int) error
 	DeleteGradesByTeacherID(ID int) error
 	DeleteGradesByUserID(ID int) error
 
-	GetLastHomeworkID() int
 	GetHomework(id int) (homework Homework, err error)
 	GetHomeworkForSubject(id int) (homework []Homework, err error)
-	InsertHomework(homework Homework) error
+	InsertHomework(homework Homework) (id int, err error)
 	UpdateHomework(homework Homework) error
 	DeleteHomework(ID int) error
 
-	GetLastStudentHomeworkID() int
 	GetStudentHomework(id int) (homework StudentHomework, err error)
 	GetStudentHomeworkForUser(homeworkId int, userId int) (homework StudentHomework, err error)
 	DeleteStudentHomeworkByStudentID(ID int) error
 	GetHomeworkForTeacher(teacherId int) (homework []Homework, err error)
 	GetStudentsHomeworkByHomeworkID(id int, meetingId int) (homework []StudentHomeworkJSON, err error)
 	GetStudentsHomework(id int) (homework []StudentHomework, err error)
-	InsertStudentHomework(homework StudentHomework) error
+	InsertStudentHomework(homework StudentHomework) (id int, err error)
 	UpdateStudentHomework(homework StudentHomework) error
 	DeleteStudentHomework(ID int) error
 	DeleteStudentHomeworkByHomeworkID(ID int) error
 	DeleteAllTeacherHomeworks(ID int)
 
 	GetCommunication(id int) (communication Communication, err error)
-	InsertCommunication(communication Communication) (err error)
+	InsertCommunication(communication Communication, people []int) (id int, err error)
 	UpdateCommunication(communication Communication) error
-	GetLastCommunicationID() (id int)
 	GetCommunications() (communication []Communication, err error)
 	DeleteCommunication(ID int) error
 	DeleteUserCommunications(userId int)
+	GetCommunicationPeople(communicationId int) (people []int, err error)
+	GetCommunicationsForUser(userId int) (communications []Communication, err error)
+	IsInCommunication(communicationId int, userId int) (bool, error)
 
 	GetMessage(id int) (message Message, err error)
 	GetCommunicationMessages(communicationId int) (messages []Message, err error)
 	GetAllUnreadMessages(userId int) (messages []Message, err error)
-	InsertMessage(message Message) (err error)
+	InsertMessage(message Message) (id int, err error)
 	UpdateMessage(message Message) error
-	GetLastMessageID() (id int)
 	GetAllMessages() (messages []Message, err error)
 	DeleteMessage(ID int) error
+	GetMessageSeen(messageId int) (users []int, err error)
+	MarkMessageSeen(messageId int, userId int) error
 
 	GetMeal(id int) (meal Meal, err error)
-	InsertMeal(meal Meal) (err error)
+	InsertMeal(meal Meal) (id int, err error)
 	UpdateMeal(meal Meal) error
-	GetLastMealID() (id int)
 	GetMeals() (meals []Meal, err error)
 	DeleteMeal(ID int) error
+	GetMealOrders(mealId int) (orders []int, err error)
+	GetMealsForUser(userId int) (meals []Meal, err error)
+	AddMealOrder(mealId int, userId int) (ordered bool, err error)
+	RemoveMealOrder(mealId int, userId int) error
 
 	GetNotification(id int) (notification NotificationSQL, err error)
 	GetAllNotifications() (notifications []NotificationSQL, err error)
-	InsertNotification(notification NotificationSQL) (err error)
+	InsertNotification(notification NotificationSQL) (id int, err error)
 	UpdateNotification(notification NotificationSQL) error
-	GetLastNotificationID() (id int)
 	DeleteNotification(ID int) error
+
+	CheckJWT(tokenString string) (jwt.MapClaims, error)
+	CheckJWTWithoutTwoFactor(tokenString string) (jwt.MapClaims, error)
+	CheckTwoFactorJWT(tokenString string) (int, error)
+	GetJWTForImpersonation(user User, adminId int, sessionId int, twoFactor bool) (string, int64, error)
+	GetJWTForTestingResult(userId int, result string, testId int, date Date) (string, error, Date)
+	GetJWTForTwoFactor(uid int) (string, error)
+	NewSession(user User, twoFactor bool) (accessToken string, refreshToken string, err error)
+	RefreshSession(refreshToken string) (accessToken string, newRefreshToken string, err error)
+	GetSession(id int) (session Session, err error)
+	GetSessionByRefreshToken(refreshToken string) (session Session, err error)
+	GetSessionsForUser(userId int) (sessions []Session, err error)
+	InsertSession(session Session) (id int, err error)
+	UpdateSession(session Session) error
+	RevokeSession(ID int) error
+	RevokeAllUserSessions(userId int) error
+	RevokeOtherUserSessions(userId int, sessionId int) error
+	DeleteUserSessions(userId int)
+
+	GetSigningKeys() (keys []SigningKey, err error)
+	InsertSigningKey(key SigningKey) (id int, err error)
+	UpdateSigningKey(key SigningKey) error
+	DeleteExpiredSigningKeys() error
+	LoadSigningKeys() error
+	RotateSigningKey() (SigningKey, error)
+
+	GetRecoveryCodes(userId int) (codes []RecoveryCode, err error)
+	InsertRecoveryCode(code RecoveryCode) (id int, err error)
+	UpdateRecoveryCode(code RecoveryCode) error
+	DeleteRecoveryCodes(userId int)
+	GenerateRecoveryCodes(userId int) ([]string, error)
+	CheckTwoFactorCode(user User, code string) (bool, error)
+	GetTwoFactorRoles() (roles []string, err error)
+	SetTwoFactorRoles(roles []string) error
+	IsTwoFactorRequired(role string) bool
+
+	GetPasswordResetByToken(token string) (reset PasswordReset, err error)
+	InsertPasswordReset(reset PasswordReset) (id int, err error)
+	UpdatePasswordReset(reset PasswordReset) error
+	DeletePasswordResets(userId int)
+	NewPasswordReset(userId int) (string, error)
+	ResetPassword(token string, password string) error
+
+	GetCalendarFeed(userId int) (feed CalendarFeed, err error)
+	GetCalendarFeedByToken(token string) (feed CalendarFeed, err error)
+	InsertCalendarFeed(feed CalendarFeed) (id int, err error)
+	UpdateCalendarFeed(feed CalendarFeed) error
+	DeleteCalendarFeed(userId int) error
+	NewCalendarFeed(userId int) (string, error)
+	GetMeetingsForUser(userId int) (meetings []Meeting, err error)
+
+	InsertLoginAttempt(attempt LoginAttempt) (id int, err error)
+	GetFailedLoginAttempts(limit int) (attempts []LoginAttempt, err error)
+	GetLoginAttemptsForUser(userId int) (attempts []LoginAttempt, err error)
+	RecordLoginAttempt(userId int, email string, ip string, successful bool, reason string)
+
+	InsertImpersonationLog(entry ImpersonationLog) (id int, err error)
+	GetImpersonationLogs(adminId int, userId int, limit int) (entries []ImpersonationLog, err error)
+	RecordImpersonatedRequest(adminId int, userId int, method string, endpoint string, ip string, allowed bool)
+	GetLoginThrottle(key string) (throttle LoginThrottle, err error)
+	GetLockedLoginThrottles() (throttles []LoginThrottle, err error)
+	DeleteLoginThrottle(key string) error
+	CheckLoginThrottle(keys ...string) time.Duration
+	ReserveLoginAttempt(key string, policy ThrottlePolicy) (wait time.Duration, err error)
+	ReleaseLoginAttempt(key string) error
+
+	GetRoles() (roles []Role, err error)
+	GetRole(name string) (role Role, err error)
+	InsertRole(role Role) error
+	UpdateRole(role Role) error
+	DeleteRole(name string) error
+	GetPermissionsForRole(role string) (permissions []string, err error)
+	SetRolePermissions(role string, permissions []string) error
+	HasPermission(role string, permission string) bool
+	CanAssignRole(assigner string, assigned string) (bool, error)
+	SeedRoles() error
+
+	ImportUsers(students []ImportedStudent, newClasses []Class) (result ImportResult, err error)
+
+	GetChildInvitationByCode(code string) (invitation ChildInvitation, err error)
+	GetChildInvitationsForStudent(studentId int) (invitations []ChildInvitation, err error)
+	InsertChildInvitation(invitation ChildInvitation) (id int, err error)
+	DeleteChildInvitations(studentId int)
+	NewChildInvitation(studentId int, createdBy int) (string, error)
+	RedeemChildInvitation(code string, parent User) (student User, err error)
+
+	InsertOIDCState(state OIDCState) error
+	NewOIDCState() (state string, nonce string, err error)
+	ConsumeOIDCState(state string) (nonce string, err error)
+
+	WithActor(actor AuditActor) SQL
+	SetAuditKey(key string)
+	InsertAuditEntry(entry AuditEntry) error
+	GetAuditEntries(filter AuditFilter) (entries []AuditEntry, err error)
+	VerifyAuditLog() (verification AuditVerification, err error)
+	RekeyAuditLog(oldKey string) (verification AuditVerification, err error)
+
+	GetLegalHold(userId int) (hold LegalHold, err error)
+	GetLegalHolds() (holds []LegalHold, err error)
+	SetLegalHold(hold LegalHold) error
+	DeleteLegalHold(userId int) error
+	PreviewUserDeletion(userId int, mode string) (DeletionPreview, error)
+	DeleteUserData(userId int, mode string) (preview DeletionPreview, err error)
+
+	WriteSnapshot(dir string) (snapshot Snapshot, err error)
+	RestoreSnapshot(dir string, snapshot Snapshot) error
+
+	GetTimetableTemplate(id int) (template TimetableTemplate, err error)
+	GetTimetableTemplates() (templates []TimetableTemplate, err error)
+	GetTimetableTemplatesForTeacher(teacherId int) (templates []TimetableTemplate, err error)
+	GetMeetingsForTemplate(templateId int) (meetings []Meeting, err error)
+	ApplyTimetableTemplate(template TimetableTemplate, from Date, freeDays []Date) (sync TemplateSync, err error)
+	DeleteTimetableTemplate(id int, from Date) (sync TemplateSync, err error)
+
+	GetUnavailableHours() (hours []UnavailableHour, err error)
+	GetUnavailableHoursForTeacher(teacherId int) (hours []UnavailableHour, err error)
+	SetUnavailableHours(teacherId int, hours []UnavailableHour) error
+	GetTimetableDraft(id int) (draft TimetableDraft, err error)
+	GetTimetableDrafts() (drafts []TimetableDraft, err error)
+	GetTimetableDraftLessons(draftId int) (lessons []TimetableDraftLesson, err error)
+	InsertTimetableDraft(draft TimetableDraft, lessons []TimetableDraftLesson) (id int, err error)
+	DeleteTimetableDraft(id int) error
+	PublishTimetableDraft(id int, freeDays []Date) (syncs []TemplateSync, err error)
+
+	GetSchoolYears() (years []SchoolYear, err error)
+	GetSchoolYear(id int) (year SchoolYear, err error)
+	GetArchivedClasses(schoolYearId int) (classes []ArchivedClass, err error)
+	GetArchivedClassStudents(schoolYearId int, classId int) (students []ArchivedClassStudent, err error)
+	GetArchivedClassesForStudent(userId int) (classes []ArchivedClassStudent, err error)
+	GetArchivedSubjects(schoolYearId int) (subjects []ArchivedSubject, err error)
+	GetArchivedMeetingsForSubject(schoolYearId int, subjectId int) (meetings []ArchivedMeeting, err error)
+	GetArchivedHomeworkForSubject(schoolYearId int, subjectId int) (homework []ArchivedHomework, err error)
+	GetArchivedGradesForUser(userId int) (grades []ArchivedGrade, err error)
+	GetArchivedAbsencesForUser(userId int) (absences []ArchivedAbsence, err error)
+	GetArchivedStudentHomeworkForUser(userId int) (homework []ArchivedStudentHomework, err error)
+	PreviewRollover(opts RolloverOptions) (RolloverPlan, error)
+	RollOver(opts RolloverOptions) (plan RolloverPlan, err error)
 }
 
 func NewSQL(driver string, drivername string, logger *zap.SugaredLogger) (SQL, error) {
 	db, err := sqlx.Connect(driver, drivername)
-	return &sqlImpl{
-		db:     db,
-		logger: logger,
-	}, err
+	if err != nil {
+		return nil, err
+	}
+	return newSQLImpl(db, driver, logger), nil
 }
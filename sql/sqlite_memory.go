@@ -0,0 +1,31 @@
+package sql
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"sync/atomic"
+)
+
+// memoryDatabases numbers in-memory SQLite databases, so every NewInMemorySQLite gets a database of its own.
+var memoryDatabases int64
+
+// NewInMemorySQLite returns a SQL backed by a private SQLite database in mode=memory. It runs on the sqlite3 driver,
+// so it behaves exactly like a SQLite file and isn't a driver of its own, but nothing is written to disk and the database
+// disappears once it's closed. It is meant for checking handlers without a database file, see the fixtures package.
+//
+// The database is empty, so it has to be migrated with MigrateUp and initialized with Init before it's used,
+// the same as a new SQLite file.
+func NewInMemorySQLite(logger *zap.SugaredLogger) (SQL, error) {
+	// Connections of a pool only see the same in-memory database when they share its cache
+	dsn := fmt.Sprintf("file:meetplan-memory-%d?mode=memory&cache=shared", atomic.AddInt64(&memoryDatabases, 1))
+	db, err := sqlx.Connect("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// The database is dropped together with its last connection, so one is never closed while idle
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	db.SetMaxIdleConns(1)
+	return newSQLImpl(db, "sqlite3", logger), nil
+}
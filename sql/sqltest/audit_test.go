@@ -0,0 +1,165 @@
+package sqltest
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"strings"
+	"testing"
+)
+
+// auditKey is the key of the audit log of checked databases.
+const auditKey = "sqltest audit key"
+
+var auditCheck = check{
+	name:    "audit log",
+	methods: []string{"WithActor", "SetAuditKey", "InsertAuditEntry", "GetAuditEntries", "VerifyAuditLog", "RekeyAuditLog"},
+	run: func(t *testing.T, db sql.SQL) {
+		admin := newUser(t, db, sql.AdminRole)
+		endpoint := unique("PATCH /user/get/data/{id}")
+		audited := db.WithActor(sql.AuditActor{UserID: admin.ID, Role: admin.Role, Endpoint: endpoint})
+		user := newUser(t, audited, "student")
+		user.Name = "Preimenovan"
+		noError(t, "UpdateUser", audited.UpdateUser(user))
+
+		entries, err := db.GetAuditEntries(sql.AuditFilter{UserID: admin.ID, Endpoint: endpoint, Limit: 10})
+		noError(t, "GetAuditEntries", err)
+		equal(t, "audited writes", len(entries), 2)
+		if len(entries) == 2 {
+			assert(t, "update is the newest", entries[0].Action == sql.AuditActionUpdate && entries[0].EntityID == fmt.Sprint(user.ID))
+			assert(t, "update stores the previous state", strings.Contains(entries[0].Before, user.Email))
+			assert(t, "insert has no previous state", entries[1].Action == sql.AuditActionInsert && entries[1].Before == "")
+			equal(t, "chained entries", entries[0].PrevHash, entries[1].Hash)
+		}
+
+		entry := sql.AuditEntry{CreatedAt: farFuture, UserID: admin.ID, Role: admin.Role, Endpoint: endpoint, EntityType: "meal", EntityID: "1", Action: sql.AuditActionDelete, Before: "{}"}
+		noError(t, "InsertAuditEntry", db.InsertAuditEntry(entry))
+		entries, err = db.GetAuditEntries(sql.AuditFilter{UserID: -1, EntityType: "meal", From: farFuture, Limit: 10})
+		noError(t, "GetAuditEntries", err)
+		equal(t, "entries from the future", len(entries), 1)
+		entries, err = db.GetAuditEntries(sql.AuditFilter{UserID: -1, EntityType: "user", EntityID: fmt.Sprint(user.ID), To: farFuture - 1, Limit: 1, Offset: 1})
+		noError(t, "GetAuditEntries", err)
+		assert(t, "second newest entry of the user", len(entries) == 1 && entries[0].Action == sql.AuditActionInsert)
+
+		verification, err := db.VerifyAuditLog()
+		noError(t, "VerifyAuditLog", err)
+		assert(t, "audit log is valid", verification.Valid && verification.BrokenAt == -1)
+		assert(t, "entries are verified", verification.Entries >= 3)
+
+		communication, err := db.InsertCommunication(sql.Communication{Title: "Izlet"}, []int{user.ID, admin.ID})
+		noError(t, "InsertCommunication", err)
+		audited.DeleteUserCommunications(user.ID)
+		_, err = db.GetCommunication(communication)
+		notFound(t, "GetCommunication after DeleteUserCommunications", err)
+		entries, err = db.GetAuditEntries(sql.AuditFilter{UserID: admin.ID, EntityType: "communication", EntityID: "user:" + fmt.Sprint(user.ID), Limit: 10})
+		noError(t, "GetAuditEntries", err)
+		assert(t, "deleted communications are recorded", len(entries) == 1 && strings.Contains(entries[0].Before, "Izlet"))
+
+		// A chain hashed with another key doesn't verify, until it's hashed again with the new key
+		db.SetAuditKey("rotated " + auditKey)
+		verification, err = db.VerifyAuditLog()
+		noError(t, "VerifyAuditLog", err)
+		assert(t, "audit log with another key is broken", !verification.Valid && verification.BrokenAt != -1)
+		verification, err = db.RekeyAuditLog("wrong " + auditKey)
+		noError(t, "RekeyAuditLog", err)
+		assert(t, "wrong old key is rejected", !verification.Valid)
+		verification, err = db.RekeyAuditLog(auditKey)
+		noError(t, "RekeyAuditLog", err)
+		assert(t, "old key is accepted", verification.Valid)
+		verification, err = db.VerifyAuditLog()
+		noError(t, "VerifyAuditLog", err)
+		assert(t, "rekeyed audit log is valid", verification.Valid)
+	},
+}
+
+var userDeletionCheck = check{
+	name: "user deletion",
+	methods: []string{"GetLegalHold", "GetLegalHolds", "SetLegalHold", "DeleteLegalHold", "PreviewUserDeletion",
+		"DeleteUserData", "DeleteUser"},
+	run: func(t *testing.T, db sql.SQL) {
+		admin := newUser(t, db, sql.AdminRole)
+		teacher := newUser(t, db, "teacher")
+		student := newUser(t, db, "student")
+		parent := newUser(t, db, "parent")
+		class := newClass(t, db, teacher.ID)
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, student.ID))
+		noError(t, "AddChildToParent", db.AddChildToParent(parent.ID, student.ID))
+		_, _, err := db.NewSession(student, false)
+		noError(t, "NewSession", err)
+		_, err = db.NewCalendarFeed(student.ID)
+		noError(t, "NewCalendarFeed", err)
+		_, err = db.NewCalendarFeed(parent.ID)
+		noError(t, "NewCalendarFeed", err)
+		subject := newSubject(t, db, teacher.ID, class.ID)
+		meeting := newMeeting(t, db, subject, day("2031-03-03"), 1)
+		_, err = db.InsertGrade(sql.Grade{UserID: student.ID, TeacherID: teacher.ID, SubjectID: subject.ID, Grade: 5, Date: now(), CanPatch: true, Period: 1, Description: "Ustno"})
+		noError(t, "InsertGrade", err)
+		_, err = db.InsertAbsence(sql.Absence{UserID: student.ID, TeacherID: teacher.ID, MeetingID: meeting.ID, AbsenceType: "ABSENT"})
+		noError(t, "InsertAbsence", err)
+
+		hold := sql.LegalHold{UserID: student.ID, Reason: "Pritožba na oceno", CreatedBy: admin.ID, CreatedAt: farFuture}
+		noError(t, "SetLegalHold", db.SetLegalHold(hold))
+		hold.Reason = "Pritožba na zaključno oceno"
+		noError(t, "SetLegalHold on a held user", db.SetLegalHold(hold))
+		got, err := db.GetLegalHold(student.ID)
+		noError(t, "GetLegalHold", err)
+		equal(t, "legal hold", got, hold)
+		holds, err := db.GetLegalHolds()
+		noError(t, "GetLegalHolds", err)
+		equal(t, "legal holds", holds, []sql.LegalHold{hold})
+
+		preview, err := db.PreviewUserDeletion(student.ID, sql.DeletionModeAnonymize)
+		noError(t, "PreviewUserDeletion", err)
+		assert(t, "held user is blocked", len(preview.Blockers) == 1 && preview.LegalHold != nil)
+		_, err = db.DeleteUserData(student.ID, sql.DeletionModeAnonymize)
+		assert(t, "held user can't be anonymized", err != nil)
+		noError(t, "DeleteLegalHold", db.DeleteLegalHold(student.ID))
+		_, err = db.GetLegalHold(student.ID)
+		notFound(t, "GetLegalHold after deleting", err)
+
+		preview, err = db.PreviewUserDeletion(student.ID, sql.DeletionModeDelete)
+		noError(t, "PreviewUserDeletion", err)
+		equal(t, "blockers of a student", len(preview.Blockers), 0)
+		assert(t, "student's rows", preview.Grades == 1 && preview.Absences == 1 && preview.Sessions == 1)
+		equal(t, "classes of the student", preview.Classes, []int{class.ID})
+		equal(t, "parents of the student", preview.ParentLinks, []int{parent.ID})
+		preview, err = db.PreviewUserDeletion(teacher.ID, sql.DeletionModeDelete)
+		noError(t, "PreviewUserDeletion", err)
+		assert(t, "teacher can't be hard-deleted", len(preview.Blockers) == 2)
+		_, err = db.PreviewUserDeletion(teacher.ID, "unknown")
+		assert(t, "unknown mode is rejected", err != nil)
+
+		preview, err = db.DeleteUserData(student.ID, sql.DeletionModeAnonymize)
+		noError(t, "DeleteUserData", err)
+		anonymized, err := db.GetUser(student.ID)
+		noError(t, "GetUser of an anonymized user", err)
+		equal(t, "anonymized name", anonymized.Name, sql.AnonymizedUserName)
+		assert(t, "anonymized email", strings.HasPrefix(anonymized.Email, "anonymized-") && anonymized.Birthday.IsZero())
+		grades, err := db.GetGradesForUser(student.ID)
+		noError(t, "GetGradesForUser", err)
+		equal(t, "grades are kept", len(grades), 1)
+		parents, err := db.GetParents(student.ID)
+		noError(t, "GetParents", err)
+		equal(t, "parent links are removed", parents, []int{})
+		sessions, err := db.GetSessionsForUser(student.ID)
+		noError(t, "GetSessionsForUser", err)
+		equal(t, "sessions are removed", len(sessions), 0)
+		_, err = db.GetCalendarFeed(student.ID)
+		notFound(t, "GetCalendarFeed of an anonymized user", err)
+
+		_, err = db.DeleteUserData(teacher.ID, sql.DeletionModeDelete)
+		assert(t, "teacher isn't hard-deleted", err != nil)
+		_, err = db.GetUser(teacher.ID)
+		noError(t, "GetUser of a blocked user", err)
+		_, err = db.DeleteUserData(admin.ID, sql.DeletionModeAnonymize)
+		assert(t, "admin can't be anonymized", err != nil)
+
+		noError(t, "DeleteUser", db.DeleteUser(parent.ID))
+		_, err = db.GetUser(parent.ID)
+		notFound(t, "GetUser of a deleted user", err)
+		children, err := db.GetChildren(parent.ID)
+		noError(t, "GetChildren", err)
+		equal(t, "children of a deleted parent", children, []int{})
+		_, err = db.GetCalendarFeed(parent.ID)
+		notFound(t, "GetCalendarFeed of a deleted user", err)
+	},
+}
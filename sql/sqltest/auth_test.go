@@ -0,0 +1,453 @@
+package sqltest
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"testing"
+	"time"
+)
+
+// farFuture doesn't fit into a 32-bit integer, so it catches Unix timestamp columns that are too small.
+var farFuture = time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+var sessionsCheck = check{
+	name: "sessions",
+	methods: []string{"CheckJWT", "CheckJWTWithoutTwoFactor", "CheckTwoFactorJWT", "GetJWTForImpersonation", "GetJWTForTwoFactor",
+		"GetJWTForTestingResult", "NewSession", "RefreshSession",
+		"GetSession", "GetSessionByRefreshToken", "GetSessionsForUser", "InsertSession", "UpdateSession", "RevokeSession",
+		"RevokeAllUserSessions", "RevokeOtherUserSessions", "DeleteUserSessions"},
+	run: func(t *testing.T, db sql.SQL) {
+		user := newUser(t, db, "teacher")
+		accessToken, refreshToken, err := db.NewSession(user, false)
+		noError(t, "NewSession", err)
+		claims, err := db.CheckJWT(accessToken)
+		noError(t, "CheckJWT", err)
+		equal(t, "email claim", claims["email"], user.Email)
+		_, err = db.CheckJWTWithoutTwoFactor(accessToken)
+		noError(t, "CheckJWTWithoutTwoFactor", err)
+		session, err := db.GetSessionByRefreshToken(refreshToken)
+		noError(t, "GetSessionByRefreshToken", err)
+		got, err := db.GetSession(session.ID)
+		noError(t, "GetSession", err)
+		equal(t, "session", got, session)
+
+		accessToken, newRefreshToken, err := db.RefreshSession(refreshToken)
+		noError(t, "RefreshSession", err)
+		_, _, err = db.RefreshSession(refreshToken)
+		assert(t, "refresh token can't be used twice", err != nil)
+		_, err = db.CheckJWT(accessToken)
+		noError(t, "CheckJWT of a refreshed session", err)
+
+		other := sql.Session{UserID: user.ID, RefreshToken: sql.HashToken("other"), CreatedAt: time.Now().Unix(), ExpiresAt: farFuture}
+		other.ID, err = db.InsertSession(other)
+		noError(t, "InsertSession", err)
+		other.ExpiresAt = farFuture + 1
+		noError(t, "UpdateSession", db.UpdateSession(other))
+		got, err = db.GetSession(other.ID)
+		noError(t, "GetSession", err)
+		equal(t, "updated session", got, other)
+		sessions, err := db.GetSessionsForUser(user.ID)
+		noError(t, "GetSessionsForUser", err)
+		equal(t, "sessions of the user", len(sessions), 2)
+
+		noError(t, "RevokeOtherUserSessions", db.RevokeOtherUserSessions(user.ID, session.ID))
+		sessions, err = db.GetSessionsForUser(user.ID)
+		noError(t, "GetSessionsForUser", err)
+		equal(t, "sessions after revoking other sessions", len(sessions), 1)
+		noError(t, "RevokeSession", db.RevokeSession(session.ID))
+		_, err = db.CheckJWT(accessToken)
+		assert(t, "token of a revoked session is rejected", err != nil)
+		_, _, err = db.RefreshSession(newRefreshToken)
+		assert(t, "revoked session can't be refreshed", err != nil)
+
+		_, _, err = db.NewSession(user, false)
+		noError(t, "NewSession", err)
+		noError(t, "RevokeAllUserSessions", db.RevokeAllUserSessions(user.ID))
+		sessions, err = db.GetSessionsForUser(user.ID)
+		noError(t, "GetSessionsForUser", err)
+		equal(t, "sessions after revoking all", len(sessions), 0)
+		db.DeleteUserSessions(user.ID)
+		_, err = db.GetSession(session.ID)
+		notFound(t, "GetSession of a deleted session", err)
+
+		token, err := db.GetJWTForTwoFactor(user.ID)
+		noError(t, "GetJWTForTwoFactor", err)
+		userId, err := db.CheckTwoFactorJWT(token)
+		noError(t, "CheckTwoFactorJWT", err)
+		equal(t, "user of the two-factor token", userId, user.ID)
+
+		admin := newUser(t, db, sql.AdminRole)
+		_, adminRefreshToken, err := db.NewSession(admin, true)
+		noError(t, "NewSession", err)
+		adminSession, err := db.GetSessionByRefreshToken(adminRefreshToken)
+		noError(t, "GetSessionByRefreshToken", err)
+		token, _, err = db.GetJWTForImpersonation(user, admin.ID, adminSession.ID, true)
+		noError(t, "GetJWTForImpersonation", err)
+		claims, err = db.CheckJWT(token)
+		noError(t, "CheckJWT of an impersonation token", err)
+		equal(t, "impersonating admin", sql.ImpersonatedBy(claims), admin.ID)
+		token, err, _ = db.GetJWTForTestingResult(user.ID, "NEGATIVE", 1, day("2023-03-06"))
+		noError(t, "GetJWTForTestingResult", err)
+		assert(t, "self-testing token", token != "")
+	},
+}
+
+var signingKeysCheck = check{
+	name: "signing keys",
+	methods: []string{"GetSigningKeys", "InsertSigningKey", "UpdateSigningKey", "DeleteExpiredSigningKeys",
+		"LoadSigningKeys", "RotateSigningKey"},
+	run: func(t *testing.T, db sql.SQL) {
+		user := newUser(t, db, "teacher")
+		accessToken, _, err := db.NewSession(user, false)
+		noError(t, "NewSession", err)
+		key, err := db.RotateSigningKey()
+		noError(t, "RotateSigningKey", err)
+		_, err = db.CheckJWT(accessToken)
+		noError(t, "CheckJWT signed with the retired key", err)
+
+		keys, err := db.GetSigningKeys()
+		noError(t, "GetSigningKeys", err)
+		active := 0
+		for _, k := range keys {
+			if k.IsActive {
+				active++
+				equal(t, "active key", k, key)
+			} else {
+				assert(t, "retired key expires", k.ExpiresAt > time.Now().Unix())
+			}
+		}
+		equal(t, "active keys", active, 1)
+
+		expired := sql.SigningKey{KID: unique("kid"), Secret: "secret", CreatedAt: time.Now().Unix(), ExpiresAt: farFuture}
+		expired.ID, err = db.InsertSigningKey(expired)
+		noError(t, "InsertSigningKey", err)
+		expired.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+		noError(t, "UpdateSigningKey", db.UpdateSigningKey(expired))
+		noError(t, "DeleteExpiredSigningKeys", db.DeleteExpiredSigningKeys())
+		keys, err = db.GetSigningKeys()
+		noError(t, "GetSigningKeys", err)
+		for _, k := range keys {
+			assert(t, "expired key is deleted", k.ID != expired.ID)
+		}
+		noError(t, "LoadSigningKeys", db.LoadSigningKeys())
+		_, err = db.CheckJWT(accessToken)
+		noError(t, "CheckJWT after loading the keys", err)
+	},
+}
+
+var twoFactorCheck = check{
+	name: "two-factor authentication",
+	methods: []string{"GetRecoveryCodes", "InsertRecoveryCode", "UpdateRecoveryCode", "DeleteRecoveryCodes",
+		"GenerateRecoveryCodes", "CheckTwoFactorCode", "GetTwoFactorRoles", "SetTwoFactorRoles", "IsTwoFactorRequired"},
+	run: func(t *testing.T, db sql.SQL) {
+		user := newUser(t, db, "teacher")
+		secret, err := sql.GenerateTOTPSecret()
+		noError(t, "GenerateTOTPSecret", err)
+		user.TOTPSecret = secret
+		user.TOTPEnabled = true
+		noError(t, "UpdateUser", db.UpdateUser(user))
+
+		code, err := sql.GetTOTPCode(secret, time.Now().Unix()/sql.TOTPPeriod)
+		noError(t, "GetTOTPCode", err)
+		valid, err := db.CheckTwoFactorCode(user, code)
+		noError(t, "CheckTwoFactorCode", err)
+		assert(t, "TOTP code is accepted", valid)
+		// user was read before the code was used, like in a request running in parallel
+		valid, err = db.CheckTwoFactorCode(user, code)
+		noError(t, "CheckTwoFactorCode", err)
+		assert(t, "TOTP code can't be replayed", !valid)
+		user.Name = "Preimenovan"
+		noError(t, "UpdateUser", db.UpdateUser(user))
+		valid, err = db.CheckTwoFactorCode(user, code)
+		noError(t, "CheckTwoFactorCode", err)
+		assert(t, "TOTP code can't be replayed after updating a stale user", !valid)
+		user, err = db.GetUser(user.ID)
+		noError(t, "GetUser", err)
+
+		codes, err := db.GenerateRecoveryCodes(user.ID)
+		noError(t, "GenerateRecoveryCodes", err)
+		equal(t, "recovery codes", len(codes), sql.RecoveryCodeCount)
+		valid, err = db.CheckTwoFactorCode(user, codes[0])
+		noError(t, "CheckTwoFactorCode", err)
+		assert(t, "recovery code is accepted", valid)
+		valid, err = db.CheckTwoFactorCode(user, codes[0])
+		noError(t, "CheckTwoFactorCode", err)
+		assert(t, "recovery code can't be used twice", !valid)
+		stored, err := db.GetRecoveryCodes(user.ID)
+		noError(t, "GetRecoveryCodes", err)
+		assert(t, "used recovery code is marked", len(stored) == sql.RecoveryCodeCount && stored[0].IsUsed && !stored[1].IsUsed)
+
+		extra := sql.RecoveryCode{UserID: user.ID, Code: sql.HashToken("extra")}
+		extra.ID, err = db.InsertRecoveryCode(extra)
+		noError(t, "InsertRecoveryCode", err)
+		extra.IsUsed = true
+		noError(t, "UpdateRecoveryCode", db.UpdateRecoveryCode(extra))
+		stored, err = db.GetRecoveryCodes(user.ID)
+		noError(t, "GetRecoveryCodes", err)
+		equal(t, "inserted recovery code", stored[len(stored)-1], extra)
+		db.DeleteRecoveryCodes(user.ID)
+		stored, err = db.GetRecoveryCodes(user.ID)
+		noError(t, "GetRecoveryCodes", err)
+		equal(t, "recovery codes after deleting", len(stored), 0)
+
+		previous, err := db.GetTwoFactorRoles()
+		noError(t, "GetTwoFactorRoles", err)
+		noError(t, "SetTwoFactorRoles", db.SetTwoFactorRoles([]string{"teacher", sql.AdminRole}))
+		roles, err := db.GetTwoFactorRoles()
+		noError(t, "GetTwoFactorRoles", err)
+		equal(t, "two-factor roles", roles, []string{sql.AdminRole, "teacher"})
+		assert(t, "two-factor is required for teachers", db.IsTwoFactorRequired("teacher"))
+		assert(t, "two-factor isn't required for students", !db.IsTwoFactorRequired("student"))
+		noError(t, "SetTwoFactorRoles", db.SetTwoFactorRoles(previous))
+	},
+}
+
+var passwordResetsCheck = check{
+	name: "password resets",
+	methods: []string{"GetPasswordResetByToken", "InsertPasswordReset", "UpdatePasswordReset", "DeletePasswordResets",
+		"NewPasswordReset", "ResetPassword"},
+	run: func(t *testing.T, db sql.SQL) {
+		user := newUser(t, db, "parent")
+		_, _, err := db.NewSession(user, false)
+		noError(t, "NewSession", err)
+
+		token, err := db.NewPasswordReset(user.ID)
+		noError(t, "NewPasswordReset", err)
+		reset, err := db.GetPasswordResetByToken(token)
+		noError(t, "GetPasswordResetByToken", err)
+		equal(t, "reset user", reset.UserID, user.ID)
+		// Requesting another link doesn't invalidate the first one
+		later, err := db.NewPasswordReset(user.ID)
+		noError(t, "NewPasswordReset", err)
+		noError(t, "ResetPassword", db.ResetPassword(token, "novo geslo"))
+		assert(t, "token can't be used twice", db.ResetPassword(token, "drugo geslo") != nil)
+		assert(t, "other tokens are revoked by the reset", db.ResetPassword(later, "drugo geslo") != nil)
+		expired := sql.PasswordReset{UserID: user.ID, Token: sql.HashToken("expired"), ExpiresAt: time.Now().Add(-time.Minute).Unix()}
+		_, err = db.InsertPasswordReset(expired)
+		noError(t, "InsertPasswordReset", err)
+		assert(t, "expired token is rejected", db.ResetPassword("expired", "drugo geslo") != nil)
+		user, err = db.GetUser(user.ID)
+		noError(t, "GetUser", err)
+		assert(t, "password is changed", sql.CheckHash("novo geslo", user.Password))
+		sessions, err := db.GetSessionsForUser(user.ID)
+		noError(t, "GetSessionsForUser", err)
+		equal(t, "sessions after resetting the password", len(sessions), 0)
+
+		manual := sql.PasswordReset{UserID: user.ID, Token: sql.HashToken("manual"), ExpiresAt: farFuture}
+		manual.ID, err = db.InsertPasswordReset(manual)
+		noError(t, "InsertPasswordReset", err)
+		manual.IsUsed = true
+		noError(t, "UpdatePasswordReset", db.UpdatePasswordReset(manual))
+		reset, err = db.GetPasswordResetByToken("manual")
+		noError(t, "GetPasswordResetByToken", err)
+		equal(t, "updated reset", reset, manual)
+		db.DeletePasswordResets(user.ID)
+		_, err = db.GetPasswordResetByToken("manual")
+		notFound(t, "GetPasswordResetByToken after deleting", err)
+	},
+}
+
+var calendarFeedsCheck = check{
+	name: "calendar feeds",
+	methods: []string{"GetCalendarFeed", "GetCalendarFeedByToken", "InsertCalendarFeed", "UpdateCalendarFeed",
+		"DeleteCalendarFeed", "NewCalendarFeed", "GetMeetingsForUser"},
+	run: func(t *testing.T, db sql.SQL) {
+		user := newUser(t, db, "student")
+		first, err := db.NewCalendarFeed(user.ID)
+		noError(t, "NewCalendarFeed", err)
+		token, err := db.NewCalendarFeed(user.ID)
+		noError(t, "NewCalendarFeed", err)
+		_, err = db.GetCalendarFeedByToken(first)
+		notFound(t, "GetCalendarFeedByToken of a replaced feed", err)
+		feed, err := db.GetCalendarFeedByToken(token)
+		noError(t, "GetCalendarFeedByToken", err)
+		equal(t, "feed user", feed.UserID, user.ID)
+		equal(t, "feed role", feed.Role, user.Role)
+		equal(t, "stored token", feed.Token, sql.HashToken(token))
+		feed.LastUsedAt = farFuture
+		noError(t, "UpdateCalendarFeed", db.UpdateCalendarFeed(feed))
+		got, err := db.GetCalendarFeed(user.ID)
+		noError(t, "GetCalendarFeed", err)
+		equal(t, "updated feed", got, feed)
+		noError(t, "DeleteCalendarFeed", db.DeleteCalendarFeed(user.ID))
+		_, err = db.GetCalendarFeed(user.ID)
+		notFound(t, "GetCalendarFeed after deleting", err)
+
+		manual := sql.CalendarFeed{UserID: user.ID, Role: "teacher", Token: sql.HashToken("manual"), CreatedAt: farFuture}
+		manual.ID, err = db.InsertCalendarFeed(manual)
+		noError(t, "InsertCalendarFeed", err)
+		got, err = db.GetCalendarFeedByToken("manual")
+		noError(t, "GetCalendarFeedByToken", err)
+		equal(t, "inserted feed", got, manual)
+
+		// The teacher teaches both subjects, the student attends one through the class and one on their own,
+		// and the parent sees both through the student
+		teacher := newUser(t, db, "teacher")
+		parent := newUser(t, db, "parent")
+		class := newClass(t, db, teacher.ID)
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, user.ID))
+		noError(t, "AddChildToParent", db.AddChildToParent(parent.ID, user.ID))
+		classSubject := newSubject(t, db, teacher.ID, class.ID)
+		ownSubject := newSubject(t, db, teacher.ID, -1)
+		noError(t, "AddStudentToSubject", db.AddStudentToSubject(ownSubject.ID, user.ID))
+		otherSubject := newSubject(t, db, teacher.ID, -1)
+		later := newMeeting(t, db, classSubject, day("2031-05-06"), 2)
+		earlier := newMeeting(t, db, ownSubject, day("2031-05-06"), 1)
+		other := newMeeting(t, db, otherSubject, day("2031-05-05"), 1)
+		for _, u := range []sql.User{user, parent} {
+			meetings, err := db.GetMeetingsForUser(u.ID)
+			noError(t, "GetMeetingsForUser", err)
+			equal(t, "meetings of the "+u.Role, meetings, []sql.Meeting{earlier, later})
+		}
+		meetings, err := db.GetMeetingsForUser(teacher.ID)
+		noError(t, "GetMeetingsForUser", err)
+		equal(t, "meetings of the teacher", meetings, []sql.Meeting{other, earlier, later})
+	},
+}
+
+var loginAttemptsCheck = check{
+	name: "login attempts",
+	methods: []string{"InsertLoginAttempt", "GetFailedLoginAttempts", "GetLoginAttemptsForUser", "RecordLoginAttempt",
+		"GetLoginThrottle", "GetLockedLoginThrottles", "DeleteLoginThrottle", "CheckLoginThrottle", "ReserveLoginAttempt",
+		"ReleaseLoginAttempt"},
+	run: func(t *testing.T, db sql.SQL) {
+		user := newUser(t, db, "student")
+		attempt := sql.LoginAttempt{UserID: user.ID, Email: user.Email, IP: "192.0.2.1", IsSuccessful: true, CreatedAt: farFuture}
+		var err error
+		attempt.ID, err = db.InsertLoginAttempt(attempt)
+		noError(t, "InsertLoginAttempt", err)
+		db.RecordLoginAttempt(user.ID, user.Email, "192.0.2.1", false, "wrong password")
+		attempts, err := db.GetLoginAttemptsForUser(user.ID)
+		noError(t, "GetLoginAttemptsForUser", err)
+		equal(t, "attempts of the user", len(attempts), 2)
+		if len(attempts) == 2 {
+			equal(t, "oldest attempt", attempts[1], attempt)
+		}
+		failed, err := db.GetFailedLoginAttempts(1)
+		noError(t, "GetFailedLoginAttempts", err)
+		assert(t, "last failed attempt", len(failed) == 1 && failed[0].Reason == "wrong password")
+
+		key := sql.AccountThrottleKey(user.Email)
+		policy := sql.ThrottlePolicy{FreeAttempts: 1, MaxDelay: time.Hour, ResetAfter: time.Hour}
+		equal(t, "wait before failures", db.CheckLoginThrottle(key), time.Duration(0))
+		for i := 0; i < 2; i++ {
+			wait, err := db.ReserveLoginAttempt(key, policy)
+			noError(t, "ReserveLoginAttempt", err)
+			equal(t, "wait for a reserved attempt", wait, time.Duration(0))
+		}
+		throttle, err := db.GetLoginThrottle(key)
+		noError(t, "GetLoginThrottle", err)
+		equal(t, "failures", throttle.Failures, 2)
+		assert(t, "key is throttled", db.CheckLoginThrottle(sql.IPThrottleKey("192.0.2.1"), key) > 0)
+		wait, err := db.ReserveLoginAttempt(key, policy)
+		noError(t, "ReserveLoginAttempt", err)
+		assert(t, "wait for a locked key", wait > 0)
+		noError(t, "ReleaseLoginAttempt", db.ReleaseLoginAttempt(key))
+		throttle, err = db.GetLoginThrottle(key)
+		noError(t, "GetLoginThrottle", err)
+		equal(t, "failures after releasing", throttle.Failures, 1)
+		locked, err := db.GetLockedLoginThrottles()
+		noError(t, "GetLockedLoginThrottles", err)
+		equal(t, "locked keys", len(locked), 1)
+		noError(t, "DeleteLoginThrottle", db.DeleteLoginThrottle(key))
+		_, err = db.GetLoginThrottle(key)
+		notFound(t, "GetLoginThrottle after deleting", err)
+	},
+}
+
+var impersonationCheck = check{
+	name:    "impersonation log",
+	methods: []string{"InsertImpersonationLog", "GetImpersonationLogs", "RecordImpersonatedRequest"},
+	run: func(t *testing.T, db sql.SQL) {
+		admin := newUser(t, db, sql.AdminRole)
+		user := newUser(t, db, "student")
+		entry := sql.ImpersonationLog{AdminID: admin.ID, UserID: user.ID, Method: "GET", Endpoint: "GET /user/get/data/{id}", IP: "192.0.2.1", IsAllowed: true, CreatedAt: farFuture}
+		var err error
+		entry.ID, err = db.InsertImpersonationLog(entry)
+		noError(t, "InsertImpersonationLog", err)
+		db.RecordImpersonatedRequest(admin.ID, user.ID, "PATCH", "PATCH /user/get/data/{id}", "192.0.2.1", false)
+		entries, err := db.GetImpersonationLogs(admin.ID, -1, 10)
+		noError(t, "GetImpersonationLogs", err)
+		equal(t, "entries", len(entries), 2)
+		if len(entries) == 2 {
+			equal(t, "oldest entry", entries[1], entry)
+			assert(t, "rejected write", entries[0].Method == "PATCH" && !entries[0].IsAllowed)
+		}
+		entries, err = db.GetImpersonationLogs(-1, user.ID, 1)
+		noError(t, "GetImpersonationLogs", err)
+		equal(t, "limited entries", len(entries), 1)
+	},
+}
+
+var oidcStateCheck = check{
+	name:    "OpenID Connect states",
+	methods: []string{"InsertOIDCState", "NewOIDCState", "ConsumeOIDCState"},
+	run: func(t *testing.T, db sql.SQL) {
+		state, nonce, err := db.NewOIDCState()
+		noError(t, "NewOIDCState", err)
+		got, err := db.ConsumeOIDCState(state)
+		noError(t, "ConsumeOIDCState", err)
+		equal(t, "nonce", got, nonce)
+		_, err = db.ConsumeOIDCState(state)
+		assert(t, "state can't be used twice", err != nil)
+
+		expired := sql.OIDCState{State: sql.HashToken("expired"), Nonce: "nonce", ExpiresAt: time.Now().Add(-time.Minute).Unix()}
+		noError(t, "InsertOIDCState", db.InsertOIDCState(expired))
+		_, err = db.ConsumeOIDCState("expired")
+		assert(t, "expired state is rejected", err != nil)
+	},
+}
+
+var rolesCheck = check{
+	name: "roles",
+	methods: []string{"GetRoles", "GetRole", "InsertRole", "UpdateRole", "DeleteRole", "GetPermissionsForRole",
+		"SetRolePermissions", "HasPermission", "CanAssignRole", "SeedRoles"},
+	run: func(t *testing.T, db sql.SQL) {
+		noError(t, "SeedRoles", db.SeedRoles())
+		teacher, err := db.GetRole("teacher")
+		noError(t, "GetRole", err)
+		assert(t, "teacher role is built in", teacher.IsBuiltIn)
+		assert(t, "admin has every permission", db.HasPermission(sql.AdminRole, sql.PermissionUsersDelete))
+
+		role := sql.Role{Name: unique("kitchen"), Description: "Kuhinja"}
+		noError(t, "InsertRole", db.InsertRole(role))
+		role.Description = "Šolska kuhinja"
+		role.Rank = 1
+		noError(t, "UpdateRole", db.UpdateRole(role))
+		got, err := db.GetRole(role.Name)
+		noError(t, "GetRole", err)
+		equal(t, "role", got, role)
+		roles, err := db.GetRoles()
+		noError(t, "GetRoles", err)
+		found := false
+		for _, r := range roles {
+			found = found || r == role
+		}
+		assert(t, "role is listed", found)
+
+		noError(t, "SetRolePermissions", db.SetRolePermissions(role.Name, []string{sql.PermissionNotifications, sql.PermissionMealsManage}))
+		permissions, err := db.GetPermissionsForRole(role.Name)
+		noError(t, "GetPermissionsForRole", err)
+		equal(t, "permissions", permissions, []string{sql.PermissionMealsManage, sql.PermissionNotifications})
+		assert(t, "role has the permission", db.HasPermission(role.Name, sql.PermissionMealsManage))
+		canAssign, err := db.CanAssignRole(role.Name, "student")
+		noError(t, "CanAssignRole", err)
+		assert(t, "role can give roles ranked below it", canAssign)
+		canAssign, err = db.CanAssignRole(role.Name, "principal assistant")
+		noError(t, "CanAssignRole", err)
+		assert(t, "role can't give roles of the same rank", !canAssign)
+		canAssign, err = db.CanAssignRole("principal", sql.AdminRole)
+		noError(t, "CanAssignRole", err)
+		assert(t, "principal can't make admins", !canAssign)
+		assert(t, "role doesn't have other permissions", !db.HasPermission(role.Name, sql.PermissionGradesWrite))
+		assert(t, "unknown permissions are rejected", db.SetRolePermissions(role.Name, []string{"unknown"}) != nil)
+
+		user := newUser(t, db, role.Name)
+		assert(t, "assigned role can't be deleted", db.DeleteRole(role.Name) != nil)
+		user.Role = "student"
+		noError(t, "UpdateUser", db.UpdateUser(user))
+		noError(t, "DeleteRole", db.DeleteRole(role.Name))
+		_, err = db.GetRole(role.Name)
+		notFound(t, "GetRole of a deleted role", err)
+		assert(t, "built-in role can't be deleted", db.DeleteRole("teacher") != nil)
+	},
+}
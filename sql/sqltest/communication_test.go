@@ -0,0 +1,193 @@
+package sqltest
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"testing"
+)
+
+var communicationCheck = check{
+	name: "communication",
+	methods: []string{"GetCommunication", "InsertCommunication", "UpdateCommunication", "GetCommunications",
+		"DeleteCommunication", "DeleteUserCommunications", "GetCommunicationPeople", "GetCommunicationsForUser",
+		"IsInCommunication", "GetMessage", "GetCommunicationMessages", "GetAllUnreadMessages", "InsertMessage",
+		"UpdateMessage", "GetAllMessages", "DeleteMessage", "GetMessageSeen", "MarkMessageSeen"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		parent := newUser(t, db, "parent")
+		outsider := newUser(t, db, "parent")
+
+		communication := sql.Communication{Title: "Govorilne ure", DateCreated: now()}
+		var err error
+		communication.ID, err = db.InsertCommunication(communication, []int{teacher.ID, parent.ID, parent.ID})
+		noError(t, "InsertCommunication", err)
+		got, err := db.GetCommunication(communication.ID)
+		noError(t, "GetCommunication", err)
+		assert(t, "creation time", got.DateCreated.Equal(communication.DateCreated))
+		communication.Title = "Govorilne ure v torek"
+		noError(t, "UpdateCommunication", db.UpdateCommunication(communication))
+		got, err = db.GetCommunication(communication.ID)
+		noError(t, "GetCommunication", err)
+		equal(t, "title", got.Title, communication.Title)
+		all, err := db.GetCommunications()
+		noError(t, "GetCommunications", err)
+		equal(t, "last communication", all[len(all)-1].ID, communication.ID)
+
+		people, err := db.GetCommunicationPeople(communication.ID)
+		noError(t, "GetCommunicationPeople", err)
+		equal(t, "people", people, []int{teacher.ID, parent.ID})
+		in, err := db.IsInCommunication(communication.ID, parent.ID)
+		noError(t, "IsInCommunication", err)
+		assert(t, "parent takes part", in)
+		in, err = db.IsInCommunication(communication.ID, outsider.ID)
+		noError(t, "IsInCommunication", err)
+		assert(t, "outsider doesn't take part", !in)
+		communications, err := db.GetCommunicationsForUser(parent.ID)
+		noError(t, "GetCommunicationsForUser", err)
+		equal(t, "communications of the parent", len(communications), 1)
+
+		message := sql.Message{CommunicationID: communication.ID, UserID: teacher.ID, Body: "Pozdravljeni", DateCreated: now()}
+		message.ID, err = db.InsertMessage(message)
+		noError(t, "InsertMessage", err)
+		reply := sql.Message{CommunicationID: communication.ID, UserID: parent.ID, Body: "Hvala", DateCreated: now()}
+		reply.ID, err = db.InsertMessage(reply)
+		noError(t, "InsertMessage", err)
+		gotMessage, err := db.GetMessage(message.ID)
+		noError(t, "GetMessage", err)
+		assert(t, "message time", gotMessage.DateCreated.Equal(message.DateCreated))
+		equal(t, "message body", gotMessage.Body, message.Body)
+		message.Body = "Pozdravljeni vsi"
+		noError(t, "UpdateMessage", db.UpdateMessage(message))
+		messages, err := db.GetCommunicationMessages(communication.ID)
+		noError(t, "GetCommunicationMessages", err)
+		equal(t, "messages", len(messages), 2)
+		if len(messages) == 2 {
+			equal(t, "updated body", messages[0].Body, message.Body)
+		}
+		messages, err = db.GetAllMessages()
+		noError(t, "GetAllMessages", err)
+		equal(t, "last message", messages[len(messages)-1].ID, reply.ID)
+
+		noError(t, "MarkMessageSeen", db.MarkMessageSeen(message.ID, parent.ID))
+		noError(t, "MarkMessageSeen twice", db.MarkMessageSeen(message.ID, parent.ID))
+		noError(t, "MarkMessageSeen", db.MarkMessageSeen(reply.ID, parent.ID))
+		seen, err := db.GetMessageSeen(message.ID)
+		noError(t, "GetMessageSeen", err)
+		equal(t, "seen by", seen, []int{parent.ID})
+		unread, err := db.GetAllUnreadMessages(teacher.ID)
+		noError(t, "GetAllUnreadMessages", err)
+		equal(t, "unread messages of the teacher", len(unread), 2)
+		unread, err = db.GetAllUnreadMessages(parent.ID)
+		noError(t, "GetAllUnreadMessages", err)
+		equal(t, "unread messages of the parent", len(unread), 0)
+		unread, err = db.GetAllUnreadMessages(outsider.ID)
+		noError(t, "GetAllUnreadMessages", err)
+		equal(t, "unread messages of the outsider", len(unread), 0)
+
+		noError(t, "DeleteMessage", db.DeleteMessage(message.ID))
+		_, err = db.GetMessage(message.ID)
+		notFound(t, "GetMessage of a deleted message", err)
+		noError(t, "DeleteCommunication", db.DeleteCommunication(communication.ID))
+		_, err = db.GetCommunication(communication.ID)
+		notFound(t, "GetCommunication of a deleted communication", err)
+		_, err = db.GetMessage(reply.ID)
+		notFound(t, "GetMessage of a deleted communication", err)
+
+		communication.ID, err = db.InsertCommunication(communication, []int{teacher.ID, parent.ID})
+		noError(t, "InsertCommunication", err)
+		db.DeleteUserCommunications(parent.ID)
+		communications, err = db.GetCommunicationsForUser(teacher.ID)
+		noError(t, "GetCommunicationsForUser", err)
+		equal(t, "communications after deleting the parent's ones", len(communications), 0)
+	},
+}
+
+var notificationsCheck = check{
+	name: "notifications",
+	methods: []string{"GetNotification", "GetAllNotifications", "InsertNotification", "UpdateNotification",
+		"DeleteNotification"},
+	run: func(t *testing.T, db sql.SQL) {
+		notification := sql.NotificationSQL{Notification: "Jutri ni pouka"}
+		var err error
+		notification.ID, err = db.InsertNotification(notification)
+		noError(t, "InsertNotification", err)
+		got, err := db.GetNotification(notification.ID)
+		noError(t, "GetNotification", err)
+		equal(t, "notification", got, notification)
+		notification.Notification = "Pojutrišnjem ni pouka"
+		noError(t, "UpdateNotification", db.UpdateNotification(notification))
+		all, err := db.GetAllNotifications()
+		noError(t, "GetAllNotifications", err)
+		equal(t, "notifications", all, []sql.NotificationSQL{notification})
+		noError(t, "DeleteNotification", db.DeleteNotification(notification.ID))
+		_, err = db.GetNotification(notification.ID)
+		notFound(t, "GetNotification of a deleted notification", err)
+	},
+}
+
+var mealsCheck = check{
+	name: "meals",
+	methods: []string{"GetMeal", "InsertMeal", "UpdateMeal", "GetMeals", "DeleteMeal", "GetMealOrders", "GetMealsForUser",
+		"AddMealOrder", "RemoveMealOrder"},
+	run: func(t *testing.T, db sql.SQL) {
+		student := newUser(t, db, "student")
+		otherStudent := newUser(t, db, "student")
+
+		later := sql.Meal{Meals: "Juha, golaž", Date: day("2031-05-07"), MealTitle: "Kosilo", Price: 3.5, IsLactoseFree: true}
+		var err error
+		later.ID, err = db.InsertMeal(later)
+		noError(t, "InsertMeal", err)
+		earlier := sql.Meal{Meals: "Kruh, čaj", Date: day("2031-05-06"), MealTitle: "Malica", Price: 1.25, IsVegan: true, IsVegetarian: true}
+		earlier.ID, err = db.InsertMeal(earlier)
+		noError(t, "InsertMeal", err)
+		got, err := db.GetMeal(later.ID)
+		noError(t, "GetMeal", err)
+		equal(t, "meal", got, later)
+		earlier.IsLimited = true
+		earlier.OrderLimit = 1
+		noError(t, "UpdateMeal", db.UpdateMeal(earlier))
+		meals, err := db.GetMeals()
+		noError(t, "GetMeals", err)
+		equal(t, "meals ordered by date", meals[len(meals)-2:], []sql.Meal{earlier, later})
+
+		ordered, err := db.AddMealOrder(earlier.ID, student.ID)
+		noError(t, "AddMealOrder", err)
+		assert(t, "meal is ordered", ordered)
+		ordered, err = db.AddMealOrder(earlier.ID, student.ID)
+		noError(t, "AddMealOrder twice", err)
+		assert(t, "meal can't be ordered twice", !ordered)
+		ordered, err = db.AddMealOrder(earlier.ID, otherStudent.ID)
+		noError(t, "AddMealOrder over the limit", err)
+		assert(t, "meal is sold out", !ordered)
+		ordered, err = db.AddMealOrder(later.ID, student.ID)
+		noError(t, "AddMealOrder", err)
+		assert(t, "unlimited meal is ordered", ordered)
+		ordered, err = db.AddMealOrder(later.ID, otherStudent.ID)
+		noError(t, "AddMealOrder", err)
+		assert(t, "unlimited meal is ordered again", ordered)
+
+		orders, err := db.GetMealOrders(later.ID)
+		noError(t, "GetMealOrders", err)
+		equal(t, "orders", orders, []int{student.ID, otherStudent.ID})
+		meals, err = db.GetMealsForUser(student.ID)
+		noError(t, "GetMealsForUser", err)
+		equal(t, "meals of the student", meals, []sql.Meal{earlier, later})
+
+		noError(t, "RemoveMealOrder", db.RemoveMealOrder(later.ID, otherStudent.ID))
+		orders, err = db.GetMealOrders(later.ID)
+		noError(t, "GetMealOrders", err)
+		equal(t, "orders after removing", orders, []int{student.ID})
+
+		// The revert migrations check needs meals with orders, so only a new meal is deleted
+		deleted := sql.Meal{Meals: "Sadje", Date: day("2031-05-08"), MealTitle: "Malica"}
+		deleted.ID, err = db.InsertMeal(deleted)
+		noError(t, "InsertMeal", err)
+		_, err = db.AddMealOrder(deleted.ID, student.ID)
+		noError(t, "AddMealOrder", err)
+		noError(t, "DeleteMeal", db.DeleteMeal(deleted.ID))
+		_, err = db.GetMeal(deleted.ID)
+		notFound(t, "GetMeal of a deleted meal", err)
+		orders, err = db.GetMealOrders(deleted.ID)
+		noError(t, "GetMealOrders", err)
+		equal(t, "orders of a deleted meal", len(orders), 0)
+	},
+}
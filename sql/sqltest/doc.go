@@ -0,0 +1,9 @@
+// Package sqltest checks that sql.SQL behaves the same on every database driver MeetPlan supports. The same
+// checks run against a scratch SQLite file, an in-memory SQLite database of sql.NewInMemorySQLite and, when
+// $MEETPLAN_TEST_POSTGRES holds a DSN, against a scratch PostgreSQL schema:
+//
+//	MEETPLAN_TEST_POSTGRES="postgres://meetplan@localhost/meetplan?sslmode=disable" go test ./sql/sqltest
+//
+// Checks share the database and run in order, so each of them creates the rows it needs. Every method of
+// sql.SQL has to be covered by at least one check, otherwise the suite fails.
+package sqltest
@@ -0,0 +1,97 @@
+package sqltest
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"testing"
+	"time"
+)
+
+var sequence int
+
+// unique returns a value nobody else used during this run, for columns such as emails.
+func unique(prefix string) string {
+	sequence++
+	return fmt.Sprintf("%s-%d", prefix, sequence)
+}
+
+// day parses a date written in the checks themselves.
+func day(value string) sql.Date {
+	d, err := sql.ParseDate(value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// now is the current time in UTC. Sub-second precision differs between databases, so it is dropped.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+func newUser(t *testing.T, db sql.SQL, role string) sql.User {
+	name := unique(role)
+	user := sql.User{
+		Email:                  name + "@meetplan.invalid",
+		Password:               "",
+		Role:                   role,
+		Name:                   name,
+		BirthCertificateNumber: "",
+		Birthday:               day("2008-05-17"),
+		CityOfBirth:            "Ljubljana",
+		CountryOfBirth:         "Slovenija",
+		IsPassing:              true,
+	}
+	var err error
+	user.ID, err = db.InsertUser(user)
+	noError(t, "InsertUser", err)
+	return user
+}
+
+func newClass(t *testing.T, db sql.SQL, teacherId int) sql.Class {
+	class := sql.Class{
+		Name:           unique("class"),
+		Teacher:        teacherId,
+		ClassYear:      "2022/2023",
+		SOK:            0,
+		EOK:            0,
+		LastSchoolDate: day("2023-06-23"),
+	}
+	var err error
+	class.ID, err = db.InsertClass(class)
+	noError(t, "InsertClass", err)
+	return class
+}
+
+// newSubject creates a subject, which inherits its students from the class unless classId is -1.
+func newSubject(t *testing.T, db sql.SQL, teacherId int, classId int) sql.Subject {
+	subject := sql.Subject{
+		TeacherID:     teacherId,
+		Name:          unique("MAT"),
+		InheritsClass: classId != -1,
+		ClassID:       classId,
+		LongName:      "Matematika",
+		Realization:   0,
+	}
+	var err error
+	subject.ID, err = db.InsertSubject(subject)
+	noError(t, "InsertSubject", err)
+	return subject
+}
+
+func newMeeting(t *testing.T, db sql.SQL, subject sql.Subject, date sql.Date, hour int) sql.Meeting {
+	meeting := sql.Meeting{
+		MeetingName: unique("meeting"),
+		TeacherID:   subject.TeacherID,
+		SubjectID:   subject.ID,
+		Hour:        hour,
+		Date:        date,
+		IsMandatory: true,
+		URL:         "",
+		Details:     "",
+	}
+	var err error
+	meeting.ID, err = db.InsertMeeting(meeting)
+	noError(t, "InsertMeeting", err)
+	return meeting
+}
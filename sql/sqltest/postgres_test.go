@@ -0,0 +1,110 @@
+package sqltest
+
+import (
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postgresSchema is an empty schema the checks run in, so they don't need a database of their own and
+// don't touch tables already in the database.
+type postgresSchema struct {
+	Name string
+	// DSN of the same database with the schema as the search path
+	DSN string
+	db  *sqlx.DB
+}
+
+// newPostgresSchema creates a scratch schema in the database dsn points to.
+func newPostgresSchema(dsn string) (*postgresSchema, error) {
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("meetplan_check_%d", time.Now().UnixNano())
+	_, err = db.Exec("CREATE SCHEMA " + name)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	schema := &postgresSchema{Name: name, db: db}
+	// lib/pq passes unknown parameters to the server as run-time parameters
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			schema.Drop()
+			return nil, err
+		}
+		query := u.Query()
+		query.Set("search_path", name)
+		u.RawQuery = query.Encode()
+		schema.DSN = u.String()
+	} else {
+		schema.DSN = dsn + " search_path=" + name
+	}
+	return schema, nil
+}
+
+// Drop removes the schema with everything the checks created in it.
+func (schema *postgresSchema) Drop() error {
+	defer schema.db.Close()
+	_, err := schema.db.Exec("DROP SCHEMA " + schema.Name + " CASCADE")
+	return err
+}
+
+// TestPostgresMembershipMigration upgrades memberships stored as JSON arrays with values that aren't user IDs,
+// which used to abort the cast of the membership migration. It's skipped when $MEETPLAN_TEST_POSTGRES isn't set.
+func TestPostgresMembershipMigration(t *testing.T) {
+	dsn := os.Getenv("MEETPLAN_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("set $MEETPLAN_TEST_POSTGRES to a PostgreSQL DSN to check PostgreSQL")
+	}
+	schema, err := newPostgresSchema(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := schema.Drop()
+		if err != nil {
+			t.Errorf("dropping schema %s: %s", schema.Name, err.Error())
+		}
+	}()
+	db, err := sql.NewSQL("postgres", schema.DSN, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.MigrateUp()
+	noError(t, "MigrateUp", err)
+	db.Init()
+	teacher := newUser(t, db, "teacher")
+	student := newUser(t, db, "student")
+	parent := newUser(t, db, "parent")
+	class := newClass(t, db, teacher.ID)
+
+	// Back to the schema with JSON arrays, the version before the membership tables
+	_, err = db.MigrateDown(sql.LatestSchemaVersion() - 2)
+	noError(t, "MigrateDown", err)
+	raw, err := sqlx.Connect("postgres", schema.DSN)
+	noError(t, "Connect", err)
+	defer raw.Close()
+	members := fmt.Sprintf(`[%d, "abc", null, "", "12a", "99999999999"]`, student.ID)
+	_, err = raw.Exec("UPDATE classes SET students=$1 WHERE id=$2", members, class.ID)
+	noError(t, "setting students of the class", err)
+	_, err = raw.Exec("UPDATE users SET users=$1 WHERE id=$2", members, parent.ID)
+	noError(t, "setting children of the parent", err)
+
+	_, err = db.MigrateUp()
+	noError(t, "MigrateUp with values that aren't IDs", err)
+	students, err := db.GetClassStudents(class.ID)
+	noError(t, "GetClassStudents", err)
+	equal(t, "students of the class", students, []int{student.ID})
+	children, err := db.GetChildren(parent.ID)
+	noError(t, "GetChildren", err)
+	equal(t, "children of the parent", children, []int{student.ID})
+}
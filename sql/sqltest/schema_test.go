@@ -0,0 +1,137 @@
+package sqltest
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"os"
+	"testing"
+)
+
+var migrationsCheck = check{
+	name:    "migrations",
+	methods: []string{"SchemaVersion", "GetMigrationStatus", "CheckSchemaVersion", "MigrateUp", "Init"},
+	run: func(t *testing.T, db sql.SQL) {
+		assert(t, "pending migrations are reported", db.CheckSchemaVersion() != nil)
+		applied, err := db.MigrateUp()
+		noError(t, "MigrateUp", err)
+		equal(t, "applied migrations", len(applied), sql.LatestSchemaVersion())
+		version, err := db.SchemaVersion()
+		noError(t, "SchemaVersion", err)
+		equal(t, "schema version", version, sql.LatestSchemaVersion())
+		noError(t, "CheckSchemaVersion", db.CheckSchemaVersion())
+		status, err := db.GetMigrationStatus()
+		noError(t, "GetMigrationStatus", err)
+		for _, s := range status {
+			assert(t, "migration "+s.Name+" is applied", s.Applied && s.AppliedAt != 0)
+		}
+
+		applied, err = db.MigrateUp()
+		noError(t, "MigrateUp on an up-to-date database", err)
+		equal(t, "migrations applied twice", len(applied), 0)
+
+		// Init loads the signing keys and creates the built-in roles, which the rest of the checks need
+		db.Init()
+	},
+}
+
+var snapshotsCheck = check{
+	name:    "snapshots",
+	methods: []string{"WriteSnapshot", "RestoreSnapshot"},
+	run: func(t *testing.T, db sql.SQL) {
+		dir, err := os.MkdirTemp("", "meetplan-snapshot")
+		noError(t, "MkdirTemp", err)
+		defer os.RemoveAll(dir)
+		users, err := db.GetAllUsers()
+		noError(t, "GetAllUsers", err)
+		meals, err := db.GetMeals()
+		noError(t, "GetMeals", err)
+		snapshot, err := db.WriteSnapshot(dir)
+		noError(t, "WriteSnapshot", err)
+		equal(t, "snapshot schema version", snapshot.SchemaVersion, sql.LatestSchemaVersion())
+		assert(t, "snapshot has files", len(snapshot.Files) != 0)
+
+		added := newUser(t, db, "student")
+		_, err = db.InsertNotification(sql.NotificationSQL{Notification: "Po varnostni kopiji"})
+		noError(t, "InsertNotification", err)
+		other := snapshot
+		other.Driver = "other"
+		assert(t, "snapshot of another driver is rejected", db.RestoreSnapshot(dir, other) != nil)
+		newer := snapshot
+		newer.SchemaVersion = sql.LatestSchemaVersion() + 1
+		assert(t, "newer snapshot is rejected", db.RestoreSnapshot(dir, newer) != nil)
+
+		noError(t, "RestoreSnapshot", db.RestoreSnapshot(dir, snapshot))
+		usersAfter, err := db.GetAllUsers()
+		noError(t, "GetAllUsers", err)
+		equal(t, "users after restoring", usersAfter, users)
+		mealsAfter, err := db.GetMeals()
+		noError(t, "GetMeals", err)
+		equal(t, "meals after restoring", mealsAfter, meals)
+		notifications, err := db.GetAllNotifications()
+		noError(t, "GetAllNotifications", err)
+		equal(t, "notifications after restoring", len(notifications), 0)
+		noError(t, "CheckSchemaVersion", db.CheckSchemaVersion())
+
+		// Generated IDs have to continue after the restored rows, not after the ones that were thrown away
+		user := newUser(t, db, "student")
+		assert(t, "ID after restoring", user.ID > users[len(users)-1].ID && user.ID <= added.ID)
+	},
+}
+
+// revertMigrationsCheck reverts all migrations except the initial one, which would drop the tables, and applies
+// them again. That is what upgrading a database of an old MeetPlan version looks like, so rows have to survive.
+// At the end the initial migration is reverted as well, which has to leave the database empty.
+var revertMigrationsCheck = check{
+	name:    "revert migrations",
+	methods: []string{"MigrateDown"},
+	run: func(t *testing.T, db sql.SQL) {
+		users, err := db.GetAllUsers()
+		noError(t, "GetAllUsers", err)
+		classes, err := db.GetClasses()
+		noError(t, "GetClasses", err)
+		meetings, err := db.GetMeetings()
+		noError(t, "GetMeetings", err)
+		meals, err := db.GetMeals()
+		noError(t, "GetMeals", err)
+		orders := make(map[int][]int)
+		for _, meal := range meals {
+			orders[meal.ID], err = db.GetMealOrders(meal.ID)
+			noError(t, "GetMealOrders", err)
+		}
+
+		latest := sql.LatestSchemaVersion()
+		reverted, err := db.MigrateDown(latest - 1)
+		noError(t, "MigrateDown", err)
+		equal(t, "reverted migrations", len(reverted), latest-1)
+		version, err := db.SchemaVersion()
+		noError(t, "SchemaVersion", err)
+		equal(t, "schema version after reverting", version, 1)
+		_, err = db.MigrateUp()
+		noError(t, "MigrateUp after reverting", err)
+		noError(t, "CheckSchemaVersion after reverting", db.CheckSchemaVersion())
+
+		usersAfter, err := db.GetAllUsers()
+		noError(t, "GetAllUsers", err)
+		equal(t, "users after migrating again", usersAfter, users)
+		classesAfter, err := db.GetClasses()
+		noError(t, "GetClasses", err)
+		equal(t, "classes after migrating again", classesAfter, classes)
+		meetingsAfter, err := db.GetMeetings()
+		noError(t, "GetMeetings", err)
+		equal(t, "meetings after migrating again", meetingsAfter, meetings)
+		mealsAfter, err := db.GetMeals()
+		noError(t, "GetMeals", err)
+		equal(t, "meals after migrating again", mealsAfter, meals)
+		for _, meal := range meals {
+			ordersAfter, err := db.GetMealOrders(meal.ID)
+			noError(t, "GetMealOrders", err)
+			equal(t, "orders after migrating again", ordersAfter, orders[meal.ID])
+		}
+
+		reverted, err = db.MigrateDown(latest)
+		noError(t, "MigrateDown everything", err)
+		equal(t, "migrations reverted at once", len(reverted), latest)
+		version, err = db.SchemaVersion()
+		noError(t, "SchemaVersion", err)
+		equal(t, "schema version after reverting everything", version, 0)
+	},
+}
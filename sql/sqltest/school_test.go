@@ -0,0 +1,681 @@
+package sqltest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"testing"
+	"time"
+)
+
+var classesCheck = check{
+	name: "classes",
+	methods: []string{"GetClass", "InsertClass", "UpdateClass", "GetClasses", "DeleteClass", "DeleteTeacherClasses",
+		"DeleteUserClasses", "GetClassStudents", "GetClassesForStudent", "IsStudentInClass", "AddStudentToClass",
+		"RemoveStudentFromClass"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		student := newUser(t, db, "student")
+		otherStudent := newUser(t, db, "student")
+		class := newClass(t, db, teacher.ID)
+		got, err := db.GetClass(class.ID)
+		noError(t, "GetClass", err)
+		equal(t, "class", got, class)
+
+		class.Name = unique("class")
+		class.ClassYear = "2023/2024"
+		class.SOK = 2
+		class.EOK = 3
+		class.LastSchoolDate = sql.Date{}
+		noError(t, "UpdateClass", db.UpdateClass(class))
+		classes, err := db.GetClasses()
+		noError(t, "GetClasses", err)
+		equal(t, "last class", classes[len(classes)-1], class)
+
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, otherStudent.ID))
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, student.ID))
+		noError(t, "AddStudentToClass twice", db.AddStudentToClass(class.ID, student.ID))
+		students, err := db.GetClassStudents(class.ID)
+		noError(t, "GetClassStudents", err)
+		equal(t, "class students", students, []int{student.ID, otherStudent.ID})
+		inClass, err := db.IsStudentInClass(class.ID, student.ID)
+		noError(t, "IsStudentInClass", err)
+		assert(t, "student is in the class", inClass)
+		classes, err = db.GetClassesForStudent(student.ID)
+		noError(t, "GetClassesForStudent", err)
+		equal(t, "classes of the student", classes, []sql.Class{class})
+
+		noError(t, "RemoveStudentFromClass", db.RemoveStudentFromClass(class.ID, student.ID))
+		inClass, err = db.IsStudentInClass(class.ID, student.ID)
+		noError(t, "IsStudentInClass", err)
+		assert(t, "student isn't in the class anymore", !inClass)
+		db.DeleteUserClasses(otherStudent.ID)
+		students, err = db.GetClassStudents(class.ID)
+		noError(t, "GetClassStudents", err)
+		equal(t, "class students after removing", students, []int{})
+
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, student.ID))
+		noError(t, "DeleteClass", db.DeleteClass(class.ID))
+		_, err = db.GetClass(class.ID)
+		notFound(t, "GetClass of a deleted class", err)
+		classes, err = db.GetClassesForStudent(student.ID)
+		noError(t, "GetClassesForStudent", err)
+		equal(t, "classes of the student after deleting", classes, []sql.Class{})
+
+		// Deleting the teacher's classes also deletes subjects inheriting them, together with their meetings
+		class = newClass(t, db, teacher.ID)
+		subject := newSubject(t, db, teacher.ID, class.ID)
+		newMeeting(t, db, subject, day("2031-03-03"), 1)
+		noError(t, "DeleteTeacherClasses", db.DeleteTeacherClasses(teacher.ID))
+		_, err = db.GetClass(class.ID)
+		notFound(t, "GetClass of a deleted class", err)
+		_, err = db.GetSubject(subject.ID)
+		notFound(t, "GetSubject of a subject of a deleted class", err)
+		meetings, err := db.GetMeetingsForSubject(subject.ID)
+		noError(t, "GetMeetingsForSubject", err)
+		equal(t, "meetings of a deleted subject", len(meetings), 0)
+	},
+}
+
+var subjectsCheck = check{
+	name: "subjects",
+	methods: []string{"GetSubject", "GetAllSubjectsForTeacher", "GetAllSubjectsForUser", "GetSubjectsWithSpecificLongName",
+		"InsertSubject", "UpdateSubject", "GetAllSubjects", "DeleteSubject", "DeleteStudentSubject", "GetSubjectStudents",
+		"AddStudentToSubject", "RemoveStudentFromSubject"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		student := newUser(t, db, "student")
+		otherStudent := newUser(t, db, "student")
+		class := newClass(t, db, teacher.ID)
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, student.ID))
+
+		inherited := newSubject(t, db, teacher.ID, class.ID)
+		own := newSubject(t, db, teacher.ID, -1)
+		got, err := db.GetSubject(own.ID)
+		noError(t, "GetSubject", err)
+		equal(t, "subject", got, own)
+		own.LongName = unique("Fizika")
+		own.Realization = 12.5
+		noError(t, "UpdateSubject", db.UpdateSubject(own))
+		subjects, err := db.GetSubjectsWithSpecificLongName(own.LongName)
+		noError(t, "GetSubjectsWithSpecificLongName", err)
+		equal(t, "subjects by long name", subjects, []sql.Subject{own})
+		subjects, err = db.GetAllSubjectsForTeacher(teacher.ID)
+		noError(t, "GetAllSubjectsForTeacher", err)
+		equal(t, "subjects of the teacher", subjects, []sql.Subject{inherited, own})
+		subjects, err = db.GetAllSubjects()
+		noError(t, "GetAllSubjects", err)
+		equal(t, "last subjects", subjects[len(subjects)-2:], []sql.Subject{inherited, own})
+
+		noError(t, "AddStudentToSubject", db.AddStudentToSubject(own.ID, otherStudent.ID))
+		noError(t, "AddStudentToSubject", db.AddStudentToSubject(own.ID, student.ID))
+		noError(t, "AddStudentToSubject twice", db.AddStudentToSubject(own.ID, student.ID))
+		students, err := db.GetSubjectStudents(own)
+		noError(t, "GetSubjectStudents", err)
+		equal(t, "subject students", students, []int{student.ID, otherStudent.ID})
+		students, err = db.GetSubjectStudents(inherited)
+		noError(t, "GetSubjectStudents", err)
+		equal(t, "students of the inherited class", students, []int{student.ID})
+		subjects, err = db.GetAllSubjectsForUser(student.ID)
+		noError(t, "GetAllSubjectsForUser", err)
+		equal(t, "subjects of the student", subjects, []sql.Subject{inherited, own})
+		subjects, err = db.GetAllSubjectsForUser(otherStudent.ID)
+		noError(t, "GetAllSubjectsForUser", err)
+		equal(t, "subjects of the other student", subjects, []sql.Subject{own})
+
+		noError(t, "RemoveStudentFromSubject", db.RemoveStudentFromSubject(own.ID, student.ID))
+		db.DeleteStudentSubject(otherStudent.ID)
+		students, err = db.GetSubjectStudents(own)
+		noError(t, "GetSubjectStudents", err)
+		equal(t, "subject students after removing", students, []int{})
+
+		noError(t, "AddStudentToSubject", db.AddStudentToSubject(own.ID, student.ID))
+		noError(t, "DeleteSubject", db.DeleteSubject(own))
+		_, err = db.GetSubject(own.ID)
+		notFound(t, "GetSubject of a deleted subject", err)
+		subjects, err = db.GetAllSubjectsForUser(student.ID)
+		noError(t, "GetAllSubjectsForUser", err)
+		equal(t, "subjects of the student after deleting", subjects, []sql.Subject{inherited})
+	},
+}
+
+var meetingsCheck = check{
+	name: "meetings",
+	methods: []string{"GetMeeting", "GetMeetingsOnSpecificTime", "GetMeetingsForSubject", "GetMeetingsForTeacherOnSpecificDate",
+		"InsertMeeting", "UpdateMeeting", "GetMeetings", "GetMeetingsForSubjectWithIDLower", "DeleteMeeting",
+		"GetMeetingsOnSpecificDate", "GetMeetingsBetween", "DeleteMeetingsForTeacher", "DeleteMeetingsForSubject",
+		"WithMeetingsLocked"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		otherTeacher := newUser(t, db, "teacher")
+		subject := newSubject(t, db, teacher.ID, -1)
+		otherSubject := newSubject(t, db, otherTeacher.ID, -1)
+
+		// Dates are compared as dates, not as strings, so the end of the year sorts before the next one
+		last := newMeeting(t, db, subject, day("2032-01-05"), 1)
+		second := newMeeting(t, db, subject, day("2031-12-31"), 3)
+		first := newMeeting(t, db, otherSubject, day("2031-12-31"), 2)
+		got, err := db.GetMeeting(first.ID)
+		noError(t, "GetMeeting", err)
+		equal(t, "meeting", got, first)
+
+		first.IsGrading = true
+		first.IsWrittenAssessment = true
+		first.IsTest = true
+		first.IsSubstitution = true
+		first.URL = "https://meet.invalid/abc"
+		first.Details = "Prinesite kalkulator"
+		noError(t, "UpdateMeeting", db.UpdateMeeting(first))
+		meetings, err := db.GetMeetingsBetween(day("2031-12-31"), day("2032-01-05"))
+		noError(t, "GetMeetingsBetween", err)
+		equal(t, "meetings between", meetings, []sql.Meeting{first, second, last})
+		meetings, err = db.GetMeetingsBetween(day("2032-01-01"), day("2032-01-04"))
+		noError(t, "GetMeetingsBetween", err)
+		equal(t, "meetings between days without meetings", len(meetings), 0)
+		meetings, err = db.GetMeetingsOnSpecificDate(day("2031-12-31"))
+		noError(t, "GetMeetingsOnSpecificDate", err)
+		equal(t, "meetings on a date", meetings, []sql.Meeting{second, first})
+		meetings, err = db.GetMeetingsOnSpecificTime(day("2031-12-31"), 2)
+		noError(t, "GetMeetingsOnSpecificTime", err)
+		equal(t, "meetings on a date and hour", meetings, []sql.Meeting{first})
+		meetings, err = db.GetMeetingsForTeacherOnSpecificDate(teacher.ID, day("2031-12-31"))
+		noError(t, "GetMeetingsForTeacherOnSpecificDate", err)
+		equal(t, "meetings of the teacher on a date", meetings, []sql.Meeting{second})
+		meetings, err = db.GetMeetingsForSubject(subject.ID)
+		noError(t, "GetMeetingsForSubject", err)
+		equal(t, "meetings of the subject", meetings, []sql.Meeting{last, second})
+		meetings, err = db.GetMeetingsForSubjectWithIDLower(last.ID, subject.ID)
+		noError(t, "GetMeetingsForSubjectWithIDLower", err)
+		equal(t, "meetings of the subject up to the first one", meetings, []sql.Meeting{last})
+		meetings, err = db.GetMeetings()
+		noError(t, "GetMeetings", err)
+		equal(t, "last meetings", meetings[len(meetings)-3:], []sql.Meeting{last, second, first})
+
+		noError(t, "DeleteMeeting", db.DeleteMeeting(second.ID))
+		_, err = db.GetMeeting(second.ID)
+		notFound(t, "GetMeeting of a deleted meeting", err)
+		noError(t, "DeleteMeetingsForSubject", db.DeleteMeetingsForSubject(subject.ID))
+		_, err = db.GetMeeting(last.ID)
+		notFound(t, "GetMeeting of a meeting of a deleted subject", err)
+		noError(t, "DeleteMeetingsForTeacher", db.DeleteMeetingsForTeacher(otherTeacher.ID))
+		_, err = db.GetMeeting(first.ID)
+		notFound(t, "GetMeeting of a meeting of a deleted teacher", err)
+
+		// Meetings written in a failed transaction are rolled back
+		var locked sql.Meeting
+		noError(t, "WithMeetingsLocked", db.WithMeetingsLocked(func(tx sql.SQL) error {
+			locked = newMeeting(t, tx, subject, day("2032-01-06"), 1)
+			return nil
+		}))
+		_, err = db.GetMeeting(locked.ID)
+		noError(t, "GetMeeting of a meeting inserted in a transaction", err)
+		var rolledBack sql.Meeting
+		err = db.WithMeetingsLocked(func(tx sql.SQL) error {
+			rolledBack = newMeeting(t, tx, subject, day("2032-01-06"), 2)
+			return errors.New("conflict")
+		})
+		equal(t, "error of the transaction", fmt.Sprint(err), "conflict")
+		_, err = db.GetMeeting(rolledBack.ID)
+		notFound(t, "GetMeeting of a meeting inserted in a rolled back transaction", err)
+	},
+}
+
+var timetableTemplatesCheck = check{
+	name: "timetable templates",
+	methods: []string{"GetTimetableTemplate", "GetTimetableTemplates", "GetTimetableTemplatesForTeacher",
+		"GetMeetingsForTemplate", "ApplyTimetableTemplate", "DeleteTimetableTemplate"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		student := newUser(t, db, "student")
+		subject := newSubject(t, db, teacher.ID, -1)
+		// Tuesdays of September 2031 are the 2nd, 9th, 16th, 23rd and 30th
+		template := sql.TimetableTemplate{
+			SubjectID:     subject.ID,
+			TeacherID:     teacher.ID,
+			MeetingName:   "Matematika",
+			IsMandatory:   true,
+			Weekday:       2,
+			Hour:          3,
+			IntervalWeeks: 1,
+			FromDate:      day("2031-09-01"),
+			ToDate:        day("2031-09-30"),
+		}
+		free := []sql.Date{day("2031-09-16")}
+		sync, err := db.ApplyTimetableTemplate(template, template.FromDate, free)
+		noError(t, "ApplyTimetableTemplate", err)
+		template = sync.Template
+		assert(t, "template is inserted", template.ID != 0)
+		equal(t, "created meetings", len(sync.Created), 4)
+		meetings, err := db.GetMeetingsForTemplate(template.ID)
+		noError(t, "GetMeetingsForTemplate", err)
+		dates := make([]string, 0)
+		for _, m := range meetings {
+			dates = append(dates, m.Date.String())
+			assert(t, "meeting follows the template", m.TemplateID == template.ID && m.Hour == 3 && m.TeacherID == teacher.ID)
+		}
+		equal(t, "meetings skip the free day", dates, []string{"2031-09-02", "2031-09-09", "2031-09-23", "2031-09-30"})
+		if len(meetings) != 4 {
+			return
+		}
+		past, withAbsence, grading, plain := meetings[0], meetings[1], meetings[2], meetings[3]
+		grading.IsGrading = true
+		noError(t, "UpdateMeeting", db.UpdateMeeting(grading))
+		_, err = db.InsertAbsence(sql.Absence{UserID: student.ID, TeacherID: teacher.ID, MeetingID: withAbsence.ID, AbsenceType: "ABSENT"})
+		noError(t, "InsertAbsence", err)
+
+		// Moving the lesson to Wednesdays from the 8th on keeps the meeting before, keeps meetings with data of
+		// their own apart from the template and removes the other one
+		template.Weekday = 3
+		template.Hour = 4
+		template.MeetingName = "Matematika (utrjevanje)"
+		sync, err = db.ApplyTimetableTemplate(template, day("2031-09-08"), free)
+		noError(t, "ApplyTimetableTemplate", err)
+		equal(t, "created meetings after moving", len(sync.Created), 3)
+		equal(t, "updated meetings after moving", sync.Updated, []int{})
+		equal(t, "removed meetings after moving", sync.Removed, []int{plain.ID})
+		equal(t, "detached meetings after moving", sync.Detached, []int{withAbsence.ID, grading.ID})
+		got, err := db.GetMeeting(past.ID)
+		noError(t, "GetMeeting", err)
+		equal(t, "past meeting", got, past)
+		got, err = db.GetMeeting(grading.ID)
+		noError(t, "GetMeeting", err)
+		assert(t, "grading is detached", got.TemplateID == 0 && got.IsGrading && got.Hour == 3)
+		// SQLite reuses IDs of deleted rows, so the removed meeting is checked through dates of the template
+		meetings, err = db.GetMeetingsForTemplate(template.ID)
+		noError(t, "GetMeetingsForTemplate", err)
+		dates = make([]string, 0)
+		for _, m := range meetings {
+			dates = append(dates, m.Date.String())
+		}
+		equal(t, "meetings after moving", dates, []string{"2031-09-02", "2031-09-10", "2031-09-17", "2031-09-24"})
+
+		template.URL = "https://meet.invalid/mat"
+		sync, err = db.ApplyTimetableTemplate(template, day("2031-09-08"), free)
+		noError(t, "ApplyTimetableTemplate", err)
+		equal(t, "updated meetings", len(sync.Updated), 3)
+		equal(t, "created meetings when nothing moved", sync.Created, []int{})
+		meetings, err = db.GetMeetingsForTemplate(template.ID)
+		noError(t, "GetMeetingsForTemplate", err)
+		equal(t, "meetings of the template", len(meetings), 4)
+		for _, m := range meetings[1:] {
+			assert(t, "meeting is updated", m.URL == template.URL && m.MeetingName == template.MeetingName && m.Hour == 4)
+		}
+
+		saved, err := db.GetTimetableTemplate(template.ID)
+		noError(t, "GetTimetableTemplate", err)
+		equal(t, "template", saved, template)
+		templates, err := db.GetTimetableTemplatesForTeacher(teacher.ID)
+		noError(t, "GetTimetableTemplatesForTeacher", err)
+		equal(t, "templates of the teacher", templates, []sql.TimetableTemplate{template})
+		templates, err = db.GetTimetableTemplates()
+		noError(t, "GetTimetableTemplates", err)
+		assert(t, "all templates", len(templates) >= 1)
+
+		invalid := template
+		invalid.Hour = sql.TimetableHours
+		_, err = db.ApplyTimetableTemplate(invalid, day("2031-09-08"), free)
+		assert(t, "invalid hour is rejected", err != nil)
+		missing := template
+		missing.ID = template.ID + 1000
+		_, err = db.ApplyTimetableTemplate(missing, day("2031-09-08"), free)
+		notFound(t, "ApplyTimetableTemplate of a missing template", err)
+
+		sync, err = db.DeleteTimetableTemplate(template.ID, day("2031-09-18"))
+		noError(t, "DeleteTimetableTemplate", err)
+		equal(t, "removed meetings after deleting", len(sync.Removed), 1)
+		_, err = db.GetTimetableTemplate(template.ID)
+		notFound(t, "GetTimetableTemplate of a deleted template", err)
+		meetings, err = db.GetMeetingsForTemplate(template.ID)
+		noError(t, "GetMeetingsForTemplate", err)
+		equal(t, "meetings of a deleted template", len(meetings), 0)
+		got, err = db.GetMeeting(past.ID)
+		noError(t, "GetMeeting", err)
+		assert(t, "past meeting is kept on its own", got.TemplateID == 0)
+	},
+}
+
+var timetableDraftsCheck = check{
+	name: "timetable drafts",
+	methods: []string{"GetUnavailableHours", "GetUnavailableHoursForTeacher", "SetUnavailableHours", "GetTimetableDraft",
+		"GetTimetableDrafts", "GetTimetableDraftLessons", "InsertTimetableDraft", "DeleteTimetableDraft", "PublishTimetableDraft"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		subject := newSubject(t, db, teacher.ID, -1)
+
+		hours := []sql.UnavailableHour{{Weekday: 1, Hour: 0}, {Weekday: 5, Hour: 7}, {Weekday: 1, Hour: 0}}
+		noError(t, "SetUnavailableHours", db.SetUnavailableHours(teacher.ID, hours))
+		saved, err := db.GetUnavailableHoursForTeacher(teacher.ID)
+		noError(t, "GetUnavailableHoursForTeacher", err)
+		equal(t, "unavailable hours skip duplicates", len(saved), 2)
+		for _, hour := range saved {
+			assert(t, "unavailable hour belongs to the teacher", hour.TeacherID == teacher.ID)
+		}
+		err = db.SetUnavailableHours(teacher.ID, []sql.UnavailableHour{{Weekday: 7, Hour: 0}})
+		assert(t, "invalid weekday is rejected", err != nil)
+		saved, err = db.GetUnavailableHoursForTeacher(teacher.ID)
+		noError(t, "GetUnavailableHoursForTeacher", err)
+		equal(t, "rejected hours don't replace saved ones", len(saved), 2)
+		noError(t, "SetUnavailableHours", db.SetUnavailableHours(teacher.ID, hours[1:2]))
+		all, err := db.GetUnavailableHours()
+		noError(t, "GetUnavailableHours", err)
+		assert(t, "all unavailable hours", len(all) >= 1)
+
+		// Mondays of September 2031 are the 1st, 8th, 15th, 22nd and 29th
+		draft := sql.TimetableDraft{
+			Seed:           42,
+			FromDate:       day("2031-09-01"),
+			ToDate:         day("2031-09-30"),
+			FirstHour:      1,
+			LastHour:       7,
+			MaxHoursPerDay: 6,
+			NoGaps:         true,
+			CreatedBy:      teacher.ID,
+			CreatedAt:      1000,
+		}
+		lessons := []sql.TimetableDraftLesson{
+			{SubjectID: subject.ID, TeacherID: teacher.ID, MeetingName: "Matematika", Weekday: 1, Hour: 2},
+			{SubjectID: subject.ID, TeacherID: teacher.ID, MeetingName: "Matematika", Weekday: 1, Hour: 3},
+		}
+		draft.ID, err = db.InsertTimetableDraft(draft, lessons)
+		noError(t, "InsertTimetableDraft", err)
+		got, err := db.GetTimetableDraft(draft.ID)
+		noError(t, "GetTimetableDraft", err)
+		equal(t, "draft", got, draft)
+		drafts, err := db.GetTimetableDrafts()
+		noError(t, "GetTimetableDrafts", err)
+		assert(t, "all drafts", len(drafts) >= 1)
+		savedLessons, err := db.GetTimetableDraftLessons(draft.ID)
+		noError(t, "GetTimetableDraftLessons", err)
+		equal(t, "lessons of the draft", len(savedLessons), 2)
+		for _, lesson := range savedLessons {
+			assert(t, "lesson belongs to the draft", lesson.DraftID == draft.ID && lesson.ID != 0)
+		}
+		invalid := draft
+		invalid.LastHour = sql.TimetableHours
+		_, err = db.InsertTimetableDraft(invalid, lessons)
+		assert(t, "invalid hours are rejected", err != nil)
+
+		syncs, err := db.PublishTimetableDraft(draft.ID, []sql.Date{day("2031-09-15")})
+		noError(t, "PublishTimetableDraft", err)
+		equal(t, "published templates", len(syncs), 2)
+		for _, sync := range syncs {
+			equal(t, "meetings of a published template", len(sync.Created), 4)
+			assert(t, "published template", sync.Template.ID != 0 && sync.Template.Weekday == 1 && sync.Template.IntervalWeeks == 1)
+		}
+		_, err = db.GetTimetableDraft(draft.ID)
+		notFound(t, "GetTimetableDraft of a published draft", err)
+		savedLessons, err = db.GetTimetableDraftLessons(draft.ID)
+		noError(t, "GetTimetableDraftLessons", err)
+		equal(t, "lessons of a published draft", len(savedLessons), 0)
+		_, err = db.PublishTimetableDraft(draft.ID, nil)
+		notFound(t, "PublishTimetableDraft of a published draft", err)
+		if len(syncs) != 0 {
+			_, err = db.DeleteTimetableTemplate(syncs[0].Template.ID, day("2031-09-01"))
+			noError(t, "DeleteTimetableTemplate", err)
+		}
+		if len(syncs) > 1 {
+			_, err = db.DeleteTimetableTemplate(syncs[1].Template.ID, day("2031-09-01"))
+			noError(t, "DeleteTimetableTemplate", err)
+		}
+
+		draft.ID, err = db.InsertTimetableDraft(draft, lessons)
+		noError(t, "InsertTimetableDraft", err)
+		noError(t, "DeleteTimetableDraft", db.DeleteTimetableDraft(draft.ID))
+		_, err = db.GetTimetableDraft(draft.ID)
+		notFound(t, "GetTimetableDraft of a deleted draft", err)
+		savedLessons, err = db.GetTimetableDraftLessons(draft.ID)
+		noError(t, "GetTimetableDraftLessons", err)
+		equal(t, "lessons of a deleted draft", len(savedLessons), 0)
+	},
+}
+
+var absencesCheck = check{
+	name: "absences",
+	methods: []string{"GetAbsence", "GetAllAbsences", "InsertAbsence", "UpdateAbsence", "GetAbsenceForUserMeeting",
+		"GetAbsencesForUser", "DeleteAbsencesForTeacher", "DeleteAbsencesForUser"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		student := newUser(t, db, "student")
+		subject := newSubject(t, db, teacher.ID, -1)
+		meeting := newMeeting(t, db, subject, day("2031-09-01"), 1)
+		otherMeeting := newMeeting(t, db, subject, day("2031-09-01"), 2)
+
+		absence := sql.Absence{UserID: student.ID, TeacherID: teacher.ID, MeetingID: meeting.ID, AbsenceType: "ABSENT"}
+		var err error
+		absence.ID, err = db.InsertAbsence(absence)
+		noError(t, "InsertAbsence", err)
+		late := sql.Absence{UserID: student.ID, TeacherID: teacher.ID, MeetingID: otherMeeting.ID, AbsenceType: "LATE"}
+		late.ID, err = db.InsertAbsence(late)
+		noError(t, "InsertAbsence", err)
+		got, err := db.GetAbsence(absence.ID)
+		noError(t, "GetAbsence", err)
+		equal(t, "absence", got, absence)
+
+		absence.IsExcused = true
+		noError(t, "UpdateAbsence", db.UpdateAbsence(absence))
+		got, err = db.GetAbsenceForUserMeeting(meeting.ID, student.ID)
+		noError(t, "GetAbsenceForUserMeeting", err)
+		equal(t, "absence for the meeting", got, absence)
+		absences, err := db.GetAbsencesForUser(student.ID)
+		noError(t, "GetAbsencesForUser", err)
+		equal(t, "absences of the student", absences, []sql.Absence{absence, late})
+		absences, err = db.GetAllAbsences(student.ID)
+		noError(t, "GetAllAbsences", err)
+		equal(t, "all absences of the student", absences, []sql.Absence{absence, late})
+
+		db.DeleteAbsencesForTeacher(teacher.ID)
+		_, err = db.GetAbsence(absence.ID)
+		notFound(t, "GetAbsence after deleting the teacher's absences", err)
+		late.ID, err = db.InsertAbsence(late)
+		noError(t, "InsertAbsence", err)
+		db.DeleteAbsencesForUser(student.ID)
+		absences, err = db.GetAbsencesForUser(student.ID)
+		noError(t, "GetAbsencesForUser", err)
+		equal(t, "absences after deleting the student's absences", len(absences), 0)
+	},
+}
+
+// equalGrades compares grades, with the time compared as an instant, as databases return it in different time zones.
+func equalGrades(t *testing.T, what string, got []sql.Grade, want []sql.Grade) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d grades, want %d", what, len(got), len(want))
+		return
+	}
+	for i := 0; i < len(got); i++ {
+		assert(t, what+": time of the grade", got[i].Date.Equal(want[i].Date))
+		got[i].Date = want[i].Date
+	}
+	equal(t, what, got, want)
+}
+
+var gradesCheck = check{
+	name: "grades",
+	methods: []string{"GetGrade", "GetGradesForUser", "GetGradesForUserInSubject", "CheckIfFinal", "InsertGrade",
+		"UpdateGrade", "DeleteGrade", "DeleteGradesByTeacherID", "DeleteGradesByUserID"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		student := newUser(t, db, "student")
+		subject := newSubject(t, db, teacher.ID, -1)
+		otherSubject := newSubject(t, db, teacher.ID, -1)
+
+		grade := sql.Grade{UserID: student.ID, TeacherID: teacher.ID, SubjectID: subject.ID, Grade: 4, Date: now(), IsWritten: true, Period: 1, Description: "Ulomki", CanPatch: true}
+		var err error
+		grade.ID, err = db.InsertGrade(grade)
+		noError(t, "InsertGrade", err)
+		final := sql.Grade{UserID: student.ID, TeacherID: teacher.ID, SubjectID: subject.ID, Grade: 5, Date: now(), IsFinal: true, Period: 2}
+		final.ID, err = db.InsertGrade(final)
+		noError(t, "InsertGrade", err)
+		other := sql.Grade{UserID: student.ID, TeacherID: teacher.ID, SubjectID: otherSubject.ID, Grade: 2, Date: now().Add(-48 * time.Hour), Period: 1}
+		other.ID, err = db.InsertGrade(other)
+		noError(t, "InsertGrade", err)
+
+		got, err := db.GetGrade(grade.ID)
+		noError(t, "GetGrade", err)
+		equalGrades(t, "grade", []sql.Grade{got}, []sql.Grade{grade})
+		grade.Grade = 3
+		grade.CanPatch = false
+		grade.Date = now().Add(time.Hour)
+		noError(t, "UpdateGrade", db.UpdateGrade(grade))
+		grades, err := db.GetGradesForUserInSubject(student.ID, subject.ID)
+		noError(t, "GetGradesForUserInSubject", err)
+		equalGrades(t, "grades in the subject", grades, []sql.Grade{grade, final})
+		grades, err = db.GetGradesForUser(student.ID)
+		noError(t, "GetGradesForUser", err)
+		equalGrades(t, "grades of the student", grades, []sql.Grade{grade, final, other})
+		got, err = db.CheckIfFinal(student.ID, subject.ID)
+		noError(t, "CheckIfFinal", err)
+		equalGrades(t, "final grade", []sql.Grade{got}, []sql.Grade{final})
+		_, err = db.CheckIfFinal(student.ID, otherSubject.ID)
+		notFound(t, "CheckIfFinal without a final grade", err)
+
+		noError(t, "DeleteGrade", db.DeleteGrade(final.ID))
+		_, err = db.GetGrade(final.ID)
+		notFound(t, "GetGrade of a deleted grade", err)
+		noError(t, "DeleteGradesByTeacherID", db.DeleteGradesByTeacherID(teacher.ID))
+		grades, err = db.GetGradesForUser(student.ID)
+		noError(t, "GetGradesForUser", err)
+		equal(t, "grades after deleting the teacher's grades", len(grades), 0)
+		_, err = db.InsertGrade(other)
+		noError(t, "InsertGrade", err)
+		noError(t, "DeleteGradesByUserID", db.DeleteGradesByUserID(student.ID))
+		grades, err = db.GetGradesForUser(student.ID)
+		noError(t, "GetGradesForUser", err)
+		equal(t, "grades after deleting the student's grades", len(grades), 0)
+	},
+}
+
+var homeworkCheck = check{
+	name: "homework",
+	methods: []string{"GetHomework", "GetHomeworkForSubject", "InsertHomework", "UpdateHomework", "DeleteHomework",
+		"GetStudentHomework", "GetStudentHomeworkForUser", "DeleteStudentHomeworkByStudentID", "GetHomeworkForTeacher",
+		"GetStudentsHomeworkByHomeworkID", "GetStudentsHomework", "InsertStudentHomework", "UpdateStudentHomework",
+		"DeleteStudentHomework", "DeleteStudentHomeworkByHomeworkID", "DeleteAllTeacherHomeworks"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		student := newUser(t, db, "student")
+		absent := newUser(t, db, "student")
+		class := newClass(t, db, teacher.ID)
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, student.ID))
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, absent.ID))
+		subject := newSubject(t, db, teacher.ID, class.ID)
+		meeting := newMeeting(t, db, subject, day("2031-10-01"), 1)
+		_, err := db.InsertAbsence(sql.Absence{UserID: absent.ID, TeacherID: teacher.ID, MeetingID: meeting.ID, AbsenceType: "ABSENT"})
+		noError(t, "InsertAbsence", err)
+
+		homework := sql.Homework{TeacherID: teacher.ID, SubjectID: subject.ID, Name: "Vaje", Description: "Stran 42", FromDate: day("2031-10-01"), ToDate: day("2031-10-08")}
+		homework.ID, err = db.InsertHomework(homework)
+		noError(t, "InsertHomework", err)
+		got, err := db.GetHomework(homework.ID)
+		noError(t, "GetHomework", err)
+		equal(t, "homework", got, homework)
+		homework.Name = "Vaje 2"
+		homework.ToDate = sql.Date{}
+		noError(t, "UpdateHomework", db.UpdateHomework(homework))
+		list, err := db.GetHomeworkForSubject(subject.ID)
+		noError(t, "GetHomeworkForSubject", err)
+		equal(t, "homework of the subject", list, []sql.Homework{homework})
+		list, err = db.GetHomeworkForTeacher(teacher.ID)
+		noError(t, "GetHomeworkForTeacher", err)
+		equal(t, "homework of the teacher", list, []sql.Homework{homework})
+
+		// Students' homework is created on the first lookup, with absent students marked
+		students, err := db.GetStudentsHomeworkByHomeworkID(homework.ID, meeting.ID)
+		noError(t, "GetStudentsHomeworkByHomeworkID", err)
+		equal(t, "students' homework", len(students), 2)
+		if len(students) == 2 {
+			equal(t, "status of the student", students[0].Status, "")
+			equal(t, "status of the absent student", students[1].Status, "ABSENT")
+			equal(t, "teacher name", students[1].TeacherName, teacher.Name)
+		}
+		again, err := db.GetStudentsHomeworkByHomeworkID(homework.ID, meeting.ID)
+		noError(t, "GetStudentsHomeworkByHomeworkID", err)
+		equal(t, "students' homework on the second lookup", again, students)
+
+		studentHomework, err := db.GetStudentHomeworkForUser(homework.ID, student.ID)
+		noError(t, "GetStudentHomeworkForUser", err)
+		studentHomework.Status = "DONE"
+		noError(t, "UpdateStudentHomework", db.UpdateStudentHomework(studentHomework))
+		gotStudentHomework, err := db.GetStudentHomework(studentHomework.ID)
+		noError(t, "GetStudentHomework", err)
+		equal(t, "student's homework", gotStudentHomework, studentHomework)
+		all, err := db.GetStudentsHomework(student.ID)
+		noError(t, "GetStudentsHomework", err)
+		equal(t, "all homework of the student", all, []sql.StudentHomework{studentHomework})
+
+		noError(t, "DeleteStudentHomework", db.DeleteStudentHomework(studentHomework.ID))
+		_, err = db.GetStudentHomework(studentHomework.ID)
+		notFound(t, "GetStudentHomework of deleted homework", err)
+		studentHomework.ID, err = db.InsertStudentHomework(studentHomework)
+		noError(t, "InsertStudentHomework", err)
+		noError(t, "DeleteStudentHomeworkByStudentID", db.DeleteStudentHomeworkByStudentID(student.ID))
+		all, err = db.GetStudentsHomework(student.ID)
+		noError(t, "GetStudentsHomework", err)
+		equal(t, "homework after deleting the student's homework", len(all), 0)
+		noError(t, "DeleteStudentHomeworkByHomeworkID", db.DeleteStudentHomeworkByHomeworkID(homework.ID))
+		all, err = db.GetStudentsHomework(absent.ID)
+		noError(t, "GetStudentsHomework", err)
+		equal(t, "homework after deleting the homework's rows", len(all), 0)
+
+		noError(t, "DeleteHomework", db.DeleteHomework(homework.ID))
+		_, err = db.GetHomework(homework.ID)
+		notFound(t, "GetHomework of deleted homework", err)
+		homework.ID, err = db.InsertHomework(homework)
+		noError(t, "InsertHomework", err)
+		db.DeleteAllTeacherHomeworks(teacher.ID)
+		list, err = db.GetHomeworkForTeacher(teacher.ID)
+		noError(t, "GetHomeworkForTeacher", err)
+		equal(t, "homework after deleting the teacher's homework", len(list), 0)
+	},
+}
+
+var selfTestingCheck = check{
+	name: "self-testing",
+	methods: []string{"UpdateTestingResult", "InsertTestingResult", "GetTestingResults", "GetAllTestingsForUser",
+		"GetTestingResult", "GetTestingResultByID", "DeleteTeacherSelfTesting", "DeleteUserSelfTesting"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		student := newUser(t, db, "student")
+		untested := newUser(t, db, "student")
+		class := newClass(t, db, teacher.ID)
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, student.ID))
+		noError(t, "AddStudentToClass", db.AddStudentToClass(class.ID, untested.ID))
+
+		date := day("2031-11-11")
+		testing := sql.Testing{UserID: student.ID, Date: date, TeacherID: teacher.ID, ClassID: class.ID, Result: "SE NE TESTIRA"}
+		var err error
+		testing.ID, err = db.InsertTestingResult(testing)
+		noError(t, "InsertTestingResult", err)
+		got, err := db.GetTestingResultByID(testing.ID)
+		noError(t, "GetTestingResultByID", err)
+		equal(t, "testing", got, testing)
+		testing.Result = "NEGATIVEN"
+		noError(t, "UpdateTestingResult", db.UpdateTestingResult(testing))
+		got, err = db.GetTestingResult(date, student.ID)
+		noError(t, "GetTestingResult", err)
+		equal(t, "testing on the date", got, testing)
+		_, err = db.GetTestingResult(date.AddDays(1), student.ID)
+		notFound(t, "GetTestingResult on another date", err)
+
+		results, err := db.GetTestingResults(date, class.ID)
+		noError(t, "GetTestingResults", err)
+		equal(t, "results of the class", len(results), 2)
+		if len(results) == 2 {
+			assert(t, "tested student is done", results[0].IsDone && results[0].ID == testing.ID && results[0].Date.Equal(date))
+			assert(t, "untested student isn't done", !results[1].IsDone && results[1].UserID == untested.ID)
+		}
+		all, err := db.GetAllTestingsForUser(student.ID)
+		noError(t, "GetAllTestingsForUser", err)
+		equal(t, "all testing of the student", all, []sql.Testing{testing})
+
+		noError(t, "DeleteTeacherSelfTesting", db.DeleteTeacherSelfTesting(teacher.ID))
+		_, err = db.GetTestingResultByID(testing.ID)
+		notFound(t, "GetTestingResultByID after deleting the teacher's tests", err)
+		_, err = db.InsertTestingResult(testing)
+		noError(t, "InsertTestingResult", err)
+		noError(t, "DeleteUserSelfTesting", db.DeleteUserSelfTesting(student.ID))
+		all, err = db.GetAllTestingsForUser(student.ID)
+		noError(t, "GetAllTestingsForUser", err)
+		equal(t, "testing after deleting the student's tests", len(all), 0)
+	},
+}
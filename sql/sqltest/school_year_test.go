@@ -0,0 +1,180 @@
+package sqltest
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"testing"
+)
+
+// outcomes maps students of an archived class to their outcome.
+func outcomes(students []sql.ArchivedClassStudent) map[int]string {
+	result := make(map[int]string)
+	for _, s := range students {
+		result[s.UserID] = s.Outcome
+	}
+	return result
+}
+
+// rolloverCheck rolls the whole database over, so it runs after the checks that need rows of the current year.
+// Fixture classes aren't named like 1.a, so the rollover leaves them unchanged.
+var rolloverCheck = check{
+	name: "school year rollover",
+	methods: []string{"PreviewRollover", "RollOver", "GetSchoolYears", "GetSchoolYear", "GetArchivedClasses",
+		"GetArchivedClassStudents", "GetArchivedClassesForStudent", "GetArchivedSubjects", "GetArchivedMeetingsForSubject",
+		"GetArchivedHomeworkForSubject", "GetArchivedGradesForUser", "GetArchivedAbsencesForUser",
+		"GetArchivedStudentHomeworkForUser"},
+	run: func(t *testing.T, db sql.SQL) {
+		admin := newUser(t, db, sql.AdminRole)
+		teacher := newUser(t, db, "teacher")
+		classes := make(map[string]sql.Class)
+		for _, name := range []string{"7.r", "8.r", "9.r"} {
+			class := sql.Class{Name: name, Teacher: teacher.ID, ClassYear: "2022/2023", LastSchoolDate: day("2023-06-23")}
+			var err error
+			class.ID, err = db.InsertClass(class)
+			noError(t, "InsertClass", err)
+			classes[name] = class
+		}
+		student := func(className string, passing bool) sql.User {
+			user := newUser(t, db, "student")
+			user.IsPassing = passing
+			noError(t, "UpdateUser", db.UpdateUser(user))
+			noError(t, "AddStudentToClass", db.AddStudentToClass(classes[className].ID, user.ID))
+			return user
+		}
+		seventh := student("7.r", true)
+		eighth := student("8.r", true)
+		eighthRetained := student("8.r", false)
+		ninth := student("9.r", true)
+		ninthRetained := student("9.r", false)
+
+		subject := newSubject(t, db, teacher.ID, classes["8.r"].ID)
+		finalSubject := newSubject(t, db, teacher.ID, classes["9.r"].ID)
+		// Elective subject of 8.r, attended by some of its students
+		elective := sql.Subject{TeacherID: teacher.ID, Name: unique("IP"), LongName: "Izbirni predmet", ClassID: classes["8.r"].ID}
+		var err error
+		elective.ID, err = db.InsertSubject(elective)
+		noError(t, "InsertSubject", err)
+		noError(t, "AddStudentToSubject", db.AddStudentToSubject(elective.ID, eighth.ID))
+		noError(t, "AddStudentToSubject", db.AddStudentToSubject(elective.ID, eighthRetained.ID))
+		_, _, err = db.NewSession(ninth, false)
+		noError(t, "NewSession", err)
+		meeting := newMeeting(t, db, subject, day("2023-03-06"), 2)
+		grade := sql.Grade{UserID: eighth.ID, TeacherID: teacher.ID, SubjectID: subject.ID, Grade: 5, Date: now(), Period: 2, IsFinal: true}
+		grade.ID, err = db.InsertGrade(grade)
+		noError(t, "InsertGrade", err)
+		_, err = db.InsertAbsence(sql.Absence{UserID: eighthRetained.ID, TeacherID: teacher.ID, MeetingID: meeting.ID, AbsenceType: "ABSENT"})
+		noError(t, "InsertAbsence", err)
+		homework := sql.Homework{TeacherID: teacher.ID, SubjectID: subject.ID, Name: "Vaje", FromDate: day("2023-03-06"), ToDate: day("2023-03-13")}
+		homework.ID, err = db.InsertHomework(homework)
+		noError(t, "InsertHomework", err)
+		_, err = db.InsertStudentHomework(sql.StudentHomework{UserID: eighth.ID, HomeworkID: homework.ID, Status: "DONE"})
+		noError(t, "InsertStudentHomework", err)
+
+		opts := sql.RolloverOptions{Year: "2022/2023", FinalGrade: 9, ArchivedBy: admin.ID}
+		plan, err := db.PreviewRollover(opts)
+		noError(t, "PreviewRollover", err)
+		equal(t, "blockers", plan.Blockers, []string{})
+		equal(t, "next year", plan.NextYear, "2023/2024")
+		planned := make(map[int]sql.RolloverClass)
+		for _, c := range plan.Classes {
+			planned[c.ClassID] = c
+		}
+		equal(t, "plan of 7.r", planned[classes["7.r"].ID], sql.RolloverClass{ClassID: classes["7.r"].ID, Name: "7.r", NewName: "8.r",
+			Promoted: []int{seventh.ID}, Graduated: []int{}, Retained: []int{}})
+		equal(t, "plan of 8.r", planned[classes["8.r"].ID], sql.RolloverClass{ClassID: classes["8.r"].ID, Name: "8.r", NewName: "9.r",
+			Promoted: []int{eighth.ID}, Graduated: []int{}, Retained: []int{eighthRetained.ID}, RetainedInto: classes["7.r"].ID, RetainedIntoName: "8.r"})
+		equal(t, "plan of 9.r", planned[classes["9.r"].ID], sql.RolloverClass{ClassID: classes["9.r"].ID, Name: "9.r", Removed: true,
+			Promoted: []int{}, Graduated: []int{ninth.ID}, Retained: []int{ninthRetained.ID}, RetainedInto: classes["8.r"].ID, RetainedIntoName: "9.r"})
+		assert(t, "subject of the final class is removed", len(plan.RemovedSubjects) != 0 && plan.RemovedSubjects[len(plan.RemovedSubjects)-1] == finalSubject.ID)
+		assert(t, "rows to archive", plan.Archived.Meetings >= 1 && plan.Archived.Grades >= 1 && plan.Archived.Homework >= 1)
+		_, err = db.GetSchoolYears()
+		noError(t, "GetSchoolYears", err)
+		renamed, err := db.GetClass(classes["7.r"].ID)
+		noError(t, "GetClass", err)
+		equal(t, "preview doesn't change anything", renamed.Name, "7.r")
+
+		plan, err = db.RollOver(opts)
+		noError(t, "RollOver", err)
+		year, err := db.GetSchoolYear(plan.SchoolYearID)
+		noError(t, "GetSchoolYear", err)
+		assert(t, "archived school year", year.Name == "2022/2023" && year.NextYear == "2023/2024" && year.ArchivedBy == admin.ID)
+		years, err := db.GetSchoolYears()
+		noError(t, "GetSchoolYears", err)
+		equal(t, "school years", years, []sql.SchoolYear{year})
+		_, err = db.RollOver(opts)
+		assert(t, "school year can't be archived twice", err != nil)
+
+		eighthClass, err := db.GetClass(classes["7.r"].ID)
+		noError(t, "GetClass", err)
+		assert(t, "7.r becomes 8.r of the next year", eighthClass.Name == "8.r" && eighthClass.ClassYear == "2023/2024" && eighthClass.LastSchoolDate.IsZero())
+		students, err := db.GetClassStudents(eighthClass.ID)
+		noError(t, "GetClassStudents", err)
+		equal(t, "students of the new 8.r", students, []int{seventh.ID, eighthRetained.ID})
+		ninthClass, err := db.GetClass(classes["8.r"].ID)
+		noError(t, "GetClass", err)
+		equal(t, "8.r becomes 9.r", ninthClass.Name, "9.r")
+		students, err = db.GetClassStudents(ninthClass.ID)
+		noError(t, "GetClassStudents", err)
+		equal(t, "students of the new 9.r", students, []int{eighth.ID, ninthRetained.ID})
+		_, err = db.GetClass(classes["9.r"].ID)
+		notFound(t, "GetClass of the graduated class", err)
+		_, err = db.GetSubject(finalSubject.ID)
+		notFound(t, "GetSubject of the graduated class", err)
+		_, err = db.GetSubject(subject.ID)
+		noError(t, "GetSubject of a promoted class", err)
+		graduate, err := db.GetUser(ninth.ID)
+		noError(t, "GetUser", err)
+		equal(t, "role of a graduate", graduate.Role, sql.GraduatedRole)
+		sessions, err := db.GetSessionsForUser(ninth.ID)
+		noError(t, "GetSessionsForUser", err)
+		equal(t, "sessions of a graduate", len(sessions), 0)
+		electiveStudents, err := db.GetSubjectStudents(elective)
+		noError(t, "GetSubjectStudents", err)
+		equal(t, "retained student leaves the elective of the promoted class", electiveStudents, []int{eighth.ID})
+		retained, err := db.GetUser(eighthRetained.ID)
+		noError(t, "GetUser", err)
+		assert(t, "retained student passes again", retained.IsPassing)
+
+		meetings, err := db.GetMeetings()
+		noError(t, "GetMeetings", err)
+		equal(t, "meetings after the rollover", len(meetings), 0)
+		grades, err := db.GetGradesForUser(eighth.ID)
+		noError(t, "GetGradesForUser", err)
+		equal(t, "grades after the rollover", len(grades), 0)
+
+		archivedClasses, err := db.GetArchivedClasses(year.ID)
+		noError(t, "GetArchivedClasses", err)
+		assert(t, "archived classes", len(archivedClasses) == plan.Archived.Classes)
+		archivedStudents, err := db.GetArchivedClassStudents(year.ID, classes["9.r"].ID)
+		noError(t, "GetArchivedClassStudents", err)
+		equal(t, "outcomes in 9.r", outcomes(archivedStudents), map[int]string{ninth.ID: sql.RolloverGraduated, ninthRetained.ID: sql.RolloverRetained})
+		memberships, err := db.GetArchivedClassesForStudent(eighth.ID)
+		noError(t, "GetArchivedClassesForStudent", err)
+		equal(t, "archived classes of a student", memberships, []sql.ArchivedClassStudent{
+			{SchoolYearID: year.ID, ClassID: classes["8.r"].ID, UserID: eighth.ID, IsPassing: true, Outcome: sql.RolloverPromoted}})
+		subjects, err := db.GetArchivedSubjects(year.ID)
+		noError(t, "GetArchivedSubjects", err)
+		equal(t, "archived subjects", len(subjects), plan.Archived.Subjects)
+		archivedMeetings, err := db.GetArchivedMeetingsForSubject(year.ID, subject.ID)
+		noError(t, "GetArchivedMeetingsForSubject", err)
+		assert(t, "archived meeting", len(archivedMeetings) == 1 && archivedMeetings[0].Meeting == meeting)
+		archivedHomework, err := db.GetArchivedHomeworkForSubject(year.ID, subject.ID)
+		noError(t, "GetArchivedHomeworkForSubject", err)
+		assert(t, "archived homework", len(archivedHomework) == 1 && archivedHomework[0].Homework == homework)
+		archivedGrades, err := db.GetArchivedGradesForUser(eighth.ID)
+		noError(t, "GetArchivedGradesForUser", err)
+		assert(t, "archived grade", len(archivedGrades) == 1 && archivedGrades[0].ID == grade.ID && archivedGrades[0].Grade.Grade == 5 && archivedGrades[0].IsFinal)
+		absences, err := db.GetArchivedAbsencesForUser(eighthRetained.ID)
+		noError(t, "GetArchivedAbsencesForUser", err)
+		assert(t, "archived absence", len(absences) == 1 && absences[0].MeetingID == meeting.ID)
+		studentHomework, err := db.GetArchivedStudentHomeworkForUser(eighth.ID)
+		noError(t, "GetArchivedStudentHomeworkForUser", err)
+		assert(t, "archived homework status", len(studentHomework) == 1 && studentHomework[0].Status == "DONE")
+
+		preview, err := db.PreviewUserDeletion(eighth.ID, sql.DeletionModeDelete)
+		noError(t, "PreviewUserDeletion", err)
+		equal(t, "archived rows of a student", preview.ArchivedRecords, 3)
+
+		// Reverting migrations afterwards needs meetings to convert
+		newMeeting(t, db, subject, day("2023-09-04"), 1)
+	},
+}
@@ -0,0 +1,168 @@
+package sqltest
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// noError stops the check when err isn't nil. The rest of the check usually depends on the call.
+func noError(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %s", what, err.Error())
+	}
+}
+
+// equal compares got and want deeply.
+func equal(t *testing.T, what string, got interface{}, want interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %+v, want %+v", what, got, want)
+	}
+}
+
+// assert fails the check when the condition doesn't hold.
+func assert(t *testing.T, what string, ok bool) {
+	t.Helper()
+	if !ok {
+		t.Errorf("%s doesn't hold", what)
+	}
+}
+
+// notFound fails the check unless err is the error of a lookup that didn't find anything.
+func notFound(t *testing.T, what string, err error) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("%s: expected no rows, got a result", what)
+	} else if err.Error() != "sql: no rows in result set" {
+		t.Errorf("%s: expected no rows, got %s", what, err.Error())
+	}
+}
+
+type check struct {
+	name string
+	// Methods of sql.SQL the check covers
+	methods []string
+	run     func(t *testing.T, db sql.SQL)
+}
+
+// checks run in this order. Migrations have to be the first, as the rest needs the schema, and the last,
+// so reverting migrations runs on a database with rows in every table.
+var checks = []check{
+	migrationsCheck,
+	usersCheck,
+	classesCheck,
+	subjectsCheck,
+	meetingsCheck,
+	timetableTemplatesCheck,
+	timetableDraftsCheck,
+	absencesCheck,
+	gradesCheck,
+	homeworkCheck,
+	selfTestingCheck,
+	communicationCheck,
+	mealsCheck,
+	notificationsCheck,
+	sessionsCheck,
+	signingKeysCheck,
+	twoFactorCheck,
+	passwordResetsCheck,
+	calendarFeedsCheck,
+	loginAttemptsCheck,
+	impersonationCheck,
+	rolesCheck,
+	importCheck,
+	childInvitationsCheck,
+	oidcStateCheck,
+	auditCheck,
+	userDeletionCheck,
+	rolloverCheck,
+	snapshotsCheck,
+	revertMigrationsCheck,
+}
+
+// TestChecksCoverSQL fails for methods of sql.SQL that aren't covered by any check.
+func TestChecksCoverSQL(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, c := range checks {
+		for _, m := range c.methods {
+			covered[m] = true
+		}
+	}
+	uncovered := make([]string, 0)
+	iface := reflect.TypeOf((*sql.SQL)(nil)).Elem()
+	for i := 0; i < iface.NumMethod(); i++ {
+		name := iface.Method(i).Name
+		if !covered[name] {
+			uncovered = append(uncovered, name)
+		}
+	}
+	sort.Strings(uncovered)
+	if len(uncovered) != 0 {
+		t.Errorf("methods without checks: %s", strings.Join(uncovered, ", "))
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	db, err := sql.NewSQL("sqlite3", filepath.Join(t.TempDir(), "meetplan.db"), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	runChecks(t, db)
+}
+
+func TestInMemorySQLite(t *testing.T) {
+	db, err := sql.NewInMemorySQLite(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	runChecks(t, db)
+}
+
+// TestPostgres runs the checks in a scratch schema of the database $MEETPLAN_TEST_POSTGRES points to, so they
+// don't need a database of their own. It's skipped when the variable isn't set.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("MEETPLAN_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("set $MEETPLAN_TEST_POSTGRES to a PostgreSQL DSN to check PostgreSQL")
+	}
+	schema, err := newPostgresSchema(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := schema.Drop()
+		if err != nil {
+			t.Errorf("dropping schema %s: %s", schema.Name, err.Error())
+		}
+	}()
+	db, err := sql.NewSQL("postgres", schema.DSN, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	runChecks(t, db)
+}
+
+// runChecks runs all checks against an empty database. It has to be empty, as the checks migrate it from scratch
+// and make assumptions about the rows in it.
+func runChecks(t *testing.T, db sql.SQL) {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Fatalf("database isn't empty, its schema version is %d", version)
+	}
+	db.SetAuditKey(auditKey)
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, db)
+		})
+	}
+}
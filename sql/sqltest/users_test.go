@@ -0,0 +1,162 @@
+package sqltest
+
+import (
+	"github.com/MeetPlan/MeetPlanBackend/sql"
+	"testing"
+	"time"
+)
+
+var usersCheck = check{
+	name: "users",
+	methods: []string{"GetUser", "InsertUser", "GetUserByEmail", "CheckIfAdminIsCreated", "GetAllUsers", "UpdateUser",
+		"GetTeachers", "GetPrincipal", "GetStudents", "GetChildren", "GetParents", "IsParentOf", "AddChildToParent",
+		"RemoveChildFromParent"},
+	run: func(t *testing.T, db sql.SQL) {
+		assert(t, "no admin exists in an empty database", !db.CheckIfAdminIsCreated())
+		admin := newUser(t, db, sql.AdminRole)
+		assert(t, "admin exists", db.CheckIfAdminIsCreated())
+
+		got, err := db.GetUser(admin.ID)
+		noError(t, "GetUser", err)
+		equal(t, "user", got, admin)
+		got, err = db.GetUserByEmail(admin.Email)
+		noError(t, "GetUserByEmail", err)
+		equal(t, "user by email", got, admin)
+		_, err = db.GetUser(admin.ID + 1000)
+		notFound(t, "GetUser of a missing user", err)
+
+		// Empty birthdays are stored as NULL
+		admin.Birthday = sql.Date{}
+		admin.TOTPSecret = "SECRET"
+		admin.TOTPEnabled = true
+		admin.TOTPLastStep = time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC).Unix() / sql.TOTPPeriod
+		admin.IsPassing = false
+		noError(t, "UpdateUser", db.UpdateUser(admin))
+		got, err = db.GetUser(admin.ID)
+		noError(t, "GetUser", err)
+		equal(t, "updated user", got, admin)
+
+		teacher := newUser(t, db, "teacher")
+		principal := newUser(t, db, "principal")
+		student := newUser(t, db, "student")
+		otherStudent := newUser(t, db, "student")
+		parent := newUser(t, db, "parent")
+
+		teachers, err := db.GetTeachers()
+		noError(t, "GetTeachers", err)
+		equal(t, "teachers", teachers, []sql.User{teacher})
+		got, err = db.GetPrincipal()
+		noError(t, "GetPrincipal", err)
+		equal(t, "principal", got, principal)
+		students, err := db.GetStudents()
+		noError(t, "GetStudents", err)
+		equal(t, "students", students, []sql.User{student, otherStudent})
+		users, err := db.GetAllUsers()
+		noError(t, "GetAllUsers", err)
+		equal(t, "all users", users, []sql.User{admin, teacher, principal, student, otherStudent, parent})
+
+		noError(t, "AddChildToParent", db.AddChildToParent(parent.ID, otherStudent.ID))
+		noError(t, "AddChildToParent", db.AddChildToParent(parent.ID, student.ID))
+		noError(t, "AddChildToParent twice", db.AddChildToParent(parent.ID, student.ID))
+		children, err := db.GetChildren(parent.ID)
+		noError(t, "GetChildren", err)
+		equal(t, "children", children, []int{student.ID, otherStudent.ID})
+		parents, err := db.GetParents(student.ID)
+		noError(t, "GetParents", err)
+		equal(t, "parents", parents, []int{parent.ID})
+		isParent, err := db.IsParentOf(parent.ID, student.ID)
+		noError(t, "IsParentOf", err)
+		assert(t, "parent is linked with the student", isParent)
+
+		noError(t, "RemoveChildFromParent", db.RemoveChildFromParent(parent.ID, student.ID))
+		isParent, err = db.IsParentOf(parent.ID, student.ID)
+		noError(t, "IsParentOf", err)
+		assert(t, "parent isn't linked with the student anymore", !isParent)
+		parents, err = db.GetParents(student.ID)
+		noError(t, "GetParents", err)
+		equal(t, "parents after removing", parents, []int{})
+	},
+}
+
+var childInvitationsCheck = check{
+	name: "child invitations",
+	methods: []string{"GetChildInvitationByCode", "GetChildInvitationsForStudent", "InsertChildInvitation",
+		"DeleteChildInvitations", "NewChildInvitation", "RedeemChildInvitation"},
+	run: func(t *testing.T, db sql.SQL) {
+		student := newUser(t, db, "student")
+		parent := newUser(t, db, "unverified")
+		teacher := newUser(t, db, "teacher")
+
+		code, err := db.NewChildInvitation(student.ID, teacher.ID)
+		noError(t, "NewChildInvitation", err)
+		invitation, err := db.GetChildInvitationByCode(code)
+		noError(t, "GetChildInvitationByCode", err)
+		equal(t, "invitation student", invitation.StudentID, student.ID)
+		assert(t, "code is stored hashed", invitation.Code != sql.NormalizeInvitationCode(code))
+
+		expired := sql.ChildInvitation{
+			StudentID: student.ID,
+			Code:      sql.HashToken("EXPIRED"),
+			CreatedBy: teacher.ID,
+			ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+			UsedBy:    -1,
+		}
+		expired.ID, err = db.InsertChildInvitation(expired)
+		noError(t, "InsertChildInvitation", err)
+		invitations, err := db.GetChildInvitationsForStudent(student.ID)
+		noError(t, "GetChildInvitationsForStudent", err)
+		equal(t, "invitations", invitations, []sql.ChildInvitation{invitation, expired})
+		_, err = db.RedeemChildInvitation("EXPIRED", parent)
+		assert(t, "expired invitation can't be redeemed", err != nil)
+
+		got, err := db.RedeemChildInvitation(code, parent)
+		noError(t, "RedeemChildInvitation", err)
+		equal(t, "redeemed student", got.ID, student.ID)
+		isParent, err := db.IsParentOf(parent.ID, student.ID)
+		noError(t, "IsParentOf", err)
+		assert(t, "parent is linked after redeeming", isParent)
+		parent, err = db.GetUser(parent.ID)
+		noError(t, "GetUser", err)
+		equal(t, "role after redeeming", parent.Role, "parent")
+		_, err = db.RedeemChildInvitation(code, newUser(t, db, "parent"))
+		assert(t, "invitation can't be redeemed twice", err != nil)
+
+		db.DeleteChildInvitations(student.ID)
+		invitations, err = db.GetChildInvitationsForStudent(student.ID)
+		noError(t, "GetChildInvitationsForStudent", err)
+		equal(t, "invitations after deleting", invitations, []sql.ChildInvitation{})
+	},
+}
+
+var importCheck = check{
+	name:    "import",
+	methods: []string{"ImportUsers"},
+	run: func(t *testing.T, db sql.SQL) {
+		teacher := newUser(t, db, "teacher")
+		parent := newUser(t, db, "parent")
+		existing := newClass(t, db, teacher.ID)
+		first := sql.User{Email: unique("import") + "@meetplan.invalid", Role: "student", Name: "Prvi", Birthday: day("2010-01-02")}
+		second := sql.User{Email: unique("import") + "@meetplan.invalid", Role: "student", Name: "Drugi"}
+		result, err := db.ImportUsers([]sql.ImportedStudent{
+			{Student: first, ClassID: existing.ID, ParentIDs: []int{parent.ID}},
+			{Student: second, ClassID: -1, NewClass: "1.z"},
+		}, []sql.Class{{Name: "1.z", Teacher: teacher.ID}})
+		noError(t, "ImportUsers", err)
+		equal(t, "imported students", len(result.Students), 2)
+		equal(t, "new classes", len(result.NewClasses), 1)
+
+		got, err := db.GetUser(result.Students[0].ID)
+		noError(t, "GetUser", err)
+		first.ID = got.ID
+		equal(t, "imported student", got, first)
+		students, err := db.GetClassStudents(existing.ID)
+		noError(t, "GetClassStudents", err)
+		equal(t, "students of the existing class", students, []int{result.Students[0].ID})
+		students, err = db.GetClassStudents(result.NewClasses[0].ID)
+		noError(t, "GetClassStudents", err)
+		equal(t, "students of the new class", students, []int{result.Students[1].ID})
+		children, err := db.GetChildren(parent.ID)
+		noError(t, "GetChildren", err)
+		equal(t, "children of the parent", children, []int{result.Students[0].ID})
+	},
+}
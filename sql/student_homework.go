@@ -1,7 +1,5 @@
 package sql
 
-import "encoding/json"
-
 type StudentHomework struct {
 	ID         int
 	UserID     int `db:"user_id"`
@@ -15,19 +13,6 @@ type StudentHomeworkJSON struct {
 	TeacherName string
 }
 
-func (db *sqlImpl) GetLastStudentHomeworkID() int {
-	var id int
-	err := db.db.Get(&id, "SELECT id FROM student_homework WHERE id = (SELECT MAX(id) FROM student_homework)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
 func (db *sqlImpl) GetStudentHomework(id int) (homework StudentHomework, err error) {
 	err = db.db.Get(&homework, "SELECT * FROM student_homework WHERE id=$1", id)
 	return homework, err
@@ -55,21 +40,9 @@ func (db *sqlImpl) GetStudentsHomeworkByHomeworkID(id int, meeetingId int) (home
 	if err != nil {
 		return make([]StudentHomeworkJSON, 0), err
 	}
-	var students []int
-	if subject.InheritsClass {
-		class, err := db.GetClass(subject.ClassID)
-		if err != nil {
-			return make([]StudentHomeworkJSON, 0), err
-		}
-		err = json.Unmarshal([]byte(class.Students), &students)
-		if err != nil {
-			return make([]StudentHomeworkJSON, 0), err
-		}
-	} else {
-		err := json.Unmarshal([]byte(subject.Students), &students)
-		if err != nil {
-			return make([]StudentHomeworkJSON, 0), err
-		}
+	students, err := db.GetSubjectStudents(subject)
+	if err != nil {
+		return make([]StudentHomeworkJSON, 0), err
 	}
 
 	teacher, err := db.GetUser(baseHomework.TeacherID)
@@ -100,16 +73,16 @@ func (db *sqlImpl) GetStudentsHomeworkByHomeworkID(id int, meeetingId int) (home
 						status = "ABSENT"
 					}
 				}
-				studentHomework := StudentHomework{ID: db.GetLastStudentHomeworkID(), UserID: students[i], HomeworkID: id, Status: status}
+				studentHomework := StudentHomework{UserID: students[i], HomeworkID: id, Status: status}
+				studentHomework.ID, err = db.InsertStudentHomework(studentHomework)
+				if err != nil {
+					return make([]StudentHomeworkJSON, 0), err
+				}
 				homework = append(homework, StudentHomeworkJSON{
 					StudentHomework: studentHomework,
 					Name:            student.Name,
 					TeacherName:     teacher.Name,
 				})
-				err = db.InsertStudentHomework(studentHomework)
-				if err != nil {
-					return make([]StudentHomeworkJSON, 0), err
-				}
 			} else {
 				return make([]StudentHomeworkJSON, 0), err
 			}
@@ -124,11 +97,10 @@ func (db *sqlImpl) GetStudentsHomeworkByHomeworkID(id int, meeetingId int) (home
 	return homework, err
 }
 
-func (db *sqlImpl) InsertStudentHomework(homework StudentHomework) error {
-	_, err := db.db.NamedExec(
-		"INSERT INTO student_homework (id, user_id, homework_id, status) VALUES (:id, :user_id, :homework_id, :status)",
+func (db *sqlImpl) InsertStudentHomework(homework StudentHomework) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO student_homework (user_id, homework_id, status) VALUES (:user_id, :homework_id, :status)",
 		homework)
-	return err
 }
 
 func (db *sqlImpl) UpdateStudentHomework(homework StudentHomework) error {
@@ -1,14 +1,11 @@
 package sql
 
-import "encoding/json"
-
 type Subject struct {
 	ID            int
 	TeacherID     int `db:"teacher_id"`
 	Name          string
-	InheritsClass bool `db:"inherits_class"`
-	ClassID       int  `db:"class_id"`
-	Students      string
+	InheritsClass bool   `db:"inherits_class"`
+	ClassID       int    `db:"class_id"`
 	LongName      string `db:"long_name"`
 	Realization   float32
 }
@@ -22,26 +19,13 @@ func contains(s []int, e int) bool {
 	return false
 }
 
-func (db *sqlImpl) GetLastSubjectID() int {
-	var id int
-	err := db.db.Get(&id, "SELECT id FROM subject WHERE id = (SELECT MAX(id) FROM subject)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
-}
-
 func (db *sqlImpl) GetSubject(id int) (subject Subject, err error) {
 	err = db.db.Get(&subject, "SELECT * FROM subject WHERE id=$1", id)
 	return subject, err
 }
 
 func (db *sqlImpl) GetSubjectsWithSpecificLongName(longName string) (subject []Subject, err error) {
-	err = db.db.Select(&subject, "SELECT * FROM subject WHERE long_name=$1", longName)
+	err = db.db.Select(&subject, "SELECT * FROM subject WHERE long_name=$1 ORDER BY id ASC", longName)
 	return subject, err
 }
 
@@ -55,73 +39,67 @@ func (db *sqlImpl) GetAllSubjects() (subject []Subject, err error) {
 	return subject, err
 }
 
+// GetAllSubjectsForUser returns subjects the student attends, either through the class the subject inherits
+// its students from or as a student of the subject itself.
 func (db *sqlImpl) GetAllSubjectsForUser(id int) (subjects []Subject, err error) {
-	subjectsAll, err := db.GetAllSubjects()
+	err = db.db.Select(&subjects,
+		"SELECT * FROM subject WHERE (inherits_class AND class_id IN (SELECT class_id FROM class_students WHERE user_id=$1)) OR (NOT inherits_class AND id IN (SELECT subject_id FROM subject_students WHERE user_id=$1)) ORDER BY id ASC",
+		id)
 	if err != nil {
 		return make([]Subject, 0), err
 	}
-	subjects = make([]Subject, 0)
-	for i := 0; i < len(subjectsAll); i++ {
-		subject := subjectsAll[i]
-		var users []int
-		if subject.InheritsClass {
-			class, err := db.GetClass(subject.ClassID)
-			if err != nil {
-				return make([]Subject, 0), err
-			}
-			err = json.Unmarshal([]byte(class.Students), &users)
-			if err != nil {
-				return make([]Subject, 0), err
-			}
-		} else {
-			err := json.Unmarshal([]byte(subject.Students), &users)
-			if err != nil {
-				return make([]Subject, 0), err
-			}
-		}
-		if contains(users, id) {
-			subjects = append(subjects, subject)
-		}
+	if subjects == nil {
+		subjects = make([]Subject, 0)
 	}
 	return subjects, nil
 }
 
-func (db *sqlImpl) InsertSubject(subject Subject) error {
-	_, err := db.db.NamedExec(
-		"INSERT INTO subject (id, teacher_id, name, inherits_class, class_id, students, long_name, realization) VALUES (:id, :teacher_id, :name, :inherits_class, :class_id, :students, :long_name, :realization)",
+func (db *sqlImpl) InsertSubject(subject Subject) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO subject (teacher_id, name, inherits_class, class_id, long_name, realization) VALUES (:teacher_id, :name, :inherits_class, :class_id, :long_name, :realization)",
 		subject)
-	return err
 }
 
 func (db *sqlImpl) UpdateSubject(subject Subject) error {
 	_, err := db.db.NamedExec(
-		"UPDATE subject SET teacher_id=:teacher_id, name=:name, inherits_class=:inherits_class, class_id=:class_id, students=:students, long_name=:long_name, realization=:realization WHERE id=:id",
+		"UPDATE subject SET teacher_id=:teacher_id, name=:name, inherits_class=:inherits_class, class_id=:class_id, long_name=:long_name, realization=:realization WHERE id=:id",
 		subject)
 	return err
 }
 
 func (db *sqlImpl) DeleteSubject(subject Subject) error {
-	_, err := db.db.NamedExec(
-		"DELETE FROM subject WHERE id=:id",
-		subject)
-	return err
+	return db.execAll([]string{
+		"DELETE FROM subject_students WHERE subject_id=$1",
+		"DELETE FROM timetable_templates WHERE subject_id=$1",
+		"DELETE FROM timetable_draft_lessons WHERE subject_id=$1",
+		"DELETE FROM subject WHERE id=$1",
+	}, subject.ID)
 }
 
 func (db *sqlImpl) DeleteStudentSubject(userId int) {
-	subjects, _ := db.GetAllSubjects()
-	for i := 0; i < len(subjects); i++ {
-		subject := subjects[i]
-		var users []int
-		json.Unmarshal([]byte(subject.Students), &users)
-		if subject.InheritsClass {
-			for n := 0; n < len(users); n++ {
-				if users[n] == userId {
-					users = remove(users, n)
-				}
-			}
-			marshal, _ := json.Marshal(users)
-			subject.Students = string(marshal)
-			db.UpdateSubject(subject)
-		}
+	db.db.Exec("DELETE FROM subject_students WHERE user_id=$1", userId)
+}
+
+// GetSubjectStudents returns IDs of the students attending the subject. Subjects that inherit the class
+// have the students of the class.
+func (db *sqlImpl) GetSubjectStudents(subject Subject) (students []int, err error) {
+	if subject.InheritsClass {
+		return db.GetClassStudents(subject.ClassID)
+	}
+	err = db.db.Select(&students, "SELECT user_id FROM subject_students WHERE subject_id=$1 ORDER BY user_id ASC", subject.ID)
+	if students == nil {
+		students = make([]int, 0)
 	}
+	return students, err
+}
+
+// AddStudentToSubject does nothing when the student already attends the subject.
+func (db *sqlImpl) AddStudentToSubject(subjectId int, userId int) error {
+	_, err := db.db.Exec("INSERT INTO subject_students (subject_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", subjectId, userId)
+	return err
+}
+
+func (db *sqlImpl) RemoveStudentFromSubject(subjectId int, userId int) error {
+	_, err := db.db.Exec("DELETE FROM subject_students WHERE subject_id=$1 AND user_id=$2", subjectId, userId)
+	return err
 }
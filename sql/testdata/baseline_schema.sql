@@ -1,6 +1,5 @@
-package sql
-
-const schema string = `
+-- Schema of databases created before the migration runner, without any of the columns the loose files in
+-- migrations/ used to add afterwards. See TestMigrateBaselineSchema.
 CREATE TABLE IF NOT EXISTS testing (
 	id           INTEGER                    PRIMARY KEY,
 	user_id      INTEGER                    NOT NULL,
@@ -124,4 +123,3 @@ CREATE TABLE IF NOT EXISTS notifications (
 	id                      INTEGER         PRIMARY KEY,
 	notification            VARCHAR(3000)
 );
-`
@@ -0,0 +1,221 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+)
+
+// UnavailableHour is an hour of the week in which the teacher can't teach.
+type UnavailableHour struct {
+	ID        int `json:"id"`
+	TeacherID int `db:"teacher_id" json:"teacher_id"`
+	// 0 is Sunday, the same as time.Weekday
+	Weekday int `json:"weekday"`
+	Hour    int `json:"hour"`
+}
+
+// TimetableDraft is a weekly timetable made by proton's generator. Its lessons only become timetable templates,
+// and with them meetings, once the draft is published. The generator's constraints are kept with the draft.
+type TimetableDraft struct {
+	ID             int   `json:"id"`
+	Seed           int64 `json:"seed"`
+	FromDate       Date  `db:"from_date" json:"from_date"`
+	ToDate         Date  `db:"to_date" json:"to_date"`
+	FirstHour      int   `db:"first_hour" json:"first_hour"`
+	LastHour       int   `db:"last_hour" json:"last_hour"`
+	MaxHoursPerDay int   `db:"max_hours_per_day" json:"max_hours_per_day"`
+	NoGaps         bool  `db:"no_gaps" json:"no_gaps"`
+	CreatedBy      int   `db:"created_by" json:"created_by"`
+	CreatedAt      int64 `db:"created_at" json:"created_at"`
+}
+
+// TimetableDraftLesson is a weekly lesson of a draft.
+type TimetableDraftLesson struct {
+	ID          int    `json:"id"`
+	DraftID     int    `db:"draft_id" json:"draft_id"`
+	SubjectID   int    `db:"subject_id" json:"subject_id"`
+	TeacherID   int    `db:"teacher_id" json:"teacher_id"`
+	MeetingName string `db:"meeting_name" json:"meeting_name"`
+	Weekday     int    `json:"weekday"`
+	Hour        int    `json:"hour"`
+}
+
+// Template returns the weekly template the lesson becomes when the draft is published.
+func (lesson TimetableDraftLesson) Template(draft TimetableDraft) TimetableTemplate {
+	return TimetableTemplate{
+		SubjectID:     lesson.SubjectID,
+		TeacherID:     lesson.TeacherID,
+		MeetingName:   lesson.MeetingName,
+		IsMandatory:   true,
+		Weekday:       lesson.Weekday,
+		Hour:          lesson.Hour,
+		IntervalWeeks: 1,
+		FromDate:      draft.FromDate,
+		ToDate:        draft.ToDate,
+	}
+}
+
+func (draft TimetableDraft) Validate() error {
+	if draft.FirstHour < 0 || draft.LastHour >= TimetableHours || draft.FirstHour > draft.LastHour {
+		return fmt.Errorf("hours have to be between 0 and %d", TimetableHours-1)
+	}
+	if draft.MaxHoursPerDay < 1 {
+		return errors.New("students need at least 1 hour per day")
+	}
+	// The dates are checked the same as the dates of templates
+	return TimetableTemplate{IntervalWeeks: 1, FromDate: draft.FromDate, ToDate: draft.ToDate}.Validate()
+}
+
+func (db *sqlImpl) GetUnavailableHours() (hours []UnavailableHour, err error) {
+	err = db.db.Select(&hours, "SELECT * FROM teacher_unavailability ORDER BY teacher_id ASC, weekday ASC, hour ASC")
+	if hours == nil {
+		hours = make([]UnavailableHour, 0)
+	}
+	return hours, err
+}
+
+func (db *sqlImpl) GetUnavailableHoursForTeacher(teacherId int) (hours []UnavailableHour, err error) {
+	err = db.db.Select(&hours, "SELECT * FROM teacher_unavailability WHERE teacher_id=$1 ORDER BY weekday ASC, hour ASC", teacherId)
+	if hours == nil {
+		hours = make([]UnavailableHour, 0)
+	}
+	return hours, err
+}
+
+// SetUnavailableHours replaces the hours in which the teacher can't teach.
+func (db *sqlImpl) SetUnavailableHours(teacherId int, hours []UnavailableHour) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("DELETE FROM teacher_unavailability WHERE teacher_id=$1", teacherId)
+	if err != nil {
+		return err
+	}
+	added := make(map[string]bool)
+	for i := 0; i < len(hours); i++ {
+		hour := hours[i]
+		hour.TeacherID = teacherId
+		if hour.Weekday < 0 || hour.Weekday > 6 || hour.Hour < 0 || hour.Hour >= TimetableHours {
+			return fmt.Errorf("invalid hour %d on weekday %d", hour.Hour, hour.Weekday)
+		}
+		key := fmt.Sprintf("%d-%d", hour.Weekday, hour.Hour)
+		if added[key] {
+			continue
+		}
+		added[key] = true
+		_, err = db.insert(tx, "INSERT INTO teacher_unavailability (teacher_id, weekday, hour) VALUES (:teacher_id, :weekday, :hour)", hour)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *sqlImpl) GetTimetableDraft(id int) (draft TimetableDraft, err error) {
+	err = db.db.Get(&draft, "SELECT * FROM timetable_drafts WHERE id=$1", id)
+	return draft, err
+}
+
+func (db *sqlImpl) GetTimetableDrafts() (drafts []TimetableDraft, err error) {
+	err = db.db.Select(&drafts, "SELECT * FROM timetable_drafts ORDER BY id DESC")
+	if drafts == nil {
+		drafts = make([]TimetableDraft, 0)
+	}
+	return drafts, err
+}
+
+func (db *sqlImpl) GetTimetableDraftLessons(draftId int) (lessons []TimetableDraftLesson, err error) {
+	err = db.db.Select(&lessons, "SELECT * FROM timetable_draft_lessons WHERE draft_id=$1 ORDER BY weekday ASC, hour ASC, id ASC", draftId)
+	if lessons == nil {
+		lessons = make([]TimetableDraftLesson, 0)
+	}
+	return lessons, err
+}
+
+// InsertTimetableDraft saves the draft together with its lessons.
+func (db *sqlImpl) InsertTimetableDraft(draft TimetableDraft, lessons []TimetableDraftLesson) (id int, err error) {
+	err = draft.Validate()
+	if err != nil {
+		return -1, err
+	}
+	tx, err := db.begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+	id, err = db.insert(tx,
+		`INSERT INTO timetable_drafts (seed, from_date, to_date, first_hour, last_hour, max_hours_per_day, no_gaps, created_by, created_at)
+			VALUES (:seed, :from_date, :to_date, :first_hour, :last_hour, :max_hours_per_day, :no_gaps, :created_by, :created_at)`,
+		draft)
+	if err != nil {
+		return -1, err
+	}
+	for i := 0; i < len(lessons); i++ {
+		lesson := lessons[i]
+		lesson.DraftID = id
+		_, err = db.insert(tx,
+			`INSERT INTO timetable_draft_lessons (draft_id, subject_id, teacher_id, meeting_name, weekday, hour)
+				VALUES (:draft_id, :subject_id, :teacher_id, :meeting_name, :weekday, :hour)`,
+			lesson)
+		if err != nil {
+			return -1, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+func (db *sqlImpl) DeleteTimetableDraft(id int) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("DELETE FROM timetable_draft_lessons WHERE draft_id=$1", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM timetable_drafts WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PublishTimetableDraft turns the draft's lessons into timetable templates and creates their meetings, except on
+// free days. Either the whole draft is published or nothing is. The draft is deleted afterwards.
+func (db *sqlImpl) PublishTimetableDraft(id int, freeDays []Date) (syncs []TemplateSync, err error) {
+	syncs = make([]TemplateSync, 0)
+	tx, err := db.begin()
+	if err != nil {
+		return syncs, err
+	}
+	defer tx.Rollback()
+	var draft TimetableDraft
+	err = tx.Get(&draft, "SELECT * FROM timetable_drafts WHERE id=$1", id)
+	if err != nil {
+		return syncs, err
+	}
+	var lessons []TimetableDraftLesson
+	err = tx.Select(&lessons, "SELECT * FROM timetable_draft_lessons WHERE draft_id=$1 ORDER BY weekday ASC, hour ASC, id ASC", id)
+	if err != nil {
+		return syncs, err
+	}
+	for i := 0; i < len(lessons); i++ {
+		sync, err := db.applyTimetableTemplate(tx, lessons[i].Template(draft), draft.FromDate, freeDays)
+		if err != nil {
+			return make([]TemplateSync, 0), err
+		}
+		syncs = append(syncs, sync)
+	}
+	_, err = tx.Exec("DELETE FROM timetable_draft_lessons WHERE draft_id=$1", id)
+	if err != nil {
+		return make([]TemplateSync, 0), err
+	}
+	_, err = tx.Exec("DELETE FROM timetable_drafts WHERE id=$1", id)
+	if err != nil {
+		return make([]TemplateSync, 0), err
+	}
+	return syncs, tx.Commit()
+}
@@ -0,0 +1,281 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TimetableHours is the number of school hours in a day, numbered from 0.
+const TimetableHours = 9
+
+// MaxTemplateDays limits how long a template can repeat, so a single template can't create meetings for years.
+const MaxTemplateDays = 366
+
+// TimetableTemplate is a lesson that repeats every IntervalWeeks weeks on the same weekday and hour between
+// FromDate and ToDate. Its meetings are created by ApplyTimetableTemplate and remember the template, so changes
+// of the template can be propagated to them.
+type TimetableTemplate struct {
+	ID          int    `json:"id"`
+	SubjectID   int    `db:"subject_id" json:"subject_id"`
+	TeacherID   int    `db:"teacher_id" json:"teacher_id"`
+	MeetingName string `db:"meeting_name" json:"meeting_name"`
+	URL         string `json:"url"`
+	Details     string `json:"details"`
+	IsMandatory bool   `db:"is_mandatory" json:"is_mandatory"`
+	// 0 is Sunday, the same as time.Weekday
+	Weekday int `json:"weekday"`
+	Hour    int `json:"hour"`
+	// 1 for weekly and 2 for biweekly lessons
+	IntervalWeeks int  `db:"interval_weeks" json:"interval_weeks"`
+	FromDate      Date `db:"from_date" json:"from_date"`
+	ToDate        Date `db:"to_date" json:"to_date"`
+}
+
+// TemplateSync lists meetings changed by applying or deleting a template.
+type TemplateSync struct {
+	Template TimetableTemplate `json:"template"`
+	Created  []int             `json:"created"`
+	Updated  []int             `json:"updated"`
+	Removed  []int             `json:"removed"`
+	// Detached meetings are off the template's schedule, but are kept as meetings on their own, as they have
+	// absences or were marked as gradings, tests or substitutions
+	Detached []int `json:"detached"`
+}
+
+func (template TimetableTemplate) Validate() error {
+	if template.Weekday < 0 || template.Weekday > 6 {
+		return errors.New("weekday has to be between 0 (Sunday) and 6 (Saturday)")
+	}
+	if template.Hour < 0 || template.Hour >= TimetableHours {
+		return fmt.Errorf("hour has to be between 0 and %d", TimetableHours-1)
+	}
+	if template.IntervalWeeks < 1 {
+		return errors.New("interval has to be at least 1 week")
+	}
+	if template.FromDate.IsZero() || template.ToDate.IsZero() {
+		return errors.New("template needs both the first and the last date")
+	}
+	if template.ToDate.Before(template.FromDate) || template.ToDate.After(template.FromDate.AddDays(MaxTemplateDays)) {
+		return fmt.Errorf("template can span from 1 to %d days", MaxTemplateDays+1)
+	}
+	return nil
+}
+
+// Dates returns the days the template's lesson takes place on, without the free days.
+func (template TimetableTemplate) Dates(freeDays []Date) []Date {
+	free := make(map[string]bool)
+	for i := 0; i < len(freeDays); i++ {
+		free[freeDays[i].String()] = true
+	}
+	dates := make([]Date, 0)
+	if template.IntervalWeeks < 1 {
+		return dates
+	}
+	offset := (template.Weekday - int(template.FromDate.Weekday()) + 7) % 7
+	for date := template.FromDate.AddDays(offset); !date.After(template.ToDate); date = date.AddDays(7 * template.IntervalWeeks) {
+		if !free[date.String()] {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// meeting returns the template's meeting on the date. Fields the template doesn't have are taken from the
+// existing meeting, so gradings, tests and substitutions stay marked.
+func (template TimetableTemplate) meeting(existing Meeting, date Date) Meeting {
+	meeting := existing
+	meeting.MeetingName = template.MeetingName
+	meeting.SubjectID = template.SubjectID
+	meeting.Hour = template.Hour
+	meeting.Date = date
+	meeting.IsMandatory = template.IsMandatory
+	meeting.URL = template.URL
+	meeting.Details = template.Details
+	meeting.TemplateID = template.ID
+	// Substitutions keep the substitute
+	if !existing.IsSubstitution {
+		meeting.TeacherID = template.TeacherID
+	}
+	return meeting
+}
+
+func (db *sqlImpl) GetTimetableTemplate(id int) (template TimetableTemplate, err error) {
+	err = db.db.Get(&template, "SELECT * FROM timetable_templates WHERE id=$1", id)
+	return template, err
+}
+
+func (db *sqlImpl) GetTimetableTemplates() (templates []TimetableTemplate, err error) {
+	err = db.db.Select(&templates, "SELECT * FROM timetable_templates ORDER BY weekday ASC, hour ASC, id ASC")
+	if templates == nil {
+		templates = make([]TimetableTemplate, 0)
+	}
+	return templates, err
+}
+
+func (db *sqlImpl) GetTimetableTemplatesForTeacher(teacherId int) (templates []TimetableTemplate, err error) {
+	err = db.db.Select(&templates, "SELECT * FROM timetable_templates WHERE teacher_id=$1 ORDER BY weekday ASC, hour ASC, id ASC", teacherId)
+	if templates == nil {
+		templates = make([]TimetableTemplate, 0)
+	}
+	return templates, err
+}
+
+func (db *sqlImpl) GetMeetingsForTemplate(templateId int) (meetings []Meeting, err error) {
+	err = db.db.Select(&meetings, "SELECT * FROM meetings WHERE template_id=$1 ORDER BY date ASC, id ASC", templateId)
+	if meetings == nil {
+		meetings = make([]Meeting, 0)
+	}
+	return meetings, err
+}
+
+// ApplyTimetableTemplate saves the template and brings its meetings from the date on in line with it, in a
+// single transaction. The template is inserted when its ID is 0. Meetings before the date are never changed,
+// as they already have absences and grades, so editing a template only affects the following lessons.
+//
+// Missing meetings are created, except on free days, and the others get the template's subject, teacher, hour
+// and description. Meetings that are off the schedule are removed, unless they have absences or were marked as
+// gradings, tests or substitutions. Those are detached from the template instead.
+func (db *sqlImpl) ApplyTimetableTemplate(template TimetableTemplate, from Date, freeDays []Date) (sync TemplateSync, err error) {
+	tx, err := db.begin()
+	if err != nil {
+		return sync, err
+	}
+	defer tx.Rollback()
+	sync, err = db.applyTimetableTemplate(tx, template, from, freeDays)
+	if err != nil {
+		return sync, err
+	}
+	return sync, tx.Commit()
+}
+
+func (db *sqlImpl) applyTimetableTemplate(tx database, template TimetableTemplate, from Date, freeDays []Date) (sync TemplateSync, err error) {
+	sync = TemplateSync{Created: make([]int, 0), Updated: make([]int, 0), Removed: make([]int, 0), Detached: make([]int, 0)}
+	err = template.Validate()
+	if err != nil {
+		return sync, err
+	}
+
+	if template.ID == 0 {
+		template.ID, err = db.insert(tx,
+			`INSERT INTO timetable_templates (subject_id, teacher_id, meeting_name, url, details, is_mandatory, weekday, hour, interval_weeks, from_date, to_date)
+				VALUES (:subject_id, :teacher_id, :meeting_name, :url, :details, :is_mandatory, :weekday, :hour, :interval_weeks, :from_date, :to_date)`,
+			template)
+	} else {
+		// Fails with no rows when the template doesn't exist
+		var id int
+		err = tx.Get(&id, "SELECT id FROM timetable_templates WHERE id=$1", template.ID)
+		if err == nil {
+			_, err = tx.NamedExec(
+				`UPDATE timetable_templates SET subject_id=:subject_id, teacher_id=:teacher_id, meeting_name=:meeting_name, url=:url,
+					details=:details, is_mandatory=:is_mandatory, weekday=:weekday, hour=:hour, interval_weeks=:interval_weeks,
+					from_date=:from_date, to_date=:to_date WHERE id=:id`,
+				template)
+		}
+	}
+	if err != nil {
+		return sync, err
+	}
+	sync.Template = template
+
+	var existing []Meeting
+	err = tx.Select(&existing, "SELECT * FROM meetings WHERE template_id=$1 AND date>=$2 ORDER BY date ASC, id ASC", template.ID, from)
+	if err != nil {
+		return sync, err
+	}
+	scheduled := make(map[string]bool)
+	dates := make([]Date, 0)
+	for _, date := range template.Dates(freeDays) {
+		if !date.Before(from) {
+			scheduled[date.String()] = true
+			dates = append(dates, date)
+		}
+	}
+	kept := make(map[string]bool)
+	for i := 0; i < len(existing); i++ {
+		meeting := existing[i]
+		date := meeting.Date.String()
+		if scheduled[date] && !kept[date] {
+			kept[date] = true
+			_, err = tx.NamedExec(
+				`UPDATE meetings SET meeting_name=:meeting_name, teacher_id=:teacher_id, subject_id=:subject_id, hour=:hour,
+					is_mandatory=:is_mandatory, url=:url, details=:details WHERE id=:id`,
+				template.meeting(meeting, meeting.Date))
+			if err != nil {
+				return sync, err
+			}
+			sync.Updated = append(sync.Updated, meeting.ID)
+			continue
+		}
+		err = removeTemplateMeeting(tx, meeting, &sync)
+		if err != nil {
+			return sync, err
+		}
+	}
+	for i := 0; i < len(dates); i++ {
+		if kept[dates[i].String()] {
+			continue
+		}
+		id, err := db.insert(tx,
+			`INSERT INTO meetings (meeting_name, teacher_id, subject_id, hour, date, is_mandatory, url, details, is_grading, is_written_assessment, is_test, is_substitution, template_id)
+				VALUES (:meeting_name, :teacher_id, :subject_id, :hour, :date, :is_mandatory, :url, :details, :is_grading, :is_written_assessment, :is_test, :is_substitution, :template_id)`,
+			template.meeting(Meeting{}, dates[i]))
+		if err != nil {
+			return sync, err
+		}
+		sync.Created = append(sync.Created, id)
+	}
+	return sync, nil
+}
+
+// DeleteTimetableTemplate deletes the template together with its meetings from the date on, the same as
+// ApplyTimetableTemplate removes meetings that are off the schedule. Earlier meetings are kept on their own.
+func (db *sqlImpl) DeleteTimetableTemplate(id int, from Date) (sync TemplateSync, err error) {
+	sync = TemplateSync{Created: make([]int, 0), Updated: make([]int, 0), Removed: make([]int, 0), Detached: make([]int, 0)}
+	tx, err := db.begin()
+	if err != nil {
+		return sync, err
+	}
+	defer tx.Rollback()
+	err = tx.Get(&sync.Template, "SELECT * FROM timetable_templates WHERE id=$1", id)
+	if err != nil {
+		return sync, err
+	}
+	var existing []Meeting
+	err = tx.Select(&existing, "SELECT * FROM meetings WHERE template_id=$1 AND date>=$2 ORDER BY date ASC, id ASC", id, from)
+	if err != nil {
+		return sync, err
+	}
+	for i := 0; i < len(existing); i++ {
+		err = removeTemplateMeeting(tx, existing[i], &sync)
+		if err != nil {
+			return sync, err
+		}
+	}
+	_, err = tx.Exec("UPDATE meetings SET template_id=0 WHERE template_id=$1", id)
+	if err != nil {
+		return sync, err
+	}
+	_, err = tx.Exec("DELETE FROM timetable_templates WHERE id=$1", id)
+	if err != nil {
+		return sync, err
+	}
+	return sync, tx.Commit()
+}
+
+// removeTemplateMeeting deletes a meeting that no longer belongs to its template, or detaches it when it
+// has data of its own.
+func removeTemplateMeeting(tx database, meeting Meeting, sync *TemplateSync) error {
+	var absences int
+	err := tx.Get(&absences, "SELECT COUNT(*) FROM absence WHERE meeting_id=$1", meeting.ID)
+	if err != nil {
+		return err
+	}
+	if absences != 0 || meeting.IsGrading || meeting.IsTest || meeting.IsSubstitution {
+		_, err = tx.Exec("UPDATE meetings SET template_id=0 WHERE id=$1", meeting.ID)
+		sync.Detached = append(sync.Detached, meeting.ID)
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM meetings WHERE id=$1", meeting.ID)
+	sync.Removed = append(sync.Removed, meeting.ID)
+	return err
+}
@@ -0,0 +1,83 @@
+package sql
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters as recommended by RFC 6238. Most authenticator apps only support these values.
+const (
+	TOTPPeriod = 30
+	TOTPDigits = 6
+	// Number of periods before and after current one that are still accepted, to account for clock drift.
+	TOTPSkew = 1
+)
+
+const TOTPIssuer = "MeetPlan"
+
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+func GetTOTPProvisioningURI(secret string, email string) string {
+	label := url.PathEscape(fmt.Sprintf("%s:%s", TOTPIssuer, email))
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", TOTPIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(TOTPDigits))
+	v.Set("period", fmt.Sprint(TOTPPeriod))
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
+
+// GetTOTPCode calculates the HOTP value (RFC 4226) for the specified time step.
+func GetTOTPCode(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, code%mod), nil
+}
+
+// ValidateTOTP checks the code against the secret and returns the time step that matched.
+// Callers should store the returned step and reject codes with step lower or equal to it, so codes can't be replayed.
+func ValidateTOTP(secret string, code string, t time.Time) (bool, int64) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return false, 0
+	}
+	current := t.Unix() / TOTPPeriod
+	for i := int64(-TOTPSkew); i <= TOTPSkew; i++ {
+		expected, err := GetTOTPCode(secret, current+i)
+		if err != nil {
+			return false, 0
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return true, current + i
+		}
+	}
+	return false, 0
+}
@@ -0,0 +1,127 @@
+package sql
+
+import (
+	"github.com/dchest/uniuri"
+	"strings"
+	"time"
+)
+
+const RecoveryCodeCount = 10
+
+type RecoveryCode struct {
+	ID     int
+	UserID int `db:"user_id"`
+	Code   string
+	IsUsed bool `db:"is_used"`
+}
+
+func (db *sqlImpl) GetRecoveryCodes(userId int) (codes []RecoveryCode, err error) {
+	err = db.db.Select(&codes, "SELECT * FROM recovery_codes WHERE user_id=$1 ORDER BY id ASC", userId)
+	if codes == nil {
+		codes = make([]RecoveryCode, 0)
+	}
+	return codes, err
+}
+
+func (db *sqlImpl) InsertRecoveryCode(code RecoveryCode) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO recovery_codes (user_id, code, is_used) VALUES (:user_id, :code, :is_used)",
+		code)
+}
+
+func (db *sqlImpl) UpdateRecoveryCode(code RecoveryCode) error {
+	_, err := db.db.NamedExec(
+		"UPDATE recovery_codes SET is_used=:is_used WHERE id=:id",
+		code)
+	return err
+}
+
+func (db *sqlImpl) DeleteRecoveryCodes(userId int) {
+	db.db.Exec("DELETE FROM recovery_codes WHERE user_id=$1", userId)
+}
+
+// GenerateRecoveryCodes replaces all existing recovery codes of the user with new ones.
+// Plaintext codes are returned only here, database only stores their hashes.
+func (db *sqlImpl) GenerateRecoveryCodes(userId int) ([]string, error) {
+	db.DeleteRecoveryCodes(userId)
+	var codes = make([]string, 0)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code := uniuri.NewLenChars(10, []byte("abcdefghijkmnpqrstuvwxyz23456789"))
+		_, err := db.InsertRecoveryCode(RecoveryCode{
+			UserID: userId,
+			Code:   HashToken(code),
+			IsUsed: false,
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// CheckTwoFactorCode accepts either a TOTP code or one of the unused recovery codes.
+// Used recovery codes and TOTP time steps are marked in the same statement that checks them, so they cannot be used
+// again, not even by requests running in parallel. Only user's ID and secret are read, so user may be stale.
+func (db *sqlImpl) CheckTwoFactorCode(user User, code string) (bool, error) {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	if code == "" || user.TOTPSecret == "" {
+		return false, nil
+	}
+	valid, step := ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if valid {
+		// Only the first request with the code can advance the last used step, others are replays
+		result, err := db.db.Exec("UPDATE users SET totp_last_step=$1 WHERE id=$2 AND COALESCE(totp_last_step, 0)<$1", step, user.ID)
+		if err != nil {
+			return false, err
+		}
+		changed, err := result.RowsAffected()
+		return changed == 1, err
+	}
+	result, err := db.db.Exec("UPDATE recovery_codes SET is_used=true WHERE user_id=$1 AND code=$2 AND is_used=false",
+		user.ID, HashToken(code))
+	if err != nil {
+		return false, err
+	}
+	changed, err := result.RowsAffected()
+	return changed != 0, err
+}
+
+func (db *sqlImpl) GetTwoFactorRoles() (roles []string, err error) {
+	err = db.db.Select(&roles, "SELECT role FROM two_factor_roles ORDER BY role ASC")
+	if roles == nil {
+		roles = make([]string, 0)
+	}
+	return roles, err
+}
+
+func (db *sqlImpl) SetTwoFactorRoles(roles []string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM two_factor_roles")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i := 0; i < len(roles); i++ {
+		_, err = tx.Exec("INSERT INTO two_factor_roles (role) VALUES ($1)", roles[i])
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *sqlImpl) IsTwoFactorRequired(role string) bool {
+	var count int
+	err := db.db.Get(&count, "SELECT COUNT(*) FROM two_factor_roles WHERE role=$1", role)
+	if err != nil {
+		db.logger.Info(err)
+		// Better be safe than sorry when it comes to privileged accounts
+		return true
+	}
+	return count > 0
+}
@@ -7,11 +7,13 @@ type User struct {
 	Role                   string
 	Name                   string
 	BirthCertificateNumber string `db:"birth_certificate_number"`
-	Birthday               string
+	Birthday               Date
 	CityOfBirth            string `db:"city_of_birth"`
 	CountryOfBirth         string `db:"country_of_birth"`
-	Users                  string
-	IsPassing              bool `db:"is_passing"`
+	IsPassing              bool   `db:"is_passing"`
+	TOTPSecret             string `db:"totp_secret"`
+	TOTPEnabled            bool   `db:"totp_enabled"`
+	TOTPLastStep           int64  `db:"totp_last_step"`
 }
 
 func (db *sqlImpl) GetUser(id int) (message User, err error) {
@@ -20,17 +22,17 @@ func (db *sqlImpl) GetUser(id int) (message User, err error) {
 }
 
 func (db *sqlImpl) GetTeachers() (message []User, err error) {
-	err = db.db.Select(&message, "SELECT * FROM users WHERE role='teacher'")
+	err = db.db.Select(&message, "SELECT * FROM users WHERE role='teacher' ORDER BY id ASC")
 	return message, err
 }
 
 func (db *sqlImpl) GetPrincipal() (principal User, err error) {
-	err = db.db.Get(&principal, "SELECT * FROM users WHERE role='principal'")
+	err = db.db.Get(&principal, "SELECT * FROM users WHERE role=$1 ORDER BY id ASC", PrincipalRole)
 	return principal, err
 }
 
 func (db *sqlImpl) GetStudents() (message []User, err error) {
-	err = db.db.Select(&message, "SELECT * FROM users WHERE role='student'")
+	err = db.db.Select(&message, "SELECT * FROM users WHERE role='student' ORDER BY id ASC")
 	return message, err
 }
 
@@ -39,23 +41,10 @@ func (db *sqlImpl) GetUserByEmail(email string) (message User, err error) {
 	return message, err
 }
 
-func (db *sqlImpl) InsertUser(user User) (err error) {
-	_, err = db.db.NamedExec(
-		"INSERT INTO users (id, email, pass, role, name, birth_certificate_number, city_of_birth, country_of_birth, birthday, users, is_passing) VALUES (:id, :email, :pass, :role, :name, :birth_certificate_number, :city_of_birth, :country_of_birth, :birthday, :users, :is_passing)",
+func (db *sqlImpl) InsertUser(user User) (id int, err error) {
+	return db.insert(db.db,
+		"INSERT INTO users (email, pass, role, name, birth_certificate_number, city_of_birth, country_of_birth, birthday, is_passing, totp_secret, totp_enabled, totp_last_step) VALUES (:email, :pass, :role, :name, :birth_certificate_number, :city_of_birth, :country_of_birth, :birthday, :is_passing, :totp_secret, :totp_enabled, :totp_last_step)",
 		user)
-	return err
-}
-
-func (db *sqlImpl) GetLastUserID() (id int) {
-	err := db.db.Get(&id, "SELECT id FROM users WHERE id = (SELECT MAX(id) FROM users)")
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return 0
-		}
-		db.logger.Info(err)
-		return -1
-	}
-	return id + 1
 }
 
 func (db *sqlImpl) CheckIfAdminIsCreated() bool {
@@ -69,32 +58,55 @@ func (db *sqlImpl) CheckIfAdminIsCreated() bool {
 }
 
 func (db *sqlImpl) GetAllUsers() (users []User, err error) {
-	err = db.db.Select(&users, "SELECT * FROM users")
+	err = db.db.Select(&users, "SELECT * FROM users ORDER BY id ASC")
 	return users, err
 }
 
+// UpdateUser never moves the last used TOTP step back while the secret stays the same, so updating a user that was
+// read before a code was used doesn't allow the code to be used again.
 func (db *sqlImpl) UpdateUser(user User) error {
 	_, err := db.db.NamedExec(
-		"UPDATE users SET pass=:pass, name=:name, role=:role, email=:email, birth_certificate_number=:birth_certificate_number, city_of_birth=:city_of_birth, country_of_birth=:country_of_birth, birthday=:birthday, users=:users, is_passing=:is_passing WHERE id=:id",
+		"UPDATE users SET pass=:pass, name=:name, role=:role, email=:email, birth_certificate_number=:birth_certificate_number, city_of_birth=:city_of_birth, country_of_birth=:country_of_birth, birthday=:birthday, is_passing=:is_passing, totp_secret=:totp_secret, totp_enabled=:totp_enabled, totp_last_step=CASE WHEN totp_secret=:totp_secret AND totp_last_step>:totp_last_step THEN totp_last_step ELSE :totp_last_step END WHERE id=:id",
 		user)
 	return err
 }
 
+// DeleteUser hard-deletes the user with everything stored about them (see DeleteUserData).
 func (db *sqlImpl) DeleteUser(ID int) error {
-	db.DeleteAllTeacherHomeworks(ID)
-	db.DeleteStudentHomeworkByStudentID(ID)
-	db.DeleteGradesByTeacherID(ID)
-	db.DeleteGradesByUserID(ID)
-	db.DeleteUserCommunications(ID)
-	db.DeleteAbsencesForUser(ID)
-	db.DeleteAbsencesForTeacher(ID)
-	db.DeleteTeacherClasses(ID)
-	db.DeleteUserClasses(ID)
-	db.DeleteMeetingsForTeacher(ID)
-	db.DeleteUserSelfTesting(ID)
-	db.DeleteTeacherSelfTesting(ID)
-	db.DeleteStudentSubject(ID)
-
-	_, err := db.db.Exec("DELETE FROM users WHERE id=$1", ID)
+	_, err := db.DeleteUserData(ID, DeletionModeDelete)
+	return err
+}
+
+// GetChildren returns IDs of the students linked with the parent.
+func (db *sqlImpl) GetChildren(parentId int) (children []int, err error) {
+	err = db.db.Select(&children, "SELECT student_id FROM parent_children WHERE parent_id=$1 ORDER BY student_id ASC", parentId)
+	if children == nil {
+		children = make([]int, 0)
+	}
+	return children, err
+}
+
+// GetParents returns IDs of the parents linked with the student.
+func (db *sqlImpl) GetParents(studentId int) (parents []int, err error) {
+	err = db.db.Select(&parents, "SELECT parent_id FROM parent_children WHERE student_id=$1 ORDER BY parent_id ASC", studentId)
+	if parents == nil {
+		parents = make([]int, 0)
+	}
+	return parents, err
+}
+
+func (db *sqlImpl) IsParentOf(parentId int, studentId int) (bool, error) {
+	n, err := count(db.db, "SELECT COUNT(*) FROM parent_children WHERE parent_id=$1 AND student_id=$2", parentId, studentId)
+	return n != 0, err
+}
+
+// AddChildToParent does nothing when the student is already linked with the parent.
+func (db *sqlImpl) AddChildToParent(parentId int, studentId int) error {
+	_, err := db.db.Exec("INSERT INTO parent_children (parent_id, student_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", parentId, studentId)
+	return err
+}
+
+func (db *sqlImpl) RemoveChildFromParent(parentId int, studentId int) error {
+	_, err := db.db.Exec("DELETE FROM parent_children WHERE parent_id=$1 AND student_id=$2", parentId, studentId)
 	return err
 }
@@ -0,0 +1,317 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const (
+	// DeletionModeDelete removes the user and everything stored about them
+	DeletionModeDelete = "delete"
+	// DeletionModeAnonymize removes personal data, but keeps grades, absences and class memberships,
+	// so school statistics stay intact
+	DeletionModeAnonymize = "anonymize"
+)
+
+const AnonymizedUserName = "Izbrisan uporabnik"
+
+// LegalHold prevents the user from being deleted or anonymized, for example during a dispute over grades.
+type LegalHold struct {
+	UserID    int    `db:"user_id" json:"user_id"`
+	Reason    string `json:"reason"`
+	CreatedBy int    `db:"created_by" json:"created_by"`
+	CreatedAt int64  `db:"created_at" json:"created_at"`
+}
+
+// DeletionPreview lists everything deleting or anonymizing the user affects. Nothing is changed when Blockers
+// aren't empty.
+type DeletionPreview struct {
+	UserID    int        `json:"user_id"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	Mode      string     `json:"mode"`
+	LegalHold *LegalHold `json:"legal_hold"`
+
+	// Rows removed in delete mode and kept in anonymize mode
+	Grades          int `json:"grades"`
+	Absences        int `json:"absences"`
+	StudentHomework int `json:"student_homework"`
+	SelfTesting     int `json:"self_testing"`
+	// Grades, absences, homework and class memberships in archived school years
+	ArchivedRecords int `json:"archived_records"`
+	// Classes and subjects the user is removed from (only in delete mode)
+	Classes  []int `json:"classes"`
+	Subjects []int `json:"subjects"`
+	// Meals the user's orders are removed from (only in delete mode)
+	MealOrders []int `json:"meal_orders"`
+
+	// Always removed
+	ParentLinks    []int `json:"parent_links"`
+	Children       []int `json:"children"`
+	Communications []int `json:"communications"`
+	Messages       int   `json:"messages"`
+	Sessions       int   `json:"sessions"`
+	Invitations    int   `json:"invitations"`
+
+	// Data of other users the user is responsible for, including archived school years. It can't be hard-deleted
+	// without destroying their records.
+	TaughtClasses    []int `json:"taught_classes"`
+	TaughtSubjects   []int `json:"taught_subjects"`
+	Meetings         int   `json:"meetings"`
+	Homework         int   `json:"homework"`
+	GradesGiven      int   `json:"grades_given"`
+	AbsencesRecorded int   `json:"absences_recorded"`
+	TestsPerformed   int   `json:"tests_performed"`
+
+	Blockers []string `json:"blockers"`
+}
+
+func (db *sqlImpl) GetLegalHold(userId int) (hold LegalHold, err error) {
+	err = db.db.Get(&hold, "SELECT * FROM legal_holds WHERE user_id=$1", userId)
+	return hold, err
+}
+
+func (db *sqlImpl) GetLegalHolds() (holds []LegalHold, err error) {
+	err = db.db.Select(&holds, "SELECT * FROM legal_holds ORDER BY created_at ASC")
+	if holds == nil {
+		holds = make([]LegalHold, 0)
+	}
+	return holds, err
+}
+
+// SetLegalHold places the user on legal hold or updates the reason of an existing hold.
+func (db *sqlImpl) SetLegalHold(hold LegalHold) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM legal_holds WHERE user_id=$1", hold.UserID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.NamedExec(
+		"INSERT INTO legal_holds (user_id, reason, created_by, created_at) VALUES (:user_id, :reason, :created_by, :created_at)",
+		hold)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *sqlImpl) DeleteLegalHold(userId int) error {
+	_, err := db.db.Exec("DELETE FROM legal_holds WHERE user_id=$1", userId)
+	return err
+}
+
+func count(q sqlx.Queryer, query string, args ...interface{}) (n int, err error) {
+	err = sqlx.Get(q, &n, query, args...)
+	return n, err
+}
+
+func previewUserDeletion(q sqlx.Queryer, userId int, mode string) (preview DeletionPreview, err error) {
+	if mode != DeletionModeDelete && mode != DeletionModeAnonymize {
+		return preview, fmt.Errorf("unknown deletion mode %s", mode)
+	}
+	var user User
+	err = sqlx.Get(q, &user, "SELECT * FROM users WHERE id=$1", userId)
+	if err != nil {
+		return preview, err
+	}
+	preview = DeletionPreview{
+		UserID:         user.ID,
+		Name:           user.Name,
+		Role:           user.Role,
+		Mode:           mode,
+		Classes:        make([]int, 0),
+		Subjects:       make([]int, 0),
+		MealOrders:     make([]int, 0),
+		ParentLinks:    make([]int, 0),
+		Children:       make([]int, 0),
+		Communications: make([]int, 0),
+		TaughtClasses:  make([]int, 0),
+		TaughtSubjects: make([]int, 0),
+		Blockers:       make([]string, 0),
+	}
+	var hold LegalHold
+	err = sqlx.Get(q, &hold, "SELECT * FROM legal_holds WHERE user_id=$1", userId)
+	if err == nil {
+		preview.LegalHold = &hold
+		preview.Blockers = append(preview.Blockers, "user is on legal hold: "+hold.Reason)
+	} else if err.Error() != "sql: no rows in result set" {
+		return preview, err
+	}
+
+	counts := []struct {
+		target *int
+		query  string
+	}{
+		{&preview.Grades, "SELECT COUNT(*) FROM grades WHERE user_id=$1"},
+		{&preview.Absences, "SELECT COUNT(*) FROM absence WHERE user_id=$1"},
+		{&preview.StudentHomework, "SELECT COUNT(*) FROM student_homework WHERE user_id=$1"},
+		{&preview.SelfTesting, "SELECT COUNT(*) FROM testing WHERE user_id=$1"},
+		{&preview.ArchivedRecords, "SELECT (SELECT COUNT(*) FROM archived_grades WHERE user_id=$1) + (SELECT COUNT(*) FROM archived_absences WHERE user_id=$1) + (SELECT COUNT(*) FROM archived_student_homework WHERE user_id=$1) + (SELECT COUNT(*) FROM archived_class_students WHERE user_id=$1)"},
+		{&preview.Messages, "SELECT COUNT(*) FROM message WHERE user_id=$1"},
+		{&preview.Sessions, "SELECT COUNT(*) FROM sessions WHERE user_id=$1"},
+		{&preview.Invitations, "SELECT COUNT(*) FROM child_invitations WHERE student_id=$1"},
+		{&preview.Meetings, "SELECT (SELECT COUNT(*) FROM meetings WHERE teacher_id=$1) + (SELECT COUNT(*) FROM archived_meetings WHERE teacher_id=$1)"},
+		{&preview.Homework, "SELECT (SELECT COUNT(*) FROM homework WHERE teacher_id=$1) + (SELECT COUNT(*) FROM archived_homework WHERE teacher_id=$1)"},
+		{&preview.GradesGiven, "SELECT (SELECT COUNT(*) FROM grades WHERE teacher_id=$1 AND user_id<>$1) + (SELECT COUNT(*) FROM archived_grades WHERE teacher_id=$1 AND user_id<>$1)"},
+		{&preview.AbsencesRecorded, "SELECT (SELECT COUNT(*) FROM absence WHERE teacher_id=$1 AND user_id<>$1) + (SELECT COUNT(*) FROM archived_absences WHERE teacher_id=$1 AND user_id<>$1)"},
+		{&preview.TestsPerformed, "SELECT COUNT(*) FROM testing WHERE teacher_id=$1 AND user_id<>$1"},
+	}
+	for _, c := range counts {
+		*c.target, err = count(q, c.query, userId)
+		if err != nil {
+			return preview, err
+		}
+	}
+
+	lists := []struct {
+		target *[]int
+		query  string
+	}{
+		{&preview.TaughtClasses, "SELECT id FROM classes WHERE teacher=$1 ORDER BY id ASC"},
+		{&preview.TaughtSubjects, "SELECT id FROM subject WHERE teacher_id=$1 ORDER BY id ASC"},
+		{&preview.Classes, "SELECT class_id FROM class_students WHERE user_id=$1 ORDER BY class_id ASC"},
+		{&preview.Subjects, "SELECT subject_id FROM subject_students WHERE user_id=$1 ORDER BY subject_id ASC"},
+		{&preview.MealOrders, "SELECT meal_id FROM meal_orders WHERE user_id=$1 ORDER BY meal_id ASC"},
+		{&preview.ParentLinks, "SELECT parent_id FROM parent_children WHERE student_id=$1 ORDER BY parent_id ASC"},
+		{&preview.Children, "SELECT student_id FROM parent_children WHERE parent_id=$1 ORDER BY student_id ASC"},
+		{&preview.Communications, "SELECT communication_id FROM communication_people WHERE user_id=$1 ORDER BY communication_id ASC"},
+	}
+	for _, l := range lists {
+		err = sqlx.Select(q, l.target, l.query, userId)
+		if err != nil {
+			return preview, err
+		}
+	}
+
+	if user.Role == AdminRole {
+		preview.Blockers = append(preview.Blockers, "administrator can't be deleted")
+	}
+	if mode == DeletionModeDelete {
+		if len(preview.TaughtClasses) != 0 || len(preview.TaughtSubjects) != 0 {
+			preview.Blockers = append(preview.Blockers, "user still teaches classes or subjects, reassign them first")
+		}
+		if preview.Meetings != 0 || preview.Homework != 0 || preview.GradesGiven != 0 || preview.AbsencesRecorded != 0 || preview.TestsPerformed != 0 {
+			preview.Blockers = append(preview.Blockers, "user has created records of other users, anonymize the user instead")
+		}
+	}
+	return preview, nil
+}
+
+func (db *sqlImpl) PreviewUserDeletion(userId int, mode string) (DeletionPreview, error) {
+	return previewUserDeletion(db.db, userId, mode)
+}
+
+// DeleteUserData deletes or anonymizes the user in a single transaction. The preview is computed again inside
+// the transaction, so the result matches what actually happened. Personal data in the audit log is redacted
+// by the audited database (see redactAuditedUser), which records the redaction.
+func (db *sqlImpl) DeleteUserData(userId int, mode string) (preview DeletionPreview, err error) {
+	tx, err := db.begin()
+	if err != nil {
+		return preview, err
+	}
+	preview, err = previewUserDeletion(tx, userId, mode)
+	if err != nil {
+		tx.Rollback()
+		return preview, err
+	}
+	if len(preview.Blockers) != 0 {
+		tx.Rollback()
+		return preview, errors.New(preview.Blockers[0])
+	}
+	if mode == DeletionModeDelete {
+		err = deleteUserData(tx, preview)
+	} else {
+		err = anonymizeUserData(tx, preview)
+	}
+	if err != nil {
+		tx.Rollback()
+		return preview, err
+	}
+	return preview, tx.Commit()
+}
+
+// removePersonalLinks removes data about the user that has to go in both modes.
+func removePersonalLinks(tx database, preview DeletionPreview) error {
+	var email string
+	err := tx.Get(&email, "SELECT email FROM users WHERE id=$1", preview.UserID)
+	if err != nil {
+		return err
+	}
+	// Throttles are keyed by the email instead of the user
+	_, err = tx.Exec("DELETE FROM login_throttles WHERE throttle_key IN ($1, $2)",
+		AccountThrottleKey(email), PasswordResetThrottleKey(email))
+	if err != nil {
+		return err
+	}
+	queries := []string{
+		"DELETE FROM parent_children WHERE parent_id=$1 OR student_id=$1",
+		"DELETE FROM communication_people WHERE user_id=$1",
+		"DELETE FROM message_seen WHERE user_id=$1 OR message_id IN (SELECT id FROM message WHERE user_id=$1)",
+		"DELETE FROM message WHERE user_id=$1",
+		"DELETE FROM sessions WHERE user_id=$1",
+		"DELETE FROM recovery_codes WHERE user_id=$1",
+		"DELETE FROM password_resets WHERE user_id=$1",
+		"DELETE FROM calendar_feeds WHERE user_id=$1",
+		"DELETE FROM teacher_unavailability WHERE teacher_id=$1",
+		"DELETE FROM child_invitations WHERE student_id=$1",
+		"UPDATE login_attempts SET email='' WHERE user_id=$1",
+	}
+	for i := 0; i < len(queries); i++ {
+		_, err := tx.Exec(queries[i], preview.UserID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteUserData(tx database, preview DeletionPreview) error {
+	userId := preview.UserID
+	err := removePersonalLinks(tx, preview)
+	if err != nil {
+		return err
+	}
+	queries := []string{
+		"DELETE FROM class_students WHERE user_id=$1",
+		"DELETE FROM subject_students WHERE user_id=$1",
+		"DELETE FROM meal_orders WHERE user_id=$1",
+		"DELETE FROM grades WHERE user_id=$1",
+		"DELETE FROM absence WHERE user_id=$1",
+		"DELETE FROM student_homework WHERE user_id=$1",
+		"DELETE FROM testing WHERE user_id=$1",
+		"DELETE FROM archived_grades WHERE user_id=$1",
+		"DELETE FROM archived_absences WHERE user_id=$1",
+		"DELETE FROM archived_student_homework WHERE user_id=$1",
+		"DELETE FROM archived_class_students WHERE user_id=$1",
+		"DELETE FROM users WHERE id=$1",
+	}
+	for i := 0; i < len(queries); i++ {
+		_, err = tx.Exec(queries[i], userId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func anonymizeUserData(tx database, preview DeletionPreview) error {
+	err := removePersonalLinks(tx, preview)
+	if err != nil {
+		return err
+	}
+	// Empty password hash never matches, so the account can't be logged into anymore
+	_, err = tx.Exec(
+		"UPDATE users SET email=$1, pass='', name=$2, birth_certificate_number='', birthday=NULL, city_of_birth='', country_of_birth='', totp_secret='', totp_enabled=false, totp_last_step=0 WHERE id=$3",
+		fmt.Sprintf("anonymized-%d-%d@meetplan.invalid", preview.UserID, time.Now().Unix()),
+		AnonymizedUserName,
+		preview.UserID,
+	)
+	return err
+}